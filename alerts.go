@@ -0,0 +1,171 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+)
+
+// CaptureAlerts optionally alerts about problems of running capture streams,
+// so that monitoring wrappers can react to them instead of discovering gaps
+// in packet captures after the fact. The callbacks get called from the
+// goroutines streaming the capture data or from timer goroutines, so they
+// must not block.
+type CaptureAlerts struct {
+	// StallAfter is the length of time without any capture data arriving
+	// after which OnStall gets called, once per stall. Zero disables stall
+	// alerts.
+	StallAfter time.Duration
+	// OnStall gets called when the capture stream stalls, with the length of
+	// time since capture data arrived last.
+	OnStall func(stalled time.Duration)
+	// SlowWrite is the duration writing capture data to the writer might take
+	// at most before OnSlowWrite gets called. Zero disables slow write
+	// alerts.
+	SlowWrite time.Duration
+	// OnSlowWrite gets called when the writer falls behind, with the length
+	// of time writing capture data took.
+	OnSlowWrite func(took time.Duration)
+	// OnDrop gets called when the interface statistics sent by the capture
+	// service report increased numbers of dropped packets.
+	OnDrop func(drop DropAlert)
+}
+
+// DropAlert describes the increase in the number of dropped packets of a
+// network interface, as reported by the capture service.
+type DropAlert struct {
+	// Name of the network interface, if known.
+	Interface string
+	// Total number of packets dropped so far.
+	Dropped uint64
+	// Number of packets dropped since the previous report.
+	Delta uint64
+}
+
+// AlertWriter passes the capture stream data written to it on to its sink,
+// watching the capture stream for stalls, slow writes, and dropped packets
+// as configured by its capture alerts.
+type AlertWriter struct {
+	sink    io.Writer
+	alerts  *CaptureAlerts
+	scanner *pcapng.Scanner // scans for interface statistics, if necessary.
+
+	mu      sync.Mutex
+	last    time.Time   // capture data arrived or got written last.
+	writing bool        // currently writing to the sink, so not stalling.
+	watch   *time.Timer // stall watchdog, if any.
+	dropped map[uint32]uint64
+}
+
+var _ io.Writer = (*AlertWriter)(nil)
+
+// NewAlertWriter returns a new AlertWriter writing to the specified sink. The
+// caller must call Finish after the capture stream has ended, in order to
+// stop watching for stalls.
+func NewAlertWriter(sink io.Writer, alerts *CaptureAlerts) *AlertWriter {
+	aw := &AlertWriter{
+		sink:    sink,
+		alerts:  alerts,
+		last:    time.Now(),
+		dropped: map[uint32]uint64{},
+	}
+	if alerts.OnDrop != nil {
+		aw.scanner = pcapng.NewScanner(aw.scan)
+	}
+	if alerts.OnStall != nil && alerts.StallAfter > 0 {
+		aw.watch = time.AfterFunc(alerts.StallAfter, aw.stalled)
+	}
+	return aw
+}
+
+// Write writes the capture stream data to the sink.
+func (aw *AlertWriter) Write(p []byte) (int, error) {
+	aw.mu.Lock()
+	aw.writing = true
+	aw.mu.Unlock()
+	start := time.Now()
+	n, err := aw.sink.Write(p)
+	// A slow writer isn't a stalled capture stream, so only start watching
+	// for stalls again after writing.
+	aw.mu.Lock()
+	aw.writing = false
+	aw.last = time.Now()
+	if aw.watch != nil {
+		aw.watch.Reset(aw.alerts.StallAfter)
+	}
+	aw.mu.Unlock()
+	if took := time.Since(start); aw.alerts.OnSlowWrite != nil &&
+		aw.alerts.SlowWrite > 0 && took >= aw.alerts.SlowWrite {
+		aw.alerts.OnSlowWrite(took)
+	}
+	if aw.scanner != nil && n > 0 {
+		if _, serr := aw.scanner.Write(p[:n]); serr != nil {
+			log.Debugf("cannot watch capture stream for dropped packets: %s", serr.Error())
+			aw.scanner = nil
+		}
+	}
+	return n, err
+}
+
+// Finish stops watching the capture stream for stalls.
+func (aw *AlertWriter) Finish() {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.watch != nil {
+		aw.watch.Stop()
+		aw.watch = nil
+	}
+}
+
+// stalled alerts about a stalled capture stream, unless capture data arrived
+// just in time, is still being written, or watching has already been
+// finished.
+func (aw *AlertWriter) stalled() {
+	aw.mu.Lock()
+	if aw.watch == nil || aw.writing {
+		aw.mu.Unlock()
+		return
+	}
+	stalled := time.Since(aw.last)
+	aw.mu.Unlock()
+	if stalled < aw.alerts.StallAfter {
+		return
+	}
+	aw.alerts.OnStall(stalled)
+}
+
+// scan checks interface statistics blocks for increased numbers of dropped
+// packets.
+func (aw *AlertWriter) scan(b *pcapng.Block) error {
+	switch b.Type {
+	case pcapng.BlockSHB:
+		// Interface IDs are local to their section.
+		aw.dropped = map[uint32]uint64{}
+	case pcapng.BlockISB:
+		isb, err := b.InterfaceStatistics()
+		if err != nil {
+			return err
+		}
+		dropped, ok := isb.Counter(pcapng.OptISBIfDrop, b.Endian)
+		if !ok || dropped <= aw.dropped[isb.InterfaceID] {
+			return nil
+		}
+		alert := DropAlert{
+			Dropped: dropped,
+			Delta:   dropped - aw.dropped[isb.InterfaceID],
+		}
+		aw.dropped[isb.InterfaceID] = dropped
+		if idb := aw.scanner.Interface(isb.InterfaceID); idb != nil {
+			alert.Interface = idb.Name()
+		}
+		aw.alerts.OnDrop(alert)
+	}
+	return nil
+}
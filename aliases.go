@@ -0,0 +1,71 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"strings"
+
+	"github.com/siemens/csharg/api"
+)
+
+// InterfaceAliases returns readable aliases for the network interfaces of the
+// specified capture target, indexed by their kernel names, such as
+// “eth0@if12” or “veth1a2b3c”. The aliases are derived from the interface
+// details of the discovered capture targets: the name of the capture target
+// at the peer end of a VETH pair on the same node, preferring pods, as well
+// as the bridge an interface is attached to. For instance, “veth1a2b3c”
+// becomes “veth1a2b3c (default/web, bridge cni0)”, and “eth0@if12” becomes
+// “eth0 (bridge cni0)”. Interfaces without any such details get an alias only
+// if their kernel name carries a peer index suffix, which gets dropped.
+func InterfaceAliases(t *api.Target, targets api.Targets) map[string]string {
+	aliases := map[string]string{}
+	if t == nil {
+		return aliases
+	}
+	for _, nif := range t.NetworkInterfaces {
+		base := nif
+		if idx := strings.Index(nif, "@"); idx > 0 {
+			base = nif[:idx]
+		}
+		var parts []string
+		details := t.InterfaceDetails[nif]
+		if details.PeerNetNS != 0 && details.PeerNetNS != t.NetNS {
+			if peer := peerTarget(t, details.PeerNetNS, targets); peer != nil {
+				parts = append(parts, peer.QualifiedName())
+			}
+		}
+		if details.Master != "" {
+			parts = append(parts, "bridge "+details.Master)
+		}
+		alias := base
+		if len(parts) != 0 {
+			alias += " (" + strings.Join(parts, ", ") + ")"
+		}
+		if alias != nif {
+			aliases[nif] = alias
+		}
+	}
+	return aliases
+}
+
+// peerTarget returns the capture target with the specified network namespace
+// on the same node as the capture target t, preferring pods over other
+// capture targets sharing the same network namespace, such as the containers
+// of a pod. It returns nil if there is no such capture target.
+func peerTarget(t *api.Target, netns int, targets api.Targets) *api.Target {
+	var peer *api.Target
+	for _, candidate := range targets {
+		if candidate == t || candidate.NetNS != netns || candidate.NodeName != t.NodeName {
+			continue
+		}
+		if candidate.Type.IsPod() {
+			return candidate
+		}
+		if peer == nil {
+			peer = candidate
+		}
+	}
+	return peer
+}
@@ -0,0 +1,271 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net/netip"
+
+	"github.com/siemens/csharg/packet"
+	"github.com/siemens/csharg/pcapng"
+)
+
+// Policy controls what gets anonymized.
+type Policy struct {
+	// KeepSubnets lists the subnets whose addresses are kept as-is, such as
+	// well-known service subnets.
+	KeepSubnets []netip.Prefix
+	// ZeroPayloads zeros the TCP, UDP, ICMP and ICMPv6 payloads.
+	ZeroPayloads bool
+	// Key for pseudonymizing IP addresses. The same key always maps the same
+	// IP address onto the same pseudonym, so using the same key across
+	// multiple packet captures keeps them correlatable. If empty, a random
+	// key is used.
+	Key []byte
+}
+
+// Writer anonymizes a pcapng stream written to it before passing it on to
+// the underlying writer. Additionally, name resolution and decryption secrets
+// blocks get dropped.
+type Writer struct {
+	w          io.Writer
+	scanner    *pcapng.Scanner
+	policy     Policy
+	pseudonyms map[netip.Addr]netip.Addr
+	packets    int
+}
+
+var _ io.WriteCloser = (*Writer)(nil)
+
+// NewWriter returns a new anonymizing writer that writes the anonymized
+// pcapng stream to w.
+func NewWriter(w io.Writer, policy Policy) *Writer {
+	if len(policy.Key) == 0 {
+		policy.Key = make([]byte, 32)
+		_, _ = rand.Read(policy.Key)
+	}
+	a := &Writer{
+		w:          w,
+		policy:     policy,
+		pseudonyms: map[netip.Addr]netip.Addr{},
+	}
+	a.scanner = pcapng.NewScanner(a.block)
+	return a
+}
+
+// Write writes octets of a pcapng stream.
+func (a *Writer) Write(p []byte) (n int, err error) {
+	return a.scanner.Write(p)
+}
+
+// Close signals the end of the pcapng stream, returning an error if the
+// stream ended in the middle of a block. It doesn't close the underlying
+// writer.
+func (a *Writer) Close() error {
+	return a.scanner.Close()
+}
+
+// Packets returns the number of packets anonymized so far.
+func (a *Writer) Packets() int {
+	return a.packets
+}
+
+// block anonymizes a single pcapng block and writes it to the underlying
+// writer.
+func (a *Writer) block(b *pcapng.Block) error {
+	switch b.Type {
+	case pcapng.BlockNRB, pcapng.BlockDSB:
+		return nil
+	case pcapng.BlockEPB:
+		epb, err := b.EnhancedPacket()
+		if err != nil {
+			return err
+		}
+		if idb := a.scanner.Interface(epb.InterfaceID); idb != nil {
+			// As the packet data references the block body, we anonymize
+			// the block in place.
+			a.Packet(idb.LinkType, epb.Data)
+		}
+		a.packets++
+	}
+	_, err := a.w.Write(b.Bytes())
+	return err
+}
+
+// Packet anonymizes the packet data of the specified link type in place.
+// IPv4 header checksums as well as TCP, UDP, ICMP and ICMPv6 checksums are
+// updated accordingly.
+func (a *Writer) Packet(linktype uint16, data []byte) {
+	s, ok := packet.Decode(linktype, data)
+	if !ok {
+		return
+	}
+	off := s.NetworkOffset
+	var end int // end of network layer packet, excluding any link layer trailer
+	switch s.EtherType {
+	case packet.EtherTypeIPv4:
+		if len(data) < off+20 || data[off]>>4 != 4 {
+			return
+		}
+		end = off + int(binary.BigEndian.Uint16(data[off+2:off+4]))
+		addrs := data[off+12 : off+20]
+		old := append([]byte(nil), addrs...)
+		a.replace(addrs[0:4])
+		a.replace(addrs[4:8])
+		adjustChecksum(data[off+10:off+12], old, addrs)
+		if sum := a.transportChecksum(&s, data); sum != nil {
+			adjustChecksum(sum, old, addrs)
+		}
+	case packet.EtherTypeIPv6:
+		if len(data) < off+40 || data[off]>>4 != 6 {
+			return
+		}
+		end = off + 40 + int(binary.BigEndian.Uint16(data[off+4:off+6]))
+		addrs := data[off+8 : off+40]
+		old := append([]byte(nil), addrs...)
+		a.replace(addrs[0:16])
+		a.replace(addrs[16:32])
+		if sum := a.transportChecksum(&s, data); sum != nil {
+			adjustChecksum(sum, old, addrs)
+		}
+	case packet.EtherTypeARP:
+		// Only IPv4 over Ethernet ARP is of interest.
+		if len(data) < off+28 ||
+			binary.BigEndian.Uint16(data[off+2:off+4]) != packet.EtherTypeIPv4 ||
+			data[off+4] != 6 || data[off+5] != 4 {
+			return
+		}
+		a.replace(data[off+14 : off+18])
+		a.replace(data[off+24 : off+28])
+		return
+	default:
+		return
+	}
+	if !a.policy.ZeroPayloads || s.PayloadOffset == 0 {
+		return
+	}
+	switch s.Proto {
+	case packet.ProtoTCP, packet.ProtoUDP, packet.ProtoICMP, packet.ProtoICMPv6:
+	default:
+		return
+	}
+	if end > len(data) || end < s.PayloadOffset {
+		end = len(data)
+	}
+	payload := data[s.PayloadOffset:end]
+	old := append([]byte(nil), payload...)
+	for idx := range payload {
+		payload[idx] = 0
+	}
+	if sum := a.checksum(&s, data); sum != nil {
+		adjustChecksum(sum, old, payload)
+	}
+}
+
+// replace replaces the IP address in place with its pseudonym, unless it is
+// to be kept.
+func (a *Writer) replace(b []byte) {
+	addr, _ := netip.AddrFromSlice(b)
+	copy(b, a.Pseudonym(addr).AsSlice())
+}
+
+// Pseudonym returns the pseudonym for the specified IP address. Addresses
+// within the subnets to keep, as well as unspecified, loopback, multicast and
+// the IPv4 broadcast addresses are returned unchanged.
+func (a *Writer) Pseudonym(addr netip.Addr) netip.Addr {
+	if addr.IsUnspecified() || addr.IsLoopback() || addr.IsMulticast() ||
+		addr == netip.AddrFrom4([4]byte{255, 255, 255, 255}) {
+		return addr
+	}
+	for _, subnet := range a.policy.KeepSubnets {
+		if subnet.Contains(addr) {
+			return addr
+		}
+	}
+	if pseudonym, ok := a.pseudonyms[addr]; ok {
+		return pseudonym
+	}
+	mac := hmac.New(sha256.New, a.policy.Key)
+	mac.Write(addr.AsSlice())
+	sum := mac.Sum(nil)
+	var pseudonym netip.Addr
+	if addr.Is4() {
+		pseudonym = netip.AddrFrom4([4]byte(sum[:4]))
+	} else {
+		pseudonym = netip.AddrFrom16([16]byte(sum[:16]))
+	}
+	a.pseudonyms[addr] = pseudonym
+	return pseudonym
+}
+
+// transportChecksum returns the checksum field of the transport layer
+// protocol if its checksum covers the IP addresses, otherwise nil.
+func (a *Writer) transportChecksum(s *packet.Summary, data []byte) []byte {
+	if s.Proto == packet.ProtoICMP {
+		return nil
+	}
+	return a.checksum(s, data)
+}
+
+// checksum returns the checksum field of the transport layer protocol, or nil
+// if there is none or it hasn't been captured. As UDP over IPv4 might not use
+// checksums, nil is returned in this case too.
+func (a *Writer) checksum(s *packet.Summary, data []byte) []byte {
+	if s.TransportOffset == 0 {
+		return nil
+	}
+	var off int
+	switch s.Proto {
+	case packet.ProtoTCP:
+		off = 16
+	case packet.ProtoUDP:
+		off = 6
+	case packet.ProtoICMP, packet.ProtoICMPv6:
+		off = 2
+	default:
+		return nil
+	}
+	off += s.TransportOffset
+	if len(data) < off+2 {
+		return nil
+	}
+	sum := data[off : off+2]
+	if s.Proto == packet.ProtoUDP && sum[0] == 0 && sum[1] == 0 {
+		return nil
+	}
+	return sum
+}
+
+// adjustChecksum incrementally updates an Internet checksum in place after
+// the covered octets have changed from old to new, see RFC 1624. Both old and
+// new must start at an even offset relative to the start of the checksummed
+// data.
+func adjustChecksum(sum []byte, old, new []byte) {
+	csum := uint32(^binary.BigEndian.Uint16(sum))
+	csum += uint32(^onesSum(old))
+	csum += uint32(onesSum(new))
+	csum = (csum & 0xffff) + (csum >> 16)
+	csum = (csum & 0xffff) + (csum >> 16)
+	binary.BigEndian.PutUint16(sum, ^uint16(csum))
+}
+
+// onesSum returns the 16 bit one's complement sum of the specified octets.
+func onesSum(b []byte) uint16 {
+	var sum uint32
+	for ; len(b) >= 2; b = b[2:] {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return uint16(sum)
+}
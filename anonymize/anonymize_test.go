@@ -0,0 +1,119 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package anonymize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+
+	"github.com/siemens/csharg/pcapng"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// udpPacket returns an Ethernet frame with an IPv4 UDP packet with correct
+// checksums.
+func udpPacket(src, dst string, payload []byte) []byte {
+	data := make([]byte, 14+20+8+len(payload))
+	binary.BigEndian.PutUint16(data[12:14], 0x0800)
+	ip := data[14:34]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+8+len(payload)))
+	ip[8] = 64
+	ip[9] = 17
+	copy(ip[12:16], netip.MustParseAddr(src).AsSlice())
+	copy(ip[16:20], netip.MustParseAddr(dst).AsSlice())
+	binary.BigEndian.PutUint16(ip[10:12], ^onesSum(ip))
+	udp := data[34:]
+	binary.BigEndian.PutUint16(udp[0:2], 12345)
+	binary.BigEndian.PutUint16(udp[2:4], 53)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(8+len(payload)))
+	copy(udp[8:], payload)
+	binary.BigEndian.PutUint16(udp[6:8], ^udpSum(data))
+	return data
+}
+
+// udpSum returns the one's complement sum over the UDP pseudo header, header
+// and payload.
+func udpSum(data []byte) uint16 {
+	pseudo := append([]byte{}, data[26:34]...)
+	pseudo = append(pseudo, 0, 17, data[38], data[39])
+	return onesSum(append(pseudo, data[34:]...))
+}
+
+var _ = Describe("anonymizing packets", func() {
+
+	It("pseudonymizes addresses consistently", func() {
+		a := NewWriter(io.Discard, Policy{
+			Key:         []byte("secret"),
+			KeepSubnets: []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")},
+		})
+		addr := netip.MustParseAddr("10.1.2.3")
+		p := a.Pseudonym(addr)
+		Expect(p).NotTo(Equal(addr))
+		Expect(p.Is4()).To(BeTrue())
+		Expect(a.Pseudonym(addr)).To(Equal(p))
+		Expect(NewWriter(io.Discard, Policy{Key: []byte("secret")}).Pseudonym(addr)).To(Equal(p))
+
+		v6 := netip.MustParseAddr("fd00::1")
+		Expect(a.Pseudonym(v6)).NotTo(Equal(v6))
+		Expect(a.Pseudonym(v6).Is6()).To(BeTrue())
+
+		for _, keep := range []string{"192.168.1.1", "127.0.0.1", "0.0.0.0", "255.255.255.255", "224.0.0.1", "::1"} {
+			addr := netip.MustParseAddr(keep)
+			Expect(a.Pseudonym(addr)).To(Equal(addr), "%s", keep)
+		}
+	})
+
+	It("keeps checksums valid", func() {
+		a := NewWriter(io.Discard, Policy{ZeroPayloads: true})
+		data := udpPacket("10.0.0.1", "10.0.0.2", []byte("top secret"))
+		a.Packet(pcapng.LinkTypeEthernet, data)
+		Expect(data[26:30]).NotTo(Equal([]byte{10, 0, 0, 1}))
+		Expect(data[30:34]).NotTo(Equal([]byte{10, 0, 0, 2}))
+		Expect(onesSum(data[14:34])).To(Equal(uint16(0xffff)))
+		Expect(udpSum(data)).To(Equal(uint16(0xffff)))
+		Expect(data[42:]).To(Equal(make([]byte, 10)))
+	})
+
+	It("anonymizes pcapng streams", func() {
+		var in bytes.Buffer
+		in.Write(pcapng.NewSectionHeaderBlock(binary.LittleEndian).Bytes())
+		in.Write(pcapng.NewInterfaceDescriptionBlock(binary.LittleEndian, &pcapng.InterfaceDescription{
+			LinkType: pcapng.LinkTypeEthernet,
+		}).Bytes())
+		in.Write((&pcapng.Block{Type: pcapng.BlockNRB, Body: []byte{0, 0, 0, 0}, Endian: binary.LittleEndian}).Bytes())
+		in.Write(pcapng.NewEnhancedPacketBlock(binary.LittleEndian, &pcapng.EnhancedPacket{
+			Data: udpPacket("10.0.0.1", "10.0.0.2", []byte("top secret")),
+		}).Bytes())
+
+		var out bytes.Buffer
+		a := NewWriter(&out, Policy{})
+		Expect(a.Write(in.Bytes())).To(Equal(in.Len()))
+		Expect(a.Close()).To(Succeed())
+		Expect(a.Packets()).To(Equal(1))
+
+		r := pcapng.NewReader(&out)
+		var types []uint32
+		for {
+			b, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			types = append(types, b.Type)
+			if b.Type == pcapng.BlockEPB {
+				epb, _ := b.EnhancedPacket()
+				Expect(epb.Data[26:30]).NotTo(Equal([]byte{10, 0, 0, 1}))
+				Expect(string(epb.Data[42:])).To(Equal("top secret"))
+			}
+		}
+		Expect(types).To(Equal([]uint32{pcapng.BlockSHB, pcapng.BlockIDB, pcapng.BlockEPB}))
+	})
+
+})
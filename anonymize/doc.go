@@ -0,0 +1,7 @@
+/*
+Package anonymize pseudonymizes the IP addresses in pcapng packet capture
+streams and optionally zeros packet payloads, so that packet captures can be
+shared with third parties, such as vendors, without disclosing the exact
+network layout or application data.
+*/
+package anonymize
@@ -0,0 +1,17 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package anonymize
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAnonymize(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Csharg anonymize package suite")
+}
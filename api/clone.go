@@ -0,0 +1,63 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Clone returns a deep copy of the capture target description, including its
+// network interfaces and their details, cluster information, and capabilities,
+// so that the copy can be modified without affecting the original. Cloning nil
+// returns nil.
+func (t *Target) Clone() *Target {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	if t.NetworkInterfaces != nil {
+		clone.NetworkInterfaces = append([]string{}, t.NetworkInterfaces...)
+	}
+	if t.InterfaceDetails != nil {
+		clone.InterfaceDetails = make(map[string]InterfaceDetails, len(t.InterfaceDetails))
+		for name, details := range t.InterfaceDetails {
+			clone.InterfaceDetails[name] = details
+		}
+	}
+	if t.Cluster != nil {
+		cluster := *t.Cluster
+		clone.Cluster = &cluster
+	}
+	if t.Capabilities != nil {
+		caps := *t.Capabilities
+		if t.Capabilities.Decapsulations != nil {
+			caps.Decapsulations = append([]string(nil), t.Capabilities.Decapsulations...)
+		}
+		clone.Capabilities = &caps
+	}
+	return &clone
+}
+
+// String returns a concise textual description of the capture target, such
+// as “"default/mypod" (pod) on "node-1"”, quoting the target and node names.
+func (t *Target) String() string {
+	if t == nil {
+		return "<nil>"
+	}
+	var b strings.Builder
+	if t.Prefix != "" {
+		b.WriteString(t.Prefix)
+		b.WriteByte(':')
+	}
+	fmt.Fprintf(&b, "%q", t.QualifiedName())
+	if t.Type != "" {
+		fmt.Fprintf(&b, " (%s)", t.Type)
+	}
+	if t.NodeName != "" {
+		fmt.Fprintf(&b, " on %q", t.NodeName)
+	}
+	return b.String()
+}
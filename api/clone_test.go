@@ -0,0 +1,75 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cloning capture targets", func() {
+
+	newTarget := func() *Target {
+		return &Target{
+			Name:              "web",
+			Namespace:         "team",
+			Type:              TypePod,
+			NetworkInterfaces: []string{"lo", "eth0"},
+			InterfaceDetails: map[string]InterfaceDetails{
+				"eth0": {Master: "cni0", PeerNetNS: 4026531992},
+			},
+			NodeName: "node-1",
+			Cluster:  &Cluster{Context: "kind", UID: "1234"},
+			Capabilities: &Capabilities{
+				SupportsFilter: true,
+				MaxNifs:        2,
+				Decapsulations: []string{"vxlan", "gre"},
+			},
+		}
+	}
+
+	It("clones nil", func() {
+		Expect((*Target)(nil).Clone()).To(BeNil())
+	})
+
+	It("deep copies", func() {
+		t := newTarget()
+		clone := t.Clone()
+		Expect(clone).To(Equal(t))
+		Expect(clone).NotTo(BeIdenticalTo(t))
+
+		clone.NetworkInterfaces[1] = "eth1"
+		clone.InterfaceDetails["eth0"] = InterfaceDetails{Master: "br0"}
+		clone.InterfaceDetails["eth1"] = InterfaceDetails{}
+		clone.Cluster.Context = "prod"
+		clone.Capabilities.MaxNifs = 1
+		clone.Capabilities.Decapsulations[0] = "geneve"
+		Expect(t).To(Equal(newTarget()))
+	})
+
+	It("keeps missing details missing", func() {
+		clone := (&Target{Name: "foo", Type: TypeDocker}).Clone()
+		Expect(clone.NetworkInterfaces).To(BeNil())
+		Expect(clone.InterfaceDetails).To(BeNil())
+		Expect(clone.Cluster).To(BeNil())
+		Expect(clone.Capabilities).To(BeNil())
+
+		clone = (&Target{Capabilities: &Capabilities{}}).Clone()
+		Expect(clone.Capabilities.Decapsulations).To(BeNil())
+	})
+
+	DescribeTable("describes capture targets",
+		func(t *Target, expected string) {
+			Expect(t.String()).To(Equal(expected))
+		},
+		Entry("nil", nil, "<nil>"),
+		Entry("pod", &Target{Name: "mypod", Namespace: "default", Type: TypePod, NodeName: "node-1"},
+			`"default/mypod" (pod) on "node-1"`),
+		Entry("prefixed container", &Target{Name: "foo", Type: TypeDocker, Prefix: "dind"},
+			`dind:"foo" (docker)`),
+		Entry("untyped", &Target{Name: "foo"}, `"foo"`),
+	)
+
+})
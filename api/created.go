@@ -0,0 +1,21 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "time"
+
+// ClockTicks is the number of Linux kernel clock ticks per second (USER_HZ)
+// in which the StartTime of capture targets is expressed.
+const ClockTicks = 100
+
+// Created returns the wall-clock creation time of the capture target, derived
+// from the start time of its “root” process and the boot time of its
+// container host. If either isn't known, the zero time is returned instead.
+func (t *Target) Created() time.Time {
+	if t.BootTime <= 0 || t.StartTime <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(t.BootTime, 0).Add(time.Duration(t.StartTime) * time.Second / ClockTicks)
+}
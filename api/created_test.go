@@ -0,0 +1,26 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("creation times", func() {
+
+	It("derives the creation time from boot and start times", func() {
+		t := &Target{BootTime: 1700000000, StartTime: 250}
+		Expect(t.Created()).To(Equal(time.Unix(1700000002, int64(500*time.Millisecond))))
+	})
+
+	It("returns the zero time when unknown", func() {
+		Expect((&Target{StartTime: 250}).Created().IsZero()).To(BeTrue())
+		Expect((&Target{BootTime: 1700000000}).Created().IsZero()).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,80 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "reflect"
+
+// TargetsDiff describes the differences between two lists of capture targets,
+// such as from two discoveries.
+type TargetsDiff struct {
+	Added   Targets // capture targets only in the new list.
+	Removed Targets // capture targets only in the old list.
+	Changed Targets // capture targets in both lists, but with different details; as in the new list.
+}
+
+// Empty returns true if there are no differences.
+func (d TargetsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// targetKey identifies a capture target across discoveries.
+type targetKey struct {
+	prefix, namespace, name, node string
+	typ                           TargetType
+}
+
+func keyOf(t *Target) targetKey {
+	return targetKey{prefix: t.Prefix, namespace: t.Namespace, name: t.Name, typ: t.Type, node: t.NodeName}
+}
+
+// Diff returns the capture targets added, removed, and changed in this list of
+// capture targets compared to the specified old list. Capture targets are
+// identified by their prefix, (qualified) name, type, and node name; they
+// have changed when any of their other details differ, such as their network
+// interfaces or start time, where missing and empty details are the same.
+// The added and changed capture targets are in the order of this list, while
+// the removed capture targets are in the order of the old list.
+func (ts Targets) Diff(old Targets) TargetsDiff {
+	olds := make(map[targetKey]*Target, len(old))
+	for _, t := range old {
+		olds[keyOf(t)] = t
+	}
+	news := make(map[targetKey]struct{}, len(ts))
+	var diff TargetsDiff
+	for _, t := range ts {
+		key := keyOf(t)
+		news[key] = struct{}{}
+		o, ok := olds[key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, t)
+		case !reflect.DeepEqual(normalized(o), normalized(t)):
+			diff.Changed = append(diff.Changed, t)
+		}
+	}
+	for _, t := range old {
+		if _, ok := news[keyOf(t)]; !ok {
+			diff.Removed = append(diff.Removed, t)
+		}
+	}
+	return diff
+}
+
+// normalized returns a copy of the specified capture target with empty lists
+// and maps of details set to nil, so that missing and empty details compare
+// as equal.
+func normalized(t *Target) *Target {
+	t = t.Clone()
+	if len(t.NetworkInterfaces) == 0 {
+		t.NetworkInterfaces = nil
+	}
+	if len(t.InterfaceDetails) == 0 {
+		t.InterfaceDetails = nil
+	}
+	if t.Capabilities != nil && len(t.Capabilities.Decapsulations) == 0 {
+		t.Capabilities.Decapsulations = nil
+	}
+	return t
+}
@@ -0,0 +1,62 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("diffing capture targets", func() {
+
+	It("finds no differences in identical lists", func() {
+		ts := Targets{{Name: "foo", Type: TypeDocker, NetworkInterfaces: []string{"eth0"}}}
+		diff := ts.Diff(Targets{ts[0].Clone()})
+		Expect(diff.Empty()).To(BeTrue())
+	})
+
+	It("treats missing and empty details the same", func() {
+		old := Targets{{Name: "foo", Type: TypeDocker, Capabilities: &Capabilities{}}}
+		ts := Targets{{Name: "foo", Type: TypeDocker,
+			NetworkInterfaces: []string{},
+			InterfaceDetails:  map[string]InterfaceDetails{},
+			Capabilities:      &Capabilities{Decapsulations: []string{}},
+		}}
+		Expect(ts.Diff(old).Empty()).To(BeTrue())
+		Expect(old.Diff(ts).Empty()).To(BeTrue())
+		Expect(ts[0].NetworkInterfaces).NotTo(BeNil(), "must not modify the targets")
+	})
+
+	It("finds added, removed, and changed capture targets", func() {
+		kept := &Target{Name: "kept", Type: TypeDocker}
+		old := Targets{
+			{Name: "gone", Type: TypeDocker},
+			kept,
+			{Name: "web", Namespace: "team", Type: TypePod, NetworkInterfaces: []string{"eth0"}},
+		}
+		changed := &Target{Name: "web", Namespace: "team", Type: TypePod, NetworkInterfaces: []string{"eth0", "eth1"}}
+		added := &Target{Name: "new", Type: TypeDocker}
+		diff := Targets{added, changed, kept.Clone()}.Diff(old)
+		Expect(diff.Empty()).To(BeFalse())
+		Expect(diff.Added).To(HaveExactElements(added))
+		Expect(diff.Removed).To(HaveExactElements(old[0]))
+		Expect(diff.Changed).To(HaveExactElements(changed))
+	})
+
+	It("identifies capture targets by prefix, name, type, and node", func() {
+		old := Targets{{Name: "foo", Type: TypeDocker, NodeName: "node-1"}}
+		for _, t := range []*Target{
+			{Name: "foo", Type: TypeDocker, NodeName: "node-2"},
+			{Name: "foo", Type: TypeContainerd, NodeName: "node-1"},
+			{Name: "foo", Type: TypeDocker, NodeName: "node-1", Prefix: "dind"},
+		} {
+			diff := Targets{t}.Diff(old)
+			Expect(diff.Added).To(HaveExactElements(t))
+			Expect(diff.Removed).To(HaveExactElements(old[0]))
+			Expect(diff.Changed).To(BeEmpty())
+		}
+	})
+
+})
@@ -11,6 +11,11 @@
 
 package api
 
+import (
+	"encoding/json"
+	"errors"
+)
+
 // GwTargetList describes the capture targets/containers discovered by a
 // GhostWire “mobyshark” discovery service endpoint. We use a list of
 // references, so we don't need to copy things around all the time ... in order
@@ -18,3 +23,121 @@ package api
 type GwTargetList struct {
 	Targets Targets `json:"containers"`
 }
+
+// GwSchemaVersion is the newest GhostWire discovery schema version
+// understood.
+const GwSchemaVersion = 2
+
+// GwTargetListV2 describes the capture targets discovered by a GhostWire
+// discovery service endpoint using the versioned v2 schema. In contrast to the
+// original “mobyshark” schema, the v2 schema explicitly states its version and
+// describes network interfaces as objects.
+type GwTargetListV2 struct {
+	Version int           `json:"version"`
+	Targets []*GwTargetV2 `json:"targets"`
+}
+
+// GwTargetV2 describes a single capture target in the v2 GhostWire discovery
+// schema.
+type GwTargetV2 struct {
+	Name         string          `json:"name"`
+	Type         TargetType      `json:"type"`
+	Prefix       string          `json:"prefix,omitempty"`
+	NetNS        int             `json:"netns"`
+	Interfaces   []GwInterfaceV2 `json:"interfaces"`
+	StartTime    int64           `json:"starttime,omitempty"`
+	Pid          int             `json:"pid,omitempty"`
+	BootTime     int64           `json:"boottime,omitempty"`
+	ContainerID  string          `json:"container-id,omitempty"`
+	SandboxID    string          `json:"sandbox-id,omitempty"`
+	NodeName     string          `json:"node-name,omitempty"`
+	Capabilities *Capabilities   `json:"capabilities,omitempty"`
+}
+
+// GwInterfaceV2 describes a network interface of a capture target in the v2
+// GhostWire discovery schema.
+type GwInterfaceV2 struct {
+	Name      string `json:"name"`
+	Master    string `json:"master,omitempty"`
+	PeerNetNS int    `json:"peer-netns,omitempty"`
+}
+
+// Target returns the capture target in the original data model.
+func (t *GwTargetV2) Target() *Target {
+	nifs := make([]string, 0, len(t.Interfaces))
+	var details map[string]InterfaceDetails
+	for _, nif := range t.Interfaces {
+		nifs = append(nifs, nif.Name)
+		if nif.Master == "" && nif.PeerNetNS == 0 {
+			continue
+		}
+		if details == nil {
+			details = map[string]InterfaceDetails{}
+		}
+		details[nif.Name] = InterfaceDetails{Master: nif.Master, PeerNetNS: nif.PeerNetNS}
+	}
+	target := &Target{
+		Type:              t.Type,
+		Prefix:            t.Prefix,
+		NetNS:             t.NetNS,
+		NetworkInterfaces: nifs,
+		InterfaceDetails:  details,
+		StartTime:         t.StartTime,
+		Pid:               t.Pid,
+		BootTime:          t.BootTime,
+		ContainerID:       t.ContainerID,
+		SandboxID:         t.SandboxID,
+		NodeName:          t.NodeName,
+		Capabilities:      t.Capabilities,
+	}
+	target.SetName(t.Name)
+	return target
+}
+
+// gwSchemaProbe detects the GhostWire discovery schema version.
+type gwSchemaProbe struct {
+	Version    *int            `json:"version"`
+	Containers json.RawMessage `json:"containers"`
+}
+
+// DecodeGwTargets decodes the capture targets returned by a GhostWire
+// discovery service endpoint, automatically detecting the schema version: the
+// original “mobyshark” schema without any version information (returned as
+// version 1), or the versioned v2 schema. Newer schema versions are decoded
+// as v2, as long as they stay compatible. The decoded capture targets are
+// validated, so malformed responses result in precise errors.
+func DecodeGwTargets(data []byte) (Targets, int, error) {
+	var probe gwSchemaProbe
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, 0, err
+	}
+	if probe.Version == nil || *probe.Version < 2 {
+		if probe.Containers == nil {
+			return nil, 0, errors.New("unknown GhostWire discovery schema")
+		}
+		var td GwTargetList
+		if err := json.Unmarshal(data, &td); err != nil {
+			return nil, 1, err
+		}
+		if err := td.Targets.Validate(); err != nil {
+			return nil, 1, err
+		}
+		return td.Targets, 1, nil
+	}
+	var td GwTargetListV2
+	if err := json.Unmarshal(data, &td); err != nil {
+		return nil, td.Version, err
+	}
+	ts := make(Targets, 0, len(td.Targets))
+	for _, t := range td.Targets {
+		if t == nil {
+			ts = append(ts, nil)
+			continue
+		}
+		ts = append(ts, t.Target())
+	}
+	if err := ts.Validate(); err != nil {
+		return nil, td.Version, err
+	}
+	return ts, td.Version, nil
+}
@@ -0,0 +1,66 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GhostWire discovery", func() {
+
+	It("decodes the original schema", func() {
+		ts, version, err := DecodeGwTargets([]byte(`{"containers":[
+			{"name":"team/web","type":"pod","netns":42,"network-interfaces":["lo","eth0"]},
+			{"name":"db","type":"docker","netns":43,"network-interfaces":["eth0"]}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal(1))
+		Expect(ts).To(HaveLen(2))
+		Expect(ts[0].Namespace).To(Equal("team"))
+		Expect(ts[0].Name).To(Equal("web"))
+		Expect(ts[1].NetworkInterfaces).To(HaveExactElements("eth0"))
+	})
+
+	It("decodes the v2 schema", func() {
+		ts, version, err := DecodeGwTargets([]byte(`{"version":2,"targets":[
+			{"name":"team/web","type":"pod","netns":42,"interfaces":[
+				{"name":"lo"},
+				{"name":"eth0","master":"cni0","peer-netns":44}],
+			 "capabilities":{"supports-filter":true,"decapsulations":["vxlan"]}}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal(2))
+		Expect(ts).To(HaveLen(1))
+		t := ts[0]
+		Expect(t.QualifiedName()).To(Equal("team/web"))
+		Expect(t.NetworkInterfaces).To(HaveExactElements("lo", "eth0"))
+		Expect(t.InterfaceDetails).To(Equal(map[string]InterfaceDetails{
+			"eth0": {Master: "cni0", PeerNetNS: 44},
+		}))
+		Expect(t.Capabilities.SupportsFilter).To(BeTrue())
+		Expect(t.Capabilities.Decapsulations).To(HaveExactElements("vxlan"))
+	})
+
+	It("decodes newer schema versions as v2", func() {
+		ts, version, err := DecodeGwTargets([]byte(`{"version":3,"targets":[
+			{"name":"db","type":"docker","interfaces":[{"name":"eth0"}]}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal(3))
+		Expect(ts).To(HaveLen(1))
+	})
+
+	DescribeTable("rejects malformed discovery results",
+		func(data string, expected string) {
+			ts, _, err := DecodeGwTargets([]byte(data))
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+			Expect(ts).To(BeNil())
+		},
+		Entry("no JSON", `garbage`, "invalid character"),
+		Entry("unknown schema", `{}`, "unknown GhostWire discovery schema"),
+		Entry("invalid v1 target", `{"containers":[{"name":"","type":"docker"}]}`, "targets[0]: name: must not be empty"),
+		Entry("invalid v2 target", `{"version":2,"targets":[{"name":"db"}]}`, "targets[0]: type: must not be empty"),
+		Entry("missing v2 target", `{"version":2,"targets":[null]}`, "targets[0]: missing target"),
+	)
+
+})
@@ -0,0 +1,88 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultNamespace is the Kubernetes namespace of pods named without an
+// explicit namespace.
+const DefaultNamespace = "default"
+
+// ParsePodName splits a pod name in “namespace/name” convention into its
+// namespace and name parts. Pod names without a namespace are in the
+// DefaultNamespace.
+func ParsePodName(podname string) (namespace, name string, err error) {
+	return ParsePodNameIn(podname, DefaultNamespace)
+}
+
+// ParsePodNameIn splits a pod name in “namespace/name” convention into its
+// namespace and name parts, like ParsePodName does. However, pod names
+// without a namespace are in the specified default namespace instead, or in
+// the DefaultNamespace if the specified default namespace is empty.
+func ParsePodNameIn(podname, defaultns string) (namespace, name string, err error) {
+	if defaultns == "" {
+		defaultns = DefaultNamespace
+	}
+	namespace, name, found := strings.Cut(podname, "/")
+	if !found {
+		namespace, name = defaultns, podname
+	}
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid pod namespace/name: %q", podname)
+	}
+	return namespace, name, nil
+}
+
+// PodName returns the pod name in “namespace/name” convention. If the
+// namespace is empty, only the name is returned.
+func PodName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// QualifiedName returns the name of the capture target, in “namespace/name”
+// convention for pods.
+func (t *Target) QualifiedName() string {
+	return PodName(t.Namespace, t.Name)
+}
+
+// SetName sets the name of the capture target from a qualified name, splitting
+// off the namespace of pods. The capture target type thus needs to be set
+// beforehand.
+func (t *Target) SetName(qualifiedname string) {
+	t.Name, t.Namespace = qualifiedname, ""
+	if !t.Type.IsPod() {
+		return
+	}
+	if ns, name, found := strings.Cut(qualifiedname, "/"); found {
+		t.Name, t.Namespace = name, ns
+	}
+}
+
+// jsonTarget is a Target without its JSON (un)marshalling methods.
+type jsonTarget Target
+
+// MarshalJSON returns the JSON representation of the capture target, with
+// pods named in the “namespace/name” convention of capture services.
+func (t Target) MarshalJSON() ([]byte, error) {
+	t.Name, t.Namespace = t.QualifiedName(), ""
+	return json.Marshal(jsonTarget(t))
+}
+
+// UnmarshalJSON decodes a capture target from its JSON representation,
+// splitting off the namespaces of pods.
+func (t *Target) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*jsonTarget)(t)); err != nil {
+		return err
+	}
+	t.SetName(t.Name)
+	return nil
+}
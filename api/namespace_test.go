@@ -0,0 +1,67 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pod names", func() {
+
+	DescribeTable("parses pod names",
+		func(podname, defaultns, namespace, name string) {
+			ns, n, err := ParsePodNameIn(podname, defaultns)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ns).To(Equal(namespace))
+			Expect(n).To(Equal(name))
+		},
+		Entry("qualified", "team/web", "", "team", "web"),
+		Entry("unqualified", "web", "", DefaultNamespace, "web"),
+		Entry("unqualified in namespace", "web", "team", "team", "web"),
+		Entry("qualified in namespace", "other/web", "team", "other", "web"),
+	)
+
+	DescribeTable("rejects invalid pod names",
+		func(podname string) {
+			Expect(ParsePodName(podname)).Error().To(MatchError(ContainSubstring("invalid pod namespace/name")))
+		},
+		Entry("empty", ""),
+		Entry("empty namespace", "/web"),
+		Entry("empty name", "team/"),
+		Entry("too many slashes", "team/web/1"),
+	)
+
+	It("qualifies pod names", func() {
+		Expect(PodName("team", "web")).To(Equal("team/web"))
+		Expect(PodName("", "web")).To(Equal("web"))
+		Expect((&Target{Name: "web", Namespace: "team", Type: TypePod}).QualifiedName()).To(Equal("team/web"))
+	})
+
+	It("splits off namespaces only from pods", func() {
+		t := &Target{Type: TypePod}
+		t.SetName("team/web")
+		Expect(t.Namespace).To(Equal("team"))
+		Expect(t.Name).To(Equal("web"))
+
+		t = &Target{Type: TypeDocker}
+		t.SetName("team/web")
+		Expect(t.Namespace).To(BeEmpty())
+		Expect(t.Name).To(Equal("team/web"))
+	})
+
+	It("(un)marshals pods using qualified names", func() {
+		data, err := json.Marshal(&Target{Name: "web", Namespace: "team", Type: TypePod})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"name":"team/web"`))
+		var t Target
+		Expect(json.Unmarshal(data, &t)).To(Succeed())
+		Expect(t.Namespace).To(Equal("team"))
+		Expect(t.Name).To(Equal("web"))
+	})
+
+})
@@ -29,11 +29,16 @@ type Target struct {
 	// (network namespace). When it comes to integrated legacy devices,
 	// "node-local" then refers to the service instance name instead of the
 	// Kubernetes node. And for simplicity, we just lump up everything under the
-	// "container" misnomer.
+	// "container" misnomer. For pods, this is only the pod name within its
+	// namespace.
 	Name string `json:"name"`
+	// Namespace of a pod capture target; empty for other types of capture
+	// targets. In JSON, pods are described using the "namespace/name"
+	// convention of capture services in the "name" field instead.
+	Namespace string `json:"-"`
 	// Type of target we're dealing with: containers such as "docker", "lxc",
-	// etc., "pod", "proc", et cetera.
-	Type string `json:"type"`
+	// etc., "pod", "proc", et cetera, as also defined by the TargetType constants.
+	Type TargetType `json:"type"`
 	// The node-local unique Linux kernel identifier of the virtual IP
 	// stack/network namespace. This is simply the inode number of the network
 	// namespace. Please note that inode numbers get recycled quickly, so the
@@ -43,6 +48,9 @@ type Target struct {
 	// List of network interface names inside a specific network namespace.
 	// Includes "lo".
 	NetworkInterfaces []string `json:"network-interfaces"`
+	// Optional details about the network interfaces, indexed by their kernel
+	// names, if reported by the discovery service.
+	InterfaceDetails map[string]InterfaceDetails `json:"interface-details,omitempty"`
 	// An optional (node-local) prefix to the name to cover situations with
 	// Docker-in-Docker or multiple Docker side-by-side setups.
 	Prefix string `json:"prefix"`
@@ -57,6 +65,16 @@ type Target struct {
 	// parameter this allows detecting stale or reused network namespace
 	// identifiers.
 	Pid int `json:"pid,omitempty"`
+	// Container runtime identifier of a container, if known to the capture
+	// service, such as the Docker container ID, or the CRI container ID.
+	ContainerID string `json:"container-id,omitempty"`
+	// Container runtime identifier of the pod sandbox a pod or container
+	// belongs to, if known to the capture service.
+	SandboxID string `json:"sandbox-id,omitempty"`
+	// Boot time of the container host in seconds since the Unix epoch, if
+	// known to the capture service. Together with the StartTime this gives
+	// the wall-clock creation time of a capture target.
+	BootTime int64 `json:"boottime,omitempty"`
 
 	// Name of the container host (which is the node name in Kubernetes
 	// parlance). For integrated legacy devices, this will be the device name
@@ -71,6 +89,36 @@ type Target struct {
 	CaptureService string `json:"capture-service,omitempty"`
 	// The (TCP/Websocket) port number of the capture service.
 	CapturePort int32 `json:"captureport,omitempty"`
+	// Optional capture capabilities of this target, if reported by the
+	// discovery service; nil if unknown.
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// Capabilities describes the capture features a capture service supports for
+// a particular capture target, so that clients can check their capture
+// options before starting a capture.
+type Capabilities struct {
+	// Capture filter expressions are supported.
+	SupportsFilter bool `json:"supports-filter"`
+	// Limiting the captured packet lengths (snap length) is supported.
+	SupportsSnaplen bool `json:"supports-snaplen"`
+	// Maximum number of network interfaces to capture from at the same time;
+	// zero means no limit.
+	MaxNifs int `json:"max-nifs,omitempty"`
+	// Restricting captures to packets with specific VLAN IDs is supported.
+	SupportsVLAN bool `json:"supports-vlan,omitempty"`
+	// Tunnel encapsulations the capture service can strip, such as "vxlan".
+	Decapsulations []string `json:"decapsulations,omitempty"`
+}
+
+// InterfaceDetails describes how a network interface of a capture target is
+// connected, as far as known to the discovery service.
+type InterfaceDetails struct {
+	// Name of the bridge this network interface is attached to, if any.
+	Master string `json:"master,omitempty"`
+	// Network namespace identifier (inode number) of the peer end of a VETH
+	// pair, if any.
+	PeerNetNS int `json:"peer-netns,omitempty"`
 }
 
 // Cluster gives details about the Kubernetes cluster a container belongs to.
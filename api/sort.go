@@ -0,0 +1,43 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import "sort"
+
+// LessByName reports whether capture target a sorts before b when ordering by
+// qualified name first, and then by node name.
+func LessByName(a, b *Target) bool {
+	if an, bn := a.QualifiedName(), b.QualifiedName(); an != bn {
+		return an < bn
+	}
+	return a.NodeName < b.NodeName
+}
+
+// LessByNode reports whether capture target a sorts before b when ordering by
+// node name first, and then by qualified name.
+func LessByNode(a, b *Target) bool {
+	if a.NodeName != b.NodeName {
+		return a.NodeName < b.NodeName
+	}
+	return a.QualifiedName() < b.QualifiedName()
+}
+
+// SortFunc sorts the capture targets in place using the specified less
+// function, keeping the original order of equal capture targets.
+func (ts Targets) SortFunc(less func(a, b *Target) bool) {
+	sort.SliceStable(ts, func(i, j int) bool { return less(ts[i], ts[j]) })
+}
+
+// SortByName sorts the capture targets in place by name, and then by node
+// name.
+func (ts Targets) SortByName() {
+	ts.SortFunc(LessByName)
+}
+
+// SortByNode sorts the capture targets in place by node name, and then by
+// name.
+func (ts Targets) SortByNode() {
+	ts.SortFunc(LessByNode)
+}
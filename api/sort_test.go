@@ -0,0 +1,50 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sorting capture targets", func() {
+
+	var a1, a2, b1, b2 *Target
+
+	BeforeEach(func() {
+		a1 = &Target{Name: "a", NodeName: "node-1"}
+		a2 = &Target{Name: "a", NodeName: "node-2"}
+		b1 = &Target{Name: "b", NodeName: "node-1"}
+		b2 = &Target{Name: "b", NodeName: "node-2"}
+	})
+
+	It("sorts by name, then node", func() {
+		ts := Targets{b2, a2, b1, a1}
+		ts.SortByName()
+		Expect(ts).To(HaveExactElements(a1, a2, b1, b2))
+	})
+
+	It("sorts by node, then name", func() {
+		ts := Targets{b2, a2, b1, a1}
+		ts.SortByNode()
+		Expect(ts).To(HaveExactElements(a1, b1, a2, b2))
+	})
+
+	It("sorts pods by their qualified names", func() {
+		p1 := &Target{Name: "z", Namespace: "a", Type: TypePod}
+		p2 := &Target{Name: "a", Namespace: "z", Type: TypePod}
+		Expect(LessByName(p1, p2)).To(BeTrue())
+		Expect(LessByName(p2, p1)).To(BeFalse())
+	})
+
+	It("keeps the order of equal capture targets", func() {
+		dup := &Target{Name: "a", NodeName: "node-1"}
+		ts := Targets{b1, a1, dup}
+		ts.SortFunc(LessByName)
+		Expect(ts).To(HaveExactElements(
+			BeIdenticalTo(a1), BeIdenticalTo(dup), BeIdenticalTo(b1)))
+	})
+
+})
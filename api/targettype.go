@@ -0,0 +1,39 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+// TargetType is the type of a capture target, such as a pod, a particular
+// type of container, or a process-less network namespace.
+type TargetType string
+
+// Well-known capture target types; capture services might report further
+// container types, which are then considered to be containers.
+const (
+	TypePod        TargetType = "pod"        // Kubernetes pod.
+	TypeDocker     TargetType = "docker"     // Docker container.
+	TypeContainerd TargetType = "containerd" // containerd container.
+	TypeCRIO       TargetType = "cri-o"      // CRI-O container.
+	TypePodman     TargetType = "podman"     // Podman container.
+	TypeLXC        TargetType = "lxc"        // LXC container.
+	TypeProc       TargetType = "proc"       // process with its own network namespace.
+	TypeBindmount  TargetType = "bindmount"  // process-less bind-mounted network namespace.
+)
+
+// IsPod returns true if the capture target type is a Kubernetes pod.
+func (tt TargetType) IsPod() bool {
+	return tt == TypePod
+}
+
+// IsNetworkOnly returns true if the capture target type is a stand-alone
+// network namespace, either of a process or bind-mounted without any process.
+func (tt TargetType) IsNetworkOnly() bool {
+	return tt == TypeProc || tt == TypeBindmount
+}
+
+// IsContainer returns true if the capture target type is a container, that is,
+// neither a pod nor a stand-alone network namespace.
+func (tt TargetType) IsContainer() bool {
+	return !tt.IsPod() && !tt.IsNetworkOnly()
+}
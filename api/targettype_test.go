@@ -0,0 +1,28 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture target types", func() {
+
+	DescribeTable("classifies capture target types",
+		func(tt TargetType, pod, networkOnly, container bool) {
+			Expect(tt.IsPod()).To(Equal(pod))
+			Expect(tt.IsNetworkOnly()).To(Equal(networkOnly))
+			Expect(tt.IsContainer()).To(Equal(container))
+		},
+		Entry("pod", TypePod, true, false, false),
+		Entry("process", TypeProc, false, true, false),
+		Entry("bind mount", TypeBindmount, false, true, false),
+		Entry("Docker container", TypeDocker, false, false, true),
+		Entry("containerd container", TypeContainerd, false, false, true),
+		Entry("unknown container type", TargetType("kata"), false, false, true),
+	)
+
+})
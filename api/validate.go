@@ -0,0 +1,116 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TargetSchema is the JSON schema of capture target descriptions, as checked
+// by Target.Validate.
+//
+//go:embed target.schema.json
+var TargetSchema []byte
+
+// Validate checks the capture target description for missing or invalid
+// fields, as specified by TargetSchema. It returns an error describing all
+// problems found, using the JSON field names, or nil if the description is
+// valid.
+func (t *Target) Validate() error {
+	if t == nil {
+		return errors.New("missing target")
+	}
+	var errs []error
+	if t.Name == "" {
+		errs = append(errs, errors.New("name: must not be empty"))
+	}
+	if t.Type == "" {
+		errs = append(errs, errors.New("type: must not be empty"))
+	}
+	if t.NetNS < 0 {
+		errs = append(errs, fmt.Errorf("netns: invalid negative value %d", t.NetNS))
+	}
+	for idx, nif := range t.NetworkInterfaces {
+		if nif == "" {
+			errs = append(errs, fmt.Errorf("network-interfaces[%d]: must not be empty", idx))
+		}
+	}
+	for _, name := range sortedKeys(t.InterfaceDetails) {
+		if pn := t.InterfaceDetails[name].PeerNetNS; pn < 0 {
+			errs = append(errs, fmt.Errorf("interface-details.%s.peer-netns: invalid negative value %d", name, pn))
+		}
+	}
+	if t.StartTime < 0 {
+		errs = append(errs, fmt.Errorf("starttime: invalid negative value %d", t.StartTime))
+	}
+	if t.Pid < 0 {
+		errs = append(errs, fmt.Errorf("pid: invalid negative value %d", t.Pid))
+	}
+	if t.BootTime < 0 {
+		errs = append(errs, fmt.Errorf("boottime: invalid negative value %d", t.BootTime))
+	}
+	if strings.ContainsAny(t.CaptureService, "/?%") {
+		errs = append(errs, fmt.Errorf("capture-service: invalid %q", t.CaptureService))
+	}
+	if t.CapturePort < 0 || t.CapturePort > 65535 {
+		errs = append(errs, fmt.Errorf("captureport: invalid port %d", t.CapturePort))
+	}
+	if t.Capabilities != nil && t.Capabilities.MaxNifs < 0 {
+		errs = append(errs, fmt.Errorf("capabilities.max-nifs: invalid negative value %d", t.Capabilities.MaxNifs))
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks all capture target descriptions, returning an error
+// describing all problems found, prefixed by the index of the offending
+// target, or nil if all descriptions are valid.
+func (ts Targets) Validate() error {
+	var errs []error
+	for idx, t := range ts {
+		if err := t.Validate(); err != nil {
+			for _, err := range unjoin(err) {
+				errs = append(errs, fmt.Errorf("targets[%d]: %w", idx, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unjoin returns the individual errors of a joined error.
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// DecodeTarget decodes and then validates a capture target description in
+// JSON format, such as from a target specification file.
+func DecodeTarget(data []byte) (*Target, error) {
+	var t *Target
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid target: %w", err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid target: %w", err)
+	}
+	return t, nil
+}
+
+// sortedKeys returns the names of the interface details in sorted order, so
+// that validation errors are reported in a stable order.
+func sortedKeys(details map[string]InterfaceDetails) []string {
+	names := make([]string, 0, len(details))
+	for name := range details {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,88 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("validating capture targets", func() {
+
+	It("accepts valid capture targets", func() {
+		Expect((&Target{
+			Name:              "web",
+			Type:              TypeDocker,
+			NetworkInterfaces: []string{"lo", "eth0"},
+			InterfaceDetails:  map[string]InterfaceDetails{"eth0": {PeerNetNS: 42}},
+			CapturePort:       5001,
+			Capabilities:      &Capabilities{MaxNifs: 1},
+		}).Validate()).To(Succeed())
+	})
+
+	It("reports all problems", func() {
+		err := (&Target{
+			NetNS:             -1,
+			NetworkInterfaces: []string{"eth0", ""},
+			InterfaceDetails: map[string]InterfaceDetails{
+				"veth2": {PeerNetNS: -2},
+				"veth1": {PeerNetNS: -1},
+			},
+			StartTime:      -1,
+			Pid:            -1,
+			BootTime:       -1,
+			CaptureService: "a/b",
+			CapturePort:    65536,
+			Capabilities:   &Capabilities{MaxNifs: -1},
+		}).Validate()
+		Expect(strings.Split(err.Error(), "\n")).To(HaveExactElements(
+			"name: must not be empty",
+			"type: must not be empty",
+			"netns: invalid negative value -1",
+			"network-interfaces[1]: must not be empty",
+			"interface-details.veth1.peer-netns: invalid negative value -1",
+			"interface-details.veth2.peer-netns: invalid negative value -2",
+			"starttime: invalid negative value -1",
+			"pid: invalid negative value -1",
+			"boottime: invalid negative value -1",
+			`capture-service: invalid "a/b"`,
+			"captureport: invalid port 65536",
+			"capabilities.max-nifs: invalid negative value -1",
+		))
+		Expect((*Target)(nil).Validate()).To(MatchError("missing target"))
+	})
+
+	It("prefixes problems with the index of the offending capture target", func() {
+		err := Targets{{Name: "foo", Type: TypeDocker}, {Name: "bar"}, nil}.Validate()
+		Expect(strings.Split(err.Error(), "\n")).To(HaveExactElements(
+			"targets[1]: type: must not be empty",
+			"targets[2]: missing target",
+		))
+	})
+
+	It("decodes and validates capture targets", func() {
+		t, err := DecodeTarget([]byte(`{"name":"team/web","type":"pod","network-interfaces":["eth0"]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t.QualifiedName()).To(Equal("team/web"))
+
+		Expect(DecodeTarget([]byte(`{"name":""}`))).Error().To(MatchError(HavePrefix("invalid target: ")))
+		Expect(DecodeTarget([]byte(`[`))).Error().To(MatchError(HavePrefix("invalid target: ")))
+	})
+
+	It("has a valid JSON schema covering all capabilities", func() {
+		var schema struct {
+			Properties map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"properties"`
+		}
+		Expect(json.Unmarshal(TargetSchema, &schema)).To(Succeed())
+		Expect(schema.Properties["capabilities"].Properties).To(HaveKey("supports-vlan"))
+		Expect(schema.Properties["capabilities"].Properties).To(HaveKey("decapsulations"))
+	})
+
+})
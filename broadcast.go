@@ -0,0 +1,380 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultBroadcastQueueLength is the default number of pcapng blocks queued
+// per broadcast consumer.
+const DefaultBroadcastQueueLength = 1024
+
+// broadcastBatchSize limits the size of the batches of queued blocks written
+// to broadcast consumers in one go.
+const broadcastBatchSize = 64 * 1024
+
+// ErrBroadcastClosed signals that a broadcast has already ended.
+var ErrBroadcastClosed = errors.New("capture broadcast closed")
+
+// ErrSlowConsumer signals that a broadcast consumer has been detached as it
+// fell too far behind to receive the section or interface descriptions needed
+// to keep its pcapng stream valid.
+var ErrSlowConsumer = errors.New("broadcast consumer too slow")
+
+// BroadcasterOptions defines options for broadcasting a capture stream.
+type BroadcasterOptions struct {
+	// QueueLength is the number of pcapng blocks queued for each consumer
+	// before packets get dropped for this consumer, defaulting to
+	// DefaultBroadcastQueueLength.
+	QueueLength int
+	// CheckOrigin optionally checks the origin of websocket clients; see also
+	// websocket.Upgrader.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Broadcaster re-broadcasts the pcapng stream of a single capture to multiple
+// dynamically attached consumers, such as a dashboard, a file and Wireshark
+// at the same time. A Broadcaster is the writer to pass to SharkTank.Capture.
+//
+// Each consumer has its own queue, so slow consumers don't hold back the
+// capture or the other consumers: when a consumer's queue is full, the
+// consumer misses packets instead. Consumers attaching late first receive the
+// section header and interface descriptions of the current section, so that
+// they always receive a valid pcapng stream.
+type Broadcaster struct {
+	opts BroadcasterOptions
+
+	mu        sync.Mutex
+	scanner   *pcapng.Scanner
+	header    [][]byte // SHB and IDBs of the current section.
+	consumers map[*Consumer]struct{}
+	cs        CaptureStreamer
+	closed    bool
+}
+
+var _ io.Writer = (*Broadcaster)(nil)
+var _ http.Handler = (*Broadcaster)(nil)
+
+// NewBroadcaster returns a new Broadcaster without any consumers attached
+// yet.
+func NewBroadcaster(opts *BroadcasterOptions) *Broadcaster {
+	b := &Broadcaster{
+		consumers: map[*Consumer]struct{}{},
+	}
+	if opts != nil {
+		b.opts = *opts
+	}
+	if b.opts.QueueLength <= 0 {
+		b.opts.QueueLength = DefaultBroadcastQueueLength
+	}
+	b.scanner = pcapng.NewScanner(b.block)
+	return b
+}
+
+// Follow the specified capture: when the capture ends, the broadcast ends too,
+// and Stop stops the capture.
+func (b *Broadcaster) Follow(cs CaptureStreamer) {
+	b.mu.Lock()
+	b.cs = cs
+	b.mu.Unlock()
+	go func() {
+		cs.Wait()
+		b.Close()
+	}()
+}
+
+// Stop the followed capture, if any, and end the broadcast.
+func (b *Broadcaster) Stop() {
+	b.mu.Lock()
+	cs := b.cs
+	b.mu.Unlock()
+	if cs != nil {
+		cs.Stop()
+	}
+	b.Close()
+}
+
+// Close ends the broadcast: the consumers still receive the blocks already
+// queued for them and then end. Close is idempotent.
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for c := range b.consumers {
+		close(c.queue)
+		delete(b.consumers, c)
+	}
+	return nil
+}
+
+// Write writes octets of the pcapng stream to be broadcast, queueing the
+// blocks completed by these octets for all attached consumers.
+func (b *Broadcaster) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, ErrBroadcastClosed
+	}
+	return b.scanner.Write(p)
+}
+
+// block queues a complete block for all attached consumers, keeping track of
+// the section header and interface descriptions for consumers attaching
+// later. Callers must hold the lock.
+func (b *Broadcaster) block(blk *pcapng.Block) error {
+	octets := blk.Bytes()
+	structural := false
+	switch blk.Type {
+	case pcapng.BlockSHB:
+		b.header = [][]byte{octets}
+		structural = true
+	case pcapng.BlockIDB:
+		b.header = append(b.header, octets)
+		structural = true
+	}
+	for c := range b.consumers {
+		select {
+		case c.queue <- octets:
+		default:
+			if structural {
+				log.Warnf("detaching broadcast consumer: %s", ErrSlowConsumer)
+				c.setErr(ErrSlowConsumer)
+				c.stopOnce.Do(func() { close(c.stop) })
+				delete(b.consumers, c)
+				continue
+			}
+			c.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Attach a new consumer writing the broadcast pcapng stream to w, beginning
+// with the current section. When attaching after the broadcast has ended, the
+// returned consumer has already ended with ErrBroadcastClosed.
+func (b *Broadcaster) Attach(w io.Writer) *Consumer {
+	c := &Consumer{
+		b:     b,
+		w:     w,
+		queue: make(chan []byte, b.opts.QueueLength),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		c.err = ErrBroadcastClosed
+		close(c.done)
+		return c
+	}
+	c.preamble = append([][]byte(nil), b.header...)
+	b.consumers[c] = struct{}{}
+	go c.run()
+	return c
+}
+
+// Consumers returns the number of currently attached consumers.
+func (b *Broadcaster) Consumers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.consumers)
+}
+
+// detach removes the consumer from the broadcast.
+func (b *Broadcaster) detach(c *Consumer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.consumers, c)
+}
+
+// ServeHTTP attaches a new consumer for the duration of the HTTP request,
+// streaming the broadcast either via a websocket, if requested, or otherwise
+// as the response body.
+func (b *Broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		b.serveWebsocket(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", CaptureStreamMediaType)
+	w.WriteHeader(http.StatusOK)
+	fw := &flushingWriter{w: w}
+	// Send the response header right away, as it might take a while until
+	// the next packet arrives.
+	if fw.flusher, _ = w.(http.Flusher); fw.flusher != nil {
+		fw.flusher.Flush()
+	}
+	c := b.Attach(fw)
+	select {
+	case <-c.Done():
+	case <-r.Context().Done():
+		c.Detach()
+		<-c.Done()
+	}
+}
+
+// serveWebsocket streams the broadcast via a websocket in binary messages.
+func (b *Broadcaster) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: b.opts.CheckOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debugf("broadcast websocket upgrade failed: %s", err.Error())
+		return
+	}
+	defer conn.Close()
+	c := b.Attach(&websocketWriter{conn: conn})
+	// Keep reading in order to process control messages, detaching when the
+	// client goes away.
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				c.Detach()
+				return
+			}
+		}
+	}()
+	<-c.Done()
+	_ = conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// Consumer is a single consumer of a broadcast pcapng stream.
+type Consumer struct {
+	b        *Broadcaster
+	w        io.Writer
+	preamble [][]byte // section header and interface descriptions.
+	queue    chan []byte
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	dropped  atomic.Uint64
+
+	mu  sync.Mutex
+	err error
+}
+
+// Detach the consumer from the broadcast. The consumer doesn't write any
+// further blocks once its current write has finished. Detach is idempotent.
+func (c *Consumer) Detach() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.b.detach(c)
+}
+
+// Done returns a channel that gets closed when the consumer has ended, either
+// because the broadcast has ended, it has been detached, or writing failed.
+func (c *Consumer) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that ended the consumer, if any.
+func (c *Consumer) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Dropped returns the number of blocks the consumer missed because it was
+// too slow.
+func (c *Consumer) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// setErr sets the error ending the consumer, unless already set.
+func (c *Consumer) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// run writes the preamble and then the queued blocks to the consumer's
+// writer, batching the blocks already queued.
+func (c *Consumer) run() {
+	defer close(c.done)
+	for _, octets := range c.preamble {
+		if !c.write(octets) {
+			return
+		}
+	}
+	c.preamble = nil
+	var batch []byte
+	for {
+		select {
+		case <-c.stop:
+			return
+		case octets, ok := <-c.queue:
+			if !ok {
+				return
+			}
+			batch = append(batch[:0], octets...)
+			more := true
+			for more && len(batch) < broadcastBatchSize {
+				select {
+				case octets, ok := <-c.queue:
+					if !ok {
+						c.write(batch)
+						return
+					}
+					batch = append(batch, octets...)
+				default:
+					more = false
+				}
+			}
+			if !c.write(batch) {
+				return
+			}
+		}
+	}
+}
+
+// write writes the octets to the consumer's writer, detaching the consumer
+// and returning false if writing failed.
+func (c *Consumer) write(octets []byte) bool {
+	if _, err := c.w.Write(octets); err != nil {
+		log.Debugf("broadcast consumer failed: %s", err.Error())
+		c.setErr(err)
+		c.b.detach(c)
+		return false
+	}
+	return true
+}
+
+// flushingWriter flushes each write to an HTTP response.
+type flushingWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (w *flushingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err == nil && w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return n, err
+}
+
+// websocketWriter writes each write as a binary websocket message.
+type websocketWriter struct {
+	conn *websocket.Conn
+}
+
+func (w *websocketWriter) Write(p []byte) (int, error) {
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
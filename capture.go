@@ -8,14 +8,18 @@
 package csharg
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -42,6 +46,171 @@ type CaptureOptions struct {
 	// force it off. This zero setting defaults to switching promiscuous mode
 	// ON.
 	AvoidPromiscuousMode bool
+	// MaxBuffer optionally limits the in-flight buffering of a capture stream
+	// in octets, so that captures can run in memory-constrained environments.
+	// It limits the size of individual websocket messages from the capture
+	// service: when a message exceeds this limit, the capture is aborted with
+	// ErrBufferLimit. It additionally limits the size of the initial section
+	// header block buffered for editing: when exceeded, the stream is passed
+	// through without adding capture target information. Zero means no limit.
+	MaxBuffer int64
+	// Session optionally describes the business context of the capture
+	// session, which gets sent to the capture service for its audit logs.
+	Session SessionMetadata
+	// Names optionally resolves network addresses to names, such as the names
+	// of Kubernetes services and their endpoints (see also ServiceNames). They
+	// get added to the capture stream in a name resolution block.
+	Names *pcapng.NameResolution
+	// VLANs optionally restricts capturing to packets tagged with any of
+	// these VLAN IDs, if supported by the capture service. This avoids
+	// having to encode VLAN matching in the Filter expression.
+	VLANs []uint16
+	// Decapsulate optionally makes the capture service strip these tunnel
+	// encapsulations, if supported, so that the inner packets get captured.
+	Decapsulate []Encapsulation
+	// Raw passes the capture stream through exactly as sent by the capture
+	// service, without adding capture target information and names, and
+	// without finalizing stopped captures. This is mainly useful for
+	// debugging capture services.
+	Raw bool
+	// InterfaceAliases optionally renames network interfaces in the capture
+	// stream, indexed by their kernel names, such as “eth0@if12”, into
+	// readable aliases (see also InterfaceAliases). The aliases also get
+	// recorded in the capture target information.
+	InterfaceAliases map[string]string
+	// Alerts optionally alerts about stalls, slow writes, and dropped packets
+	// while capturing.
+	Alerts *CaptureAlerts
+	// Events optionally gets called on lifecycle events of the capture, such
+	// as when the capture stream has been established, the first packet
+	// arrived, or the capture closed. It gets called from the goroutine
+	// streaming the capture data, so it must not block.
+	Events func(LifecycleEvent)
+	// MaxOutput optionally limits the size of the packet capture written by
+	// CaptureContext, CapturePodContext, and CaptureContainerContext, such as
+	// for protecting shared volumes: the capture gets stopped gracefully
+	// before exceeding the limit, only the final interface statistics might
+	// exceed it slightly. Zero means no limit.
+	MaxOutput int64
+	// MaxPackets optionally stops the capture gracefully after this number of
+	// network packets, similar to tcpdump's "-c" option; packets arriving
+	// while the capture stops get dropped. When capturing from multiple
+	// targets at the same time, the limit applies to all targets together.
+	// Zero means no limit.
+	MaxPackets int64
+	// SnapLen optionally limits the captured length of each network packet
+	// to this number of octets, such as for capturing only the packet headers
+	// from high-volume links. The snap length gets passed to the capture
+	// service; as capture services not supporting it send complete packets,
+	// the packet data additionally gets truncated client-side (see also
+	// pcapng.Truncator). Zero means no limit.
+	SnapLen int
+	// NoLoopback excludes the loopback network interface “lo” when capturing
+	// from all network interfaces of the capture target as discovered, as
+	// loopback traffic often dominates captures without being of interest.
+	NoLoopback bool
+	// Heartbeat optionally adds interface statistics to the capture stream
+	// each time no capture data arrived for this duration, so that consumers
+	// can tell a capture without network traffic from a dead capture stream.
+	// Zero disables heartbeats.
+	Heartbeat time.Duration
+	// Reconnect optionally re-requests websocket capture streams whose
+	// connection to the capture service broke or stalled, retrying for up to
+	// this duration with increasing backoff. The resumed capture stream then
+	// continues the same packet capture, without repeating its section header
+	// and interface descriptions (see also pcapng.Resumer). Packets arriving
+	// at the capture service while reconnecting are lost. Zero disables
+	// reconnecting.
+	Reconnect time.Duration
+}
+
+// CheckCapabilities checks the capture options against the capabilities of the
+// specified capture target, if known, returning an error describing the first
+// unsupported capture option. Capture targets without known capabilities pass
+// unchecked.
+func (opts *CaptureOptions) CheckCapabilities(t *api.Target) error {
+	if t == nil || t.Capabilities == nil {
+		return nil
+	}
+	if opts.Filter != "" && !t.Capabilities.SupportsFilter {
+		return fmt.Errorf("capture target %s does not support capture filters", t)
+	}
+	// Capturing from all network interfaces means all network interfaces of
+	// the capture target.
+	nifs := len(opts.targetNifs(t))
+	if limit := t.Capabilities.MaxNifs; limit > 0 && nifs > limit {
+		return fmt.Errorf("capture target %s supports capturing from at most %d network interfaces, but %d requested",
+			t, limit, nifs)
+	}
+	if len(opts.VLANs) > 0 && !t.Capabilities.SupportsVLAN {
+		return fmt.Errorf("capture target %s does not support capturing VLANs", t)
+	}
+nextEncap:
+	for _, encap := range opts.Decapsulate {
+		for _, supported := range t.Capabilities.Decapsulations {
+			if string(encap) == supported {
+				continue nextEncap
+			}
+		}
+		return fmt.Errorf("capture target %s does not support stripping %s encapsulation", t, encap)
+	}
+	return nil
+}
+
+// MaxSnapLen is the maximum snap length, matching the maximum snap length
+// supported by libpcap.
+const MaxSnapLen = 262144
+
+// ErrBufferLimit signals that a capture stream has been aborted because it
+// exceeded the MaxBuffer limit.
+var ErrBufferLimit = errors.New("capture stream exceeded buffer limit")
+
+// ErrStalled signals that a capture stream has been aborted because no capture
+// data arrived within the stall timeout of the client options.
+var ErrStalled = errors.New("capture stream stalled")
+
+// CaptureError describes why a capture failed, as opposed to the capture
+// having been stopped or the capture service having gracefully ended it. Use
+// errors.Is and errors.As to check for the underlying error, such as
+// ErrStalled, ErrBufferLimit, a websocket.CloseError with the capture
+// service's close reason, or the error of a failing writer.
+type CaptureError struct {
+	// Op is either "receive" when receiving the capture stream from the
+	// capture service failed, or "write" when writing the capture stream
+	// failed.
+	Op string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *CaptureError) Error() string {
+	return fmt.Sprintf("cannot %s capture stream: %s", e.Op, e.Err.Error())
+}
+
+func (e *CaptureError) Unwrap() error { return e.Err }
+
+// captureFailure records the first failure of a capture, if any. It is safe
+// for concurrent use.
+type captureFailure struct {
+	mu  sync.Mutex
+	err error
+}
+
+// fail records the failure of the specified operation, unless the capture
+// already failed before.
+func (f *captureFailure) fail(op string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = &CaptureError{Op: op, Err: err}
+	}
+}
+
+// Err returns the recorded failure, or nil.
+func (f *captureFailure) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
 }
 
 // Nifs is a list of network interface names.
@@ -54,6 +223,45 @@ type Nifs []string
 // of the implicit zero default.
 var AllNifs = Nifs{}
 
+// loopbackNif is the name of the loopback network interface.
+const loopbackNif = "lo"
+
+// targetNifs returns the network interfaces to capture from: either the
+// network interfaces explicitly asked for, or otherwise the network interfaces
+// of the capture target, except for loopback if so asked for. An empty result
+// means all network interfaces.
+func (opts *CaptureOptions) targetNifs(t *api.Target) Nifs {
+	if len(opts.Nifs) != 0 {
+		return opts.Nifs
+	}
+	if !opts.NoLoopback {
+		return t.NetworkInterfaces
+	}
+	nifs := Nifs{}
+	for _, nif := range t.NetworkInterfaces {
+		if nif != loopbackNif {
+			nifs = append(nifs, nif)
+		}
+	}
+	return nifs
+}
+
+// resolveNifs returns the network interfaces to capture from, as sent to the
+// capture service. When asked to exclude loopback, it fails if the network
+// interfaces of the capture target are unknown, or if there's nothing else
+// besides loopback, as capturing from all network interfaces would otherwise
+// include loopback anyway.
+func (opts *CaptureOptions) resolveNifs(t *api.Target) (Nifs, error) {
+	nifs := opts.targetNifs(t)
+	if len(nifs) == 0 && len(opts.Nifs) == 0 && opts.NoLoopback {
+		if len(t.NetworkInterfaces) == 0 {
+			return nil, fmt.Errorf("cannot exclude loopback, as the network interfaces of capture target %s are unknown", t)
+		}
+		return nil, fmt.Errorf("capture target %s has no network interfaces besides loopback", t)
+	}
+	return nifs, nil
+}
+
 // SharkTank gives access to network captures in clusters via the
 // SharkTank cluster capture service.
 type SharkTank interface {
@@ -63,7 +271,8 @@ type SharkTank interface {
 	// stream to the writer w. The capture optionally can be restricted to only
 	// a subset of the pod's network interfaces. The pod name can be prefixed by
 	// a namespace in form of "namespace/podname"; if the namespace is left out
-	// it defaults to the aptly-named "default" namespace.
+	// it defaults to the client's configured namespace, or otherwise to the
+	// aptly-named "default" namespace.
 	CapturePod(w io.Writer, podname string, opts *CaptureOptions) (cs CaptureStreamer, err error)
 	// Captures network traffic from a specific container on a specific
 	// kubernetes node. Of course, the capture can be restricted to only a
@@ -74,11 +283,68 @@ type SharkTank interface {
 	// limited to a specific (set of) network interface(s) for this target. The
 	// captured packets are then send to the given Writer.
 	Capture(w io.Writer, t *api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error)
+	// Prepares capturing network traffic from a capture target like Capture
+	// does, including target discovery and completion as well as connecting
+	// to the capture service, but delays requesting the captured packets
+	// until the returned PreparedCapture is started. This allows starting
+	// captures from multiple targets at the same instant.
+	Prepare(w io.Writer, t *api.Target, opts *CaptureOptions) (pc PreparedCapture, err error)
+	// TargetsContext lists the available capture targets like Targets does,
+	// but returns the context's error when the context is done before the
+	// discovery completes. Capture service clients additionally return
+	// errors wrapping ErrServiceUnreachable when the capture service cannot
+	// be contacted, ErrUnauthenticated when it rejects the credentials, and
+	// ErrForbidden when it denies the discovery.
+	TargetsContext(ctx context.Context) (ts api.Targets, err error)
+	// CapturePodContext captures from a pod like CapturePod does, but see
+	// CaptureContext for how the context applies.
+	CapturePodContext(ctx context.Context, w io.Writer, podname string, opts *CaptureOptions) (cs CaptureStreamer, err error)
+	// CaptureContainerContext captures from a container like
+	// CaptureContainer does, but see CaptureContext for how the context
+	// applies.
+	CaptureContainerContext(ctx context.Context, w io.Writer, nodename, name string, opts *CaptureOptions) (cs CaptureStreamer, err error)
+	// CaptureContext captures from a capture target like Capture does, but
+	// gives up discovering the capture target and connecting to the capture
+	// service when the context is done, returning the context's error.
+	// Afterwards, the capture gets stopped in an orderly manner when the
+	// context is done. In contrast to the CaptureContext function, the
+	// packet capture doesn't get finalized.
+	CaptureContext(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error)
+	// PrepareContext prepares a capture from a capture target like Prepare
+	// does, but see CaptureContext for how the context applies, both while
+	// preparing and after the prepared capture has been started.
+	PrepareContext(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions) (pc PreparedCapture, err error)
+	// Captures network traffic from multiple capture targets at the same
+	// time, such as both ends of a pod-to-pod conversation, merging the
+	// captured packets of all targets as they arrive into a single section
+	// written to w. The network interfaces of the individual targets are kept
+	// distinct, with their descriptions naming the capture targets. The
+	// returned capture ends only after the captures from all targets ended.
+	CaptureMany(w io.Writer, targets []*api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error)
+	// Captures network traffic from a capture target like Capture does, but
+	// returns a reader delivering the packet capture stream, see the
+	// CaptureReader function for details.
+	CaptureReader(t *api.Target, opts *CaptureOptions) (r io.ReadCloser, err error)
+	// Checks whether capturing from a capture target is permitted without
+	// actually capturing: it returns nil if the capture service accepts the
+	// credentials for capturing from this target. Otherwise, it returns an
+	// error, wrapping ErrUnauthenticated or ErrForbidden if the capture service
+	// rejects the credentials or capturing from this target respectively, or
+	// wrapping ErrServiceUnreachable if the capture service cannot be
+	// contacted.
+	CanCapture(t *api.Target) error
 	// Clears the cached set of capture targets: a SharkTank will fetch the set
 	// of capture targets anew when it needs them, and will then cache them
 	// because typically there will be multiple lookups into the cached set
-	// necessary in order to start a capture.
+	// necessary in order to start a capture. Discoveries still in flight
+	// when clearing get cancelled, and their stale results discarded.
 	Clear()
+	// Closes this SharkTank, stopping all its active captures in an orderly
+	// manner and cancelling its prepared captures, as well as cancelling
+	// discoveries in flight and releasing its connections to the capture
+	// service. Close waits for the captures to terminate. Afterwards, captures
+	// fail with ErrClosed. Closing again does nothing.
+	Close() error
 }
 
 // CaptureStreamer gives control over an individual network packet capture.
@@ -91,21 +357,82 @@ type CaptureStreamer interface {
 	// StopAfter waits the specified duration for the capture to terminate, and
 	// terminates it after the duration if necessary.
 	StopAfter(d time.Duration)
+	// StopAfterContext waits the specified duration for the capture to
+	// terminate, like StopAfter, but additionally terminates the capture when
+	// the context is done, returning the context's error. It reports true if
+	// the capture ended by itself, and false if it had to be stopped.
+	StopAfterContext(ctx context.Context, d time.Duration) (bool, error)
+	// Stats returns the live statistics of this capture, such as the number
+	// of network packets received so far and when the last one arrived.
+	Stats() CaptureStats
+	// Err returns why the capture failed, such as a *CaptureError, or nil while
+	// the capture is still running, or after it has been stopped or the
+	// capture service gracefully ended it.
+	Err() error
+	// WaitErr waits for the capture to terminate, like Wait, and then returns
+	// why it failed, if it failed, like Err.
+	WaitErr() error
+	// StopErr stops this capture, like Stop, and then returns why it failed
+	// before being stopped, if it failed, like Err.
+	StopErr() error
 }
 
+// Backoff when reconnecting broken websocket capture streams.
+const (
+	reconnectBackoff    = 250 * time.Millisecond
+	maxReconnectBackoff = 5 * time.Second
+)
+
+// redialFunc connects anew to the capture service via a websocket in order to
+// resume a broken capture stream.
+type redialFunc func(ctx context.Context) (*websocket.Conn, error)
+
 // captureStreamer is the implementation of the CaptureStreamer interface.
 type captureStreamer struct {
-	// The (wrapped) websocket for the network packet stream.
-	cws *websock.ReadingClientWebsocket
+	mu sync.Mutex
+	// The (wrapped) websocket for the network packet stream; it gets replaced
+	// when reconnecting.
+	cws     *websock.ReadingClientWebsocket
+	stopped bool
+	// Optionally reconnects broken capture streams for up to the reconnect
+	// duration; stopping the capture cancels reconnecting.
+	redial      redialFunc
+	reconnect   time.Duration
+	ctx         context.Context
+	cancel      context.CancelFunc
+	brokenSince time.Time     // when the capture stream last broke after delivering data.
+	backoff     time.Duration // backoff before reconnecting next.
 	// Signals that the capture (and the capture stream) finally has ended.
-	done chan bool
+	done      chan bool
+	stats     *StatsWriter
+	failure   captureFailure
+	lifecycle *lifecycle
 }
 
 // Stop the packet capture and waits for the capture to gracefully terminate.
 // See also Wait() for the usecase where a go routine needs to wait for the
 // capture to terminate, but will not initiate the termination itself.
 func (cs *captureStreamer) Stop() {
-	cs.cws.Close()
+	cs.mu.Lock()
+	cs.stopped = true
+	cws := cs.cws
+	cs.mu.Unlock()
+	if cs.redial == nil {
+		cws.Close()
+		return
+	}
+	// Give up reconnecting, and wait for the capture stream to end, as it
+	// might be in between websockets.
+	cs.cancel()
+	cws.Close()
+	<-cs.done
+}
+
+// websocket returns the current websocket of the capture stream.
+func (cs *captureStreamer) websocket() *websock.ReadingClientWebsocket {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.cws
 }
 
 // Wait for the packet capture to terminate, without initiating it. See also
@@ -125,10 +452,52 @@ func (cs *captureStreamer) StopAfter(d time.Duration) {
 	}
 }
 
+// StopAfterContext waits for the packet capture to terminate and terminates it after
+// the specified duration or when the context is done, whichever comes first.
+// It reports whether the packet capture ended by itself.
+func (cs *captureStreamer) StopAfterContext(ctx context.Context, d time.Duration) (bool, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-cs.done:
+		return true, nil
+	case <-timer.C:
+		cs.Stop()
+		return false, nil
+	case <-ctx.Done():
+		cs.Stop()
+		return false, ctx.Err()
+	}
+}
+
+// Stats returns the live statistics of the packet capture.
+func (cs *captureStreamer) Stats() CaptureStats {
+	return cs.stats.Stats()
+}
+
+// Err returns why the packet capture failed, if it failed.
+func (cs *captureStreamer) Err() error {
+	return cs.failure.Err()
+}
+
+// WaitErr waits for the packet capture to terminate and returns why it
+// failed, if it failed.
+func (cs *captureStreamer) WaitErr() error {
+	cs.Wait()
+	return cs.Err()
+}
+
+// StopErr stops the packet capture and returns why it failed before, if it
+// failed.
+func (cs *captureStreamer) StopErr() error {
+	cs.Stop()
+	return cs.Err()
+}
+
 // CompleteTarget completes the capture target description to the point that the
 // SharkTank service can be successfully contacted on the service application
 // level. If the target description needs to be modified, then CompleteTarget
-// will return a shallow copy of the passed target description, with the
+// will return a deep copy of the passed target description, with the
 // necessary additional data filled in. Otherwise, if the target description is
 // already sufficient to start the capture, then it will be returned as-is
 // instead.
@@ -146,32 +515,89 @@ func CompleteTarget(t *api.Target, opts *CaptureOptions, ts *TargetCache) (*api.
 	// information, we need to first look it up. That's because the developer of
 	// this crap is slightly dumb.
 	if t.CaptureService == "" {
-		if t.Type == "pod" {
-			tcached, ok := ts.Pod(t.Name)
+		if t.Type.IsPod() {
+			tcached, ok := ts.Pod(t.QualifiedName())
 			if !ok {
-				return nil, fmt.Errorf("non-existing target %+v", *t)
+				return nil, fmt.Errorf("%w %s", ErrTargetNotFound, t)
 			}
 			// Since we're going to update the capture target description, we
-			// make a shallow copy first
-			tshallow := *tcached
-			t = &tshallow
+			// make a deep copy first, so callers cannot accidentally modify
+			// the cached description.
+			t = tcached.Clone()
 		} else {
 			tcached, ok := ts.OnNode(t.NodeName, t.Prefix, t.Name)
 			if !ok {
-				return nil, fmt.Errorf("non-existing target %+v", *t)
+				return nil, fmt.Errorf("%w %s", ErrTargetNotFound, t)
 			}
-			tshallow := *tcached
-			t = &tshallow
+			t = tcached.Clone()
 		}
 	}
 	// By now we will have the required information about the particular capture
 	// service instance responsible for our capture target.
 	if strings.ContainsAny(t.CaptureService, "/?%") {
-		return nil, fmt.Errorf("missing or invalid capture service routing for target %+v", t)
+		return nil, fmt.Errorf("missing or invalid capture service routing for target %s", t)
 	}
 	return t, nil
 }
 
+// newStreamSink returns the writer for the capture stream data received from a
+// capture service: usually a StreamEditor adding the capture target
+// information before writing to w, or otherwise w itself for raw capture
+// streams. Network interfaces with aliases get renamed before editing, and
+// heartbeats get added before renaming. When alerting, the capture stream gets
+// watched before renaming and editing. When limiting the number of packets,
+// the stop function gets called in the background after the last packet
+// within the limit. The returned finish function must be called after the
+// capture stream has ended.
+func newStreamSink(w io.Writer, t *api.Target, opts *CaptureOptions, stop func()) (io.Writer, func()) {
+	sink, finish := newEditingSink(w, t, opts)
+	if opts.Alerts != nil {
+		aw := NewAlertWriter(sink, opts.Alerts)
+		editfinish := finish
+		sink, finish = aw, func() {
+			aw.Finish()
+			editfinish()
+		}
+	}
+	if opts.MaxPackets > 0 {
+		limit := opts.MaxPackets
+		sink = pcapng.NewPacketLimitWriter(sink, limit, func() {
+			log.Infof("capture reached packet limit of %d, stopping capture", limit)
+			go stop()
+		})
+	}
+	return sink, finish
+}
+
+// newEditingSink returns the writer editing the capture stream data before
+// writing it to w, if necessary, together with its finish function.
+func newEditingSink(w io.Writer, t *api.Target, opts *CaptureOptions) (io.Writer, func()) {
+	if opts.Raw {
+		return w, func() {}
+	}
+	pcapedit := pcapng.NewStreamEditor(w, t, opts.Filter, opts.AvoidPromiscuousMode)
+	pcapedit.Names = opts.Names
+	if opts.MaxBuffer > 0 {
+		pcapedit.MaxSHBLength = opts.MaxBuffer
+	}
+	var sink io.Writer = pcapedit
+	if len(opts.InterfaceAliases) != 0 {
+		pcapedit.Aliases = opts.InterfaceAliases
+		sink = pcapng.NewRenamer(pcapedit, opts.InterfaceAliases)
+	}
+	if opts.SnapLen > 0 {
+		sink = pcapng.NewTruncator(sink, uint32(opts.SnapLen))
+	}
+	if opts.Heartbeat > 0 {
+		hb := pcapng.NewHeartbeat(sink, opts.Heartbeat)
+		return hb, func() {
+			hb.Stop()
+			pcapedit.Finish()
+		}
+	}
+	return sink, func() { pcapedit.Finish() }
+}
+
 // StartCaptureStream is a low-level function almost all cshark package users
 // WON'T use. Instead, csharg package users typically want to use the high-level
 // SharkTank methods CapturePod, CaptureContainer, and Capture instead. Please
@@ -183,7 +609,16 @@ func CompleteTarget(t *api.Target, opts *CaptureOptions, ts *TargetCache) (*api.
 // the websocket and then in the background streams the incomming network packet
 // data into the given Writer.
 func StartCaptureStream(w io.Writer, ws *websocket.Conn, t *api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error) {
-	log.Debugf("capturing from: %s %s", t.Type, t.Name)
+	return startCaptureStream(w, ws, t, opts, 0, nil)
+}
+
+// startCaptureStream starts streaming the capture data arriving on the
+// websocket, aborting the capture stream when no capture data arrives within
+// the specified stall timeout, unless zero. When the capture options ask for
+// reconnecting and a redial function has been specified, broken capture
+// streams get resumed on new websockets.
+func startCaptureStream(w io.Writer, ws *websocket.Conn, t *api.Target, opts *CaptureOptions, stall time.Duration, redial redialFunc) (cs CaptureStreamer, err error) {
+	log.Debugf("capturing from: %s", t)
 	log.Debugf("capturing from network interfaces: %s", strings.Join(t.NetworkInterfaces, ", "))
 
 	csimpl := &captureStreamer{
@@ -192,6 +627,14 @@ func StartCaptureStream(w io.Writer, ws *websocket.Conn, t *api.Target, opts *Ca
 		cws:  websock.New(ws),
 		done: make(chan bool),
 	}
+	if opts.Reconnect > 0 && redial != nil {
+		csimpl.redial = redial
+		csimpl.reconnect = opts.Reconnect
+		csimpl.ctx, csimpl.cancel = context.WithCancel(context.Background())
+	}
+	sink, finish := newStreamSink(w, t, opts, csimpl.Stop)
+	csimpl.stats = NewStatsWriter(sink)
+	csimpl.lifecycle = newLifecycle(t, opts, csimpl.stats)
 	cs = csimpl
 	// Sending the incomming packet capture data from the websocket to the
 	// writer is done in a separate go routine. Beyond "just" connecting the
@@ -199,47 +642,203 @@ func StartCaptureStream(w io.Writer, ws *websocket.Conn, t *api.Target, opts *Ca
 	// the writer to break
 	go func() {
 		defer close(csimpl.done)
-		pcapedit := pcapng.NewStreamEditor(
-			w, t, opts.Filter, opts.AvoidPromiscuousMode)
+		if csimpl.cancel != nil {
+			defer csimpl.cancel()
+		}
+		defer func() { csimpl.lifecycle.emit(EventClosed, csimpl.failure.Err()) }()
+		defer finish()
+		csimpl.lifecycle.emit(EventConnected, nil)
+		var pcapedit io.Writer = csimpl.stats
+		var resumer *pcapng.Resumer
+		if csimpl.redial != nil {
+			// Splice resumed capture streams into the section of the
+			// original capture stream before editing.
+			resumer = pcapng.NewResumer(pcapedit)
+			pcapedit = resumer
+		}
 		for {
-			// Wait for more packet data to arrive, or the websocket becoming
-			// closed/broken.
-			data, err := csimpl.cws.Read()
-			if err != nil {
-				log.Debugf("websocket packet data stream error: %s", err.Error())
+			broken, delivered := csimpl.stream(pcapedit, opts, stall)
+			if !broken || csimpl.redial == nil {
 				return
 			}
-			// Now forward the packet data into the Wireshark pipe. But pass it
-			// through our pcapng stream editor.
-			_, err = pcapedit.Write(data)
-			perr, ok := err.(*os.PathError)
-			if ok && (perr.Err == os.ErrClosed) {
-				log.Errorf("capture stream writer is fed up and does not accpet any more packets.")
-				go func() {
-					// We need to read further from the websocket in order to
-					// keep the control message interaction going during the
-					// graceful close. It's just that we're throwing away any
-					// packet capture data that might still arrive because it
-					// was already in flight.
-					log.Debug("draining websocket...")
-					for {
-						_, err := csimpl.cws.Read()
-						if err != nil {
-							break
-						}
-					}
-					log.Debug("...drained")
-				}()
-				return
-			} else if err != nil {
-				log.Errorf("capture stream writer failed: %s", err.Error())
+			if !csimpl.reconnectStream(delivered) {
 				return
 			}
+			resumer.Resume()
+			csimpl.lifecycle.emit(EventConnected, nil)
 		}
 	}()
 	return cs, nil
 }
 
+// stream the capture data arriving on the current websocket into the writer
+// until the capture stream ends, reporting whether the capture stream broke
+// and is to be reconnected, and whether it delivered any capture data.
+func (cs *captureStreamer) stream(pcapedit io.Writer, opts *CaptureOptions, stall time.Duration) (broken, delivered bool) {
+	cws := cs.websocket()
+	ws := cws.Conn
+	if opts.MaxBuffer > 0 {
+		ws.SetReadLimit(opts.MaxBuffer)
+	}
+	for {
+		// Wait for more packet data to arrive, or the websocket becoming
+		// closed/broken.
+		if stall > 0 {
+			_ = ws.SetReadDeadline(time.Now().Add(stall))
+		}
+		data, err := cws.Read()
+		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				log.Errorf("%s of %d octets, aborting capture", ErrBufferLimit, opts.MaxBuffer)
+				cs.failure.fail("receive", ErrBufferLimit)
+				return false, delivered
+			}
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				cws.Abort()
+				cs.lifecycle.emit(EventStalled, nil)
+				if cs.redial != nil {
+					log.Warnf("%s for %s, reconnecting", ErrStalled, stall)
+					cs.lifecycle.emit(EventReconnecting, ErrStalled)
+					return true, delivered
+				}
+				log.Errorf("%s for %s, aborting capture", ErrStalled, stall)
+				cs.failure.fail("receive", ErrStalled)
+				return false, delivered
+			}
+			log.Debugf("websocket packet data stream error: %s", err.Error())
+			// The capture service gracefully ending the capture stream as
+			// well as stopping the capture end the capture stream for good;
+			// abnormal closures are connections lost without any close
+			// handshake.
+			var cerr *websocket.CloseError
+			if cs.isStopped() {
+				return false, delivered
+			}
+			if errors.As(err, &cerr) && cerr.Code != websocket.CloseAbnormalClosure {
+				if cerr.Code != websocket.CloseNormalClosure {
+					cs.failure.fail("receive", err)
+				}
+				return false, delivered
+			}
+			if cs.redial == nil {
+				cs.failure.fail("receive", err)
+				return false, delivered
+			}
+			log.Warnf("capture stream broke: %s, reconnecting", err.Error())
+			cs.lifecycle.emit(EventReconnecting, err)
+			return true, delivered
+		}
+		delivered = true
+		// Now forward the packet data into the Wireshark pipe. But pass it
+		// through our pcapng stream editor.
+		_, err = pcapedit.Write(data)
+		if err != nil {
+			if perr, ok := err.(*os.PathError); ok && perr.Err == os.ErrClosed {
+				log.Errorf("capture stream writer is fed up and does not accpet any more packets.")
+			} else {
+				log.Errorf("capture stream writer failed: %s", err.Error())
+			}
+			cs.failure.fail("write", err)
+			go func() {
+				// We need to read further from the websocket in order to
+				// keep the control message interaction going during the
+				// graceful close. It's just that we're throwing away any
+				// packet capture data that might still arrive because it
+				// was already in flight.
+				log.Debug("draining websocket...")
+				for {
+					_, err := cws.Read()
+					if err != nil {
+						break
+					}
+				}
+				log.Debug("...drained")
+			}()
+			return false, delivered
+		}
+		cs.lifecycle.written()
+	}
+}
+
+// reconnectStream connects anew to the capture service after the capture
+// stream broke, retrying with increasing backoff until either succeeding, the
+// reconnect duration since the capture stream last delivered capture data has
+// passed, the capture service rejects the capture, or the capture has been
+// stopped. Capture streams breaking without delivering any capture data get
+// reconnected only after a backoff. It returns true if the capture stream can
+// be resumed on the new websocket.
+func (cs *captureStreamer) reconnectStream(delivered bool) bool {
+	// Make sure the broken websocket is gone for good, so that stopping the
+	// capture doesn't wait for it.
+	cs.websocket().Abort()
+	if delivered || cs.brokenSince.IsZero() {
+		cs.brokenSince = time.Now()
+		cs.backoff = 0
+	}
+	deadline := cs.brokenSince.Add(cs.reconnect)
+	if !delivered && !cs.waitBackoff(deadline, errors.New("capture stream broke without capture data")) {
+		return false
+	}
+	for {
+		ctx, cancel := context.WithDeadline(cs.ctx, deadline)
+		ws, err := cs.redial(ctx)
+		cancel()
+		if err == nil {
+			cs.mu.Lock()
+			defer cs.mu.Unlock()
+			if cs.stopped {
+				ws.Close()
+				return false
+			}
+			cs.cws = websock.New(ws)
+			log.Info("reconnected capture stream")
+			return true
+		}
+		if cs.ctx.Err() != nil {
+			return false
+		}
+		if errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrForbidden) {
+			log.Errorf("cannot reconnect capture stream: %s", err.Error())
+			cs.failure.fail("receive", err)
+			return false
+		}
+		if !cs.waitBackoff(deadline, err) {
+			return false
+		}
+	}
+}
+
+// waitBackoff waits for the next, increased backoff before reconnecting,
+// returning false if the backoff would pass the deadline or the capture has
+// been stopped in the meantime.
+func (cs *captureStreamer) waitBackoff(deadline time.Time, err error) bool {
+	if cs.backoff *= 2; cs.backoff == 0 {
+		cs.backoff = reconnectBackoff
+	} else if cs.backoff > maxReconnectBackoff {
+		cs.backoff = maxReconnectBackoff
+	}
+	if time.Until(deadline) < cs.backoff {
+		log.Errorf("cannot reconnect capture stream within %s: %s", cs.reconnect, err.Error())
+		cs.failure.fail("receive", err)
+		return false
+	}
+	log.Warnf("cannot reconnect capture stream: %s, retrying in %s", err.Error(), cs.backoff)
+	select {
+	case <-cs.ctx.Done():
+		return false
+	case <-time.After(cs.backoff):
+		return true
+	}
+}
+
+// isStopped returns true if the capture has been stopped.
+func (cs *captureStreamer) isStopped() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.stopped
+}
+
 // CaptureServiceHeaders is a convenience function that builds the set of
 // capture service HTTP/WS headers required in order to successfully connect via
 // the Kubernetes remote API proxy to the capture service -- where the WS
@@ -249,17 +848,21 @@ func StartCaptureStream(w io.Writer, ws *websocket.Conn, t *api.Target, opts *Ca
 // service headers also when not passing broken Kubernetes remote API servers,
 // to keep things more uniform.
 func CaptureServiceHeaders(t *api.Target, opts *CaptureOptions) (header *http.Header, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
 	ctext, err := json.Marshal(t)
 	if err != nil {
 		return
 	}
 	// If the options specify the network interfaces to capture from, then take
 	// this options set. If this is set to AllNifs, then try to figure the exact
-	// set of network interfaces from the target description. And if that
-	// doesn't give us a clue, then fall back to "all" as the last resort.
-	nifs := opts.Nifs
-	if len(nifs) == 0 {
-		nifs = t.NetworkInterfaces
+	// set of network interfaces from the target description, optionally
+	// without loopback. And if that doesn't give us a clue, then fall back to
+	// "all" as the last resort.
+	nifs, err := opts.resolveNifs(t)
+	if err != nil {
+		return
 	}
 	if len(nifs) == 0 {
 		nifs = []string{"all"}
@@ -275,6 +878,11 @@ func CaptureServiceHeaders(t *api.Target, opts *CaptureOptions) (header *http.He
 	if len(opts.Filter) > 0 {
 		header.Set("Clustershark-Filter", opts.Filter)
 	}
+	if opts.SnapLen > 0 {
+		header.Set("Clustershark-Snaplen", strconv.Itoa(opts.SnapLen))
+	}
+	opts.Session.setHeader(*header)
+	opts.setEncapsulationHeader(*header)
 	return
 }
 
@@ -285,17 +893,21 @@ func CaptureServiceHeaders(t *api.Target, opts *CaptureOptions) (header *http.He
 // whenever we contact the SharkTank capture service, regardless of the path
 // we'll take.
 func CaptureServiceQueryParams(t *api.Target, opts *CaptureOptions) (values *url.Values, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
 	ctext, err := json.Marshal(t)
 	if err != nil {
 		return
 	}
 	// If the options specify the network interfaces to capture from, then take
 	// this options set. If this is set to AllNifs, then try to figure the exact
-	// set of network interfaces from the target description. And if that
-	// doesn't give us a clue, then fall back to "all" as the last resort.
-	nifs := opts.Nifs
-	if len(nifs) == 0 {
-		nifs = t.NetworkInterfaces
+	// set of network interfaces from the target description, optionally
+	// without loopback. And if that doesn't give us a clue, then fall back to
+	// "all" as the last resort.
+	nifs, err := opts.resolveNifs(t)
+	if err != nil {
+		return
 	}
 	if len(nifs) == 0 {
 		nifs = []string{"all"}
@@ -310,5 +922,10 @@ func CaptureServiceQueryParams(t *api.Target, opts *CaptureOptions) (values *url
 	if len(opts.Filter) > 0 {
 		values.Set("filter", opts.Filter)
 	}
+	if opts.SnapLen > 0 {
+		values.Set("snaplen", strconv.Itoa(opts.SnapLen))
+	}
+	opts.Session.setQuery(*values)
+	opts.setEncapsulationQuery(*values)
 	return
 }
@@ -0,0 +1,254 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+)
+
+// CaptureContext captures network traffic from a capture target like
+// SharkTank.CaptureContext does, stopping the capture when the context is
+// done, such as when its deadline expires. In contrast to cancelling the
+// writer, the capture is stopped in an orderly manner: the capture stream gets
+// closed gracefully and additionally the packet capture written to w is
+// properly finalized, ending with the final statistics of all its network
+// interfaces.
+//
+// Waiting for or stopping the returned capture waits for the finalization to
+// complete, so that the writer can be closed afterwards. Raw captures are
+// stopped, but not finalized.
+func CaptureContext(ctx context.Context, st SharkTank, w io.Writer, t *api.Target, opts *CaptureOptions) (CaptureStreamer, error) {
+	return captureContext(ctx, w, opts, func(w io.Writer) (CaptureStreamer, error) {
+		return st.CaptureContext(ctx, w, t, opts)
+	})
+}
+
+// CapturePodContext captures network traffic from a pod like
+// SharkTank.CapturePodContext does, but additionally finalizes the packet
+// capture; see CaptureContext for details.
+func CapturePodContext(ctx context.Context, st SharkTank, w io.Writer, podname string, opts *CaptureOptions) (CaptureStreamer, error) {
+	return captureContext(ctx, w, opts, func(w io.Writer) (CaptureStreamer, error) {
+		return st.CapturePodContext(ctx, w, podname, opts)
+	})
+}
+
+// CaptureContainerContext captures network traffic from a container like
+// SharkTank.CaptureContainerContext does, but additionally finalizes the
+// packet capture; see CaptureContext for details.
+func CaptureContainerContext(ctx context.Context, st SharkTank, w io.Writer, nodename, name string, opts *CaptureOptions) (CaptureStreamer, error) {
+	return captureContext(ctx, w, opts, func(w io.Writer) (CaptureStreamer, error) {
+		return st.CaptureContainerContext(ctx, w, nodename, name, opts)
+	})
+}
+
+// captureContext starts a capture writing to a finalizer in front of w, and
+// stops and then finalizes the capture when the context is done. Raw captures
+// write directly to w instead and thus don't get finalized. When the capture
+// options limit the output size, the capture additionally gets stopped when
+// reaching the limit.
+func captureContext(ctx context.Context, w io.Writer, opts *CaptureOptions, capture func(w io.Writer) (CaptureStreamer, error)) (CaptureStreamer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var f *pcapng.Finalizer
+	if opts == nil || !opts.Raw {
+		f = pcapng.NewFinalizer(w)
+		w = f
+	}
+	cancel := context.CancelFunc(func() {})
+	if opts != nil && opts.MaxOutput > 0 {
+		ctx, cancel = context.WithCancel(ctx)
+		limit := opts.MaxOutput
+		w = pcapng.NewLimitWriter(w, limit, func() {
+			log.Infof("packet capture reached output limit of %d octets, stopping capture", limit)
+			cancel()
+		})
+	}
+	cs, err := capture(w)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	ccs := &contextCaptureStreamer{
+		cs:   cs,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer cancel()
+		ccs.follow(ctx, f)
+	}()
+	return ccs, nil
+}
+
+// contextCaptureStreamer is a capture that gets stopped when its context is
+// done, and that is finalized when ended.
+type contextCaptureStreamer struct {
+	cs      CaptureStreamer
+	done    chan struct{} // closed after the capture has been finalized.
+	failure captureFailure
+}
+
+// follow the capture until either it ends or the context is done, and then
+// finalize the capture, unless raw.
+func (ccs *contextCaptureStreamer) follow(ctx context.Context, f *pcapng.Finalizer) {
+	defer close(ccs.done)
+	ended := make(chan struct{})
+	go func() {
+		ccs.cs.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-ctx.Done():
+		log.Debugf("stopping capture: %s", ctx.Err().Error())
+		ccs.cs.Stop()
+		<-ended
+	}
+	if f == nil {
+		return
+	}
+	if err := f.Finalize(time.Now()); err != nil {
+		log.Warnf("cannot finalize packet capture: %s", err.Error())
+		ccs.failure.fail("write", err)
+	}
+}
+
+// Stop the capture in an orderly manner, waiting for the capture to be
+// finalized.
+func (ccs *contextCaptureStreamer) Stop() {
+	ccs.cs.Stop()
+	<-ccs.done
+}
+
+// Wait for the capture to terminate and be finalized, without initiating the
+// termination.
+func (ccs *contextCaptureStreamer) Wait() {
+	<-ccs.done
+}
+
+// Stats returns the live statistics of the capture.
+func (ccs *contextCaptureStreamer) Stats() CaptureStats {
+	return ccs.cs.Stats()
+}
+
+// Err returns why the capture failed, or otherwise why finalizing it failed,
+// if either failed.
+func (ccs *contextCaptureStreamer) Err() error {
+	if err := ccs.cs.Err(); err != nil {
+		return err
+	}
+	return ccs.failure.Err()
+}
+
+// WaitErr waits for the capture to terminate and be finalized, and returns
+// why it failed, if it failed.
+func (ccs *contextCaptureStreamer) WaitErr() error {
+	ccs.Wait()
+	return ccs.Err()
+}
+
+// StopErr stops the capture, waiting for it to be finalized, and returns why
+// it failed before, if it failed.
+func (ccs *contextCaptureStreamer) StopErr() error {
+	ccs.Stop()
+	return ccs.Err()
+}
+
+// StopAfter waits for the capture to terminate and terminates it after the
+// specified duration if necessary.
+func (ccs *contextCaptureStreamer) StopAfter(d time.Duration) {
+	select {
+	case <-ccs.done:
+	case <-time.After(d):
+		ccs.Stop()
+	}
+}
+
+// StopAfterContext waits for the capture to terminate and terminates it after
+// the specified duration or when the context is done, whichever comes first.
+// It reports whether the capture ended by itself.
+func (ccs *contextCaptureStreamer) StopAfterContext(ctx context.Context, d time.Duration) (bool, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ccs.done:
+		return true, nil
+	case <-timer.C:
+		ccs.Stop()
+		return false, nil
+	case <-ctx.Done():
+		ccs.Stop()
+		return false, ctx.Err()
+	}
+}
+
+// afterDone calls f when the context is done, unless the returned stop
+// function gets called before. Calling stop more than once does nothing.
+func afterDone(ctx context.Context, f func()) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f()
+		case <-stopped:
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(stopped) }) }
+}
+
+// stopWhenDone stops the capture in an orderly manner when the context is
+// done before the capture ends.
+func stopWhenDone(ctx context.Context, cs CaptureStreamer) {
+	if ctx.Done() == nil {
+		return
+	}
+	go func() {
+		ended := make(chan struct{})
+		go func() {
+			cs.Wait()
+			close(ended)
+		}()
+		select {
+		case <-ended:
+		case <-ctx.Done():
+			log.Debugf("stopping capture: %s", ctx.Err().Error())
+			cs.Stop()
+		}
+	}()
+}
+
+// preparedContext returns the prepared capture that stops its capture when
+// the context is done, and that refuses to start after the context is done.
+func preparedContext(ctx context.Context, pc PreparedCapture) PreparedCapture {
+	if ctx.Done() == nil {
+		return pc
+	}
+	return &preparedCapture{
+		start: func() (CaptureStreamer, error) {
+			if err := ctx.Err(); err != nil {
+				pc.Cancel()
+				return nil, err
+			}
+			cs, err := pc.Start()
+			if err != nil {
+				return nil, err
+			}
+			stopWhenDone(ctx, cs)
+			return cs, nil
+		},
+		cancel: pc.Cancel,
+	}
+}
@@ -0,0 +1,300 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capturerpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// CaptureMethod is the HTTP/2 request path of the Capture call.
+const CaptureMethod = "/csharg.capture.v1.CaptureService/Capture"
+
+// ContentType is the content type of gRPC requests and responses using
+// protobuf-encoded messages.
+const ContentType = "application/grpc+proto"
+
+// Names of the gRPC status trailers (or headers in trailers-only responses).
+const (
+	StatusHeader  = "Grpc-Status"
+	MessageHeader = "Grpc-Message"
+)
+
+// DefaultMaxMessageSize is the maximum size of a received message if not
+// specified otherwise, as in gRPC.
+const DefaultMaxMessageSize = 4 * 1024 * 1024
+
+// Code is a gRPC status code; only the codes of interest to csharg are
+// defined.
+type Code uint32
+
+// gRPC status codes.
+const (
+	OK               Code = 0
+	Canceled         Code = 1
+	Unknown          Code = 2
+	InvalidArgument  Code = 3
+	NotFound         Code = 5
+	PermissionDenied Code = 7
+	Unimplemented    Code = 12
+	Internal         Code = 13
+	Unavailable      Code = 14
+	Unauthenticated  Code = 16
+)
+
+// Status is a non-OK gRPC call status.
+type Status struct {
+	Code    Code
+	Message string
+}
+
+// Error returns the textual description of the status.
+func (s *Status) Error() string {
+	if s.Message == "" {
+		return fmt.Sprintf("gRPC status %d", s.Code)
+	}
+	return fmt.Sprintf("gRPC status %d: %s", s.Code, s.Message)
+}
+
+// ParseStatus returns the call status from the specified gRPC response
+// headers or trailers, with a nil error for the OK status. It returns false if
+// there is no status at all.
+func ParseStatus(h http.Header) (present bool, err error) {
+	status := h.Get(StatusHeader)
+	if status == "" {
+		return false, nil
+	}
+	code, err := strconv.ParseUint(status, 10, 32)
+	if err != nil {
+		return true, &Status{Code: Unknown, Message: "malformed gRPC status " + strconv.Quote(status)}
+	}
+	if Code(code) == OK {
+		return true, nil
+	}
+	message := h.Get(MessageHeader)
+	if msg, err := url.PathUnescape(message); err == nil {
+		message = msg
+	}
+	return true, &Status{Code: Code(code), Message: message}
+}
+
+// EncodeMessage percent-encodes a status message for the gRPC message header.
+func EncodeMessage(message string) string {
+	return url.PathEscape(message)
+}
+
+// CaptureRequest starts a capture.
+type CaptureRequest struct {
+	Container string   // JSON-encoded capture target description.
+	Nifs      []string // network interfaces to capture from; empty for all.
+	Filter    string   // packet filter expression.
+	Chaste    bool     // avoid promiscuous mode.
+	VLANs     []uint32 // VLAN IDs to capture; empty for all.
+	Decap     []string // tunnel encapsulations to strip.
+	SnapLen   uint32   // maximum captured packet length; zero for no limit.
+}
+
+// Field numbers of CaptureRequest.
+const (
+	fieldContainer protowire.Number = 1
+	fieldNifs      protowire.Number = 2
+	fieldFilter    protowire.Number = 3
+	fieldChaste    protowire.Number = 4
+	fieldVLANs     protowire.Number = 5
+	fieldDecap     protowire.Number = 6
+	fieldSnapLen   protowire.Number = 7
+)
+
+// Field numbers of CaptureChunk.
+const (
+	fieldData protowire.Number = 1
+)
+
+// Marshal returns the protobuf wire encoding of the capture request.
+func (r *CaptureRequest) Marshal() []byte {
+	var b []byte
+	if r.Container != "" {
+		b = protowire.AppendTag(b, fieldContainer, protowire.BytesType)
+		b = protowire.AppendString(b, r.Container)
+	}
+	for _, nif := range r.Nifs {
+		b = protowire.AppendTag(b, fieldNifs, protowire.BytesType)
+		b = protowire.AppendString(b, nif)
+	}
+	if r.Filter != "" {
+		b = protowire.AppendTag(b, fieldFilter, protowire.BytesType)
+		b = protowire.AppendString(b, r.Filter)
+	}
+	if r.Chaste {
+		b = protowire.AppendTag(b, fieldChaste, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+	if len(r.VLANs) > 0 {
+		// Repeated scalars are packed in proto3.
+		var packed []byte
+		for _, vlan := range r.VLANs {
+			packed = protowire.AppendVarint(packed, uint64(vlan))
+		}
+		b = protowire.AppendTag(b, fieldVLANs, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	for _, decap := range r.Decap {
+		b = protowire.AppendTag(b, fieldDecap, protowire.BytesType)
+		b = protowire.AppendString(b, decap)
+	}
+	if r.SnapLen != 0 {
+		b = protowire.AppendTag(b, fieldSnapLen, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.SnapLen))
+	}
+	return b
+}
+
+// Unmarshal decodes the capture request from its protobuf wire encoding,
+// skipping unknown fields.
+func (r *CaptureRequest) Unmarshal(b []byte) error {
+	*r = CaptureRequest{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == fieldContainer && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			r.Container = v
+			return n
+		case num == fieldNifs && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n >= 0 {
+				r.Nifs = append(r.Nifs, v)
+			}
+			return n
+		case num == fieldFilter && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			r.Filter = v
+			return n
+		case num == fieldChaste && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.Chaste = protowire.DecodeBool(v)
+			return n
+		case num == fieldVLANs && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n >= 0 {
+				r.VLANs = append(r.VLANs, uint32(v))
+			}
+			return n
+		case num == fieldVLANs && typ == protowire.BytesType:
+			packed, n := protowire.ConsumeBytes(b)
+			for len(packed) > 0 {
+				v, m := protowire.ConsumeVarint(packed)
+				if m < 0 {
+					return m
+				}
+				r.VLANs = append(r.VLANs, uint32(v))
+				packed = packed[m:]
+			}
+			return n
+		case num == fieldDecap && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n >= 0 {
+				r.Decap = append(r.Decap, v)
+			}
+			return n
+		case num == fieldSnapLen && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			r.SnapLen = uint32(v)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// CaptureChunk is the next part of a capture stream.
+type CaptureChunk struct {
+	Data []byte // pcapng stream data.
+}
+
+// Marshal returns the protobuf wire encoding of the capture chunk.
+func (c *CaptureChunk) Marshal() []byte {
+	if len(c.Data) == 0 {
+		return nil
+	}
+	b := make([]byte, 0, protowire.SizeTag(fieldData)+protowire.SizeBytes(len(c.Data)))
+	b = protowire.AppendTag(b, fieldData, protowire.BytesType)
+	return protowire.AppendBytes(b, c.Data)
+}
+
+// Unmarshal decodes the capture chunk from its protobuf wire encoding,
+// skipping unknown fields.
+func (c *CaptureChunk) Unmarshal(b []byte) error {
+	*c = CaptureChunk{}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if num == fieldData && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			c.Data = append(c.Data, v...)
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+}
+
+// consumeFields iterates over the fields of an encoded message, calling the
+// specified field function with the tag already consumed. The field function
+// returns the length of the consumed field value, or a negative length for
+// malformed values.
+func consumeFields(b []byte, field func(protowire.Number, protowire.Type, []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n = field(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// ErrCompressed signals a compressed message, which isn't supported.
+var ErrCompressed = errors.New("compressed gRPC messages are not supported")
+
+// WriteMessage writes the length-prefixed gRPC message to w.
+func WriteMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+// ReadMessage reads the next length-prefixed gRPC message from r, rejecting
+// messages larger than maxSize. It returns io.EOF if there are no more
+// messages, and io.ErrUnexpectedEOF for truncated messages.
+func ReadMessage(r io.Reader, maxSize int) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, ErrCompressed
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if uint64(size) > uint64(maxSize) {
+		return nil, fmt.Errorf("gRPC message of %d bytes exceeds limit of %d bytes", size, maxSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
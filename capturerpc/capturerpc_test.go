@@ -0,0 +1,97 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capturerpc
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture service gRPC messages", func() {
+
+	It("round-trips capture requests", func() {
+		req := CaptureRequest{
+			Container: `{"name":"foo","type":"docker"}`,
+			Nifs:      []string{"eth0", "eth1"},
+			Filter:    "tcp port 80",
+			Chaste:    true,
+			VLANs:     []uint32{10, 4094},
+			Decap:     []string{"vxlan", "geneve"},
+			SnapLen:   96,
+		}
+		var decoded CaptureRequest
+		Expect(decoded.Unmarshal(req.Marshal())).To(Succeed())
+		Expect(decoded).To(Equal(req))
+
+		Expect(decoded.Unmarshal(nil)).To(Succeed())
+		Expect(decoded).To(BeZero())
+
+		// Unpacked repeated scalars must be accepted too.
+		b := protowire.AppendTag(nil, fieldVLANs, protowire.VarintType)
+		b = protowire.AppendVarint(b, 42)
+		b = protowire.AppendTag(b, fieldVLANs, protowire.VarintType)
+		b = protowire.AppendVarint(b, 43)
+		Expect(decoded.Unmarshal(b)).To(Succeed())
+		Expect(decoded.VLANs).To(Equal([]uint32{42, 43}))
+	})
+
+	It("skips unknown fields and rejects malformed messages", func() {
+		b := protowire.AppendTag(nil, 42, protowire.VarintType)
+		b = protowire.AppendVarint(b, 666)
+		b = append(b, (&CaptureChunk{Data: []byte("pcapng")}).Marshal()...)
+		var chunk CaptureChunk
+		Expect(chunk.Unmarshal(b)).To(Succeed())
+		Expect(chunk.Data).To(Equal([]byte("pcapng")))
+
+		Expect(chunk.Unmarshal(b[:len(b)-1])).NotTo(Succeed())
+	})
+
+	It("frames messages", func() {
+		var buff bytes.Buffer
+		Expect(WriteMessage(&buff, []byte("foo"))).To(Succeed())
+		Expect(WriteMessage(&buff, nil)).To(Succeed())
+		Expect(buff.Bytes()[:5]).To(Equal([]byte{0, 0, 0, 0, 3}))
+
+		r := bytes.NewReader(buff.Bytes())
+		Expect(ReadMessage(r, 10)).To(Equal([]byte("foo")))
+		Expect(ReadMessage(r, 10)).To(BeEmpty())
+		_, err := ReadMessage(r, 10)
+		Expect(err).To(Equal(io.EOF))
+
+		_, err = ReadMessage(bytes.NewReader(buff.Bytes()), 2)
+		Expect(err).To(MatchError(ContainSubstring("exceeds limit")))
+		_, err = ReadMessage(bytes.NewReader(buff.Bytes()[:6]), 10)
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		_, err = ReadMessage(bytes.NewReader([]byte{1, 0, 0, 0, 0}), 10)
+		Expect(err).To(Equal(ErrCompressed))
+	})
+
+	It("parses call status", func() {
+		present, err := ParseStatus(http.Header{})
+		Expect(present).To(BeFalse())
+		Expect(err).NotTo(HaveOccurred())
+
+		present, err = ParseStatus(http.Header{StatusHeader: {"0"}})
+		Expect(present).To(BeTrue())
+		Expect(err).NotTo(HaveOccurred())
+
+		present, err = ParseStatus(http.Header{
+			StatusHeader:  {"12"},
+			MessageHeader: {EncodeMessage("no such thing: 100%")},
+		})
+		Expect(present).To(BeTrue())
+		Expect(err).To(Equal(&Status{Code: Unimplemented, Message: "no such thing: 100%"}))
+
+		_, err = ParseStatus(http.Header{StatusHeader: {"foo"}})
+		Expect(err).To(HaveField("Code", Unknown))
+	})
+
+})
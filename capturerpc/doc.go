@@ -0,0 +1,11 @@
+/*
+Package capturerpc implements the messages and wire framing of the gRPC
+“csharg.capture.v1.CaptureService” defined in capture.proto, for capture
+services streaming live captures as gRPC server streams.
+
+The messages are hand-coded using the low-level protobuf wire encoding instead
+of protoc-generated code, and the gRPC length-prefixed message framing is done
+directly on top of HTTP/2 streams, so csharg doesn't need to pull in a full gRPC
+stack for a single server-streaming call.
+*/
+package capturerpc
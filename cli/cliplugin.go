@@ -5,18 +5,35 @@
 package cli
 
 import (
+	"crypto/tls"
+	"io"
+
 	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
 	"github.com/spf13/cobra"
+	"github.com/thediveo/klo"
 )
 
 // SetupCLI defines an exposed plugin symbol type for adding “things” to a
 // cobra root command (the csharg root command in particular).
 type SetupCLI func(*cobra.Command)
 
-// CommandExamples defines an exposed symbol with CLI examples, indexed by a
-// particular (sub) command, namely: “list” and “capture” at this time.
+// CommandExamples defines an exposed symbol with CLI examples, indexed by the
+// path of a particular (sub) command without the root command name, such as
+// “list”, “capture”, or “capture pod”. The examples are appended to any
+// examples the command already has.
 type CommandExamples func() map[string]string
 
+// ConfigSection defines an exposed plugin symbol type for plugins reading
+// their own section of the configuration file. It returns a pointer to the
+// plugin's configuration value, preset with its defaults, which then gets
+// decoded from the “plugins” section named after the plugin, followed by any
+// settings under the section's “profiles” key that are specific to the
+// current profile. If the configuration value implements a “Validate() error”
+// method, then it is called afterwards. Configuration sections are read before
+// any other [BeforeCommand] plugins run.
+type ConfigSection func() any
+
 // BeforeCommand defines an exposed plugin symbol type for running checks after
 // the command line args have been processed and before running the (chosen)
 // command.
@@ -29,6 +46,60 @@ type BeforeCommand func(*cobra.Command) error
 // aborted and the returned error reported to the CLI user.
 type NewClient func() (csharg.SharkTank, error)
 
+// Credentials describes the authentication material for connecting to the
+// capture service, as contributed by an AuthProvider.
+type Credentials struct {
+	// BearerToken optionally specifies the bearer token to use.
+	BearerToken string
+	// TLSConfig optionally specifies the TLS client configuration to use, such
+	// as with a client certificate.
+	TLSConfig *tls.Config
+}
+
+// AuthProvider defines an exposed plugin symbol type for contributing
+// authentication methods, such as a corporate SSO device flow. Auth providers
+// are asked one after another just before a capture client gets created,
+// passing them the bearer token determined so far from the CLI args, stdin,
+// or OS keyring, if any. If a provider isn't responsible, it must return nil
+// credentials as well as a nil error. The credentials of the first responsible
+// provider are then consumed by the NewClient factories.
+type AuthProvider func(token string) (*Credentials, error)
+
+// TargetTransformer defines an exposed plugin symbol type for filtering or
+// enriching the discovered capture targets, such as hiding system pods or
+// adding site labels, before commands like “list” and “capture” see them. The
+// registered transformers are applied in plugin order, each one getting the
+// result of its predecessor. Transformers may modify the targets passed to
+// them in place.
+type TargetTransformer func(targets api.Targets) api.Targets
+
+// BeforeCapture defines an exposed plugin symbol type for enforcing capture
+// policies, such as mandatory capture filters or forbidding promiscuous mode.
+// BeforeCapture plugins are invoked one after another just before a capture
+// starts, getting passed the capture target as well as the capture options
+// resolved from the CLI args. They may modify the capture options in place.
+// If a plugin returns a non-nil error, the capture is vetoed and the error
+// reported to the CLI user.
+type BeforeCapture func(target *api.Target, opts *csharg.CaptureOptions) error
+
+// ListPrinter defines an exposed plugin symbol type for providing additional
+// output formats for the “list” command, such as HTML, CSV, or a Graphviz
+// topology. The printer gets passed the “-o” CLI arg and is then responsible
+// for printing the list of capture targets, which is either a []*api.Target or
+// a []*command.OriginTarget when listing all profiles. If a registered printer
+// factory isn't responsible for the specified output format, it must return a
+// nil printer as well as a nil error. The builtin output formats apply only
+// when no printer factory is responsible.
+type ListPrinter func(outfmt string) (klo.ValuePrinter, error)
+
+// NewSink defines an exposed plugin symbol type for returning a suitable output
+// sink for writing packet capture streams to, based on the destination
+// specified in a “-w” CLI arg, such as “tcp://host:port”. If a registered sink
+// factory isn't responsible for the specified destination, it must return a
+// nil sink as well as a nil error. Closing the sink must flush any buffered
+// data and report any final error.
+type NewSink func(dest string) (io.WriteCloser, error)
+
 // SemVer defines an exposed plugin symbol type for returning (overriding) the
 // CLI binary's semantic version. The first plugin will win.
 type SemVer func() string
@@ -0,0 +1,90 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg anonymize" command for anonymizing existing pcapng
+// capture files before sharing them.
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+
+	"github.com/siemens/csharg/anonymize"
+	"github.com/siemens/csharg/cli"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// anonymizeCmd defines the "csharg anonymize" command.
+var anonymizeCmd = &cobra.Command{
+	Use:   "anonymize [flags] FILE",
+	Short: "Anonymize a pcapng capture file",
+	Long: `Anonymizes a pcapng capture file for sharing it with third parties, such as
+vendors. IP addresses get replaced with pseudonyms, except for addresses in
+subnets to keep, as well as loopback, multicast and broadcast addresses. The
+same IP address always gets the same pseudonym when using the same --key, so
+multiple anonymized capture files stay correlatable. Name resolution and
+decryption secrets are removed. Optionally, TCP, UDP and ICMP payloads can be
+zeroed.`,
+	Example: `# Anonymize a capture file, keeping the service subnet.
+csharg anonymize capture.pcapng --keep-subnet 10.96.0.0/12 --zero-payloads -w shareable.pcapng`,
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{"no-keyring": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy := anonymize.Policy{}
+		subnets, _ := cmd.Flags().GetStringArray("keep-subnet")
+		for _, subnet := range subnets {
+			prefix, err := netip.ParsePrefix(subnet)
+			if err != nil {
+				return fmt.Errorf("invalid --keep-subnet: %w", err)
+			}
+			policy.KeepSubnets = append(policy.KeepSubnets, prefix)
+		}
+		policy.ZeroPayloads, _ = cmd.Flags().GetBool("zero-payloads")
+		if key, _ := cmd.Flags().GetString("key"); key != "" {
+			policy.Key = []byte(key)
+		}
+		in, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		wname, _ := cmd.Flags().GetString("write")
+		out, err := OpenSink(wname)
+		if err != nil {
+			return err
+		}
+		aw := anonymize.NewWriter(out, policy)
+		_, err = io.Copy(aw, in)
+		if err == nil {
+			err = aw.Close()
+		}
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("cannot anonymize %s: %w", args[0], err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d packets anonymized\n", aw.Packets())
+		return out.Close()
+	},
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(AnonymizeSetupCLI, plugger.WithPlugin("anonymize"))
+}
+
+// AnonymizeSetupCLI adds the “anonymize” command.
+func AnonymizeSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(anonymizeCmd)
+	anonymizeCmd.Flags().StringP("write", "w", "-",
+		"Write anonymized network packets to file or sink URL. Use \"-\" for stdout.")
+	anonymizeCmd.Flags().StringArray("keep-subnet", []string{},
+		"Keep IP addresses in this subnet (CIDR). Can be specified multiple times.")
+	anonymizeCmd.Flags().Bool("zero-payloads", false,
+		"Zero TCP, UDP and ICMP payloads")
+	anonymizeCmd.Flags().String("key", "",
+		"Key for consistent IP address pseudonyms across multiple capture files; random if not set")
+}
@@ -0,0 +1,111 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg auth can-capture" command for checking capture
+// permissions without capturing.
+
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// authCmd defines the "csharg auth" command, grouping authentication-related
+// subcommands.
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Check authentication and authorization with the capture service",
+}
+
+// canCaptureCmd defines the "csharg auth can-capture" command.
+var canCaptureCmd = &cobra.Command{
+	Use:   "can-capture [flags] TARGET",
+	Short: "Check whether capturing from a target is permitted, without capturing",
+	Long: `Checks whether the capture service accepts the credentials of the current
+profile and permits capturing from the named capture target, without actually
+capturing any packets. csharg exits with a non-zero status if capturing is not
+permitted, so this command can be used in scripts to fail early.`,
+	Example: `# Check that the "plant" profile may capture from the "mqtt" container.
+csharg --profile plant auth can-capture mqtt
+
+# Check capturing from a pod on a specific node.
+csharg auth can-capture --node worker-1 default/mypod
+
+# Check capturing from a pod in the "shop" namespace.
+csharg auth can-capture --namespace shop mypod`,
+	Args: cobra.ExactArgs(1),
+	RunE: canCapture,
+}
+
+// canCaptureNode optionally specifies the node of the capture target.
+var canCaptureNode string
+
+// canCaptureNamespace optionally specifies the namespace of pods named without
+// an explicit namespace.
+var canCaptureNamespace string
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(AuthSetupCLI, plugger.WithPlugin("auth"))
+}
+
+// AuthSetupCLI adds the “auth” command with its “can-capture” subcommand.
+func AuthSetupCLI(cmd *cobra.Command) {
+	canCaptureCmd.Flags().StringVarP(&canCaptureNode, "node", "n", "",
+		"node name of the capture target, if ambiguous")
+	canCaptureCmd.Flags().StringVar(&canCaptureNamespace, "namespace", "",
+		"Namespace of pods named without an explicit namespace (default $"+NamespaceEnv+", otherwise \""+api.DefaultNamespace+"\").")
+	authCmd.AddCommand(canCaptureCmd)
+	cmd.AddCommand(authCmd)
+}
+
+// canCapture checks the capture permission for the named capture target. When
+// target discovery doesn't find the named capture target, such as when the
+// capture service rejects the credentials, it still probes the capture service
+// so that the actual reason gets reported. Pods named without an explicit
+// namespace are looked up in the default namespace, as when capturing.
+func canCapture(cmd *cobra.Command, args []string) error {
+	st, err := NewSharkTank()
+	if err != nil {
+		return fmt.Errorf("invalid --context: %w", err)
+	}
+	defer st.Close()
+	name := args[0]
+	namespace := canCaptureNamespace
+	if namespace == "" {
+		namespace = DefaultNamespace()
+	}
+	var targets api.Targets
+	Spin("discovering capture targets...", func() {
+		targets = st.Targets()
+	})
+	var target *api.Target
+	for _, t := range targets {
+		qname := name
+		if t.Type.IsPod() && !strings.ContainsRune(name, '/') {
+			qname = api.PodName(namespace, name)
+		}
+		if t.QualifiedName() != qname || (canCaptureNode != "" && t.NodeName != canCaptureNode) {
+			continue
+		}
+		if target != nil {
+			return fmt.Errorf("%w %q, please specify --node", csharg.ErrAmbiguousTarget, name)
+		}
+		target = t
+	}
+	if target == nil {
+		target = &api.Target{Name: name, NodeName: canCaptureNode}
+	}
+	if err := st.CanCapture(target); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "capturing from %q is permitted\n", target.QualifiedName())
+	return nil
+}
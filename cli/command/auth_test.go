@@ -0,0 +1,73 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"bytes"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/csargtest"
+	"github.com/thediveo/go-plugger/v3"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// testSharkTank, if set, is the capture client returned by the client factory
+// registered for testing.
+var testSharkTank *csargtest.SharkTank
+
+func init() {
+	plugger.Group[cli.NewClient]().Register(func() (csharg.SharkTank, error) {
+		if testSharkTank == nil {
+			return nil, nil
+		}
+		return testSharkTank, nil
+	}, plugger.WithPlugin("test-client"))
+}
+
+var _ = Describe("auth can-capture command", func() {
+
+	web := &api.Target{Name: "web", Namespace: "shop", Type: api.TypePod,
+		NetworkInterfaces: []string{"eth0"}}
+
+	BeforeEach(func() {
+		testSharkTank = csargtest.New(web)
+		DeferCleanup(func() {
+			testSharkTank = nil
+			canCaptureNamespace = ""
+		})
+	})
+
+	canCaptureOut := func(name string) (string, error) {
+		var out bytes.Buffer
+		canCaptureCmd.SetOut(&out)
+		DeferCleanup(func() { canCaptureCmd.SetOut(nil) })
+		err := canCapture(canCaptureCmd, []string{name})
+		return out.String(), err
+	}
+
+	It("qualifies pod names with the default namespace", func() {
+		GinkgoT().Setenv(NamespaceEnv, "shop")
+		Expect(canCaptureOut("web")).To(ContainSubstring(`capturing from "shop/web" is permitted`))
+		Expect(testSharkTank.Closed()).To(BeTrue())
+	})
+
+	It("qualifies pod names with the specified namespace", func() {
+		canCaptureNamespace = "shop"
+		Expect(canCaptureOut("web")).To(ContainSubstring(`capturing from "shop/web" is permitted`))
+		canCaptureNamespace = "other"
+		testSharkTank = csargtest.New(web)
+		_, err := canCaptureOut("web")
+		Expect(err).To(MatchError(csharg.ErrTargetNotFound))
+	})
+
+	It("checks explicitly qualified pod names", func() {
+		Expect(canCaptureOut("shop/web")).To(ContainSubstring(`capturing from "shop/web" is permitted`))
+	})
+
+})
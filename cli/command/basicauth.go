@@ -0,0 +1,69 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// PasswordEnv names the environment variable with the password for HTTP basic
+// authentication, unless read from stdin.
+const PasswordEnv = "CSHARG_PASSWORD"
+
+// Username optionally specifies the user name for HTTP basic authentication.
+var Username string
+
+// Password specifies the password for HTTP basic authentication, when Username
+// has been specified.
+var Password string
+
+// passwordStdin requests reading the basic authentication password from stdin.
+var passwordStdin bool
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(BasicAuthSetupCLI, plugger.WithPlugin("basicauth"))
+	plugger.Group[cli.BeforeCommand]().Register(BasicAuthBeforeCommand, plugger.WithPlugin("basicauth"))
+}
+
+// BasicAuthSetupCLI registers the “--username” and “--password-stdin” CLI
+// flags.
+func BasicAuthSetupCLI(cmd *cobra.Command) {
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&Username, "username", "",
+		`User name for HTTP basic authentication, such as with capture services fronted by
+reverse proxies; the password is taken from $`+PasswordEnv+` unless --password-stdin;
+--token takes precedence`)
+	pf.BoolVar(&passwordStdin, "password-stdin", false,
+		"Read the password for HTTP basic authentication from stdin")
+	Annotate(pf, "password-stdin", MutualFlagGroupAnnotation, "token")
+}
+
+// BasicAuthBeforeCommand determines the password for basic authentication
+// when a user name has been specified: either reading the password from stdin
+// when requested using “--password-stdin”, or otherwise taking it from the
+// environment.
+func BasicAuthBeforeCommand(cmd *cobra.Command) error {
+	if passwordStdin {
+		if Username == "" {
+			return errors.New("--password-stdin requires --username")
+		}
+		password, err := ReadSecret(os.Stdin, "Password: ")
+		if err != nil {
+			return fmt.Errorf("cannot read password from stdin: %w", err)
+		}
+		Password = password
+		return nil
+	}
+	if Username != "" {
+		Password = os.Getenv(PasswordEnv)
+	}
+	return nil
+}
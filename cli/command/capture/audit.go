@@ -0,0 +1,180 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli/command"
+	log "github.com/sirupsen/logrus"
+)
+
+// Audit log syslog defaults.
+const (
+	defaultAuditSyslogPort = "514"
+	syslogFacilityAuthpriv = 10
+	syslogSeverityNotice   = 5
+)
+
+// Audit log events.
+const (
+	auditStart  = "start"  // capture has been started.
+	auditFailed = "failed" // capture could not be started.
+	auditStop   = "stop"   // capture has finished.
+)
+
+// Audit log outcomes of finished captures.
+const (
+	auditOutcomeOK     = "ok"     // capture completed.
+	auditOutcomeFailed = "failed" // capture ended with an error.
+)
+
+// auditRecord is a single audit log entry about a capture session.
+type auditRecord struct {
+	Time        time.Time      `json:"time"`
+	Event       string         `json:"event"`
+	User        string         `json:"user"`
+	Principal   string         `json:"principal,omitempty"`
+	Client      string         `json:"client"`
+	Target      string         `json:"target"`
+	Type        api.TargetType `json:"type"`
+	Node        string         `json:"node,omitempty"`
+	Nifs        []string       `json:"nifs,omitempty"`
+	Filter      string         `json:"filter,omitempty"`
+	Promiscuous bool           `json:"promiscuous"`
+	Requester   string         `json:"requester,omitempty"`
+	Reason      string         `json:"reason,omitempty"`
+	Ticket      string         `json:"ticket,omitempty"`
+	Start       time.Time      `json:"start"`
+	Stop        *time.Time     `json:"stop,omitempty"`
+	Duration    string         `json:"duration,omitempty"`
+	Octets      int64          `json:"octets"`
+	Outcome     string         `json:"outcome,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// auditLog appends audit records about capture sessions as JSON lines to a
+// local file, or sends them to a syslog collector.
+type auditLog struct {
+	mu       sync.Mutex
+	w        io.WriteCloser
+	syslog   bool
+	hostname string
+}
+
+// openAuditLog opens the audit log for the specified destination, either a
+// file name or “syslog://host[:port]” for sending RFC 5424 messages via UDP
+// with the authpriv facility.
+func openAuditLog(dest string) (*auditLog, error) {
+	a := &auditLog{hostname: "-"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		a.hostname = hostname
+	}
+	if strings.HasPrefix(dest, "syslog://") {
+		u, err := url.Parse(dest)
+		if err != nil || u.Hostname() == "" || strings.TrimPrefix(u.Path, "/") != "" {
+			return nil, fmt.Errorf("invalid audit log %q, expecting syslog://host[:port]", dest)
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), defaultAuditSyslogPort)
+		}
+		conn, err := net.DialTimeout("udp", host, 5*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to audit log syslog collector: %w", err)
+		}
+		a.w, a.syslog = conn, true
+		return a, nil
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit log: %w", err)
+	}
+	a.w = f
+	return a, nil
+}
+
+// newAuditRecord returns a new audit record for a capture session from the
+// specified target and with the specified capture options, starting now.
+func newAuditRecord(target *api.Target, opts *csharg.CaptureOptions) *auditRecord {
+	r := &auditRecord{
+		User:        "-",
+		Principal:   command.Username,
+		Client:      "-",
+		Target:      target.QualifiedName(),
+		Type:        target.Type,
+		Node:        target.NodeName,
+		Nifs:        opts.Nifs,
+		Filter:      opts.Filter,
+		Promiscuous: !opts.AvoidPromiscuousMode,
+		Requester:   opts.Session.Requester,
+		Reason:      opts.Session.Reason,
+		Ticket:      opts.Session.Ticket,
+		Start:       time.Now(),
+	}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		r.Client = hostname
+	}
+	return r
+}
+
+// Record the specified event about a capture session. Recording the final
+// stop event also sets the stop time, duration, the number of octets captured,
+// and whether the capture completed ("ok") or failed with the specified error.
+func (a *auditLog) Record(r *auditRecord, event string, octets int64, err error) error {
+	entry := *r
+	entry.Time = time.Now()
+	entry.Event = event
+	entry.Octets = octets
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if event == auditStop {
+		stop := entry.Time
+		entry.Stop = &stop
+		entry.Duration = stop.Sub(entry.Start).Round(time.Millisecond).String()
+		entry.Outcome = auditOutcomeOK
+		if err != nil {
+			entry.Outcome = auditOutcomeFailed
+		}
+	}
+	line, jerr := json.Marshal(&entry)
+	if jerr != nil {
+		return jerr
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.syslog {
+		line = []byte(fmt.Sprintf("<%d>1 %s %s csharg %d - - %s",
+			syslogFacilityAuthpriv*8+syslogSeverityNotice,
+			entry.Time.Format(time.RFC3339Nano), a.hostname, os.Getpid(), line))
+	} else {
+		line = append(line, '\n')
+	}
+	if _, werr := a.w.Write(line); werr != nil {
+		return fmt.Errorf("cannot write audit log: %w", werr)
+	}
+	log.Debugf("audit log: %s capture from target %q", event, entry.Target)
+	return nil
+}
+
+// Close the audit log.
+func (a *auditLog) Close() error {
+	return a.w.Close()
+}
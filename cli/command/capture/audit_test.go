@@ -0,0 +1,53 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture audit log", func() {
+
+	It("tells completed captures from failed ones", func() {
+		dest := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+		audit, err := openAuditLog(dest)
+		Expect(err).NotTo(HaveOccurred())
+		rec := newAuditRecord(&api.Target{Name: "foo", Type: api.TypeDocker}, &csharg.CaptureOptions{})
+		Expect(audit.Record(rec, auditStart, 0, nil)).To(Succeed())
+		Expect(audit.Record(rec, auditStop, 42, nil)).To(Succeed())
+		Expect(audit.Record(rec, auditStop, 1, errors.New("connection reset"))).To(Succeed())
+		Expect(audit.Close()).To(Succeed())
+
+		f, err := os.Open(dest)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		var entries []auditRecord
+		lines := bufio.NewScanner(f)
+		for lines.Scan() {
+			var entry auditRecord
+			Expect(json.Unmarshal(lines.Bytes(), &entry)).To(Succeed())
+			entries = append(entries, entry)
+		}
+		Expect(lines.Err()).NotTo(HaveOccurred())
+		Expect(entries).To(HaveExactElements(
+			And(HaveField("Event", auditStart), HaveField("Outcome", ""), HaveField("Error", "")),
+			And(HaveField("Event", auditStop), HaveField("Octets", BeEquivalentTo(42)),
+				HaveField("Outcome", auditOutcomeOK), HaveField("Error", "")),
+			And(HaveField("Event", auditStop), HaveField("Octets", BeEquivalentTo(1)),
+				HaveField("Outcome", auditOutcomeFailed), HaveField("Error", "connection reset")),
+		))
+	})
+
+})
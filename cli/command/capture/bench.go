@@ -0,0 +1,224 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/csargtest"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// Defaults for benchmarking captures.
+const (
+	DefaultBenchDuration   = 10 * time.Second
+	DefaultBenchPacketSize = 1500
+)
+
+// simulatedTarget is the name of the capture target served by the builtin
+// capture service simulator.
+const simulatedTarget = "bench"
+
+// benchChunkSize is the size of the websocket messages sent by the builtin
+// capture service simulator.
+const benchChunkSize = 64 * 1024
+
+// benchCmd defines the "csharg bench" command.
+var benchCmd = &cobra.Command{
+	Use:   "bench [flags] [TARGET]",
+	Short: "Measure end-to-end capture throughput and client CPU overhead.",
+	Long: `Measure end-to-end capture throughput and client CPU overhead.
+
+The bench command captures from the specified target for a while, throwing
+away the captured packets, and then prints the packets and octets per second,
+as well as the CPU time used by csharg. With --simulate, the bench command
+instead captures from a builtin capture service simulator, streaming packets as
+fast as possible; please note that in this case the CPU time includes the
+simulator.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: bench,
+	Example: `# Measure the throughput from a container for 30s.
+csharg --host localhost:5001 bench --duration 30s fools-mikroserviz
+
+# Measure the client overhead using the builtin capture service simulator.
+csharg bench --simulate`,
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(BenchSetupCLI, plugger.WithPlugin("bench"))
+}
+
+// BenchSetupCLI adds the "bench" command.
+func BenchSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(benchCmd)
+	f := benchCmd.Flags()
+	f.Duration("duration", DefaultBenchDuration, "Duration of the benchmark capture")
+	f.Bool("simulate", false, "Capture from a builtin capture service simulator instead of a capture target")
+	f.Int("packet-size", DefaultBenchPacketSize, "Size of the packets streamed by the simulator")
+	f.StringArrayP("interface", "i", []string{},
+		"Name of interface to capture from. Can be specified multiple times.")
+	f.StringP("filter", "f", "",
+		"Set the capture filter expression. It applies to all network interfaces included in a capture.")
+}
+
+// benchCounter counts the octets and packets of a packet capture stream
+// written to it, throwing away the stream.
+type benchCounter struct {
+	mu      sync.Mutex
+	scanner *pcapng.Scanner
+	octets  int64
+	packets int64
+}
+
+func newBenchCounter() *benchCounter {
+	c := &benchCounter{}
+	c.scanner = pcapng.NewScanner(func(b *pcapng.Block) error {
+		if b.Type == pcapng.BlockEPB || b.Type == pcapng.BlockSPB {
+			c.packets++
+		}
+		return nil
+	})
+	return c
+}
+
+// Write counts the octets and packets written.
+func (c *benchCounter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.octets += int64(len(p))
+	if c.scanner != nil {
+		if _, err := c.scanner.Write(p); err != nil {
+			log.Warnf("cannot count packets: %s", err)
+			c.scanner = nil
+		}
+	}
+	return len(p), nil
+}
+
+// counts returns the octets and packets counted so far.
+func (c *benchCounter) counts() (octets, packets int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.octets, c.packets
+}
+
+// bench runs a benchmark capture and then prints the results.
+func bench(cmd *cobra.Command, args []string) error {
+	duration, _ := cmd.Flags().GetDuration("duration")
+	if duration <= 0 {
+		return fmt.Errorf("invalid --duration %s", duration)
+	}
+	simulate, _ := cmd.Flags().GetBool("simulate")
+	var st csharg.SharkTank
+	var target *api.Target
+	if simulate {
+		if len(args) != 0 {
+			return fmt.Errorf("no capture target allowed with --simulate")
+		}
+		size, _ := cmd.Flags().GetInt("packet-size")
+		if size <= 0 || size > 65535 {
+			return fmt.Errorf("invalid --packet-size %d", size)
+		}
+		srv := startSimulator(size)
+		defer srv.Close()
+		var err error
+		st, err = csharg.NewSharkTankOnHost(srv.URL, nil)
+		if err != nil {
+			return err
+		}
+		target = &api.Target{Name: simulatedTarget, Type: api.TypeProc, NetworkInterfaces: []string{"eth0"}}
+	} else {
+		if len(args) != 1 {
+			return fmt.Errorf("missing capture target (or --simulate)")
+		}
+		var err error
+		st, err = command.NewSharkTank()
+		if err != nil {
+			return fmt.Errorf("invalid --context: %w", err)
+		}
+		target, err = findTarget(st, args[0], nil, "", defaultNamespace())
+		if err != nil {
+			return err
+		}
+	}
+	captureopts := &csharg.CaptureOptions{MaxBuffer: command.MaxBuffer}
+	captureopts.Nifs, _ = cmd.Flags().GetStringArray("interface")
+	captureopts.Filter, _ = cmd.Flags().GetString("filter")
+
+	counter := newBenchCounter()
+	cpuStart, cpuOK := processCPUTime()
+	start := time.Now()
+	capture, err := st.Capture(counter, target, captureopts)
+	if err != nil {
+		return fmt.Errorf("cannot start capture: %w", err)
+	}
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, command.ShutdownSignals...)
+	defer signal.Stop(done)
+	ended := make(chan struct{})
+	go func() {
+		capture.Wait()
+		close(ended)
+	}()
+	select {
+	case <-time.After(duration):
+	case <-done:
+	case <-ended:
+	}
+	capture.Stop()
+	elapsed := time.Since(start)
+	cpuEnd, _ := processCPUTime()
+	octets, packets := counter.counts()
+
+	secs := elapsed.Seconds()
+	fmt.Printf("Target:    %s\n", target.QualifiedName())
+	fmt.Printf("Duration:  %s\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("Packets:   %d (%.0f packets/s)\n", packets, float64(packets)/secs)
+	fmt.Printf("Octets:    %d (%.2f MB/s)\n", octets, float64(octets)/secs/1e6)
+	if cpuOK {
+		cpu := cpuEnd - cpuStart
+		fmt.Printf("CPU time:  %s (%.1f%% of one core)\n",
+			cpu.Round(time.Millisecond), 100*cpu.Seconds()/secs)
+	}
+	return nil
+}
+
+// startSimulator starts a capture service simulator streaming packets of the
+// specified size as fast as possible.
+func startSimulator(size int) *csargtest.Server {
+	b := pcapngtest.New(binary.LittleEndian).
+		SHB().
+		IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0"))
+	header := b.Bytes()
+	packets := pcapngtest.New(binary.LittleEndian)
+	data := make([]byte, size)
+	for ts := uint64(0); packets.Len() < benchChunkSize; ts++ {
+		packets.EPB(0, ts, data)
+	}
+	chunk := packets.Bytes()
+	// Repeat the same chunk over and over again, so we don't need to allocate
+	// huge amounts of memory for the simulated capture stream.
+	chunks := make([][]byte, 1+1024*1024)
+	chunks[0] = header
+	for idx := 1; idx < len(chunks); idx++ {
+		chunks[idx] = chunk
+	}
+	st := csargtest.New(&api.Target{Name: simulatedTarget, Type: api.TypeProc})
+	st.SetStream("", &csargtest.Stream{Chunks: chunks, End: true})
+	return csargtest.NewServer(st)
+}
@@ -0,0 +1,14 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+
+package capture
+
+import "time"
+
+// processCPUTime isn't supported on Windows.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
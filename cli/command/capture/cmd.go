@@ -5,16 +5,20 @@
 package capture
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/siemens/csharg"
 	"github.com/siemens/csharg/api"
 	"github.com/siemens/csharg/cli"
 	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/packet"
 	"github.com/thediveo/go-plugger/v3"
 
 	log "github.com/sirupsen/logrus"
@@ -27,11 +31,17 @@ const AvoidPromModeArg = "avoid-promiscuous"
 // automatically registered with this command by the other sibling .go files
 // in this package.
 var captureCmd = &cobra.Command{
-	Use:   "capture [flags] TARGET",
+	Use:   "capture [flags] TARGET...",
 	Short: "Capture and then live stream network traffic.",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return capture(cmd, args[0], []string{}, "")
+		if dir, _ := cmd.Flags().GetString("split-per-target"); dir != "" {
+			return captureSplit(cmd, dir, args)
+		}
+		if len(args) > 1 {
+			return errors.New("capturing from multiple targets requires --split-per-target DIR")
+		}
+		return capture(cmd, args[0], nil, "")
 	},
 }
 
@@ -43,38 +53,429 @@ func init() {
 func CaptureSetupCLI(cmd *cobra.Command) {
 	cmd.AddCommand(captureCmd)
 	pf := captureCmd.PersistentFlags()
+	pf.StringP("namespace", "n", "",
+		"Namespace of pods named without an explicit namespace (default $"+NamespaceEnv+", otherwise \""+api.DefaultNamespace+"\").")
 	pf.StringArrayP("interface", "i", []string{},
 		"Name of interface to capture from. Can be specified multiple times.")
+	pf.Bool("no-loopback", false,
+		"Don't capture from the loopback network interface \"lo\" when capturing from all network interfaces.")
 	pf.StringP("filter", "f", "",
 		"Set the capture filter expression. It applies to all network interfaces included in a capture.")
 	pf.BoolP(AvoidPromModeArg, "p", false,
 		"Don't put network interfaces into promiscuous mode")
+	pf.String("vlan", "",
+		"Only capture packets tagged with these comma-separated VLAN IDs, if supported by the capture service.")
+	pf.String("decapsulate", "",
+		"Strip these comma-separated tunnel encapsulations, either \"vxlan\", \"geneve\", \"gre\", or \"ipip\", if supported by the capture service.")
+	pf.Bool("raw", false,
+		"Write the capture stream exactly as sent by the capture service, without adding capture target information and without finalizing stopped captures.")
+	pf.String("max-output", "",
+		"Stop the capture gracefully before the captured network packets exceed this size, such as \"1GiB\" (default no limit)")
+	pf.Int64P("packet-count", "c", 0,
+		"Stop the capture gracefully after capturing this number of network packets (default no limit)")
+	pf.IntP("snaplen", "s", 0,
+		"Capture at most this number of octets from each network packet, such as only the packet headers (default complete packets)")
+	pf.Duration("stall-alert", 0,
+		"Warn when no capture data arrives for this length of time (default never)")
+	pf.Duration("slow-write-alert", 0,
+		"Warn when writing captured network packets takes longer than this (default never)")
+	pf.Duration("heartbeat", 0,
+		"Add interface statistics to the packet capture each time no packets arrived for this duration, telling quiet captures from dead capture streams; zero disables heartbeats.")
+	pf.Duration("reconnect", 0,
+		"Reconnect broken capture streams for up to this duration, resuming the packet capture in the same section; zero disables reconnecting.")
+	pf.Bool("alias-interfaces", false,
+		"Rename kernel-style network interface names, such as \"eth0@if12\", into readable aliases derived from the peer capture targets and bridges.")
 	pf.StringP("write", "w", "-",
-		"Write captured network packets to file. Use \"-\" for stdout.")
+		"Write captured network packets to file or sink URL, such as tcp://host:port. Use \"-\" for stdout.")
+	captureCmd.Flags().String("split-per-target", "",
+		"Capture from all specified targets at the same time, writing a separate packet capture file per target into this directory.")
+	pf.String("on-output-error", "fail",
+		"How to recover from a full disk or I/O errors when writing the captured network packets: fail, retry[=DURATION] (default 1m), fallback=DIR to continue in a new file, or ring[=SIZE] to retain the most recent packets in memory.")
+	pf.String("exec", "",
+		"Stream captured network packets into an analysis tool command, such as \"suricata -r -\". "+
+			"Use \""+FifoPlaceholder+"\" in the command to stream via a named pipe instead of stdin.")
+	pf.StringSlice("fields", nil,
+		"Print the specified comma-separated packet fields, such as \"ip.src,tcp.port\", using tshark instead of the packet capture stream.")
+	pf.String("fields-format", "tab",
+		"Format of the printed --fields, either \"tab\" (tab-separated with header line) or \"json\" (one object per line).")
+	pf.String("metrics-push", "",
+		"Periodically push capture throughput, packet and drop metrics to this Prometheus pushgateway or InfluxDB write URL.")
+	pf.String("metrics-format", "pushgateway",
+		"Format of pushed metrics, either \"pushgateway\" or \"influx\" (line protocol, with the API token taken from $"+InfluxTokenEnv+").")
+	pf.Duration("metrics-interval", DefaultMetricsInterval,
+		"Interval for pushing capture metrics.")
+	pf.String("audit-log", "",
+		"Record who captured from which target, when, and how much to this audit log file (as JSON lines) or syslog://host[:port] collector. Captures are refused when the audit log cannot be written.")
+	pf.String("requester", "",
+		"Name the person or team on whose behalf this capture is taken, for the capture service's audit logs.")
+	pf.String("reason", "",
+		"Briefly describe why this capture is taken, for the capture service's audit logs.")
+	pf.String("ticket", "",
+		"Reference the incident or change ticket ID of this capture, for the capture service's audit logs.")
+	pf.Duration("duration", 0,
+		"Stop the capture after this duration, finalizing the packet capture with the final interface statistics; zero captures until interrupted.")
+	pf.String("k8s-api", "",
+		"URL of a Kubernetes API server, such as http://127.0.0.1:8001 from \"kubectl proxy\", to add the names of services and their endpoints to the capture (with an optional bearer token taken from $"+K8sTokenEnv+").")
+	pf.String("k8s-namespace", "",
+		"Only add the names of the Kubernetes services in this namespace, instead of all namespaces.")
+	pf.Bool("summary", false,
+		"Print a summary of the busiest flows, recently ended flows and top talkers when the capture ends. Without --write, --exec, or --fields, only the summary is printed.")
+	pf.Int("summary-top", DefaultSummaryTop,
+		"Number of busiest flows, recently ended flows and top talkers to show in the --summary.")
+	command.Annotate(pf, "write", command.MutualFlagGroupAnnotation, "output")
+	command.Annotate(pf, "exec", command.MutualFlagGroupAnnotation, "output")
+	command.Annotate(pf, "fields", command.MutualFlagGroupAnnotation, "output")
+	command.Annotate(pf, "raw", command.MutualFlagGroupAnnotation, "raw")
+	command.Annotate(pf, "k8s-api", command.MutualFlagGroupAnnotation, "raw")
 }
 
+// anyContainer is a pseudo capture target type matching all types of
+// containers when looking up capture targets.
+const anyContainer api.TargetType = "container"
+
 // Capture network traffic from the specified named target and start streaming
 // it. Optionally, the required type of target can be specified ("pod", et
 // cetera), as well as the host/node name in order to give an unambiguous target
 // match.
-func capture(cmd *cobra.Command, targetname string, targettypes []string, nodename string) error {
+func capture(cmd *cobra.Command, targetname string, targettypes []api.TargetType, nodename string) error {
 	// Retrieve the list of capture targets from the container/cluster capture
 	// service.
 	st, err := command.NewSharkTank()
 	if err != nil {
-		return fmt.Errorf("invalid --context: %s", err)
+		return fmt.Errorf("invalid --context: %w", err)
+	}
+	defer st.Close()
+	var target *api.Target
+	if id, _ := cmd.Flags().GetString("id"); id != "" {
+		target, err = findTargetByID(st, id, nodename)
+	} else {
+		target, err = findTarget(st, targetname, targettypes, nodename, podNamespace(cmd))
+	}
+	if err != nil {
+		return err
+	}
+	// Open a new output sink to dump the captured network packets into, such
+	// as a file, or use stdout, if "-" was specified. Alternatively, hand off
+	// the captured network packets to an analysis tool; when the tool exits
+	// prematurely, then we end the capture too. Printing fields is just
+	// handing off to tshark.
+	var out io.WriteCloser
+	var recovering *recoveringSink
+	var exited <-chan struct{}
+	// When asking for a capture summary, the summary goes to stdout, unless
+	// the capture stream or tool output already goes there.
+	summary, _ := cmd.Flags().GetBool("summary")
+	summaryOut := io.Writer(os.Stderr)
+	if fields, _ := cmd.Flags().GetStringSlice("fields"); len(fields) > 0 {
+		format, _ := cmd.Flags().GetString("fields-format")
+		tshark, err := startFields(fields, format)
+		if err != nil {
+			return err
+		}
+		out, exited = tshark, tshark.Exited()
+	} else if execcmd, _ := cmd.Flags().GetString("exec"); execcmd != "" {
+		tool, err := startExec(execcmd)
+		if err != nil {
+			return err
+		}
+		out, exited = tool, tool.Exited()
+	} else if summary && !cmd.Flags().Changed("write") {
+		out, summaryOut = discardSink{}, os.Stdout
+	} else {
+		wname, _ := cmd.Flags().GetString("write")
+		onerr, _ := cmd.Flags().GetString("on-output-error")
+		recovery, err := parseOutputRecovery(onerr)
+		if err != nil {
+			return err
+		}
+		out, err = command.OpenSink(wname)
+		if err != nil {
+			return err
+		}
+		if recovery.mode != "fail" {
+			recovering = newRecoveringSink(out, recovery)
+			out = recovering
+		}
+		if wname != "-" {
+			summaryOut = os.Stdout
+		}
+	}
+	captureopts, err := captureOptions(cmd, st, target)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	// Optionally push capture metrics while capturing.
+	var metrics *captureMetrics
+	if pushurl, _ := cmd.Flags().GetString("metrics-push"); pushurl != "" {
+		format, _ := cmd.Flags().GetString("metrics-format")
+		interval, _ := cmd.Flags().GetDuration("metrics-interval")
+		metrics, err = newCaptureMetrics(pushurl, format, interval, target.QualifiedName(), target.NodeName)
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	// Optionally record the capture session in an audit log; if the audit log
+	// cannot be written, then there's no capture.
+	var audit *auditLog
+	var auditrec *auditRecord
+	if dest, _ := cmd.Flags().GetString("audit-log"); dest != "" {
+		audit, err = openAuditLog(dest)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		defer audit.Close()
+		auditrec = newAuditRecord(target, captureopts)
+	}
+	// Start the capture stream and keep streaming until we drop ... because
+	// this CLI tool was asked to shut down, such as when SIGINT'ed or SIGTERM'ed.
+	pw := &progressWriter{w: out}
+	var taps []io.Writer
+	if metrics != nil {
+		taps = append(taps, metrics)
+	}
+	var flows *packet.FlowTracker
+	if summary {
+		flows = packet.NewFlowTracker(nil)
+		taps = append(taps, flows)
+	}
+	var w io.Writer = pw
+	if len(taps) != 0 {
+		w = &teeWriter{out: pw, taps: taps}
+	}
+	// Stopping the capture via its context finalizes the packet capture,
+	// regardless of whether the capture gets interrupted or runs out of time.
+	duration, _ := cmd.Flags().GetDuration("duration")
+	if duration < 0 {
+		out.Close()
+		return fmt.Errorf("invalid --duration %s", duration)
+	}
+	ctx, stopSignals := signal.NotifyContext(context.Background(), command.ShutdownSignals...)
+	defer stopSignals()
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	capture, err := csharg.CaptureContext(ctx, st, w, target, captureopts)
+	if err != nil {
+		out.Close()
+		if audit != nil {
+			if aerr := audit.Record(auditrec, auditFailed, 0, err); aerr != nil {
+				log.Error(aerr.Error())
+			}
+		}
+		return fmt.Errorf("cannot start capture: %w", err)
+	}
+	var captureErr error
+	if audit != nil {
+		if err := audit.Record(auditrec, auditStart, 0, nil); err != nil {
+			capture.Stop()
+			out.Close()
+			return err
+		}
+		defer func() {
+			if err := audit.Record(auditrec, auditStop, pw.octets.Load(), captureErr); err != nil {
+				log.Error(err.Error())
+			}
+		}()
+	}
+	stopProgress := showProgress(pw, target.QualifiedName())
+	defer stopProgress()
+	if metrics != nil {
+		metrics.Start()
+		defer metrics.Stop()
+	}
+	stopNotify := notifySystemd(pw, target.QualifiedName())
+	ended := make(chan struct{})
+	go func() {
+		capture.Wait()
+		close(ended)
+	}()
+	// ...zzzzzzzzzz...
+	toolExited := false
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Infof("capture duration of %s elapsed, stopping capture", duration)
+		}
+	case <-exited:
+		log.Warnf("analysis tool exited, stopping capture")
+		toolExited = true
+	case <-ended:
+		log.Debugf("network packet capture stream from target %q ended", target.QualifiedName())
 	}
+	stopNotify()
+	// We're done, stop the packet capture stream in an orderly manner, so that
+	// we won't stream half-broken captures, but instead get a clean end.
+	// Stopping a capture will block until the capture has orderly terminated.
+	log.Debugf("closing live network packet capture stream from target %q...", target.QualifiedName())
+	if recovering != nil {
+		recovering.Abort()
+	}
+	// Writing to an analysis tool that exited fails, but that's not a failed
+	// capture.
+	captureErr = capture.StopErr()
+	if toolExited {
+		captureErr = nil
+	}
+	log.Debugf("network packet capture stream from target %q finished", target.QualifiedName())
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("cannot finish writing packet capture: %w", err)
+	}
+	if flows != nil {
+		flows.Close()
+		if err := flows.Err(); err != nil {
+			log.Warnf("capture summary incomplete: %s", err.Error())
+		}
+		top, _ := cmd.Flags().GetInt("summary-top")
+		s := flows.Summary(top)
+		if top > 0 && len(s.Recent) > top {
+			s.Recent = s.Recent[:top]
+		}
+		printSummary(summaryOut, s)
+	}
+	if captureErr != nil {
+		return fmt.Errorf("capture from target %q failed: %w", target.QualifiedName(), captureErr)
+	}
+	return nil
+}
+
+// captureOptions returns the capture options for capturing from the specified
+// target, as set using the capture flags, giving the capture policy plugins
+// the final say.
+func captureOptions(cmd *cobra.Command, st csharg.SharkTank, target *api.Target) (*csharg.CaptureOptions, error) {
+	var err error
+	// Get any supported capture options, such as the list of network interfaces.
+	captureopts := &csharg.CaptureOptions{}
+	if nifs, err := cmd.Flags().GetStringArray("interface"); err == nil && len(nifs) > 0 {
+		log.Debugf("capturing from network interfaces: %s", strings.Join(nifs, ", "))
+		captureopts.Nifs = nifs
+	}
+	captureopts.NoLoopback, _ = cmd.Flags().GetBool("no-loopback")
+	captureopts.AvoidPromiscuousMode, _ = cmd.Flags().GetBool(AvoidPromModeArg)
+	captureopts.MaxBuffer = command.MaxBuffer
+	if captureopts.Filter, _ = cmd.Flags().GetString("filter"); captureopts.Filter != "" {
+		log.Debugf("capture filter expression: %q", captureopts.Filter)
+	}
+	vlans, _ := cmd.Flags().GetString("vlan")
+	if captureopts.VLANs, err = csharg.ParseVLANs(vlans); err != nil {
+		return nil, fmt.Errorf("invalid --vlan: %w", err)
+	}
+	decap, _ := cmd.Flags().GetString("decapsulate")
+	if captureopts.Decapsulate, err = csharg.ParseEncapsulations(decap); err != nil {
+		return nil, fmt.Errorf("invalid --decapsulate: %w", err)
+	}
+	captureopts.Raw, _ = cmd.Flags().GetBool("raw")
+	if maxoutput, _ := cmd.Flags().GetString("max-output"); maxoutput != "" {
+		if captureopts.MaxOutput, err = command.ParseOctets(maxoutput); err != nil || captureopts.MaxOutput <= 0 {
+			return nil, fmt.Errorf("invalid --max-output %q", maxoutput)
+		}
+	}
+	if captureopts.MaxPackets, _ = cmd.Flags().GetInt64("packet-count"); captureopts.MaxPackets < 0 {
+		return nil, fmt.Errorf("invalid --packet-count %d", captureopts.MaxPackets)
+	}
+	if captureopts.SnapLen, _ = cmd.Flags().GetInt("snaplen"); captureopts.SnapLen < 0 || captureopts.SnapLen > csharg.MaxSnapLen {
+		return nil, fmt.Errorf("invalid --snaplen %d", captureopts.SnapLen)
+	}
+	captureopts.Heartbeat, _ = cmd.Flags().GetDuration("heartbeat")
+	captureopts.Reconnect, _ = cmd.Flags().GetDuration("reconnect")
+	captureopts.Alerts = captureAlerts(cmd, target)
+	if alias, _ := cmd.Flags().GetBool("alias-interfaces"); alias {
+		captureopts.InterfaceAliases = csharg.InterfaceAliases(target, st.Targets())
+	}
+	captureopts.Session.Requester, _ = cmd.Flags().GetString("requester")
+	captureopts.Session.Reason, _ = cmd.Flags().GetString("reason")
+	captureopts.Session.Ticket, _ = cmd.Flags().GetString("ticket")
+	if err := captureopts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid capture options:\n%w", err)
+	}
+	captureopts.Names = serviceNames(cmd)
+	// Give the capture policy plugins the final say about the capture options
+	// or whether to capture at all.
+	for _, beforeCapture := range plugger.Group[cli.BeforeCapture]().Symbols() {
+		if err := beforeCapture(target, captureopts); err != nil {
+			return nil, fmt.Errorf("capture from target %q denied: %w", target.QualifiedName(), err)
+		}
+	}
+	if err := captureopts.CheckCapabilities(target); err != nil {
+		return nil, err
+	}
+	return captureopts, nil
+}
+
+// captureAlerts returns the capture alerts logging warnings about stalled
+// capture streams and slow writes, as requested, as well as about packets
+// dropped by the capture service.
+func captureAlerts(cmd *cobra.Command, target *api.Target) *csharg.CaptureAlerts {
+	name := target.QualifiedName()
+	alerts := &csharg.CaptureAlerts{
+		OnStall: func(stalled time.Duration) {
+			log.Warnf("no network packets from target %q for %s", name, stalled.Round(time.Millisecond))
+		},
+		OnSlowWrite: func(took time.Duration) {
+			log.Warnf("writing network packets from target %q took %s", name, took.Round(time.Millisecond))
+		},
+		OnDrop: func(drop csharg.DropAlert) {
+			log.Warnf("capture service dropped %d more packets on %q of target %q (%d in total)",
+				drop.Delta, drop.Interface, name, drop.Dropped)
+		},
+	}
+	alerts.StallAfter, _ = cmd.Flags().GetDuration("stall-alert")
+	alerts.SlowWrite, _ = cmd.Flags().GetDuration("slow-write-alert")
+	return alerts
+}
+
+// findTargetByID looks up the capture target with the specified (truncated)
+// container or sandbox ID from the capture service, optionally on a specific
+// host/node.
+func findTargetByID(st csharg.SharkTank, id string, nodename string) (*api.Target, error) {
+	log.Debugf("looking up capture target with ID %q on node %q", id, nodename)
+	var cache csharg.TargetCache
+	command.Spin("discovering capture targets...", func() {
+		cache.Set(st.Targets())
+	})
+	matches := cache.MatchID(nodename, id)
+	switch len(matches) {
+	case 0:
+		if nodename == "" {
+			return nil, fmt.Errorf("%w with ID %q", csharg.ErrTargetNotFound, id)
+		}
+		return nil, fmt.Errorf("%w with ID %q on node %q", csharg.ErrTargetNotFound, id, nodename)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, t := range matches {
+		names = append(names, t.QualifiedName())
+	}
+	return nil, fmt.Errorf("%w: ID %q matches %d capture targets: %s",
+		csharg.ErrAmbiguousTarget, id, len(matches), strings.Join(names, ", "))
+}
+
+// findTarget looks up the specified named target from the capture service.
+// Optionally, the required type of target can be specified ("pod", et cetera),
+// as well as the host/node name in order to give an unambiguous target match.
+// Pods named without an explicit namespace are looked up in the specified
+// namespace.
+func findTarget(st csharg.SharkTank, targetname string, targettypes []api.TargetType, nodename string, namespace string) (*api.Target, error) {
 	// Final parameter sanity check.
 	if targetname == "" {
-		return fmt.Errorf("invalid empty capture target name")
+		return nil, fmt.Errorf("invalid empty capture target name")
 	}
 	log.Debugf("looking up capture target %q of type(s) %q on node %q",
 		targetname, targettypes, nodename)
 	// Try to find the named target and check for its type and/or nodename, if
 	// additionally specified, too.
+	var targets api.Targets
+	command.Spin("discovering capture targets...", func() {
+		targets = st.Targets()
+	})
 	matches := []*api.Target{}
-	for _, t := range st.Targets() {
-		log.Debugf("?target %+v", t)
+	for _, t := range targets {
+		log.Debugf("?target %s", t)
 		var typematch bool
 		if len(targettypes) != 0 {
 			// See if the type of this target is, erm, contained in the list of
@@ -83,8 +484,7 @@ func capture(cmd *cobra.Command, targetname string, targettypes []string, nodena
 				if t.Type == tt {
 					typematch = true
 					break
-				} else if tt == "container" &&
-					t.Type != "bindmount" && t.Type != "proc" && t.Type != "pod" {
+				} else if tt == anyContainer && t.Type.IsContainer() {
 					typematch = true
 					break
 				}
@@ -94,59 +494,49 @@ func capture(cmd *cobra.Command, targetname string, targettypes []string, nodena
 			// will always match any target type.
 			typematch = true
 		}
-		if t.Name == targetname && typematch &&
+		name := targetname
+		if t.Type.IsPod() && !strings.ContainsRune(targetname, '/') {
+			name = api.PodName(namespace, targetname)
+		}
+		if t.QualifiedName() == name && typematch &&
 			(nodename == "" || t.NodeName == nodename) {
 			matches = append(matches, t)
 		}
 	}
+	if len(matches) == 0 && len(targettypes) == 1 && targettypes[0] == api.TypePod {
+		// Fall back to matching pods by the start of their names, such as
+		// the names of deployments and stateful sets, kubectl style.
+		name := targetname
+		if !strings.ContainsRune(targetname, '/') {
+			name = api.PodName(namespace, targetname)
+		}
+		var cache csharg.TargetCache
+		cache.Set(targets)
+		for _, t := range cache.MatchPods(name) {
+			if nodename == "" || t.NodeName == nodename {
+				matches = append(matches, t)
+			}
+		}
+		if len(matches) > 1 {
+			names := make([]string, 0, len(matches))
+			for _, t := range matches {
+				names = append(names, t.QualifiedName())
+			}
+			return nil, fmt.Errorf("%w: pod %q matches %d pods: %s",
+				csharg.ErrAmbiguousTarget, targetname, len(matches), strings.Join(names, ", "))
+		}
+		if len(matches) == 1 {
+			log.Infof("capturing from pod %q", matches[0].QualifiedName())
+		}
+	}
 	if len(matches) == 0 {
 		if nodename == "" {
-			return fmt.Errorf("capture target %q not found", targetname)
+			return nil, fmt.Errorf("%w %q", csharg.ErrTargetNotFound, targetname)
 		}
-		return fmt.Errorf("capture target %q on node %q not found", targetname, nodename)
+		return nil, fmt.Errorf("%w %q on node %q", csharg.ErrTargetNotFound, targetname, nodename)
 	}
 	if len(matches) > 1 {
-		return fmt.Errorf("ambiguous capture target %q matches %d targets", targetname, len(matches))
-	}
-	// Open a new output file to dump the captured network packets into, or use
-	// stdout, if "-" was specified.
-	out := os.Stdout
-	if wname, _ := cmd.Flags().GetString("write"); wname != "-" {
-		var err error // ...oh, the joy of shady variable shadowing when misusing ":="!
-		out, err = os.OpenFile(wname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
-		if err != nil {
-			return fmt.Errorf("cannot create packet capture file: %s", err.Error())
-		}
-		defer out.Close()
+		return nil, fmt.Errorf("%w %q matches %d targets", csharg.ErrAmbiguousTarget, targetname, len(matches))
 	}
-	// Get any supported capture options, such as the list of network interfaces.
-	captureopts := &csharg.CaptureOptions{}
-	if nifs, err := cmd.Flags().GetStringArray("interface"); err == nil && len(nifs) > 0 {
-		log.Debugf("capturing from network interfaces: %s", strings.Join(nifs, ", "))
-		captureopts.Nifs = nifs
-	}
-	captureopts.AvoidPromiscuousMode, _ = cmd.Flags().GetBool(AvoidPromModeArg)
-	if filter, err := cmd.Flags().GetString("filter"); err != nil && filter != "" {
-		log.Debugf("capture filter expression: %q", filter)
-		captureopts.Filter = filter
-	}
-	// Start the capture stream and keep streaming until we drop ... because
-	// this CLI tool was SIGINT'ed or SIGTERM'ed.
-	target := matches[0]
-	capture, err := st.Capture(out, target, captureopts)
-	if err != nil {
-		return fmt.Errorf("cannot start capture: %s", err.Error())
-	}
-	done := make(chan os.Signal)
-	signal.Notify(done, os.Interrupt)
-	signal.Notify(done, syscall.SIGTERM)
-	// ...zzzzzzzzzz...
-	<-done
-	// We're done, stop the packet capture stream in an orderly manner, so that
-	// we won't stream half-broken captures, but instead get a clean end.
-	// Stopping a capture will block until the capture has orderly terminated.
-	log.Debugf("closing live network packet capture stream from target %q...", target.Name)
-	capture.Stop()
-	log.Debugf("network packet capture stream from target %q finished", target.Name)
-	return nil
+	return matches[0], nil
 }
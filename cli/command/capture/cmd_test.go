@@ -0,0 +1,109 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"errors"
+	"io"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/csargtest"
+	"github.com/thediveo/go-plugger/v3"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// requireFilter enables the filter-enforcing capture policy plugin registered
+// for testing.
+var requireFilter bool
+
+func init() {
+	plugger.Group[cli.BeforeCapture]().Register(func(target *api.Target, opts *csharg.CaptureOptions) error {
+		if requireFilter && opts.Filter == "" {
+			return errors.New("capture filter required")
+		}
+		return nil
+	}, plugger.WithPlugin("requirefilter"))
+}
+
+var _ = Describe("capture command", func() {
+
+	foo := &api.Target{Name: "foo", Type: api.TypeDocker, NetworkInterfaces: []string{"eth0"}}
+
+	var st *csargtest.SharkTank
+	var client csharg.SharkTank
+
+	BeforeEach(func() {
+		st = csargtest.New(foo)
+		srv := csargtest.NewServer(st)
+		DeferCleanup(srv.Close)
+		var err error
+		client, err = csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+	})
+
+	// setFlags sets the capture command flags as if given on the command
+	// line, resetting them afterwards.
+	setFlags := func(args ...string) {
+		Expect(captureCmd.ParseFlags(args)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(captureCmd.ParseFlags([]string{"--filter", ""})).To(Succeed())
+		})
+	}
+
+	// captureWith captures from the capture target using the capture options
+	// as set by the capture command flags, and returns the capture options
+	// received by the capture service.
+	captureWith := func() csharg.CaptureOptions {
+		opts, err := captureOptions(captureCmd, client, foo)
+		Expect(err).NotTo(HaveOccurred())
+		cs, err := client.Capture(io.Discard, foo, opts)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		Expect(st.Captures()).To(HaveLen(1))
+		return st.Captures()[0].Options
+	}
+
+	It("passes the capture filter to the capture service", func() {
+		setFlags("-f", "tcp port 80")
+		Expect(captureWith().Filter).To(Equal("tcp port 80"))
+	})
+
+	It("captures unfiltered without a capture filter", func() {
+		setFlags()
+		Expect(captureWith().Filter).To(BeEmpty())
+	})
+
+	It("rejects invalid capture filters", func() {
+		setFlags("--filter", "tcp port")
+		Expect(captureOptions(captureCmd, client, foo)).Error().To(
+			MatchError(ContainSubstring("filter")))
+	})
+
+	When("a capture policy requires capture filters", func() {
+
+		BeforeEach(func() {
+			requireFilter = true
+			DeferCleanup(func() { requireFilter = false })
+		})
+
+		It("denies captures without capture filter", func() {
+			setFlags()
+			Expect(captureOptions(captureCmd, client, foo)).Error().To(
+				MatchError(ContainSubstring("capture filter required")))
+		})
+
+		It("allows captures with capture filter", func() {
+			setFlags("--filter", "udp")
+			Expect(captureWith().Filter).To(Equal("udp"))
+		})
+
+	})
+
+})
@@ -7,29 +7,50 @@
 package capture
 
 import (
+	"fmt"
+
+	"github.com/siemens/csharg/api"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	captureCmd.AddCommand(ContainerCmd)
+	ContainerCmd.Flags().String("id", "",
+		"(Truncated) container or sandbox ID of the container to capture from, as shown by \"docker ps\" or \"crictl ps\", instead of its name.")
 }
 
 // ContainerCmd defines the "csharg capture container" command.
 var ContainerCmd = &cobra.Command{
-	Use:   "container [flags] CONTAINER [NODE]",
+	Use:   "container [flags] CONTAINER|--id ID [NODE]",
 	Short: "capture from a stand-alone container on a stand-alone container host or node",
 	Example: `# Capture from stand-alone container "mymoby" on host
 csharg --host localhost:5001 capture container mycontainer-1 localhost
 
 # Capture from stand-alone container in specific cluster context
-csharg --context mycluster container mymoby worker-42`,
-	Args: cobra.RangeArgs(1, 2),
+csharg --context mycluster container mymoby worker-42
+
+# Capture from the container with the (truncated) ID from "docker ps" on host
+csharg --host localhost:5001 capture container --id 4f1c0e2d9a7b`,
+	Args: cobra.RangeArgs(0, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if id, _ := cmd.Flags().GetString("id"); id != "" {
+			if len(args) > 1 {
+				return fmt.Errorf("accepts at most 1 arg(s) with --id, received %d", len(args))
+			}
+			nodename := ""
+			if len(args) == 1 {
+				nodename = args[0]
+			}
+			return capture(cmd, "", []api.TargetType{anyContainer}, nodename)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("requires a container name or --id")
+		}
 		containername := args[0]
 		nodename := ""
 		if standalonehost, err := cmd.Flags().GetString("host"); err != nil || standalonehost == "" {
 			nodename = args[1]
 		}
-		return capture(cmd, containername, []string{"container"}, nodename)
+		return capture(cmd, containername, []api.TargetType{anyContainer}, nodename)
 	},
 }
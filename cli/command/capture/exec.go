@@ -0,0 +1,206 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FifoPlaceholder gets replaced in “--exec” commands with the path of a named
+// pipe (FIFO) to read the packet capture stream from, for analysis tools that
+// cannot read from stdin.
+const FifoPlaceholder = "{fifo}"
+
+// ExecGracePeriod is the time an analysis tool gets to finish processing
+// after the end of the packet capture stream, before it gets killed.
+const ExecGracePeriod = 30 * time.Second
+
+// execSink feeds a packet capture stream to an analysis tool, such as
+// Suricata or Zeek, running as a child process.
+type execSink struct {
+	cmd    *exec.Cmd
+	what   string         // describes the tool in error messages.
+	w      io.WriteCloser // stdin of the child process or the FIFO.
+	opened chan error     // signals opening the FIFO.
+	fifo   string         // temporary directory with the FIFO, if any.
+	exited chan struct{}
+	err    error // exit error, valid only after exited has been closed.
+}
+
+// startExec starts the specified analysis tool command using the system's
+// shell. The packet capture stream is fed to the command via its stdin,
+// unless the command contains the FifoPlaceholder.
+func startExec(command string) (*execSink, error) {
+	s := &execSink{what: "--exec command", exited: make(chan struct{})}
+	if strings.Contains(command, FifoPlaceholder) {
+		dir, err := os.MkdirTemp("", "csharg-")
+		if err != nil {
+			return nil, err
+		}
+		s.fifo = dir
+		fifo := s.fifoPath()
+		if err := mkfifo(fifo); err != nil {
+			s.cleanup()
+			return nil, fmt.Errorf("cannot create FIFO for --exec: %w", err)
+		}
+		command = strings.ReplaceAll(command, FifoPlaceholder, fifo)
+		s.cmd = shellCommand(command)
+		s.opened = make(chan error, 1)
+		go func() {
+			// Opening the FIFO for writing blocks until the analysis tool has
+			// opened it for reading.
+			f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+			if err == nil {
+				s.w = f
+			}
+			s.opened <- err
+		}()
+	} else {
+		s.cmd = shellCommand(command)
+		stdin, err := s.cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		s.w = stdin
+	}
+	s.cmd.Stdout = os.Stdout
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// startTool starts the specified tool command, feeding the packet capture
+// stream to its stdin. The caller is responsible for setting up the tool's
+// stdout.
+func startTool(cmd *exec.Cmd, what string) (*execSink, error) {
+	s := &execSink{cmd: cmd, what: what, exited: make(chan struct{})}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.w = stdin
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// start starts the tool and then watches for it to exit.
+func (s *execSink) start() error {
+	s.cmd.Stderr = os.Stderr
+	isolate(s.cmd)
+	log.Debugf("starting analysis tool: %s", s.cmd.String())
+	if err := s.cmd.Start(); err != nil {
+		s.cleanup()
+		return fmt.Errorf("cannot start %s: %w", s.what, err)
+	}
+	go func() {
+		s.err = s.cmd.Wait()
+		close(s.exited)
+	}()
+	return nil
+}
+
+// shellCommand returns a command running the specified command line using the
+// system's shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
+
+// Exited returns a channel that gets closed when the analysis tool has
+// exited.
+func (s *execSink) Exited() <-chan struct{} {
+	return s.exited
+}
+
+// Write feeds octets of the packet capture stream to the analysis tool.
+func (s *execSink) Write(p []byte) (int, error) {
+	if s.opened != nil {
+		select {
+		case err := <-s.opened:
+			s.opened = nil
+			if err != nil {
+				return 0, fmt.Errorf("cannot open FIFO for --exec: %w", err)
+			}
+		case <-s.exited:
+			return 0, fmt.Errorf("%s exited before reading the packet capture stream", s.what)
+		}
+	}
+	if s.w == nil {
+		return 0, fmt.Errorf("%s isn't reading the packet capture stream", s.what)
+	}
+	return s.w.Write(p)
+}
+
+// Close ends the packet capture stream and then waits for the analysis tool
+// to finish, killing it after the grace period.
+func (s *execSink) Close() error {
+	defer s.cleanup()
+	grace := time.NewTimer(ExecGracePeriod)
+	defer grace.Stop()
+	if s.opened != nil {
+		// The analysis tool might not yet have opened the FIFO, so give it
+		// time to do so; otherwise, when it opens the FIFO after we've given
+		// up, it would block forever.
+		select {
+		case <-s.opened:
+		case <-s.exited:
+			s.unblock()
+		case <-grace.C:
+			log.Warnf("%s didn't open FIFO within %s, killing it", s.what, ExecGracePeriod)
+			kill(s.cmd)
+			s.unblock()
+		}
+		s.opened = nil
+	}
+	if s.w != nil {
+		s.w.Close()
+	}
+	select {
+	case <-s.exited:
+	case <-grace.C:
+		log.Warnf("%s didn't finish within %s, killing it", s.what, ExecGracePeriod)
+		kill(s.cmd)
+		<-s.exited
+	}
+	if s.err != nil {
+		return fmt.Errorf("%s failed: %w", s.what, s.err)
+	}
+	return nil
+}
+
+// unblock unblocks our pending open of the FIFO in case the analysis tool
+// didn't open it on its own.
+func (s *execSink) unblock() {
+	if f, err := os.OpenFile(s.fifoPath(), os.O_RDWR, 0); err == nil {
+		<-s.opened
+		f.Close()
+	}
+}
+
+// fifoPath returns the path of the FIFO.
+func (s *execSink) fifoPath() string {
+	return filepath.Join(s.fifo, "capture.pcapng")
+}
+
+// cleanup removes the temporary FIFO, if any.
+func (s *execSink) cleanup() {
+	if s.fifo != "" {
+		os.RemoveAll(s.fifo)
+	}
+}
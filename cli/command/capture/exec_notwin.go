@@ -0,0 +1,30 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !windows
+
+package capture
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// mkfifo creates a named pipe (FIFO) at the specified path.
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, 0600)
+}
+
+// isolate puts the analysis tool into its own process group, so that a
+// terminal SIGINT only stops the capture, while the tool gets to finish
+// processing the remaining packets.
+func isolate(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// kill kills the analysis tool including any child processes in its process
+// group, such as when the tool was started via the shell.
+func kill(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
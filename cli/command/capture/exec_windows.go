@@ -0,0 +1,26 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+
+package capture
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// mkfifo isn't supported on Windows, so analysis tools need to read the
+// packet capture stream from stdin instead.
+func mkfifo(path string) error {
+	return errors.New("FIFOs are not supported on Windows, use stdin instead")
+}
+
+// isolate is a no-op on Windows.
+func isolate(cmd *exec.Cmd) {}
+
+// kill kills the analysis tool.
+func kill(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,92 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// TsharkEnv optionally names the tshark binary to use for extracting fields,
+// overriding looking up tshark in the PATH.
+const TsharkEnv = "CSHARG_TSHARK"
+
+// startFields starts a tshark child process extracting the specified fields
+// from the packet capture stream fed to it, and printing them in either "tab"
+// or "json" format to stdout.
+func startFields(fields []string, format string) (*execSink, error) {
+	var out io.Writer
+	switch format {
+	case "tab":
+		out = os.Stdout
+	case "json":
+		out = &fieldsJSONWriter{fields: fields, w: os.Stdout}
+	default:
+		return nil, fmt.Errorf("invalid --fields-format %q, must be tab or json", format)
+	}
+	tshark := os.Getenv(TsharkEnv)
+	if tshark == "" {
+		var err error
+		tshark, err = exec.LookPath("tshark")
+		if err != nil {
+			return nil, fmt.Errorf("--fields requires Wireshark's tshark in PATH or in $%s", TsharkEnv)
+		}
+	}
+	header := "header=n"
+	if format == "tab" {
+		header = "header=y"
+	}
+	args := []string{"-l", "-n", "-r", "-", "-T", "fields",
+		"-E", "separator=/t", "-E", "occurrence=a", "-E", header}
+	for _, field := range fields {
+		args = append(args, "-e", field)
+	}
+	cmd := exec.Command(tshark, args...)
+	cmd.Stdout = out
+	return startTool(cmd, "tshark")
+}
+
+// fieldsJSONWriter converts tab-separated tshark field output lines into JSON
+// objects, one per line, mapping field names to their values. Empty field
+// values become null.
+type fieldsJSONWriter struct {
+	fields []string
+	w      io.Writer
+	buff   []byte // incomplete line.
+}
+
+// Write converts all complete lines, keeping any incomplete line for later.
+func (f *fieldsJSONWriter) Write(p []byte) (int, error) {
+	f.buff = append(f.buff, p...)
+	for {
+		eol := bytes.IndexByte(f.buff, '\n')
+		if eol < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimSuffix(string(f.buff[:eol]), "\r")
+		f.buff = f.buff[eol+1:]
+		values := strings.Split(line, "\t")
+		record := make(map[string]*string, len(f.fields))
+		for idx, field := range f.fields {
+			if idx < len(values) && values[idx] != "" {
+				record[field] = &values[idx]
+			} else {
+				record[field] = nil
+			}
+		}
+		j, err := json.Marshal(record)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := f.w.Write(append(j, '\n')); err != nil {
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"context"
+	"os"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// K8sTokenEnv names the environment variable with the optional bearer token
+// for the Kubernetes API server queried for service names.
+const K8sTokenEnv = "CSHARG_K8S_TOKEN"
+
+// serviceNames returns the names of the Kubernetes services and their
+// endpoints when asked for using --k8s-api, otherwise nil. As the names only
+// enrich the capture, failing to discover them doesn't fail the capture.
+func serviceNames(cmd *cobra.Command) *pcapng.NameResolution {
+	apiserver, _ := cmd.Flags().GetString("k8s-api")
+	if apiserver == "" {
+		return nil
+	}
+	namespace, _ := cmd.Flags().GetString("k8s-namespace")
+	svcs, err := csharg.DiscoverServices(context.Background(), &csharg.ServiceDiscoveryOptions{
+		APIServer:   apiserver,
+		BearerToken: os.Getenv(K8sTokenEnv),
+		Namespace:   namespace,
+		Timeout:     command.ReqTimeout,
+	})
+	if err != nil {
+		log.Warnf("capturing without Kubernetes service names: %s", err.Error())
+		return nil
+	}
+	log.Infof("adding names of %d Kubernetes services", len(svcs))
+	return csharg.ServiceNames(svcs)
+}
@@ -0,0 +1,245 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+)
+
+// InfluxTokenEnv names the environment variable with the InfluxDB API token
+// for pushing capture metrics.
+const InfluxTokenEnv = "CSHARG_INFLUX_TOKEN"
+
+// DefaultMetricsInterval is the default interval for pushing capture metrics.
+const DefaultMetricsInterval = 10 * time.Second
+
+// captureMetrics keeps track of the throughput, packets and drops of a packet
+// capture stream written through it, periodically pushing these metrics to
+// either a Prometheus pushgateway or InfluxDB.
+type captureMetrics struct {
+	url      string
+	format   string
+	interval time.Duration
+	target   string
+	node     string
+	scanner  *pcapng.Scanner
+	client   *http.Client
+
+	mu      sync.Mutex
+	octets  int64
+	packets int64
+	drops   map[uint32]uint64 // latest drop counters per interface.
+	start   time.Time
+
+	lastOctets int64
+	lastPush   time.Time
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// newCaptureMetrics returns new capture metrics to be pushed in the specified
+// format, either "pushgateway" or "influx", to the specified URL.
+func newCaptureMetrics(pushurl string, format string, interval time.Duration, target string, node string) (*captureMetrics, error) {
+	u, err := url.Parse(pushurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid --metrics-push URL %q", pushurl)
+	}
+	switch format {
+	case "pushgateway", "influx":
+	default:
+		return nil, fmt.Errorf("invalid --metrics-format %q, must be pushgateway or influx", format)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid --metrics-interval %s", interval)
+	}
+	timeout := command.ReqTimeout
+	if timeout <= 0 {
+		timeout = interval
+	}
+	m := &captureMetrics{
+		url:      strings.TrimSuffix(pushurl, "/"),
+		format:   format,
+		interval: interval,
+		target:   target,
+		node:     node,
+		client:   &http.Client{Timeout: timeout},
+		drops:    map[uint32]uint64{},
+		done:     make(chan struct{}),
+	}
+	m.scanner = pcapng.NewScanner(m.block)
+	return m, nil
+}
+
+// Write scans the octets of the packet capture stream for packets and
+// interface statistics. Write never fails, so that a garbled stream at most
+// spoils the packet and drop metrics, but never the capture.
+func (m *captureMetrics) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	m.octets += int64(len(p))
+	m.mu.Unlock()
+	if m.scanner != nil {
+		if _, err := m.scanner.Write(p); err != nil {
+			log.Warnf("cannot count packets for capture metrics: %s", err)
+			m.scanner = nil
+		}
+	}
+	return len(p), nil
+}
+
+// block counts packets and keeps track of the drop counters.
+func (m *captureMetrics) block(b *pcapng.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch b.Type {
+	case pcapng.BlockSHB:
+		m.drops = map[uint32]uint64{}
+	case pcapng.BlockEPB, pcapng.BlockSPB:
+		m.packets++
+	case pcapng.BlockISB:
+		isb, err := b.InterfaceStatistics()
+		if err != nil {
+			return nil
+		}
+		if dropped, ok := isb.Counter(pcapng.OptISBIfDrop, b.Endian); ok {
+			m.drops[isb.InterfaceID] = dropped
+		}
+	}
+	return nil
+}
+
+// Start periodically pushes the capture metrics until stopped.
+func (m *captureMetrics) Start() {
+	m.start = time.Now()
+	m.lastPush = m.start
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				m.push()
+			}
+		}
+	}()
+}
+
+// Stop stops pushing and then pushes the final metrics.
+func (m *captureMetrics) Stop() {
+	close(m.done)
+	m.wg.Wait()
+	m.push()
+}
+
+// push pushes the current metrics, logging any errors, as these must not
+// interrupt the capture.
+func (m *captureMetrics) push() {
+	m.mu.Lock()
+	now := time.Now()
+	octets, packets := m.octets, m.packets
+	var dropped uint64
+	for _, drops := range m.drops {
+		dropped += drops
+	}
+	throughput := 0.0
+	if elapsed := now.Sub(m.lastPush).Seconds(); elapsed > 0 {
+		throughput = float64(octets-m.lastOctets) / elapsed
+	}
+	m.lastOctets, m.lastPush = octets, now
+	duration := now.Sub(m.start).Seconds()
+	m.mu.Unlock()
+
+	var req *http.Request
+	var err error
+	switch m.format {
+	case "pushgateway":
+		var body bytes.Buffer
+		for _, metric := range []struct {
+			name, kind, help string
+			value            any
+		}{
+			{"csharg_capture_octets_total", "counter", "Octets of the packet capture stream.", octets},
+			{"csharg_capture_packets_total", "counter", "Packets captured.", packets},
+			{"csharg_capture_dropped_packets_total", "counter", "Packets dropped by the capture interfaces.", dropped},
+			{"csharg_capture_throughput_octets_per_second", "gauge", "Current packet capture stream throughput.", throughput},
+			{"csharg_capture_duration_seconds", "gauge", "Duration of the capture so far.", duration},
+		} {
+			fmt.Fprintf(&body, "# HELP %s %s\n# TYPE %s %s\n%s %v\n",
+				metric.name, metric.help, metric.name, metric.kind, metric.name, metric.value)
+		}
+		req, err = http.NewRequest(http.MethodPut, m.url+"/metrics/job/csharg"+
+			groupingLabel("target", m.target)+groupingLabel("node", m.node), &body)
+		if err == nil {
+			req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+		}
+	case "influx":
+		line := fmt.Sprintf("csharg_capture,target=%s%s octets=%di,packets=%di,dropped=%di,throughput=%f,duration=%f %d\n",
+			influxTag(m.target), influxOptionalTag("node", m.node),
+			octets, packets, dropped, throughput, duration, now.UnixNano())
+		req, err = http.NewRequest(http.MethodPost, m.url, strings.NewReader(line))
+		if err == nil {
+			req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+			if token := os.Getenv(InfluxTokenEnv); token != "" {
+				req.Header.Set("Authorization", "Token "+token)
+			}
+		}
+	}
+	if err != nil {
+		log.Warnf("cannot push capture metrics: %s", err)
+		return
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		log.Warnf("cannot push capture metrics: %s", csharg.RedactError(err))
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		log.Warnf("cannot push capture metrics: %s", resp.Status)
+	}
+}
+
+// groupingLabel returns a pushgateway grouping key URL path element for the
+// specified label and value, using base64 encoding where necessary.
+func groupingLabel(label, value string) string {
+	if value == "" {
+		return ""
+	}
+	if strings.Contains(value, "/") {
+		return "/" + label + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + label + "/" + url.PathEscape(value)
+}
+
+// influxTag escapes a tag value in InfluxDB line protocol.
+func influxTag(value string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(value)
+}
+
+// influxOptionalTag returns an additional tag, unless the value is empty.
+func influxOptionalTag(key, value string) string {
+	if value == "" {
+		return ""
+	}
+	return "," + key + "=" + influxTag(value)
+}
@@ -7,6 +7,7 @@
 package capture
 
 import (
+	"github.com/siemens/csharg/api"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +31,6 @@ csharg --context mycluster network "init (1)" worker-42`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		containername := args[0]
 		nodename := args[1]
-		return capture(cmd, containername, []string{"bindmount", "proc"}, nodename)
+		return capture(cmd, containername, []api.TargetType{api.TypeBindmount, api.TypeProc}, nodename)
 	},
 }
@@ -0,0 +1,23 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCapture(t *testing.T) {
+	// Add the capture command with its flags to a root command, as the CLI
+	// does when setting up its commands.
+	CaptureSetupCLI(&cobra.Command{Use: "csharg"})
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Csharg cli/command/capture package suite")
+}
@@ -9,13 +9,17 @@ package capture
 import (
 	"strings"
 
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli/command"
 	"github.com/spf13/cobra"
 )
 
+// NamespaceEnv names the environment variable optionally specifying the
+// namespace of pods named without an explicit namespace.
+const NamespaceEnv = command.NamespaceEnv
+
 func init() {
 	captureCmd.AddCommand(PodCmd)
-	PodCmd.Flags().StringP("namespace", "n", "default",
-		"Namespace of pod, unless explicitly specified in pod name itself. Defaults to \"default\" namespace.")
 }
 
 // PodCmd defines the "csharg capture pod" command.
@@ -26,11 +30,27 @@ var PodCmd = &cobra.Command{
 csharg --host ... capture pod mikroservice | wireshark -k -i -`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		podnamespace, _ := cmd.Flags().GetString("namespace")
 		podname := args[0] // index safe, was already checked via ExactArgs(1).
 		if !strings.ContainsRune(podname, '/') {
-			podname = podnamespace + "/" + podname
+			podname = api.PodName(podNamespace(cmd), podname)
 		}
-		return capture(cmd, podname, []string{"pod"}, "")
+		return capture(cmd, podname, []api.TargetType{api.TypePod}, "")
 	},
 }
+
+// defaultNamespace returns the namespace of pods named without an explicit
+// namespace, as specified in $CSHARG_NAMESPACE, otherwise the “default”
+// namespace.
+func defaultNamespace() string {
+	return command.DefaultNamespace()
+}
+
+// podNamespace returns the namespace of pods named without an explicit
+// namespace, as specified using the --namespace flag, otherwise the default
+// namespace.
+func podNamespace(cmd *cobra.Command) string {
+	if namespace, _ := cmd.Flags().GetString("namespace"); namespace != "" {
+		return namespace
+	}
+	return defaultNamespace()
+}
@@ -0,0 +1,136 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/siemens/csharg/cli/command"
+)
+
+// progressWriter counts the octets written through it to the wrapped writer,
+// so that the capture progress can be shown to humans.
+type progressWriter struct {
+	w      io.Writer
+	octets atomic.Int64
+}
+
+// Write writes the octets in b to the wrapped writer, counting the octets
+// successfully written.
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.octets.Add(int64(n))
+	return n, err
+}
+
+// errNotSeekable signals that the wrapped writer isn't seekable.
+var errNotSeekable = errors.New("capture output is not seekable")
+
+// Seek seeks the wrapped writer, if seekable, so that the capture stream can
+// be patched in place when written to a file.
+func (p *progressWriter) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := p.w.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errNotSeekable
+}
+
+// WriteAt patches the wrapped writer in place, if seekable, without counting
+// the patched octets.
+func (p *progressWriter) WriteAt(b []byte, off int64) (int, error) {
+	if w, ok := p.w.(io.WriterAt); ok {
+		return w.WriteAt(b, off)
+	}
+	return 0, errNotSeekable
+}
+
+// teeWriter writes to the capture output as well as to additional taps, such
+// as the capture metrics and summary, like io.MultiWriter does. Unlike
+// io.MultiWriter, it passes seeking and patching in place on to the capture
+// output, so that the section length can still be patched in place.
+type teeWriter struct {
+	out  *progressWriter
+	taps []io.Writer
+}
+
+// Write writes the octets in b to the capture output and then to the taps,
+// stopping at the first error.
+func (t *teeWriter) Write(b []byte) (int, error) {
+	n, err := t.out.Write(b)
+	if err != nil {
+		return n, err
+	}
+	for _, tap := range t.taps {
+		if _, err := tap.Write(b); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Seek seeks the capture output, if seekable.
+func (t *teeWriter) Seek(offset int64, whence int) (int64, error) {
+	return t.out.Seek(offset, whence)
+}
+
+// WriteAt patches the capture output in place, if seekable, leaving the taps
+// alone.
+func (t *teeWriter) WriteAt(b []byte, off int64) (int, error) {
+	return t.out.WriteAt(b, off)
+}
+
+// showProgress periodically shows the capture progress on stderr, until the
+// returned stop function gets called. Stopping then shows a final summary.
+// If stderr isn't a terminal, then no progress is shown at all.
+func showProgress(pw *progressWriter, targetname string) (stop func()) {
+	if !command.IsTerminal(os.Stderr) {
+		return func() {}
+	}
+	start := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			elapsed := time.Since(start)
+			octets := pw.octets.Load()
+			status := fmt.Sprintf("capturing from %q: %s, %s/s, %s",
+				targetname,
+				command.HumanOctets(octets),
+				command.HumanOctets(int64(float64(octets)/elapsed.Seconds())),
+				elapsed.Truncate(time.Second))
+			if command.ColorEnabled(os.Stderr) {
+				status = command.Colorize("●", command.ColorRed) + " " + status
+			}
+			fmt.Fprintf(os.Stderr, "\r\x1b[K%s", status)
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+		summary := fmt.Sprintf("captured %s from %q in %s",
+			command.HumanOctets(pw.octets.Load()),
+			targetname,
+			time.Since(start).Truncate(time.Second))
+		if command.ColorEnabled(os.Stderr) {
+			summary = command.Colorize(summary, command.ColorGreen)
+		}
+		fmt.Fprintf(os.Stderr, "\r\x1b[K%s\n", summary)
+	}
+}
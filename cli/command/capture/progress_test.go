@@ -0,0 +1,42 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture output tee", func() {
+
+	It("keeps seekable capture outputs seekable", func() {
+		f, err := os.Create(filepath.Join(GinkgoT().TempDir(), "capture.pcapng"))
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		var tap bytes.Buffer
+		tee := &teeWriter{out: &progressWriter{w: f}, taps: []io.Writer{&tap}}
+
+		Expect(tee.Write([]byte("hello, world"))).To(Equal(12))
+		Expect(tee.WriteAt([]byte("H"), 0)).To(Equal(1))
+		Expect(tee.Seek(0, io.SeekEnd)).To(BeEquivalentTo(12))
+		Expect(tee.Write([]byte("!"))).To(Equal(1))
+
+		Expect(os.ReadFile(f.Name())).To(Equal([]byte("Hello, world!")))
+		Expect(tap.String()).To(Equal("hello, world!"))
+		Expect(tee.out.octets.Load()).To(BeEquivalentTo(13))
+	})
+
+	It("reports non-seekable capture outputs", func() {
+		tee := &teeWriter{out: &progressWriter{w: &bytes.Buffer{}}, taps: []io.Writer{io.Discard}}
+		Expect(tee.Seek(0, io.SeekEnd)).Error().To(MatchError(errNotSeekable))
+		Expect(tee.WriteAt([]byte("H"), 0)).Error().To(MatchError(errNotSeekable))
+	})
+
+})
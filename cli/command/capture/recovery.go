@@ -0,0 +1,341 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+)
+
+// Output recovery defaults.
+const (
+	DefaultOutputRetry = time.Minute
+	DefaultOutputRing  = 64 << 20
+)
+
+// outputRecovery describes how to recover from failing to write the packet
+// capture, as specified using “--on-output-error”.
+type outputRecovery struct {
+	mode     string        // "fail", "retry", "fallback", or "ring".
+	retryFor time.Duration // how long to keep retrying.
+	dir      string        // directory of the fallback file.
+	size     int64         // size of the memory ring.
+}
+
+// parseOutputRecovery parses an output recovery specification: "fail",
+// "retry[=DURATION]", "fallback=DIR", or "ring[=SIZE]".
+func parseOutputRecovery(s string) (*outputRecovery, error) {
+	mode, arg, hasArg := strings.Cut(s, "=")
+	r := &outputRecovery{mode: mode}
+	switch mode {
+	case "fail":
+		if hasArg {
+			return nil, fmt.Errorf("invalid --on-output-error %q", s)
+		}
+	case "retry":
+		r.retryFor = DefaultOutputRetry
+		if hasArg {
+			d, err := time.ParseDuration(arg)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid --on-output-error retry duration %q", arg)
+			}
+			r.retryFor = d
+		}
+	case "fallback":
+		if arg == "" {
+			return nil, errors.New("invalid --on-output-error fallback, expecting fallback=DIR")
+		}
+		if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("invalid --on-output-error fallback directory %q", arg)
+		}
+		r.dir = arg
+	case "ring":
+		r.size = command.BufferLimited(DefaultOutputRing)
+		if hasArg {
+			size, err := command.ParseOctets(arg)
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid --on-output-error ring size %q", arg)
+			}
+			r.size = size
+		}
+	default:
+		return nil, fmt.Errorf("invalid --on-output-error %q, expecting fail, retry[=DURATION], fallback=DIR, or ring[=SIZE]", s)
+	}
+	return r, nil
+}
+
+// recoverable returns true if the error while writing the packet capture is
+// an output problem worth recovering from, such as a full disk, in contrast
+// to, for instance, a consumer that went away.
+func recoverable(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) || errors.Is(err, syscall.EIO)
+}
+
+// errRecovered signals that the original output cannot be patched anymore,
+// as writing has switched away from it.
+var errRecovered = errors.New("capture output has been switched")
+
+// recoveringSink writes the packet capture to an output sink, recovering from
+// a full disk or I/O errors as configured instead of ending the capture. It
+// only ever writes complete pcapng blocks, so that after switching to a
+// fallback file or memory ring, the original output can be cut back to its
+// last complete block, and the fallback starts a well-formed pcapng stream
+// with the section header and interface descriptions of the current section.
+type recoveringSink struct {
+	out      io.WriteCloser
+	recovery *outputRecovery
+	abort    chan struct{}
+	abortOne sync.Once
+
+	mu        sync.Mutex
+	scanner   *pcapng.Scanner
+	malformed bool     // passing a malformed pcapng stream through as is.
+	header    [][]byte // SHB and IDBs of the current section.
+	fresh     int      // number of header blocks from the current write.
+	blocks    []byte   // complete blocks of the current write.
+	offset    int64    // octets written to the current output.
+	ring      *pcapng.Ring
+	recovered bool // switched away from the original output.
+}
+
+var _ io.WriteCloser = (*recoveringSink)(nil)
+
+// newRecoveringSink returns a new recoveringSink writing to out.
+func newRecoveringSink(out io.WriteCloser, recovery *outputRecovery) *recoveringSink {
+	s := &recoveringSink{
+		out:      out,
+		recovery: recovery,
+		abort:    make(chan struct{}),
+	}
+	s.scanner = pcapng.NewScanner(s.block)
+	return s
+}
+
+// Write writes the complete pcapng blocks in p to the output, recovering from
+// output errors as configured.
+func (s *recoveringSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks, s.fresh = s.blocks[:0], 0
+	out := p
+	if !s.malformed {
+		if _, err := s.scanner.Write(p); err != nil {
+			log.Debugf("passing malformed packet capture through: %s", err.Error())
+			s.malformed = true
+		} else {
+			out = s.blocks
+		}
+	}
+	if len(out) == 0 {
+		return len(p), nil
+	}
+	if err := s.write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// block remembers the section header and interface descriptions of the
+// current section, and queues the block for writing. Callers must hold the
+// lock.
+func (s *recoveringSink) block(b *pcapng.Block) error {
+	octets := b.Bytes()
+	switch b.Type {
+	case pcapng.BlockSHB:
+		s.header, s.fresh = [][]byte{octets}, 1
+	case pcapng.BlockIDB:
+		s.header = append(s.header, octets)
+		s.fresh++
+	}
+	s.blocks = append(s.blocks, octets...)
+	return nil
+}
+
+// write writes the octets to the current output, or memory ring, recovering
+// from output errors as configured. Callers must hold the lock.
+func (s *recoveringSink) write(p []byte) error {
+	if s.ring != nil {
+		_, err := s.ring.Write(p)
+		return err
+	}
+	if s.out == nil {
+		// Switching to the fallback file failed.
+		return errRecovered
+	}
+	n, err := s.out.Write(p)
+	s.offset += int64(n)
+	if err == nil {
+		return nil
+	}
+	if !recoverable(err) || s.recovered {
+		return err
+	}
+	switch s.recovery.mode {
+	case "retry":
+		return s.retry(p[n:], err)
+	case "fallback":
+		return s.fallback(p, int64(n), err)
+	case "ring":
+		return s.toRing(p, int64(n), err)
+	}
+	return err
+}
+
+// retry keeps writing the remaining octets until either succeeding, the retry
+// duration has passed, or the capture is being stopped. Callers must hold the
+// lock.
+func (s *recoveringSink) retry(p []byte, err error) error {
+	log.Warnf("cannot write packet capture, retrying for up to %s: %s", s.recovery.retryFor, err.Error())
+	deadline := time.Now().Add(s.recovery.retryFor)
+	for time.Now().Before(deadline) {
+		select {
+		case <-s.abort:
+			return err
+		case <-time.After(time.Second):
+		}
+		var n int
+		n, err = s.out.Write(p)
+		s.offset += int64(n)
+		p = p[n:]
+		if err == nil {
+			log.Infof("resumed writing packet capture")
+			return nil
+		}
+		if !recoverable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// fallback cuts the original output back to its last complete block and then
+// continues with a new file in the fallback directory, starting with the
+// header of the current section. Callers must hold the lock.
+func (s *recoveringSink) fallback(p []byte, written int64, err error) error {
+	s.abandon(written)
+	f, ferr := os.CreateTemp(s.recovery.dir,
+		"csharg-fallback-"+time.Now().UTC().Format("20060102T150405Z")+"-*.pcapng")
+	if ferr != nil {
+		return errors.Join(err, ferr)
+	}
+	log.Warnf("cannot write packet capture, continuing in %s: %s", f.Name(), err.Error())
+	s.out, s.offset = f, 0
+	for _, octets := range s.preamble() {
+		if _, err := f.Write(octets); err != nil {
+			return err
+		}
+	}
+	_, err = f.Write(p)
+	return err
+}
+
+// toRing cuts the original output back to its last complete block and then
+// continues retaining the most recent packets in memory, starting with the
+// header of the current section. Callers must hold the lock.
+func (s *recoveringSink) toRing(p []byte, written int64, err error) error {
+	s.abandon(written)
+	log.Warnf("cannot write packet capture, retaining the most recent %s in memory: %s",
+		command.HumanOctets(s.recovery.size), err.Error())
+	s.ring = pcapng.NewRing(0, s.recovery.size)
+	for _, octets := range s.preamble() {
+		if _, err := s.ring.Write(octets); err != nil {
+			return err
+		}
+	}
+	_, err = s.ring.Write(p)
+	return err
+}
+
+// preamble returns the header blocks of the current section that have been
+// written before the current write, as the other header blocks are part of
+// the current write. Callers must hold the lock.
+func (s *recoveringSink) preamble() [][]byte {
+	return s.header[:len(s.header)-s.fresh]
+}
+
+// abandon cuts the original output back to its last complete block, if
+// possible, and then closes it. Callers must hold the lock.
+func (s *recoveringSink) abandon(written int64) {
+	s.recovered = true
+	if t, ok := s.out.(interface{ Truncate(int64) error }); ok {
+		if err := t.Truncate(s.offset - written); err != nil {
+			log.Debugf("cannot cut packet capture back to last complete block: %s", err.Error())
+		}
+	}
+	if err := s.out.Close(); err != nil {
+		log.Debugf("cannot close packet capture: %s", err.Error())
+	}
+	s.out = nil
+}
+
+// Abort retrying, such as when stopping the capture. Abort is idempotent.
+func (s *recoveringSink) Abort() {
+	s.abortOne.Do(func() { close(s.abort) })
+}
+
+// Close the output, or otherwise write the packets retained in memory into a
+// snapshot file in the current directory.
+func (s *recoveringSink) Close() error {
+	s.Abort()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ring == nil {
+		if s.out == nil {
+			return nil
+		}
+		return s.out.Close()
+	}
+	_ = s.ring.Close()
+	f, err := os.CreateTemp(".", "csharg-snapshot-"+time.Now().UTC().Format("20060102T150405Z")+"-*.pcapng")
+	if err != nil {
+		return err
+	}
+	packets, err := s.ring.Snapshot(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("wrote snapshot of the %d most recent packets to %s", packets, f.Name())
+	return nil
+}
+
+// Seek seeks the original output, if seekable.
+func (s *recoveringSink) Seek(offset int64, whence int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recovered {
+		return 0, errRecovered
+	}
+	if sk, ok := s.out.(io.Seeker); ok {
+		return sk.Seek(offset, whence)
+	}
+	return 0, errNotSeekable
+}
+
+// WriteAt patches the original output in place, if seekable and writing
+// hasn't switched away from it.
+func (s *recoveringSink) WriteAt(b []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recovered {
+		return 0, errRecovered
+	}
+	if w, ok := s.out.(io.WriterAt); ok {
+		return w.WriteAt(b, off)
+	}
+	return 0, errNotSeekable
+}
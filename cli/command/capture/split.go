@@ -0,0 +1,225 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// splitConflicts lists the capture flags that cannot be used when writing a
+// separate packet capture file per target.
+var splitConflicts = []string{
+	"write", "exec", "fields", "summary", "metrics-push", "on-output-error", "id",
+}
+
+// splitCapture is the capture from one of multiple targets into its own packet
+// capture file.
+type splitCapture struct {
+	target  *api.Target
+	file    *os.File
+	pw      *progressWriter
+	capture csharg.CaptureStreamer
+	audit   *auditRecord
+}
+
+// captureSplit captures from all the specified named targets at the same time,
+// writing the captured network packets of each target into its own packet
+// capture file in the specified directory. Stopping the captures finalizes all
+// packet capture files.
+func captureSplit(cmd *cobra.Command, dir string, targetnames []string) error {
+	for _, name := range splitConflicts {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--split-per-target cannot be combined with --%s", name)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("invalid --split-per-target directory %q", dir)
+	}
+	duration, _ := cmd.Flags().GetDuration("duration")
+	if duration < 0 {
+		return fmt.Errorf("invalid --duration %s", duration)
+	}
+	st, err := command.NewSharkTank()
+	if err != nil {
+		return fmt.Errorf("invalid --context: %w", err)
+	}
+	defer st.Close()
+	// Resolve all capture targets and their capture options before capturing
+	// from any of them, so that mistakes don't leave behind partial captures.
+	var splits []*splitCapture
+	var opts []*csharg.CaptureOptions
+	filenames := map[string]bool{}
+	for _, name := range targetnames {
+		target, err := findTarget(st, name, nil, "", podNamespace(cmd))
+		if err != nil {
+			return err
+		}
+		filename := splitFilename(target)
+		if filenames[filename] {
+			return fmt.Errorf("capture target %q specified multiple times", target.QualifiedName())
+		}
+		filenames[filename] = true
+		captureopts, err := captureOptions(cmd, st, target)
+		if err != nil {
+			return err
+		}
+		splits = append(splits, &splitCapture{target: target})
+		opts = append(opts, captureopts)
+	}
+	var audit *auditLog
+	if dest, _ := cmd.Flags().GetString("audit-log"); dest != "" {
+		audit, err = openAuditLog(dest)
+		if err != nil {
+			return err
+		}
+		defer audit.Close()
+	}
+	ctx, stopSignals := signal.NotifyContext(context.Background(), command.ShutdownSignals...)
+	defer stopSignals()
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	started := splits[:0]
+	for idx, split := range splits {
+		if err := split.start(ctx, st, dir, opts[idx], audit); err != nil {
+			log.Errorf("cannot capture from %q: %s", split.target.QualifiedName(), err.Error())
+			continue
+		}
+		started = append(started, split)
+	}
+	splits = started
+	if len(splits) == 0 {
+		return errors.New("cannot capture from any target")
+	}
+	// Wait for all captures to end, either on their own, or because they got
+	// stopped by interrupting this CLI tool or running out of time.
+	var wg sync.WaitGroup
+	for _, split := range splits {
+		wg.Add(1)
+		go func(split *splitCapture) {
+			defer wg.Done()
+			split.capture.Wait()
+		}(split)
+	}
+	ended := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Infof("capture duration of %s elapsed, stopping captures", duration)
+		}
+	case <-ended:
+		log.Debugf("all network packet capture streams ended")
+	}
+	var errs []error
+	for _, split := range splits {
+		if err := split.stop(audit); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// start capturing from the target into a new packet capture file in the
+// specified directory.
+func (s *splitCapture) start(ctx context.Context, st csharg.SharkTank, dir string, opts *csharg.CaptureOptions, audit *auditLog) error {
+	var err error
+	path := filepath.Join(dir, splitFilename(s.target))
+	s.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("cannot create packet capture file: %w", err)
+	}
+	s.pw = &progressWriter{w: s.file}
+	if audit != nil {
+		s.audit = newAuditRecord(s.target, opts)
+	}
+	s.capture, err = csharg.CaptureContext(ctx, st, s.pw, s.target, opts)
+	if err != nil {
+		s.file.Close()
+		_ = os.Remove(path)
+		if audit != nil {
+			if aerr := audit.Record(s.audit, auditFailed, 0, err); aerr != nil {
+				log.Error(aerr.Error())
+			}
+		}
+		return err
+	}
+	if audit != nil {
+		if err := audit.Record(s.audit, auditStart, 0, nil); err != nil {
+			s.capture.Stop()
+			s.file.Close()
+			return err
+		}
+	}
+	log.Infof("capturing from %q into %s", s.target.QualifiedName(), path)
+	return nil
+}
+
+// stop the capture in an orderly manner and then close its finalized packet
+// capture file.
+func (s *splitCapture) stop(audit *auditLog) error {
+	captureErr := s.capture.StopErr()
+	if audit != nil {
+		if err := audit.Record(s.audit, auditStop, s.pw.octets.Load(), captureErr); err != nil {
+			log.Error(err.Error())
+		}
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("cannot finish writing packet capture of %q: %w", s.target.QualifiedName(), err)
+	}
+	log.Infof("captured %s from %q into %s",
+		command.HumanOctets(s.pw.octets.Load()), s.target.QualifiedName(), s.file.Name())
+	return nil
+}
+
+// splitFilename returns the file name of the packet capture of the specified
+// target, derived from the target's prefix, namespace, name, and node name,
+// such as "default_web-0_node-1.pcapng".
+func splitFilename(target *api.Target) string {
+	var parts []string
+	for _, part := range []string{target.Prefix, target.Namespace, target.Name, target.NodeName} {
+		if part = sanitizeFilename(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{"netns-" + strconv.Itoa(target.NetNS)}
+	}
+	return strings.Join(parts, "_") + ".pcapng"
+}
+
+// sanitizeFilename replaces all characters unsafe in file names across
+// platforms with dashes, and trims leading dots and dashes.
+func sanitizeFilename(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '.', r == '-':
+			return r
+		}
+		return '-'
+	}, s)
+	return strings.TrimLeft(s, ".-")
+}
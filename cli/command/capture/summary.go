@@ -0,0 +1,54 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/packet"
+)
+
+// DefaultSummaryTop is the default number of busiest flows and top talkers
+// in capture summaries.
+const DefaultSummaryTop = 10
+
+// discardSink discards the packet capture stream when only a capture summary
+// is asked for.
+type discardSink struct{}
+
+func (discardSink) Write(p []byte) (int, error) { return len(p), nil }
+func (discardSink) Close() error                { return nil }
+
+// printSummary prints the capture summary of flows and top talkers in
+// human-readable form.
+func printSummary(w io.Writer, s packet.FlowSummary) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "Packets:\t%d\n", s.Packets)
+	fmt.Fprintf(tw, "Bytes:\t%d (%s)\n", s.Octets, command.HumanOctets(s.Octets))
+	printFlows(tw, "FLOW", s.Flows)
+	printFlows(tw, "RECENTLY ENDED FLOW", s.Recent)
+	if len(s.Talkers) > 0 {
+		fmt.Fprintln(tw, "\nTOP TALKER\tPACKETS\tBYTES")
+		for _, talker := range s.Talkers {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", talker.Addr, talker.Packets, command.HumanOctets(talker.Octets))
+		}
+	}
+}
+
+// printFlows prints a table of flows, unless there are none.
+func printFlows(tw io.Writer, heading string, flows []packet.Flow) {
+	if len(flows) == 0 {
+		return
+	}
+	fmt.Fprintf(tw, "\n%s\tPACKETS\tBYTES\tDURATION\n", heading)
+	for _, flow := range flows {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n",
+			flow.String(), flow.Packets, command.HumanOctets(flow.Octets), flow.Last.Sub(flow.First))
+	}
+}
@@ -0,0 +1,64 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/internal/sdnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// notifySystemd tells systemd that the capture is up and running when run as
+// a Type=notify service, and then keeps the service watchdog happy as long as
+// capture data keeps arriving, so that systemd restarts stalled captures.
+// Quiet, but otherwise alive captures need heartbeats in order to not get
+// restarted. Calling the returned stop function tells systemd that the capture
+// is stopping.
+func notifySystemd(pw *progressWriter, targetname string) (stop func()) {
+	if !sdnotify.Enabled() {
+		return func() {}
+	}
+	if err := sdnotify.Notify(sdnotify.Ready,
+		sdnotify.Status(fmt.Sprintf("capturing from %q", targetname))); err != nil {
+		log.Warnf("cannot notify systemd: %s", err)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if interval, ok := sdnotify.WatchdogInterval(); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(interval / 2)
+			defer ticker.Stop()
+			last := pw.octets.Load()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+				}
+				octets := pw.octets.Load()
+				if octets == last {
+					log.Debugf("capture stream stalled, skipping watchdog notification")
+					continue
+				}
+				last = octets
+				_ = sdnotify.Notify(sdnotify.Watchdog,
+					sdnotify.Status(fmt.Sprintf("capturing from %q: %s",
+						targetname, command.HumanOctets(octets))))
+			}
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+		_ = sdnotify.Notify(sdnotify.Stopping,
+			sdnotify.Status(fmt.Sprintf("stopping capture from %q", targetname)))
+	}
+}
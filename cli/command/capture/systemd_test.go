@@ -0,0 +1,77 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("systemd notifications", func() {
+
+	// listen sets up a notification socket and returns a channel receiving
+	// the notifications.
+	listen := func() chan string {
+		socket := filepath.Join(GinkgoT().TempDir(), "notify")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+		GinkgoT().Setenv("NOTIFY_SOCKET", socket)
+		GinkgoT().Setenv("WATCHDOG_USEC", "100000")
+		GinkgoT().Setenv("WATCHDOG_PID", "")
+		notifications := make(chan string, 100)
+		go func() {
+			buff := make([]byte, 4096)
+			for {
+				n, err := conn.Read(buff)
+				if err != nil {
+					return
+				}
+				notifications <- string(buff[:n])
+			}
+		}()
+		return notifications
+	}
+
+	isWatchdog := func(notification string) bool {
+		return strings.HasPrefix(notification, "WATCHDOG=1")
+	}
+
+	It("pings the watchdog only while capture data arrives", func() {
+		notifications := listen()
+		pw := &progressWriter{w: io.Discard}
+		stop := notifySystemd(pw, "foo")
+		Eventually(notifications).Should(Receive(HavePrefix("READY=1")))
+
+		By("not pinging the watchdog for a stalled capture stream")
+		Consistently(notifications, 200*time.Millisecond).ShouldNot(Receive(Satisfy(isWatchdog)))
+
+		By("pinging the watchdog while capture data arrives")
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			for {
+				select {
+				case <-done:
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+				_, _ = pw.Write([]byte{42})
+			}
+		}()
+		Eventually(notifications).Should(Receive(Satisfy(isWatchdog)))
+		close(done)
+
+		stop()
+		Eventually(notifications).Should(Receive(HavePrefix("STOPPING=1")))
+	})
+
+})
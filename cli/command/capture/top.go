@@ -0,0 +1,373 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package capture
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/packet"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// Defaults for the top command.
+const (
+	DefaultTopInterval   = 2 * time.Second
+	DefaultTopFlows      = 10
+	DefaultTopMaxTargets = 32
+)
+
+// topCmd defines the "csharg top" command.
+var topCmd = &cobra.Command{
+	Use:   "top [flags] [TARGET...]",
+	Short: "Show live per-target and per-flow network throughput",
+	Long: `Show live per-target and per-flow network throughput.
+
+The top command captures from the specified targets, or from all discovered
+targets if none are specified, and periodically shows a table of the current
+throughput per capture target, as well as of the busiest flows. Only the
+packet headers are decoded and the captured packets are thrown away
+afterwards. When stdout is a terminal, the table gets refreshed in place.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: top,
+	Example: `# Find out which pod is flooding the network.
+csharg top
+
+# Show the busiest TCP flows of two containers, refreshing every 5s.
+csharg top --interval 5s -f tcp mqtt-broker historian`,
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(TopSetupCLI, plugger.WithPlugin("top"))
+}
+
+// TopSetupCLI adds the "top" command.
+func TopSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(topCmd)
+	f := topCmd.Flags()
+	f.Duration("interval", DefaultTopInterval, "Interval for refreshing the throughput table")
+	f.Duration("duration", 0, "Stop after this duration; zero runs until interrupted")
+	f.Int("flows", DefaultTopFlows, "Number of busiest flows to show; zero hides flows")
+	f.Int("max-targets", DefaultTopMaxTargets,
+		"Maximum number of targets to capture from at the same time when no targets are specified")
+	f.StringP("node", "n", "", "Only capture from targets on this node")
+	f.StringP("filter", "f", "",
+		"Set the capture filter expression. It applies to all network interfaces included in a capture.")
+}
+
+// flowKey identifies a unidirectional flow of a capture target.
+type flowKey struct {
+	target  string
+	proto   string
+	src     netip.Addr
+	dst     netip.Addr
+	srcPort uint16
+	dstPort uint16
+}
+
+// topCounter counts the packets and octets of the packet capture stream of a
+// single capture target written to it, in total as well as per flow, throwing
+// away the stream.
+type topCounter struct {
+	target  *api.Target
+	scanner *pcapng.Scanner
+
+	mu      sync.Mutex
+	octets  int64 // octets of the current interval.
+	packets int64 // packets of the current interval.
+	total   int64 // total octets.
+	flows   map[flowKey]*counts
+	ended   bool
+}
+
+// counts are packet and octet counts.
+type counts struct {
+	packets int64
+	octets  int64
+}
+
+func newTopCounter(target *api.Target) *topCounter {
+	c := &topCounter{
+		target: target,
+		flows:  map[flowKey]*counts{},
+	}
+	c.scanner = pcapng.NewScanner(c.block)
+	return c
+}
+
+// Write decodes the packet headers written in order to count them.
+func (c *topCounter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scanner != nil {
+		if _, err := c.scanner.Write(p); err != nil {
+			log.Warnf("cannot decode packets from %q: %s", c.target.QualifiedName(), err)
+			c.scanner = nil
+		}
+	}
+	return len(p), nil
+}
+
+// block counts an enhanced packet block, decoding its packet headers in order
+// to attribute it to its flow.
+func (c *topCounter) block(b *pcapng.Block) error {
+	if b.Type != pcapng.BlockEPB {
+		return nil
+	}
+	epb, err := b.EnhancedPacket()
+	if err != nil {
+		return nil
+	}
+	octets := int64(epb.OriginalLength)
+	c.packets++
+	c.octets += octets
+	c.total += octets
+	idb := c.scanner.Interface(epb.InterfaceID)
+	if idb == nil {
+		return nil
+	}
+	summary, ok := packet.Decode(idb.LinkType, epb.Data)
+	if !ok || !summary.Src.IsValid() {
+		return nil
+	}
+	key := flowKey{
+		target: c.target.QualifiedName(),
+		proto:  summary.Transport(),
+		src:    summary.Src,
+		dst:    summary.Dst,
+	}
+	if summary.HasPorts() {
+		key.srcPort, key.dstPort = summary.SrcPort, summary.DstPort
+	}
+	flow, ok := c.flows[key]
+	if !ok {
+		flow = &counts{}
+		c.flows[key] = flow
+	}
+	flow.packets++
+	flow.octets += octets
+	return nil
+}
+
+// topTargetRow is a row of the per-target throughput table.
+type topTargetRow struct {
+	target *api.Target
+	counts
+	total int64
+	ended bool
+}
+
+// topFlowRow is a row of the per-flow throughput table.
+type topFlowRow struct {
+	flowKey
+	counts
+}
+
+// interval returns the counts of the current interval and starts a new
+// interval.
+func (c *topCounter) interval() (topTargetRow, []topFlowRow) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row := topTargetRow{
+		target: c.target,
+		counts: counts{packets: c.packets, octets: c.octets},
+		total:  c.total,
+		ended:  c.ended,
+	}
+	flows := make([]topFlowRow, 0, len(c.flows))
+	for key, flow := range c.flows {
+		flows = append(flows, topFlowRow{flowKey: key, counts: *flow})
+	}
+	c.packets, c.octets = 0, 0
+	c.flows = map[flowKey]*counts{}
+	return row, flows
+}
+
+// top captures from the specified or all capture targets and periodically
+// renders their throughput, until interrupted.
+func top(cmd *cobra.Command, args []string) error {
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("invalid --interval %s", interval)
+	}
+	duration, _ := cmd.Flags().GetDuration("duration")
+	if duration < 0 {
+		return fmt.Errorf("invalid --duration %s", duration)
+	}
+	numflows, _ := cmd.Flags().GetInt("flows")
+	maxTargets, _ := cmd.Flags().GetInt("max-targets")
+	nodename, _ := cmd.Flags().GetString("node")
+
+	st, err := command.NewSharkTank()
+	if err != nil {
+		return fmt.Errorf("invalid --context: %w", err)
+	}
+	defer st.Close()
+	var targets []*api.Target
+	if len(args) == 0 {
+		var discovered api.Targets
+		command.Spin("discovering capture targets...", func() {
+			discovered = st.Targets()
+		})
+		for _, t := range discovered {
+			if nodename == "" || t.NodeName == nodename {
+				targets = append(targets, t)
+			}
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("no capture targets found")
+		}
+		if len(targets) > maxTargets {
+			return fmt.Errorf("too many capture targets (%d), please specify targets or raise --max-targets",
+				len(targets))
+		}
+	} else {
+		for _, name := range args {
+			t, err := findTarget(st, name, nil, nodename, defaultNamespace())
+			if err != nil {
+				return err
+			}
+			targets = append(targets, t)
+		}
+	}
+
+	captureopts := &csharg.CaptureOptions{MaxBuffer: command.MaxBuffer}
+	captureopts.Filter, _ = cmd.Flags().GetString("filter")
+	var counters []*topCounter
+	var captures []csharg.CaptureStreamer
+	defer func() {
+		for _, capture := range captures {
+			capture.Stop()
+		}
+	}()
+	// Prepare all captures first and only then start them, so that the
+	// throughput of all targets gets measured from the same instant.
+	var prepared []csharg.PreparedCapture
+	for _, target := range targets {
+		counter := newTopCounter(target)
+		pc, err := st.Prepare(counter, target, captureopts)
+		if err != nil {
+			log.Errorf("cannot capture from %q: %s", target.QualifiedName(), err.Error())
+			continue
+		}
+		counters = append(counters, counter)
+		prepared = append(prepared, pc)
+	}
+	started := counters[:0]
+	for idx, pc := range prepared {
+		counter := counters[idx]
+		capture, err := pc.Start()
+		if err != nil {
+			log.Errorf("cannot capture from %q: %s", counter.target.QualifiedName(), err.Error())
+			continue
+		}
+		go func() {
+			capture.Wait()
+			counter.mu.Lock()
+			counter.ended = true
+			counter.mu.Unlock()
+		}()
+		started = append(started, counter)
+		captures = append(captures, capture)
+	}
+	counters = started
+	if len(counters) == 0 {
+		return fmt.Errorf("cannot capture from any target")
+	}
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, command.ShutdownSignals...)
+	defer signal.Stop(done)
+	var stop <-chan time.Time
+	if duration > 0 {
+		stop = time.After(duration)
+	}
+	refresh := command.IsTerminal(os.Stdout)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-stop:
+			return nil
+		case now := <-ticker.C:
+			renderTop(os.Stdout, counters, now.Sub(last), numflows, refresh)
+			last = now
+		}
+	}
+}
+
+// renderTop renders the per-target and per-flow throughput of the interval
+// that just ended, sorted by octets. When refreshing, it first clears the
+// terminal.
+func renderTop(w io.Writer, counters []*topCounter, elapsed time.Duration, numflows int, refresh bool) {
+	rows := make([]topTargetRow, 0, len(counters))
+	var flows []topFlowRow
+	for _, counter := range counters {
+		row, targetflows := counter.interval()
+		rows = append(rows, row)
+		flows = append(flows, targetflows...)
+	}
+	sort.SliceStable(rows, func(a, b int) bool { return rows[a].octets > rows[b].octets })
+	sort.Slice(flows, func(a, b int) bool { return flows[a].octets > flows[b].octets })
+	if len(flows) > numflows {
+		flows = flows[:numflows]
+	}
+	secs := elapsed.Seconds()
+	rate := func(octets int64) string {
+		return command.HumanOctets(int64(float64(octets)/secs)) + "/s"
+	}
+	if refresh {
+		fmt.Fprint(w, "\x1b[H\x1b[2J")
+	}
+	fmt.Fprintf(w, "csharg top - %s - %d targets\n\n", time.Now().Format(time.TimeOnly), len(rows))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tTYPE\tNODE\tPACKETS/s\tBYTES/s\tTOTAL")
+	for _, row := range rows {
+		name := row.target.QualifiedName()
+		if row.ended {
+			name += " (ended)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.0f\t%s\t%s\n",
+			name, row.target.Type, row.target.NodeName,
+			float64(row.packets)/secs, rate(row.octets), command.HumanOctets(row.total))
+	}
+	if len(flows) > 0 {
+		fmt.Fprintln(tw, "\nFLOW\tTARGET\tPACKETS/s\tBYTES/s")
+		for _, flow := range flows {
+			fmt.Fprintf(tw, "%s\t%s\t%.0f\t%s\n",
+				flow.String(), flow.target, float64(flow.packets)/secs, rate(flow.octets))
+		}
+	}
+	tw.Flush()
+	if !refresh {
+		fmt.Fprintln(w)
+	}
+}
+
+// String returns the flow in the form of "TCP 10.0.0.1:1234 > 10.0.0.2:80".
+func (k flowKey) String() string {
+	if k.srcPort == 0 && k.dstPort == 0 {
+		return fmt.Sprintf("%s %s > %s", k.proto, k.src, k.dst)
+	}
+	return fmt.Sprintf("%s %s > %s", k.proto,
+		netip.AddrPortFrom(k.src, k.srcPort), netip.AddrPortFrom(k.dst, k.dstPort))
+}
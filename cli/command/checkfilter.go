@@ -0,0 +1,101 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg check-filter" command for validating pcap filter
+// expressions without starting a capture.
+
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/filter"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// linkTypes maps the link type names accepted by "--link-type" to their link
+// types.
+var linkTypes = map[string]uint16{
+	"ethernet":   pcapng.LinkTypeEthernet,
+	"linux-sll":  pcapng.LinkTypeLinuxSLL,
+	"linux-sll2": pcapng.LinkTypeLinuxSLL2,
+	"raw":        pcapng.LinkTypeRaw,
+	"ipv4":       pcapng.LinkTypeIPv4,
+	"ipv6":       pcapng.LinkTypeIPv6,
+}
+
+// checkFilterCmd defines the "csharg check-filter" command.
+var checkFilterCmd = &cobra.Command{
+	Use:   "check-filter [flags] EXPRESSION",
+	Short: "Check a capture filter expression for syntax errors",
+	Long: `Checks a pcap capture filter expression for syntax errors, without starting a
+capture. The expression can be given as a single (quoted) argument or as
+multiple arguments that will be joined by spaces, similar to tcpdump.
+
+With --dump, the expression additionally gets compiled into a BPF program for
+the --link-type, which then is shown similar to "tcpdump -d". Compiling works
+offline, so host names are not supported, only addresses.`,
+	Example: `# Check a filter expression before capturing with it.
+csharg check-filter 'tcp port 443 and host 10.0.0.1'
+
+# Show the BPF program of a filter expression.
+csharg check-filter --dump 'tcp port 443 and host 10.0.0.1'`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{"no-keyring": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		expr := strings.Join(args, " ")
+		if err := csharg.ValidateFilter(expr); err != nil {
+			return err
+		}
+		if dump, _ := cmd.Flags().GetBool("dump"); dump {
+			linktype, err := linkType(cmd)
+			if err != nil {
+				return err
+			}
+			insns, err := filter.Compile(expr, linktype)
+			if err != nil {
+				return err
+			}
+			for idx, insn := range insns {
+				fmt.Fprintf(cmd.OutOrStdout(), "(%03d) %s\n", idx, insn)
+			}
+			return nil
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "filter expression is valid")
+		return nil
+	},
+}
+
+// linkType returns the link type specified by the "--link-type" flag, either
+// by name or number.
+func linkType(cmd *cobra.Command) (uint16, error) {
+	name, _ := cmd.Flags().GetString("link-type")
+	if linktype, ok := linkTypes[strings.ToLower(name)]; ok {
+		return linktype, nil
+	}
+	linktype, err := strconv.ParseUint(name, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unknown link type %q", name)
+	}
+	return uint16(linktype), nil
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(CheckFilterSetupCLI, plugger.WithPlugin("check-filter"))
+}
+
+// CheckFilterSetupCLI adds the “check-filter” command.
+func CheckFilterSetupCLI(cmd *cobra.Command) {
+	pf := checkFilterCmd.Flags()
+	pf.Bool("dump", false, "show the compiled BPF program")
+	pf.String("link-type", "ethernet",
+		"link type to compile for: ethernet, linux-sll, linux-sll2, raw, ipv4, ipv6, or a number")
+	cmd.AddCommand(checkFilterCmd)
+}
@@ -0,0 +1,71 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"os"
+
+	"github.com/mattn/go-isatty"
+	"github.com/siemens/csharg/cli"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// noColor disables colored output, as requested via the “--no-color” flag.
+var noColor bool
+
+// ANSI terminal attributes used for colored output.
+const (
+	ColorReset     = "\x1b[0m"
+	ColorBold      = "\x1b[1m"
+	ColorDim       = "\x1b[2m"
+	ColorUnderline = "\x1b[4m"
+	ColorRed       = "\x1b[31m"
+	ColorGreen     = "\x1b[32m"
+	ColorYellow    = "\x1b[33m"
+	ColorBlue      = "\x1b[34m"
+	ColorMagenta   = "\x1b[35m"
+	ColorCyan      = "\x1b[36m"
+)
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(ColorSetupCLI, plugger.WithPlugin("color"))
+}
+
+// ColorSetupCLI registers the “--no-color” CLI flag.
+func ColorSetupCLI(cmd *cobra.Command) {
+	pf := cmd.PersistentFlags()
+	pf.BoolVar(&noColor, "no-color", false,
+		"Disable colored output (also disabled when the NO_COLOR environment variable is set)")
+}
+
+// IsTerminal returns true if the specified file is a terminal.
+func IsTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// ColorEnabled returns true if colored output should be written to the
+// specified file: that is, the file is a terminal and the user did not disable
+// colors using either “--no-color” or the NO_COLOR environment variable (see
+// also https://no-color.org).
+func ColorEnabled(f *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return IsTerminal(f)
+}
+
+// Colorize wraps the specified text into the given ANSI attributes, resetting
+// the attributes afterwards.
+func Colorize(text string, attrs ...string) string {
+	if len(attrs) == 0 {
+		return text
+	}
+	s := ""
+	for _, attr := range attrs {
+		s += attr
+	}
+	return s + text + ColorReset
+}
@@ -0,0 +1,91 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/siemens/csharg/api"
+	"github.com/thediveo/klo"
+)
+
+// ColoringPrinter colors the tabular output of a chained custom-columns
+// printer, using bold headers and coloring the rows according to the types of
+// capture targets. As coloring happens on complete lines only after the
+// chained printer has aligned the columns, the ANSI escape sequences don't
+// disturb the column alignment.
+type ColoringPrinter struct {
+	ChainedPrinter *klo.CustomColumnsPrinter
+}
+
+// Fprint prints the value v (usually a list of capture targets) using the
+// chained custom-columns printer, then colors the output lines.
+func (p *ColoringPrinter) Fprint(w io.Writer, v interface{}) error {
+	var buff bytes.Buffer
+	if err := p.ChainedPrinter.Fprint(&buff, v); err != nil {
+		return err
+	}
+	attrs := rowAttributes(v)
+	sc := bufio.NewScanner(&buff)
+	row := 0
+	if !p.ChainedPrinter.HideHeaders && sc.Scan() {
+		if _, err := fmt.Fprintln(w, Colorize(sc.Text(), ColorBold)); err != nil {
+			return err
+		}
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		if row < len(attrs) && attrs[row] != "" {
+			line = Colorize(line, attrs[row])
+		}
+		row++
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// rowAttributes returns the row colors for the items in v, based on the types
+// of capture targets. For items that aren't capture targets no color is
+// returned.
+func rowAttributes(v interface{}) []string {
+	if v == nil || reflect.TypeOf(v).Kind() != reflect.Slice {
+		return nil
+	}
+	sl := reflect.ValueOf(v)
+	attrs := make([]string, sl.Len())
+	for idx := 0; idx < sl.Len(); idx++ {
+		item := sl.Index(idx).Interface()
+		if rv, ok := item.(reflect.Value); ok {
+			item = rv.Interface()
+		}
+		var t *api.Target
+		switch item := item.(type) {
+		case *api.Target:
+			t = item
+		case *OriginTarget:
+			t = item.Target
+		case *listRow:
+			t = item.Target
+		}
+		if t == nil {
+			continue
+		}
+		switch {
+		case t.Type.IsPod():
+			attrs[idx] = ColorCyan
+		case t.Type.IsNetworkOnly():
+			attrs[idx] = ColorYellow
+		default:
+			attrs[idx] = ColorGreen
+		}
+	}
+	return attrs
+}
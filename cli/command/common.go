@@ -9,6 +9,7 @@
 package command
 
 import (
+	"strings"
 	"time"
 
 	"github.com/siemens/csharg/cli"
@@ -38,6 +39,17 @@ var BearerToken string
 // server request.
 var ReqTimeout time.Duration
 
+// DiscoveryTimeout optionally overrides ReqTimeout for discovery requests.
+var DiscoveryTimeout time.Duration
+
+// HandshakeTimeout optionally overrides ReqTimeout for establishing capture
+// stream connections.
+var HandshakeTimeout time.Duration
+
+// StallTimeout optionally aborts capture streams not receiving any capture
+// data for this length of time.
+var StallTimeout time.Duration
+
 // rootCmd represents the Cobra "root" command thus the charg CLI itself.
 var rootCmd = &cobra.Command{
 	Use:   "csharg",
@@ -71,6 +83,12 @@ func SetupCLI() *cobra.Command {
 		`The length of time to wait before giving up on a single server request.
 Non-zero values should contain a corresponding time unit (e.g. 1s, 2m, 3h).
 A value of zero means don't timeout requests.`)
+	pf.DurationVar(&DiscoveryTimeout, "discovery-timeout", 0,
+		"The length of time to wait for capture target discoveries to complete (default --request-timeout)")
+	pf.DurationVar(&HandshakeTimeout, "handshake-timeout", 0,
+		"The length of time to wait for capture stream connections to be established (default --request-timeout)")
+	pf.DurationVar(&StallTimeout, "stall-timeout", 0,
+		"Abort captures when no capture data arrives for this length of time (default never)")
 
 	// Call registered plugins in order to add further CLI args as well as
 	// commands to the root command (or below).
@@ -81,17 +99,28 @@ A value of zero means don't timeout requests.`)
 	mutuallyExclusives(rootCmd)
 	// Fill in/expand command example sections, where additional command
 	// examples are available.
-	for _, cmd := range rootCmd.Commands() {
-		examples := cli.Examples(cmd.Name())
-		if examples == "" {
-			continue
-		}
-		cmd.Example = examples
-	}
+	addExamples(rootCmd)
 
 	return rootCmd
 }
 
+// addExamples recursively adds the examples registered for the (sub) commands
+// of the specified command, appending them to any examples the commands
+// already have. The examples are looked up by the command paths without the
+// root command name, such as “capture pod”.
+func addExamples(cmd *cobra.Command) {
+	for _, subcmd := range cmd.Commands() {
+		path := strings.TrimPrefix(subcmd.CommandPath(), rootCmd.Name()+" ")
+		if examples := cli.Examples(path); examples != "" {
+			if subcmd.Example != "" {
+				subcmd.Example += "\n\n"
+			}
+			subcmd.Example += examples
+		}
+		addExamples(subcmd)
+	}
+}
+
 // Annotate annotates the flag identified by name with the key=ann.
 func Annotate(fs *pflag.FlagSet, flagname, key, ann string) {
 	fs.SetAnnotation(flagname, key, []string{ann})
@@ -0,0 +1,261 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/thediveo/go-plugger/v3"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the csharg configuration as read from the configuration file.
+type Config struct {
+	// Profiles maps profile names to their settings.
+	Profiles map[string]ProfileSettings `yaml:"profiles"`
+	// Plugins maps plugin names to their configuration sections.
+	Plugins map[string]yaml.Node `yaml:"plugins"`
+}
+
+// pluginProfiles are the profile-specific settings of a plugin configuration
+// section, overriding the plugin's general settings.
+type pluginProfiles struct {
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// Validator is optionally implemented by the configuration values of
+// cli.ConfigSection plugins in order to validate their configuration after it
+// has been read.
+type Validator interface {
+	Validate() error
+}
+
+// ProfileSettings maps CLI flag names to the values to use for these flags in
+// a particular profile, such as "host: https://node-1:5001".
+type ProfileSettings map[string]string
+
+// ConfigFile specifies the configuration file to use.
+var ConfigFile string
+
+// config is the configuration loaded from the configuration file.
+var config *Config
+
+// pluginDefaults are the original (default) configuration values of the
+// cli.ConfigSection plugins, so profiles can be switched.
+var pluginDefaults = map[string]reflect.Value{}
+
+// profileRestores restore the flags set from a profile to their original
+// values, so profiles can be switched.
+var profileRestores []func() error
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(ConfigSetupCLI, plugger.WithPlugin("config"))
+	plugger.Group[cli.BeforeCommand]().Register(ConfigBeforeCommand,
+		plugger.WithPlugin("config"), plugger.WithPlacement("<"))
+}
+
+// ConfigSetupCLI registers the “--config” CLI flag.
+func ConfigSetupCLI(cmd *cobra.Command) {
+	configFile := os.Getenv("CSHARG_CONFIG")
+	if configFile == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			configFile = filepath.Join(dir, "csharg", "config.yaml")
+		}
+	}
+	cmd.PersistentFlags().StringVar(&ConfigFile, "config", configFile,
+		"Configuration file with profiles (defaults to $CSHARG_CONFIG, if set)")
+}
+
+// ConfigBeforeCommand loads the configuration file and then applies the
+// settings of the current profile to the CLI flags not explicitly set on the
+// command line.
+func ConfigBeforeCommand(cmd *cobra.Command) error {
+	var err error
+	config, err = LoadConfig(ConfigFile, cmd.Flags().Changed("config"))
+	if err != nil {
+		return err
+	}
+	return ApplyProfile(cmd, Profile)
+}
+
+// LoadConfig loads the specified configuration file. If the configuration
+// file doesn't exist and it is not required, then an empty configuration is
+// returned.
+func LoadConfig(filename string, required bool) (*Config, error) {
+	c := &Config{Profiles: map[string]ProfileSettings{}}
+	if filename == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("cannot read configuration: %w", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", filename, err)
+	}
+	if c.Profiles == nil {
+		c.Profiles = map[string]ProfileSettings{}
+	}
+	log.Debugf("loaded configuration %s with %d profiles", filename, len(c.Profiles))
+	return c, nil
+}
+
+// ProfileNames returns the sorted names of the configured profiles.
+func ProfileNames() []string {
+	if config == nil {
+		return nil
+	}
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile sets the CLI flags of the specified command according to the
+// settings of the named profile, except for flags explicitly set on the
+// command line. Flags set by a previously applied profile are restored first.
+// Unknown profiles without any settings are fine.
+func ApplyProfile(cmd *cobra.Command, name string) error {
+	for _, restore := range profileRestores {
+		if err := restore(); err != nil {
+			return err
+		}
+	}
+	profileRestores = nil
+	if config == nil {
+		return nil
+	}
+	for flagname, value := range config.Profiles[name] {
+		flag := cmd.Flags().Lookup(flagname)
+		if flag == nil {
+			return fmt.Errorf("profile %q: unknown flag %q", name, flagname)
+		}
+		if flag.Changed {
+			continue
+		}
+		profileRestores = append(profileRestores, restoreFlagValue(flag))
+		if err := setFlagValue(flag, value); err != nil {
+			return fmt.Errorf("profile %q: invalid %q value: %w", name, flagname, err)
+		}
+		if csharg.IsSensitive(flagname) {
+			value = csharg.Redacted
+		}
+		log.Debugf("profile %q: --%s=%q", name, flagname, value)
+	}
+	return applyPluginSections(name)
+}
+
+// applyPluginSections reads the configuration sections of the cli.ConfigSection
+// plugins, applying the settings specific to the named profile on top. The
+// configuration values of the plugins are reset to their defaults first.
+func applyPluginSections(name string) error {
+	sections := plugger.Group[cli.ConfigSection]().PluginsSymbols()
+	for plugin := range config.Plugins {
+		if !slices.ContainsFunc(sections, func(section plugger.Symbol[cli.ConfigSection]) bool {
+			return section.Plugin == plugin
+		}) {
+			return fmt.Errorf("unknown plugin configuration section %q", plugin)
+		}
+	}
+	for _, section := range sections {
+		v := section.S()
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Pointer || rv.IsNil() {
+			return fmt.Errorf("plugin %q: configuration must be a non-nil pointer", section.Plugin)
+		}
+		if defaults, ok := pluginDefaults[section.Plugin]; ok {
+			rv.Elem().Set(defaults)
+		} else {
+			defaults := reflect.New(rv.Elem().Type()).Elem()
+			defaults.Set(rv.Elem())
+			pluginDefaults[section.Plugin] = defaults
+		}
+		node, ok := config.Plugins[section.Plugin]
+		if !ok {
+			continue
+		}
+		if err := node.Decode(v); err != nil {
+			return fmt.Errorf("plugin %q: invalid configuration: %w", section.Plugin, err)
+		}
+		var profiles pluginProfiles
+		if err := node.Decode(&profiles); err != nil {
+			return fmt.Errorf("plugin %q: invalid profiles configuration: %w", section.Plugin, err)
+		}
+		if profile, ok := profiles.Profiles[name]; ok {
+			if err := profile.Decode(v); err != nil {
+				return fmt.Errorf("plugin %q: profile %q: invalid configuration: %w",
+					section.Plugin, name, err)
+			}
+		}
+		if validator, ok := v.(Validator); ok {
+			if err := validator.Validate(); err != nil {
+				return fmt.Errorf("plugin %q: invalid configuration: %w", section.Plugin, err)
+			}
+		}
+		log.Debugf("plugin %q: applied configuration for profile %q", section.Plugin, name)
+	}
+	return nil
+}
+
+// UseProfile switches to the named profile, applying its settings and
+// looking up its bearer token stored in the OS keyring, unless a bearer token
+// has been specified otherwise.
+func UseProfile(cmd *cobra.Command, name string) error {
+	if err := ApplyProfile(cmd, name); err != nil {
+		return err
+	}
+	if !tokenStdin && !cmd.Flags().Changed("token") && !ProfileSets(name, "token") {
+		BearerToken = KeyringToken(name)
+	}
+	return nil
+}
+
+// ProfileSets returns true if the named profile has a setting for the
+// specified flag.
+func ProfileSets(name string, flagname string) bool {
+	if config == nil {
+		return false
+	}
+	_, ok := config.Profiles[name][flagname]
+	return ok
+}
+
+// setFlagValue sets the value of a flag without marking the flag as changed,
+// so it can still be told apart from flags explicitly set on the command
+// line.
+func setFlagValue(flag *pflag.Flag, value string) error {
+	if sv, ok := flag.Value.(pflag.SliceValue); ok {
+		if err := sv.Replace(nil); err != nil {
+			return err
+		}
+	}
+	return flag.Value.Set(value)
+}
+
+// restoreFlagValue returns a function restoring the current value of a flag.
+func restoreFlagValue(flag *pflag.Flag) func() error {
+	if sv, ok := flag.Value.(pflag.SliceValue); ok {
+		values := sv.GetSlice()
+		return func() error { return sv.Replace(values) }
+	}
+	value := flag.Value.String()
+	return func() error { return flag.Value.Set(value) }
+}
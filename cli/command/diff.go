@@ -0,0 +1,199 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg diff" command for comparing capture target inventories,
+// such as before and after deployments.
+
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// liveInventory is the pseudo inventory file name for discovering the capture
+// targets instead.
+const liveInventory = "live"
+
+// diffCmd defines the "csharg diff" command.
+var diffCmd = &cobra.Command{
+	Use:   "diff [flags] OLD-TARGETS.json [NEW-TARGETS.json|live]",
+	Short: "Show the differences between capture target inventories",
+	Long: `Shows the capture targets added, removed, and changed between two capture
+target inventories, as saved using "csharg list -o json". Instead of a second
+inventory, "live" compares the saved inventory with the capture targets
+currently discovered; this is also the default.
+
+Capture targets are identified by their prefix, (qualified) name, type, and
+node name; changed capture targets are listed with the details that changed,
+such as their network interfaces.`,
+	Example: `# Verify the capture targets after a deployment.
+csharg list -o json > before.json
+kubectl apply -f deployment.yaml
+csharg diff before.json`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldTargets, err := loadInventory(args[0])
+		if err != nil {
+			return err
+		}
+		newname := liveInventory
+		if len(args) > 1 {
+			newname = args[1]
+		}
+		newTargets, err := loadInventory(newname)
+		if err != nil {
+			return err
+		}
+		diff := newTargets.Diff(oldTargets)
+		out := cmd.OutOrStdout()
+		if outfmt, _ := cmd.Flags().GetString("output"); outfmt == "json" {
+			return printDiffJSON(out, diff)
+		} else if outfmt != "" {
+			return fmt.Errorf("invalid --output %q, expecting json", outfmt)
+		}
+		printDiff(out, diff, oldTargets, out == os.Stdout && ColorEnabled(os.Stdout))
+		return nil
+	},
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(DiffSetupCLI, plugger.WithPlugin("diff"))
+}
+
+// DiffSetupCLI adds the “diff” command.
+func DiffSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringP("output", "o", "",
+		"Output format. One of: json; defaults to a line per added (+), removed (-), and changed (~) capture target.")
+}
+
+// loadInventory returns the capture targets from the specified inventory
+// file, or the currently discovered capture targets for "live". The
+// discovered capture targets get normalized in the same way as saved
+// inventories, so that only actual differences show up.
+func loadInventory(name string) (api.Targets, error) {
+	var data []byte
+	if name == liveInventory {
+		st, err := NewSharkTank()
+		if err != nil {
+			return nil, fmt.Errorf("invalid --context: %w", err)
+		}
+		var targets api.Targets
+		Spin("discovering capture targets...", func() {
+			targets = st.Targets()
+		})
+		if data, err = json.Marshal(targets); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(name); err != nil {
+			return nil, err
+		}
+	}
+	var targets api.Targets
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("invalid capture target inventory %s: %w", name, err)
+	}
+	return targets, nil
+}
+
+// printDiff prints the added, removed, and changed capture targets, one per
+// line, with the details that changed.
+func printDiff(w io.Writer, diff api.TargetsDiff, old api.Targets, color bool) {
+	if diff.Empty() {
+		fmt.Fprintln(w, "no differences")
+		return
+	}
+	paint := func(text, attr string) string {
+		if !color {
+			return text
+		}
+		return Colorize(text, attr)
+	}
+	for _, t := range diff.Added {
+		fmt.Fprintln(w, paint("+ "+t.String(), ColorGreen))
+	}
+	for _, t := range diff.Removed {
+		fmt.Fprintln(w, paint("- "+t.String(), ColorRed))
+	}
+	olds := make(map[string]*api.Target, len(old))
+	for _, t := range old {
+		olds[t.String()] = t
+	}
+	for _, t := range diff.Changed {
+		line := "~ " + t.String()
+		if fields := changedFields(olds[t.String()], t); len(fields) != 0 {
+			line += ": " + strings.Join(fields, ", ")
+		}
+		fmt.Fprintln(w, paint(line, ColorYellow))
+	}
+}
+
+// changedFields returns the sorted JSON field names of the capture target
+// details that differ between the old and new capture target.
+func changedFields(oldTarget, newTarget *api.Target) []string {
+	var oldfields, newfields map[string]json.RawMessage
+	if oldTarget == nil || jsonFields(oldTarget, &oldfields) != nil || jsonFields(newTarget, &newfields) != nil {
+		return nil
+	}
+	fields := []string{}
+	for name, value := range newfields {
+		if !bytes.Equal(value, oldfields[name]) {
+			fields = append(fields, name)
+		}
+	}
+	for name := range oldfields {
+		if _, ok := newfields[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// jsonFields decodes the JSON representation of a capture target into its
+// individual fields.
+func jsonFields(t *api.Target, fields *map[string]json.RawMessage) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, fields)
+}
+
+// printDiffJSON prints the differences in JSON format.
+func printDiffJSON(w io.Writer, diff api.TargetsDiff) error {
+	nonNil := func(ts api.Targets) api.Targets {
+		if ts == nil {
+			return api.Targets{}
+		}
+		return ts
+	}
+	txt, err := json.MarshalIndent(struct {
+		Added   api.Targets `json:"added"`
+		Removed api.Targets `json:"removed"`
+		Changed api.Targets `json:"changed"`
+	}{
+		Added:   nonNil(diff.Added),
+		Removed: nonNil(diff.Removed),
+		Changed: nonNil(diff.Changed),
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(txt, '\n'))
+	return err
+}
@@ -0,0 +1,141 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/siemens/csharg/cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+	"golang.org/x/exp/slices"
+)
+
+// ExternalPluginPrefix is the name prefix of external plugin executables on
+// the PATH: an executable “csharg-foo-bar” provides the “csharg foo bar”
+// command.
+const ExternalPluginPrefix = "csharg-"
+
+// Provides the “csharg plugin list” command to list the external plugins found
+// on the PATH.
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Provides utilities for interacting with external plugins.",
+	Long: `Provides utilities for interacting with external plugins.
+
+External plugins are executables on the PATH with names starting with "` + ExternalPluginPrefix + `".
+For instance, an executable "` + ExternalPluginPrefix + `foo-bar" provides the command "csharg foo bar",
+getting passed all remaining CLI args as well as the environment.`,
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all external plugins found on the PATH.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plugins := ExternalPlugins()
+		if len(plugins) == 0 {
+			return errors.New("no external plugins found on the PATH")
+		}
+		for _, plugin := range plugins {
+			fmt.Fprintln(cmd.OutOrStdout(), plugin)
+		}
+		return nil
+	},
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(
+		PluginSetupCLI, plugger.WithPlugin("plugin"))
+}
+
+// PluginSetupCLI adds the “plugin” command.
+func PluginSetupCLI(cmd *cobra.Command) {
+	pluginCmd.AddCommand(pluginListCmd)
+	cmd.AddCommand(pluginCmd)
+}
+
+// ExternalPlugins returns the paths of the external plugin executables found
+// on the PATH. Plugins shadowed by earlier plugins of the same name are
+// skipped.
+func ExternalPlugins() []string {
+	plugins := []string{}
+	seen := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, ExternalPluginPrefix) {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if !isExecutable(path) || slices.Contains(seen, name) {
+				continue
+			}
+			seen = append(seen, name)
+			plugins = append(plugins, path)
+		}
+	}
+	return plugins
+}
+
+// isExecutable returns true if the specified path is an executable file.
+func isExecutable(path string) bool {
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(path))
+		return ext == ".exe" || ext == ".bat" || ext == ".cmd"
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0111 != 0
+}
+
+// RunExternalPlugin runs the external plugin for the specified CLI args, if
+// these args don't address a builtin command, but instead an external plugin
+// executable on the PATH. In kubectl style, the longest sequence of leading
+// non-flag args matching a plugin executable name wins, and the remaining CLI
+// args are passed to the plugin. RunExternalPlugin returns true if it ran an
+// external plugin, together with any error.
+func RunExternalPlugin(root *cobra.Command, args []string) (bool, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return false, nil
+	}
+	if cmd, _, err := root.Find(args); err == nil && cmd != root {
+		return false, nil
+	}
+	names := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		names = append(names, arg)
+	}
+	for n := len(names); n > 0; n-- {
+		path, err := exec.LookPath(ExternalPluginPrefix + strings.Join(names[:n], "-"))
+		if err != nil {
+			continue
+		}
+		log.Debugf("running external plugin %s", path)
+		plugin := exec.Command(path, args[n:]...)
+		plugin.Stdin = os.Stdin
+		plugin.Stdout = os.Stdout
+		plugin.Stderr = os.Stderr
+		plugin.Env = os.Environ()
+		return true, plugin.Run()
+	}
+	return false, nil
+}
@@ -0,0 +1,52 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("external plugins", func() {
+
+	BeforeEach(func() {
+		if runtime.GOOS == "windows" {
+			Skip("needs executable permission bits")
+		}
+	})
+
+	It("lists the external plugins on the PATH", func() {
+		first, second := GinkgoT().TempDir(), GinkgoT().TempDir()
+		for _, path := range []string{
+			filepath.Join(first, "csharg-site-inventory"),
+			filepath.Join(second, "csharg-site-inventory"),
+			filepath.Join(second, "csharg-hello"),
+		} {
+			Expect(os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755)).To(Succeed())
+		}
+		Expect(os.WriteFile(filepath.Join(second, "csharg-notexec"), nil, 0o644)).To(Succeed())
+		GinkgoT().Setenv("PATH", first+string(filepath.ListSeparator)+second)
+
+		var out bytes.Buffer
+		pluginListCmd.SetOut(&out)
+		DeferCleanup(func() { pluginListCmd.SetOut(nil) })
+		Expect(pluginListCmd.RunE(pluginListCmd, nil)).To(Succeed())
+		Expect(out.String()).To(Equal(
+			filepath.Join(first, "csharg-site-inventory") + "\n" +
+				filepath.Join(second, "csharg-hello") + "\n"))
+	})
+
+	It("reports missing external plugins", func() {
+		GinkgoT().Setenv("PATH", GinkgoT().TempDir())
+		Expect(pluginListCmd.RunE(pluginListCmd, nil)).To(
+			MatchError("no external plugins found on the PATH"))
+	})
+
+})
@@ -0,0 +1,74 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HumanOctets returns the specified number of octets in human-readable form,
+// using binary units.
+func HumanOctets(octets int64) string {
+	const unit = 1024
+	if octets < unit {
+		return fmt.Sprintf("%d B", octets)
+	}
+	div, exp := int64(unit), 0
+	for n := octets / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(octets)/float64(div), "KMGTPE"[exp])
+}
+
+// octetUnits lists the supported unit suffixes for ParseOctets; the binary
+// units need to come first, as otherwise "B" would match them too.
+var octetUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000}, {"TB", 1000 * 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseOctets parses a number of octets with an optional binary or decimal
+// unit suffix, such as "512KiB", "16MiB", "1GB", or "1000".
+func ParseOctets(s string) (int64, error) {
+	factor := int64(1)
+	for _, unit := range octetUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, factor = strings.TrimSuffix(s, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * factor, nil
+}
+
+// HumanAge returns the specified age in the compact form used by kubectl,
+// such as “42s”, “5m”, “3h”, or “12d”, or “<unknown>” for negative ages.
+func HumanAge(age time.Duration) string {
+	switch {
+	case age < 0:
+		return "<unknown>"
+	case age < 2*time.Minute:
+		return fmt.Sprintf("%ds", int64(age.Seconds()))
+	case age < 3*time.Hour:
+		return fmt.Sprintf("%dm", int64(age.Minutes()))
+	case age < 2*24*time.Hour:
+		return fmt.Sprintf("%dh", int64(age.Hours()))
+	case age < 2*365*24*time.Hour:
+		return fmt.Sprintf("%dd", int64(age.Hours()/24))
+	default:
+		return fmt.Sprintf("%dy", int64(age.Hours()/24/365))
+	}
+}
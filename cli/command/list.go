@@ -8,10 +8,14 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/siemens/csharg"
 	"github.com/siemens/csharg/api"
 	"github.com/siemens/csharg/cli"
 	log "github.com/sirupsen/logrus"
@@ -23,24 +27,116 @@ import (
 // Builtin custom-columns templates
 const (
 	// PodListTemplate defines the custom columns when listing only pods.
-	PodListTemplate = "POD:{.Name}"
+	PodListTemplate = "NAMESPACE:{.Namespace},POD:{.Name},AGE:{.Age}"
 	// PodWideListTemplate defines the custom columns when listing only pods in
 	// --wide mode.
-	PodWideListTemplate = "POD:{.Name},NODE:{.NodeName}"
+	PodWideListTemplate = "NAMESPACE:{.Namespace},POD:{.Name},NODE:{.NodeName},AGE:{.Age},CLUSTER:{.ClusterContext},CLUSTER-UID:{.ClusterUID}"
 
 	// TargetListTemplate defines the custom columns when listing all types of
 	// capture targets.
-	TargetListTemplate = "TARGET:{.Name},TYPE:{.Type},NODE:{.NodeName}"
+	TargetListTemplate = "TARGET:{.QualifiedName},TYPE:{.Type},NODE:{.NodeName},AGE:{.Age}"
 	// TargetWideListTemplate is like TargetListTemplate, but additionally tacks
-	// on a column listing the capture service pod names.
-	TargetWideListTemplate = "TARGET:{.Name},TYPE:{.Type},NODE:{.NodeName},SERVICE:{.CaptureService}"
+	// on columns listing the capture service pod names and the cluster
+	// identities.
+	TargetWideListTemplate = "TARGET:{.QualifiedName},TYPE:{.Type},NODE:{.NodeName},AGE:{.Age},SERVICE:{.CaptureService},CLUSTER:{.ClusterContext},CLUSTER-UID:{.ClusterUID}"
 
 	// NameListTemplate for handling "-o name" and only showing a custom "name"
 	// column; this template should be used with no headers shown, as kubectl
 	// and others do.
-	NameListTemplate = "NAME:{.Name}"
+	NameListTemplate = "NAME:{.QualifiedName}"
+
+	// OriginColumnTemplate defines the custom column prefixed to the other
+	// templates when listing the capture targets of all profiles.
+	OriginColumnTemplate = "ORIGIN:{.Origin},"
+
+	// ClusterColumnTemplate defines the custom columns prefixed to the other
+	// non-wide templates when showing the cluster identities of the capture
+	// targets.
+	ClusterColumnTemplate = "CLUSTER:{.ClusterContext},CLUSTER-UID:{.ClusterUID},"
+
+	// DuplicatesColumnTemplate defines the custom column appended to the
+	// other templates when showing how many capture targets share the same
+	// name, such as "init (1)" on each node.
+	DuplicatesColumnTemplate = ",DUPLICATES:{.Duplicates}"
 )
 
+// OriginTarget is a capture target together with the name of the profile the
+// capture target has been discovered through.
+type OriginTarget struct {
+	*api.Target
+	Origin string `json:"origin"`
+}
+
+// MarshalJSON returns the JSON representation of the capture target with its
+// origin added, as otherwise the JSON marshalling of the embedded capture
+// target would take over.
+func (ot OriginTarget) MarshalJSON() ([]byte, error) {
+	target, err := json.Marshal(ot.Target)
+	if err != nil {
+		return nil, err
+	}
+	origin, err := json.Marshal(ot.Origin)
+	if err != nil {
+		return nil, err
+	}
+	if len(target) < 2 || target[len(target)-1] != '}' {
+		return nil, fmt.Errorf("cannot add origin to capture target %s", target)
+	}
+	target = append(target[:len(target)-1], `,"origin":`...)
+	return append(append(target, origin...), '}'), nil
+}
+
+// listRow is a capture target row in custom-columns list output, adding the
+// qualified name, human-readable age, cluster identity, and number of
+// duplicate names of the capture target, so that custom-columns templates can
+// refer to them as “{.QualifiedName}”, “{.Age}”, “{.ClusterContext}”,
+// “{.ClusterUID}”, and “{.Duplicates}”.
+type listRow struct {
+	*OriginTarget
+	QualifiedName  string
+	Age            string
+	ClusterContext string
+	ClusterUID     string
+	Duplicates     int // number of capture targets with the same name and origin.
+}
+
+// listRows returns the custom-columns list rows for the specified capture
+// targets, with their ages relative to now.
+func listRows(ots []*OriginTarget) []*listRow {
+	now := time.Now()
+	// Capture targets with the same name from the same origin can only be
+	// captured from when additionally specifying their nodes.
+	duplicates := map[string]int{}
+	for _, ot := range ots {
+		duplicates[ot.Origin+"\x00"+ot.QualifiedName()]++
+	}
+	rows := make([]*listRow, 0, len(ots))
+	for _, ot := range ots {
+		age := time.Duration(-1)
+		if created := ot.Created(); !created.IsZero() {
+			age = now.Sub(created)
+		}
+		row := &listRow{
+			OriginTarget:   ot,
+			QualifiedName:  ot.QualifiedName(),
+			Age:            HumanAge(age),
+			ClusterContext: "<none>",
+			ClusterUID:     "<none>",
+			Duplicates:     duplicates[ot.Origin+"\x00"+ot.QualifiedName()],
+		}
+		if cluster := ot.Cluster; cluster != nil {
+			if cluster.Context != "" {
+				row.ClusterContext = cluster.Context
+			}
+			if cluster.UID != "" {
+				row.ClusterUID = cluster.UID
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
 // listCmd defines the "csharg list" command.
 var listCmd = &cobra.Command{
 	Use:     "list [flags] [pods|containers|networks...]",
@@ -81,10 +177,18 @@ func init() {
 func ListSetupCLI(cmd *cobra.Command) {
 	cmd.AddCommand(listCmd)
 	listCmd.Flags().StringP("output", "o", "",
-		"Output format. One of: json|yaml|wide|custom-columns=...|custom-columns-file=...|jsonpath=...|jsonpath-file=...")
+		"Output format. One of: json|yaml|wide|custom-columns=...|custom-columns-file=...|jsonpath=...|jsonpath-file=..., or a format provided by a plugin.")
 	listCmd.Flags().Bool("no-headers", false, "When using the default or custom-column output format, don't print headers (default print headers).")
-	listCmd.Flags().String("sort-by", "{.Name}{'/'}{.NodeName}",
-		"If non-empty, sort custom-columns using this field specification. The field specification is expressed as a JSONPath expression (e.g. '{.Name}').")
+	listCmd.Flags().String("sort-by", "{.QualifiedName}{'/'}{.NodeName}",
+		"If non-empty, sort using these comma-separated keys. Each key is expressed as a JSONPath expression (e.g. '{.Name}'), sorting in descending order when prefixed with '-' (e.g. '{.NodeName},-{.Name}').")
+	listCmd.Flags().Bool("show-cluster", false,
+		"Show the cluster context and UID of the capture targets, as the wide output format does")
+	listCmd.Flags().Bool("show-duplicates", false,
+		"Show how many capture targets share the same name, such as \"init (1)\" on each node; these need --node when capturing")
+	listCmd.Flags().Bool("unique", false,
+		"List only capture targets with unique names, which can be captured from without specifying their nodes")
+	listCmd.Flags().Bool("all-profiles", false,
+		"Concurrently list the capture targets of all configured profiles, adding an origin column")
 }
 
 // filteredlist fetches the list of available capture targets and optionally
@@ -107,6 +211,22 @@ func filteredlist(cmd *cobra.Command, args []string) error {
 		}
 	}
 	log.Debugf("show pods: %v, containers: %v, networks: %v", showPods, showContainers, showNetworks)
+	allProfiles, _ := cmd.LocalFlags().GetBool("all-profiles")
+	var colprefix string
+	if allProfiles {
+		colprefix = OriginColumnTemplate
+	}
+	// The wide output format already shows the cluster identities, so only
+	// the other builtin formats need the cluster columns.
+	outfmt, _ := cmd.LocalFlags().GetString("output")
+	if showCluster, _ := cmd.LocalFlags().GetBool("show-cluster"); showCluster && outfmt != "wide" {
+		colprefix += ClusterColumnTemplate
+	}
+	var colsuffix string
+	if showDuplicates, _ := cmd.LocalFlags().GetBool("show-duplicates"); showDuplicates {
+		colsuffix = DuplicatesColumnTemplate
+	}
+	unique, _ := cmd.LocalFlags().GetBool("unique")
 	// If the user did not specify any output format or did just select the wide
 	// output format then select a suitable builtin format based on the filter
 	// settings...
@@ -121,64 +241,187 @@ func filteredlist(cmd *cobra.Command, args []string) error {
 			} else {
 				ccfmt = PodListTemplate
 			}
-			if err := cmd.LocalFlags().Set("output", "custom-columns="+ccfmt); err != nil {
+			if err := cmd.LocalFlags().Set("output", "custom-columns="+colprefix+ccfmt+colsuffix); err != nil {
 				panic(err)
 			}
 		}
 	}
 	// Get the output CLI flag and prepare a suitable object printer.
-	prn, err := getPrinter(cmd)
+	prn, err := getPrinter(cmd, colprefix, colsuffix)
 	if err != nil {
 		return err
 	}
-	// ...throwing in sorting, if not explicitly forbidden. It depends on the
-	// object printer if it will honor the sorted data or will just impose its
-	// own order anyway.
+	// Tables get rows with additional information, such as the capture target
+	// ages, while the other output formats get the capture targets as they are.
+	_, tabular := prn.(*klo.CustomColumnsPrinter)
+	// When printing tables to a terminal, color them unless told otherwise.
+	if ccprn, ok := prn.(*klo.CustomColumnsPrinter); ok && ColorEnabled(os.Stdout) {
+		prn = &ColoringPrinter{ChainedPrinter: ccprn}
+	}
+	// ...throwing in sorting, if not explicitly forbidden. All output formats
+	// get sorted by the JSONPath sort keys evaluated on the list rows, so that
+	// sort keys can also refer to “{.QualifiedName}” and “{.Age}”.
+	var sortkeys []sortKey
 	if sortby, err := cmd.LocalFlags().GetString("sort-by"); err == nil && sortby != "" {
-		var err error
-		prn, err = klo.NewSortingPrinter(sortby, prn)
+		if sortkeys, err = parseSortKeys(sortby); err != nil {
+			return fmt.Errorf("invalid --sort-by: %w", err)
+		}
+	}
+	show := func(t *api.Target) bool {
+		log.Debugf("found target %s via %q", t, t.CaptureService)
+		switch {
+		case t.Type.IsPod():
+			return showPods
+		case t.Type.IsNetworkOnly():
+			return showNetworks
+		default:
+			return showContainers
+		}
+	}
+	if allProfiles {
+		targets, err := profileTargets(cmd)
 		if err != nil {
+			return err
+		}
+		ft := make([]*OriginTarget, 0, len(targets))
+		for _, t := range targets {
+			if show(t.Target) {
+				ft = append(ft, t)
+			}
+		}
+		rows := listRows(ft)
+		if unique {
+			rows = uniqueRows(rows)
+		}
+		if err := sortRows(rows, sortkeys); err != nil {
+			return fmt.Errorf("invalid --sort-by: %w", err)
+		}
+		if tabular {
+			prn.Fprint(os.Stdout, rows)
 			return nil
 		}
+		ft = ft[:0]
+		for _, row := range rows {
+			ft = append(ft, row.OriginTarget)
+		}
+		prn.Fprint(os.Stdout, ft)
+		return nil
 	}
 	// Retrieve the list of capture targets from the container/cluster capture
 	// service.
 	st, err := NewSharkTank()
 	if err != nil {
-		return fmt.Errorf("invalid --context: %s", err)
+		return fmt.Errorf("invalid --context: %w", err)
 	}
-	targets := st.Targets()
-	// Filter the target list and then print it.
-	ft := make([]*api.Target, 0, len(targets))
+	defer st.Close()
+	var targets api.Targets
+	Spin("discovering capture targets...", func() {
+		targets = st.Targets()
+	})
+	// Filter the target list, sort, and then print it.
+	ots := make([]*OriginTarget, 0, len(targets))
 	for _, t := range targets {
-		log.Debugf("found target %q (%s) on %q via %q", t.Name, t.Type, t.NodeName, t.CaptureService)
-		switch t.Type {
-		case "pod":
-			if !showPods {
-				continue
-			}
-		case "bindmount", "proc":
-			if !showNetworks {
-				continue
-			}
-		default:
-			if !showContainers {
-				continue
-			}
+		if show(t) {
+			ots = append(ots, &OriginTarget{Target: t})
 		}
-		ft = append(ft, t)
+	}
+	rows := listRows(ots)
+	if unique {
+		rows = uniqueRows(rows)
+	}
+	if err := sortRows(rows, sortkeys); err != nil {
+		return fmt.Errorf("invalid --sort-by: %w", err)
+	}
+	if tabular {
+		prn.Fprint(os.Stdout, rows)
+		return nil
+	}
+	ft := make([]*api.Target, 0, len(rows))
+	for _, row := range rows {
+		ft = append(ft, row.Target)
 	}
 	prn.Fprint(os.Stdout, ft)
 	return nil
 }
 
+// uniqueRows returns only the list rows of capture targets with unique names.
+func uniqueRows(rows []*listRow) []*listRow {
+	unique := make([]*listRow, 0, len(rows))
+	for _, row := range rows {
+		if row.Duplicates <= 1 {
+			unique = append(unique, row)
+		}
+	}
+	return unique
+}
+
+// profileTargets concurrently retrieves the capture targets of all configured
+// profiles. Profiles for which no client can be created are skipped with an
+// error logged.
+func profileTargets(cmd *cobra.Command) ([]*OriginTarget, error) {
+	names := ProfileNames()
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no profiles configured in %s", ConfigFile)
+	}
+	// Creating the clients needs to be done one after another, as the client
+	// factories take their settings from the CLI flags.
+	sts := make([]csharg.SharkTank, len(names))
+	for idx, name := range names {
+		if err := UseProfile(cmd, name); err != nil {
+			return nil, err
+		}
+		st, err := NewSharkTank()
+		if err != nil {
+			log.Errorf("profile %q: %s", name, err.Error())
+			continue
+		}
+		defer st.Close()
+		sts[idx] = st
+	}
+	if err := UseProfile(cmd, Profile); err != nil {
+		return nil, err
+	}
+	targets := make([]api.Targets, len(names))
+	Spin(fmt.Sprintf("discovering capture targets of %d profiles...", len(names)), func() {
+		var wg sync.WaitGroup
+		for idx, st := range sts {
+			if st == nil {
+				continue
+			}
+			wg.Add(1)
+			go func(idx int, st csharg.SharkTank) {
+				defer wg.Done()
+				targets[idx] = st.Targets()
+			}(idx, st)
+		}
+		wg.Wait()
+	})
+	ots := []*OriginTarget{}
+	for idx, name := range names {
+		for _, t := range targets[idx] {
+			ots = append(ots, &OriginTarget{Target: t, Origin: name})
+		}
+	}
+	return ots, nil
+}
+
 // getPrinter returns a value printer configured according to the output format
-// chosen by the user, and some more optional output configuration flags.
-func getPrinter(cmd *cobra.Command) (prn klo.ValuePrinter, err error) {
+// chosen by the user, and some more optional output configuration flags. The
+// column prefix and suffix get prepended and appended respectively to the
+// builtin custom-columns templates.
+func getPrinter(cmd *cobra.Command, colprefix, colsuffix string) (prn klo.ValuePrinter, err error) {
 	outfmt, err := cmd.LocalFlags().GetString("output")
 	if err != nil {
 		return
 	}
+	// Give the registered list printer plugins a chance first to handle the
+	// requested output format, before we fall back to our builtin formats.
+	for _, newPrinter := range plugger.Group[cli.ListPrinter]().Symbols() {
+		prn, err = newPrinter(outfmt)
+		if err != nil || prn != nil {
+			return
+		}
+	}
 	if outfmt == "name" {
 		// Support "-o name" output format which uses our builtin custom-columns
 		// template to only show capture target names, and hide the column
@@ -197,8 +440,8 @@ func getPrinter(cmd *cobra.Command) (prn klo.ValuePrinter, err error) {
 		// package handle the details and give us just the printer suitable for
 		// dumping the target list onto our users.
 		prn, err = klo.PrinterFromFlag(outfmt, &klo.Specs{
-			DefaultColumnSpec: TargetListTemplate,
-			WideColumnSpec:    TargetWideListTemplate,
+			DefaultColumnSpec: colprefix + TargetListTemplate + colsuffix,
+			WideColumnSpec:    colprefix + TargetWideListTemplate + colsuffix,
 		})
 		if err != nil {
 			return
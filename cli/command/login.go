@@ -0,0 +1,81 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg login" and "csharg logout" commands for storing bearer
+// tokens per profile in the OS keyring, so that tokens never need to appear in
+// the shell history or process listings.
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/zalando/go-keyring"
+)
+
+// loginCmd defines the "csharg login" command.
+var loginCmd = &cobra.Command{
+	Use:   "login [flags]",
+	Short: "Store a bearer token for the current profile in the OS keyring",
+	Long: `Stores a bearer token for the current profile (see --profile) in the OS
+keyring. The token is read from stdin: when stdin is a terminal, then csharg
+prompts for the token without echoing it. Subsequent commands using the same
+profile then automatically use the stored token, unless a token is explicitly
+specified.`,
+	Example: `# Interactively store a bearer token for the "plant" profile.
+csharg --profile plant login
+
+# Store a bearer token from a file.
+csharg login < token.txt`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"no-keyring": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token := BearerToken
+		if token == "" {
+			var err error
+			token, err = ReadSecret(os.Stdin, fmt.Sprintf("Bearer token for profile %q: ", Profile))
+			if err != nil {
+				return fmt.Errorf("cannot read bearer token: %w", err)
+			}
+		}
+		if err := keyring.Set(KeyringService, Profile, token); err != nil {
+			return fmt.Errorf("cannot store bearer token in OS keyring: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "bearer token stored for profile %q\n", Profile)
+		return nil
+	},
+}
+
+// logoutCmd defines the "csharg logout" command.
+var logoutCmd = &cobra.Command{
+	Use:         "logout [flags]",
+	Short:       "Remove the bearer token for the current profile from the OS keyring",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"no-keyring": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := keyring.Delete(KeyringService, Profile); err != nil {
+			if errors.Is(err, keyring.ErrNotFound) {
+				return fmt.Errorf("no bearer token stored for profile %q", Profile)
+			}
+			return fmt.Errorf("cannot remove bearer token from OS keyring: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "bearer token removed for profile %q\n", Profile)
+		return nil
+	},
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(LoginSetupCLI, plugger.WithPlugin("login"))
+}
+
+// LoginSetupCLI adds the “login” and “logout” commands.
+func LoginSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(loginCmd)
+	cmd.AddCommand(logoutCmd)
+}
@@ -0,0 +1,62 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"github.com/siemens/csharg/cli"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// MaxBuffer optionally limits the in-flight buffering of capture streams in
+// octets; zero means no limit.
+var MaxBuffer int64
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(MaxBufferSetupCLI, plugger.WithPlugin("maxbuffer"))
+}
+
+// MaxBufferSetupCLI adds the global --max-buffer flag.
+func MaxBufferSetupCLI(cmd *cobra.Command) {
+	cmd.PersistentFlags().Var((*octetsValue)(&MaxBuffer), "max-buffer",
+		`Limit in-flight buffering of capture streams, such as "4MiB", for running in
+memory-constrained containers; see README for the behaviour when hitting the
+limit. Zero means no limit.`)
+}
+
+// BufferLimited returns the specified default buffer size, unless it exceeds
+// the --max-buffer limit, then returning the limit instead.
+func BufferLimited(size int64) int64 {
+	if MaxBuffer > 0 && size > MaxBuffer {
+		return MaxBuffer
+	}
+	return size
+}
+
+// octetsValue is a pflag.Value for sizes in octets with optional units.
+type octetsValue int64
+
+// String returns the number of octets in human-friendly form.
+func (o *octetsValue) String() string {
+	if *o == 0 {
+		return "0"
+	}
+	return HumanOctets(int64(*o))
+}
+
+// Set parses the number of octets with optional unit.
+func (o *octetsValue) Set(s string) error {
+	n, err := ParseOctets(s)
+	if err != nil {
+		return err
+	}
+	*o = octetsValue(n)
+	return nil
+}
+
+// Type returns the flag value type name.
+func (o *octetsValue) Type() string {
+	return "size"
+}
@@ -0,0 +1,68 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg merge" command for merging multiple pcapng capture
+// files into a single one.
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// mergeCmd defines the "csharg merge" command.
+var mergeCmd = &cobra.Command{
+	Use:   "merge [flags] FILE...",
+	Short: "Merge pcapng capture files",
+	Long: `Merges the packets from multiple pcapng capture files in timestamp order into a
+single pcapng capture file, similar to Wireshark's mergecap. The capture target
+meta data of the individual capture files is preserved, and the interfaces of
+the individual capture files are kept distinct, with their descriptions
+telling the capture targets they belong to.`,
+	Example: `# Merge the captures from a client and a server pod.
+csharg merge client.pcapng server.pcapng -w merged.pcapng`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{"no-keyring": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ins := make([]io.Reader, 0, len(args))
+		for _, filename := range args {
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			ins = append(ins, f)
+		}
+		wname, _ := cmd.Flags().GetString("write")
+		out, err := OpenSink(wname)
+		if err != nil {
+			return err
+		}
+		packets, err := pcapng.Merge(out, ins...)
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("cannot merge: %w", err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d packets merged from %d files\n", packets, len(args))
+		return out.Close()
+	},
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(MergeSetupCLI, plugger.WithPlugin("merge"))
+}
+
+// MergeSetupCLI adds the “merge” command.
+func MergeSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(mergeCmd)
+	mergeCmd.Flags().StringP("write", "w", "-",
+		"Write merged network packets to file or sink URL. Use \"-\" for stdout.")
+}
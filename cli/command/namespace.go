@@ -0,0 +1,25 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"os"
+
+	"github.com/siemens/csharg/api"
+)
+
+// NamespaceEnv names the environment variable optionally specifying the
+// namespace of pods named without an explicit namespace.
+const NamespaceEnv = "CSHARG_NAMESPACE"
+
+// DefaultNamespace returns the namespace of pods named without an explicit
+// namespace, as specified in $CSHARG_NAMESPACE, otherwise the “default”
+// namespace.
+func DefaultNamespace() string {
+	if namespace := os.Getenv(NamespaceEnv); namespace != "" {
+		return namespace
+	}
+	return api.DefaultNamespace
+}
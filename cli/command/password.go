@@ -0,0 +1,33 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readPassword reads a secret from the specified terminal without echoing,
+// showing the (optional) prompt on stderr.
+func readPassword(f *os.File, prompt string) (string, error) {
+	if prompt == "" {
+		prompt = "Secret: "
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(int(f.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(b))
+	if secret == "" {
+		return "", errors.New("empty secret")
+	}
+	return secret, nil
+}
@@ -5,24 +5,39 @@
 package command
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"io"
 	"strings"
 
 	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
 	"github.com/siemens/csharg/cli"
 	"github.com/thediveo/go-plugger/v3"
 )
 
+// TLSConfig optionally specifies the TLS client configuration contributed by
+// an AuthProvider, to be used by capture service clients.
+var TLSConfig *tls.Config
+
 // NewSharkTank returns a suitable packetflix capture service client by asking
 // the registered client factories one after another until the first one returns
 // a client or an error.
 func NewSharkTank() (csharg.SharkTank, error) {
+	if err := Authenticate(); err != nil {
+		return nil, err
+	}
 	for _, newClient := range plugger.Group[cli.NewClient]().Symbols() {
 		st, err := newClient()
 		if err != nil {
 			return nil, err
 		}
 		if st != nil {
+			if len(plugger.Group[cli.TargetTransformer]().Symbols()) != 0 {
+				st = &transformingSharkTank{SharkTank: st}
+			}
 			return st, nil
 		}
 	}
@@ -32,3 +47,184 @@ func NewSharkTank() (csharg.SharkTank, error) {
 	}
 	return nil, errors.New("no suitable capture API client; available clients: " + plugins)
 }
+
+// Authenticate asks the registered auth providers one after another for
+// credentials until the first one returns credentials or an error. The
+// credentials then update BearerToken and TLSConfig.
+func Authenticate() error {
+	TLSConfig = nil
+	for _, provider := range plugger.Group[cli.AuthProvider]().Symbols() {
+		creds, err := provider(BearerToken)
+		if err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+		if creds == nil {
+			continue
+		}
+		if creds.BearerToken != "" {
+			BearerToken = creds.BearerToken
+		}
+		TLSConfig = creds.TLSConfig
+		break
+	}
+	return nil
+}
+
+// transformingSharkTank applies the registered target transformers to the
+// capture targets discovered by the wrapped capture service client. Capturing
+// from and probing capture targets is restricted to the transformed capture
+// targets, so that capture targets hidden by a transformer cannot be captured
+// from by name either.
+type transformingSharkTank struct {
+	csharg.SharkTank
+}
+
+// Targets returns the discovered and then transformed capture targets.
+func (st *transformingSharkTank) Targets() api.Targets {
+	return transformTargets(st.SharkTank.Targets())
+}
+
+// TargetsContext returns the discovered and then transformed capture targets,
+// unless the context is done before the discovery completes.
+func (st *transformingSharkTank) TargetsContext(ctx context.Context) (api.Targets, error) {
+	targets, err := st.SharkTank.TargetsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return transformTargets(targets), nil
+}
+
+// CapturePod captures from the named pod, if it is among the transformed
+// capture targets.
+func (st *transformingSharkTank) CapturePod(w io.Writer, podname string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	return st.CapturePodContext(context.Background(), w, podname, opts)
+}
+
+// CapturePodContext captures from the named pod like CapturePod, stopping the
+// capture when the context is done.
+func (st *transformingSharkTank) CapturePodContext(ctx context.Context, w io.Writer, podname string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	namespace, name, err := api.ParsePodName(podname)
+	if err != nil {
+		return nil, err
+	}
+	return st.CaptureContext(ctx, w, &api.Target{Name: name, Namespace: namespace, Type: api.TypePod}, opts)
+}
+
+// CaptureContainer captures from the named container on the specified node,
+// if it is among the transformed capture targets. Instead of its name, the
+// container can also be specified by its (truncated) container or sandbox ID.
+func (st *transformingSharkTank) CaptureContainer(w io.Writer, nodename, name string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	return st.CaptureContainerContext(context.Background(), w, nodename, name, opts)
+}
+
+// CaptureContainerContext captures from the named container like
+// CaptureContainer, stopping the capture when the context is done.
+func (st *transformingSharkTank) CaptureContainerContext(ctx context.Context, w io.Writer, nodename, name string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	targets, err := st.TargetsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var cache csharg.TargetCache
+	cache.Set(targets)
+	if t, ok := cache.OnNode(nodename, "", name); ok {
+		return st.SharkTank.CaptureContext(ctx, w, t.Clone(), opts)
+	}
+	switch ts := cache.MatchID(nodename, name); len(ts) {
+	case 0:
+		return st.CaptureContext(ctx, w, &api.Target{Name: name, NodeName: nodename}, opts)
+	case 1:
+		return st.SharkTank.CaptureContext(ctx, w, ts[0].Clone(), opts)
+	default:
+		return nil, fmt.Errorf("%w: container ID %q matches %d capture targets",
+			csharg.ErrAmbiguousTarget, name, len(ts))
+	}
+}
+
+// Capture captures from the specified capture target, if it is among the
+// transformed capture targets.
+func (st *transformingSharkTank) Capture(w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	return st.CaptureContext(context.Background(), w, t, opts)
+}
+
+// CaptureContext captures from the specified capture target like Capture,
+// stopping the capture when the context is done.
+func (st *transformingSharkTank) CaptureContext(ctx context.Context, w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	if err := st.check(ctx, t); err != nil {
+		return nil, err
+	}
+	return st.SharkTank.CaptureContext(ctx, w, t, opts)
+}
+
+// CaptureMany captures from the specified capture targets at the same time,
+// if they all are among the transformed capture targets.
+func (st *transformingSharkTank) CaptureMany(w io.Writer, targets []*api.Target, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	for _, t := range targets {
+		if err := st.check(context.Background(), t); err != nil {
+			return nil, err
+		}
+	}
+	return st.SharkTank.CaptureMany(w, targets, opts)
+}
+
+// CaptureReader captures from the specified capture target, if it is among the
+// transformed capture targets, returning a reader delivering the packet
+// capture stream.
+func (st *transformingSharkTank) CaptureReader(t *api.Target, opts *csharg.CaptureOptions) (io.ReadCloser, error) {
+	if err := st.check(context.Background(), t); err != nil {
+		return nil, err
+	}
+	return st.SharkTank.CaptureReader(t, opts)
+}
+
+// Prepare prepares capturing from the specified capture target, if it is
+// among the transformed capture targets.
+func (st *transformingSharkTank) Prepare(w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.PreparedCapture, error) {
+	return st.PrepareContext(context.Background(), w, t, opts)
+}
+
+// PrepareContext prepares capturing from the specified capture target like
+// Prepare, stopping the capture when the context is done.
+func (st *transformingSharkTank) PrepareContext(ctx context.Context, w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.PreparedCapture, error) {
+	if err := st.check(ctx, t); err != nil {
+		return nil, err
+	}
+	return st.SharkTank.PrepareContext(ctx, w, t, opts)
+}
+
+// CanCapture checks that the specified capture target is among the
+// transformed capture targets, and that it can be captured from.
+func (st *transformingSharkTank) CanCapture(t *api.Target) error {
+	if err := st.check(context.Background(), t); err != nil {
+		return err
+	}
+	return st.SharkTank.CanCapture(t)
+}
+
+// check returns an error wrapping csharg.ErrTargetNotFound if the specified
+// capture target is not among the transformed capture targets.
+func (st *transformingSharkTank) check(ctx context.Context, t *api.Target) error {
+	if t == nil {
+		return errors.New("no capture target specified")
+	}
+	targets, err := st.TargetsContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if target.QualifiedName() == t.QualifiedName() && target.Prefix == t.Prefix &&
+			(t.NodeName == "" || target.NodeName == t.NodeName) &&
+			(t.Type == "" || target.Type == t.Type) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %s", csharg.ErrTargetNotFound, t)
+}
+
+// transformTargets applies the registered target transformers to the capture
+// targets.
+func transformTargets(targets api.Targets) api.Targets {
+	for _, transform := range plugger.Group[cli.TargetTransformer]().Symbols() {
+		targets = transform(targets)
+	}
+	return targets
+}
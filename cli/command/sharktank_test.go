@@ -0,0 +1,80 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"bytes"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/csargtest"
+	"github.com/thediveo/go-plugger/v3"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// hideSystemPods enables the test target transformer hiding the pods in the
+// "kube-system" namespace.
+var hideSystemPods bool
+
+func init() {
+	plugger.Group[cli.TargetTransformer]().Register(func(targets api.Targets) api.Targets {
+		if !hideSystemPods {
+			return targets
+		}
+		visible := api.Targets{}
+		for _, t := range targets {
+			if t.Namespace != "kube-system" {
+				visible = append(visible, t)
+			}
+		}
+		return visible
+	}, plugger.WithPlugin("test-hide-system-pods"))
+}
+
+var _ = Describe("transformed capture targets", func() {
+
+	web := &api.Target{Name: "web", Namespace: "default", Type: api.TypePod,
+		NetworkInterfaces: []string{"eth0"}}
+	dns := &api.Target{Name: "coredns", Namespace: "kube-system", Type: api.TypePod,
+		NodeName: "node-1", ContainerID: "c0ffee", NetworkInterfaces: []string{"eth0"}}
+
+	var st csharg.SharkTank
+
+	BeforeEach(func() {
+		hideSystemPods = true
+		DeferCleanup(func() { hideSystemPods = false })
+		st = &transformingSharkTank{SharkTank: csargtest.New(web, dns)}
+		DeferCleanup(st.Close)
+	})
+
+	It("lists only the transformed capture targets", func() {
+		Expect(st.Targets()).To(ConsistOf(web))
+	})
+
+	It("captures from transformed capture targets", func() {
+		cs, err := st.CapturePod(&bytes.Buffer{}, "web", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		Expect(st.CanCapture(web)).To(Succeed())
+	})
+
+	It("refuses to capture from hidden capture targets", func() {
+		Expect(st.CapturePod(&bytes.Buffer{}, "kube-system/coredns", nil)).Error().To(
+			MatchError(csharg.ErrTargetNotFound))
+		Expect(st.CaptureContainer(&bytes.Buffer{}, "node-1", "c0ff", nil)).Error().To(
+			MatchError(csharg.ErrTargetNotFound))
+		Expect(st.Capture(&bytes.Buffer{}, dns, nil)).Error().To(
+			MatchError(csharg.ErrTargetNotFound))
+		Expect(st.CaptureMany(&bytes.Buffer{}, []*api.Target{web, dns}, nil)).Error().To(
+			MatchError(csharg.ErrTargetNotFound))
+		Expect(st.Prepare(&bytes.Buffer{}, dns, nil)).Error().To(
+			MatchError(csharg.ErrTargetNotFound))
+		Expect(st.CanCapture(dns)).To(MatchError(csharg.ErrTargetNotFound))
+	})
+
+})
@@ -0,0 +1,21 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !windows
+
+package command
+
+import (
+	"os"
+	"syscall"
+)
+
+// ShutdownSignals lists the signals that request csharg to cleanly finish,
+// such as captures. On Unix, these are SIGINT (^C), SIGTERM, and SIGHUP when
+// the controlling terminal goes away.
+var ShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// SnapshotSignals lists the signals that request snapshots, such as of the
+// ring buffer sink. On Unix, this is SIGUSR1.
+var SnapshotSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,23 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+
+package command
+
+import (
+	"os"
+	"syscall"
+)
+
+// ShutdownSignals lists the signals that request csharg to cleanly finish,
+// such as captures. On Windows, os.Interrupt covers CTRL_C_EVENT and
+// CTRL_BREAK_EVENT, while syscall.SIGTERM covers CTRL_CLOSE_EVENT when the
+// console window gets closed, as well as CTRL_LOGOFF_EVENT and
+// CTRL_SHUTDOWN_EVENT.
+var ShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// SnapshotSignals lists the signals that request snapshots, such as of the
+// ring buffer sink. As Windows lacks user-defined signals, there are none.
+var SnapshotSignals []os.Signal
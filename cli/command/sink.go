@@ -0,0 +1,66 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// OpenSink returns an output sink for writing a packet capture stream to the
+// specified destination. The destination "-" denotes stdout. Otherwise, the
+// registered sink factories get asked one after another until the first one
+// returns a sink or an error. If no sink factory is responsible, then the
+// destination is taken as the name of a file to create, unless it is a URL
+// with an unsupported scheme. Closing a stdout sink doesn't close stdout.
+func OpenSink(dest string) (io.WriteCloser, error) {
+	if dest == "-" {
+		return stdoutSink{os.Stdout}, nil
+	}
+	for _, newSink := range plugger.Group[cli.NewSink]().Symbols() {
+		sink, err := newSink(dest)
+		if err != nil {
+			return nil, err
+		}
+		if sink != nil {
+			return sink, nil
+		}
+	}
+	if scheme, path, ok := strings.Cut(dest, "://"); ok {
+		if scheme != "file" {
+			sinks := append([]string{"file"}, plugger.Group[cli.NewSink]().Plugins()...)
+			return nil, fmt.Errorf("unsupported output sink %q; available sinks: %s",
+				scheme, strings.Join(sinks, ", "))
+		}
+		dest = path
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create packet capture file: %w", err)
+	}
+	return f, nil
+}
+
+// nopCloser wraps a writer with a no-op Close method.
+type nopCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopCloser) Close() error { return nil }
+
+// stdoutSink wraps stdout with a no-op Close method, keeping stdout seekable
+// when redirected into a file.
+type stdoutSink struct {
+	*os.File
+}
+
+// Close does nothing.
+func (stdoutSink) Close() error { return nil }
@@ -0,0 +1,116 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg slice" command for extracting a time range from an
+// existing pcapng capture file.
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// sliceCmd defines the "csharg slice" command.
+var sliceCmd = &cobra.Command{
+	Use:   "slice [flags] IN-FILE OUT-FILE",
+	Short: "Extract a time range from a pcapng capture file",
+	Long: `Extracts the packets within a time range from a pcapng capture file, preserving
+the csharg capture target meta data. The start and end of the time range can be
+specified as:
+  - RFC3339 timestamps, such as "2023-06-01T12:34:56Z" or "2023-06-01T12:34:56.789+02:00",
+  - date and time in local time, such as "2023-06-01 12:34:56",
+  - time of day in local time on the day of the first packet, such as "12:34:56",
+  - offsets relative to the first packet, such as "+5m" or "+1h30m".`,
+	Example: `# Extract the interesting minute from an hours-long capture.
+csharg slice --from 12:34:00 --to 12:35:00 long.pcapng minute.pcapng
+
+# Extract the first ten minutes.
+csharg slice --to +10m long.pcapng start.pcapng`,
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{"no-keyring": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fromflag, _ := cmd.Flags().GetString("from")
+		toflag, _ := cmd.Flags().GetString("to")
+		in, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		first, err := pcapng.FirstPacketTime(in)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", args[0], err)
+		}
+		from, err := parseSliceTime(fromflag, first)
+		if err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+		to, err := parseSliceTime(toflag, first)
+		if err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+		if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+			return fmt.Errorf("empty time range from %s to %s", from, to)
+		}
+		if _, err := in.Seek(0, 0); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+		if err != nil {
+			return fmt.Errorf("cannot create packet capture file: %w", err)
+		}
+		defer out.Close()
+		packets, err := pcapng.Slice(out, in, from, to)
+		if err != nil {
+			return fmt.Errorf("cannot slice %s: %w", args[0], err)
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "%d packets written to %s\n", packets, args[1])
+		return out.Close()
+	},
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(SliceSetupCLI, plugger.WithPlugin("slice"))
+}
+
+// SliceSetupCLI adds the “slice” command.
+func SliceSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(sliceCmd)
+	sliceCmd.Flags().String("from", "", "Start of the time range (inclusive); defaults to the first packet")
+	sliceCmd.Flags().String("to", "", "End of the time range (exclusive); defaults to after the last packet")
+}
+
+// parseSliceTime parses a point in time, which might be relative to the
+// specified start time.
+func parseSliceTime(s string, start time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasPrefix(s, "+") {
+		d, err := time.ParseDuration(s[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return start.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("15:04:05.999999999", s, time.Local); err == nil {
+		day := start.In(time.Local)
+		return time.Date(day.Year(), day.Month(), day.Day(),
+			t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local), nil
+	}
+	return time.Time{}, fmt.Errorf("unsupported time %q", s)
+}
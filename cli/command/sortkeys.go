@@ -0,0 +1,194 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fvbommel/sortorder"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// sortKey is a single key of a “--sort-by” specification: a JSONPath
+// expression, optionally prefixed by “-” to sort in descending order.
+type sortKey struct {
+	expr *jsonpath.JSONPath
+	desc bool
+}
+
+// parseSortKeys parses a “--sort-by” specification consisting of one or more
+// comma-separated sort keys, such as “{.NodeName},-{.Name}”. Commas inside
+// the braces of JSONPath expressions don't separate sort keys.
+func parseSortKeys(spec string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, field := range splitSortKeys(spec) {
+		field = strings.TrimSpace(field)
+		key := sortKey{}
+		if strings.HasPrefix(field, "-") {
+			key.desc = true
+			field = field[1:]
+		} else if strings.HasPrefix(field, "+") {
+			field = field[1:]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("empty sort key in %q", spec)
+		}
+		key.expr = jsonpath.New("sort").AllowMissingKeys(true)
+		if err := key.expr.Parse(field); err != nil {
+			return nil, fmt.Errorf("invalid sort key %q: %w", field, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no sort keys")
+	}
+	return keys, nil
+}
+
+// splitSortKeys splits a “--sort-by” specification at the commas outside of
+// braces and quotes.
+func splitSortKeys(spec string) []string {
+	var fields []string
+	depth := 0
+	var quote rune
+	start := 0
+	for idx, r := range spec {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '{':
+			depth++
+		case r == '}':
+			if depth > 0 {
+				depth--
+			}
+		case r == ',' && depth == 0:
+			fields = append(fields, spec[start:idx])
+			start = idx + 1
+		}
+	}
+	return append(fields, spec[start:])
+}
+
+// sortRows stably sorts the list rows by the specified sort keys, comparing
+// the rows by their first key, then by their second key, and so on.
+func sortRows(rows []*listRow, keys []sortKey) error {
+	type keyedRow struct {
+		row  *listRow
+		keys []reflect.Value
+	}
+	keyed := make([]keyedRow, len(rows))
+	for idx, row := range rows {
+		keyed[idx].row = row
+		for _, key := range keys {
+			value, err := sortValue(key.expr, row)
+			if err != nil {
+				return err
+			}
+			keyed[idx].keys = append(keyed[idx].keys, value)
+		}
+	}
+	sort.SliceStable(keyed, func(a, b int) bool {
+		for idx, key := range keys {
+			cmp := compareValues(keyed[a].keys[idx], keyed[b].keys[idx])
+			if cmp == 0 {
+				continue
+			}
+			if key.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+	for idx := range keyed {
+		rows[idx] = keyed[idx].row
+	}
+	return nil
+}
+
+// sortValue evaluates the JSONPath sort expression for the specified row:
+// missing values sort as “<none>”, and multiple values as their concatenated
+// string representations.
+func sortValue(expr *jsonpath.JSONPath, row *listRow) (reflect.Value, error) {
+	results, err := expr.FindResults(row)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if len(results) == 0 || len(results[0]) == 0 {
+		return reflect.ValueOf("<none>"), nil
+	}
+	if len(results) == 1 && len(results[0]) == 1 {
+		return results[0][0], nil
+	}
+	var s strings.Builder
+	for _, result := range results {
+		for _, value := range result {
+			fmt.Fprint(&s, value.Interface())
+		}
+	}
+	return reflect.ValueOf(s.String()), nil
+}
+
+// compareValues returns -1, 0, or +1 when a is less than, equal to, or greater
+// than b. Numbers compare numerically and strings in natural order; other
+// values compare by their string representations.
+func compareValues(a, b reflect.Value) int {
+	for a.Kind() == reflect.Ptr || a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Ptr || b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+	if af, ok := number(a); ok {
+		if bf, ok := number(b); ok {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+			return 0
+		}
+	}
+	as, bs := fmt.Sprint(valueInterface(a)), fmt.Sprint(valueInterface(b))
+	switch {
+	case as == bs:
+		return 0
+	case sortorder.NaturalLess(as, bs):
+		return -1
+	}
+	return 1
+}
+
+// number returns the numeric value of v, if v is a number.
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// valueInterface returns the value of v as an interface, or nil for invalid
+// values.
+func valueInterface(v reflect.Value) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
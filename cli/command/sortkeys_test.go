@@ -0,0 +1,88 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"reflect"
+
+	"github.com/siemens/csharg/api"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sort keys", func() {
+
+	DescribeTable("splits sort key specifications",
+		func(spec string, fields []string) {
+			Expect(splitSortKeys(spec)).To(Equal(fields))
+		},
+		Entry("single key", "{.Name}", []string{"{.Name}"}),
+		Entry("comma-separated keys", "{.NodeName},-{.Name}", []string{"{.NodeName}", "-{.Name}"}),
+		Entry("commas inside braces", "{.NetworkInterfaces[0,1]},{.Name}",
+			[]string{"{.NetworkInterfaces[0,1]}", "{.Name}"}),
+		Entry("nested braces", "{range .NetworkInterfaces}{@},{end},{.Name}",
+			[]string{"{range .NetworkInterfaces}{@}", "{end}", "{.Name}"}),
+		Entry("commas inside quotes", `{.Name},'a,b'`, []string{"{.Name}", `'a,b'`}),
+		Entry("empty keys", "{.Name},", []string{"{.Name}", ""}),
+	)
+
+	DescribeTable("parses ascending and descending sort keys",
+		func(spec string, desc []bool) {
+			keys, err := parseSortKeys(spec)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keys).To(HaveLen(len(desc)))
+			for idx, key := range keys {
+				Expect(key.desc).To(Equal(desc[idx]), "sort key %d", idx)
+			}
+		},
+		Entry("ascending", "{.Name}", []bool{false}),
+		Entry("descending", "-{.Name}", []bool{true}),
+		Entry("explicitly ascending", "+{.Name}", []bool{false}),
+		Entry("mixed", " {.NodeName} , -{.Name},+{.Type}", []bool{false, true, false}),
+	)
+
+	DescribeTable("rejects invalid sort keys",
+		func(spec string, expected string) {
+			Expect(parseSortKeys(spec)).Error().To(MatchError(ContainSubstring(expected)))
+		},
+		Entry("empty key", "{.Name},-", "empty sort key"),
+		Entry("blank key", "{.Name}, ", "empty sort key"),
+		Entry("unbalanced braces", "{.Name", "invalid sort key"),
+	)
+
+	DescribeTable("compares values",
+		func(a, b interface{}, expected int) {
+			Expect(compareValues(reflect.ValueOf(a), reflect.ValueOf(b))).To(Equal(expected))
+			Expect(compareValues(reflect.ValueOf(b), reflect.ValueOf(a))).To(Equal(-expected))
+		},
+		Entry("equal numbers", 42, 42, 0),
+		Entry("numbers numerically", 9, 10, -1),
+		Entry("mixed numeric types", int32(9), 10.5, -1),
+		Entry("unsigned and signed", uint64(2), int64(-1), 1),
+		Entry("strings in natural order", "eth9", "eth10", -1),
+		Entry("equal strings", "foo", "foo", 0),
+		Entry("numbers and strings in natural order of representation", 10, "9", 1),
+		Entry("numeric and non-numeric strings", 10, "eth0", -1),
+		Entry("pointers by their values", func() *int { v := 9; return &v }(), 10, -1),
+	)
+
+	It("sorts rows by multiple keys", func() {
+		row := func(node, name string) *listRow {
+			t := &api.Target{Name: name, NodeName: node}
+			return &listRow{OriginTarget: &OriginTarget{Target: t}, QualifiedName: name}
+		}
+		rows := []*listRow{row("n1", "a"), row("n2", "b"), row("n1", "b"), row("n2", "a")}
+		keys, err := parseSortKeys("{.NodeName},-{.QualifiedName}")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sortRows(rows, keys)).To(Succeed())
+		var order []string
+		for _, r := range rows {
+			order = append(order, r.NodeName+"/"+r.QualifiedName)
+		}
+		Expect(order).To(HaveExactElements("n1/b", "n1/a", "n2/b", "n2/a"))
+	})
+
+})
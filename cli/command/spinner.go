@@ -0,0 +1,52 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// spinnerFrames are the individual animation frames of our spinner.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spin shows an animated spinner with the specified message on stderr while
+// the function fn runs. The spinner is only shown when stderr is a terminal,
+// otherwise fn is simply run.
+func Spin(msg string, fn func()) {
+	if !IsTerminal(os.Stderr) {
+		fn()
+		return
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			spinner := spinnerFrames[frame%len(spinnerFrames)]
+			if ColorEnabled(os.Stderr) {
+				spinner = Colorize(spinner, ColorCyan)
+			}
+			fmt.Fprintf(os.Stderr, "\r%s %s", spinner, msg)
+			select {
+			case <-done:
+				// Erase the spinner line.
+				fmt.Fprint(os.Stderr, "\r\x1b[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	fn()
+}
@@ -0,0 +1,267 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Provides the "csharg stats" command for quickly triaging existing pcapng
+// capture files without a full Wireshark round-trip.
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/packet"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// statsCmd defines the "csharg stats" command.
+var statsCmd = &cobra.Command{
+	Use:   "stats [flags] FILE...",
+	Short: "Show statistics of pcapng capture files",
+	Long: `Shows the capture duration, packet and byte counts per interface, the top
+talkers, as well as the protocol breakdown of pcapng capture files.`,
+	Example: `# Quickly triage a capture file.
+csharg stats capture.pcapng`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{"no-keyring": "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		top, _ := cmd.Flags().GetInt("top")
+		for idx, filename := range args {
+			if idx > 0 {
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+			stats, err := fileStats(filename)
+			if err != nil {
+				return err
+			}
+			stats.Fprint(cmd.OutOrStdout(), filename, top)
+		}
+		return nil
+	},
+}
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(StatsSetupCLI, plugger.WithPlugin("stats"))
+}
+
+// StatsSetupCLI adds the “stats” command.
+func StatsSetupCLI(cmd *cobra.Command) {
+	cmd.AddCommand(statsCmd)
+	statsCmd.Flags().Int("top", 10, "Number of top talkers to show")
+}
+
+// captureStats are the statistics gathered from a pcapng capture file.
+type captureStats struct {
+	Targets    []*pcapng.ContainerInfo
+	First      time.Time
+	Last       time.Time
+	Packets    int64
+	Octets     int64
+	Interfaces []*interfaceStats
+	Talkers    map[netip.Addr]*counters
+	Protocols  map[string]*counters
+}
+
+// interfaceStats are the statistics of a single interface.
+type interfaceStats struct {
+	Name     string
+	LinkType uint16
+	counters
+	Dropped *uint64
+}
+
+// counters count packets and octets.
+type counters struct {
+	Packets int64
+	Octets  int64
+}
+
+func (c *counters) add(octets int) {
+	c.Packets++
+	c.Octets += int64(octets)
+}
+
+// fileStats reads the specified pcapng file and returns its statistics.
+func fileStats(filename string) (*captureStats, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stats := &captureStats{
+		Talkers:   map[netip.Addr]*counters{},
+		Protocols: map[string]*counters{},
+	}
+	r := pcapng.NewReader(f)
+	// Interface IDs are per section, so we need to map them onto our overall
+	// list of interfaces.
+	var sectionIfs []*interfaceStats
+	for {
+		b, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", filename, err)
+		}
+		switch b.Type {
+		case pcapng.BlockSHB:
+			sectionIfs = nil
+			cis, _ := pcapng.ParseContainerInfos(r.SectionHeader().Comment())
+			stats.Targets = append(stats.Targets, cis...)
+		case pcapng.BlockIDB:
+			idb := r.Interface(uint32(len(r.Interfaces()) - 1))
+			ifstats := &interfaceStats{Name: idb.Name(), LinkType: idb.LinkType}
+			if ifstats.Name == "" {
+				ifstats.Name = fmt.Sprintf("#%d", len(stats.Interfaces))
+			}
+			sectionIfs = append(sectionIfs, ifstats)
+			stats.Interfaces = append(stats.Interfaces, ifstats)
+		case pcapng.BlockISB:
+			isb, err := b.InterfaceStatistics()
+			if err != nil || int(isb.InterfaceID) >= len(sectionIfs) {
+				continue
+			}
+			if dropped, ok := isb.Counter(pcapng.OptISBIfDrop, b.Endian); ok {
+				sectionIfs[isb.InterfaceID].Dropped = &dropped
+			}
+		case pcapng.BlockEPB:
+			epb, err := b.EnhancedPacket()
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %s: %w", filename, err)
+			}
+			idb := r.Interface(epb.InterfaceID)
+			if idb == nil {
+				return nil, fmt.Errorf("cannot read %s: packet references unknown interface %d",
+					filename, epb.InterfaceID)
+			}
+			ts := idb.Time(epb.Timestamp)
+			if stats.First.IsZero() || ts.Before(stats.First) {
+				stats.First = ts
+			}
+			if ts.After(stats.Last) {
+				stats.Last = ts
+			}
+			octets := int(epb.OriginalLength)
+			stats.Packets++
+			stats.Octets += int64(octets)
+			sectionIfs[epb.InterfaceID].add(octets)
+			summary, ok := packet.Decode(idb.LinkType, epb.Data)
+			proto := "other"
+			if ok {
+				proto = summary.Transport()
+			}
+			stats.count(stats.Protocols, proto, octets)
+			if summary.Src.IsValid() {
+				stats.talk(summary.Src, octets)
+				stats.talk(summary.Dst, octets)
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (s *captureStats) count(m map[string]*counters, key string, octets int) {
+	c, ok := m[key]
+	if !ok {
+		c = &counters{}
+		m[key] = c
+	}
+	c.add(octets)
+}
+
+func (s *captureStats) talk(addr netip.Addr, octets int) {
+	c, ok := s.Talkers[addr]
+	if !ok {
+		c = &counters{}
+		s.Talkers[addr] = c
+	}
+	c.add(octets)
+}
+
+// Fprint prints the statistics in human-readable form.
+func (s *captureStats) Fprint(w io.Writer, filename string, top int) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "File:\t%s\n", filename)
+	for _, target := range s.Targets {
+		fmt.Fprintf(tw, "Target:\t%s (%s) on %q\n",
+			target.ContainerName, target.ContainerType, target.NodeName)
+		if target.ContainerID != "" {
+			fmt.Fprintf(tw, "Container ID:\t%s\n", target.ContainerID)
+		}
+		if target.CaptureFilter != "" {
+			fmt.Fprintf(tw, "Filter:\t%s\n", target.CaptureFilter)
+		}
+	}
+	if s.Packets > 0 {
+		fmt.Fprintf(tw, "Duration:\t%s (%s – %s)\n",
+			s.Last.Sub(s.First), s.First.Format(time.RFC3339Nano), s.Last.Format(time.RFC3339Nano))
+	}
+	fmt.Fprintf(tw, "Packets:\t%d\n", s.Packets)
+	fmt.Fprintf(tw, "Bytes:\t%d (%s)\n", s.Octets, HumanOctets(s.Octets))
+
+	fmt.Fprintln(tw, "\nINTERFACE\tLINKTYPE\tPACKETS\tBYTES\tDROPPED")
+	for _, ifstats := range s.Interfaces {
+		dropped := "-"
+		if ifstats.Dropped != nil {
+			dropped = fmt.Sprintf("%d", *ifstats.Dropped)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n",
+			ifstats.Name, ifstats.LinkType, ifstats.Packets, HumanOctets(ifstats.Octets), dropped)
+	}
+
+	if top > 0 && len(s.Talkers) > 0 {
+		addrs := make([]netip.Addr, 0, len(s.Talkers))
+		for addr := range s.Talkers {
+			addrs = append(addrs, addr)
+		}
+		sort.Slice(addrs, func(i, j int) bool {
+			ci, cj := s.Talkers[addrs[i]], s.Talkers[addrs[j]]
+			if ci.Octets != cj.Octets {
+				return ci.Octets > cj.Octets
+			}
+			return addrs[i].Less(addrs[j])
+		})
+		if len(addrs) > top {
+			addrs = addrs[:top]
+		}
+		fmt.Fprintln(tw, "\nTOP TALKER\tPACKETS\tBYTES")
+		for _, addr := range addrs {
+			c := s.Talkers[addr]
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", addr, c.Packets, HumanOctets(c.Octets))
+		}
+	}
+
+	if len(s.Protocols) > 0 {
+		protos := make([]string, 0, len(s.Protocols))
+		for proto := range s.Protocols {
+			protos = append(protos, proto)
+		}
+		sort.Slice(protos, func(i, j int) bool {
+			ci, cj := s.Protocols[protos[i]], s.Protocols[protos[j]]
+			if ci.Octets != cj.Octets {
+				return ci.Octets > cj.Octets
+			}
+			return protos[i] < protos[j]
+		})
+		fmt.Fprintln(tw, "\nPROTOCOL\tPACKETS\tBYTES\tSHARE")
+		for _, proto := range protos {
+			c := s.Protocols[proto]
+			share := 0.0
+			if s.Octets > 0 {
+				share = 100 * float64(c.Octets) / float64(s.Octets)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f%%\n", proto, c.Packets, HumanOctets(c.Octets), share)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/siemens/csharg/cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringService is the service name under which csharg stores bearer tokens
+// in the OS keyring; the individual tokens are then stored per profile.
+const KeyringService = "csharg"
+
+// DefaultProfile is the name of the profile used when no profile has been
+// specified, neither via “--profile” nor the CSHARG_PROFILE environment
+// variable.
+const DefaultProfile = "default"
+
+// Profile specifies the name of the profile to use, such as for looking up
+// stored credentials.
+var Profile string
+
+// tokenStdin requests reading the bearer token from stdin.
+var tokenStdin bool
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(TokenSetupCLI, plugger.WithPlugin("token"))
+	plugger.Group[cli.BeforeCommand]().Register(TokenBeforeCommand, plugger.WithPlugin("token"))
+}
+
+// TokenSetupCLI registers the “--token-stdin” and “--profile” CLI flags.
+func TokenSetupCLI(cmd *cobra.Command) {
+	pf := cmd.PersistentFlags()
+	pf.BoolVar(&tokenStdin, "token-stdin", false,
+		"Read the bearer token for authentication from stdin")
+	Annotate(pf, "token-stdin", MutualFlagGroupAnnotation, "token")
+	Annotate(pf, "token", MutualFlagGroupAnnotation, "token")
+	profile := os.Getenv("CSHARG_PROFILE")
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	pf.StringVar(&Profile, "profile", profile,
+		"Name of the profile to use, such as for stored credentials (defaults to $CSHARG_PROFILE, if set)")
+}
+
+// TokenBeforeCommand determines the bearer token to use, unless explicitly
+// specified using “--token”: either reading the token from stdin when
+// requested using “--token-stdin”, or otherwise looking up a token stored in
+// the OS keyring for the current profile, unless using basic authentication.
+func TokenBeforeCommand(cmd *cobra.Command) error {
+	if tokenStdin {
+		token, err := ReadSecret(os.Stdin, "")
+		if err != nil {
+			return fmt.Errorf("cannot read bearer token from stdin: %w", err)
+		}
+		BearerToken = token
+		return nil
+	}
+	if BearerToken != "" || Username != "" || cmd.Annotations["no-keyring"] != "" {
+		return nil
+	}
+	BearerToken = KeyringToken(Profile)
+	return nil
+}
+
+// KeyringToken returns the bearer token stored in the OS keyring for the
+// specified profile, or "" if there is none.
+func KeyringToken(profile string) string {
+	token, err := keyring.Get(KeyringService, profile)
+	if err != nil {
+		if !errors.Is(err, keyring.ErrNotFound) {
+			log.Debugf("cannot query OS keyring for profile %q: %s", profile, err.Error())
+		}
+		return ""
+	}
+	log.Debugf("using bearer token stored in OS keyring for profile %q", profile)
+	return token
+}
+
+// ReadSecret reads a single line containing a secret, such as a bearer token,
+// from the specified reader, trimming any leading and trailing whitespace. If
+// the reader is a terminal, then the prompt is shown on stderr and the secret
+// is read without echoing it.
+func ReadSecret(r io.Reader, prompt string) (string, error) {
+	if f, ok := r.(*os.File); ok && IsTerminal(f) {
+		return readPassword(f, prompt)
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return "", errors.New("empty secret")
+	}
+	return secret, nil
+}
@@ -0,0 +1,44 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package command
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("bearer tokens", func() {
+
+	BeforeEach(func() {
+		keyring.MockInit()
+		Expect(keyring.Set(KeyringService, DefaultProfile, "t0k3n")).To(Succeed())
+		oldToken, oldProfile, oldUsername := BearerToken, Profile, Username
+		DeferCleanup(func() {
+			BearerToken, Profile, Username = oldToken, oldProfile, oldUsername
+		})
+		BearerToken, Profile, Username = "", DefaultProfile, ""
+	})
+
+	It("looks up the token for commands talking to capture services", func() {
+		Expect(TokenBeforeCommand(listCmd)).To(Succeed())
+		Expect(BearerToken).To(Equal("t0k3n"))
+	})
+
+	DescribeTable("doesn't query the keyring for offline commands",
+		func(cmd *cobra.Command) {
+			Expect(TokenBeforeCommand(cmd)).To(Succeed())
+			Expect(BearerToken).To(BeEmpty())
+		},
+		Entry("stats", statsCmd),
+		Entry("slice", sliceCmd),
+		Entry("merge", mergeCmd),
+		Entry("anonymize", anonymizeCmd),
+		Entry("check-filter", checkFilterCmd),
+	)
+
+})
@@ -10,14 +10,27 @@ this general order):
 
   - [SetupCLI]: for adding (sub) commands and CLI args to the (in [cobra]
     parlance) “root” command.
-  - [CommandExamples]: for adding (more) examples to particular commands, namely
-    the “list” and “capture” commands. These plugin functions are invoked after
-    all [SetupCLI] plugins have been called, so that all commands have been
-    registered by the time the examples should be extended with even more
-    examples.
+  - [CommandExamples]: for adding (more) examples to particular commands,
+    addressed by their command paths, such as “list” or “capture pod”. These
+    plugin functions are invoked after all [SetupCLI] plugins have been called,
+    so that all commands have been registered by the time the examples should
+    be extended with even more examples.
+  - [ConfigSection]: for reading plugin-specific sections of the configuration
+    file, including per-profile settings.
   - [BeforeCommand]: for checking and doing things just before the command runs.
+  - [AuthProvider]: for contributing authentication methods producing the
+    bearer token and TLS configuration used by the capture service clients.
   - [NewClient]: for creating a suitable capture service client, depending on
     CLI args.
+  - [TargetTransformer]: for filtering or enriching the capture targets
+    discovered by capture service clients.
+  - [BeforeCapture]: for enforcing capture policies by vetoing or modifying
+    the capture options just before a capture starts.
+  - [ListPrinter]: for providing additional “-o” output formats of the “list”
+    command.
+  - [NewSink]: for creating a suitable output sink for packet capture streams,
+    depending on the URL scheme of the “-w” CLI arg. Plain files remain the
+    default when no sink factory is responsible.
 
 Simply put, the plugin mechanism used in csharg is compile-time only and allows
 so-called plugins to register functions (and interface implementations) in what
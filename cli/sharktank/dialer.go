@@ -0,0 +1,42 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sharktank
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/siemens/csharg"
+)
+
+// DialTimeout optionally limits the time for establishing network connections
+// to the capture service.
+var DialTimeout time.Duration
+
+// KeepAlive specifies the TCP keep-alive interval for connections to the
+// capture service.
+var KeepAlive time.Duration
+
+// IPFamily optionally restricts connections to the capture service to either
+// IPv4 or IPv6.
+var IPFamily string
+
+// MaxDials optionally bounds the number of connections to the capture service
+// being established at the same time.
+var MaxDials int
+
+// dialerOptions returns the dialer options as configured via the CLI flags.
+func dialerOptions() (csharg.DialerOptions, error) {
+	family, err := csharg.ParseIPFamily(IPFamily)
+	if err != nil {
+		return csharg.DialerOptions{}, fmt.Errorf("invalid --ip-family: %w", err)
+	}
+	return csharg.DialerOptions{
+		Timeout:            DialTimeout,
+		KeepAlive:          KeepAlive,
+		IPFamily:           family,
+		MaxConcurrentDials: MaxDials,
+	}, nil
+}
@@ -19,6 +19,23 @@ var StandaloneHost string
 // Insecure skips invalid server certificates.
 var Insecure bool
 
+// TLSServerName overrides the server name for verifying server certificates.
+var TLSServerName string
+
+// ClientCert and ClientKey specify the PEM files of a client certificate and
+// its private key for capture services requiring mutual TLS.
+var ClientCert, ClientKey string
+
+// Negotiate enables SPNEGO (Kerberos) authentication as the logged-on user.
+var Negotiate bool
+
+// Transport specifies the capture stream transport, "websocket", "http2",
+// "sse", or "grpc".
+var Transport string
+
+// MaxCaptures optionally limits the number of concurrent captures.
+var MaxCaptures int
+
 func init() {
 	plugger.Group[cli.SetupCLI]().Register(
 		HostSetupCLI, plugger.WithPlugin("host"))
@@ -36,7 +53,10 @@ csharg --host dns-or-ip:5001 list
 # List pods in the local KinD deployment.
 csharg --host localhost:5001 list pods`,
 				"capture": `# Capture from (stand-alone) container on the local host and pipe the captured packets into Wireshark.
-csharg --host localhost:5001 capture fools-mikroserviz | wireshark -k -i -`,
+csharg --host localhost:5001 capture fools-mikroserviz | wireshark -k -i -
+
+# Capture from a container on a container host only reachable via a bastion.
+csharg --ssh jane@bastion --host edge-1:5001 capture fools-mikroserviz | wireshark -k -i -`,
 			}
 		},
 		plugger.WithPlugin("host"), plugger.WithPlacement("<"))
@@ -50,6 +70,44 @@ on a standalone container host`)
 	command.Annotate(pf, "host", command.MutualFlagGroupAnnotation, command.ClientGroup)
 	pf.BoolVarP(&Insecure, "insecure", "k", false,
 		"Danger: skip invalid server certificates when connecting to a standalone container host")
+	pf.StringVar(&TLSServerName, "tls-server-name", "",
+		`Server name to use for verifying the server certificate and for SNI, when
+connecting by IP address or through port forwardings`)
+	pf.StringVar(&ClientCert, "client-cert", "",
+		"PEM file with the client certificate to present to capture services requiring mutual TLS")
+	pf.StringVar(&ClientKey, "client-key", "",
+		"PEM file with the private key of the --client-cert client certificate")
+	pf.StringVar(&SSHJumphost, "ssh", "",
+		"[user@]jumphost[:port] of an SSH jumphost (bastion) to tunnel connections to the capture service through")
+	pf.StringVar(&SSHIdentity, "ssh-identity", "",
+		"Private key file for authenticating with the SSH jumphost, in addition to any SSH agent")
+	pf.StringVar(&SSHKnownHosts, "ssh-known-hosts", "",
+		"Known hosts file for verifying the SSH jumphost (default ~/.ssh/known_hosts)")
+	pf.StringVar(&Proxy, "proxy", "",
+		`http[s]://host[:port] of an HTTP CONNECT proxy to connect to the capture service
+through, overriding any proxy environment variables; credentials are taken from
+$`+ProxyUsernameEnv+` and $`+ProxyPasswordEnv)
+	pf.StringVar(&ProxyAuth, "proxy-auth", "",
+		`Proxy authentication scheme, either "basic" (default with credentials) or "ntlm"`)
+	pf.BoolVar(&Negotiate, "negotiate", false,
+		`Authenticate to the capture service using SPNEGO (Kerberos) as the logged-on Windows user,
+when neither a bearer token nor basic authentication credentials are available`)
+	pf.StringVar(&Transport, "transport", string(csharg.TransportWebsocket),
+		`Capture stream transport, either "websocket", "http2" (for proxies mishandling websockets),
+"sse" (for proxies blocking websockets), or "grpc" (for capture services exposing gRPC
+capture streams); falls back to websocket for capture services not supporting the
+requested transport, and rejected websockets downgrade to "sse"`)
+	pf.DurationVar(&DialTimeout, "dial-timeout", 0,
+		"The length of time to wait for network connections to the capture service to be established")
+	pf.DurationVar(&KeepAlive, "tcp-keepalive", 0,
+		"Interval between TCP keep-alive probes on connections to the capture service; negative disables keep-alives (default system)")
+	pf.StringVar(&IPFamily, "ip-family", "dual",
+		`IP family to connect to the capture service with, either "dual", "ipv4", or "ipv6"`)
+	pf.IntVar(&MaxDials, "max-dials", 0,
+		"Maximum number of connections to the capture service to establish at the same time (default unlimited)")
+	pf.IntVar(&MaxCaptures, "max-captures", 0,
+		`Maximum number of concurrent captures from a standalone container host (default unlimited);
+use the "http2" or "grpc" transport to share connections between concurrent captures`)
 }
 
 func NewHostClient() (csharg.SharkTank, error) {
@@ -57,10 +115,37 @@ func NewHostClient() (csharg.SharkTank, error) {
 	if StandaloneHost != "" {
 		opts := &csharg.SharkTankOnHostOptions{
 			CommonClientOptions: csharg.CommonClientOptions{
-				BearerToken: command.BearerToken,
-				Timeout:     command.ReqTimeout,
+				BearerToken:             command.BearerToken,
+				Username:                command.Username,
+				Password:                command.Password,
+				Timeout:                 command.ReqTimeout,
+				DiscoveryTimeout:        command.DiscoveryTimeout,
+				CaptureHandshakeTimeout: command.HandshakeTimeout,
+				StallTimeout:            command.StallTimeout,
 			},
 			InsecureSkipVerify: Insecure,
+			ServerName:         TLSServerName,
+			TLSConfig:          command.TLSConfig,
+			ClientCertFile:     ClientCert,
+			ClientKeyFile:      ClientKey,
+			Transport:          csharg.CaptureTransport(Transport),
+			MaxCaptures:        MaxCaptures,
+		}
+		if SSHJumphost != "" {
+			opts.DialContext = newSSHTunnel(SSHJumphost).DialContext
+		}
+		proxy, err := proxyOptions()
+		if err != nil {
+			return nil, err
+		}
+		opts.Proxy = proxy
+		if opts.Dialer, err = dialerOptions(); err != nil {
+			return nil, err
+		}
+		if Negotiate {
+			if opts.Negotiate, err = negotiate(); err != nil {
+				return nil, err
+			}
 		}
 		return csharg.NewSharkTankOnHost(StandaloneHost, opts)
 	}
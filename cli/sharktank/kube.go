@@ -0,0 +1,93 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sharktank
+
+import (
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// Kubeconfig specifies the kubeconfig file(s) to use instead of $KUBECONFIG or
+// "~/.kube/config".
+var Kubeconfig string
+
+// KubeContext specifies the kubeconfig context to use instead of the current
+// context.
+var KubeContext string
+
+// ClusterService specifies the cluster capture service as
+// "[https:]name[:port]".
+var ClusterService string
+
+// ClusterServiceNamespace specifies the namespace of the cluster capture
+// service.
+var ClusterServiceNamespace string
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(
+		KubeSetupCLI, plugger.WithPlugin("kube"))
+	// Place the Kubernetes cluster client last, so that it acts as the default
+	// when no other capture service client has been specified.
+	plugger.Group[cli.NewClient]().Register(
+		NewKubeClient, plugger.WithPlugin("kube"), plugger.WithPlacement(">"))
+	plugger.Group[cli.CommandExamples]().Register(
+		func() map[string]string {
+			return map[string]string{
+				"list": `# List the pods in the cluster of the current kubeconfig context.
+csharg list pods
+
+# List all capture targets in the cluster of a specific kubeconfig context.
+csharg --context production list`,
+				"capture": `# Capture from a pod in the cluster of the current kubeconfig context.
+csharg capture pod default/fools-mikroserviz | wireshark -k -i -`,
+			}
+		},
+		plugger.WithPlugin("kube"))
+}
+
+// KubeSetupCLI registers the “--kubeconfig”, “--context”, “--capture-service”,
+// and “--capture-service-namespace” CLI flags.
+func KubeSetupCLI(cmd *cobra.Command) {
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&Kubeconfig, "kubeconfig", "",
+		`Path to the kubeconfig file(s) to use instead of $KUBECONFIG or ~/.kube/config;
+without any kubeconfig, the in-cluster configuration is used`)
+	pf.StringVar(&KubeContext, "context", "",
+		"Name of the kubeconfig context to use instead of the current context")
+	command.Annotate(pf, "context", command.MutualFlagGroupAnnotation, command.ClientGroup)
+	pf.StringVar(&ClusterService, "capture-service", csharg.DefaultClusterService,
+		"[https:]name[:port] of the cluster capture service")
+	pf.StringVar(&ClusterServiceNamespace, "capture-service-namespace", csharg.DefaultClusterServiceNamespace,
+		"Namespace of the cluster capture service")
+}
+
+// NewKubeClient returns a client accessing the cluster capture service through
+// the Kubernetes remote API server, unless another capture service client has
+// been specified.
+func NewKubeClient() (csharg.SharkTank, error) {
+	if StandaloneHost != "" || ReplayDir != "" {
+		return nil, nil
+	}
+	return csharg.NewSharkTankOnKubeCluster(&csharg.SharkTankOnKubeClusterOptions{
+		CommonClientOptions: csharg.CommonClientOptions{
+			BearerToken:             command.BearerToken,
+			Username:                command.Username,
+			Password:                command.Password,
+			Timeout:                 command.ReqTimeout,
+			DiscoveryTimeout:        command.DiscoveryTimeout,
+			CaptureHandshakeTimeout: command.HandshakeTimeout,
+			StallTimeout:            command.StallTimeout,
+		},
+		Kubeconfig:       Kubeconfig,
+		Context:          KubeContext,
+		Service:          ClusterService,
+		ServiceNamespace: ClusterServiceNamespace,
+		Transport:        csharg.CaptureTransport(Transport),
+		MaxCaptures:      MaxCaptures,
+	})
+}
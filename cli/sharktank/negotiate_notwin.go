@@ -0,0 +1,19 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build !windows
+
+package sharktank
+
+import (
+	"errors"
+
+	"github.com/siemens/csharg"
+)
+
+// negotiate returns an error, as acquiring SPNEGO tokens is only supported
+// using the Windows SSPI, lacking a Kerberos implementation otherwise.
+func negotiate() (csharg.NegotiateFunc, error) {
+	return nil, errors.New("--negotiate is only supported on Windows")
+}
@@ -0,0 +1,103 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+
+package sharktank
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/siemens/csharg"
+)
+
+// SSPI functions for acquiring SPNEGO tokens for the logged-on user.
+var (
+	secur32                        = syscall.NewLazyDLL("secur32.dll")
+	procAcquireCredentialsHandleW  = secur32.NewProc("AcquireCredentialsHandleW")
+	procInitializeSecurityContextW = secur32.NewProc("InitializeSecurityContextW")
+	procDeleteSecurityContext      = secur32.NewProc("DeleteSecurityContext")
+	procFreeCredentialsHandle      = secur32.NewProc("FreeCredentialsHandle")
+	procFreeContextBuffer          = secur32.NewProc("FreeContextBuffer")
+)
+
+// SSPI constants, see sspi.h.
+const (
+	secpkgCredOutbound      = 0x2
+	securityNativeDrep      = 0x10
+	iscReqAllocateMemory    = 0x100
+	iscReqMutualAuth        = 0x2
+	secbufferVersion        = 0
+	secbufferToken          = 2
+	secEOK                  = 0x00000000
+	secIContinueNeeded      = 0x00090312
+	secICompleteNeeded      = 0x00090313
+	secICompleteAndContinue = 0x00090314
+)
+
+type secHandle struct {
+	lower, upper uintptr
+}
+
+type secBuffer struct {
+	cbBuffer   uint32
+	bufferType uint32
+	pvBuffer   *byte
+}
+
+type secBufferDesc struct {
+	ulVersion uint32
+	cBuffers  uint32
+	pBuffers  *secBuffer
+}
+
+// negotiate returns the SPNEGO token function using the credentials of the
+// logged-on Windows user.
+func negotiate() (csharg.NegotiateFunc, error) {
+	if err := secur32.Load(); err != nil {
+		return nil, fmt.Errorf("SSPI not available: %w", err)
+	}
+	return sspiToken, nil
+}
+
+// sspiToken returns the initial SPNEGO token for the specified service
+// principal name, using the SSPI “Negotiate” security package.
+func sspiToken(spn string) ([]byte, error) {
+	pkg, _ := syscall.UTF16PtrFromString("Negotiate")
+	target, err := syscall.UTF16PtrFromString(spn)
+	if err != nil {
+		return nil, err
+	}
+	var cred secHandle
+	var expiry int64
+	status, _, _ := procAcquireCredentialsHandleW.Call(
+		0, uintptr(unsafe.Pointer(pkg)), secpkgCredOutbound, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&cred)), uintptr(unsafe.Pointer(&expiry)))
+	if status != secEOK {
+		return nil, fmt.Errorf("AcquireCredentialsHandle failed with status 0x%08x", uint32(status))
+	}
+	defer procFreeCredentialsHandle.Call(uintptr(unsafe.Pointer(&cred)))
+	var ctx secHandle
+	out := secBuffer{bufferType: secbufferToken}
+	outdesc := secBufferDesc{ulVersion: secbufferVersion, cBuffers: 1, pBuffers: &out}
+	var attrs uint32
+	status, _, _ = procInitializeSecurityContextW.Call(
+		uintptr(unsafe.Pointer(&cred)), 0, uintptr(unsafe.Pointer(target)),
+		iscReqAllocateMemory|iscReqMutualAuth, 0, securityNativeDrep, 0, 0,
+		uintptr(unsafe.Pointer(&ctx)), uintptr(unsafe.Pointer(&outdesc)),
+		uintptr(unsafe.Pointer(&attrs)), uintptr(unsafe.Pointer(&expiry)))
+	switch status {
+	case secEOK, secIContinueNeeded, secICompleteNeeded, secICompleteAndContinue:
+	default:
+		return nil, fmt.Errorf("InitializeSecurityContext failed with status 0x%08x", uint32(status))
+	}
+	defer procDeleteSecurityContext.Call(uintptr(unsafe.Pointer(&ctx)))
+	if out.pvBuffer == nil {
+		return nil, fmt.Errorf("InitializeSecurityContext returned no token")
+	}
+	defer procFreeContextBuffer.Call(uintptr(unsafe.Pointer(out.pvBuffer)))
+	return append([]byte(nil), unsafe.Slice(out.pvBuffer, out.cbBuffer)...), nil
+}
@@ -0,0 +1,45 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sharktank
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/siemens/csharg"
+)
+
+// Proxy optionally specifies the URL of an HTTP CONNECT proxy to connect to
+// the capture service through.
+var Proxy string
+
+// ProxyAuth specifies the proxy authentication scheme, "basic" or "ntlm".
+var ProxyAuth string
+
+// Environment variables with the proxy credentials, so that they don't show
+// up in shell histories and process listings.
+const (
+	ProxyUsernameEnv = "CSHARG_PROXY_USERNAME"
+	ProxyPasswordEnv = "CSHARG_PROXY_PASSWORD"
+)
+
+// proxyOptions returns the proxy options as configured via the CLI flags and
+// environment variables, or nil if no proxy has been configured.
+func proxyOptions() (*csharg.ProxyOptions, error) {
+	if Proxy == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --proxy: %w", err)
+	}
+	return &csharg.ProxyOptions{
+		URL:      u,
+		Username: os.Getenv(ProxyUsernameEnv),
+		Password: os.Getenv(ProxyPasswordEnv),
+		Auth:     csharg.ProxyAuth(ProxyAuth),
+	}, nil
+}
@@ -0,0 +1,56 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sharktank
+
+import (
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/spf13/cobra"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// ReplayDir specifies a directory of pcapng files to replay as capture
+// targets, instead of contacting a capture service.
+var ReplayDir string
+
+// ReplayRealTime paces replays according to the packet timestamps.
+var ReplayRealTime bool
+
+func init() {
+	plugger.Group[cli.SetupCLI]().Register(
+		ReplaySetupCLI, plugger.WithPlugin("replay"))
+	plugger.Group[cli.NewClient]().Register(
+		NewReplayClient, plugger.WithPlugin("replay"))
+	plugger.Group[cli.CommandExamples]().Register(
+		func() map[string]string {
+			return map[string]string{
+				"capture": `# Replay a packet capture file from a directory in real time, completely offline.
+csharg --replay ./captures --replay-realtime capture fools-mikroserviz | wireshark -k -i -`,
+			}
+		},
+		plugger.WithPlugin("replay"))
+}
+
+// ReplaySetupCLI registers the “--replay” and “--replay-realtime” CLI flags.
+func ReplaySetupCLI(cmd *cobra.Command) {
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&ReplayDir, "replay", "",
+		"Directory with pcapng files to replay as capture targets, instead of contacting a capture service")
+	command.Annotate(pf, "replay", command.MutualFlagGroupAnnotation, command.ClientGroup)
+	pf.BoolVar(&ReplayRealTime, "replay-realtime", false,
+		"Replay packets in real time according to their timestamps, instead of as fast as possible")
+}
+
+// NewReplayClient returns a client replaying pcapng files, if “--replay” has
+// been specified.
+func NewReplayClient() (csharg.SharkTank, error) {
+	if ReplayDir == "" {
+		return nil, nil
+	}
+	return csharg.NewSharkTankReplay(ReplayDir, &csharg.SharkTankReplayOptions{
+		RealTime: ReplayRealTime,
+	})
+}
@@ -0,0 +1,178 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sharktank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/cli/command"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHJumphost optionally specifies the [user@]host[:port] of an SSH jumphost
+// (bastion) through which to connect to the capture service.
+var SSHJumphost string
+
+// SSHIdentity optionally specifies a private key file for authenticating with
+// the SSH jumphost.
+var SSHIdentity string
+
+// SSHKnownHosts specifies the known_hosts file for verifying the SSH
+// jumphost's host key.
+var SSHKnownHosts string
+
+// DefaultSSHTimeout limits connecting to the SSH jumphost, unless a request
+// timeout has been specified.
+const DefaultSSHTimeout = 10 * time.Second
+
+// defaultSSHIdentities lists the private key files tried when no identity has
+// been specified explicitly.
+var defaultSSHIdentities = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshTunnel lazily connects to an SSH jumphost and then dials connections to
+// the capture service through it.
+type sshTunnel struct {
+	jumphost string
+	mu       sync.Mutex
+	client   *ssh.Client
+}
+
+// newSSHTunnel returns a new (yet unconnected) SSH tunnel through the
+// specified jumphost.
+func newSSHTunnel(jumphost string) *sshTunnel {
+	return &sshTunnel{jumphost: jumphost}
+}
+
+// DialContext dials the specified address through the SSH tunnel, first
+// connecting to the jumphost if not done so already.
+func (t *sshTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("dialing %s through SSH jumphost %s", addr, t.jumphost)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return client.Dial(network, addr)
+}
+
+// connect connects to the SSH jumphost, unless already connected.
+func (t *sshTunnel) connect() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+	username, host := "", t.jumphost
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		username, host = host[:at], host[at+1:]
+	}
+	if username == "" {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	hostkeys, err := sshHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	auths := sshAuthMethods()
+	if len(auths) == 0 {
+		return nil, errors.New("no SSH agent and no SSH identity available for --ssh")
+	}
+	timeout := command.ReqTimeout
+	if timeout == 0 {
+		timeout = DefaultSSHTimeout
+	}
+	log.Debugf("connecting to SSH jumphost %s as %q", host, username)
+	client, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auths,
+		HostKeyCallback: hostkeys,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to SSH jumphost %s: %w", host, err)
+	}
+	t.client = client
+	return client, nil
+}
+
+// sshHostKeyCallback returns a host key callback checking the jumphost's key
+// against the known_hosts file.
+func sshHostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownhostsfile := SSHKnownHosts
+	if knownhostsfile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate SSH known_hosts: %w", err)
+		}
+		knownhostsfile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(knownhostsfile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read SSH known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// sshAuthMethods returns the available SSH authentication methods, that is,
+// the SSH agent (if running), as well as either the explicitly specified
+// identity or the user's unencrypted default identities.
+func sshAuthMethods() []ssh.AuthMethod {
+	var auths []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		} else {
+			log.Debugf("cannot contact SSH agent: %s", err)
+		}
+	}
+	identities := []string{SSHIdentity}
+	if SSHIdentity == "" {
+		identities = nil
+		if home, err := os.UserHomeDir(); err == nil {
+			for _, id := range defaultSSHIdentities {
+				identities = append(identities, filepath.Join(home, ".ssh", id))
+			}
+		}
+	}
+	var signers []ssh.Signer
+	for _, id := range identities {
+		pem, err := os.ReadFile(id)
+		if err != nil {
+			if SSHIdentity != "" {
+				log.Warnf("cannot read SSH identity: %s", err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			log.Warnf("cannot use SSH identity %s: %s", id, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auths = append(auths, ssh.PublicKeys(signers...))
+	}
+	return auths
+}
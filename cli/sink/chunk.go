@@ -0,0 +1,100 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sink
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/pcapng"
+)
+
+// DefaultChunkLinger is the maximum time a chunk waits for further blocks
+// before it gets emitted, so that live captures with only sporadic packets
+// still get forwarded timely.
+const DefaultChunkLinger = time.Second
+
+// chunker collects complete pcapng blocks into chunks of up to a maximum size
+// and then emits them, so that consumers of the individual chunks never see
+// partial blocks. Blocks larger than the maximum chunk size are emitted as
+// chunks of their own.
+type chunker struct {
+	scanner *pcapng.Scanner
+	max     int
+	linger  time.Duration
+	emit    func(chunk []byte) error
+
+	mu    sync.Mutex
+	buff  []byte
+	timer *time.Timer
+	err   error
+}
+
+// newChunker returns a new chunker emitting chunks of up to max octets, or
+// after the linger duration since the first block of a chunk.
+func newChunker(max int, linger time.Duration, emit func(chunk []byte) error) *chunker {
+	c := &chunker{max: max, linger: linger, emit: emit}
+	c.scanner = pcapng.NewScanner(c.block)
+	return c
+}
+
+// Write writes octets of a pcapng stream.
+func (c *chunker) Write(p []byte) (int, error) {
+	return c.scanner.Write(p)
+}
+
+// Close emits any remaining chunk.
+func (c *chunker) Close() error {
+	err := c.scanner.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	return errors.Join(err, c.flush())
+}
+
+// block adds a complete pcapng block to the current chunk.
+func (c *chunker) block(b *pcapng.Block) error {
+	octets := b.Bytes()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buff) > 0 && len(c.buff)+len(octets) > c.max {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	if len(c.buff) == 0 && c.linger > 0 {
+		if c.timer == nil {
+			c.timer = time.AfterFunc(c.linger, c.lingered)
+		} else {
+			c.timer.Reset(c.linger)
+		}
+	}
+	c.buff = append(c.buff, octets...)
+	if len(c.buff) >= c.max {
+		return c.flush()
+	}
+	return c.err
+}
+
+// lingered emits the current chunk after it waited long enough.
+func (c *chunker) lingered() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.flush()
+}
+
+// flush emits the current chunk, if any. The caller must hold the lock.
+func (c *chunker) flush() error {
+	if c.err != nil || len(c.buff) == 0 {
+		return c.err
+	}
+	chunk := c.buff
+	c.buff = nil
+	c.err = c.emit(chunk)
+	return c.err
+}
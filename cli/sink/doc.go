@@ -0,0 +1,6 @@
+/*
+Package sink implements the builtin output sinks for streaming packet captures
+to destinations other than plain files, such as “-w tcp://host:port”. The sinks
+register themselves as [cli.NewSink] plugins.
+*/
+package sink
@@ -0,0 +1,259 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// DefaultKafkaChunkSize is the default maximum size of pcapng chunk messages.
+const DefaultKafkaChunkSize = 512 * 1024
+
+// Environment variables with the SASL credentials for Kafka brokers.
+const (
+	KafkaUsernameEnv = "CSHARG_KAFKA_USERNAME"
+	KafkaPasswordEnv = "CSHARG_KAFKA_PASSWORD"
+)
+
+func init() {
+	plugger.Group[cli.NewSink]().Register(NewKafkaSink, plugger.WithPlugin("kafka"))
+}
+
+// kafkasink publishes a packet capture stream to a Kafka topic, either as
+// chunks of raw pcapng blocks, or as individual packet records.
+type kafkasink struct {
+	writer *kafka.Writer
+	key    []byte
+	w      io.WriteCloser // either a chunker or a pcapng block scanner.
+
+	seq     int64
+	headers []kafka.Header // capture target meta data of the current section.
+	scanner *pcapng.Scanner
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewKafkaSink returns a sink publishing to a Kafka topic for
+// “kafka://broker[,broker...]/topic” destinations. The following query
+// parameters are supported:
+//   - mode: "chunks" (default) publishes the raw pcapng stream in chunks of
+//     complete pcapng blocks; "packets" publishes each packet as a record of
+//     its own, with the packet data as the value and the timestamp, link type
+//     and capture target meta data as headers.
+//   - chunk-size: maximum size of chunks, such as "1MiB".
+//   - key: message key; defaults to a key unique to this capture, so that all
+//     messages of a capture end up in the same partition in order.
+//   - tls: "true" to connect to the brokers using TLS.
+//   - sasl: "plain", "scram-sha-256", or "scram-sha-512", with the credentials
+//     taken from $CSHARG_KAFKA_USERNAME and $CSHARG_KAFKA_PASSWORD.
+//   - compression: "gzip", "snappy", "lz4", or "zstd".
+func NewKafkaSink(dest string) (io.WriteCloser, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "kafka" {
+		return nil, nil
+	}
+	topic := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || topic == "" || strings.Contains(topic, "/") {
+		return nil, fmt.Errorf("invalid Kafka sink %q, expecting kafka://broker[,broker...]/topic", dest)
+	}
+	q := u.Query()
+	transport := &kafka.Transport{DialTimeout: dialTimeout()}
+	if q.Get("tls") == "true" {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.SASL, err = kafkaSASL(q.Get("sasl"))
+	if err != nil {
+		return nil, err
+	}
+	s := &kafkasink{
+		key: []byte(q.Get("key")),
+	}
+	if len(s.key) == 0 {
+		s.key = []byte("csharg-" + strconv.FormatInt(time.Now().UnixNano(), 36))
+	}
+	chunksize := command.BufferLimited(DefaultKafkaChunkSize)
+	if size := q.Get("chunk-size"); size != "" {
+		chunksize, err = command.ParseOctets(size)
+		if err != nil || chunksize <= 0 {
+			return nil, fmt.Errorf("invalid Kafka sink chunk-size %q", size)
+		}
+	}
+	s.writer = &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(u.Host, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Async:        true,
+		BatchTimeout: 100 * time.Millisecond,
+		BatchBytes:   chunksize + 64*1024,
+		Transport:    transport,
+		Completion:   s.completed,
+	}
+	switch compression := q.Get("compression"); compression {
+	case "":
+	case "gzip":
+		s.writer.Compression = kafka.Gzip
+	case "snappy":
+		s.writer.Compression = kafka.Snappy
+	case "lz4":
+		s.writer.Compression = kafka.Lz4
+	case "zstd":
+		s.writer.Compression = kafka.Zstd
+	default:
+		return nil, fmt.Errorf("invalid Kafka sink compression %q", compression)
+	}
+	switch mode := q.Get("mode"); mode {
+	case "", "chunks":
+		s.w = newChunker(int(chunksize), DefaultChunkLinger, s.chunk)
+	case "packets":
+		s.scanner = pcapng.NewScanner(s.packet)
+		s.w = s.scanner
+	default:
+		return nil, fmt.Errorf("invalid Kafka sink mode %q, must be chunks or packets", mode)
+	}
+	log.Debugf("publishing packet capture to Kafka topic %q on %s", topic, u.Host)
+	return s, nil
+}
+
+// kafkaSASL returns the specified SASL mechanism, if any.
+func kafkaSASL(mechanism string) (sasl.Mechanism, error) {
+	username, password := os.Getenv(KafkaUsernameEnv), os.Getenv(KafkaPasswordEnv)
+	switch mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	}
+	return nil, fmt.Errorf("invalid Kafka sink sasl %q, must be plain, scram-sha-256, or scram-sha-512", mechanism)
+}
+
+// Write writes octets of the pcapng stream.
+func (s *kafkasink) Write(p []byte) (int, error) {
+	if err := s.error(); err != nil {
+		return 0, err
+	}
+	return s.w.Write(p)
+}
+
+// Close publishes any remaining data and waits for all messages to be
+// published, returning the first publishing error, if any.
+func (s *kafkasink) Close() error {
+	err := s.w.Close()
+	return errors.Join(err, s.writer.Close(), s.error())
+}
+
+// chunk publishes a chunk of pcapng blocks.
+func (s *kafkasink) chunk(chunk []byte) error {
+	s.seq++
+	return s.publish(kafka.Message{
+		Key:   s.key,
+		Value: chunk,
+		Headers: []kafka.Header{
+			{Key: "csharg-seq", Value: []byte(strconv.FormatInt(s.seq, 10))},
+		},
+	})
+}
+
+// packet publishes the packets of a pcapng stream as individual records,
+// keeping track of the capture target meta data.
+func (s *kafkasink) packet(b *pcapng.Block) error {
+	switch b.Type {
+	case pcapng.BlockSHB:
+		s.headers = nil
+		ci, _ := pcapng.ParseContainerInfo(s.scanner.SectionHeader().Comment())
+		if ci == nil {
+			return nil
+		}
+		for _, hdr := range [][2]string{
+			{"target-name", ci.ContainerName},
+			{"target-type", ci.ContainerType},
+			{"node-name", ci.NodeName},
+			{"container-id", ci.ContainerID},
+			{"sandbox-id", ci.SandboxID},
+			{"capture-filter", ci.CaptureFilter},
+		} {
+			if hdr[1] != "" {
+				s.headers = append(s.headers, kafka.Header{Key: hdr[0], Value: []byte(hdr[1])})
+			}
+		}
+		return nil
+	case pcapng.BlockEPB:
+	default:
+		return nil
+	}
+	epb, err := b.EnhancedPacket()
+	if err != nil {
+		return err
+	}
+	idb := s.scanner.Interface(epb.InterfaceID)
+	if idb == nil {
+		return fmt.Errorf("packet references unknown interface %d", epb.InterfaceID)
+	}
+	ts := idb.Time(epb.Timestamp)
+	headers := append([]kafka.Header{
+		{Key: "timestamp", Value: []byte(ts.UTC().Format(time.RFC3339Nano))},
+		{Key: "linktype", Value: []byte(strconv.Itoa(int(idb.LinkType)))},
+		{Key: "interface", Value: []byte(idb.Name())},
+		{Key: "original-length", Value: []byte(strconv.Itoa(int(epb.OriginalLength)))},
+	}, s.headers...)
+	return s.publish(kafka.Message{
+		Key:     s.key,
+		Value:   epb.Data,
+		Headers: headers,
+		Time:    ts,
+	})
+}
+
+// publish asynchronously publishes a message.
+func (s *kafkasink) publish(msg kafka.Message) error {
+	if err := s.error(); err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(context.Background(), msg)
+}
+
+// completed records the first publishing error.
+func (s *kafkasink) completed(messages []kafka.Message, err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = fmt.Errorf("cannot publish to Kafka topic %q: %w", s.writer.Topic, err)
+	}
+}
+
+// error returns the first publishing error, if any.
+func (s *kafkasink) error() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,139 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sink
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	log "github.com/sirupsen/logrus"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// DefaultMQTTChunkSize is the default maximum size of pcapng chunk messages,
+// erring on the small side for constrained edge networks and brokers.
+const DefaultMQTTChunkSize = 64 * 1024
+
+// Environment variables with the credentials for MQTT brokers.
+const (
+	MQTTUsernameEnv = "CSHARG_MQTT_USERNAME"
+	MQTTPasswordEnv = "CSHARG_MQTT_PASSWORD"
+)
+
+func init() {
+	plugger.Group[cli.NewSink]().Register(NewMQTTSink, plugger.WithPlugin("mqtt"))
+}
+
+// mqttsink publishes a packet capture stream to an MQTT topic in chunks of
+// complete pcapng blocks.
+type mqttsink struct {
+	client  mqtt.Client
+	topic   string
+	qos     byte
+	chunker *chunker
+}
+
+// NewMQTTSink returns a sink publishing to an MQTT topic for
+// “mqtt://broker[:port]/topic” and (TLS) “mqtts://broker[:port]/topic”
+// destinations. The pcapng stream gets published in chunks of complete pcapng
+// blocks. The following query parameters are supported:
+//   - qos: the MQTT quality of service 0, 1 (default), or 2.
+//   - chunk-size: maximum size of chunks, such as "64KiB".
+//   - client-id: the MQTT client ID, defaulting to a unique ID.
+//
+// The credentials are taken from $CSHARG_MQTT_USERNAME and
+// $CSHARG_MQTT_PASSWORD, if set.
+func NewMQTTSink(dest string) (io.WriteCloser, error) {
+	u, err := url.Parse(dest)
+	if err != nil || (u.Scheme != "mqtt" && u.Scheme != "mqtts") {
+		return nil, nil
+	}
+	topic := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || topic == "" {
+		return nil, fmt.Errorf("invalid MQTT sink %q, expecting %s://broker[:port]/topic", dest, u.Scheme)
+	}
+	q := u.Query()
+	s := &mqttsink{topic: topic, qos: 1}
+	if qos := q.Get("qos"); qos != "" {
+		n, err := strconv.Atoi(qos)
+		if err != nil || n < 0 || n > 2 {
+			return nil, fmt.Errorf("invalid MQTT sink qos %q, must be 0, 1, or 2", qos)
+		}
+		s.qos = byte(n)
+	}
+	chunksize := command.BufferLimited(DefaultMQTTChunkSize)
+	if size := q.Get("chunk-size"); size != "" {
+		chunksize, err = command.ParseOctets(size)
+		if err != nil || chunksize <= 0 {
+			return nil, fmt.Errorf("invalid MQTT sink chunk-size %q", size)
+		}
+	}
+	broker := "tcp://" + u.Host
+	port := "1883"
+	if u.Scheme == "mqtts" {
+		broker = "ssl://" + u.Host
+		port = "8883"
+	}
+	if u.Port() == "" {
+		broker += ":" + port
+	}
+	clientID := q.Get("client-id")
+	if clientID == "" {
+		clientID = "csharg-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(os.Getenv(MQTTUsernameEnv)).
+		SetPassword(os.Getenv(MQTTPasswordEnv)).
+		SetConnectTimeout(dialTimeout()).
+		SetAutoReconnect(true).
+		SetCleanSession(true)
+	if u.Scheme == "mqtts" {
+		opts.SetTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	log.Debugf("connecting to MQTT broker %s", broker)
+	s.client = mqtt.NewClient(opts)
+	if token := s.client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, fmt.Errorf("cannot connect to MQTT broker: %w", token.Error())
+	}
+	s.chunker = newChunker(int(chunksize), DefaultChunkLinger, s.chunk)
+	return s, nil
+}
+
+// Write writes octets of the pcapng stream.
+func (s *mqttsink) Write(p []byte) (int, error) {
+	return s.chunker.Write(p)
+}
+
+// Close publishes any remaining data and then disconnects from the broker.
+func (s *mqttsink) Close() error {
+	err := s.chunker.Close()
+	s.client.Disconnect(uint(dialTimeout().Milliseconds()))
+	return err
+}
+
+// chunk publishes a chunk of pcapng blocks, waiting for the broker to
+// acknowledge it in case of QoS 1 and 2.
+func (s *mqttsink) chunk(chunk []byte) error {
+	token := s.client.Publish(s.topic, s.qos, false, chunk)
+	if !token.WaitTimeout(dialTimeout()) {
+		return errors.New("cannot publish to MQTT broker: timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("cannot publish to MQTT broker: %w", err)
+	}
+	return nil
+}
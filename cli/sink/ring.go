@@ -0,0 +1,146 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// Ring buffer sink defaults.
+const (
+	DefaultRingDuration = time.Minute
+	DefaultRingSize     = 64 << 20
+)
+
+func init() {
+	plugger.Group[cli.NewSink]().Register(NewRingSink, plugger.WithPlugin("ring"))
+}
+
+// ringsink retains the most recent packets in memory and dumps them into
+// snapshot files on demand.
+type ringsink struct {
+	ring    *pcapng.Ring
+	dir     string
+	onClose bool
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// NewRingSink returns a sink retaining the most recent packets in memory for
+// “ring://[dir]” destinations. On SIGUSR1 (not supported on Windows) the sink
+// writes the retained packets into a new snapshot file in the specified
+// directory, defaulting to the current working directory. The following query
+// parameters are supported:
+//   - duration: retains the packets of up to this duration, such as "30s",
+//     defaulting to 1m.
+//   - size: retains packets of up to this overall size, such as "16MiB",
+//     defaulting to 64MiB, or --max-buffer if smaller.
+//   - on-close: "true" additionally writes a snapshot when the capture ends.
+func NewRingSink(dest string) (io.WriteCloser, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "ring" {
+		return nil, nil
+	}
+	q := u.Query()
+	duration := DefaultRingDuration
+	if d := q.Get("duration"); d != "" {
+		duration, err = time.ParseDuration(d)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid ring sink duration %q", d)
+		}
+	}
+	size := command.BufferLimited(DefaultRingSize)
+	if sz := q.Get("size"); sz != "" {
+		size, err = command.ParseOctets(sz)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid ring sink size %q", sz)
+		}
+	}
+	s := &ringsink{
+		ring:    pcapng.NewRing(duration, size),
+		dir:     u.Host + u.Path,
+		onClose: q.Get("on-close") == "true",
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+	if s.dir == "" {
+		s.dir = "."
+	}
+	if info, err := os.Stat(s.dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("invalid ring sink snapshot directory %q", s.dir)
+	}
+	log.Debugf("retaining the packets of the last %s, up to %s, snapshots in %s",
+		duration, command.HumanOctets(size), s.dir)
+	if len(command.SnapshotSignals) > 0 {
+		signal.Notify(s.signals, command.SnapshotSignals...)
+		go s.watch()
+	}
+	return s, nil
+}
+
+// Write retains the octets of the pcapng stream.
+func (s *ringsink) Write(p []byte) (int, error) {
+	return s.ring.Write(p)
+}
+
+// Close stops watching for snapshot signals and then optionally writes a
+// final snapshot.
+func (s *ringsink) Close() error {
+	if len(command.SnapshotSignals) > 0 {
+		signal.Stop(s.signals)
+		close(s.done)
+	}
+	err := s.ring.Close()
+	if s.onClose {
+		err = errors.Join(err, s.snapshot())
+	}
+	return err
+}
+
+// watch writes a snapshot each time a snapshot signal is received.
+func (s *ringsink) watch() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.signals:
+			if err := s.snapshot(); err != nil {
+				log.Errorf("cannot write snapshot: %s", err.Error())
+			}
+		}
+	}
+}
+
+// snapshot writes the retained packets into a new snapshot file.
+func (s *ringsink) snapshot() error {
+	name := filepath.Join(s.dir,
+		"csharg-snapshot-"+time.Now().UTC().Format("20060102T150405.000Z")+".pcapng")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	packets, err := s.ring.Snapshot(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("wrote snapshot of %d packets to %s", packets, name)
+	return nil
+}
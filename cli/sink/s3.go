@@ -0,0 +1,248 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sink
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// S3 sink defaults.
+const (
+	DefaultS3Endpoint = "s3.amazonaws.com"
+	DefaultS3PartSize = 16 * 1024 * 1024
+	MinS3PartSize     = 5 * 1024 * 1024
+)
+
+// S3SSECKeyEnv names the environment variable containing the base64 encoded
+// 256 bit key for server-side encryption with customer-provided keys.
+const S3SSECKeyEnv = "CSHARG_S3_SSEC_KEY"
+
+func init() {
+	plugger.Group[cli.NewSink]().Register(NewS3Sink, plugger.WithPlugin("s3"))
+}
+
+// s3sink uploads a packet capture stream to S3-compatible object storage
+// using multipart uploads, optionally rotating to new objects after a certain
+// size. Rotated objects start with the section header and interface
+// descriptions of the current section, so each object is a valid pcapng file.
+type s3sink struct {
+	client     *minio.Client
+	bucket     string
+	key        string
+	opts       minio.PutObjectOptions
+	rotateSize int64
+
+	upload  *s3upload
+	objects int
+	scanner *pcapng.Scanner
+	header  [][]byte // SHB and IDBs of the current section.
+}
+
+// s3upload is a single streaming multipart object upload in progress.
+type s3upload struct {
+	w    *io.PipeWriter
+	done chan error
+	size int64
+}
+
+// NewS3Sink returns a sink uploading to S3-compatible object storage for
+// “s3://bucket/key” destinations. The following query parameters are
+// supported:
+//   - endpoint: host[:port] of the object storage service, defaulting to
+//     AWS S3.
+//   - region: the bucket region.
+//   - insecure: "true" to use plain HTTP instead of HTTPS.
+//   - part-size: the multipart upload part size, such as "64MiB".
+//   - rotate-size: rotates to a new object after the specified size, such as
+//     "1GiB"; objects then get a sequence number appended to their names.
+//   - sse: server-side encryption, either "s3", "kms" (with optional
+//     kms-key-id), or "c" with the key taken from $CSHARG_S3_SSEC_KEY.
+//
+// Credentials are taken from the usual AWS and MinIO environment variables,
+// the AWS credentials file, or IAM.
+func NewS3Sink(dest string) (io.WriteCloser, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "s3" {
+		return nil, nil
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 sink %q, expecting s3://bucket/key", dest)
+	}
+	q := u.Query()
+	endpoint := q.Get("endpoint")
+	if endpoint == "" {
+		endpoint = DefaultS3Endpoint
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		}),
+		Secure: q.Get("insecure") != "true",
+		Region: q.Get("region"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 sink: %w", err)
+	}
+	s := &s3sink{
+		client: client,
+		bucket: u.Host,
+		key:    strings.TrimPrefix(u.Path, "/"),
+		opts: minio.PutObjectOptions{
+			ContentType: "application/x-pcapng",
+			PartSize:    DefaultS3PartSize,
+		},
+	}
+	if command.MaxBuffer > 0 {
+		// Multipart uploads buffer a complete part in memory, so use the
+		// smallest possible part size when memory is tight.
+		s.opts.PartSize = MinS3PartSize
+	}
+	if s.key == "" || strings.HasSuffix(s.key, "/") {
+		s.key += "csharg-" + time.Now().UTC().Format("20060102T150405Z") + ".pcapng"
+	}
+	if partsize := q.Get("part-size"); partsize != "" {
+		size, err := command.ParseOctets(partsize)
+		if err != nil || size < MinS3PartSize {
+			return nil, fmt.Errorf("invalid S3 sink part-size %q, must be at least 5MiB", partsize)
+		}
+		s.opts.PartSize = uint64(size)
+	}
+	if rotate := q.Get("rotate-size"); rotate != "" {
+		s.rotateSize, err = command.ParseOctets(rotate)
+		if err != nil || s.rotateSize <= 0 {
+			return nil, fmt.Errorf("invalid S3 sink rotate-size %q", rotate)
+		}
+		s.scanner = pcapng.NewScanner(s.block)
+	}
+	switch sse := q.Get("sse"); sse {
+	case "":
+	case "s3":
+		s.opts.ServerSideEncryption = encrypt.NewSSE()
+	case "kms":
+		s.opts.ServerSideEncryption, err = encrypt.NewSSEKMS(q.Get("kms-key-id"), nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 sink SSE-KMS: %w", err)
+		}
+	case "c":
+		key, err := base64.StdEncoding.DecodeString(os.Getenv(S3SSECKeyEnv))
+		if err != nil {
+			return nil, fmt.Errorf("invalid $%s: %w", S3SSECKeyEnv, err)
+		}
+		s.opts.ServerSideEncryption, err = encrypt.NewSSEC(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $%s: %w", S3SSECKeyEnv, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid S3 sink sse %q, must be s3, kms, or c", sse)
+	}
+	s.start()
+	return s, nil
+}
+
+// Write writes the octets to the current object upload. When rotating, the
+// octets are first scanned for complete pcapng blocks.
+func (s *s3sink) Write(p []byte) (int, error) {
+	if s.scanner != nil {
+		return s.scanner.Write(p)
+	}
+	return s.upload.write(p)
+}
+
+// Close finishes the current object upload, returning any upload error.
+func (s *s3sink) Close() error {
+	if s.upload == nil {
+		return nil
+	}
+	var err error
+	if s.scanner != nil {
+		err = s.scanner.Close()
+	}
+	return errors.Join(err, s.finish())
+}
+
+// block writes a single pcapng block to the current object, rotating to a new
+// object beforehand if the current object has become too large.
+func (s *s3sink) block(b *pcapng.Block) error {
+	octets := b.Bytes()
+	if s.upload.size >= s.rotateSize {
+		if err := s.finish(); err != nil {
+			return err
+		}
+		s.start()
+		if b.Type != pcapng.BlockSHB {
+			for _, hdr := range s.header {
+				if _, err := s.upload.write(hdr); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	switch b.Type {
+	case pcapng.BlockSHB:
+		s.header = [][]byte{octets}
+	case pcapng.BlockIDB:
+		s.header = append(s.header, octets)
+	}
+	_, err := s.upload.write(octets)
+	return err
+}
+
+// start starts a new streaming multipart object upload.
+func (s *s3sink) start() {
+	key := s.key
+	if s.rotateSize > 0 {
+		ext := path.Ext(key)
+		key = fmt.Sprintf("%s-%05d%s", strings.TrimSuffix(key, ext), s.objects+1, ext)
+	}
+	s.objects++
+	pr, pw := io.Pipe()
+	up := &s3upload{w: pw, done: make(chan error, 1)}
+	log.Debugf("uploading packet capture to s3://%s/%s", s.bucket, key)
+	go func() {
+		_, err := s.client.PutObject(context.Background(), s.bucket, key, pr, -1, s.opts)
+		if err != nil {
+			err = fmt.Errorf("cannot upload s3://%s/%s: %w", s.bucket, key, err)
+		}
+		pr.CloseWithError(err)
+		up.done <- err
+	}()
+	s.upload = up
+}
+
+// finish finishes the current object upload and waits for it to complete.
+func (s *s3sink) finish() error {
+	up := s.upload
+	s.upload = nil
+	up.w.Close()
+	return <-up.done
+}
+
+// write writes to the object upload, keeping track of the object size.
+func (u *s3upload) write(p []byte) (int, error) {
+	n, err := u.w.Write(p)
+	u.size += int64(n)
+	return n, err
+}
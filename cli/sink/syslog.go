@@ -0,0 +1,254 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sink
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/packet"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// Syslog sink defaults.
+const (
+	DefaultSyslogPort         = "514"
+	DefaultSyslogFlowInterval = 10 * time.Second
+	syslogFacilityLocal0      = 16
+	syslogSeverityInfo        = 6
+	syslogMaxMessageSize      = 1024 // stay well below UDP fragmentation.
+)
+
+func init() {
+	plugger.Group[cli.NewSink]().Register(NewSyslogSink, plugger.WithPlugin("syslog"))
+}
+
+// syslogsink forwards one-line packet or flow summaries to a syslog collector
+// via UDP, instead of the full packets.
+type syslogsink struct {
+	conn     net.Conn
+	pri      int
+	hostname string
+	target   string // capture target name of the current section, if known.
+	scanner  *pcapng.Scanner
+	failed   bool // already warned about failing to forward.
+
+	flows    map[syslogFlowKey]*syslogFlow // nil in packet mode.
+	interval time.Duration
+	mu       sync.Mutex
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// syslogFlowKey identifies a flow in terms of its network and transport layer
+// endpoints.
+type syslogFlowKey struct {
+	target  string
+	summary string
+}
+
+// syslogFlow counts the packets and octets of a flow.
+type syslogFlow struct {
+	packets int
+	octets  int
+}
+
+// NewSyslogSink returns a sink forwarding packet summaries to a syslog
+// collector for “syslog://host[:port]” destinations, using UDP and RFC 5424
+// messages. The following query parameters are supported:
+//   - mode: "packets" (default) forwards a summary per packet; "flows"
+//     forwards per-flow packet and octet counts at the end of each flow
+//     interval.
+//   - flow-interval: the flow interval, such as "1m", defaulting to 10s.
+//   - facility: "local0" (default) to "local7".
+func NewSyslogSink(dest string) (io.WriteCloser, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "syslog" {
+		return nil, nil
+	}
+	if u.Hostname() == "" || strings.TrimPrefix(u.Path, "/") != "" {
+		return nil, fmt.Errorf("invalid syslog sink %q, expecting syslog://host[:port]", dest)
+	}
+	q := u.Query()
+	facility := syslogFacilityLocal0
+	if f := q.Get("facility"); f != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(f, "local"))
+		if err != nil || !strings.HasPrefix(f, "local") || n < 0 || n > 7 {
+			return nil, fmt.Errorf("invalid syslog sink facility %q, must be local0 to local7", f)
+		}
+		facility += n
+	}
+	s := &syslogsink{
+		pri:      facility*8 + syslogSeverityInfo,
+		hostname: "-",
+		done:     make(chan struct{}),
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		s.hostname = hostname
+	}
+	switch mode := q.Get("mode"); mode {
+	case "", "packets":
+	case "flows":
+		s.flows = map[syslogFlowKey]*syslogFlow{}
+		s.interval = DefaultSyslogFlowInterval
+		if interval := q.Get("flow-interval"); interval != "" {
+			s.interval, err = time.ParseDuration(interval)
+			if err != nil || s.interval <= 0 {
+				return nil, fmt.Errorf("invalid syslog sink flow-interval %q", interval)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid syslog sink mode %q, must be packets or flows", mode)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), DefaultSyslogPort)
+	}
+	log.Debugf("forwarding packet summaries to syslog collector %s", host)
+	s.conn, err = net.DialTimeout("udp", host, dialTimeout())
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to syslog sink: %w", err)
+	}
+	s.scanner = pcapng.NewScanner(s.block)
+	if s.flows != nil {
+		s.wg.Add(1)
+		go s.flush()
+	}
+	return s, nil
+}
+
+// Write scans the octets of the pcapng stream for packets.
+func (s *syslogsink) Write(p []byte) (int, error) {
+	return s.scanner.Write(p)
+}
+
+// Close forwards any remaining flow summaries and then closes the connection
+// to the syslog collector.
+func (s *syslogsink) Close() error {
+	err := s.scanner.Close()
+	if s.flows != nil {
+		close(s.done)
+		s.wg.Wait()
+		s.sendFlows()
+	}
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// block summarizes packets, keeping track of the capture target name.
+func (s *syslogsink) block(b *pcapng.Block) error {
+	switch b.Type {
+	case pcapng.BlockSHB:
+		s.target = ""
+		if ci, _ := pcapng.ParseContainerInfo(s.scanner.SectionHeader().Comment()); ci != nil {
+			s.target = ci.ContainerName
+		}
+		return nil
+	case pcapng.BlockEPB:
+	default:
+		return nil
+	}
+	epb, err := b.EnhancedPacket()
+	if err != nil {
+		return err
+	}
+	idb := s.scanner.Interface(epb.InterfaceID)
+	if idb == nil {
+		return fmt.Errorf("packet references unknown interface %d", epb.InterfaceID)
+	}
+	summary, ok := packet.Decode(idb.LinkType, epb.Data)
+	if !ok {
+		return nil
+	}
+	if s.flows == nil {
+		s.send(idb.Time(epb.Timestamp), fmt.Sprintf("%s%s len=%d",
+			s.targetPrefix(s.target), summary.String(), epb.OriginalLength))
+		return nil
+	}
+	key := syslogFlowKey{target: s.target, summary: summary.String()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flow := s.flows[key]
+	if flow == nil {
+		flow = &syslogFlow{}
+		s.flows[key] = flow
+	}
+	flow.packets++
+	flow.octets += int(epb.OriginalLength)
+	return nil
+}
+
+// flush periodically forwards the flow summaries until the sink gets closed.
+func (s *syslogsink) flush() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.sendFlows()
+		}
+	}
+}
+
+// sendFlows forwards the summaries of the flows seen since the last flow
+// interval and then starts a new flow interval.
+func (s *syslogsink) sendFlows() {
+	s.mu.Lock()
+	flows := s.flows
+	s.flows = map[syslogFlowKey]*syslogFlow{}
+	s.mu.Unlock()
+	keys := make([]syslogFlowKey, 0, len(flows))
+	for key := range flows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		return flows[keys[a]].octets > flows[keys[b]].octets
+	})
+	now := time.Now()
+	for _, key := range keys {
+		flow := flows[key]
+		s.send(now, fmt.Sprintf("%s%s packets=%d octets=%d",
+			s.targetPrefix(key.target), key.summary, flow.packets, flow.octets))
+	}
+}
+
+// targetPrefix returns the message prefix for the specified capture target,
+// if known.
+func (s *syslogsink) targetPrefix(target string) string {
+	if target == "" {
+		return ""
+	}
+	return "target=" + strconv.Quote(target) + " "
+}
+
+// send sends a single RFC 5424 syslog message. As syslog via UDP is lossy
+// anyway, failing to send doesn't end the capture, but only gets logged once.
+func (s *syslogsink) send(ts time.Time, msg string) {
+	line := fmt.Sprintf("<%d>1 %s %s csharg %d - - %s",
+		s.pri, ts.UTC().Format(time.RFC3339Nano), s.hostname, os.Getpid(), msg)
+	if len(line) > syslogMaxMessageSize {
+		line = line[:syslogMaxMessageSize]
+	}
+	if _, err := s.conn.Write([]byte(line)); err != nil && !s.failed {
+		s.failed = true
+		log.Warnf("cannot forward to syslog sink: %s", err)
+	}
+}
@@ -0,0 +1,52 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package sink
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/siemens/csharg/cli"
+	"github.com/siemens/csharg/cli/command"
+	log "github.com/sirupsen/logrus"
+	"github.com/thediveo/go-plugger/v3"
+)
+
+// DefaultDialTimeout limits connecting to remote sinks, unless a request
+// timeout has been specified.
+const DefaultDialTimeout = 10 * time.Second
+
+func init() {
+	plugger.Group[cli.NewSink]().Register(NewTCPSink, plugger.WithPlugin("tcp"))
+}
+
+// NewTCPSink returns a sink streaming to a TCP server for “tcp://host:port”
+// destinations, such as a remote “nc -l”.
+func NewTCPSink(dest string) (io.WriteCloser, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "tcp" {
+		return nil, nil
+	}
+	if u.Port() == "" || u.Path != "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("invalid TCP sink %q, expecting tcp://host:port", dest)
+	}
+	log.Debugf("connecting to TCP sink %s", u.Host)
+	conn, err := net.DialTimeout("tcp", u.Host, dialTimeout())
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to TCP sink: %w", err)
+	}
+	return conn, nil
+}
+
+// dialTimeout returns the timeout for connecting to remote sinks.
+func dialTimeout() time.Duration {
+	if command.ReqTimeout != 0 {
+		return command.ReqTimeout
+	}
+	return DefaultDialTimeout
+}
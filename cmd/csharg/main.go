@@ -9,7 +9,9 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"os/exec"
 
 	// Pull in all command packages which define sub-commands: they will
 	// register themselves as needed, but we need the packages to get included,
@@ -19,6 +21,7 @@ import (
 	_ "github.com/siemens/csharg/cli/command/capture"
 
 	_ "github.com/siemens/csharg/cli/sharktank" // stand-alone host
+	_ "github.com/siemens/csharg/cli/sink"      // builtin output sinks
 
 	log "github.com/sirupsen/logrus"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
@@ -33,11 +36,27 @@ func main() {
 	f.TimestampFormat = "15:04:05"
 	log.SetFormatter(f)
 
+	rootCmd := command.SetupCLI()
+	// Unknown commands might be provided by external plugin executables on the
+	// PATH instead, so give them a try first; we pass on the exit code of the
+	// external plugin.
+	if ran, err := command.RunExternalPlugin(rootCmd, os.Args[1:]); ran {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	// This is cobra boilerplate documentation, except for the missing call to
 	// fmt.Println(err) which in the original boilerplate is just plain wrong:
 	// it renders the error message twice, see also:
 	// https://github.com/spf13/cobra/issues/304
-	if err := command.SetupCLI().Execute(); err != nil {
+	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
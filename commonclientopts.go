@@ -8,7 +8,12 @@
 
 package csharg
 
-import "time"
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+)
 
 // CommonClientOptions defines options common to all cluster capture client
 // types.
@@ -16,9 +21,79 @@ type CommonClientOptions struct {
 	// BearerToken optionally specifies the bearer token to use when talking to
 	// the cluster capture service, regardless of how we reach the service.
 	BearerToken string
+	// Username and Password optionally specify HTTP basic authentication
+	// credentials, such as for capture services fronted by reverse proxies
+	// with simple authentication. A bearer token takes precedence.
+	Username string
+	Password string
+	// Negotiate optionally returns SPNEGO tokens for Kerberos-based
+	// authentication ("Negotiate"), such as in Windows-integrated enterprise
+	// environments, when neither a bearer token nor basic authentication
+	// credentials have been specified.
+	Negotiate NegotiateFunc
 	// Timeout specifies a time limit for requests made to the SharkTank cluster
 	// capture service. For discovery it limits the time allowed to complete a
 	// discovery request and response. For capturing it limits just the
 	// connection establishing phase, including the web socket handshake phase.
+	// Timeout is the default for DiscoveryTimeout and CaptureHandshakeTimeout,
+	// but not for StallTimeout.
 	Timeout time.Duration
+	// DiscoveryTimeout optionally overrides Timeout for discovery requests,
+	// such as allowing for longer discoveries in huge clusters.
+	DiscoveryTimeout time.Duration
+	// CaptureHandshakeTimeout optionally overrides Timeout for establishing
+	// capture stream connections, including the web socket handshake phase.
+	CaptureHandshakeTimeout time.Duration
+	// StallTimeout optionally aborts capture streams when no capture data
+	// arrives for this duration, such as when connections silently break
+	// behind NAT gateways. Zero means capture streams can stall forever.
+	// Please note that captures with restrictive capture filters might not
+	// see any packets for longer periods of time.
+	StallTimeout time.Duration
+	// Namespace optionally specifies the namespace of pods named without an
+	// explicit namespace, instead of the “default” namespace, as many
+	// clusters forbid using the “default” namespace.
+	Namespace string
+}
+
+// NegotiateFunc returns a fresh initial SPNEGO token for authenticating with
+// the service identified by the specified service principal name, such as
+// "HTTP/capture.example.org".
+type NegotiateFunc func(spn string) ([]byte, error)
+
+// discoveryTimeout returns the time limit for discovery requests.
+func (o *CommonClientOptions) discoveryTimeout() time.Duration {
+	if o.DiscoveryTimeout != 0 {
+		return o.DiscoveryTimeout
+	}
+	return o.Timeout
+}
+
+// handshakeTimeout returns the time limit for establishing capture stream
+// connections.
+func (o *CommonClientOptions) handshakeTimeout() time.Duration {
+	if o.CaptureHandshakeTimeout != 0 {
+		return o.CaptureHandshakeTimeout
+	}
+	return o.Timeout
+}
+
+// authorize sets the Authorization header for the bearer token, otherwise the
+// basic authentication credentials, or otherwise a fresh SPNEGO token for the
+// specified service principal name, if any.
+func (o *CommonClientOptions) authorize(h http.Header, spn string) error {
+	switch {
+	case o.BearerToken != "":
+		h.Set("Authorization", "Bearer "+o.BearerToken)
+	case o.Username != "":
+		h.Set("Authorization", "Basic "+
+			base64.StdEncoding.EncodeToString([]byte(o.Username+":"+o.Password)))
+	case o.Negotiate != nil:
+		token, err := o.Negotiate(spn)
+		if err != nil {
+			return fmt.Errorf("SPNEGO authentication for %s failed: %w", spn, err)
+		}
+		h.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(token))
+	}
+	return nil
 }
@@ -0,0 +1,131 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// slowWriter is a syncBuffer taking its time for each write.
+type slowWriter struct {
+	syncBuffer
+	delay time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.syncBuffer.Write(p)
+}
+
+var _ = Describe("capture alerts", func() {
+
+	foo := dockerTarget("foo")
+
+	b := pcapngtest.New(binary.LittleEndian)
+	drops := b.SHB().
+		IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0")).
+		EPB(0, 1, []byte{1}).
+		ISB(0, b.Counter(pcapng.OptISBIfDrop, 5)).
+		EPB(0, 2, []byte{2}).
+		ISB(0, b.Counter(pcapng.OptISBIfDrop, 8)).
+		ISB(0, b.Counter(pcapng.OptISBIfDrop, 8)).
+		Bytes()
+
+	It("alerts about increased packet drops", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(drops, 11), End: true})
+		var mu sync.Mutex
+		var alerts []csharg.DropAlert
+		cs, err := st.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{
+			Alerts: &csharg.CaptureAlerts{
+				OnDrop: func(drop csharg.DropAlert) {
+					mu.Lock()
+					defer mu.Unlock()
+					alerts = append(alerts, drop)
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(alerts).To(HaveExactElements(
+			csharg.DropAlert{Interface: "eth0", Dropped: 5, Delta: 5},
+			csharg.DropAlert{Interface: "eth0", Dropped: 8, Delta: 3},
+		))
+	})
+
+	It("alerts about packet drops from capture services", func() {
+		st, srv := serve(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(drops, 11), End: true})
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		dropped := make(chan csharg.DropAlert, 10)
+		cs, err := client.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{
+			Alerts: &csharg.CaptureAlerts{
+				OnDrop: func(drop csharg.DropAlert) { dropped <- drop },
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+		Expect(dropped).To(HaveLen(2))
+	})
+
+	It("alerts about stalls once per stall", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(drops, 32)})
+		stalls := make(chan time.Duration, 10)
+		cs, err := st.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{
+			Alerts: &csharg.CaptureAlerts{
+				StallAfter: 100 * time.Millisecond,
+				OnStall:    func(stalled time.Duration) { stalls <- stalled },
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer cs.Stop()
+		var stalled time.Duration
+		Eventually(stalls, "2s").Should(Receive(&stalled))
+		Expect(stalled).To(BeNumerically(">=", 100*time.Millisecond))
+		Consistently(stalls, 300*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("alerts about slow writes, but not as stalls", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(drops, 64), End: true})
+		slow := make(chan time.Duration, 100)
+		stalls := make(chan time.Duration, 100)
+		cs, err := st.Capture(&slowWriter{delay: 100 * time.Millisecond}, foo, &csharg.CaptureOptions{
+			Raw: true,
+			Alerts: &csharg.CaptureAlerts{
+				StallAfter:  50 * time.Millisecond,
+				OnStall:     func(stalled time.Duration) { stalls <- stalled },
+				SlowWrite:   50 * time.Millisecond,
+				OnSlowWrite: func(took time.Duration) { slow <- took },
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+		Expect(len(slow)).To(BeNumerically(">=", 1))
+		Expect(stalls).To(BeEmpty())
+	})
+
+	It("rejects negative alert thresholds", func() {
+		Expect((&csharg.CaptureOptions{Alerts: &csharg.CaptureAlerts{
+			StallAfter: -time.Second,
+			SlowWrite:  -time.Second,
+		}}).Validate()).To(MatchError(
+			"alerts.stallafter: invalid negative value -1s\nalerts.slowwrite: invalid negative value -1s"))
+	})
+
+})
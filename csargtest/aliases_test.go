@@ -0,0 +1,102 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("interface aliases", func() {
+
+	host := &api.Target{
+		Name: "node-1", Type: api.TypeProc, NodeName: "node-1", NetNS: 1,
+		NetworkInterfaces: []string{"lo", "cni0", "veth1a2b3c", "veth4d5e6f@if3", "vethdead"},
+		InterfaceDetails: map[string]api.InterfaceDetails{
+			"veth1a2b3c":     {Master: "cni0", PeerNetNS: 42},
+			"veth4d5e6f@if3": {Master: "cni0", PeerNetNS: 43},
+			"vethdead":       {PeerNetNS: 666},
+		},
+	}
+	web := &api.Target{
+		Name: "web", Namespace: "default", Type: api.TypePod, NodeName: "node-1", NetNS: 42,
+		NetworkInterfaces: []string{"lo", "eth0@if12"},
+		InterfaceDetails: map[string]api.InterfaceDetails{
+			"eth0@if12": {PeerNetNS: 1},
+		},
+	}
+	webctr := &api.Target{Name: "k8s_web", Type: api.TypeDocker, NodeName: "node-1", NetNS: 42}
+	db := &api.Target{Name: "db", Type: api.TypeDocker, NodeName: "node-1", NetNS: 43}
+	elsewhere := &api.Target{Name: "db", Type: api.TypeDocker, NodeName: "node-2", NetNS: 666}
+	targets := api.Targets{host, webctr, web, db, elsewhere}
+
+	It("derives aliases from peers and bridges", func() {
+		Expect(csharg.InterfaceAliases(nil, targets)).To(BeEmpty())
+		Expect(csharg.InterfaceAliases(host, targets)).To(Equal(map[string]string{
+			"veth1a2b3c":     "veth1a2b3c (default/web, bridge cni0)",
+			"veth4d5e6f@if3": "veth4d5e6f (db, bridge cni0)",
+		}))
+		Expect(csharg.InterfaceAliases(web, targets)).To(Equal(map[string]string{
+			"eth0@if12": "eth0 (node-1)",
+		}))
+		Expect(csharg.InterfaceAliases(web, nil)).To(Equal(map[string]string{
+			"eth0@if12": "eth0",
+		}))
+	})
+
+	It("renames interfaces in captures and records the aliases", func() {
+		b := pcapngtest.New(binary.LittleEndian)
+		stream := b.SHB().
+			IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("lo")).
+			IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0@if12")).
+			EPB(1, 1, []byte{1, 2, 3}).
+			Bytes()
+		st, srv := serve(host, web)
+		st.SetStream("default/web", &Stream{Chunks: pcapngtest.Chunk(stream, 7), End: true})
+		srv.SetSchemaVersion(2)
+
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		discovered := client.Targets()
+		var target *api.Target
+		for _, t := range discovered {
+			if t.QualifiedName() == "default/web" {
+				target = t
+			}
+		}
+		Expect(target).NotTo(BeNil())
+		Expect(target.InterfaceDetails).To(Equal(web.InterfaceDetails))
+
+		aliases := csharg.InterfaceAliases(target, discovered)
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, target, &csharg.CaptureOptions{InterfaceAliases: aliases})
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+
+		r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+		for {
+			if _, err := r.Next(); err != nil {
+				break
+			}
+		}
+		Expect(r.Interfaces()).To(HaveLen(2))
+		Expect(r.Interface(0).Name()).To(Equal("lo"))
+		Expect(r.Interface(1).Name()).To(Equal("eth0 (node-1)"))
+		Expect(r.Interface(1).Description()).To(Equal("eth0@if12"))
+		ci, err := pcapng.ParseContainerInfo(r.SectionHeader().Comment())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ci.InterfaceAliases).To(Equal(map[string]string{"eth0@if12": "eth0 (node-1)"}))
+	})
+
+})
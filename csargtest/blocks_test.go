@@ -0,0 +1,86 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/siemens/csharg/pcapng"
+
+	. "github.com/onsi/gomega"
+)
+
+// eachBlock calls fn for each pcapng block of the specified packet capture
+// stream, returning the error of the first malformed block, if any.
+func eachBlock(stream []byte, fn func(r *pcapng.Reader, b *pcapng.Block)) error {
+	r := pcapng.NewReader(bytes.NewReader(stream))
+	for {
+		b, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(r, b)
+	}
+}
+
+// packets returns the number of packets in the specified packet capture
+// stream.
+func packets(stream []byte) int {
+	n := 0
+	ExpectWithOffset(1, eachBlock(stream, func(_ *pcapng.Reader, b *pcapng.Block) {
+		if b.Type == pcapng.BlockEPB {
+			n++
+		}
+	})).To(Succeed())
+	return n
+}
+
+// packetData returns the (captured) data of the packets in the specified
+// packet capture stream.
+func packetData(stream []byte) [][]byte {
+	var data [][]byte
+	ExpectWithOffset(1, eachBlock(stream, func(_ *pcapng.Reader, b *pcapng.Block) {
+		if b.Type == pcapng.BlockEPB {
+			epb, err := b.EnhancedPacket()
+			ExpectWithOffset(2, err).NotTo(HaveOccurred())
+			data = append(data, append([]byte(nil), epb.Data...))
+		}
+	})).To(Succeed())
+	return data
+}
+
+// blockTypes returns the types of the blocks in the specified packet capture
+// stream, as well as the number of delivered packets according to the last
+// interface statistics block.
+func blockTypes(stream []byte) ([]uint32, uint64) {
+	types := []uint32{}
+	var delivered uint64
+	ExpectWithOffset(1, eachBlock(stream, func(r *pcapng.Reader, b *pcapng.Block) {
+		types = append(types, b.Type)
+		if b.Type == pcapng.BlockISB {
+			isb, err := b.InterfaceStatistics()
+			ExpectWithOffset(2, err).NotTo(HaveOccurred())
+			delivered, _ = isb.Counter(pcapng.OptISBUsrDeliv, r.Endian())
+		}
+	})).To(Succeed())
+	return types, delivered
+}
+
+// heartbeats returns the number of heartbeats in the specified packet capture
+// stream, which might still be in the middle of being written.
+func heartbeats(stream []byte) int {
+	count := 0
+	_ = eachBlock(stream, func(_ *pcapng.Reader, b *pcapng.Block) {
+		if b.Type == pcapng.BlockISB && bytes.Contains(b.Body, []byte(pcapng.HeartbeatComment)) {
+			count++
+		}
+	})
+	return count
+}
@@ -0,0 +1,171 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// blockingWriter blocks writes until released.
+type blockingWriter struct {
+	release chan struct{}
+	syncBuffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.syncBuffer.Write(p)
+}
+
+var _ = Describe("broadcasting captures", func() {
+
+	It("broadcasts to consumers attaching at any time", func() {
+		b := csharg.NewBroadcaster(nil)
+		var early, late syncBuffer
+		c1 := b.Attach(&early)
+		Expect(b.Consumers()).To(Equal(1))
+
+		first := pcapngtest.New(binary.LittleEndian).
+			SHB().IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0")).
+			EPB(0, 1, []byte{1}).Bytes()
+		_, err := b.Write(first[:7])
+		Expect(err).NotTo(HaveOccurred())
+		_, err = b.Write(first[7:])
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int { return packets(early.Bytes()) }).Should(Equal(1))
+
+		c2 := b.Attach(&late)
+		_, err = b.Write(pcapngtest.New(binary.LittleEndian).EPB(0, 2, []byte{2}).Bytes())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.Close()).To(Succeed())
+		Eventually(c1.Done()).Should(BeClosed())
+		Eventually(c2.Done()).Should(BeClosed())
+		Expect(c1.Err()).NotTo(HaveOccurred())
+		Expect(c2.Err()).NotTo(HaveOccurred())
+
+		Expect(packets(early.Bytes())).To(Equal(2))
+		Expect(packets(late.Bytes())).To(Equal(1))
+
+		Expect(b.Write([]byte{0})).Error().To(MatchError(csharg.ErrBroadcastClosed))
+		c3 := b.Attach(&syncBuffer{})
+		Expect(c3.Done()).To(BeClosed())
+		Expect(c3.Err()).To(MatchError(csharg.ErrBroadcastClosed))
+	})
+
+	It("drops packets only for slow consumers", func() {
+		b := csharg.NewBroadcaster(&csharg.BroadcasterOptions{QueueLength: 2})
+		slow := &blockingWriter{release: make(chan struct{})}
+		var fast syncBuffer
+		cslow := b.Attach(slow)
+		cfast := b.Attach(&fast)
+		timestamps := []uint64{}
+		for ts := uint64(1); ts <= 100; ts++ {
+			timestamps = append(timestamps, ts)
+		}
+		for _, chunk := range pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, timestamps...), 64) {
+			_, err := b.Write(chunk)
+			Expect(err).NotTo(HaveOccurred())
+			// Give the fast consumer a chance to keep up.
+			time.Sleep(time.Millisecond)
+		}
+		close(slow.release)
+		Expect(b.Close()).To(Succeed())
+		Eventually(cfast.Done()).Should(BeClosed())
+		Eventually(cslow.Done()).Should(BeClosed())
+
+		Expect(packets(fast.Bytes())).To(Equal(100))
+		Expect(cfast.Dropped()).To(BeZero())
+		Expect(cslow.Dropped()).NotTo(BeZero())
+		Expect(packets(slow.Bytes())).To(BeNumerically("<", 100))
+	})
+
+	It("detaches consumers", func() {
+		b := csharg.NewBroadcaster(nil)
+		c := b.Attach(&syncBuffer{})
+		c.Detach()
+		c.Detach()
+		Eventually(c.Done()).Should(BeClosed())
+		Expect(b.Consumers()).To(BeZero())
+	})
+
+	It("follows captures", func() {
+		foo := &api.Target{Name: "foo", Type: api.TypeDocker}
+		st := New(foo)
+		st.SetStream("foo", &Stream{
+			Chunks:   pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, 1, 2, 3), 13),
+			Interval: 10 * time.Millisecond,
+			End:      true,
+		})
+		b := csharg.NewBroadcaster(nil)
+		var buff syncBuffer
+		c := b.Attach(&buff)
+		cs, err := st.Capture(b, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		b.Follow(cs)
+		Eventually(c.Done(), "5s").Should(BeClosed())
+		Expect(packets(buff.Bytes())).To(Equal(3))
+
+		st.SetStream("foo", nil)
+		b = csharg.NewBroadcaster(nil)
+		c = b.Attach(&syncBuffer{})
+		cs, err = st.Capture(b, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		b.Follow(cs)
+		Consistently(c.Done(), "100ms").ShouldNot(BeClosed())
+		b.Stop()
+		Eventually(c.Done()).Should(BeClosed())
+	})
+
+	It("serves HTTP and websocket clients", func() {
+		b := csharg.NewBroadcaster(nil)
+		srv := httptest.NewServer(b)
+		DeferCleanup(srv.Close)
+		stream := pcapngtest.Capture(binary.BigEndian, 1, 2)
+
+		resp, err := http.Get(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get("Content-Type")).To(Equal(csharg.CaptureStreamMediaType))
+
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer ws.Close()
+
+		Eventually(b.Consumers).Should(Equal(2))
+		_, err = b.Write(stream)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.Close()).To(Succeed())
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packets(body)).To(Equal(2))
+
+		var wsstream []byte
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				Expect(websocket.IsCloseError(err, websocket.CloseNormalClosure)).To(BeTrue())
+				break
+			}
+			wsstream = append(wsstream, msg...)
+		}
+		Expect(packets(wsstream)).To(Equal(2))
+	})
+
+})
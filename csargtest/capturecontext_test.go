@@ -0,0 +1,128 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("deadline-driven captures", func() {
+
+	foo := &api.Target{Name: "foo", Type: api.TypeDocker, NodeName: "node"}
+
+	// unfinished is a capture stream without final statistics.
+	unfinished := pcapngtest.New(binary.LittleEndian).
+		SHB().IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0")).
+		EPB(0, 1, []byte{1}).EPB(0, 2, []byte{2}).Bytes()
+
+	It("finalizes captures when the deadline fires", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(unfinished, 13)})
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var buff syncBuffer
+		cs, err := csharg.CaptureContext(ctx, st, &buff, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Wait()
+		}()
+		Eventually(done).Should(BeClosed())
+		types, delivered := blockTypes(buff.Bytes())
+		Expect(types).To(Equal([]uint32{
+			pcapng.BlockSHB, pcapng.BlockIDB, pcapng.BlockEPB, pcapng.BlockEPB, pcapng.BlockISB}))
+		Expect(delivered).To(Equal(uint64(2)))
+		cs.Stop()
+	})
+
+	It("keeps the final statistics of captures ending before the deadline", func() {
+		st := New(foo)
+		stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		var buff syncBuffer
+		cs, err := csharg.CaptureContainerContext(context.Background(), st, &buff, "node", "foo", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		types, _ := blockTypes(buff.Bytes())
+		Expect(types).To(HaveLen(6))
+		Expect(types[5]).To(Equal(pcapng.BlockISB))
+	})
+
+	It("finalizes captures when stopped", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(unfinished, 13)})
+		var buff syncBuffer
+		cs, err := csharg.CaptureContext(context.Background(), st, &buff, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int { return len(buff.Bytes()) }).Should(BeNumerically(">=", len(unfinished)))
+		cs.Stop()
+		types, _ := blockTypes(buff.Bytes())
+		Expect(types[len(types)-1]).To(Equal(pcapng.BlockISB))
+	})
+
+	It("doesn't finalize raw captures", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(unfinished, 13)})
+		var buff syncBuffer
+		cs, err := csharg.CaptureContext(context.Background(), st, &buff, foo, &csharg.CaptureOptions{Raw: true})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int { return len(buff.Bytes()) }).Should(BeNumerically(">=", len(unfinished)))
+		cs.Stop()
+		Expect(buff.Bytes()).To(Equal(unfinished))
+	})
+
+	It("stops captures gracefully when reaching the output limit", func() {
+		b := pcapngtest.New(binary.LittleEndian).
+			SHB().IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0"))
+		for ts := uint64(1); ts <= 50; ts++ {
+			b.EPB(0, ts, make([]byte, 60))
+		}
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(b.Bytes(), 100)})
+		var buff syncBuffer
+		cs, err := csharg.CaptureContext(context.Background(), st, &buff, foo,
+			&csharg.CaptureOptions{MaxOutput: 1000})
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Wait()
+		}()
+		Eventually(done, "5s").Should(BeClosed())
+		types, delivered := blockTypes(buff.Bytes())
+		Expect(types[len(types)-1]).To(Equal(pcapng.BlockISB))
+		epbs := uint64(len(types) - 3) // SHB, IDB, ..., ISB
+		Expect(epbs).To(BeNumerically(">", 0))
+		Expect(epbs).To(BeNumerically("<", 50))
+		Expect(delivered).To(Equal(epbs))
+		// Only the final statistics appended after stopping may exceed the
+		// limit; the final block total length trails the stream.
+		out := buff.Bytes()
+		isb := binary.LittleEndian.Uint32(out[len(out)-4:])
+		Expect(len(out) - int(isb)).To(BeNumerically("<=", 1000))
+		cs.Stop()
+	})
+
+	It("doesn't capture with a done context", func() {
+		st := New(foo)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(csharg.CaptureContext(ctx, st, &bytes.Buffer{}, foo, nil)).Error().To(MatchError(context.Canceled))
+		Expect(st.Captures()).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,155 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var errDiskFull = errors.New("disk full")
+
+// failingWriter fails all writes.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errDiskFull }
+
+var _ = Describe("capture failures", func() {
+
+	foo := dockerTarget("foo")
+	bar := dockerTarget("bar")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo, bar)
+	})
+
+	newClient := func(transport csharg.CaptureTransport, stall time.Duration) csharg.SharkTank {
+		srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+		srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{
+				Timeout:      5 * time.Second,
+				StallTimeout: stall,
+			},
+			Transport: transport,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	// waitErr returns a channel receiving why the capture failed, once it
+	// terminated.
+	waitErr := func(cs csharg.CaptureStreamer) <-chan error {
+		errch := make(chan error, 1)
+		go func() { errch <- cs.WaitErr() }()
+		return errch
+	}
+
+	DescribeTable("reports no failure for gracefully ended and stopped captures",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport, 0)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+			cs, err := client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(waitErr(cs), "5s").Should(Receive(BeNil()))
+
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			cs, err = client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cs.Err()).To(BeNil())
+			Expect(cs.StopErr()).To(Succeed())
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	DescribeTable("reports broken capture streams",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport, 0)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			srv.SetFaults(Fault{Kind: FaultDisconnect, After: 2})
+			cs, err := client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			var cerr error
+			Eventually(waitErr(cs), "5s").Should(Receive(&cerr))
+			var capErr *csharg.CaptureError
+			Expect(errors.As(cerr, &capErr)).To(BeTrue())
+			Expect(capErr.Op).To(Equal("receive"))
+			Expect(cs.StopErr()).To(Equal(cerr))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	DescribeTable("reports stalled capture streams",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport, 200*time.Millisecond)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			srv.SetFaults(Fault{Kind: FaultStall, After: 1, Duration: time.Hour})
+			cs, err := client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(waitErr(cs), "5s").Should(Receive(MatchError(csharg.ErrStalled)))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+	)
+
+	DescribeTable("reports failing writers",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport, 0)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			cs, err := client.Capture(failingWriter{}, foo, &csharg.CaptureOptions{Raw: true})
+			Expect(err).NotTo(HaveOccurred())
+			var cerr error
+			Eventually(waitErr(cs), "5s").Should(Receive(&cerr))
+			Expect(cerr).To(MatchError(errDiskFull))
+			Expect(cerr).To(MatchError("cannot write capture stream: disk full"))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+	)
+
+	It("joins the failures of multiple targets", func() {
+		client := newClient(csharg.TransportWebsocket, 0)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		st.SetStream("bar", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+		srv.SetFaults(Fault{Kind: FaultDisconnect, Target: "bar", After: 2})
+		cs, err := client.CaptureMany(&syncBuffer{}, []*api.Target{foo, bar}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		var cerr error
+		Eventually(waitErr(cs), "5s").Should(Receive(&cerr))
+		var capErr *csharg.CaptureError
+		Expect(errors.As(cerr, &capErr)).To(BeTrue())
+		Expect(capErr.Op).To(Equal("receive"))
+	})
+
+	It("reports failing writers of scripted captures", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		cs, err := st.Capture(failingWriter{}, foo, &csharg.CaptureOptions{Raw: true})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitErr(cs), "5s").Should(Receive(MatchError(errDiskFull)))
+
+		st.SetStream("bar", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		cs, err = st.CaptureMany(failingWriter{}, []*api.Target{foo, bar}, &csharg.CaptureOptions{Raw: true})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitErr(cs), "5s").Should(Receive(MatchError(errDiskFull)))
+	})
+
+})
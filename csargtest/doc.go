@@ -0,0 +1,34 @@
+/*
+Package csargtest provides a configurable in-memory fake [csharg.SharkTank] for
+unit testing applications embedding csharg without a live capture service.
+
+The fake [SharkTank] serves a static list of capture targets and scripted
+capture [Stream]s, and allows injecting capture errors. Captures started on the
+fake are recorded, so tests can check the capture targets and options used:
+
+	st := csargtest.New(&api.Target{Name: "foo", Type: "docker", NodeName: "node"})
+	st.SetStream("foo", &csargtest.Stream{Chunks: [][]byte{pcapngdata}, End: true})
+	cs, err := st.Capture(&buff, st.Targets()[0], nil)
+	cs.Wait()
+
+Like real captures, the scripted capture streams are passed through the pcapng
+stream editor that adds the capture target information to the first section
+header block, so scripted streams should be valid pcapng streams.
+
+For end-to-end tests of the capture clients from the csharg package, [Server]
+simulates a Packetflix capture service with the GhostWire discovery service,
+serving the capture targets and scripted capture streams of a fake SharkTank
+over HTTP(S) and websockets:
+
+	srv := csargtest.NewServer(st)
+	defer srv.Close()
+	client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+
+In order to test capture clients under adverse conditions, the simulated
+capture service can inject [Fault]s, such as mid-stream disconnects, stalls,
+slow reads, malformed section headers, and rejecting reconnects as
+unauthorized:
+
+	srv.SetFaults(csargtest.Fault{Kind: csargtest.FaultDisconnect, After: 2})
+*/
+package csargtest
@@ -0,0 +1,130 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("typed errors", func() {
+
+	foo := dockerTarget("foo")
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+	})
+
+	newClient := func(url string, transport csharg.CaptureTransport, token string) csharg.SharkTank {
+		srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+		srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+		client, err := csharg.NewSharkTankOnHost(url, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{
+				Timeout:     5 * time.Second,
+				BearerToken: token,
+			},
+			Transport: transport,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	It("tells non-existing and ambiguous capture targets", func() {
+		st.SetTargets(
+			&api.Target{Name: "web", Type: api.TypeDocker, NetworkInterfaces: []string{"eth0"}, ContainerID: "4f1c0e2d9a7b"},
+			&api.Target{Name: "db", Type: api.TypeDocker, NetworkInterfaces: []string{"eth0"}, ContainerID: "4f2a"})
+		client := newClient(srv.URL, csharg.TransportWebsocket, "")
+		_, err := client.Capture(&syncBuffer{}, &api.Target{Name: "nope", Type: api.TypeDocker}, nil)
+		Expect(err).To(MatchError(csharg.ErrTargetNotFound))
+		Expect(err).To(MatchError(HavePrefix(`non-existing target "nope"`)))
+		Expect(client.CaptureContainer(&syncBuffer{}, "", "4f", nil)).Error().To(
+			MatchError(csharg.ErrAmbiguousTarget))
+
+		Expect(st.CaptureContainer(&syncBuffer{}, "", "4f", nil)).Error().To(
+			MatchError(csharg.ErrAmbiguousTarget))
+		Expect(st.CapturePod(&syncBuffer{}, "default/nope", nil)).Error().To(
+			MatchError(csharg.ErrTargetNotFound))
+	})
+
+	DescribeTable("tells unreachable capture services",
+		func(transport csharg.CaptureTransport) {
+			gone := NewServer(st)
+			url := gone.URL
+			gone.Close()
+			client := newClient(url, transport, "")
+			Expect(client.Capture(&syncBuffer{}, foo, nil)).Error().To(
+				MatchError(csharg.ErrServiceUnreachable))
+			Expect(client.CanCapture(foo)).To(MatchError(csharg.ErrServiceUnreachable))
+			_, err := client.TargetsContext(context.Background())
+			Expect(err).To(MatchError(csharg.ErrServiceUnreachable))
+			_, err = client.Capture(&syncBuffer{}, &api.Target{Name: "foo", Type: api.TypeDocker}, nil)
+			Expect(err).To(MatchError(csharg.ErrServiceUnreachable))
+			Expect(errors.Is(err, csharg.ErrTargetNotFound)).To(BeFalse())
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	DescribeTable("tells rejected credentials and denied captures",
+		func(transport csharg.CaptureTransport) {
+			srv.RequireBearerToken("t0k3n")
+			client := newClient(srv.URL, transport, "wr0ng")
+			_, err := client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).To(MatchError(csharg.ErrUnauthenticated))
+			Expect(err).To(MatchError(csharg.ErrUnauthorized))
+			Expect(errors.Is(err, csharg.ErrForbidden)).To(BeFalse())
+			_, err = client.TargetsContext(context.Background())
+			Expect(err).To(MatchError(csharg.ErrUnauthorized))
+
+			client = newClient(srv.URL, transport, "t0k3n")
+			srv.SetFaults(Fault{Kind: FaultForbidden, Target: "foo"})
+			_, err = client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).To(MatchError(csharg.ErrForbidden))
+			Expect(err).To(MatchError(csharg.ErrUnauthorized))
+			Expect(client.CanCapture(foo)).To(MatchError(csharg.ErrUnauthorized))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("tells denied and failed discoveries", func() {
+		denying := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}))
+		defer denying.Close()
+		_, err := newClient(denying.URL, csharg.TransportWebsocket, "").TargetsContext(context.Background())
+		Expect(err).To(MatchError(csharg.ErrForbidden))
+		Expect(err).To(MatchError(csharg.ErrUnauthorized))
+
+		garbage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("garbage"))
+		}))
+		defer garbage.Close()
+		_, err = newClient(garbage.URL, csharg.TransportWebsocket, "").TargetsContext(context.Background())
+		Expect(err).To(MatchError(HavePrefix("cannot decode discovered targets: ")))
+	})
+
+	It("keeps the messages of authorization errors", func() {
+		Expect(csharg.ErrUnauthenticated.Error()).To(Equal("not authenticated"))
+		Expect(csharg.ErrForbidden.Error()).To(Equal("capture not permitted"))
+		Expect(errors.Is(csharg.ErrUnauthorized, csharg.ErrForbidden)).To(BeFalse())
+	})
+
+})
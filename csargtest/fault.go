@@ -0,0 +1,112 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"net/http"
+	"time"
+)
+
+// FaultKind identifies the kind of fault injected by the simulated capture
+// service.
+type FaultKind int
+
+// Fault kinds supported by the simulated capture service.
+const (
+	// FaultDisconnect abruptly drops the connection of a capture stream after
+	// After chunks have been sent, without any websocket close handshake.
+	FaultDisconnect FaultKind = iota
+	// FaultStall stops sending a capture stream for Duration after After
+	// chunks have been sent.
+	FaultStall
+	// FaultSlowRead delays reading messages from the capture client for
+	// Duration, including the client's close request, as a slow or overloaded
+	// capture service would. After is ignored.
+	FaultSlowRead
+	// FaultMalformedSHB corrupts the section header block at the beginning of
+	// the first chunk of a capture stream. After is ignored.
+	FaultMalformedSHB
+	// FaultUnauthorized rejects capture requests with HTTP status 401 after
+	// After captures have been started, such as when reconnecting with an
+	// expired bearer token.
+	FaultUnauthorized
+	// FaultForbidden rejects capture requests with HTTP status 403 after After
+	// captures have been started, as when the capture service denies
+	// capturing from a capture target.
+	FaultForbidden
+)
+
+// Fault describes a fault to be injected by the simulated capture service
+// into capture streams.
+type Fault struct {
+	Kind FaultKind
+	// Target optionally limits the fault to the named capture target.
+	Target string
+	// After specifies when to inject the fault, see the individual fault
+	// kinds for details.
+	After int
+	// Duration of stalls and delays.
+	Duration time.Duration
+	// Times optionally limits the number of capture streams to inject the
+	// fault into, such as for only disconnecting the first capture stream,
+	// but not its reconnects. Zero injects the fault into all capture
+	// streams. Times is ignored for rejecting capture requests.
+	Times int
+}
+
+// SetFaults sets the faults to inject into capture streams, replacing any
+// previously set faults.
+func (s *Server) SetFaults(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+	s.injected = make([]int, len(faults))
+}
+
+// streamFaults returns the faults to inject into the capture stream of the
+// named capture target, as well as the HTTP status to reject the capture
+// request with, or zero. Unless probing, it counts the requested captures.
+func (s *Server) streamFaults(name string, probe bool) (faults []Fault, reject int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for idx, fault := range s.faults {
+		if fault.Target != "" && fault.Target != name {
+			continue
+		}
+		switch fault.Kind {
+		case FaultUnauthorized:
+			if s.captures >= fault.After && reject == 0 {
+				reject = http.StatusUnauthorized
+			}
+			continue
+		case FaultForbidden:
+			if s.captures >= fault.After && reject == 0 {
+				reject = http.StatusForbidden
+			}
+			continue
+		}
+		if !probe && fault.Times > 0 {
+			if s.injected[idx] >= fault.Times {
+				continue
+			}
+			s.injected[idx]++
+		}
+		faults = append(faults, fault)
+	}
+	if reject == 0 && !probe {
+		s.captures++
+	}
+	return
+}
+
+// malformed returns a copy of the specified chunk with its section header
+// block type corrupted.
+func malformed(chunk []byte) []byte {
+	chunk = append([]byte(nil), chunk...)
+	for idx := 0; idx < 4 && idx < len(chunk); idx++ {
+		chunk[idx] ^= 0xff
+	}
+	return chunk
+}
@@ -0,0 +1,131 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("simulated capture service faults", func() {
+
+	foo := dockerTarget("foo")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+	var client csharg.SharkTank
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+		var err error
+		client, err = csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("disconnects mid-stream", func() {
+		srv.SetFaults(Fault{Kind: FaultDisconnect, After: 2})
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Wait()
+		}()
+		Eventually(done, "5s").Should(BeClosed())
+		Expect(len(buff.Bytes())).To(BeNumerically("<", len(stream)))
+	})
+
+	It("stalls streams", func() {
+		srv.SetFaults(Fault{Kind: FaultStall, After: 1, Duration: time.Hour})
+		cs, err := client.Capture(&syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Wait()
+		}()
+		Consistently(done, 200*time.Millisecond).ShouldNot(BeClosed())
+		cs.Stop()
+		Eventually(done, "5s").Should(BeClosed())
+	})
+
+	DescribeTable("aborts stalled streams",
+		func(transport csharg.CaptureTransport) {
+			srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+			srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+			srv.SetFaults(Fault{Kind: FaultStall, After: 1, Duration: time.Hour})
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+				CommonClientOptions: csharg.CommonClientOptions{
+					Timeout:      5 * time.Second,
+					StallTimeout: 200 * time.Millisecond,
+				},
+				Transport: transport,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				cs.Wait()
+			}()
+			Eventually(done, "5s").Should(BeClosed())
+			Expect(len(buff.Bytes())).To(BeNumerically("<", len(stream)))
+			start := time.Now()
+			cs.Stop()
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("reads slowly", func() {
+		srv.SetFaults(Fault{Kind: FaultSlowRead, Duration: 500 * time.Millisecond})
+		cs, err := client.Capture(&syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		start := time.Now()
+		cs.Stop()
+		Expect(time.Since(start)).To(BeNumerically(">=", 400*time.Millisecond))
+	})
+
+	It("sends malformed section headers that pass through unedited", func() {
+		srv.SetFaults(Fault{Kind: FaultMalformedSHB})
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int { return len(buff.Bytes()) }, "5s").Should(Equal(len(stream)))
+		cs.Stop()
+		Expect(bytes.Equal(buff.Bytes()[4:], stream[4:])).To(BeTrue())
+		Expect(bytes.Equal(buff.Bytes()[:4], stream[:4])).To(BeFalse())
+	})
+
+	It("rejects reconnects as unauthorized", func() {
+		srv.SetFaults(Fault{Kind: FaultUnauthorized, After: 1})
+		cs, err := client.Capture(&syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		Expect(client.Capture(&syncBuffer{}, foo, nil)).Error().To(HaveOccurred())
+		Expect(st.Captures()).To(HaveLen(1))
+	})
+
+	It("rejects captures as forbidden", func() {
+		srv.SetFaults(Fault{Kind: FaultForbidden, Target: "foo"})
+		Expect(client.Capture(&syncBuffer{}, foo, nil)).Error().To(HaveOccurred())
+		Expect(st.Captures()).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,56 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/filter"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("validating capture filters", func() {
+
+	DescribeTable("accepts valid and empty filter expressions",
+		func(expr string) {
+			Expect(csharg.ValidateFilter(expr)).To(Succeed())
+		},
+		Entry("empty", ""),
+		Entry("blank", "  "),
+		Entry("protocol", "tcp"),
+		Entry("combined", "tcp port 443 and host 10.0.0.1"),
+		Entry("negated net", "ip6 net fe80::/10 and not udp"),
+		Entry("packet data", "tcp[tcpflags] & (tcp-syn|tcp-ack) != 0"),
+	)
+
+	DescribeTable("reports syntax errors with their positions",
+		func(expr string, pos int, msg string) {
+			err := csharg.ValidateFilter(expr)
+			Expect(err).To(BeAssignableToTypeOf(&filter.SyntaxError{}))
+			Expect(err.(*filter.SyntaxError).Pos).To(Equal(pos))
+			Expect(err).To(MatchError(msg))
+		},
+		Entry("misspelled keyword", "tcp prot 443", 4,
+			`filter syntax error at position 5: unexpected "prot"`),
+		Entry("dangling operator", "port 80 or", 10,
+			`filter syntax error at position 11: unexpected "" (at end of expression)`),
+		Entry("unbalanced parenthesis", "(tcp", 4,
+			`filter syntax error at position 5: expected "[" after "tcp" (at end of expression)`),
+	)
+
+	DescribeTable("rejects unsupported primitives",
+		func(expr string, pos int, msg string) {
+			err := csharg.ValidateFilter(expr)
+			Expect(err).To(BeAssignableToTypeOf(&filter.SyntaxError{}))
+			Expect(err.(*filter.SyntaxError).Pos).To(Equal(pos))
+			Expect(err).To(MatchError(HaveSuffix(msg)))
+		},
+		Entry("port of ICMP", "icmp port 7", 10, `"icmp port" is not a valid qualifier combination`),
+		Entry("host of UDP", "udp host 10.0.0.1", 9, `"udp host" is not a valid qualifier combination`),
+		Entry("net of Ethernet", "ether net 10.0.0.0", 10, `"ether net" is not a valid qualifier combination`),
+	)
+
+})
@@ -0,0 +1,26 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"github.com/siemens/csharg/api"
+
+	. "github.com/onsi/ginkgo/v2"
+)
+
+// dockerTarget returns a new Docker container capture target with the
+// specified name and a single "eth0" network interface.
+func dockerTarget(name string) *api.Target {
+	return &api.Target{Name: name, Type: api.TypeDocker, NetworkInterfaces: []string{"eth0"}}
+}
+
+// serve starts a fake capture service with the specified capture targets,
+// closing the capture service when the current spec ends.
+func serve(targets ...*api.Target) (*SharkTank, *Server) {
+	st := New(targets...)
+	srv := NewServer(st)
+	DeferCleanup(srv.Close)
+	return st, srv
+}
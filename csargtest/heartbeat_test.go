@@ -0,0 +1,49 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture heartbeats", func() {
+
+	foo := dockerTarget("foo")
+	// quiet is a capture stream without final statistics.
+	quiet := pcapngtest.New(binary.LittleEndian).
+		SHB().IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0")).
+		EPB(0, 1, []byte{1}).EPB(0, 2, []byte{2}).EPB(0, 3, []byte{3}).
+		Bytes()
+
+	It("adds interface statistics while the capture is quiet", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(quiet, 16)})
+		var buff syncBuffer
+		cs, err := csharg.CaptureContext(context.Background(), st, &buff, foo,
+			&csharg.CaptureOptions{Heartbeat: 50 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int { return heartbeats(buff.Bytes()) }, "5s").Should(BeNumerically(">=", 2))
+		cs.Stop()
+
+		types, delivered := blockTypes(buff.Bytes())
+		Expect(types[len(types)-1]).To(Equal(pcapng.BlockISB))
+		Expect(delivered).To(Equal(uint64(3)))
+	})
+
+	It("rejects heartbeats for raw capture streams", func() {
+		Expect((&csharg.CaptureOptions{Raw: true, Heartbeat: time.Second}).Validate()).To(
+			MatchError("heartbeat: cannot be added to raw capture streams"))
+	})
+
+})
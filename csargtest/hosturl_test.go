@@ -0,0 +1,77 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/siemens/csharg"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture service host URLs", func() {
+
+	DescribeTable("rejects invalid host URLs",
+		func(hosturl string, errmsg string) {
+			Expect(csharg.NewSharkTankOnHost(hosturl, nil)).Error().To(
+				MatchError(ContainSubstring(errmsg)))
+		},
+		Entry("unsupported scheme", "ftp://localhost", "unsupported capture service URL scheme"),
+		Entry("missing host", "http://:5001", "missing capture service host name"),
+		Entry("query", "localhost:5001?foo=bar", "only host name and optional port number allowed"),
+		Entry("missing bracket", "[fe80::1%eth0:5001", "missing closing bracket"),
+		Entry("invalid IPv6 literal", "[fe80::1::2]:5001", "invalid IPv6 address"),
+		Entry("IPv4 in brackets", "[127.0.0.1]:5001", "invalid IPv6 address"),
+		Entry("unbracketed with port", "fe80::1::5001:x", "use brackets when specifying a port"),
+	)
+
+	It("accepts unbracketed IPv6 literals without port", func() {
+		Expect(csharg.NewSharkTankOnHost("fe80::1%eth0", nil)).Error().NotTo(HaveOccurred())
+		Expect(csharg.NewSharkTankOnHost("https://2001:db8::1", nil)).Error().NotTo(HaveOccurred())
+	})
+
+	Context("IPv6 capture service", func() {
+
+		var srv *Server
+		var port string
+
+		BeforeEach(func() {
+			l, err := net.Listen("tcp6", "[::1]:0")
+			if err != nil {
+				Skip("IPv6 loopback not available")
+			}
+			st := New(dockerTarget("foo"))
+			srv = newServer(st)
+			srv.Listener.Close()
+			srv.Listener = l
+			srv.Start()
+			DeferCleanup(srv.Close)
+			_, port, _ = net.SplitHostPort(l.Addr().String())
+		})
+
+		DescribeTable("discovers and captures, filling in node names",
+			func(hosturl string, nodename string) {
+				client, err := csharg.NewSharkTankOnHost(strings.ReplaceAll(hosturl, "PORT", port), nil)
+				Expect(err).NotTo(HaveOccurred())
+				targets := client.Targets()
+				Expect(targets).To(HaveLen(1))
+				Expect(targets[0].NodeName).To(Equal(nodename))
+				cs, err := client.CaptureContainer(&syncBuffer{}, nodename, "foo", nil)
+				Expect(err).NotTo(HaveOccurred())
+				cs.StopAfter(100 * time.Millisecond)
+			},
+			Entry("literal", "[::1]:PORT", "::1"),
+			Entry("literal with scheme and path", "http://[::1]:PORT/", "::1"),
+			Entry("zoned literal", "http://[::1%lo]:PORT", "::1%lo"),
+			Entry("percent-encoded zone", "[::1%25lo]:PORT", "::1%lo"),
+		)
+
+	})
+
+})
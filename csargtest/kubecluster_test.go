@@ -0,0 +1,170 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const kubeconfigTemplate = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: kind
+  cluster:
+    server: %s
+contexts:
+- name: dev
+  context:
+    cluster: kind
+    user: dev
+    namespace: frontend
+- name: ops
+  context:
+    cluster: kind
+    user: ops
+- name: plugged
+  context:
+    cluster: kind
+    user: plugged
+users:
+- name: dev
+  user:
+    token: dev-token
+- name: ops
+  user:
+    tokenFile: ops-token
+- name: plugged
+  user:
+    exec:
+      command: get-token
+`
+
+// newAPIServerProxy returns a fake Kubernetes remote API server that proxies
+// requests to the cluster capture service, losing the query parameters of
+// websocket requests the same as real API servers do.
+func newAPIServerProxy(service *Server) *httptest.Server {
+	serviceurl, _ := url.Parse(service.URL)
+	proxy := httputil.NewSingleHostReverseProxy(serviceurl)
+	const prefix = "/api/v1/namespaces/ghostwire/services/clustershark/proxy"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, prefix+"/") {
+			http.NotFound(w, req)
+			return
+		}
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, prefix)
+		req.URL.RawPath = ""
+		if req.Header.Get("Upgrade") != "" {
+			req.URL.RawQuery = ""
+		}
+		proxy.ServeHTTP(w, req)
+	}))
+}
+
+var _ = Describe("SharkTank on Kubernetes cluster", func() {
+
+	web := &api.Target{
+		Name: "web", Namespace: "frontend", Type: api.TypePod,
+		NodeName: "node-1", NetworkInterfaces: []string{"eth0"},
+	}
+	db := &api.Target{
+		Name: "db", Namespace: "backend", Type: api.TypePod,
+		NodeName: "node-2", NetworkInterfaces: []string{"eth0"},
+	}
+
+	var st *SharkTank
+	var srv *Server
+	var kubeconfig string
+
+	BeforeEach(func() {
+		st, srv = serve(web, db)
+		apiserver := newAPIServerProxy(srv)
+		DeferCleanup(apiserver.Close)
+		dir := GinkgoT().TempDir()
+		kubeconfig = filepath.Join(dir, "config")
+		Expect(os.WriteFile(kubeconfig,
+			[]byte(fmt.Sprintf(kubeconfigTemplate, apiserver.URL)), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "ops-token"), []byte("ops-token\n"), 0600)).To(Succeed())
+	})
+
+	It("discovers the capture targets of all cluster nodes", func() {
+		srv.RequireBearerToken("dev-token")
+		client, err := csharg.NewSharkTankOnKubeCluster(&csharg.SharkTankOnKubeClusterOptions{
+			Kubeconfig: kubeconfig,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect(client.Targets()).To(ConsistOf(
+			And(HaveField("Name", "web"), HaveField("NodeName", "node-1")),
+			And(HaveField("Name", "db"), HaveField("NodeName", "node-2")),
+		))
+	})
+
+	It("captures from pods in the namespace of the kubeconfig context", func() {
+		srv.RequireBearerToken("dev-token")
+		stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+		st.SetStream("frontend/web", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		client, err := csharg.NewSharkTankOnKubeCluster(&csharg.SharkTankOnKubeClusterOptions{
+			Kubeconfig: kubeconfig,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		var buff syncBuffer
+		cs, err := client.CapturePod(&buff, "web", &csharg.CaptureOptions{Filter: "tcp"})
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(buff.Bytes()).NotTo(BeEmpty())
+		Expect(st.Captures()).To(ConsistOf(And(
+			HaveField("Target.Name", "web"),
+			HaveField("Target.Namespace", "frontend"),
+			HaveField("Options.Filter", "tcp"),
+		)))
+	})
+
+	It("uses the credentials of the specified kubeconfig context", func() {
+		srv.RequireBearerToken("ops-token")
+		client, err := csharg.NewSharkTankOnKubeCluster(&csharg.SharkTankOnKubeClusterOptions{
+			Kubeconfig: kubeconfig,
+			Context:    "ops",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect(client.Targets()).To(HaveLen(2))
+	})
+
+	It("rejects unknown contexts and unsupported authentication", func() {
+		_, err := csharg.NewSharkTankOnKubeCluster(&csharg.SharkTankOnKubeClusterOptions{
+			Kubeconfig: kubeconfig,
+			Context:    "missing",
+		})
+		Expect(err).To(MatchError(ContainSubstring(`no kubeconfig context "missing"`)))
+		_, err = csharg.NewSharkTankOnKubeCluster(&csharg.SharkTankOnKubeClusterOptions{
+			Kubeconfig: kubeconfig,
+			Context:    "plugged",
+		})
+		Expect(err).To(MatchError(ContainSubstring("unsupported exec")))
+		_, err = csharg.NewSharkTankOnKubeCluster(&csharg.SharkTankOnKubeClusterOptions{
+			Kubeconfig: kubeconfig,
+			Service:    "foo/bar",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+})
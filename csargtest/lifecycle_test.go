@@ -0,0 +1,144 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// eventRecorder records the lifecycle events of captures.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []csharg.LifecycleEvent
+}
+
+func (r *eventRecorder) record(event csharg.LifecycleEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// Events returns the recorded lifecycle events so far.
+func (r *eventRecorder) Events() []csharg.LifecycleEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]csharg.LifecycleEvent(nil), r.events...)
+}
+
+// Kinds returns the kinds of the recorded lifecycle events so far.
+func (r *eventRecorder) Kinds() []csharg.EventKind {
+	var kinds []csharg.EventKind
+	for _, event := range r.Events() {
+		kinds = append(kinds, event.Kind)
+	}
+	return kinds
+}
+
+var _ = Describe("capture lifecycle events", func() {
+
+	foo := dockerTarget("foo")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+	var events *eventRecorder
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+		events = &eventRecorder{}
+	})
+
+	newClient := func(transport csharg.CaptureTransport, stall time.Duration) csharg.SharkTank {
+		srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+		srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{
+				Timeout:      5 * time.Second,
+				StallTimeout: stall,
+			},
+			Transport: transport,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	DescribeTable("signals connecting, the first packet, and closing",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport, 0)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+			before := time.Now()
+			cs, err := client.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{Events: events.record})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cs.WaitErr()).To(Succeed())
+			Expect(events.Kinds()).To(HaveExactElements(
+				csharg.EventConnected, csharg.EventFirstPacket, csharg.EventClosed))
+			for _, event := range events.Events() {
+				Expect(event.Target.Name).To(Equal("foo"))
+				Expect(event.Time).To(BeTemporally(">=", before))
+				Expect(event.Err).NotTo(HaveOccurred())
+			}
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	DescribeTable("signals stalls and the reason for closing",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport, 200*time.Millisecond)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			srv.SetFaults(Fault{Kind: FaultStall, After: 1, Duration: time.Hour})
+			cs, err := client.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{Events: events.record})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cs.WaitErr()).To(MatchError(csharg.ErrStalled))
+			Expect(events.Kinds()).To(HaveExactElements(
+				csharg.EventConnected, csharg.EventStalled, csharg.EventClosed))
+			Expect(events.Events()[2].Err).To(MatchError(csharg.ErrStalled))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+	)
+
+	It("signals reconnecting", func() {
+		client := newClient(csharg.TransportWebsocket, 0)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		srv.SetFaults(Fault{Kind: FaultDisconnect, After: 6, Times: 1})
+		cs, err := client.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{
+			Reconnect: 5 * time.Second,
+			Events:    events.record,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cs.WaitErr()).To(Succeed())
+		Expect(events.Kinds()).To(HaveExactElements(
+			csharg.EventConnected, csharg.EventFirstPacket,
+			csharg.EventReconnecting, csharg.EventConnected,
+			csharg.EventClosed))
+		Expect(events.Events()[2].Err).To(HaveOccurred())
+	})
+
+	It("signals the lifecycle of scripted captures", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		cs, err := st.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{Events: events.record})
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(events.Kinds()).To(HaveExactElements(
+			csharg.EventConnected, csharg.EventFirstPacket, csharg.EventClosed))
+	})
+
+	It("names lifecycle event kinds", func() {
+		Expect(csharg.EventFirstPacket.String()).To(Equal("first packet"))
+		Expect(csharg.EventKind(42).String()).To(Equal("unknown"))
+	})
+
+})
@@ -0,0 +1,119 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capturing from multiple targets", func() {
+
+	foo := dockerTarget("foo")
+	bar := dockerTarget("bar")
+
+	var st *SharkTank
+	var client csharg.SharkTank
+
+	BeforeEach(func() {
+		var srv *Server
+		st, srv = serve(foo, bar)
+		var err error
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+	})
+
+	It("merges the capture streams into a single section", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, 1, 3), 16), End: true})
+		st.SetStream("bar", &Stream{Chunks: pcapngtest.Chunk(pcapngtest.Capture(binary.BigEndian, 2), 16), End: true})
+		var buff syncBuffer
+		cs, err := client.CaptureMany(&buff, []*api.Target{foo, bar}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(st.Captures()).To(HaveLen(2))
+
+		r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+		sections := 0
+		packets := 0
+		for {
+			b, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			switch b.Type {
+			case pcapng.BlockSHB:
+				sections++
+			case pcapng.BlockEPB:
+				packets++
+			}
+		}
+		Expect(sections).To(Equal(1))
+		Expect(packets).To(Equal(3))
+		Expect(r.SectionHeader().Comment()).To(And(
+			ContainSubstring("container-name: foo"),
+			ContainSubstring("container-name: bar")))
+		Expect(r.Interfaces()).To(HaveLen(2))
+		descs := []string{r.Interface(0).Description(), r.Interface(1).Description()}
+		Expect(descs).To(ConsistOf(ContainSubstring("foo"), ContainSubstring("bar")))
+	})
+
+	It("stops all captures", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, 1), 16)})
+		st.SetStream("bar", &Stream{Chunks: pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, 2), 16)})
+		cs, err := client.CaptureMany(&syncBuffer{}, []*api.Target{foo, bar}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(st.Captures).Should(HaveLen(2))
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			cs.Stop()
+		}()
+		Eventually(stopped, "5s").Should(BeClosed())
+	})
+
+	It("rejects capturing from no targets", func() {
+		Expect(client.CaptureMany(io.Discard, nil, nil)).Error().To(HaveOccurred())
+		Expect(st.CaptureMany(io.Discard, nil, nil)).Error().To(HaveOccurred())
+	})
+
+	It("fails when any target cannot be captured from", func() {
+		Expect(client.CaptureMany(io.Discard, []*api.Target{foo, bar},
+			&csharg.CaptureOptions{Reconnect: -time.Second})).Error().To(
+			MatchError(ContainSubstring(`cannot capture from "foo"`)))
+		Expect(st.Captures()).To(BeEmpty())
+	})
+
+	It("multiplexes scripted captures", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, 1), 16), End: true})
+		st.SetStream("bar", &Stream{Chunks: pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, 2), 16), End: true})
+		var buff syncBuffer
+		cs, err := st.CaptureMany(&buff, []*api.Target{foo, bar}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+		for {
+			if _, err := r.Next(); err != nil {
+				Expect(err).To(Equal(io.EOF))
+				break
+			}
+		}
+		Expect(r.Interfaces()).To(HaveLen(2))
+	})
+
+})
@@ -0,0 +1,151 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// newClientCertificate returns a new self-signed client CA together with a
+// PEM-encoded client certificate and private key signed by this CA.
+func newClientCertificate() (ca *x509.Certificate, certPEM, keyPEM []byte) {
+	cakey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	catmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "csargtest client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, catmpl, catmpl, &cakey.PublicKey, cakey)
+	Expect(err).NotTo(HaveOccurred())
+	ca, err = x509.ParseCertificate(caDER)
+	Expect(err).NotTo(HaveOccurred())
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "csargtest client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, cakey)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return ca,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+var _ = Describe("mutual TLS", func() {
+
+	foo := dockerTarget("foo")
+
+	var st *SharkTank
+	var srv *Server
+	var roots *tls.Config
+	var certPEM, keyPEM []byte
+
+	BeforeEach(func() {
+		var ca *x509.Certificate
+		ca, certPEM, keyPEM = newClientCertificate()
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(ca)
+		st = New(foo)
+		srv = NewMutualTLSServer(st, clientCAs)
+		DeferCleanup(srv.Close)
+		roots = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	})
+
+	It("rejects clients without client certificate", func() {
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			TLSConfig: roots,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect(client.Targets()).To(BeEmpty())
+	})
+
+	DescribeTable("presents client certificates when discovering and capturing",
+		func(transport csharg.CaptureTransport) {
+			srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+			srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+			st.SetStream("foo", &Stream{
+				Chunks: pcapngtest.Chunk(pcapngtest.Capture(binary.LittleEndian, 1, 2, 3), 16),
+				End:    true,
+			})
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			Expect(err).NotTo(HaveOccurred())
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+				TLSConfig:          roots,
+				ClientCertificates: []tls.Certificate{cert},
+				Transport:          transport,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer client.Close()
+			Expect(client.Targets()).To(HaveLen(1))
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			cs.Wait()
+			Expect(buff.Bytes()).NotTo(BeEmpty())
+			Expect(roots.Certificates).To(BeEmpty())
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("loads client certificates from PEM files", func() {
+		dir := GinkgoT().TempDir()
+		certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+		Expect(os.WriteFile(certFile, certPEM, 0600)).To(Succeed())
+		Expect(os.WriteFile(keyFile, keyPEM, 0600)).To(Succeed())
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			TLSConfig:      roots,
+			ClientCertFile: certFile,
+			ClientKeyFile:  keyFile,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect(client.Targets()).To(HaveLen(1))
+
+		_, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			ClientCertFile: certFile,
+		})
+		Expect(err).To(MatchError(ContainSubstring("both certificate and key files")))
+		_, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			ClientCertFile: keyFile,
+			ClientKeyFile:  certFile,
+		})
+		Expect(err).To(MatchError(ContainSubstring("invalid client certificate")))
+	})
+
+})
@@ -0,0 +1,96 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("limiting the number of captured packets", func() {
+
+	foo := dockerTarget("foo")
+	bar := dockerTarget("bar")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo, bar)
+		// Capture streams don't end on their own.
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+		st.SetStream("bar", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+	})
+
+	newClient := func(transport csharg.CaptureTransport) csharg.SharkTank {
+		srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+			Transport:           transport,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	waitDone := func(cs csharg.CaptureStreamer) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Wait()
+		}()
+		return done
+	}
+
+	DescribeTable("stops after the packet limit",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport)
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, foo, &csharg.CaptureOptions{MaxPackets: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(waitDone(cs), "5s").Should(BeClosed())
+			Expect(packets(buff.Bytes())).To(Equal(2))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+	)
+
+	It("limits the packets of multiple targets together", func() {
+		client := newClient(csharg.TransportWebsocket)
+		var buff syncBuffer
+		cs, err := client.CaptureMany(&buff, []*api.Target{foo, bar}, &csharg.CaptureOptions{MaxPackets: 4})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitDone(cs), "5s").Should(BeClosed())
+		Expect(packets(buff.Bytes())).To(Equal(4))
+	})
+
+	It("stops scripted captures after the packet limit", func() {
+		var buff syncBuffer
+		cs, err := st.Capture(&buff, foo, &csharg.CaptureOptions{MaxPackets: 1})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitDone(cs), "5s").Should(BeClosed())
+		Expect(packets(buff.Bytes())).To(Equal(1))
+
+		buff = syncBuffer{}
+		cs, err = st.CaptureMany(&buff, []*api.Target{foo, bar}, &csharg.CaptureOptions{MaxPackets: 5})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitDone(cs), "5s").Should(BeClosed())
+		Expect(packets(buff.Bytes())).To(Equal(5))
+	})
+
+	It("rejects negative packet limits", func() {
+		Expect((&csharg.CaptureOptions{MaxPackets: -1}).Validate()).To(
+			MatchError("maxpackets: invalid negative value -1"))
+	})
+
+})
@@ -0,0 +1,247 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// connectProxy is a minimal HTTP CONNECT proxy recording the
+// Proxy-Authorization headers it receives and tunneling only those CONNECT
+// requests its authorize function lets pass.
+type connectProxy struct {
+	*httptest.Server
+	authorize func(w http.ResponseWriter, authorization string) bool
+
+	mu             sync.Mutex
+	authorizations []string
+}
+
+func newConnectProxy(authorize func(w http.ResponseWriter, authorization string) bool) *connectProxy {
+	p := &connectProxy{authorize: authorize}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+	return p
+}
+
+// Authorizations returns the Proxy-Authorization headers received so far.
+func (p *connectProxy) Authorizations() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.authorizations...)
+}
+
+func (p *connectProxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	if r.Method != http.MethodConnect {
+		http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+		return
+	}
+	authorization := r.Header.Get("Proxy-Authorization")
+	p.mu.Lock()
+	p.authorizations = append(p.authorizations, authorization)
+	p.mu.Unlock()
+	if !p.authorize(w, authorization) {
+		return
+	}
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn, bufrw, err := w.(http.Hijacker).Hijack()
+	Expect(err).NotTo(HaveOccurred())
+	_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	go func() {
+		_, _ = io.Copy(upstream, bufrw)
+		upstream.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(conn, upstream)
+		conn.Close()
+	}()
+}
+
+// ntlmChallenge returns a minimal NTLMv2 challenge message (type 2) without
+// target name and target information.
+func ntlmChallenge() []byte {
+	msg := make([]byte, 48)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[16:], 48)     // empty target name at end
+	binary.LittleEndian.PutUint32(msg[20:], 0x0201) // unicode, NTLM
+	copy(msg[24:32], "s3rv3r!!")
+	binary.LittleEndian.PutUint32(msg[44:], 48) // empty target info at end
+	return msg
+}
+
+// ntlmMessageType returns the type of the base64-encoded NTLM message in the
+// specified authorization header, or 0 if it isn't a NTLM message.
+func ntlmMessageType(authorization string) uint32 {
+	if !strings.HasPrefix(authorization, "NTLM ") {
+		return 0
+	}
+	msg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "NTLM "))
+	if err != nil || len(msg) < 12 || !bytes.HasPrefix(msg, []byte("NTLMSSP\x00")) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(msg[8:])
+}
+
+var _ = Describe("HTTP CONNECT proxies", func() {
+
+	foo := dockerTarget("foo")
+
+	var srv *Server
+
+	BeforeEach(func() {
+		_, srv = serve(foo)
+	})
+
+	proxyURL := func(p *connectProxy) *url.URL {
+		u, err := url.Parse(p.URL)
+		Expect(err).NotTo(HaveOccurred())
+		return u
+	}
+
+	discover := func(opts *csharg.ProxyOptions) ([]*api.Target, error) {
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+			Proxy:               opts,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		ts, err := client.TargetsContext(context.Background())
+		return ts, err
+	}
+
+	It("tunnels through unauthenticated proxies", func() {
+		p := newConnectProxy(func(http.ResponseWriter, string) bool { return true })
+		defer p.Close()
+		ts, err := discover(&csharg.ProxyOptions{URL: proxyURL(p)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ts).To(ConsistOf(HaveField("Name", "foo")))
+		Expect(p.Authorizations()).NotTo(BeEmpty())
+		Expect(p.Authorizations()).To(HaveEach(BeEmpty()))
+	})
+
+	It("authenticates using basic authentication", func() {
+		basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:s3cr3t"))
+		p := newConnectProxy(func(w http.ResponseWriter, authorization string) bool {
+			if authorization != basic {
+				w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+				w.WriteHeader(http.StatusProxyAuthRequired)
+				return false
+			}
+			return true
+		})
+		defer p.Close()
+
+		ts, err := discover(&csharg.ProxyOptions{
+			URL:      proxyURL(p),
+			Username: "alice",
+			Password: "s3cr3t",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ts).To(ConsistOf(HaveField("Name", "foo")))
+		Expect(p.Authorizations()).To(HaveEach(Equal(basic)))
+
+		u := proxyURL(p)
+		u.User = url.UserPassword("alice", "s3cr3t")
+		_, err = discover(&csharg.ProxyOptions{URL: u})
+		Expect(err).NotTo(HaveOccurred())
+
+		dial, err := csharg.NewProxyDialer(&csharg.ProxyOptions{
+			URL:      proxyURL(p),
+			Username: "alice",
+			Password: "wr0ng",
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "http://"))
+		Expect(err).To(MatchError(ContainSubstring("refused to connect to")))
+		Expect(err).To(MatchError(ContainSubstring("407")))
+	})
+
+	It("authenticates using the NTLM handshake", func() {
+		p := newConnectProxy(func(w http.ResponseWriter, authorization string) bool {
+			switch ntlmMessageType(authorization) {
+			case 1:
+				w.Header().Set("Proxy-Authenticate",
+					"NTLM "+base64.StdEncoding.EncodeToString(ntlmChallenge()))
+			case 3:
+				return true
+			default:
+				w.Header().Set("Proxy-Authenticate", "NTLM")
+			}
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return false
+		})
+		defer p.Close()
+
+		ts, err := discover(&csharg.ProxyOptions{
+			URL:      proxyURL(p),
+			Username: `CORP\alice`,
+			Password: "s3cr3t",
+			Auth:     csharg.ProxyAuthNTLM,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ts).To(ConsistOf(HaveField("Name", "foo")))
+		auths := p.Authorizations()
+		Expect(len(auths)).To(BeNumerically(">=", 2))
+		Expect(len(auths) % 2).To(BeZero())
+		for idx := 0; idx < len(auths); idx += 2 {
+			Expect(ntlmMessageType(auths[idx])).To(Equal(uint32(1)), "negotiate message")
+			Expect(ntlmMessageType(auths[idx+1])).To(Equal(uint32(3)), "authenticate message")
+		}
+	})
+
+	It("reports proxies not supporting NTLM", func() {
+		p := newConnectProxy(func(w http.ResponseWriter, _ string) bool {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return false
+		})
+		defer p.Close()
+
+		dial, err := csharg.NewProxyDialer(&csharg.ProxyOptions{
+			URL:      proxyURL(p),
+			Username: "alice",
+			Password: "s3cr3t",
+			Auth:     csharg.ProxyAuthNTLM,
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dial(context.Background(), "tcp", strings.TrimPrefix(srv.URL, "http://"))
+		Expect(err).To(MatchError(ContainSubstring("doesn't support NTLM authentication")))
+		Expect(p.Authorizations()).To(ConsistOf(HavePrefix("NTLM ")))
+	})
+
+	It("rejects invalid proxy options", func() {
+		Expect(csharg.NewProxyDialer(nil, nil)).Error().To(HaveOccurred())
+		Expect(csharg.NewProxyDialer(&csharg.ProxyOptions{
+			URL: &url.URL{Scheme: "socks5", Host: "localhost:1080"},
+		}, nil)).Error().To(MatchError(HavePrefix("invalid proxy URL")))
+		Expect(csharg.NewProxyDialer(&csharg.ProxyOptions{
+			URL:  &url.URL{Scheme: "http", Host: "localhost:3128"},
+			Auth: "kerberos",
+		}, nil)).Error().To(MatchError(`unsupported proxy authentication "kerberos"`))
+	})
+
+})
@@ -0,0 +1,99 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("reading captures", func() {
+
+	foo := dockerTarget("foo")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+	})
+
+	newClient := func(transport csharg.CaptureTransport) csharg.SharkTank {
+		srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+		srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+			Transport:           transport,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	DescribeTable("reads the packet capture stream until the capture ends",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+			r, err := client.CaptureReader(foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(packets(data)).To(Equal(3))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("stops the capture when closed without reading", func() {
+		client := newClient(csharg.TransportWebsocket)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+		r, err := client.CaptureReader(foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		closed := make(chan error, 1)
+		go func() { closed <- r.Close() }()
+		Eventually(closed, "5s").Should(Receive(BeNil()))
+		Expect(r.Read(make([]byte, 1))).Error().To(MatchError(io.ErrClosedPipe))
+		Expect(r.Close()).To(Succeed())
+	})
+
+	It("fails reading failed captures", func() {
+		client := newClient(csharg.TransportWebsocket)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+		srv.SetFaults(Fault{Kind: FaultDisconnect, After: 2})
+		r, err := client.CaptureReader(foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		_, err = io.ReadAll(r)
+		var capErr *csharg.CaptureError
+		Expect(errors.As(err, &capErr)).To(BeTrue())
+		Expect(capErr.Op).To(Equal("receive"))
+	})
+
+	It("fails to start reading captures that cannot be started", func() {
+		client := newClient(csharg.TransportWebsocket)
+		st.SetCaptureError("foo", errors.New("no such container"))
+		Expect(client.CaptureReader(foo, nil)).Error().To(HaveOccurred())
+	})
+
+	It("reads scripted captures", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		r, err := st.CaptureReader(foo, &csharg.CaptureOptions{Raw: true})
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(io.ReadAll(r)).To(Equal(stream))
+	})
+
+})
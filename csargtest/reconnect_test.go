@@ -0,0 +1,127 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("reconnecting capture streams", func() {
+
+	foo := dockerTarget("foo")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+	var client csharg.SharkTank
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+		var err error
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+	})
+
+	waitDone := func(cs csharg.CaptureStreamer) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Wait()
+		}()
+		return done
+	}
+
+	It("resumes broken capture streams into the same section", func() {
+		// Break the first capture stream right after its first packet.
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		srv.SetFaults(Fault{Kind: FaultDisconnect, After: 6, Times: 1})
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, foo, &csharg.CaptureOptions{Reconnect: 5 * time.Second})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitDone(cs), "5s").Should(BeClosed())
+		Expect(st.Captures()).To(HaveLen(2))
+
+		r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+		var types []uint32
+		var timestamps []uint64
+		for {
+			b, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			types = append(types, b.Type)
+			if b.Type == pcapng.BlockEPB {
+				epb, err := b.EnhancedPacket()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(epb.InterfaceID).To(BeZero())
+				timestamps = append(timestamps, epb.Timestamp)
+			}
+		}
+		Expect(types).To(HaveExactElements(
+			pcapng.BlockSHB, pcapng.BlockIDB,
+			pcapng.BlockEPB, pcapng.BlockEPB, pcapng.BlockEPB, pcapng.BlockEPB,
+			pcapng.BlockISB))
+		Expect(timestamps).To(HaveExactElements(uint64(1), uint64(1), uint64(2), uint64(3)))
+	})
+
+	It("doesn't reconnect unless asked to", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		srv.SetFaults(Fault{Kind: FaultDisconnect, After: 6, Times: 1})
+		cs, err := client.Capture(&syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitDone(cs), "5s").Should(BeClosed())
+		Expect(st.Captures()).To(HaveLen(1))
+	})
+
+	It("gives up when the capture service rejects reconnecting", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		srv.SetFaults(
+			Fault{Kind: FaultDisconnect, After: 6, Times: 1},
+			Fault{Kind: FaultUnauthorized, After: 1})
+		cs, err := client.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{Reconnect: time.Minute})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(waitDone(cs), "5s").Should(BeClosed())
+		Expect(st.Captures()).To(HaveLen(1))
+	})
+
+	It("stops reconnecting when stopped", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+		srv.SetFaults(Fault{Kind: FaultDisconnect, After: 6})
+		cs, err := client.Capture(&syncBuffer{}, foo, &csharg.CaptureOptions{Reconnect: time.Minute})
+		Expect(err).NotTo(HaveOccurred())
+		done := waitDone(cs)
+		Consistently(done, "500ms").ShouldNot(BeClosed())
+		Expect(len(st.Captures())).To(BeNumerically(">", 1))
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			cs.Stop()
+		}()
+		Eventually(stopped, "5s").Should(BeClosed())
+		Expect(done).To(BeClosed())
+	})
+
+	It("rejects invalid reconnect options", func() {
+		Expect((&csharg.CaptureOptions{Reconnect: -time.Second}).Validate()).To(
+			MatchError("reconnect: invalid negative value -1s"))
+		Expect((&csharg.CaptureOptions{Raw: true, Reconnect: time.Second}).Validate()).To(
+			MatchError("reconnect: cannot resume raw capture streams"))
+	})
+
+})
@@ -0,0 +1,138 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("replaying recorded captures", func() {
+
+	web := &api.Target{Name: "web", Type: api.TypeDocker, NodeName: "node1",
+		ContainerID: "4f1c0e2d9a7b", NetworkInterfaces: []string{"eth0"}}
+	shop := &api.Target{Name: "shop", Namespace: "default", Type: api.TypePod,
+		NodeName: "node2", NetworkInterfaces: []string{"eth0"}}
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var dir string
+
+	// record captures the scripted capture stream from the specified capture
+	// target into a pcapng file of the replay directory.
+	record := func(t *api.Target, filename string) {
+		st := New(t)
+		st.SetStream(t.QualifiedName(), &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		var buff syncBuffer
+		cs, err := st.Capture(&buff, t, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cs.WaitErr()).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, filename), buff.Bytes(), 0o644)).To(Succeed())
+	}
+
+	// containerInfo returns the capture target information of the first
+	// section in the specified packet capture stream.
+	containerInfo := func(stream []byte) *pcapng.ContainerInfo {
+		b, err := pcapng.NewReader(bytes.NewReader(stream)).Next()
+		Expect(err).NotTo(HaveOccurred())
+		sh, err := b.SectionHeader()
+		Expect(err).NotTo(HaveOccurred())
+		ci, err := pcapng.ParseContainerInfo(sh.Comment())
+		Expect(err).NotTo(HaveOccurred())
+		return ci
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		record(web, "web.pcapng")
+		record(shop, "shop.pcapng")
+		Expect(os.WriteFile(filepath.Join(dir, "broken.pcapng"), []byte("garbage"), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignore me"), 0o644)).To(Succeed())
+	})
+
+	newClient := func() csharg.SharkTank {
+		client, err := csharg.NewSharkTankReplay(dir, nil)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	It("rejects missing replay directories", func() {
+		Expect(csharg.NewSharkTankReplay(filepath.Join(dir, "nope"), nil)).Error().To(HaveOccurred())
+		Expect(csharg.NewSharkTankReplay(filepath.Join(dir, "notes.txt"), nil)).Error().To(
+			MatchError(HavePrefix("not a directory: ")))
+	})
+
+	It("discovers the recorded capture targets", func() {
+		client := newClient()
+		ts, err := client.TargetsContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ts).To(ConsistOf(
+			And(HaveField("Name", "shop"), HaveField("Namespace", "default"),
+				HaveField("Type", api.TypePod), HaveField("NodeName", "node2"),
+				HaveField("NetworkInterfaces", ConsistOf("eth0"))),
+			And(HaveField("Name", "web"), HaveField("Type", api.TypeDocker),
+				HaveField("NodeName", "node1"), HaveField("ContainerID", "4f1c0e2d9a7b"),
+				HaveField("NetworkInterfaces", ConsistOf("eth0"))),
+		))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(client.TargetsContext(ctx)).Error().To(MatchError(context.Canceled))
+	})
+
+	It("replays the recorded capture streams", func() {
+		client := newClient()
+
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, &api.Target{Name: "web", Type: api.TypeDocker}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cs.WaitErr()).To(Succeed())
+		Expect(packets(buff.Bytes())).To(Equal(3))
+		Expect(cs.Stats().Packets).To(BeEquivalentTo(3))
+		ci := containerInfo(buff.Bytes())
+		Expect(ci.ContainerName).To(Equal("web"))
+		Expect(ci.ContainerID).To(Equal("4f1c0e2d9a7b"))
+
+		buff = syncBuffer{}
+		cs, err = client.CapturePod(&buff, "shop", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cs.WaitErr()).To(Succeed())
+		Expect(packets(buff.Bytes())).To(Equal(3))
+		Expect(containerInfo(buff.Bytes()).ContainerName).To(Equal("default/shop"))
+
+		buff = syncBuffer{}
+		cs, err = client.CaptureContainer(&buff, "", "4f1c", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cs.WaitErr()).To(Succeed())
+		Expect(packets(buff.Bytes())).To(Equal(3))
+	})
+
+	It("tells capture targets without recordings", func() {
+		client := newClient()
+		Expect(client.CanCapture(web)).To(Succeed())
+		Expect(client.CanCapture(&api.Target{Name: "broken", Type: csharg.ReplayTargetType})).To(
+			MatchError(csharg.ErrTargetNotFound))
+		Expect(client.Capture(&syncBuffer{}, &api.Target{Name: "nope"}, nil)).Error().To(
+			MatchError(csharg.ErrTargetNotFound))
+	})
+
+	It("refuses to replay after closing", func() {
+		client := newClient()
+		Expect(client.Close()).To(Succeed())
+		Expect(client.Capture(&syncBuffer{}, web, nil)).Error().To(MatchError(csharg.ErrClosed))
+	})
+
+})
@@ -0,0 +1,642 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/capturerpc"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// closeTimeout limits waiting for the client to acknowledge closing the
+// capture stream websocket.
+const closeTimeout = 2 * time.Second
+
+// Server simulates a Packetflix capture service together with its GhostWire
+// discovery service, implementing the “/discover/mobyshark” and “/capture”
+// endpoints, as well as optionally the gRPC csharg.capture.v1.CaptureService.
+// It serves the capture targets and scripted capture streams of a
+// fake SharkTank, so the capture clients from the csharg package can be tested
+// end-to-end. In contrast to the fake SharkTank itself, the scripted capture
+// streams are sent unedited over the capture websocket, and it's the capture
+// client that edits them.
+type Server struct {
+	*httptest.Server
+	tank     *SharkTank
+	mu       sync.Mutex
+	token    string
+	username string
+	password string
+	spnego   []byte // required SPNEGO token.
+	faults   []Fault
+	injected []int         // number of capture streams each fault got injected into.
+	schema   int           // GhostWire discovery schema version to serve.
+	delay    time.Duration // delay of discovery responses.
+	h2stream bool          // serve capture streams as HTTP response bodies.
+	grpc     bool          // serve capture streams as gRPC server streams.
+	sse      bool          // serve capture streams as Server-Sent Events.
+	nows     bool          // reject websocket upgrades.
+	cookie   *http.Cookie  // session cookie to set in capture responses.
+	captures int           // number of captures started, for FaultUnauthorized.
+}
+
+// NewServer starts and returns a new simulated capture service, serving the
+// capture targets and scripted capture streams of the specified fake
+// SharkTank. Captures through the simulated capture service get recorded in
+// the fake SharkTank. The caller should call Close when finished, to shut the
+// server down.
+func NewServer(st *SharkTank) *Server {
+	s := newServer(st)
+	s.Start()
+	return s
+}
+
+// NewTLSServer starts and returns a new simulated capture service using TLS.
+// Use the Client method of the server for the TLS configuration trusting the
+// server's certificate.
+func NewTLSServer(st *SharkTank) *Server {
+	s := newServer(st)
+	s.StartTLS()
+	return s
+}
+
+// NewMutualTLSServer starts and returns a new simulated capture service using
+// mutual TLS, requiring clients to present certificates signed by the
+// specified certificate authorities.
+func NewMutualTLSServer(st *SharkTank, clientCAs *x509.CertPool) *Server {
+	s := newServer(st)
+	s.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	s.StartTLS()
+	return s
+}
+
+// newServer returns a new, unstarted simulated capture service.
+func newServer(st *SharkTank) *Server {
+	s := &Server{tank: st}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/discover/mobyshark", s.authorized(s.discover))
+	mux.HandleFunc("/capture", s.authorized(s.capture))
+	mux.HandleFunc(capturerpc.CaptureMethod, s.authorized(s.captureGRPC))
+	// Support unencrypted HTTP/2 (h2c) with prior knowledge, as well as
+	// HTTP/2 over TLS, for HTTP capture streams.
+	s.Server = httptest.NewUnstartedServer(h2c.NewHandler(mux, &http2.Server{}))
+	s.Server.EnableHTTP2 = true
+	return s
+}
+
+// RequireBearerToken makes the simulated capture service reject requests not
+// carrying the specified bearer token. An empty token accepts all requests.
+func (s *Server) RequireBearerToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// RequireBasicAuth makes the simulated capture service reject requests not
+// carrying the specified basic authentication credentials, as do reverse
+// proxies with simple authentication. An empty username accepts all requests.
+func (s *Server) RequireBasicAuth(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username, s.password = username, password
+}
+
+// RequireNegotiate makes the simulated capture service reject requests not
+// carrying the specified SPNEGO token using the “Negotiate” authentication
+// scheme. A nil token accepts all requests.
+func (s *Server) RequireNegotiate(token []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spnego = token
+}
+
+// SetSchemaVersion sets the GhostWire discovery schema version to serve,
+// either 1 for the original “mobyshark” schema (default), or 2.
+func (s *Server) SetSchemaVersion(version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schema = version
+}
+
+// SetHTTPStreaming enables or disables serving capture streams as HTTP
+// response bodies to clients accepting them, in addition to websockets. By
+// default, like the real capture service, only websockets are served.
+func (s *Server) SetHTTPStreaming(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.h2stream = enabled
+}
+
+// SetEventStreaming enables or disables serving capture streams as
+// Server-Sent Events to clients accepting them, in addition to websockets.
+func (s *Server) SetEventStreaming(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sse = enabled
+}
+
+// BlockWebsockets makes the simulated capture service reject websocket
+// upgrades, as do proxies blocking websockets.
+func (s *Server) BlockWebsockets(blocked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nows = blocked
+}
+
+// SetSessionCookie sets a session cookie in the capture responses, as do
+// reverse proxies with session affinity. A nil cookie sets no cookie.
+func (s *Server) SetSessionCookie(cookie *http.Cookie) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cookie = cookie
+}
+
+// SetGRPCStreaming enables or disables serving capture streams as gRPC server
+// streams of the csharg.capture.v1.CaptureService. When disabled (default),
+// the gRPC Capture method is unimplemented.
+func (s *Server) SetGRPCStreaming(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grpc = enabled
+}
+
+// SetDiscoveryDelay delays the discovery responses by the specified duration,
+// simulating slow discoveries in large clusters. Delayed discoveries finish
+// early when the client cancels them.
+func (s *Server) SetDiscoveryDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// authorized wraps the specified handler, checking for the required bearer
+// token, basic authentication credentials and SPNEGO token, if any.
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		s.mu.Lock()
+		token, username, password, spnego := s.token, s.username, s.password, s.spnego
+		s.mu.Unlock()
+		if token != "" && req.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if username != "" {
+			if u, p, ok := req.BasicAuth(); !ok || u != username || p != password {
+				w.Header().Set("WWW-Authenticate", `Basic realm="csargtest"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if spnego != nil &&
+			req.Header.Get("Authorization") != "Negotiate "+base64.StdEncoding.EncodeToString(spnego) {
+			w.Header().Set("WWW-Authenticate", "Negotiate")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// discover serves the list of capture targets.
+func (s *Server) discover(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	schema, delay := s.schema, s.delay
+	s.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if schema < 2 {
+		_ = json.NewEncoder(w).Encode(api.GwTargetList{Targets: s.tank.Targets()})
+		return
+	}
+	td := api.GwTargetListV2{Version: schema, Targets: []*api.GwTargetV2{}}
+	for _, t := range s.tank.Targets() {
+		t2 := &api.GwTargetV2{
+			Name:         t.QualifiedName(),
+			Type:         t.Type,
+			Prefix:       t.Prefix,
+			NetNS:        t.NetNS,
+			StartTime:    t.StartTime,
+			Pid:          t.Pid,
+			BootTime:     t.BootTime,
+			ContainerID:  t.ContainerID,
+			SandboxID:    t.SandboxID,
+			Capabilities: t.Capabilities,
+			NodeName:     t.NodeName,
+		}
+		for _, nif := range t.NetworkInterfaces {
+			details := t.InterfaceDetails[nif]
+			t2.Interfaces = append(t2.Interfaces, api.GwInterfaceV2{
+				Name:      nif,
+				Master:    details.Master,
+				PeerNetNS: details.PeerNetNS,
+			})
+		}
+		td.Targets = append(td.Targets, t2)
+	}
+	_ = json.NewEncoder(w).Encode(td)
+}
+
+// capture serves a scripted capture stream over a websocket, or as an HTTP
+// response body or Server-Sent Events if enabled, taking the capture target
+// and capture options from the query parameters.
+func (s *Server) capture(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodHead {
+		s.probe(w, req)
+		return
+	}
+	s.mu.Lock()
+	h2stream, sse, nows, cookie := s.h2stream, s.sse, s.nows, s.cookie
+	s.mu.Unlock()
+	streamHTTP := !websocket.IsWebSocketUpgrade(req)
+	if !streamHTTP && nows {
+		http.Error(w, "websockets blocked", http.StatusForbidden)
+		return
+	}
+	var mediatype string
+	if streamHTTP {
+		switch {
+		case h2stream && accepts(req, csharg.CaptureStreamMediaType):
+			mediatype = csharg.CaptureStreamMediaType
+		case sse && accepts(req, csharg.CaptureEventStreamMediaType):
+			mediatype = csharg.CaptureEventStreamMediaType
+		default:
+			http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+	}
+	q := captureParams(req)
+	t, err := api.DecodeTarget([]byte(q.Get("container")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := &csharg.CaptureOptions{
+		Filter:               q.Get("filter"),
+		AvoidPromiscuousMode: q.Has("chaste"),
+		Session: csharg.SessionMetadata{
+			Requester: q.Get("requester"),
+			Reason:    q.Get("reason"),
+			Ticket:    q.Get("ticket"),
+		},
+	}
+	if nifs := q.Get("nif"); nifs != "" && nifs != "all" {
+		opts.Nifs = strings.Split(nifs, "/")
+	}
+	if snaplen := q.Get("snaplen"); snaplen != "" {
+		if opts.SnapLen, err = strconv.Atoi(snaplen); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.VLANs, err = csharg.ParseVLANs(q.Get("vlan")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Decapsulate, err = csharg.ParseEncapsulations(q.Get("decap")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	faults, reject := s.streamFaults(t.QualifiedName(), false)
+	if reject != 0 {
+		http.Error(w, http.StatusText(reject), reject)
+		return
+	}
+	stream, err := s.tank.start(t, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cookie != nil {
+		http.SetCookie(w, cookie)
+	}
+	if streamHTTP {
+		w.Header().Set("Content-Type", mediatype)
+		w.WriteHeader(http.StatusOK)
+		s.streamHTTP(w, req, stream, faults, func(chunk []byte) error {
+			if mediatype == csharg.CaptureEventStreamMediaType {
+				_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n",
+					csharg.CaptureEvent, base64.StdEncoding.EncodeToString(chunk))
+				return err
+			}
+			_, err := w.Write(chunk)
+			return err
+		})
+		return
+	}
+	upgrader := websocket.Upgrader{}
+	ws, err := upgrader.Upgrade(w, req, w.Header())
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	// Reading from the websocket handles the client closing the capture: the
+	// default close handler acknowledges it and then reading fails.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for _, fault := range faults {
+			if fault.Kind == FaultSlowRead {
+				time.Sleep(fault.Duration)
+			}
+		}
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	if stream == nil {
+		<-stopped
+		return
+	}
+	for idx := 0; idx <= len(stream.Chunks); idx++ {
+		if !s.inject(ws, faults, idx, stopped) {
+			return
+		}
+		if idx == len(stream.Chunks) {
+			break
+		}
+		chunk := stream.Chunks[idx]
+		if idx == 0 && hasFault(faults, FaultMalformedSHB) {
+			chunk = malformed(chunk)
+		}
+		if stream.Interval > 0 {
+			select {
+			case <-time.After(stream.Interval):
+			case <-stopped:
+				return
+			}
+		}
+		if err := ws.WriteMessage(websocket.BinaryMessage, chunk); err != nil {
+			log.Debugf("simulated capture stream failed: %s", err.Error())
+			return
+		}
+	}
+	if stream.End {
+		_ = ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "capture ended"),
+			time.Now().Add(closeTimeout))
+		select {
+		case <-stopped:
+		case <-time.After(closeTimeout):
+		}
+		return
+	}
+	<-stopped
+}
+
+// accepts returns true if the request accepts the specified media type.
+func accepts(req *http.Request, mediatype string) bool {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		if mt, _, _ := mime.ParseMediaType(accept); mt == mediatype {
+			return true
+		}
+	}
+	return false
+}
+
+// streamHTTP serves a scripted capture stream as an HTTP response body using
+// the specified chunk writer, injecting the stall and disconnect faults. The
+// response header must have already been written. It returns true if the
+// scripted capture stream ended.
+func (s *Server) streamHTTP(w http.ResponseWriter, req *http.Request, stream *Stream, faults []Fault, write func([]byte) error) bool {
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+	stopped := req.Context().Done()
+	if stream == nil {
+		<-stopped
+		return false
+	}
+	for idx := 0; idx <= len(stream.Chunks); idx++ {
+		for _, fault := range faults {
+			if fault.After != idx {
+				continue
+			}
+			switch fault.Kind {
+			case FaultDisconnect:
+				log.Debugf("simulated capture stream disconnecting after %d chunks", idx)
+				panic(http.ErrAbortHandler)
+			case FaultStall:
+				log.Debugf("simulated capture stream stalling after %d chunks", idx)
+				select {
+				case <-time.After(fault.Duration):
+				case <-stopped:
+					return false
+				}
+			}
+		}
+		if idx == len(stream.Chunks) {
+			break
+		}
+		chunk := stream.Chunks[idx]
+		if idx == 0 && hasFault(faults, FaultMalformedSHB) {
+			chunk = malformed(chunk)
+		}
+		if stream.Interval > 0 {
+			select {
+			case <-time.After(stream.Interval):
+			case <-stopped:
+				return false
+			}
+		}
+		if err := write(chunk); err != nil {
+			log.Debugf("simulated capture stream failed: %s", err.Error())
+			return false
+		}
+		flush()
+	}
+	if !stream.End {
+		<-stopped
+		return false
+	}
+	return true
+}
+
+// probe answers capture permission probes without starting a capture, taking
+// the capture target from the query parameters.
+func (s *Server) probe(w http.ResponseWriter, req *http.Request) {
+	t, err := api.DecodeTarget([]byte(captureParams(req).Get("container")))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, reject := s.streamFaults(t.QualifiedName(), true); reject != 0 {
+		w.WriteHeader(reject)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// captureParams returns the capture target and options from the URL query
+// parameters, or otherwise from the capture service headers, as the
+// Kubernetes remote API server proxy loses the query parameters of websocket
+// requests.
+func captureParams(req *http.Request) url.Values {
+	q := req.URL.Query()
+	if q.Has("container") {
+		return q
+	}
+	for _, param := range []struct{ header, name string }{
+		{"Clustershark-Container", "container"},
+		{"Clustershark-Nif", "nif"},
+		{"Clustershark-Filter", "filter"},
+		{"Clustershark-Chaste", "chaste"},
+		{"Clustershark-Requester", "requester"},
+		{"Clustershark-Reason", "reason"},
+		{"Clustershark-Ticket", "ticket"},
+		{"Clustershark-Vlan", "vlan"},
+		{"Clustershark-Decap", "decap"},
+		{"Clustershark-Snaplen", "snaplen"},
+	} {
+		if values, ok := req.Header[param.header]; ok {
+			q[param.name] = values
+		}
+	}
+	return q
+}
+
+// captureGRPC serves a scripted capture stream as a gRPC server stream of the
+// csharg.capture.v1.CaptureService Capture method, if enabled.
+func (s *Server) captureGRPC(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	enabled := s.grpc
+	s.mu.Unlock()
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !enabled {
+		grpcStatus(w, capturerpc.Unimplemented, "unknown service csharg.capture.v1.CaptureService")
+		return
+	}
+	msg, err := capturerpc.ReadMessage(req.Body, capturerpc.DefaultMaxMessageSize)
+	if err != nil {
+		grpcStatus(w, capturerpc.InvalidArgument, err.Error())
+		return
+	}
+	var capreq capturerpc.CaptureRequest
+	if err := capreq.Unmarshal(msg); err != nil {
+		grpcStatus(w, capturerpc.InvalidArgument, err.Error())
+		return
+	}
+	t, err := api.DecodeTarget([]byte(capreq.Container))
+	if err != nil {
+		grpcStatus(w, capturerpc.InvalidArgument, err.Error())
+		return
+	}
+	opts := &csharg.CaptureOptions{
+		Nifs:                 capreq.Nifs,
+		Filter:               capreq.Filter,
+		AvoidPromiscuousMode: capreq.Chaste,
+		SnapLen:              int(capreq.SnapLen),
+		Session: csharg.SessionMetadata{
+			Requester: req.Header.Get("Clustershark-Requester"),
+			Reason:    req.Header.Get("Clustershark-Reason"),
+			Ticket:    req.Header.Get("Clustershark-Ticket"),
+		},
+	}
+	for _, vlan := range capreq.VLANs {
+		opts.VLANs = append(opts.VLANs, uint16(vlan))
+	}
+	for _, decap := range capreq.Decap {
+		opts.Decapsulate = append(opts.Decapsulate, csharg.Encapsulation(decap))
+	}
+	faults, reject := s.streamFaults(t.QualifiedName(), false)
+	switch reject {
+	case http.StatusUnauthorized:
+		grpcStatus(w, capturerpc.Unauthenticated, "unauthorized")
+		return
+	case http.StatusForbidden:
+		grpcStatus(w, capturerpc.PermissionDenied, "forbidden")
+		return
+	}
+	stream, err := s.tank.start(t, opts)
+	if err != nil {
+		grpcStatus(w, capturerpc.Internal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", capturerpc.ContentType)
+	w.Header().Set("Trailer", capturerpc.StatusHeader)
+	w.WriteHeader(http.StatusOK)
+	if s.streamHTTP(w, req, stream, faults, func(chunk []byte) error {
+		return capturerpc.WriteMessage(w, (&capturerpc.CaptureChunk{Data: chunk}).Marshal())
+	}) {
+		w.Header().Set(capturerpc.StatusHeader, "0")
+	}
+}
+
+// grpcStatus sends a trailers-only gRPC response with the specified status.
+func grpcStatus(w http.ResponseWriter, code capturerpc.Code, message string) {
+	w.Header().Set("Content-Type", capturerpc.ContentType)
+	w.Header().Set(capturerpc.StatusHeader, strconv.FormatUint(uint64(code), 10))
+	w.Header().Set(capturerpc.MessageHeader, capturerpc.EncodeMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// inject injects the faults due after the specified number of chunks have
+// been sent. It returns false if the capture stream must not continue.
+func (s *Server) inject(ws *websocket.Conn, faults []Fault, sent int, stopped <-chan struct{}) bool {
+	for _, fault := range faults {
+		if fault.After != sent {
+			continue
+		}
+		switch fault.Kind {
+		case FaultDisconnect:
+			log.Debugf("simulated capture stream disconnecting after %d chunks", sent)
+			ws.UnderlyingConn().Close()
+			return false
+		case FaultStall:
+			log.Debugf("simulated capture stream stalling after %d chunks", sent)
+			select {
+			case <-time.After(fault.Duration):
+			case <-stopped:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasFault returns true if the faults contain a fault of the specified kind.
+func hasFault(faults []Fault, kind FaultKind) bool {
+	for _, fault := range faults {
+		if fault.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
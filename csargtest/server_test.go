@@ -0,0 +1,792 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.b.Bytes()...)
+}
+
+var _ = Describe("simulated capture service", func() {
+
+	foo := &api.Target{Name: "foo", Type: api.TypeDocker, NetworkInterfaces: []string{"eth0", "lo"}}
+
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+	})
+
+	It("discovers targets and captures until the stream ends", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		targets := client.Targets()
+		Expect(targets).To(HaveLen(1))
+		Expect(targets[0].Name).To(Equal("foo"))
+
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, targets[0], &csharg.CaptureOptions{
+			Nifs:                 csharg.Nifs{"eth0"},
+			Filter:               "tcp",
+			AvoidPromiscuousMode: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+
+		r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+		b, err := r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		sh, err := b.SectionHeader()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sh.Comment()).To(ContainSubstring("foo"))
+		b, err = r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.Type).To(Equal(pcapng.BlockIDB))
+
+		Expect(st.Captures()).To(HaveLen(1))
+		Expect(st.Captures()[0].Target.Name).To(Equal("foo"))
+		Expect(st.Captures()[0].Options).To(Equal(csharg.CaptureOptions{
+			Nifs:                 csharg.Nifs{"eth0"},
+			Filter:               "tcp",
+			AvoidPromiscuousMode: true,
+		}))
+	})
+
+	It("discovers targets using the v2 schema", func() {
+		srv.SetSchemaVersion(2)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		targets := client.Targets()
+		Expect(targets).To(HaveLen(1))
+		Expect(targets[0].Name).To(Equal("foo"))
+		Expect(targets[0].NetworkInterfaces).To(Equal([]string{"eth0", "lo"}))
+	})
+
+	DescribeTable("discovers pods with their namespaces and captures from them",
+		func(schema int) {
+			st.SetTargets(&api.Target{Name: "kube-system/coredns", Type: "pod", NetworkInterfaces: []string{"eth0"}})
+			st.SetStream("kube-system/coredns", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			srv.SetSchemaVersion(schema)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			targets := client.Targets()
+			Expect(targets).To(HaveLen(1))
+			Expect(targets[0].Namespace).To(Equal("kube-system"))
+			Expect(targets[0].Name).To(Equal("coredns"))
+			Expect(targets[0].QualifiedName()).To(Equal("kube-system/coredns"))
+
+			var buff syncBuffer
+			cs, err := client.CapturePod(&buff, "kube-system/coredns", nil)
+			Expect(err).NotTo(HaveOccurred())
+			cs.Wait()
+			Expect(buff.Bytes()).NotTo(BeEmpty())
+			Expect(st.Captures()).To(ConsistOf(HaveField("Target.Namespace", "kube-system")))
+		},
+		Entry("original schema", 1),
+		Entry("v2 schema", 2),
+	)
+
+	It("cancels in-flight discoveries when clearing", func() {
+		srv.SetDiscoveryDelay(5 * time.Second)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		discovered := make(chan api.Targets)
+		go func() { discovered <- client.Targets() }()
+		time.Sleep(200 * time.Millisecond)
+		client.Clear()
+		var targets api.Targets
+		Eventually(discovered, "2s").Should(Receive(&targets))
+		Expect(targets).To(BeEmpty())
+
+		srv.SetDiscoveryDelay(0)
+		st.SetTargets(&api.Target{Name: "bar", Type: api.TypeDocker})
+		Expect(client.Targets()).To(ConsistOf(HaveField("Name", "bar")))
+	})
+
+	It("applies separate discovery and handshake timeouts", func() {
+		srv.SetDiscoveryDelay(time.Second)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{
+				Timeout:          5 * time.Second,
+				DiscoveryTimeout: 100 * time.Millisecond,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(BeEmpty())
+
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{
+				Timeout:                 100 * time.Millisecond,
+				DiscoveryTimeout:        5 * time.Second,
+				CaptureHandshakeTimeout: 5 * time.Second,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(HaveLen(1))
+	})
+
+	It("tunes the connections to the capture service", func() {
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			Dialer: csharg.DialerOptions{Timeout: time.Second, KeepAlive: -1, IPFamily: csharg.IPFamilyV4},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(HaveLen(1))
+		cs, err := client.Capture(&syncBuffer{}, client.Targets()[0], nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+
+		// The simulated capture service listens only on IPv4 loopback.
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			Dialer: csharg.DialerOptions{IPFamily: csharg.IPFamilyV6},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(BeEmpty())
+	})
+
+	It("bounds concurrent dials and shares connections between captures", func() {
+		srv.SetHTTPStreaming(true)
+		var mu sync.Mutex
+		var dials, dialing, maxDialing int
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			dials++
+			dialing++
+			if dialing > maxDialing {
+				maxDialing = dialing
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				dialing--
+				mu.Unlock()
+			}()
+			time.Sleep(10 * time.Millisecond)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			DialContext: dial,
+			Dialer:      csharg.DialerOptions{MaxConcurrentDials: 1},
+			Transport:   csharg.TransportHTTP2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		target := client.Targets()[0]
+
+		const captures = 8
+		css := make(chan csharg.CaptureStreamer, captures)
+		var wg sync.WaitGroup
+		for i := 0; i < captures; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				cs, err := client.Capture(&syncBuffer{}, target, nil)
+				Expect(err).NotTo(HaveOccurred())
+				css <- cs
+			}()
+		}
+		wg.Wait()
+		close(css)
+		for cs := range css {
+			cs.Stop()
+		}
+		Expect(client.Close()).To(Succeed())
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(maxDialing).To(Equal(1))
+		Expect(dials).To(BeNumerically("<", captures))
+	})
+
+	It("limits concurrent captures", func() {
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{MaxCaptures: 2})
+		Expect(err).NotTo(HaveOccurred())
+		target := client.Targets()[0]
+		cs1, err := client.Capture(&syncBuffer{}, target, nil)
+		Expect(err).NotTo(HaveOccurred())
+		pc, err := client.Prepare(&syncBuffer{}, target, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Capture(&syncBuffer{}, target, nil)).Error().To(MatchError(csharg.ErrTooManyCaptures))
+
+		pc.Cancel()
+		cs2, err := client.Capture(&syncBuffer{}, target, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Prepare(&syncBuffer{}, target, nil)).Error().To(MatchError(csharg.ErrTooManyCaptures))
+
+		cs1.Stop()
+		var cs3 csharg.CaptureStreamer
+		Eventually(func() (err error) {
+			cs3, err = client.Capture(&syncBuffer{}, target, nil)
+			return
+		}).Should(Succeed())
+		cs2.Stop()
+		cs3.Stop()
+	})
+
+	It("discovers and checks target capabilities", func() {
+		st.SetTargets(&api.Target{
+			Name: "foo", Type: api.TypeDocker, NetworkInterfaces: []string{"eth0", "lo"},
+			Capabilities: &api.Capabilities{MaxNifs: 1},
+		})
+		srv.SetSchemaVersion(2)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		targets := client.Targets()
+		Expect(targets).To(HaveLen(1))
+		Expect(targets[0].Capabilities).To(Equal(&api.Capabilities{MaxNifs: 1}))
+
+		opts := &csharg.CaptureOptions{Nifs: csharg.Nifs{"eth0"}}
+		Expect(opts.CheckCapabilities(targets[0])).To(Succeed())
+		opts.Filter = "tcp"
+		Expect(opts.CheckCapabilities(targets[0])).To(MatchError(ContainSubstring("does not support capture filters")))
+		opts = &csharg.CaptureOptions{}
+		Expect(opts.CheckCapabilities(targets[0])).To(MatchError(ContainSubstring("at most 1 network interfaces, but 2 requested")))
+	})
+
+	It("checks VLAN and encapsulation capabilities", func() {
+		t := &api.Target{Name: "foo", Type: api.TypeDocker, Capabilities: &api.Capabilities{
+			SupportsVLAN:   true,
+			Decapsulations: []string{"vxlan"},
+		}}
+		opts := &csharg.CaptureOptions{
+			VLANs:       []uint16{10},
+			Decapsulate: []csharg.Encapsulation{csharg.EncapsulationVXLAN},
+		}
+		Expect(opts.CheckCapabilities(t)).To(Succeed())
+		opts.Decapsulate = append(opts.Decapsulate, csharg.EncapsulationGRE)
+		Expect(opts.CheckCapabilities(t)).To(MatchError(ContainSubstring("does not support stripping gre encapsulation")))
+		t.Capabilities = &api.Capabilities{}
+		opts.Decapsulate = nil
+		Expect(opts.CheckCapabilities(t)).To(MatchError(ContainSubstring("does not support capturing VLANs")))
+	})
+
+	It("captures pods in the configured namespace", func() {
+		st.SetTargets(foo,
+			&api.Target{Name: "bar", Namespace: "default", Type: api.TypePod},
+			&api.Target{Name: "bar", Namespace: "team", Type: api.TypePod})
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Namespace: "team"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cs, err := client.CapturePod(&syncBuffer{}, "bar", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		cs, err = client.CapturePod(&syncBuffer{}, "default/bar", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		Expect(st.Captures()).To(HaveLen(2))
+		Expect(st.Captures()[0].Target.QualifiedName()).To(Equal("team/bar"))
+		Expect(st.Captures()[1].Target.QualifiedName()).To(Equal("default/bar"))
+	})
+
+	It("captures containers by their truncated IDs", func() {
+		st.SetTargets(
+			&api.Target{Name: "web", Type: api.TypeDocker, NetworkInterfaces: []string{"eth0"}, ContainerID: "4f1c0e2d9a7b"},
+			&api.Target{Name: "db", Type: api.TypeDocker, NetworkInterfaces: []string{"eth0"}, ContainerID: "4f2a"})
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs, err := client.CaptureContainer(&syncBuffer{}, "", "4f1c", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		cs, err = client.CaptureContainer(&syncBuffer{}, "", "db", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		Expect(st.Captures()).To(HaveLen(2))
+		Expect(st.Captures()[0].Target.Name).To(Equal("web"))
+		Expect(st.Captures()[1].Target.Name).To(Equal("db"))
+		Expect(client.CaptureContainer(&syncBuffer{}, "", "4f", nil)).Error().To(MatchError(ContainSubstring("ambiguous")))
+	})
+
+	It("stops running captures", func() {
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs, err := client.Capture(&syncBuffer{}, client.Targets()[0], nil)
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Stop()
+		}()
+		Eventually(done, "5s").Should(BeClosed())
+	})
+
+	It("rejects failing captures and unauthorized requests", func() {
+		st.SetCaptureError("foo", errors.New("boom"))
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Capture(&syncBuffer{}, foo, nil)).Error().To(HaveOccurred())
+
+		srv.RequireBearerToken("secret")
+		client, err = csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(BeEmpty())
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{BearerToken: "secret"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(HaveLen(1))
+	})
+
+	It("authenticates using basic authentication", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		srv.RequireBasicAuth("jane", "doe")
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Username: "jane", Password: "dough"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(BeEmpty())
+
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Username: "jane", Password: "doe"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(HaveLen(1))
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, client.Targets()[0], nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+		Expect(buff.Bytes()).NotTo(BeEmpty())
+	})
+
+	It("authenticates using SPNEGO", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		srv.RequireNegotiate([]byte("kerberos-ticket"))
+		var mu sync.Mutex
+		var spns []string
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{
+				Negotiate: func(spn string) ([]byte, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					spns = append(spns, spn)
+					return []byte("kerberos-ticket"), nil
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(HaveLen(1))
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, client.Targets()[0], nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+		Expect(buff.Bytes()).NotTo(BeEmpty())
+		mu.Lock()
+		Expect(spns).To(HaveEach("HTTP/127.0.0.1"))
+		Expect(spns).To(HaveLen(2), "must use a fresh token for each request")
+		mu.Unlock()
+
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{
+				Negotiate: func(spn string) ([]byte, error) { return nil, errors.New("no ticket") },
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(BeEmpty())
+	})
+
+	It("checks capture permissions without capturing", func() {
+		srv.RequireBearerToken("t0k3n")
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{BearerToken: "t0k3n"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.CanCapture(foo)).To(Succeed())
+
+		srv.SetFaults(Fault{Kind: FaultForbidden, Target: "foo"})
+		Expect(client.CanCapture(foo)).To(MatchError(csharg.ErrForbidden))
+		Expect(st.Captures()).To(BeEmpty())
+
+		client, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{BearerToken: "wr0ng"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.CanCapture(foo)).To(MatchError(csharg.ErrUnauthenticated))
+	})
+
+	DescribeTable("captures over HTTP/2 streams",
+		func(useTLS bool) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			h2srv := srv
+			opts := &csharg.SharkTankOnHostOptions{Transport: csharg.TransportHTTP2}
+			if useTLS {
+				h2srv = NewTLSServer(st)
+				defer h2srv.Close()
+				opts.TLSConfig = h2srv.Client().Transport.(*http.Transport).TLSClientConfig
+			}
+			h2srv.SetHTTPStreaming(true)
+			client, err := csharg.NewSharkTankOnHost(h2srv.URL, opts)
+			Expect(err).NotTo(HaveOccurred())
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, client.Targets()[0], nil)
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+
+			r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+			packets := 0
+			for {
+				b, err := r.Next()
+				if err != nil {
+					break
+				}
+				if b.Type == pcapng.BlockEPB {
+					packets++
+				}
+			}
+			Expect(packets).To(Equal(3))
+		},
+		Entry("h2c", false),
+		Entry("TLS", true),
+	)
+
+	DescribeTable("passes raw capture streams through unmodified",
+		func(transport csharg.CaptureTransport) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+			srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{Transport: transport})
+			Expect(err).NotTo(HaveOccurred())
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, client.Targets()[0], &csharg.CaptureOptions{Raw: true})
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+			Expect(buff.Bytes()).To(Equal(stream))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	DescribeTable("downgrades to HTTP capture streams when websockets are blocked",
+		func(transport csharg.CaptureTransport, sse bool, blocked bool) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			srv.BlockWebsockets(blocked)
+			srv.SetEventStreaming(sse)
+			srv.SetHTTPStreaming(!sse)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+				Transport: transport,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, client.Targets()[0], nil)
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+
+			r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+			packets := 0
+			for {
+				b, err := r.Next()
+				if err != nil {
+					break
+				}
+				if b.Type == pcapng.BlockEPB {
+					packets++
+				}
+			}
+			Expect(packets).To(Equal(3))
+		},
+		Entry("websocket rejected, chunked", csharg.TransportWebsocket, false, true),
+		Entry("websocket rejected, SSE", csharg.TransportWebsocket, true, true),
+		Entry("SSE requested", csharg.TransportSSE, true, false),
+	)
+
+	It("reports rejected websockets without HTTP capture streams", func() {
+		srv.BlockWebsockets(true)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Capture(io.Discard, client.Targets()[0], nil)
+		Expect(err).To(MatchError(websocket.ErrBadHandshake))
+	})
+
+	DescribeTable("captures over gRPC streams",
+		func(useTLS bool) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			grpcsrv := srv
+			opts := &csharg.SharkTankOnHostOptions{Transport: csharg.TransportGRPC}
+			if useTLS {
+				grpcsrv = NewTLSServer(st)
+				defer grpcsrv.Close()
+				opts.TLSConfig = grpcsrv.Client().Transport.(*http.Transport).TLSClientConfig
+			}
+			grpcsrv.SetGRPCStreaming(true)
+			client, err := csharg.NewSharkTankOnHost(grpcsrv.URL, opts)
+			Expect(err).NotTo(HaveOccurred())
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, client.Targets()[0], &csharg.CaptureOptions{
+				Nifs:   []string{"eth0"},
+				Filter: "tcp",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+
+			r := pcapng.NewReader(bytes.NewReader(buff.Bytes()))
+			packets := 0
+			for {
+				b, err := r.Next()
+				if err != nil {
+					break
+				}
+				if b.Type == pcapng.BlockEPB {
+					packets++
+				}
+			}
+			Expect(packets).To(Equal(3))
+			Expect(st.Captures()).To(ConsistOf(HaveField("Options.Nifs", ConsistOf("eth0"))))
+		},
+		Entry("h2c", false),
+		Entry("TLS", true),
+	)
+
+	DescribeTable("sends session metadata",
+		func(transport csharg.CaptureTransport) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			srv.SetHTTPStreaming(true)
+			srv.SetEventStreaming(true)
+			srv.SetGRPCStreaming(true)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{Transport: transport})
+			Expect(err).NotTo(HaveOccurred())
+			session := csharg.SessionMetadata{
+				Requester: "Jane Doe",
+				Reason:    "investigating MQTT disconnects",
+				Ticket:    "INC-42",
+			}
+			cs, err := client.Capture(&syncBuffer{}, client.Targets()[0], &csharg.CaptureOptions{Session: session})
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+			Expect(st.Captures()).To(ConsistOf(HaveField("Options.Session", Equal(session))))
+
+			Expect(client.Capture(&syncBuffer{}, client.Targets()[0], &csharg.CaptureOptions{
+				Session: csharg.SessionMetadata{Reason: "line\nbreak"},
+			})).Error().To(MatchError(ContainSubstring("control characters")))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("SSE", csharg.TransportSSE),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	DescribeTable("sends VLAN and encapsulation options",
+		func(transport csharg.CaptureTransport) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			srv.SetHTTPStreaming(true)
+			srv.SetEventStreaming(true)
+			srv.SetGRPCStreaming(true)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{Transport: transport})
+			Expect(err).NotTo(HaveOccurred())
+			vlans := []uint16{10, 20}
+			decap := []csharg.Encapsulation{csharg.EncapsulationVXLAN, csharg.EncapsulationGeneve}
+			cs, err := client.Capture(&syncBuffer{}, client.Targets()[0], &csharg.CaptureOptions{
+				VLANs:       vlans,
+				Decapsulate: decap,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+			Expect(st.Captures()).To(ConsistOf(And(
+				HaveField("Options.VLANs", Equal(vlans)),
+				HaveField("Options.Decapsulate", Equal(decap)))))
+
+			Expect(client.Capture(&syncBuffer{}, client.Targets()[0], &csharg.CaptureOptions{
+				VLANs: []uint16{4095},
+			})).Error().To(MatchError(ContainSubstring("invalid VLAN ID 4095")))
+			Expect(client.Capture(&syncBuffer{}, client.Targets()[0], &csharg.CaptureOptions{
+				Decapsulate: []csharg.Encapsulation{"mpls"},
+			})).Error().To(MatchError(ContainSubstring(`invalid encapsulation "mpls"`)))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("SSE", csharg.TransportSSE),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	DescribeTable("excludes loopback",
+		func(transport csharg.CaptureTransport) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			srv.SetHTTPStreaming(true)
+			srv.SetEventStreaming(true)
+			srv.SetGRPCStreaming(true)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{Transport: transport})
+			Expect(err).NotTo(HaveOccurred())
+			cs, err := client.Capture(&syncBuffer{}, client.Targets()[0], &csharg.CaptureOptions{NoLoopback: true})
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+			Expect(st.Captures()).To(ConsistOf(HaveField("Options.Nifs", ConsistOf("eth0"))))
+
+			lo := &api.Target{Name: "foo", Type: api.TypeDocker, NetworkInterfaces: []string{"lo"}}
+			Expect(client.Capture(&syncBuffer{}, lo, &csharg.CaptureOptions{NoLoopback: true})).Error().To(
+				MatchError(ContainSubstring("no network interfaces besides loopback")))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("SSE", csharg.TransportSSE),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("parses VLAN and encapsulation lists", func() {
+		Expect(csharg.ParseVLANs("10, 4094")).To(Equal([]uint16{10, 4094}))
+		Expect(csharg.ParseVLANs("")).To(BeNil())
+		Expect(csharg.ParseVLANs("0")).Error().To(HaveOccurred())
+		Expect(csharg.ParseVLANs("10,x")).Error().To(HaveOccurred())
+		Expect(csharg.ParseEncapsulations("VXLAN,gre")).To(Equal([]csharg.Encapsulation{
+			csharg.EncapsulationVXLAN, csharg.EncapsulationGRE}))
+		Expect(csharg.ParseEncapsulations("")).To(BeNil())
+		Expect(csharg.ParseEncapsulations("mpls")).Error().To(MatchError(ContainSubstring("expecting vxlan,geneve,gre,ipip")))
+	})
+
+	DescribeTable("prepares captures and starts them later",
+		func(transport csharg.CaptureTransport) {
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+			srv.SetHTTPStreaming(true)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{Transport: transport})
+			Expect(err).NotTo(HaveOccurred())
+			var buff syncBuffer
+			pc, err := client.Prepare(&buff, client.Targets()[0], nil)
+			Expect(err).NotTo(HaveOccurred())
+			Consistently(buff.Bytes, "100ms").Should(BeEmpty())
+			cs, err := pc.Start()
+			Expect(err).NotTo(HaveOccurred())
+			cs.StopAfter(5 * time.Second)
+			Expect(buff.Bytes()).NotTo(BeEmpty())
+			Expect(st.Captures()).To(HaveLen(1))
+			Expect(pc.Start()).Error().To(MatchError(csharg.ErrNotPrepared))
+
+			pc, err = client.Prepare(&syncBuffer{}, client.Targets()[0], nil)
+			Expect(err).NotTo(HaveOccurred())
+			pc.Cancel()
+			pc.Cancel()
+			Expect(pc.Start()).Error().To(MatchError(csharg.ErrNotPrepared))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+	)
+
+	DescribeTable("stops all captures when closing",
+		func(transport csharg.CaptureTransport) {
+			srv.SetHTTPStreaming(true)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{Transport: transport})
+			Expect(err).NotTo(HaveOccurred())
+			cs1, err := client.Capture(&syncBuffer{}, client.Targets()[0], nil)
+			Expect(err).NotTo(HaveOccurred())
+			cs2, err := client.Capture(&syncBuffer{}, client.Targets()[0], nil)
+			Expect(err).NotTo(HaveOccurred())
+			pc, err := client.Prepare(&syncBuffer{}, client.Targets()[0], nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				Expect(client.Close()).To(Succeed())
+			}()
+			Eventually(closed, "5s").Should(BeClosed())
+			for _, cs := range []csharg.CaptureStreamer{cs1, cs2} {
+				done := make(chan struct{})
+				go func(cs csharg.CaptureStreamer) {
+					defer close(done)
+					cs.Wait()
+				}(cs)
+				Eventually(done).Should(BeClosed())
+			}
+			Expect(pc.Start()).Error().To(MatchError(csharg.ErrClosed))
+
+			Expect(client.Close()).To(Succeed())
+			Expect(client.Capture(&syncBuffer{}, foo, nil)).Error().To(MatchError(csharg.ErrClosed))
+			Expect(client.Prepare(&syncBuffer{}, foo, nil)).Error().To(MatchError(csharg.ErrClosed))
+			client.Clear()
+			Expect(client.Targets()).To(BeEmpty())
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+	)
+
+	It("requests HTTP capture streams only when starting prepared captures", func() {
+		srv.SetHTTPStreaming(true)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			Transport: csharg.TransportHTTP2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		pc, err := client.Prepare(&syncBuffer{}, client.Targets()[0], nil)
+		Expect(err).NotTo(HaveOccurred())
+		pc.Cancel()
+		Consistently(st.Captures, "100ms").Should(BeEmpty())
+	})
+
+	It("falls back to websockets when gRPC streams are unimplemented", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			Transport: csharg.TransportGRPC,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, client.Targets()[0], nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+		Expect(buff.Bytes()).NotTo(BeEmpty())
+		Expect(st.Captures()).To(HaveLen(1))
+	})
+
+	It("falls back to websockets when HTTP/2 streams are unsupported", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			Transport: csharg.TransportHTTP2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		var buff syncBuffer
+		cs, err := client.Capture(&buff, client.Targets()[0], nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.StopAfter(5 * time.Second)
+		Expect(buff.Bytes()).NotTo(BeEmpty())
+		Expect(st.Captures()).To(HaveLen(1))
+
+		_, err = csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{Transport: "carrier-pigeon"})
+		Expect(err).To(MatchError(ContainSubstring("unsupported capture transport")))
+	})
+
+	It("serves over TLS", func() {
+		tlssrv := NewTLSServer(st)
+		defer tlssrv.Close()
+		client, err := csharg.NewSharkTankOnHost(tlssrv.URL, &csharg.SharkTankOnHostOptions{
+			TLSConfig: tlssrv.Client().Transport.(*http.Transport).TLSClientConfig,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Targets()).To(HaveLen(1))
+	})
+
+})
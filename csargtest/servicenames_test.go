@@ -0,0 +1,112 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const k8sServices = `{"kind":"ServiceList","items":[
+{"metadata":{"name":"kube-dns","namespace":"kube-system"},"spec":{"clusterIP":"10.96.0.10","clusterIPs":["10.96.0.10"]}},
+{"metadata":{"name":"headless","namespace":"default"},"spec":{"clusterIP":"None"}},
+{"metadata":{"name":"kubernetes","namespace":"default"},"spec":{"clusterIP":"10.96.0.1"}}]}`
+
+const k8sEndpoints = `{"kind":"EndpointsList","items":[
+{"metadata":{"name":"kube-dns","namespace":"kube-system"},"subsets":[
+ {"addresses":[{"ip":"10.244.0.2","targetRef":{"kind":"Pod","name":"coredns-1"}}],
+  "notReadyAddresses":[{"ip":"10.244.0.3","targetRef":{"kind":"Pod","name":"coredns-2"}}]}]},
+{"metadata":{"name":"kubernetes","namespace":"default"},"subsets":[{"addresses":[{"ip":"172.18.0.2"}]}]},
+{"metadata":{"name":"orphan","namespace":"default"},"subsets":[{"addresses":[{"ip":"10.244.0.9"}]}]}]}`
+
+var _ = Describe("Kubernetes service names", func() {
+
+	// apiServer returns the URL of a fake Kubernetes API server, serving the
+	// services and endpoints of all namespaces.
+	apiServer := func(token string) string {
+		mux := http.NewServeMux()
+		serve := func(body string) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(body))
+			}
+		}
+		mux.Handle("/api/v1/services", serve(k8sServices))
+		mux.Handle("/api/v1/endpoints", serve(k8sEndpoints))
+		srv := httptest.NewServer(mux)
+		DeferCleanup(srv.Close)
+		return srv.URL
+	}
+
+	It("discovers services and their endpoints", func() {
+		svcs, err := csharg.DiscoverServices(context.Background(), &csharg.ServiceDiscoveryOptions{
+			APIServer:   apiServer("t0k3n"),
+			BearerToken: "t0k3n",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcs).To(Equal([]csharg.Service{
+			{Namespace: "default", Name: "headless"},
+			{Namespace: "default", Name: "kubernetes",
+				ClusterIPs: []netip.Addr{netip.MustParseAddr("10.96.0.1")},
+				Endpoints:  []csharg.ServiceEndpoint{{Addr: netip.MustParseAddr("172.18.0.2")}}},
+			{Namespace: "kube-system", Name: "kube-dns",
+				ClusterIPs: []netip.Addr{netip.MustParseAddr("10.96.0.10")},
+				Endpoints: []csharg.ServiceEndpoint{
+					{Addr: netip.MustParseAddr("10.244.0.2"), Pod: "coredns-1"},
+					{Addr: netip.MustParseAddr("10.244.0.3"), Pod: "coredns-2"},
+				}},
+		}))
+	})
+
+	It("fails for rejected credentials and missing API servers", func() {
+		_, err := csharg.DiscoverServices(context.Background(), &csharg.ServiceDiscoveryOptions{
+			APIServer: apiServer("t0k3n"),
+		})
+		Expect(err).To(MatchError(csharg.ErrUnauthenticated))
+
+		_, err = csharg.DiscoverServices(context.Background(), &csharg.ServiceDiscoveryOptions{
+			APIServer: apiServer("") + "/nowhere",
+		})
+		Expect(err).To(MatchError(ContainSubstring("404")))
+
+		_, err = csharg.DiscoverServices(context.Background(), nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("resolves service and endpoint addresses to names", func() {
+		svcs, err := csharg.DiscoverServices(context.Background(), &csharg.ServiceDiscoveryOptions{
+			APIServer: apiServer(""),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		nr := csharg.ServiceNames(svcs)
+		Expect(nr.Records).To(Equal([]pcapng.NameRecord{
+			{Addr: netip.MustParseAddr("10.96.0.1"), Names: []string{"kubernetes.default.svc"}},
+			{Addr: netip.MustParseAddr("10.96.0.10"), Names: []string{"kube-dns.kube-system.svc"}},
+			{Addr: netip.MustParseAddr("172.18.0.2"), Names: []string{"kubernetes.default.endpoint"}},
+			{Addr: netip.MustParseAddr("10.244.0.2"), Names: []string{"coredns-1.kube-system.pod"}},
+			{Addr: netip.MustParseAddr("10.244.0.3"), Names: []string{"coredns-2.kube-system.pod"}},
+		}))
+		Expect(nr.Options).To(HaveLen(1))
+		Expect(nr.Options[0].String()).To(And(
+			HavePrefix("---\n# kubernetes services\n"),
+			ContainSubstring("name: kube-dns"),
+			ContainSubstring("pod: coredns-1")))
+
+		Expect(csharg.ServiceNames(nil).Records).To(BeEmpty())
+	})
+
+})
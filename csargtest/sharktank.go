@@ -0,0 +1,628 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+)
+
+// Stream describes a scripted capture stream.
+type Stream struct {
+	// Chunks of the capture stream, written one after another, as if they
+	// were arriving in individual websocket messages from a capture service.
+	Chunks [][]byte
+	// Interval optionally delays writing the chunks, starting with the first
+	// chunk.
+	Interval time.Duration
+	// End ends the capture after the last chunk has been written, as if the
+	// capture service has ended the capture. Otherwise, the capture stays
+	// running until it gets stopped, as usual.
+	End bool
+	// Err, if non-nil, makes starting the capture fail with this error.
+	Err error
+}
+
+// Capture records a capture started on the fake SharkTank.
+type Capture struct {
+	Target  *api.Target
+	Options csharg.CaptureOptions
+}
+
+// SharkTank is a configurable in-memory fake implementing the
+// csharg.SharkTank interface. It is safe for concurrent use.
+type SharkTank struct {
+	mu       sync.Mutex
+	targets  api.Targets
+	streams  map[string]*Stream // scripted streams by target name; "" is the default.
+	captures []Capture
+	clears   int
+	active   map[*captureStreamer]struct{}
+	closed   bool
+}
+
+var _ csharg.SharkTank = (*SharkTank)(nil)
+
+// New returns a new fake SharkTank with the specified capture targets. Unless
+// configured otherwise using SetStream, captures produce empty capture streams
+// that stay running until they get stopped.
+func New(targets ...*api.Target) *SharkTank {
+	return &SharkTank{
+		targets: targets,
+		streams: map[string]*Stream{},
+	}
+}
+
+// SetTargets replaces the capture targets.
+func (st *SharkTank) SetTargets(targets ...*api.Target) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.targets = targets
+}
+
+// SetStream sets the scripted capture stream for the named capture target. An
+// empty name sets the default stream for all capture targets without their
+// own stream. A nil stream removes the scripted stream. Pods are named in
+// “namespace/name” convention.
+func (st *SharkTank) SetStream(name string, s *Stream) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if s == nil {
+		delete(st.streams, name)
+		return
+	}
+	st.streams[name] = s
+}
+
+// SetCaptureError makes starting captures from the named capture target fail
+// with the specified error. An empty name applies to all capture targets
+// without their own scripted stream.
+func (st *SharkTank) SetCaptureError(name string, err error) {
+	st.SetStream(name, &Stream{Err: err})
+}
+
+// Captures returns the captures started so far, in order.
+func (st *SharkTank) Captures() []Capture {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]Capture(nil), st.captures...)
+}
+
+// Clears returns how often the target cache has been cleared.
+func (st *SharkTank) Clears() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.clears
+}
+
+// Targets returns the configured capture targets.
+func (st *SharkTank) Targets() api.Targets {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append(api.Targets(nil), st.targets...)
+}
+
+// TargetsContext returns the configured capture targets, unless the context is
+// already done.
+func (st *SharkTank) TargetsContext(ctx context.Context) (api.Targets, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return st.Targets(), nil
+}
+
+// Clear only counts how often it has been called, as the fake doesn't cache.
+func (st *SharkTank) Clear() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.clears++
+}
+
+// Close stops all active captures, waiting for them to terminate. Afterwards,
+// captures fail with csharg.ErrClosed.
+func (st *SharkTank) Close() error {
+	st.mu.Lock()
+	st.closed = true
+	active := st.active
+	st.active = nil
+	st.mu.Unlock()
+	for cs := range active {
+		cs.Stop()
+	}
+	return nil
+}
+
+// Closed returns true if the fake SharkTank has been closed.
+func (st *SharkTank) Closed() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.closed
+}
+
+// CapturePod captures from the named pod, defaulting to the “default”
+// namespace if the pod name lacks a namespace.
+func (st *SharkTank) CapturePod(w io.Writer, podname string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	namespace, name, err := api.ParsePodName(podname)
+	if err != nil {
+		return nil, err
+	}
+	podname = api.PodName(namespace, name)
+	for _, t := range st.Targets() {
+		if t.Type.IsPod() && t.QualifiedName() == podname {
+			return st.Capture(w, t, opts)
+		}
+	}
+	return nil, fmt.Errorf("%w pod %q", csharg.ErrTargetNotFound, podname)
+}
+
+// CaptureContainer captures from the named container on the specified node,
+// or otherwise from the capture target on the node with this (truncated)
+// container or sandbox ID.
+func (st *SharkTank) CaptureContainer(w io.Writer, nodename, name string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	for _, t := range st.Targets() {
+		if !t.Type.IsPod() && t.NodeName == nodename && t.Name == name {
+			return st.Capture(w, t, opts)
+		}
+	}
+	var cache csharg.TargetCache
+	cache.Set(st.Targets())
+	switch ts := cache.MatchID(nodename, name); len(ts) {
+	case 0:
+	case 1:
+		return st.Capture(w, ts[0], opts)
+	default:
+		return nil, fmt.Errorf("%w: container ID %q matches %d capture targets", csharg.ErrAmbiguousTarget, name, len(ts))
+	}
+	return nil, fmt.Errorf("%w container %q on node %q", csharg.ErrTargetNotFound, name, nodename)
+}
+
+// CapturePodContext captures from the named pod like CapturePod, stopping the
+// capture when the context is done.
+func (st *SharkTank) CapturePodContext(ctx context.Context, w io.Writer, podname string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return stopWhenDone(ctx)(st.CapturePod(w, podname, opts))
+}
+
+// CaptureContainerContext captures from the named container like
+// CaptureContainer, stopping the capture when the context is done.
+func (st *SharkTank) CaptureContainerContext(ctx context.Context, w io.Writer, nodename, name string, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return stopWhenDone(ctx)(st.CaptureContainer(w, nodename, name, opts))
+}
+
+// CaptureContext starts a scripted capture like Capture, stopping the capture
+// when the context is done.
+func (st *SharkTank) CaptureContext(ctx context.Context, w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return stopWhenDone(ctx)(st.Capture(w, t, opts))
+}
+
+// stopWhenDone returns a function passing through a started capture or the
+// error starting it, stopping a started capture when the context is done.
+func stopWhenDone(ctx context.Context) func(csharg.CaptureStreamer, error) (csharg.CaptureStreamer, error) {
+	return func(cs csharg.CaptureStreamer, err error) (csharg.CaptureStreamer, error) {
+		if err != nil || ctx.Done() == nil {
+			return cs, err
+		}
+		go func() {
+			ended := make(chan struct{})
+			go func() {
+				cs.Wait()
+				close(ended)
+			}()
+			select {
+			case <-ended:
+			case <-ctx.Done():
+				cs.Stop()
+			}
+		}()
+		return cs, nil
+	}
+}
+
+// Capture starts a scripted capture from the specified capture target, writing
+// the scripted capture stream to w.
+func (st *SharkTank) Capture(w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	if t == nil {
+		return nil, fmt.Errorf("no capture target specified")
+	}
+	if opts == nil {
+		opts = &csharg.CaptureOptions{}
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if st.Closed() {
+		return nil, csharg.ErrClosed
+	}
+	s, err := st.start(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	cs := &captureStreamer{
+		target: t,
+		events: opts.Events,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	st.mu.Lock()
+	if st.active == nil {
+		st.active = map[*captureStreamer]struct{}{}
+	}
+	st.active[cs] = struct{}{}
+	st.mu.Unlock()
+	sink := w
+	var finish []func()
+	if !opts.Raw {
+		pcapedit := pcapng.NewStreamEditor(w, t, opts.Filter, opts.AvoidPromiscuousMode)
+		pcapedit.Names = opts.Names
+		sink = pcapedit
+		finish = append(finish, func() { pcapedit.Finish() })
+		if len(opts.InterfaceAliases) != 0 {
+			pcapedit.Aliases = opts.InterfaceAliases
+			sink = pcapng.NewRenamer(pcapedit, opts.InterfaceAliases)
+		}
+		if opts.SnapLen > 0 {
+			sink = pcapng.NewTruncator(sink, uint32(opts.SnapLen))
+		}
+		if opts.Heartbeat > 0 {
+			hb := pcapng.NewHeartbeat(sink, opts.Heartbeat)
+			sink = hb
+			finish = append(finish, hb.Stop)
+		}
+	}
+	if opts.Alerts != nil {
+		aw := csharg.NewAlertWriter(sink, opts.Alerts)
+		sink = aw
+		finish = append(finish, aw.Finish)
+	}
+	if opts.MaxPackets > 0 {
+		sink = pcapng.NewPacketLimitWriter(sink, opts.MaxPackets, func() { go cs.Stop() })
+	}
+	sw := csharg.NewStatsWriter(sink)
+	sink = sw
+	cs.stats = sw.Stats
+	go func() {
+		cs.stream(sink, s, finish)
+		st.mu.Lock()
+		delete(st.active, cs)
+		st.mu.Unlock()
+	}()
+	return cs, nil
+}
+
+// CaptureMany starts scripted captures from all the specified capture
+// targets, multiplexing their capture streams into w. Stopping the returned
+// capture stops all scripted captures.
+func (st *SharkTank) CaptureMany(w io.Writer, targets []*api.Target, opts *csharg.CaptureOptions) (csharg.CaptureStreamer, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no capture targets specified")
+	}
+	mcs := &captureStreamer{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	// The packet limit applies to all scripted captures together.
+	if opts != nil && opts.MaxPackets > 0 {
+		w = pcapng.NewPacketLimitWriter(w, opts.MaxPackets, func() { go mcs.Stop() })
+		perTarget := *opts
+		perTarget.MaxPackets = 0
+		opts = &perTarget
+	}
+	// Count the multiplexed capture stream, which is close enough for a fake.
+	sw := csharg.NewStatsWriter(w)
+	mcs.stats = sw.Stats
+	mux := pcapng.NewMultiplexer(sw, len(targets))
+	var css []csharg.CaptureStreamer
+	for idx, t := range targets {
+		cs, err := st.Capture(mux.Input(idx), t, opts)
+		if err != nil {
+			for _, cs := range css {
+				cs.Stop()
+			}
+			return nil, err
+		}
+		css = append(css, cs)
+	}
+	var wg sync.WaitGroup
+	for idx, cs := range css {
+		wg.Add(1)
+		go func(idx int, cs csharg.CaptureStreamer) {
+			defer wg.Done()
+			cs.Wait()
+			_ = mux.Input(idx).Close()
+		}(idx, cs)
+	}
+	go func() {
+		wg.Wait()
+		var errs []error
+		for _, cs := range css {
+			if err := cs.Err(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			mcs.fail(err)
+		}
+		close(mcs.done)
+	}()
+	go func() {
+		select {
+		case <-mcs.stop:
+			for _, cs := range css {
+				cs.Stop()
+			}
+		case <-mcs.done:
+		}
+	}()
+	return mcs, nil
+}
+
+// CaptureReader starts a scripted capture from the specified capture target,
+// returning a reader delivering the scripted capture stream. Closing the
+// reader stops the scripted capture.
+func (st *SharkTank) CaptureReader(t *api.Target, opts *csharg.CaptureOptions) (io.ReadCloser, error) {
+	return csharg.CaptureReader(st, t, opts)
+}
+
+// Prepare prepares a scripted capture from the specified capture target,
+// failing with the scripted error, if any. The capture gets recorded only when
+// the prepared capture is started.
+func (st *SharkTank) Prepare(w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.PreparedCapture, error) {
+	if err := st.CanCapture(t); err != nil {
+		return nil, err
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if st.Closed() {
+		return nil, csharg.ErrClosed
+	}
+	return &preparedCapture{st: st, ctx: context.Background(), w: w, t: t, opts: opts}, nil
+}
+
+// PrepareContext prepares a scripted capture like Prepare, stopping the
+// capture when the context is done after the prepared capture has been
+// started.
+func (st *SharkTank) PrepareContext(ctx context.Context, w io.Writer, t *api.Target, opts *csharg.CaptureOptions) (csharg.PreparedCapture, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pc, err := st.Prepare(w, t, opts)
+	if err != nil {
+		return nil, err
+	}
+	pc.(*preparedCapture).ctx = ctx
+	return pc, nil
+}
+
+// preparedCapture implements the csharg.PreparedCapture interface for scripted
+// captures.
+type preparedCapture struct {
+	st   *SharkTank
+	ctx  context.Context
+	w    io.Writer
+	t    *api.Target
+	opts *csharg.CaptureOptions
+
+	mu   sync.Mutex
+	used bool
+}
+
+// Start the prepared capture once.
+func (pc *preparedCapture) Start() (csharg.CaptureStreamer, error) {
+	pc.mu.Lock()
+	used := pc.used
+	pc.used = true
+	pc.mu.Unlock()
+	if used {
+		return nil, csharg.ErrNotPrepared
+	}
+	return pc.st.CaptureContext(pc.ctx, pc.w, pc.t, pc.opts)
+}
+
+// Cancel the prepared capture, unless already started.
+func (pc *preparedCapture) Cancel() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.used = true
+}
+
+// CanCapture returns the scripted error for captures from the specified
+// capture target, if any, without recording a capture.
+func (st *SharkTank) CanCapture(t *api.Target) error {
+	if t == nil {
+		return fmt.Errorf("no capture target specified")
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.streams[t.QualifiedName()]
+	if !ok {
+		s = st.streams[""]
+	}
+	if s != nil {
+		return s.Err
+	}
+	return nil
+}
+
+// start records a new capture from the specified target and returns its
+// scripted capture stream, or nil if there's none. If the capture is to fail,
+// start returns the scripted error instead, without recording the capture.
+func (st *SharkTank) start(t *api.Target, opts *csharg.CaptureOptions) (*Stream, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.streams[t.QualifiedName()]
+	if !ok {
+		s = st.streams[""]
+	}
+	if s != nil && s.Err != nil {
+		return nil, s.Err
+	}
+	st.captures = append(st.captures, Capture{Target: t, Options: *opts})
+	return s, nil
+}
+
+// captureStreamer implements the csharg.CaptureStreamer interface for
+// scripted capture streams.
+type captureStreamer struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	stats    func() csharg.CaptureStats
+
+	target *api.Target
+	events func(csharg.LifecycleEvent) // lifecycle events, if asked for.
+
+	mu  sync.Mutex
+	err error // why the capture failed, if it failed.
+}
+
+// emit a lifecycle event of the specified kind, if asked for.
+func (cs *captureStreamer) emit(kind csharg.EventKind, err error) {
+	if cs.events == nil {
+		return
+	}
+	cs.events(csharg.LifecycleEvent{
+		Kind:   kind,
+		Target: cs.target,
+		Time:   time.Now(),
+		Err:    err,
+	})
+}
+
+// fail records why the capture failed, unless it already failed before.
+func (cs *captureStreamer) fail(err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.err == nil {
+		cs.err = err
+	}
+}
+
+// stream writes the scripted capture stream to the stream editor, or directly
+// to the writer for raw captures, until the script ends or the capture gets
+// stopped. Finally, stream calls the finish functions in reverse order,
+// before signalling that the capture has terminated. Along the way, stream
+// emits the connected, first packet, and closed lifecycle events.
+func (cs *captureStreamer) stream(w io.Writer, s *Stream, finish []func()) {
+	defer close(cs.done)
+	defer func() {
+		for idx := len(finish) - 1; idx >= 0; idx-- {
+			finish[idx]()
+		}
+		cs.emit(csharg.EventClosed, cs.Err())
+	}()
+	cs.emit(csharg.EventConnected, nil)
+	firstPacket := false
+	if s == nil {
+		<-cs.stop
+		return
+	}
+	for _, chunk := range s.Chunks {
+		if s.Interval > 0 {
+			select {
+			case <-time.After(s.Interval):
+			case <-cs.stop:
+				return
+			}
+		}
+		select {
+		case <-cs.stop:
+			return
+		default:
+		}
+		if _, err := w.Write(chunk); err != nil {
+			cs.fail(&csharg.CaptureError{Op: "write", Err: err})
+			return
+		}
+		if !firstPacket && cs.stats().Packets > 0 {
+			firstPacket = true
+			cs.emit(csharg.EventFirstPacket, nil)
+		}
+	}
+	if !s.End {
+		<-cs.stop
+	}
+}
+
+// Stop stops the capture and waits for it to terminate.
+func (cs *captureStreamer) Stop() {
+	cs.stopOnce.Do(func() { close(cs.stop) })
+	<-cs.done
+}
+
+// Wait waits for the capture to terminate, without initiating it.
+func (cs *captureStreamer) Wait() {
+	<-cs.done
+}
+
+// StopAfter waits the specified duration for the capture to terminate, and
+// terminates it after the duration if necessary.
+func (cs *captureStreamer) StopAfter(d time.Duration) {
+	select {
+	case <-cs.done:
+	case <-time.After(d):
+		cs.Stop()
+	}
+}
+
+// StopAfterContext waits for the capture to terminate and terminates it after
+// the specified duration or when the context is done, whichever comes first.
+// It reports whether the capture ended by itself.
+func (cs *captureStreamer) StopAfterContext(ctx context.Context, d time.Duration) (bool, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-cs.done:
+		return true, nil
+	case <-timer.C:
+		cs.Stop()
+		return false, nil
+	case <-ctx.Done():
+		cs.Stop()
+		return false, ctx.Err()
+	}
+}
+
+// Stats returns the live statistics of the scripted capture.
+func (cs *captureStreamer) Stats() csharg.CaptureStats {
+	return cs.stats()
+}
+
+// Err returns why the scripted capture failed, if it failed.
+func (cs *captureStreamer) Err() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.err
+}
+
+// WaitErr waits for the scripted capture to terminate and returns why it
+// failed, if it failed.
+func (cs *captureStreamer) WaitErr() error {
+	cs.Wait()
+	return cs.Err()
+}
+
+// StopErr stops the scripted capture and returns why it failed before, if it
+// failed.
+func (cs *captureStreamer) StopErr() error {
+	cs.Stop()
+	return cs.Err()
+}
@@ -0,0 +1,134 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fake SharkTank", func() {
+
+	foo := &api.Target{Name: "foo", Type: api.TypeDocker, NodeName: "node"}
+	pod := &api.Target{Name: "default/bar", Type: "pod", NodeName: "node"}
+
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	It("returns the configured targets", func() {
+		st := New(foo)
+		Expect(st.Targets()).To(ConsistOf(foo))
+		st.SetTargets(foo, pod)
+		Expect(st.Targets()).To(ConsistOf(foo, pod))
+		st.Clear()
+		Expect(st.Clears()).To(Equal(1))
+	})
+
+	It("streams scripted captures through the stream editor", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		var buff bytes.Buffer
+		cs, err := st.Capture(&buff, foo, &csharg.CaptureOptions{Filter: "tcp"})
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+
+		b, err := pcapng.NewReader(&buff).Next()
+		Expect(err).NotTo(HaveOccurred())
+		sh, err := b.SectionHeader()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sh.Comment()).To(ContainSubstring("foo"))
+
+		Expect(st.Captures()).To(HaveLen(1))
+		Expect(st.Captures()[0].Target).To(BeIdenticalTo(foo))
+		Expect(st.Captures()[0].Options.Filter).To(Equal("tcp"))
+	})
+
+	It("keeps captures running until stopped", func() {
+		st := New(foo)
+		st.SetStream("", &Stream{Chunks: pcapngtest.Chunk(stream, 13)})
+		cs, err := st.Capture(&bytes.Buffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cs.Wait()
+		}()
+		Consistently(done, 100*time.Millisecond).ShouldNot(BeClosed())
+		cs.StopAfter(10 * time.Millisecond)
+		Eventually(done).Should(BeClosed())
+		cs.Stop()
+	})
+
+	It("injects capture errors", func() {
+		st := New(foo)
+		boom := errors.New("boom")
+		st.SetCaptureError("foo", boom)
+		Expect(st.Capture(&bytes.Buffer{}, foo, nil)).Error().To(MatchError(boom))
+		Expect(st.Captures()).To(BeEmpty())
+	})
+
+	It("captures pods and containers by name", func() {
+		st := New(foo, pod)
+		cs, err := st.CapturePod(&bytes.Buffer{}, "bar", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		cs, err = st.CaptureContainer(&bytes.Buffer{}, "node", "foo", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		Expect(st.CaptureContainer(&bytes.Buffer{}, "other", "foo", nil)).Error().To(HaveOccurred())
+		Expect(st.Captures()).To(HaveLen(2))
+
+		st.SetTargets(&api.Target{Name: "baz", Type: api.TypeDocker, NodeName: "node", ContainerID: "4f1c0e2d9a7b"})
+		cs, err = st.CaptureContainer(&bytes.Buffer{}, "node", "4f1c", nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Stop()
+		Expect(st.Captures()[2].Target.Name).To(Equal("baz"))
+	})
+
+	It("records prepared captures only when started", func() {
+		st := New(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 13), End: true})
+		pc, err := st.Prepare(&bytes.Buffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Captures()).To(BeEmpty())
+		cs, err := pc.Start()
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(st.Captures()).To(HaveLen(1))
+		Expect(pc.Start()).Error().To(MatchError(csharg.ErrNotPrepared))
+
+		pc, err = st.Prepare(&bytes.Buffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		pc.Cancel()
+		Expect(pc.Start()).Error().To(MatchError(csharg.ErrNotPrepared))
+		Expect(st.Captures()).To(HaveLen(1))
+
+		st.SetCaptureError("foo", errors.New("boom"))
+		Expect(st.Prepare(&bytes.Buffer{}, foo, nil)).Error().To(MatchError("boom"))
+	})
+
+	It("stops active captures when closed", func() {
+		st := New(foo)
+		cs, err := st.Capture(&bytes.Buffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Close()).To(Succeed())
+		cs.Wait()
+		Expect(st.Closed()).To(BeTrue())
+		Expect(st.Close()).To(Succeed())
+		Expect(st.Capture(&bytes.Buffer{}, foo, nil)).Error().To(MatchError(csharg.ErrClosed))
+		Expect(st.Prepare(&bytes.Buffer{}, foo, nil)).Error().To(MatchError(csharg.ErrClosed))
+		Expect(st.Captures()).To(HaveLen(1))
+	})
+
+})
@@ -0,0 +1,110 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("context-aware SharkTanks", func() {
+
+	foo := dockerTarget("foo")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+	})
+
+	It("gives up discovering when the context is done", func() {
+		srv.SetDiscoveryDelay(5 * time.Second)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		targets, err := client.TargetsContext(ctx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(targets).To(BeEmpty())
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+
+		By("not caching the cancelled discovery")
+		srv.SetDiscoveryDelay(0)
+		targets, err = client.TargetsContext(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(ConsistOf(HaveField("Name", "foo")))
+	})
+
+	It("gives up capturing when the context is done while discovering", func() {
+		srv.SetDiscoveryDelay(5 * time.Second)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = client.CaptureContainerContext(ctx, &syncBuffer{}, "", "foo", nil)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(st.Captures()).To(BeEmpty())
+	})
+
+	DescribeTable("stops captures when the context is done",
+		func(transport csharg.CaptureTransport) {
+			srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+			srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+				CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+				Transport:           transport,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer client.Close()
+
+			By("refusing to capture when the context is already done")
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = client.CaptureContext(ctx, &syncBuffer{}, foo, nil)
+			Expect(err).To(MatchError(context.Canceled))
+
+			By("stopping a running capture")
+			var buff syncBuffer
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			cs, err := client.CaptureContext(ctx, &buff, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(buff.Bytes).ShouldNot(BeEmpty())
+			ended := make(chan struct{})
+			go func() {
+				cs.Wait()
+				close(ended)
+			}()
+			Consistently(ended, "200ms").ShouldNot(BeClosed())
+			cancel()
+			Eventually(ended, "5s").Should(BeClosed())
+
+			By("refusing to start a prepared capture after the context is done")
+			ctx, cancel = context.WithCancel(context.Background())
+			pc, err := client.PrepareContext(ctx, &syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			cancel()
+			_, err = pc.Start()
+			Expect(err).To(MatchError(context.Canceled))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+})
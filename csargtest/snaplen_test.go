@@ -0,0 +1,78 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("snap length", func() {
+
+	foo := dockerTarget("foo")
+	stream := pcapngtest.New(binary.LittleEndian).
+		SHB().
+		IDB(pcapng.LinkTypeEthernet).
+		EPB(0, 1, []byte("0123456789")).
+		EPB(0, 2, []byte("0123")).
+		Bytes()
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+	})
+
+	DescribeTable("passes the snap length to the capture service and truncates packets",
+		func(transport csharg.CaptureTransport) {
+			srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+			srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+				CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+				Transport:           transport,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(client.Close)
+
+			var buff syncBuffer
+			cs, err := client.Capture(&buff, foo, &csharg.CaptureOptions{SnapLen: 6})
+			Expect(err).NotTo(HaveOccurred())
+			cs.Wait()
+			Expect(st.Captures()).To(HaveLen(1))
+			Expect(st.Captures()[0].Options.SnapLen).To(Equal(6))
+			Expect(packetData(buff.Bytes())).To(Equal([][]byte{[]byte("012345"), []byte("0123")}))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("truncates packets of scripted captures", func() {
+		var buff syncBuffer
+		cs, err := st.Capture(&buff, foo, &csharg.CaptureOptions{SnapLen: 2})
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(packetData(buff.Bytes())).To(Equal([][]byte{[]byte("01"), []byte("01")}))
+	})
+
+	It("rejects invalid snap lengths", func() {
+		Expect((&csharg.CaptureOptions{SnapLen: -1}).Validate()).To(
+			MatchError("snaplen: invalid value -1, expecting 0-262144"))
+		Expect((&csharg.CaptureOptions{SnapLen: csharg.MaxSnapLen + 1}).Validate()).To(
+			MatchError("snaplen: invalid value 262145, expecting 0-262144"))
+		Expect((&csharg.CaptureOptions{SnapLen: 64, Raw: true}).Validate()).To(
+			MatchError("snaplen: cannot truncate raw capture streams"))
+	})
+
+})
@@ -0,0 +1,102 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture statistics", func() {
+
+	foo := dockerTarget("foo")
+	bar := dockerTarget("bar")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo, bar)
+	})
+
+	newClient := func(transport csharg.CaptureTransport) csharg.SharkTank {
+		srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+		srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+		client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+			CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+			Transport:           transport,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	DescribeTable("counts packets and octets while capturing",
+		func(transport csharg.CaptureTransport) {
+			client := newClient(transport)
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			before := time.Now()
+			cs, err := client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer cs.Stop()
+			Expect(cs.Stats().Started).To(BeTemporally(">=", before.Add(-time.Second)))
+			Eventually(func() uint64 { return cs.Stats().Octets }, "5s").Should(Equal(uint64(len(stream))))
+			stats := cs.Stats()
+			Expect(stats.Packets).To(Equal(uint64(3)))
+			Expect(stats.LastPacket).To(BeTemporally(">=", stats.Started))
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("has no last packet before the first packet", func() {
+		client := newClient(csharg.TransportWebsocket)
+		cs, err := client.Capture(&syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer cs.Stop()
+		Expect(cs.Stats().Packets).To(BeZero())
+		Expect(cs.Stats().LastPacket.IsZero()).To(BeTrue())
+	})
+
+	It("keeps the statistics after the capture ended", func() {
+		client := newClient(csharg.TransportWebsocket)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		cs, err := csharg.CaptureContext(context.Background(), client, &syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(cs.Stats().Packets).To(Equal(uint64(3)))
+		Expect(cs.Stats().Octets).To(Equal(uint64(len(stream))))
+	})
+
+	It("combines the statistics of multiple targets", func() {
+		client := newClient(csharg.TransportWebsocket)
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		st.SetStream("bar", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		cs, err := client.CaptureMany(&syncBuffer{}, []*api.Target{foo, bar}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(cs.Stats().Packets).To(Equal(uint64(6)))
+		Expect(cs.Stats().Octets).To(Equal(uint64(2 * len(stream))))
+	})
+
+	It("counts scripted captures", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+		cs, err := st.Capture(&syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		cs.Wait()
+		Expect(cs.Stats().Packets).To(Equal(uint64(3)))
+	})
+
+})
@@ -0,0 +1,78 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("stopping captures after a duration", func() {
+
+	foo := dockerTarget("foo")
+	stream := pcapngtest.Capture(binary.LittleEndian, 1, 2, 3)
+
+	var st *SharkTank
+	var srv *Server
+
+	BeforeEach(func() {
+		st, srv = serve(foo)
+	})
+
+	DescribeTable("reports how captures terminated",
+		func(transport csharg.CaptureTransport) {
+			srv.SetHTTPStreaming(transport == csharg.TransportHTTP2)
+			srv.SetGRPCStreaming(transport == csharg.TransportGRPC)
+			client, err := csharg.NewSharkTankOnHost(srv.URL, &csharg.SharkTankOnHostOptions{
+				CommonClientOptions: csharg.CommonClientOptions{Timeout: 5 * time.Second},
+				Transport:           transport,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("ending by itself")
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16), End: true})
+			cs, err := client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cs.StopAfterContext(context.Background(), 5*time.Second)).To(BeTrue())
+
+			By("getting stopped after the duration")
+			st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+			cs, err = client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cs.StopAfterContext(context.Background(), 100*time.Millisecond)).To(BeFalse())
+
+			By("getting stopped when the context is done")
+			cs, err = client.Capture(&syncBuffer{}, foo, nil)
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			ended, err := cs.StopAfterContext(ctx, time.Hour)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(ended).To(BeFalse())
+		},
+		Entry("websocket", csharg.TransportWebsocket),
+		Entry("HTTP/2", csharg.TransportHTTP2),
+		Entry("gRPC", csharg.TransportGRPC),
+	)
+
+	It("reports how context-driven captures terminated", func() {
+		st.SetStream("foo", &Stream{Chunks: pcapngtest.Chunk(stream, 16)})
+		cs, err := csharg.CaptureContext(context.Background(), st, &syncBuffer{}, foo, nil)
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		ended, err := cs.StopAfterContext(ctx, time.Hour)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(ended).To(BeFalse())
+	})
+
+})
@@ -0,0 +1,58 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("target cache", func() {
+
+	frontend1 := &api.Target{Name: "frontend-5c9d7f-x2k4q", Namespace: "shop", Type: api.TypePod}
+	frontend2 := &api.Target{Name: "frontend-5c9d7f-7tq9z", Namespace: "shop", Type: api.TypePod}
+	backend := &api.Target{Name: "backend-0", Namespace: "shop", Type: api.TypePod}
+	backendcanary := &api.Target{Name: "backend", Namespace: "shop", Type: api.TypePod}
+	other := &api.Target{Name: "frontend-6b8c4d-q8w2e", Namespace: "other", Type: api.TypePod}
+	container := &api.Target{Name: "frontend-container", Type: api.TypeDocker, NodeName: "node"}
+
+	It("matches pods by the start of their names", func() {
+		var cache csharg.TargetCache
+		cache.Set(api.Targets{frontend1, frontend2, backend, other, container})
+		Expect(cache.MatchPods("shop/frontend")).To(HaveExactElements(frontend2, frontend1))
+		Expect(cache.MatchPods("shop/frontend-5c9d7f-x")).To(HaveExactElements(frontend1))
+		Expect(cache.MatchPods("other/frontend")).To(HaveExactElements(other))
+		Expect(cache.MatchPods("frontend")).To(BeEmpty())
+		Expect(cache.MatchPods("shop/nothing")).To(BeEmpty())
+		Expect(cache.MatchPods("shop/")).To(BeEmpty())
+	})
+
+	It("prefers exact pod name matches", func() {
+		var cache csharg.TargetCache
+		cache.Set(api.Targets{backend, backendcanary})
+		Expect(cache.MatchPods("shop/backend")).To(HaveExactElements(backendcanary))
+		Expect(cache.MatchPods("shop/backend-")).To(HaveExactElements(backend))
+	})
+
+	It("matches capture targets by their truncated IDs", func() {
+		web := &api.Target{Name: "web", Type: api.TypeDocker, NodeName: "node", ContainerID: "4f1c0e2d9a7b"}
+		db := &api.Target{Name: "db", Type: api.TypeDocker, NodeName: "node", ContainerID: "4f2a"}
+		webtoo := &api.Target{Name: "web", Type: api.TypeDocker, NodeName: "other", ContainerID: "4f1c0e2d9a7b11"}
+		pod := &api.Target{Name: "pod", Namespace: "shop", Type: api.TypePod, NodeName: "node", SandboxID: "c0ffee"}
+		var cache csharg.TargetCache
+		cache.Set(api.Targets{web, db, webtoo, pod, container})
+		Expect(cache.MatchID("", "4f1c")).To(ConsistOf(web, webtoo))
+		Expect(cache.MatchID("node", "4f1c")).To(HaveExactElements(web))
+		Expect(cache.MatchID("", "4f1c0e2d9a7b")).To(HaveExactElements(web))
+		Expect(cache.MatchID("", "docker://4f2")).To(HaveExactElements(db))
+		Expect(cache.MatchID("", "c0f")).To(HaveExactElements(pod))
+		Expect(cache.MatchID("", "beef")).To(BeEmpty())
+		Expect(cache.MatchID("", "")).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,113 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csargtest
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/siemens/csharg"
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/filter"
+	"github.com/siemens/csharg/pcapng"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("capture options validation", func() {
+
+	foo := &api.Target{Name: "foo", Type: api.TypeDocker, NodeName: "node", NetworkInterfaces: []string{"eth0"}}
+
+	It("accepts valid options", func() {
+		Expect((*csharg.CaptureOptions)(nil).Validate()).To(Succeed())
+		Expect((&csharg.CaptureOptions{}).Validate()).To(Succeed())
+		Expect((&csharg.CaptureOptions{
+			Nifs:        csharg.Nifs{"eth0", "vxlan.calico", "veth1234567890a"},
+			Filter:      "tcp port 80",
+			MaxBuffer:   1 << 20,
+			Session:     csharg.SessionMetadata{Reason: "debugging"},
+			VLANs:       []uint16{1, 4094},
+			Decapsulate: []csharg.Encapsulation{csharg.EncapsulationVXLAN},
+		}).Validate()).To(Succeed())
+		Expect((&csharg.CaptureOptions{Nifs: csharg.Nifs{"all"}}).Validate()).To(Succeed())
+	})
+
+	It("reports all problems", func() {
+		err := (&csharg.CaptureOptions{
+			Nifs:        csharg.Nifs{"", "eth0", "eth0", "a/b", "far-too-long-name", "all"},
+			Filter:      " \t",
+			MaxBuffer:   -1,
+			Session:     csharg.SessionMetadata{Ticket: "INC\n42"},
+			VLANs:       []uint16{0, 10, 10},
+			Decapsulate: []csharg.Encapsulation{"mpls", "gre", "gre"},
+		}).Validate()
+		Expect(err).To(HaveOccurred())
+		Expect(strings.Split(err.Error(), "\n")).To(HaveExactElements(
+			"nifs[0]: network interface name must not be empty",
+			`nifs[2]: duplicate network interface "eth0"`,
+			`nifs[3]: network interface name "a/b" must not contain slashes or whitespace`,
+			`nifs[4]: network interface name "far-too-long-name" exceeds 15 characters`,
+			`nifs: "all" conflicts with individual network interfaces`,
+			"filter: must not be blank when set",
+			"maxbuffer: invalid negative value -1",
+			`invalid session ticket "INC\n42": must not contain control characters`,
+			"vlans[0]: invalid VLAN ID 0, expecting 1-4094",
+			"vlans[2]: duplicate VLAN ID 10",
+			`decapsulate[0]: invalid encapsulation "mpls", expecting vxlan,geneve,gre,ipip`,
+			`decapsulate[2]: duplicate encapsulation "gre"`,
+		))
+		Expect(errors.Unwrap(err)).To(BeNil()) // joined errors unwrap to many
+	})
+
+	It("rejects capture filter syntax errors", func() {
+		err := (&csharg.CaptureOptions{Filter: "tcp port"}).Validate()
+		Expect(err).To(MatchError(HavePrefix("filter: filter syntax error at position")))
+		var serr *filter.SyntaxError
+		Expect(errors.As(err, &serr)).To(BeTrue())
+	})
+
+	It("rejects names for raw capture streams", func() {
+		Expect((&csharg.CaptureOptions{Raw: true, Names: &pcapng.NameResolution{}}).Validate()).To(
+			MatchError("names: cannot be added to raw capture streams"))
+	})
+
+	It("rejects empty interface aliases and renaming raw capture streams", func() {
+		err := (&csharg.CaptureOptions{
+			Raw:              true,
+			InterfaceAliases: map[string]string{"veth1a2b3c": "", "eth0@if12": "eth0"},
+		}).Validate()
+		Expect(strings.Split(err.Error(), "\n")).To(HaveExactElements(
+			"interfacealiases: cannot rename interfaces of raw capture streams",
+			`interfacealiases: empty alias for network interface "veth1a2b3c"`,
+		))
+	})
+
+	It("rejects excluding loopback when capturing from it", func() {
+		Expect((&csharg.CaptureOptions{NoLoopback: true, Nifs: csharg.Nifs{"eth0"}}).Validate()).To(Succeed())
+		for _, nif := range []string{"lo", "all"} {
+			Expect((&csharg.CaptureOptions{NoLoopback: true, Nifs: csharg.Nifs{nif}}).Validate()).To(
+				MatchError("noloopback: conflicts with explicitly capturing from all or loopback network interfaces"))
+		}
+	})
+
+	It("validates before contacting the capture service", func() {
+		opts := &csharg.CaptureOptions{Filter: "tcp\n"}
+		// Nothing listens on port 1, so contacting the capture service would
+		// fail differently.
+		client, err := csharg.NewSharkTankOnHost("127.0.0.1:1", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Capture(&syncBuffer{}, foo, opts)).Error().To(
+			MatchError(ContainSubstring("filter: ")))
+		Expect(client.Prepare(&syncBuffer{}, foo, opts)).Error().To(
+			MatchError(ContainSubstring("filter: ")))
+
+		st := New(foo)
+		Expect(st.Capture(&syncBuffer{}, foo, opts)).Error().To(MatchError(ContainSubstring("filter: ")))
+		Expect(st.Prepare(&syncBuffer{}, foo, opts)).Error().To(MatchError(ContainSubstring("filter: ")))
+		Expect(st.Captures()).To(BeEmpty())
+	})
+
+})
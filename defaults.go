@@ -7,8 +7,8 @@ package csharg
 import "time"
 
 const (
-	// DefaultServiceTimeout specifies the time limit for completing discovery
-	// service calls and for establishing a stream connection to the capture
-	// service.
+	// DefaultServiceTimeout specifies the default time limit for completing
+	// discovery service calls and for establishing a stream connection to the
+	// capture service.
 	DefaultServiceTimeout = 30 * time.Second
 )
@@ -0,0 +1,106 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements tuning the network connections to the capture service, such as
+// for long-haul VPNs and dual-stack clusters.
+
+package csharg
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// IPFamily specifies the IP family to use when connecting to the capture
+// service.
+type IPFamily int
+
+// Supported IP families.
+const (
+	IPFamilyDual IPFamily = iota // IPv4 as well as IPv6 (default).
+	IPFamilyV4                   // IPv4 only.
+	IPFamilyV6                   // IPv6 only.
+)
+
+// ParseIPFamily parses an IP family, either “dual” (or empty), “ipv4” (or
+// “4”), or “ipv6” (or “6”).
+func ParseIPFamily(family string) (IPFamily, error) {
+	switch strings.ToLower(family) {
+	case "", "dual":
+		return IPFamilyDual, nil
+	case "4", "ipv4":
+		return IPFamilyV4, nil
+	case "6", "ipv6":
+		return IPFamilyV6, nil
+	}
+	return IPFamilyDual, fmt.Errorf("invalid IP family %q, expecting dual, ipv4, or ipv6", family)
+}
+
+// network returns the network to dial for the specified network, restricted to
+// the IP family.
+func (f IPFamily) network(network string) string {
+	if network != "tcp" {
+		return network
+	}
+	switch f {
+	case IPFamilyV4:
+		return "tcp4"
+	case IPFamilyV6:
+		return "tcp6"
+	}
+	return network
+}
+
+// DialerOptions tunes the network connections to the capture service, for
+// discovery as well as for capturing.
+type DialerOptions struct {
+	// Timeout optionally limits the time for establishing network
+	// connections, in contrast to the client timeouts limiting the time for
+	// complete discovery requests and capture handshakes.
+	Timeout time.Duration
+	// KeepAlive specifies the interval between TCP keep-alive probes; zero
+	// uses the system default, while negative values disable keep-alives.
+	// KeepAlive applies only when not using a custom dial function.
+	KeepAlive time.Duration
+	// IPFamily optionally restricts connections to either IPv4 or IPv6.
+	IPFamily IPFamily
+	// MaxConcurrentDials optionally bounds the number of connections being
+	// established at the same time; further dials wait for their turn, or
+	// until their context is done. This avoids bursts of connection attempts
+	// when starting large fan-out captures.
+	MaxConcurrentDials int
+}
+
+// DialContext returns a dial function applying the dialer options on top of
+// the specified dial function, or on top of a net.Dialer if nil.
+func (o DialerOptions) DialContext(dial DialContextFunc) DialContextFunc {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: o.Timeout, KeepAlive: o.KeepAlive}).DialContext
+	} else if o.Timeout > 0 {
+		custom := dial
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+			defer cancel()
+			return custom(ctx, network, addr)
+		}
+	}
+	if o.MaxConcurrentDials <= 0 {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(ctx, o.IPFamily.network(network), addr)
+		}
+	}
+	dials := make(chan struct{}, o.MaxConcurrentDials)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select {
+		case dials <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		defer func() { <-dials }()
+		return dial(ctx, o.IPFamily.network(network), addr)
+	}
+}
@@ -22,5 +22,21 @@ Please see struct CaptureOptions for details.
 Normally, packet capture streaming will go on until you stop it. See the
 examples for how to automatically stop a packet capture stream after a given
 amount of time.
+
+In order to start captures from multiple targets at the same instant, first
+prepare all captures using SharkTank.Prepare, which takes care of discovery and
+connecting to the capture service, and then start the prepared captures.
+
+A Broadcaster feeds a single capture to multiple consumers at once, such as a
+dashboard, a file and Wireshark, which can attach and detach any time.
+
+For captures limited in time, CaptureContext stops the capture when its context
+is done, such as when a deadline expires, and then finalizes the packet capture
+with the final statistics of its network interfaces, instead of leaving it cut
+off mid-stream.
+
+Services embedding a SharkTank shut down cleanly by closing it: Close stops all
+its active captures, cancels its prepared captures and discoveries, and
+releases its connections to the capture service.
 */
 package csharg
@@ -0,0 +1,118 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Encapsulation names a tunnel encapsulation the capture service can strip
+// from captured packets, so that the encapsulated inner packets get captured.
+type Encapsulation string
+
+// Tunnel encapsulations capture services can strip.
+const (
+	EncapsulationVXLAN  Encapsulation = "vxlan"
+	EncapsulationGeneve Encapsulation = "geneve"
+	EncapsulationGRE    Encapsulation = "gre"
+	EncapsulationIPIP   Encapsulation = "ipip"
+)
+
+// Encapsulations lists the tunnel encapsulations capture services can strip.
+var Encapsulations = []Encapsulation{
+	EncapsulationVXLAN, EncapsulationGeneve, EncapsulationGRE, EncapsulationIPIP,
+}
+
+// Valid VLAN IDs; 0 and 4095 are reserved.
+const (
+	MinVLAN = 1
+	MaxVLAN = 4094
+)
+
+// ParseVLANs parses a comma-separated list of VLAN IDs, such as “10,20”. An
+// empty list returns nil.
+func ParseVLANs(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var vlans []uint16
+	for _, field := range strings.Split(s, ",") {
+		vlan, err := strconv.ParseUint(strings.TrimSpace(field), 10, 16)
+		if err != nil || vlan < MinVLAN || vlan > MaxVLAN {
+			return nil, fmt.Errorf("invalid VLAN ID %q, expecting %d-%d", field, MinVLAN, MaxVLAN)
+		}
+		vlans = append(vlans, uint16(vlan))
+	}
+	return vlans, nil
+}
+
+// ParseEncapsulations parses a comma-separated list of tunnel encapsulations,
+// such as “vxlan,geneve”. An empty list returns nil.
+func ParseEncapsulations(s string) ([]Encapsulation, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var encaps []Encapsulation
+	for _, field := range strings.Split(s, ",") {
+		encap := Encapsulation(strings.ToLower(strings.TrimSpace(field)))
+		if !encap.valid() {
+			return nil, fmt.Errorf("invalid encapsulation %q, expecting %s", field, encapsulationList(Encapsulations))
+		}
+		encaps = append(encaps, encap)
+	}
+	return encaps, nil
+}
+
+// valid returns true if the capture service might strip this encapsulation.
+func (e Encapsulation) valid() bool {
+	for _, encap := range Encapsulations {
+		if e == encap {
+			return true
+		}
+	}
+	return false
+}
+
+// encapsulationList returns the comma-separated list of encapsulations.
+func encapsulationList(encaps []Encapsulation) string {
+	names := make([]string, 0, len(encaps))
+	for _, encap := range encaps {
+		names = append(names, string(encap))
+	}
+	return strings.Join(names, ",")
+}
+
+// vlanList returns the comma-separated list of VLAN IDs.
+func vlanList(vlans []uint16) string {
+	ids := make([]string, 0, len(vlans))
+	for _, vlan := range vlans {
+		ids = append(ids, strconv.FormatUint(uint64(vlan), 10))
+	}
+	return strings.Join(ids, ",")
+}
+
+// setEncapsulationHeader sets the VLAN and encapsulation request headers.
+func (opts *CaptureOptions) setEncapsulationHeader(header http.Header) {
+	if len(opts.VLANs) > 0 {
+		header.Set("Clustershark-Vlan", vlanList(opts.VLANs))
+	}
+	if len(opts.Decapsulate) > 0 {
+		header.Set("Clustershark-Decap", encapsulationList(opts.Decapsulate))
+	}
+}
+
+// setEncapsulationQuery sets the VLAN and encapsulation query parameters.
+func (opts *CaptureOptions) setEncapsulationQuery(values url.Values) {
+	if len(opts.VLANs) > 0 {
+		values.Set("vlan", vlanList(opts.VLANs))
+	}
+	if len(opts.Decapsulate) > 0 {
+		values.Set("decap", encapsulationList(opts.Decapsulate))
+	}
+}
@@ -0,0 +1,16 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import "github.com/siemens/csharg/filter"
+
+// ValidateFilter checks the specified pcap filter expression for syntax errors
+// without contacting any capture service, so that typos can be caught before
+// starting a capture. It returns nil for a valid or empty filter expression.
+// Please note that only the syntax gets checked, but not whether, for
+// instance, host names can be resolved.
+func ValidateFilter(expr string) error {
+	return filter.Validate(expr)
+}
@@ -0,0 +1,120 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter
+
+import "fmt"
+
+// Node is a node in the abstract syntax tree of a parsed filter expression.
+type Node interface {
+	fmt.Stringer
+	node()
+}
+
+// And is the logical conjunction of two filter sub-expressions.
+type And struct {
+	L, R Node
+}
+
+// Or is the logical disjunction of two filter sub-expressions.
+type Or struct {
+	L, R Node
+}
+
+// Not negates a filter sub-expression.
+type Not struct {
+	X Node
+}
+
+// Primitive is a pcap filter primitive in the form of "[proto] [dir] [kind]
+// id", such as "tcp src port 80", "host 10.0.0.1", or just "tcp". Some
+// primitives, such as "vlan" or "broadcast", have no or only an optional id.
+type Primitive struct {
+	Proto string // protocol qualifier, such as "ether", "ip", "tcp", et cetera.
+	Dir   string // direction qualifier, such as "src", "dst", "src or dst".
+	Kind  string // type qualifier, such as "host", "net", "port", "vlan", ...
+	ID    string // optional id, such as an address, port, or protocol number.
+	Mask  string // optional netmask in case of "net ID mask MASK".
+}
+
+// Relation compares two arithmetic expressions, such as in "tcp[13] & 2 !=
+// 0".
+type Relation struct {
+	Op   string // one of ">", "<", ">=", "<=", "=", "==", "!=".
+	L, R Arith
+}
+
+// Arith is an arithmetic expression used in relations.
+type Arith interface {
+	fmt.Stringer
+	arith()
+}
+
+// Num is a numeric constant.
+type Num struct {
+	V uint32
+}
+
+// Len is the length of the packet.
+type Len struct{}
+
+// Load accesses packet data relative to the beginning of the specified
+// protocol header, such as "tcp[13]" or "ip[2:2]".
+type Load struct {
+	Proto string
+	Off   Arith
+	Size  int // 1, 2, or 4 octets.
+}
+
+// BinOp is a binary arithmetic operation.
+type BinOp struct {
+	Op   string // one of "+", "-", "*", "/", "%", "&", "|", "^", "<<", ">>".
+	L, R Arith
+}
+
+func (*And) node()       {}
+func (*Or) node()        {}
+func (*Not) node()       {}
+func (*Primitive) node() {}
+func (*Relation) node()  {}
+
+func (*Num) arith()   {}
+func (*Len) arith()   {}
+func (*Load) arith()  {}
+func (*BinOp) arith() {}
+
+func (n *And) String() string { return fmt.Sprintf("(%s and %s)", n.L, n.R) }
+func (n *Or) String() string  { return fmt.Sprintf("(%s or %s)", n.L, n.R) }
+func (n *Not) String() string { return fmt.Sprintf("not %s", n.X) }
+
+func (n *Primitive) String() string {
+	s := ""
+	for _, part := range []string{n.Proto, n.Dir, n.Kind, n.ID} {
+		if part == "" {
+			continue
+		}
+		if s != "" {
+			s += " "
+		}
+		s += part
+	}
+	if n.Mask != "" {
+		s += " mask " + n.Mask
+	}
+	return s
+}
+
+func (n *Relation) String() string { return fmt.Sprintf("%s %s %s", n.L, n.Op, n.R) }
+
+func (a *Num) String() string { return fmt.Sprintf("%d", a.V) }
+func (a *Len) String() string { return "len" }
+
+func (a *Load) String() string {
+	if a.Size == 1 {
+		return fmt.Sprintf("%s[%s]", a.Proto, a.Off)
+	}
+	return fmt.Sprintf("%s[%s:%d]", a.Proto, a.Off, a.Size)
+}
+
+func (a *BinOp) String() string { return fmt.Sprintf("(%s %s %s)", a.L, a.Op, a.R) }
@@ -0,0 +1,1006 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/siemens/csharg/pcapng"
+	"golang.org/x/net/bpf"
+)
+
+// acceptSnapLen is the number of packet octets a compiled filter program
+// returns for accepted packets; this is the same value libpcap uses.
+const acceptSnapLen = 262144
+
+// maxScratch is the number of scratch memory slots of the BPF machine.
+const maxScratch = 16
+
+// Ether types and IP protocol numbers used by filter primitives.
+const (
+	etherTypeIPv4     = 0x0800
+	etherTypeARP      = 0x0806
+	etherTypeRARP     = 0x8035
+	etherTypeIPv6     = 0x86dd
+	etherTypeVLAN     = 0x8100
+	etherTypeQinQ     = 0x88a8
+	etherTypeQinQ9100 = 0x9100
+
+	protoICMP   = 1
+	protoIGMP   = 2
+	protoIGRP   = 9
+	protoTCP    = 6
+	protoUDP    = 17
+	protoESP    = 50
+	protoAH     = 51
+	protoICMPv6 = 58
+	protoPIM    = 103
+	protoVRRP   = 112
+	protoSCTP   = 132
+)
+
+// ipProtos maps the protocol qualifiers of IP-based protocols, as well as the
+// protocol names usable with "proto", to their IP protocol numbers.
+var ipProtos = map[string]uint32{
+	"icmp": protoICMP, "igmp": protoIGMP, "igrp": protoIGRP,
+	"tcp": protoTCP, "udp": protoUDP, "sctp": protoSCTP,
+	"esp": protoESP, "ah": protoAH, "icmp6": protoICMPv6,
+	"pim": protoPIM, "vrrp": protoVRRP, "carp": protoVRRP,
+}
+
+// etherProtos maps the protocol names usable with "ether proto" to their
+// Ether types.
+var etherProtos = map[string]uint32{
+	"ip": etherTypeIPv4, "ip6": etherTypeIPv6, "arp": etherTypeARP, "rarp": etherTypeRARP,
+}
+
+// CompileError describes why a syntactically correct filter expression cannot
+// be compiled, such as when it refers to host names that would need to be
+// resolved, or uses primitives not supported for the link type.
+type CompileError struct {
+	Msg string // error description.
+}
+
+// Error returns the textual description of a filter expression compile error.
+func (e *CompileError) Error() string {
+	return "filter compile error: " + e.Msg
+}
+
+// compileErrorf returns a new CompileError with a formatted description.
+func compileErrorf(format string, args ...interface{}) error {
+	return &CompileError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Compile parses the specified pcap filter expression and compiles it into a
+// classic BPF program for packets of the specified link type, such as
+// pcapng.LinkTypeEthernet. The program returns a non-zero value for matching
+// packets and zero otherwise. An empty expression compiles into a program
+// accepting all packets.
+//
+// In contrast to libpcap, Compile works offline: host and network names
+// aren't resolved, so only addresses are supported; port names are looked up
+// in the local services database, though.
+func Compile(expr string, linktype uint16) ([]bpf.Instruction, error) {
+	n, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return CompileNode(n, linktype)
+}
+
+// CompileNode compiles the abstract syntax tree of a parsed filter expression
+// into a classic BPF program for packets of the specified link type; see
+// Compile for details. A nil node compiles into a program accepting all
+// packets.
+func CompileNode(n Node, linktype uint16) ([]bpf.Instruction, error) {
+	switch linktype {
+	case pcapng.LinkTypeEthernet, pcapng.LinkTypeLinuxSLL, pcapng.LinkTypeLinuxSLL2,
+		pcapng.LinkTypeRaw, pcapng.LinkTypeIPv4, pcapng.LinkTypeIPv6:
+	default:
+		return nil, compileErrorf("unsupported link type %d", linktype)
+	}
+	if n == nil {
+		return []bpf.Instruction{bpf.RetConstant{Val: acceptSnapLen}}, nil
+	}
+	c := &compiler{linktype: linktype}
+	root, err := c.node(n)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{}
+	accept, reject := g.newLabel(), g.newLabel()
+	g.cond(root, accept, reject)
+	g.place(accept)
+	g.emit(bpf.RetConstant{Val: acceptSnapLen})
+	g.place(reject)
+	g.emit(bpf.RetConstant{Val: 0})
+	return g.program()
+}
+
+// cond is a boolean condition in the intermediate representation of a filter
+// expression, which gets generated into conditional jumps.
+type cond interface{}
+
+type (
+	condAnd   struct{ l, r cond }
+	condOr    struct{ l, r cond }
+	condNot   struct{ x cond }
+	condConst bool
+	// condTest loads a value into the accumulator and then tests it against
+	// a constant value or, if x is set, against the X register.
+	condTest struct {
+		load []bpf.Instruction
+		test bpf.JumpTest
+		val  uint32
+		x    bool
+	}
+)
+
+// and returns the conjunction of the specified conditions, folding constant
+// conditions.
+func and(cs ...cond) cond {
+	var res cond = condConst(true)
+	for _, c := range cs {
+		switch {
+		case res == condConst(false) || c == condConst(true):
+		case c == condConst(false) || res == condConst(true):
+			res = c
+		default:
+			res = &condAnd{l: res, r: c}
+		}
+	}
+	return res
+}
+
+// or returns the disjunction of the specified conditions, folding constant
+// conditions.
+func or(cs ...cond) cond {
+	var res cond = condConst(false)
+	for _, c := range cs {
+		switch {
+		case res == condConst(true) || c == condConst(false):
+		case c == condConst(true) || res == condConst(false):
+			res = c
+		default:
+			res = &condOr{l: res, r: c}
+		}
+	}
+	return res
+}
+
+// not returns the negation of the specified condition.
+func not(c cond) cond {
+	if b, ok := c.(condConst); ok {
+		return !b
+	}
+	return &condNot{x: c}
+}
+
+// load returns the instructions loading size octets at the absolute offset,
+// optionally masking the loaded value.
+func load(off uint32, size int, mask uint32) []bpf.Instruction {
+	insns := []bpf.Instruction{bpf.LoadAbsolute{Off: off, Size: size}}
+	if mask != 0 {
+		insns = append(insns, bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: mask})
+	}
+	return insns
+}
+
+// eq returns the condition that the size octets at the absolute offset equal
+// the value.
+func eq(off uint32, size int, val uint32) cond {
+	return &condTest{load: load(off, size, 0), test: bpf.JumpEqual, val: val}
+}
+
+// compiler lowers the abstract syntax tree of a filter expression into
+// conditions for a particular link type.
+type compiler struct {
+	linktype uint16
+	vlan     uint32 // additional link-layer header length after "vlan" primitives.
+	scratch  int    // scratch memory slots in use.
+}
+
+// linkHeader returns the offset of the Ether type, as well as the offset of
+// the network layer header. It returns false if the link layer has no Ether
+// type.
+func (c *compiler) linkHeader() (ethtype uint32, nh uint32, ok bool) {
+	switch c.linktype {
+	case pcapng.LinkTypeEthernet:
+		return 12 + c.vlan, 14 + c.vlan, true
+	case pcapng.LinkTypeLinuxSLL:
+		return 14, 16, true
+	case pcapng.LinkTypeLinuxSLL2:
+		return 0, 20, true
+	}
+	return 0, 0, false
+}
+
+// nh returns the offset of the network layer header.
+func (c *compiler) nh() uint32 {
+	_, nh, _ := c.linkHeader()
+	return nh
+}
+
+// network returns the condition that the network layer protocol has the
+// specified Ether type.
+func (c *compiler) network(ethtype uint32) cond {
+	if off, _, ok := c.linkHeader(); ok {
+		return eq(off, 2, ethtype)
+	}
+	// Raw IP packets without any link-layer header.
+	switch {
+	case c.linktype == pcapng.LinkTypeIPv4:
+		return condConst(ethtype == etherTypeIPv4)
+	case c.linktype == pcapng.LinkTypeIPv6:
+		return condConst(ethtype == etherTypeIPv6)
+	case ethtype == etherTypeIPv4:
+		return &condTest{load: load(0, 1, 0xf0), test: bpf.JumpEqual, val: 0x40}
+	case ethtype == etherTypeIPv6:
+		return &condTest{load: load(0, 1, 0xf0), test: bpf.JumpEqual, val: 0x60}
+	}
+	return condConst(false)
+}
+
+// ipProto returns the condition that the packet is an IPv4 and/or IPv6 packet
+// with the specified IP protocol number.
+func (c *compiler) ipProto(proto uint32, v4, v6 bool) cond {
+	var cs []cond
+	if v4 {
+		cs = append(cs, and(c.network(etherTypeIPv4), eq(c.nh()+9, 1, proto)))
+	}
+	if v6 {
+		cs = append(cs, and(c.network(etherTypeIPv6), eq(c.nh()+6, 1, proto)))
+	}
+	return or(cs...)
+}
+
+// notFragment returns the condition that an IPv4 packet is either not
+// fragmented or the first fragment, carrying the transport header.
+func (c *compiler) notFragment() cond {
+	return &condTest{load: load(c.nh()+6, 2, 0), test: bpf.JumpBitsNotSet, val: 0x1fff}
+}
+
+// node lowers a node of the abstract syntax tree.
+func (c *compiler) node(n Node) (cond, error) {
+	switch n := n.(type) {
+	case *And:
+		l, err := c.node(n.L)
+		if err != nil {
+			return nil, err
+		}
+		r, err := c.node(n.R)
+		if err != nil {
+			return nil, err
+		}
+		return and(l, r), nil
+	case *Or:
+		l, err := c.node(n.L)
+		if err != nil {
+			return nil, err
+		}
+		r, err := c.node(n.R)
+		if err != nil {
+			return nil, err
+		}
+		return or(l, r), nil
+	case *Not:
+		x, err := c.node(n.X)
+		if err != nil {
+			return nil, err
+		}
+		return not(x), nil
+	case *Primitive:
+		return c.primitive(n)
+	case *Relation:
+		return c.relation(n)
+	}
+	return nil, compileErrorf("unsupported expression %q", n.String())
+}
+
+// direction combines the source and destination conditions of a primitive
+// according to its direction qualifier.
+func direction(prim *Primitive, src, dst func() cond) cond {
+	switch prim.Dir {
+	case "src":
+		return src()
+	case "dst":
+		return dst()
+	case "src and dst", "dst and src":
+		return and(src(), dst())
+	}
+	return or(src(), dst())
+}
+
+// primitive lowers a filter primitive.
+func (c *compiler) primitive(prim *Primitive) (cond, error) {
+	switch prim.Kind {
+	case "":
+		if prim.Dir != "" {
+			return nil, compileErrorf("unsupported primitive %q", prim.String())
+		}
+		return c.protocol(prim)
+	case "host":
+		return c.host(prim)
+	case "net":
+		return c.net(prim)
+	case "port", "portrange":
+		return c.port(prim)
+	case "proto":
+		return c.proto(prim)
+	case "broadcast", "multicast":
+		return c.cast(prim)
+	case "vlan":
+		return c.vlanTag(prim)
+	}
+	return nil, compileErrorf("unsupported primitive %q", prim.String())
+}
+
+// protocol lowers a bare protocol primitive, such as "ip6" or "tcp".
+func (c *compiler) protocol(prim *Primitive) (cond, error) {
+	switch prim.Proto {
+	case "ip":
+		return c.network(etherTypeIPv4), nil
+	case "ip6":
+		return c.network(etherTypeIPv6), nil
+	case "arp":
+		return c.network(etherTypeARP), nil
+	case "rarp":
+		return c.network(etherTypeRARP), nil
+	case "icmp", "igmp", "igrp", "vrrp", "carp":
+		return c.ipProto(ipProtos[prim.Proto], true, false), nil
+	case "icmp6":
+		return c.ipProto(protoICMPv6, false, true), nil
+	}
+	if proto, ok := ipProtos[prim.Proto]; ok {
+		return c.ipProto(proto, true, true), nil
+	}
+	return nil, compileErrorf("unsupported protocol %q", prim.Proto)
+}
+
+// host lowers a host primitive, such as "src host 10.0.0.1" or "ether host
+// 00:11:22:33:44:55".
+func (c *compiler) host(prim *Primitive) (cond, error) {
+	switch prim.Proto {
+	case "ether", "link":
+		if c.linktype != pcapng.LinkTypeEthernet {
+			return nil, compileErrorf("%q not supported on link type %d", prim.String(), c.linktype)
+		}
+		mac, err := parseMAC(prim.ID)
+		if err != nil {
+			return nil, err
+		}
+		match := func(off uint32) func() cond {
+			return func() cond {
+				return and(eq(off, 4, binary.BigEndian.Uint32(mac[0:4])),
+					eq(off+4, 2, uint32(binary.BigEndian.Uint16(mac[4:6]))))
+			}
+		}
+		return direction(prim, match(6), match(0)), nil
+	case "", "ip", "ip6", "arp", "rarp":
+	default:
+		return nil, compileErrorf("unsupported primitive %q", prim.String())
+	}
+	ip := net.ParseIP(prim.ID)
+	if ip == nil {
+		return nil, compileErrorf("cannot resolve host name %q offline", prim.ID)
+	}
+	nh := c.nh()
+	if ip4 := ip.To4(); ip4 != nil {
+		if prim.Proto == "ip6" {
+			return nil, compileErrorf("IPv4 address in %q", prim.String())
+		}
+		addr := binary.BigEndian.Uint32(ip4)
+		return c.ipv4(prim, func(off uint32) cond { return eq(off, 4, addr) }), nil
+	}
+	if prim.Proto != "" && prim.Proto != "ip6" {
+		return nil, compileErrorf("IPv6 address in %q", prim.String())
+	}
+	return and(c.network(etherTypeIPv6), direction(prim,
+		func() cond { return match128(nh+8, ip, nil) },
+		func() cond { return match128(nh+24, ip, nil) })), nil
+}
+
+// ipv4 returns the condition that an IPv4, ARP, or RARP packet matches the
+// address test in the direction of the primitive, limited to the protocol
+// qualifier of the primitive, if any.
+func (c *compiler) ipv4(prim *Primitive, test func(off uint32) cond) cond {
+	nh := c.nh()
+	var cs []cond
+	for _, n := range []struct {
+		proto    string
+		ethtype  uint32
+		src, dst uint32
+	}{
+		{"ip", etherTypeIPv4, 12, 16},
+		{"arp", etherTypeARP, 14, 24},
+		{"rarp", etherTypeRARP, 14, 24},
+	} {
+		if prim.Proto != "" && prim.Proto != n.proto {
+			continue
+		}
+		cs = append(cs, and(c.network(n.ethtype), direction(prim,
+			func() cond { return test(nh + n.src) },
+			func() cond { return test(nh + n.dst) })))
+	}
+	return or(cs...)
+}
+
+// match128 returns the condition that the 128 bit address at the absolute
+// offset matches the address in the bits set in the mask, if any.
+func match128(off uint32, addr net.IP, mask net.IPMask) cond {
+	var cs []cond
+	for word := 0; word < 4; word++ {
+		a := binary.BigEndian.Uint32(addr[word*4:])
+		m := uint32(0xffffffff)
+		if mask != nil {
+			m = binary.BigEndian.Uint32(mask[word*4:])
+		}
+		switch m {
+		case 0:
+			continue
+		case 0xffffffff:
+			cs = append(cs, eq(off+uint32(word*4), 4, a))
+		default:
+			cs = append(cs, &condTest{load: load(off+uint32(word*4), 4, m), test: bpf.JumpEqual, val: a & m})
+		}
+	}
+	return and(cs...)
+}
+
+// net lowers a network primitive, such as "net 10.0.0.0/8" or "net 192.168
+// mask 255.255.0.0".
+func (c *compiler) net(prim *Primitive) (cond, error) {
+	switch prim.Proto {
+	case "", "ip", "ip6", "arp", "rarp":
+	default:
+		return nil, compileErrorf("unsupported primitive %q", prim.String())
+	}
+	ipnet, err := parseNet(prim.ID, prim.Mask)
+	if err != nil {
+		return nil, err
+	}
+	nh := c.nh()
+	if ip4 := ipnet.IP.To4(); ip4 != nil {
+		if prim.Proto == "ip6" {
+			return nil, compileErrorf("IPv4 network in %q", prim.String())
+		}
+		addr := binary.BigEndian.Uint32(ip4)
+		mask := binary.BigEndian.Uint32(ipnet.Mask[len(ipnet.Mask)-4:])
+		return c.ipv4(prim, func(off uint32) cond {
+			return &condTest{load: load(off, 4, mask), test: bpf.JumpEqual, val: addr}
+		}), nil
+	}
+	if prim.Proto != "" && prim.Proto != "ip6" {
+		return nil, compileErrorf("IPv6 network in %q", prim.String())
+	}
+	return and(c.network(etherTypeIPv6), direction(prim,
+		func() cond { return match128(nh+8, ipnet.IP, ipnet.Mask) },
+		func() cond { return match128(nh+24, ipnet.IP, ipnet.Mask) })), nil
+}
+
+// port lowers a port or port range primitive, such as "tcp dst port 80" or
+// "portrange 1-1024".
+func (c *compiler) port(prim *Primitive) (cond, error) {
+	var protos []string
+	switch prim.Proto {
+	case "tcp", "udp", "sctp":
+		protos = []string{prim.Proto}
+	case "", "ip", "ip6":
+		protos = []string{"tcp", "udp", "sctp"}
+	default:
+		return nil, compileErrorf("unsupported primitive %q", prim.String())
+	}
+	lo, hi := prim.ID, prim.ID
+	if prim.Kind == "portrange" {
+		lo, hi, _ = strings.Cut(prim.ID, "-")
+	}
+	lport, err := lookupPort(protos[0], lo)
+	if err != nil {
+		return nil, err
+	}
+	hport, err := lookupPort(protos[0], hi)
+	if err != nil {
+		return nil, err
+	}
+	if lport > hport {
+		lport, hport = hport, lport
+	}
+	nh := c.nh()
+	// ports returns the port condition for transport headers loaded by the
+	// specified instructions, given the port offset inside the transport
+	// header.
+	ports := func(hdr func(off uint32) []bpf.Instruction) cond {
+		test := func(off uint32) func() cond {
+			return func() cond {
+				if lport == hport {
+					return &condTest{load: hdr(off), test: bpf.JumpEqual, val: lport}
+				}
+				return and(
+					&condTest{load: hdr(off), test: bpf.JumpGreaterOrEqual, val: lport},
+					&condTest{load: hdr(off), test: bpf.JumpLessOrEqual, val: hport})
+			}
+		}
+		return direction(prim, test(0), test(2))
+	}
+	var cs []cond
+	if prim.Proto != "ip6" {
+		// The IPv4 header has a variable length, so the transport header
+		// needs to be accessed relative to the header length in X.
+		m := ports(func(off uint32) []bpf.Instruction {
+			return []bpf.Instruction{
+				bpf.LoadMemShift{Off: nh},
+				bpf.LoadIndirect{Off: nh + off, Size: 2},
+			}
+		})
+		var p []cond
+		for _, proto := range protos {
+			p = append(p, eq(nh+9, 1, ipProtos[proto]))
+		}
+		cs = append(cs, and(c.network(etherTypeIPv4), or(p...), c.notFragment(), m))
+	}
+	if prim.Proto != "ip" {
+		m := ports(func(off uint32) []bpf.Instruction {
+			return load(nh+40+off, 2, 0)
+		})
+		var p []cond
+		for _, proto := range protos {
+			p = append(p, eq(nh+6, 1, ipProtos[proto]))
+		}
+		cs = append(cs, and(c.network(etherTypeIPv6), or(p...), m))
+	}
+	return or(cs...), nil
+}
+
+// proto lowers a protocol number primitive, such as "ip proto 6" or "ether
+// proto \arp".
+func (c *compiler) proto(prim *Primitive) (cond, error) {
+	name := strings.TrimPrefix(prim.ID, "\\")
+	if prim.Proto == "ether" {
+		ethtype, ok := parseNumber(name)
+		if !ok {
+			if ethtype, ok = etherProtos[name]; !ok {
+				return nil, compileErrorf("unknown Ether type %q", prim.ID)
+			}
+		}
+		return c.network(ethtype), nil
+	}
+	proto, ok := parseNumber(name)
+	if !ok {
+		if proto, ok = ipProtos[name]; !ok {
+			return nil, compileErrorf("unknown IP protocol %q", prim.ID)
+		}
+	}
+	switch prim.Proto {
+	case "":
+		return c.ipProto(proto, true, true), nil
+	case "ip":
+		return c.ipProto(proto, true, false), nil
+	case "ip6":
+		return c.ipProto(proto, false, true), nil
+	}
+	return nil, compileErrorf("unsupported primitive %q", prim.String())
+}
+
+// cast lowers the broadcast and multicast primitives.
+func (c *compiler) cast(prim *Primitive) (cond, error) {
+	switch prim.Proto {
+	case "", "ether", "link":
+		if c.linktype != pcapng.LinkTypeEthernet {
+			return nil, compileErrorf("%q not supported on link type %d", prim.String(), c.linktype)
+		}
+		if prim.Kind == "broadcast" {
+			return and(eq(0, 4, 0xffffffff), eq(4, 2, 0xffff)), nil
+		}
+		return &condTest{load: load(0, 1, 0), test: bpf.JumpBitsSet, val: 0x01}, nil
+	case "ip":
+		if prim.Kind == "multicast" {
+			return and(c.network(etherTypeIPv4),
+				&condTest{load: load(c.nh()+16, 1, 0), test: bpf.JumpGreaterOrEqual, val: 224}), nil
+		}
+	case "ip6":
+		if prim.Kind == "multicast" {
+			return and(c.network(etherTypeIPv6), eq(c.nh()+24, 1, 0xff)), nil
+		}
+	}
+	return nil, compileErrorf("unsupported primitive %q", prim.String())
+}
+
+// vlanTag lowers a "vlan [id]" primitive. As with libpcap, it shifts the
+// offsets of all subsequent primitives by the length of the VLAN tag.
+func (c *compiler) vlanTag(prim *Primitive) (cond, error) {
+	if c.linktype != pcapng.LinkTypeEthernet {
+		return nil, compileErrorf("%q not supported on link type %d", prim.String(), c.linktype)
+	}
+	off, _, _ := c.linkHeader()
+	m := or(eq(off, 2, etherTypeVLAN), eq(off, 2, etherTypeQinQ), eq(off, 2, etherTypeQinQ9100))
+	if prim.ID != "" {
+		id, _ := parseNumber(prim.ID)
+		if id > 4095 {
+			return nil, compileErrorf("VLAN ID %d out of range", id)
+		}
+		m = and(m, &condTest{load: load(off+2, 2, 0x0fff), test: bpf.JumpEqual, val: id})
+	}
+	c.vlan += 4
+	return m, nil
+}
+
+// relops maps relational operators to jump tests.
+var relops = map[string]bpf.JumpTest{
+	">": bpf.JumpGreaterThan, "<": bpf.JumpLessThan,
+	">=": bpf.JumpGreaterOrEqual, "<=": bpf.JumpLessOrEqual,
+	"=": bpf.JumpEqual, "==": bpf.JumpEqual, "!=": bpf.JumpNotEqual,
+}
+
+// aluops maps arithmetic operators to ALU operations.
+var aluops = map[string]bpf.ALUOp{
+	"+": bpf.ALUOpAdd, "-": bpf.ALUOpSub, "*": bpf.ALUOpMul, "/": bpf.ALUOpDiv,
+	"%": bpf.ALUOpMod, "&": bpf.ALUOpAnd, "|": bpf.ALUOpOr, "^": bpf.ALUOpXor,
+	"<<": bpf.ALUOpShiftLeft, ">>": bpf.ALUOpShiftRight,
+}
+
+// relation lowers a relation between arithmetic expressions, such as
+// "tcp[13] & 2 != 0". Packet data accessors additionally require the packet to
+// be of the accessed protocol.
+func (c *compiler) relation(rel *Relation) (cond, error) {
+	guards := map[string]cond{}
+	l, err := c.arith(rel.L, guards)
+	if err != nil {
+		return nil, err
+	}
+	test := &condTest{test: relops[rel.Op]}
+	if num, ok := rel.R.(*Num); ok {
+		test.load, test.val = l, num.V
+	} else {
+		slot, err := c.alloc()
+		if err != nil {
+			return nil, err
+		}
+		r, err := c.arith(rel.R, guards)
+		c.scratch--
+		if err != nil {
+			return nil, err
+		}
+		test.load = append(append(append(l,
+			bpf.StoreScratch{Src: bpf.RegA, N: slot}),
+			r...),
+			bpf.TAX{}, bpf.LoadScratch{Dst: bpf.RegA, N: slot})
+		test.x = true
+	}
+	var cs []cond
+	for _, proto := range sortedKeys(guards) {
+		cs = append(cs, guards[proto])
+	}
+	return and(append(cs, test)...), nil
+}
+
+// sortedKeys returns the keys of the guards in a stable order.
+func sortedKeys(guards map[string]cond) []string {
+	keys := make([]string, 0, len(guards))
+	for key := range guards {
+		keys = append(keys, key)
+	}
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	return keys
+}
+
+// alloc allocates a scratch memory slot.
+func (c *compiler) alloc() (int, error) {
+	if c.scratch >= maxScratch {
+		return 0, compileErrorf("arithmetic expression too complex")
+	}
+	c.scratch++
+	return c.scratch - 1, nil
+}
+
+// arith returns the instructions computing an arithmetic expression into the
+// accumulator, adding the protocol guards of packet data accessors.
+func (c *compiler) arith(a Arith, guards map[string]cond) ([]bpf.Instruction, error) {
+	switch a := a.(type) {
+	case *Num:
+		return []bpf.Instruction{bpf.LoadConstant{Dst: bpf.RegA, Val: a.V}}, nil
+	case *Len:
+		return []bpf.Instruction{bpf.LoadExtension{Num: bpf.ExtLen}}, nil
+	case *BinOp:
+		l, err := c.arith(a.L, guards)
+		if err != nil {
+			return nil, err
+		}
+		op := aluops[a.Op]
+		if num, ok := a.R.(*Num); ok {
+			if num.V == 0 && (op == bpf.ALUOpDiv || op == bpf.ALUOpMod) {
+				return nil, compileErrorf("division by zero in %q", a.String())
+			}
+			return append(l, bpf.ALUOpConstant{Op: op, Val: num.V}), nil
+		}
+		slot, err := c.alloc()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { c.scratch-- }()
+		r, err := c.arith(a.R, guards)
+		if err != nil {
+			return nil, err
+		}
+		return append(append(append(l,
+			bpf.StoreScratch{Src: bpf.RegA, N: slot}),
+			r...),
+			bpf.TAX{}, bpf.LoadScratch{Dst: bpf.RegA, N: slot}, bpf.ALUOpX{Op: op}), nil
+	case *Load:
+		return c.load(a, guards)
+	}
+	return nil, compileErrorf("unsupported arithmetic expression %q", a.String())
+}
+
+// load returns the instructions loading packet data relative to the
+// beginning of a protocol header into the accumulator.
+func (c *compiler) load(a *Load, guards map[string]cond) ([]bpf.Instruction, error) {
+	nh := c.nh()
+	var base uint32
+	ihl := false // offset relative to the variable-length IPv4 header?
+	switch a.Proto {
+	case "ether", "link":
+	case "ip":
+		guards[a.Proto], base = c.network(etherTypeIPv4), nh
+	case "ip6":
+		guards[a.Proto], base = c.network(etherTypeIPv6), nh
+	case "arp":
+		guards[a.Proto], base = c.network(etherTypeARP), nh
+	case "rarp":
+		guards[a.Proto], base = c.network(etherTypeRARP), nh
+	case "icmp6":
+		guards[a.Proto], base = c.ipProto(protoICMPv6, false, true), nh+40
+	default:
+		proto, ok := ipProtos[a.Proto]
+		if !ok {
+			return nil, compileErrorf("unsupported packet data accessor %q", a.String())
+		}
+		guards[a.Proto] = and(c.ipProto(proto, true, false), c.notFragment())
+		base, ihl = nh, true
+	}
+	if num, ok := a.Off.(*Num); ok {
+		if ihl {
+			return []bpf.Instruction{
+				bpf.LoadMemShift{Off: nh},
+				bpf.LoadIndirect{Off: base + num.V, Size: a.Size},
+			}, nil
+		}
+		return load(base+num.V, a.Size, 0), nil
+	}
+	off, err := c.arith(a.Off, guards)
+	if err != nil {
+		return nil, err
+	}
+	if !ihl {
+		return append(off, bpf.TAX{}, bpf.LoadIndirect{Off: base, Size: a.Size}), nil
+	}
+	slot, err := c.alloc()
+	if err != nil {
+		return nil, err
+	}
+	c.scratch--
+	return append(off,
+		bpf.StoreScratch{Src: bpf.RegA, N: slot},
+		bpf.LoadMemShift{Off: nh},
+		bpf.LoadScratch{Dst: bpf.RegA, N: slot},
+		bpf.ALUOpX{Op: bpf.ALUOpAdd},
+		bpf.TAX{},
+		bpf.LoadIndirect{Off: base, Size: a.Size}), nil
+}
+
+// parseMAC parses a MAC address in the notations pcap accepts.
+func parseMAC(s string) ([]byte, error) {
+	var groups []string
+	switch {
+	case strings.ContainsAny(s, ":-") || strings.Count(s, ".") == 5:
+		groups = strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == '-' || r == '.' })
+	case strings.Count(s, ".") == 2:
+		for _, g := range strings.Split(s, ".") {
+			if len(g) != 4 {
+				return nil, compileErrorf("invalid MAC address %q", s)
+			}
+			groups = append(groups, g[:2], g[2:])
+		}
+	case len(s) == 12:
+		for i := 0; i < 12; i += 2 {
+			groups = append(groups, s[i:i+2])
+		}
+	}
+	if len(groups) != 6 {
+		return nil, compileErrorf("cannot resolve MAC host name %q offline", s)
+	}
+	mac := make([]byte, 6)
+	for i, g := range groups {
+		v, err := strconv.ParseUint(g, 16, 8)
+		if err != nil {
+			return nil, compileErrorf("invalid MAC address %q", s)
+		}
+		mac[i] = byte(v)
+	}
+	return mac, nil
+}
+
+// parseNet parses an IPv4 or IPv6 network, given either as a prefix, as a
+// network number with a netmask, or as a (partial) IPv4 network number with an
+// implicit netmask, such as "192.168".
+func parseNet(id string, mask string) (*net.IPNet, error) {
+	if addr, bits, ok := strings.Cut(id, "/"); ok {
+		if !strings.Contains(addr, ":") {
+			octets := strings.Split(addr, ".")
+			for len(octets) < 4 {
+				octets = append(octets, "0")
+			}
+			id = strings.Join(octets, ".") + "/" + bits
+		}
+		_, n, err := net.ParseCIDR(id)
+		if err != nil {
+			return nil, compileErrorf("invalid network %q", id)
+		}
+		if ip, _, _ := net.ParseCIDR(id); !ip.Equal(n.IP) {
+			return nil, compileErrorf("non-network bits set in %q", id)
+		}
+		return n, nil
+	}
+	if strings.Contains(id, ":") {
+		ip := net.ParseIP(id)
+		if ip == nil {
+			return nil, compileErrorf("invalid network %q", id)
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	octets := strings.Split(id, ".")
+	ip := net.ParseIP(strings.Join(append(octets, "0", "0", "0")[:4], ".")).To4()
+	if ip == nil || len(octets) > 4 {
+		return nil, compileErrorf("cannot resolve network name %q offline", id)
+	}
+	ipnet := &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(octets), 32)}
+	if mask != "" {
+		m := net.ParseIP(mask).To4()
+		if m == nil {
+			return nil, compileErrorf("invalid netmask %q", mask)
+		}
+		ipnet.Mask = net.IPMask(m)
+	}
+	if !ipnet.IP.Equal(ipnet.IP.Mask(ipnet.Mask)) {
+		return nil, compileErrorf("non-network bits set in %q", id)
+	}
+	return ipnet, nil
+}
+
+// lookupPort returns the number of the specified port, looking up port
+// (service) names in the local services database.
+func lookupPort(proto string, port string) (uint32, error) {
+	if v, ok := parseNumber(port); ok {
+		return v, nil
+	}
+	if proto == "sctp" {
+		proto = "tcp"
+	}
+	v, err := net.LookupPort(proto, port)
+	if err != nil {
+		return 0, compileErrorf("unknown port %q", port)
+	}
+	return uint32(v), nil
+}
+
+// generator generates the instructions of a BPF program from conditions,
+// with conditional jumps first referring to labels that get resolved into
+// relative jump offsets at the end.
+type generator struct {
+	insns  []bpf.Instruction
+	fixups []fixup
+	labels []int // instruction indices of labels.
+}
+
+// fixup is a jump instruction still referring to its true and false labels.
+type fixup struct {
+	at   int // index of the jump instruction.
+	t, f int // labels to jump to.
+}
+
+// newLabel returns a new and yet unplaced label.
+func (g *generator) newLabel() int {
+	g.labels = append(g.labels, -1)
+	return len(g.labels) - 1
+}
+
+// place the label at the next instruction.
+func (g *generator) place(label int) {
+	g.labels[label] = len(g.insns)
+}
+
+// emit instructions.
+func (g *generator) emit(insns ...bpf.Instruction) {
+	g.insns = append(g.insns, insns...)
+}
+
+// jump emits a jump instruction, with its true and false labels getting
+// resolved later. For unconditional jumps the false label is ignored.
+func (g *generator) jump(insn bpf.Instruction, t, f int) {
+	g.fixups = append(g.fixups, fixup{at: len(g.insns), t: t, f: f})
+	g.emit(insn)
+}
+
+// cond generates the instructions for a condition, jumping to label t if the
+// condition is true, and to label f otherwise.
+func (g *generator) cond(c cond, t, f int) {
+	switch c := c.(type) {
+	case condConst:
+		if c {
+			g.jump(bpf.Jump{}, t, t)
+		} else {
+			g.jump(bpf.Jump{}, f, f)
+		}
+	case *condAnd:
+		mid := g.newLabel()
+		g.cond(c.l, mid, f)
+		g.place(mid)
+		g.cond(c.r, t, f)
+	case *condOr:
+		mid := g.newLabel()
+		g.cond(c.l, t, mid)
+		g.place(mid)
+		g.cond(c.r, t, f)
+	case *condNot:
+		g.cond(c.x, f, t)
+	case *condTest:
+		g.emit(c.load...)
+		if c.x {
+			g.jump(bpf.JumpIfX{Cond: c.test}, t, f)
+		} else {
+			g.jump(bpf.JumpIf{Cond: c.test, Val: c.val}, t, f)
+		}
+	}
+}
+
+// program resolves the jump labels into relative jump offsets and returns the
+// final program.
+func (g *generator) program() ([]bpf.Instruction, error) {
+	for _, fix := range g.fixups {
+		skipTrue := g.labels[fix.t] - fix.at - 1
+		skipFalse := g.labels[fix.f] - fix.at - 1
+		if insn, ok := g.insns[fix.at].(bpf.Jump); ok {
+			insn.Skip = uint32(skipTrue)
+			g.insns[fix.at] = insn
+			continue
+		}
+		if skipTrue > 255 || skipFalse > 255 {
+			return nil, compileErrorf("filter expression too complex")
+		}
+		switch insn := g.insns[fix.at].(type) {
+		case bpf.JumpIf:
+			insn.Cond, insn.SkipTrue, insn.SkipFalse = native(insn.Cond, skipTrue, skipFalse)
+			g.insns[fix.at] = insn
+		case bpf.JumpIfX:
+			insn.Cond, insn.SkipTrue, insn.SkipFalse = native(insn.Cond, skipTrue, skipFalse)
+			g.insns[fix.at] = insn
+		}
+	}
+	return g.insns, nil
+}
+
+// native returns the jump test and offsets using only the jump tests that
+// classic BPF natively supports, by inverting the other jump tests and
+// swapping their offsets.
+func native(test bpf.JumpTest, skipTrue, skipFalse int) (bpf.JumpTest, uint8, uint8) {
+	switch test {
+	case bpf.JumpNotEqual:
+		return bpf.JumpEqual, uint8(skipFalse), uint8(skipTrue)
+	case bpf.JumpLessThan:
+		return bpf.JumpGreaterOrEqual, uint8(skipFalse), uint8(skipTrue)
+	case bpf.JumpLessOrEqual:
+		return bpf.JumpGreaterThan, uint8(skipFalse), uint8(skipTrue)
+	case bpf.JumpBitsNotSet:
+		return bpf.JumpBitsSet, uint8(skipFalse), uint8(skipTrue)
+	}
+	return test, uint8(skipTrue), uint8(skipFalse)
+}
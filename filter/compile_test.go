@@ -0,0 +1,211 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter_test
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/siemens/csharg/filter"
+	"github.com/siemens/csharg/pcapng"
+	"golang.org/x/net/bpf"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// ether returns an Ethernet frame with the specified Ether type and payload,
+// optionally VLAN-tagged.
+func ether(dst string, ethtype uint16, vlan uint16, payload []byte) []byte {
+	mac, _ := net.ParseMAC(dst)
+	frame := append(append([]byte{}, mac...), 0x02, 0, 0, 0, 0, 0x01)
+	if vlan != 0 {
+		frame = binary.BigEndian.AppendUint16(frame, 0x8100)
+		frame = binary.BigEndian.AppendUint16(frame, vlan)
+	}
+	frame = binary.BigEndian.AppendUint16(frame, ethtype)
+	return append(frame, payload...)
+}
+
+// ipv4 returns an IPv4 packet with options, so that the header length is
+// different from 20 octets.
+func ipv4(proto uint8, src, dst string, fragoff uint16, payload []byte) []byte {
+	hdr := make([]byte, 24)
+	hdr[0] = 0x46
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(24+len(payload)))
+	binary.BigEndian.PutUint16(hdr[6:8], fragoff)
+	hdr[8] = 64
+	hdr[9] = proto
+	copy(hdr[12:16], net.ParseIP(src).To4())
+	copy(hdr[16:20], net.ParseIP(dst).To4())
+	return append(hdr, payload...)
+}
+
+// ipv6 returns an IPv6 packet.
+func ipv6(next uint8, src, dst string, payload []byte) []byte {
+	hdr := make([]byte, 40)
+	hdr[0] = 0x60
+	binary.BigEndian.PutUint16(hdr[4:6], uint16(len(payload)))
+	hdr[6] = next
+	hdr[7] = 64
+	copy(hdr[8:24], net.ParseIP(src))
+	copy(hdr[24:40], net.ParseIP(dst))
+	return append(hdr, payload...)
+}
+
+// transport returns a TCP or UDP header with the specified ports and TCP
+// flags.
+func transport(sport, dport uint16, flags uint8) []byte {
+	hdr := make([]byte, 20)
+	binary.BigEndian.PutUint16(hdr[0:2], sport)
+	binary.BigEndian.PutUint16(hdr[2:4], dport)
+	hdr[12] = 5 << 4
+	hdr[13] = flags
+	return hdr
+}
+
+// arp returns an ARP request.
+func arp(spa, tpa string) []byte {
+	pkt := make([]byte, 28)
+	binary.BigEndian.PutUint16(pkt[0:2], 1)
+	binary.BigEndian.PutUint16(pkt[2:4], 0x0800)
+	pkt[4], pkt[5] = 6, 4
+	binary.BigEndian.PutUint16(pkt[6:8], 1)
+	copy(pkt[14:18], net.ParseIP(spa).To4())
+	copy(pkt[24:28], net.ParseIP(tpa).To4())
+	return pkt
+}
+
+var (
+	syn   = ipv4(6, "10.0.0.1", "192.168.1.2", 0, transport(12345, 80, 0x02))
+	frag  = ipv4(6, "10.0.0.1", "192.168.1.2", 100, transport(12345, 80, 0x02))
+	dns6  = ipv6(17, "fe80::1", "2001:db8::53", transport(5353, 53, 0))
+	who   = arp("10.0.0.1", "10.0.0.254")
+	bcast = "ff:ff:ff:ff:ff:ff"
+	host  = "00:11:22:33:44:55"
+)
+
+var _ = Describe("compiling pcap filter expressions", func() {
+
+	DescribeTable("matches Ethernet frames",
+		func(expr string, frame []byte, expected bool) {
+			insns, err := filter.Compile(expr, pcapng.LinkTypeEthernet)
+			Expect(err).NotTo(HaveOccurred())
+			vm, err := bpf.NewVM(insns)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vm.Run(frame)).To(Equal(map[bool]int{true: 262144, false: 0}[expected]))
+		},
+		Entry(nil, "", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "ip", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "ip6", ether(host, 0x0800, 0, syn), false),
+		Entry(nil, "tcp", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "udp", ether(host, 0x86dd, 0, dns6), true),
+		Entry(nil, "tcp port 80", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "tcp port http", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "udp port 80", ether(host, 0x0800, 0, syn), false),
+		Entry(nil, "src port 80", ether(host, 0x0800, 0, syn), false),
+		Entry(nil, "tcp port 80", ether(host, 0x0800, 0, frag), false),
+		Entry(nil, "portrange 50-60", ether(host, 0x86dd, 0, dns6), true),
+		Entry(nil, "ip6 and dst port 53", ether(host, 0x86dd, 0, dns6), true),
+		Entry(nil, "host 10.0.0.1", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "dst host 10.0.0.1", ether(host, 0x0800, 0, syn), false),
+		Entry(nil, "host 10.0.0.254", ether(bcast, 0x0806, 0, who), true),
+		Entry(nil, "ip host 10.0.0.254", ether(bcast, 0x0806, 0, who), false),
+		Entry(nil, "src host fe80::1", ether(host, 0x86dd, 0, dns6), true),
+		Entry(nil, "host fe80::2", ether(host, 0x86dd, 0, dns6), false),
+		Entry(nil, "net 192.168.0.0/16", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "src net 192.168", ether(host, 0x0800, 0, syn), false),
+		Entry(nil, "net 10.0.0.0 mask 255.0.0.0", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "dst net 2001:db8::/32", ether(host, 0x86dd, 0, dns6), true),
+		Entry(nil, "ip proto 6", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "ip6 proto \\udp", ether(host, 0x86dd, 0, dns6), true),
+		Entry(nil, "ether proto \\arp", ether(bcast, 0x0806, 0, who), true),
+		Entry(nil, "broadcast", ether(bcast, 0x0806, 0, who), true),
+		Entry(nil, "ether dst host 00:11:22:33:44:55", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "ether src 02:00:00:00:00:01", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "vlan 42 and tcp port 80", ether(host, 0x0800, 42, syn), true),
+		Entry(nil, "vlan 43 and tcp port 80", ether(host, 0x0800, 42, syn), false),
+		Entry(nil, "tcp port 80", ether(host, 0x0800, 42, syn), false),
+		Entry(nil, "tcp[tcpflags] & tcp-syn != 0", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "tcp[tcpflags] & (tcp-syn|tcp-ack) = tcp-syn|tcp-ack", ether(host, 0x0800, 0, syn), false),
+		Entry(nil, "ip[2:2] = len - 14", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "ip[9] + 1 = 7 and ip[0] & 0xf = 6", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "tcp[len - 14 - 24 - 2 : 2] = tcp[2:2]", ether(host, 0x0800, 0, syn), false),
+		Entry(nil, "greater 50 and less 100", ether(host, 0x0800, 0, syn), true),
+		Entry(nil, "not (tcp or arp)", ether(bcast, 0x0806, 0, who), false),
+		Entry(nil, "icmp or udp or (tcp and port 80)", ether(host, 0x0800, 0, syn), true),
+	)
+
+	DescribeTable("matches packets of other link types",
+		func(expr string, linktype uint16, data []byte, expected bool) {
+			m, err := filter.NewMatcher(expr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Match(linktype, data)).To(Equal(expected))
+		},
+		Entry(nil, "tcp dst port 80", pcapng.LinkTypeRaw, syn, true),
+		Entry(nil, "ip6", pcapng.LinkTypeRaw, syn, false),
+		Entry(nil, "udp port 53", pcapng.LinkTypeIPv6, dns6, true),
+		Entry(nil, "ip", pcapng.LinkTypeIPv6, dns6, false),
+		Entry(nil, "host 192.168.1.2", pcapng.LinkTypeLinuxSLL,
+			append([]byte{0, 0, 0, 1, 0, 6, 2, 0, 0, 0, 0, 1, 0, 0, 0x08, 0x00}, syn...), true),
+		Entry(nil, "ip6", pcapng.LinkTypeLinuxSLL2,
+			append([]byte{0x86, 0xdd, 0, 0, 0, 0, 0, 2, 0, 1, 0, 6, 2, 0, 0, 0, 0, 1, 0, 0}, dns6...), true),
+	)
+
+	It("matches with truncated packets", func() {
+		m, err := filter.NewMatcher("tcp port 80")
+		Expect(err).NotTo(HaveOccurred())
+		frame := ether(host, 0x0800, 0, syn)
+		Expect(m.Match(pcapng.LinkTypeEthernet, frame[:40])).To(BeFalse())
+	})
+
+	It("accepts all packets with an empty expression", func() {
+		m, err := filter.NewMatcher(" ")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Match(pcapng.LinkTypeEthernet, nil)).To(BeTrue())
+	})
+
+	It("generates native jumps", func() {
+		insns, err := filter.Compile("ip and not arp", pcapng.LinkTypeEthernet)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(insns).To(HaveExactElements(
+			bpf.LoadAbsolute{Off: 12, Size: 2},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipFalse: 3},
+			bpf.LoadAbsolute{Off: 12, Size: 2},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0806, SkipTrue: 1},
+			bpf.RetConstant{Val: 262144},
+			bpf.RetConstant{Val: 0},
+		))
+		_, err = bpf.Assemble(insns)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("rejects expressions it cannot compile",
+		func(expr string, linktype uint16, msg string) {
+			_, err := filter.Compile(expr, linktype)
+			Expect(err).To(HaveOccurred())
+			Expect(err).To(BeAssignableToTypeOf(&filter.CompileError{}))
+			Expect(err.Error()).To(ContainSubstring(msg))
+		},
+		Entry(nil, "host example.com", pcapng.LinkTypeEthernet, "cannot resolve host name"),
+		Entry(nil, "net 10.0.0.1/8", pcapng.LinkTypeEthernet, "non-network bits"),
+		Entry(nil, "ip6 host 10.0.0.1", pcapng.LinkTypeEthernet, "IPv4 address"),
+		Entry(nil, "ip host fe80::1", pcapng.LinkTypeEthernet, "IPv6 address"),
+		Entry(nil, "tcp port no-such-service", pcapng.LinkTypeEthernet, "unknown port"),
+		Entry(nil, "ether broadcast", pcapng.LinkTypeRaw, "not supported on link type"),
+		Entry(nil, "vlan", pcapng.LinkTypeLinuxSLL, "not supported on link type"),
+		Entry(nil, "gateway router", pcapng.LinkTypeEthernet, "unsupported primitive"),
+		Entry(nil, "tcp[0] / 0 = 1", pcapng.LinkTypeEthernet, "division by zero"),
+		Entry(nil, "ip", pcapng.LinkTypeNull, "unsupported link type"),
+	)
+
+	It("returns syntax errors", func() {
+		_, err := filter.Compile("tcp prot 80", pcapng.LinkTypeEthernet)
+		Expect(err).To(BeAssignableToTypeOf(&filter.SyntaxError{}))
+		_, err = filter.NewMatcher("tcp prot 80")
+		Expect(err).To(BeAssignableToTypeOf(&filter.SyntaxError{}))
+	})
+
+})
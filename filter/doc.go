@@ -0,0 +1,11 @@
+/*
+Package filter parses pcap filter expressions offline, without the need for
+libpcap. This allows catching typos in capture filter expressions before
+contacting the capture service and starting a capture. For the pcap filter
+syntax, please see: https://www.tcpdump.org/manpages/pcap-filter.7.html
+
+Additionally, filter compiles filter expressions into classic BPF programs in
+pure Go, and matches packets against them using [Matcher], so that packets can
+be filtered on the client side without cgo and libpcap.
+*/
+package filter
@@ -0,0 +1,123 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind identifies the kind of a lexical token in a filter expression.
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokWord             // names, numbers, addresses, et cetera.
+	tokOp               // arithmetic, relational and logical operators.
+	tokLParen           // (
+	tokRParen           // )
+	tokLBrack           // [
+	tokRBrack           // ]
+	tokColon            // : (only inside brackets)
+)
+
+// token is a single lexical token of a filter expression, together with its
+// (byte) position inside the expression for error reporting.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators lists the (multi-character first) operators we recognize.
+var operators = []string{
+	"&&", "||", "<<", ">>", "<=", ">=", "==", "!=",
+	"&", "|", "^", "+", "-", "*", "/", "%", "<", ">", "=", "!",
+}
+
+// lex splits a filter expression into its tokens. As pcap filter expressions
+// allow IPv6 addresses, MAC addresses, and network prefixes as single "words",
+// colons, slashes and dashes are part of words unless they appear inside
+// brackets (packet data accessors), or on their own.
+func lex(expr string) ([]token, error) {
+	tokens := []token{}
+	brackets := 0
+	pos := 0
+	for pos < len(expr) {
+		ch := expr[pos]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			pos++
+			continue
+		case ch == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: pos})
+			pos++
+			continue
+		case ch == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: pos})
+			pos++
+			continue
+		case ch == '[':
+			brackets++
+			tokens = append(tokens, token{kind: tokLBrack, text: "[", pos: pos})
+			pos++
+			continue
+		case ch == ']':
+			if brackets > 0 {
+				brackets--
+			}
+			tokens = append(tokens, token{kind: tokRBrack, text: "]", pos: pos})
+			pos++
+			continue
+		case ch == ':' && brackets > 0:
+			tokens = append(tokens, token{kind: tokColon, text: ":", pos: pos})
+			pos++
+			continue
+		}
+		if isWordChar(ch, brackets > 0) {
+			start := pos
+			for pos < len(expr) && isWordChar(expr[pos], brackets > 0) {
+				pos++
+			}
+			word := expr[start:pos]
+			// A lone dash or slash is an arithmetic operator and not a word.
+			if word == "-" || word == "/" {
+				tokens = append(tokens, token{kind: tokOp, text: word, pos: start})
+				continue
+			}
+			tokens = append(tokens, token{kind: tokWord, text: word, pos: start})
+			continue
+		}
+		op := ""
+		for _, o := range operators {
+			if strings.HasPrefix(expr[pos:], o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("unexpected character %q", ch)}
+		}
+		tokens = append(tokens, token{kind: tokOp, text: op, pos: pos})
+		pos += len(op)
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(expr)})
+	return tokens, nil
+}
+
+// isWordChar returns true if the character ch can be part of a word. Inside
+// brackets the set of word characters is restricted so that offset
+// expressions such as "tcp[len-4:2]" get correctly split.
+func isWordChar(ch byte, inBrackets bool) bool {
+	switch {
+	case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		return true
+	case ch == '_' || ch == '.' || ch == '\\':
+		return true
+	case ch == ':' || ch == '-' || ch == '/':
+		return !inBrackets
+	}
+	return false
+}
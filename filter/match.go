@@ -0,0 +1,63 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter
+
+import (
+	"sync"
+
+	"golang.org/x/net/bpf"
+)
+
+// Matcher matches packets against a filter expression on the client side,
+// without libpcap. As the packets of a pcapng stream might come from
+// interfaces with different link types, Matcher compiles the filter
+// expression on demand for each link type it encounters.
+type Matcher struct {
+	root Node
+
+	mu  sync.Mutex
+	vms map[uint16]matcherVM
+}
+
+// matcherVM is the compiled filter program for a particular link type, or the
+// reason why the filter expression cannot be compiled for it.
+type matcherVM struct {
+	vm  *bpf.VM
+	err error
+}
+
+// NewMatcher returns a new Matcher for the specified pcap filter expression,
+// or an error if the expression is syntactically incorrect. An empty
+// expression matches all packets.
+func NewMatcher(expr string) (*Matcher, error) {
+	n, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{root: n, vms: map[uint16]matcherVM{}}, nil
+}
+
+// Match returns true if the packet data of the specified link type matches the
+// filter expression. It returns an error if the filter expression cannot be
+// compiled for the link type. As the packet data might have been truncated
+// when captured, “len” in filter expressions refers to the captured length.
+func (m *Matcher) Match(linktype uint16, data []byte) (bool, error) {
+	m.mu.Lock()
+	mvm, ok := m.vms[linktype]
+	if !ok {
+		var insns []bpf.Instruction
+		insns, mvm.err = CompileNode(m.root, linktype)
+		if mvm.err == nil {
+			mvm.vm, mvm.err = bpf.NewVM(insns)
+		}
+		m.vms[linktype] = mvm
+	}
+	m.mu.Unlock()
+	if mvm.err != nil {
+		return false, mvm.err
+	}
+	n, err := mvm.vm.Run(data)
+	return n > 0, err
+}
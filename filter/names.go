@@ -0,0 +1,251 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// protos lists the protocol qualifiers.
+var protos = map[string]bool{
+	"ether": true, "fddi": true, "tr": true, "wlan": true, "link": true,
+	"ppp": true, "slip": true, "radio": true,
+	"ip": true, "ip6": true, "arp": true, "rarp": true,
+	"tcp": true, "udp": true, "sctp": true,
+	"icmp": true, "icmp6": true, "igmp": true, "igrp": true, "pim": true,
+	"ah": true, "esp": true, "vrrp": true, "carp": true,
+	"decnet": true, "lat": true, "sca": true, "moprc": true, "mopdl": true,
+	"iso": true, "esis": true, "isis": true, "clnp": true,
+	"stp": true, "ipx": true, "netbeui": true, "atalk": true, "aarp": true,
+}
+
+// loadProtos lists the protocols allowed in packet data accessors, such as
+// "tcp[13]".
+var loadProtos = map[string]bool{
+	"ether": true, "fddi": true, "tr": true, "wlan": true, "link": true,
+	"ppp": true, "slip": true, "radio": true,
+	"ip": true, "ip6": true, "arp": true, "rarp": true,
+	"tcp": true, "udp": true, "sctp": true,
+	"icmp": true, "icmp6": true, "igmp": true, "igrp": true, "pim": true,
+	"vrrp": true, "carp": true,
+}
+
+// kinds lists the type qualifiers, as well as some further primitives that
+// syntactically behave like type qualifiers.
+var kinds = map[string]bool{
+	"host": true, "net": true, "port": true, "portrange": true, "gateway": true,
+	"proto": true, "protochain": true,
+	"broadcast": true, "multicast": true,
+	"vlan": true, "mpls": true, "pppoed": true, "pppoes": true, "geneve": true,
+}
+
+// idKinds lists the type qualifiers with a mandatory id, which bare ids can
+// inherit from their preceding primitive.
+var idKinds = map[string]bool{
+	"host": true, "net": true, "port": true, "portrange": true, "gateway": true,
+	"proto": true, "protochain": true,
+}
+
+// keywords cannot be used as ids.
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true,
+	"src": true, "dst": true, "mask": true, "len": true,
+	"less": true, "greater": true, "inbound": true, "outbound": true,
+}
+
+// namedConstants maps the named constants that pcap filter expressions can use
+// in arithmetic expressions to their values.
+var namedConstants = map[string]uint32{
+	"tcpflags": 13,
+	"tcp-fin":  0x01, "tcp-syn": 0x02, "tcp-rst": 0x04, "tcp-push": 0x08,
+	"tcp-ack": 0x10, "tcp-urg": 0x20, "tcp-ece": 0x40, "tcp-cwr": 0x80,
+	"icmptype": 0, "icmpcode": 1,
+	"icmp-echoreply": 0, "icmp-unreach": 3, "icmp-sourcequench": 4,
+	"icmp-redirect": 5, "icmp-echo": 8, "icmp-routeradvert": 9,
+	"icmp-routersolicit": 10, "icmp-timxceed": 11, "icmp-paramprob": 12,
+	"icmp-tstamp": 13, "icmp-tstampreply": 14, "icmp-ireq": 15,
+	"icmp-ireqreply": 16, "icmp-maskreq": 17, "icmp-maskreply": 18,
+	"icmp6type": 0, "icmp6code": 1,
+	"icmp6-destinationunreach": 1, "icmp6-packettoobig": 2,
+	"icmp6-timeexceeded": 3, "icmp6-parameterproblem": 4,
+	"icmp6-echo": 128, "icmp6-echoreply": 129,
+	"icmp6-multicastlistenerquery": 130, "icmp6-multicastlistenerreportv1": 131,
+	"icmp6-multicastlistenerdone": 132, "icmp6-routersolicit": 133,
+	"icmp6-routeradvert": 134, "icmp6-neighborsolicit": 135,
+	"icmp6-neighboradvert": 136, "icmp6-redirect": 137,
+}
+
+var (
+	// hostnameRe matches (DNS) host names.
+	hostnameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*\.?$`)
+	// servicenameRe matches (port) service names, such as "http" or
+	// "ftp-data".
+	servicenameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+	// protonameRe matches (escaped) protocol names, such as "\tcp".
+	protonameRe = regexp.MustCompile(`^\\?[A-Za-z][A-Za-z0-9-]*$`)
+	// macRe matches MAC addresses in the various notations pcap accepts.
+	macRe = regexp.MustCompile(`^([0-9A-Fa-f]{1,2}([:.-][0-9A-Fa-f]{1,2}){5}|[0-9A-Fa-f]{4}\.[0-9A-Fa-f]{4}\.[0-9A-Fa-f]{4}|[0-9A-Fa-f]{12})$`)
+	// partialIPv4Re matches IPv4 network numbers with fewer than four octets,
+	// such as "10" or "192.168".
+	partialIPv4Re = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){0,3}$`)
+)
+
+// linkProtos are the protocols using link-layer (MAC) host addresses.
+var linkProtos = map[string]bool{
+	"ether": true, "fddi": true, "tr": true, "wlan": true, "link": true,
+}
+
+// checkPrimitive checks the qualifiers and id of a primitive for consistency
+// and validity.
+func checkPrimitive(prim *Primitive) error {
+	switch prim.Kind {
+	case "host":
+		if linkProtos[prim.Proto] {
+			if !macRe.MatchString(prim.ID) && !hostnameRe.MatchString(prim.ID) {
+				return fmt.Errorf("invalid MAC address %q", prim.ID)
+			}
+			return nil
+		}
+		switch prim.Proto {
+		case "", "ip", "ip6", "arp", "rarp", "decnet":
+		default:
+			return fmt.Errorf("\"%s host\" is not a valid qualifier combination", prim.Proto)
+		}
+		return checkHost(prim.ID)
+	case "gateway":
+		if !hostnameRe.MatchString(prim.ID) {
+			return fmt.Errorf("invalid gateway host name %q", prim.ID)
+		}
+	case "net":
+		switch prim.Proto {
+		case "", "ip", "ip6", "arp", "rarp", "decnet":
+		default:
+			return fmt.Errorf("\"%s net\" is not a valid qualifier combination", prim.Proto)
+		}
+		return checkNet(prim.ID, prim.Mask)
+	case "port", "portrange":
+		switch prim.Proto {
+		case "", "tcp", "udp", "sctp", "ip", "ip6":
+		default:
+			return fmt.Errorf("\"%s %s\" is not a valid qualifier combination", prim.Proto, prim.Kind)
+		}
+		if prim.Kind == "port" {
+			return checkPort(prim.ID)
+		}
+		lo, hi, ok := strings.Cut(prim.ID, "-")
+		if !ok {
+			return fmt.Errorf("invalid port range %q, expected PORT1-PORT2", prim.ID)
+		}
+		if err := checkPort(lo); err != nil {
+			return err
+		}
+		return checkPort(hi)
+	case "proto", "protochain":
+		if v, ok := parseNumber(prim.ID); ok {
+			if v > 255 && prim.Proto != "ether" {
+				return fmt.Errorf("protocol number %d out of range", v)
+			}
+			if v > 0xffff {
+				return fmt.Errorf("protocol number %d out of range", v)
+			}
+			return nil
+		}
+		if !protonameRe.MatchString(prim.ID) {
+			return fmt.Errorf("invalid protocol name %q", prim.ID)
+		}
+	}
+	return nil
+}
+
+// checkHost checks for a valid IPv4 or IPv6 address, or DNS host name.
+func checkHost(id string) error {
+	if net.ParseIP(id) != nil {
+		return nil
+	}
+	if partialIPv4Re.MatchString(id) {
+		return fmt.Errorf("invalid IPv4 address %q", id)
+	}
+	if strings.Contains(id, ":") {
+		return fmt.Errorf("invalid IPv6 address %q", id)
+	}
+	if !hostnameRe.MatchString(id) {
+		return fmt.Errorf("invalid host name %q", id)
+	}
+	return nil
+}
+
+// checkNet checks for a valid network number, prefix, or network number with
+// netmask.
+func checkNet(id string, mask string) error {
+	if strings.Contains(id, "/") {
+		if mask != "" {
+			return errors.New("network prefix cannot be combined with mask")
+		}
+		addr, bits, _ := strings.Cut(id, "/")
+		if partialIPv4Re.MatchString(addr) && !strings.Contains(addr, ":") {
+			if n, ok := parseNumber(bits); !ok || n > 32 {
+				return fmt.Errorf("invalid IPv4 network prefix length in %q", id)
+			}
+			return checkOctets(addr)
+		}
+		if _, _, err := net.ParseCIDR(id); err != nil {
+			return fmt.Errorf("invalid network prefix %q", id)
+		}
+		return nil
+	}
+	if strings.Contains(id, ":") {
+		if net.ParseIP(id) == nil {
+			return fmt.Errorf("invalid IPv6 network %q", id)
+		}
+		if mask != "" {
+			return errors.New("IPv6 network cannot be combined with mask")
+		}
+		return nil
+	}
+	if !partialIPv4Re.MatchString(id) {
+		if mask == "" && hostnameRe.MatchString(id) {
+			// network names from /etc/networks.
+			return nil
+		}
+		return fmt.Errorf("invalid network %q", id)
+	}
+	if err := checkOctets(id); err != nil {
+		return err
+	}
+	if mask != "" {
+		if ip := net.ParseIP(mask); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid netmask %q", mask)
+		}
+	}
+	return nil
+}
+
+// checkOctets checks that all octets of a (partial) IPv4 address are in range.
+func checkOctets(addr string) error {
+	for _, octet := range strings.Split(addr, ".") {
+		if v, ok := parseNumber(octet); !ok || v > 255 {
+			return fmt.Errorf("invalid IPv4 network %q", addr)
+		}
+	}
+	return nil
+}
+
+// checkPort checks for a valid port number or service name.
+func checkPort(id string) error {
+	if v, ok := parseNumber(id); ok {
+		if v > 65535 {
+			return fmt.Errorf("port number %d out of range", v)
+		}
+		return nil
+	}
+	if !servicenameRe.MatchString(id) {
+		return fmt.Errorf("invalid port %q", id)
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SyntaxError describes a syntax error in a filter expression, together with
+// the (byte) position inside the expression where the error was detected.
+type SyntaxError struct {
+	Pos int    // position of offending token.
+	Msg string // error description.
+}
+
+// Error returns the textual description of a filter expression syntax error.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter syntax error at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// Parse parses the specified pcap filter expression and returns its abstract
+// syntax tree. An empty expression (that is, only whitespace, if any) results
+// in a nil Node and no error, as an empty filter expression means "capture
+// everything".
+func Parse(expr string) (Node, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return n, nil
+}
+
+// Validate checks the specified pcap filter expression for syntax errors,
+// returning nil if the expression is syntactically correct. An empty
+// expression is considered to be valid.
+func Validate(expr string) error {
+	_, err := Parse(expr)
+	return err
+}
+
+// parser is a recursive-descent pcap filter expression parser.
+type parser struct {
+	tokens []token
+	pos    int
+	// most recently parsed primitive, so that "port 80 or 443" can inherit the
+	// qualifiers of "port 80" for the bare "443".
+	last *Primitive
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	if tok.kind == tokEOF {
+		return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf(format, args...) + " (at end of expression)"}
+	}
+	return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// isWord returns true if the token is the specified word.
+func isWord(tok token, words ...string) bool {
+	if tok.kind != tokWord {
+		return false
+	}
+	for _, w := range words {
+		if tok.text == w {
+			return true
+		}
+	}
+	return false
+}
+
+// isOp returns true if the token is one of the specified operators.
+func isOp(tok token, ops ...string) bool {
+	if tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isWord(p.peek(), "or") || isOp(p.peek(), "||") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &Or{L: l, R: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for isWord(p.peek(), "and") || isOp(p.peek(), "&&") {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &And{L: l, R: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.peek()
+	switch {
+	case isWord(tok, "not") || isOp(tok, "!"):
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+	case tok.kind == tokLParen:
+		// This might either be a parenthesized boolean expression or the
+		// beginning of an arithmetic expression in a relation. We first try
+		// the boolean interpretation and backtrack if it turns out to be
+		// arithmetic after all.
+		start := p.pos
+		last := p.last
+		p.next()
+		x, err := p.parseOr()
+		if err == nil && p.peek().kind == tokRParen {
+			p.next()
+			if p.peek().kind != tokOp || isOp(p.peek(), "&&", "||", "!") {
+				return x, nil
+			}
+		}
+		p.pos = start
+		p.last = last
+		return p.parseRelation()
+	case tok.kind == tokWord:
+		if p.startsArith() {
+			return p.parseRelation()
+		}
+		return p.parsePrimitive()
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// startsArith returns true if the current token starts an arithmetic
+// expression, as opposed to a filter primitive.
+func (p *parser) startsArith() bool {
+	tok := p.peek()
+	if _, ok := parseNumber(tok.text); ok {
+		// A bare number might also be a port or alike for which the
+		// qualifiers are inherited from the preceding primitive, as in "port
+		// 80 or 8080"; only treat it as an arithmetic expression if it is
+		// followed by an operator.
+		return p.peekAt(1).kind == tokOp && !isOp(p.peekAt(1), "&&", "||", "!")
+	}
+	if tok.text == "len" {
+		return true
+	}
+	if _, ok := namedConstants[tok.text]; ok {
+		return true
+	}
+	return loadProtos[tok.text] && p.peekAt(1).kind == tokLBrack
+}
+
+// parseRelation parses "arith relop arith".
+func (p *parser) parseRelation() (Node, error) {
+	l, err := p.parseArith()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	if !isOp(tok, ">", "<", ">=", "<=", "=", "==", "!=") {
+		return nil, p.errorf(tok, "expected relational operator instead of %q", tok.text)
+	}
+	p.next()
+	r, err := p.parseArith()
+	if err != nil {
+		return nil, err
+	}
+	return &Relation{Op: tok.text, L: l, R: r}, nil
+}
+
+// arithPrecedence lists the binary arithmetic operators by increasing
+// precedence.
+var arithPrecedence = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) parseArith() (Arith, error) {
+	return p.parseArithLevel(0)
+}
+
+func (p *parser) parseArithLevel(level int) (Arith, error) {
+	if level >= len(arithPrecedence) {
+		return p.parseArithPrimary()
+	}
+	l, err := p.parseArithLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for isOp(p.peek(), arithPrecedence[level]...) {
+		op := p.next().text
+		r, err := p.parseArithLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &BinOp{Op: op, L: l, R: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseArithPrimary() (Arith, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		a, err := p.parseArith()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, p.errorf(closing, "expected \")\" instead of %q", closing.text)
+		}
+		return a, nil
+	case tokWord:
+		if v, ok := parseNumber(tok.text); ok {
+			return &Num{V: v}, nil
+		}
+		if v, ok := namedConstants[tok.text]; ok {
+			return &Num{V: v}, nil
+		}
+		if tok.text == "len" {
+			return &Len{}, nil
+		}
+		if loadProtos[tok.text] {
+			return p.parseLoad(tok)
+		}
+	}
+	return nil, p.errorf(tok, "expected arithmetic expression instead of %q", tok.text)
+}
+
+// parseLoad parses a packet data accessor "proto[expr]" or "proto[expr:size]",
+// with the proto token already consumed.
+func (p *parser) parseLoad(proto token) (Arith, error) {
+	if tok := p.next(); tok.kind != tokLBrack {
+		return nil, p.errorf(tok, "expected \"[\" after %q", proto.text)
+	}
+	off, err := p.parseArith()
+	if err != nil {
+		return nil, err
+	}
+	size := 1
+	if p.peek().kind == tokColon {
+		p.next()
+		tok := p.next()
+		switch tok.text {
+		case "1", "2", "4":
+			size = int(tok.text[0] - '0')
+		default:
+			return nil, p.errorf(tok, "data size must be 1, 2, or 4 instead of %q", tok.text)
+		}
+	}
+	if tok := p.next(); tok.kind != tokRBrack {
+		return nil, p.errorf(tok, "expected \"]\" instead of %q", tok.text)
+	}
+	return &Load{Proto: proto.text, Off: off, Size: size}, nil
+}
+
+// parsePrimitive parses a filter primitive "[proto] [dir] [kind] [id]".
+func (p *parser) parsePrimitive() (Node, error) {
+	prim := &Primitive{}
+	first := p.peek()
+	switch first.text {
+	case "less", "greater":
+		p.next()
+		tok := p.next()
+		v, ok := parseNumber(tok.text)
+		if !ok {
+			return nil, p.errorf(tok, "expected length after %q instead of %q", first.text, tok.text)
+		}
+		op := "<="
+		if first.text == "greater" {
+			op = ">="
+		}
+		return &Relation{Op: op, L: &Len{}, R: &Num{V: v}}, nil
+	}
+	// Protocol qualifier...
+	if protos[p.peek().text] {
+		prim.Proto = p.next().text
+	}
+	// Direction qualifier, where "src or dst" and "src and dst" are
+	// special-cased, as they otherwise would clash with the logical operators.
+	if tok := p.peek(); isWord(tok, "src", "dst") {
+		p.next()
+		prim.Dir = tok.text
+		if isWord(p.peek(), "or", "and") && isWord(p.peekAt(1), "src", "dst") &&
+			p.peekAt(1).text != tok.text {
+			prim.Dir += " " + p.next().text + " " + p.next().text
+		}
+	} else if isWord(tok, "inbound", "outbound") {
+		p.next()
+		prim.Dir = tok.text
+		return prim, nil
+	}
+	// Type qualifier...
+	if tok := p.peek(); kinds[tok.text] {
+		p.next()
+		prim.Kind = tok.text
+	}
+	switch prim.Kind {
+	case "":
+		if prim.Proto != "" && prim.Dir == "" {
+			// Just a protocol, such as "tcp" or "ip6".
+			return prim, nil
+		}
+		tok := p.peek()
+		if tok.kind != tokWord || keywords[tok.text] {
+			return nil, p.errorf(tok, "expected host name or address instead of %q", tok.text)
+		}
+		if prim.Proto == "" && prim.Dir == "" && p.last != nil && idKinds[p.last.Kind] {
+			// Bare id, inheriting the qualifiers from the preceding
+			// primitive, as in "host a or b".
+			inherited := *p.last
+			inherited.Mask = ""
+			prim = &inherited
+		} else {
+			prim.Kind = "host"
+		}
+	case "broadcast", "multicast":
+		return prim, nil
+	case "vlan", "mpls", "pppoes", "geneve":
+		// The id is optional here, but must be numeric when present.
+		if _, ok := parseNumber(p.peek().text); ok && p.peek().kind == tokWord {
+			prim.ID = p.next().text
+		}
+		return prim, nil
+	}
+	tok := p.next()
+	if tok.kind != tokWord || keywords[tok.text] {
+		return nil, p.errorf(tok, "expected %s instead of %q", prim.Kind, tok.text)
+	}
+	prim.ID = tok.text
+	if prim.Kind == "net" && isWord(p.peek(), "mask") {
+		p.next()
+		mask := p.next()
+		if mask.kind != tokWord {
+			return nil, p.errorf(mask, "expected netmask instead of %q", mask.text)
+		}
+		prim.Mask = mask.text
+	}
+	if err := checkPrimitive(prim); err != nil {
+		return nil, p.errorf(tok, "%s", err.Error())
+	}
+	p.last = prim
+	return prim, nil
+}
+
+// parseNumber parses a decimal, hexadecimal ("0x...") or octal ("0...")
+// unsigned 32bit number.
+func parseNumber(s string) (uint32, bool) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(v), true
+}
@@ -0,0 +1,65 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package filter_test
+
+import (
+	"github.com/siemens/csharg/filter"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pcap filter expressions", func() {
+
+	It("accepts an empty expression", func() {
+		n, err := filter.Parse("  ")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeNil())
+	})
+
+	DescribeTable("accepts valid expressions",
+		func(expr string, expected string) {
+			n, err := filter.Parse(expr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n.String()).To(Equal(expected))
+		},
+		Entry(nil, "tcp", "tcp"),
+		Entry(nil, "host 10.0.0.1", "host 10.0.0.1"),
+		Entry(nil, "tcp port 443 and host 10.0.0.1", "(tcp port 443 and host 10.0.0.1)"),
+		Entry(nil, "port 80 or 8080", "(port 80 or port 8080)"),
+		Entry(nil, "src or dst host fe80::1", "src or dst host fe80::1"),
+		Entry(nil, "ether host 00:11:22:33:44:55", "ether host 00:11:22:33:44:55"),
+		Entry(nil, "net 10.0.0.0/8 and not udp", "(net 10.0.0.0/8 and not udp)"),
+		Entry(nil, "net 192.168 mask 255.255.0.0", "net 192.168 mask 255.255.0.0"),
+		Entry(nil, "tcp portrange 1-1024", "tcp portrange 1-1024"),
+		Entry(nil, "ip proto \\tcp", "ip proto \\tcp"),
+		Entry(nil, "vlan 42 && (arp || icmp)", "(vlan 42 and (arp or icmp))"),
+		Entry(nil, "tcp[13] & 2 != 0", "(tcp[13] & 2) != 0"),
+		Entry(nil, "tcp[tcpflags] & (tcp-syn|tcp-ack) != 0", "(tcp[13] & (2 | 16)) != 0"),
+		Entry(nil, "ip[2:2] > 576", "ip[2:2] > 576"),
+		Entry(nil, "greater 100", "len >= 100"),
+		Entry(nil, "not host foo.example.com", "not host foo.example.com"),
+	)
+
+	DescribeTable("rejects invalid expressions",
+		func(expr string, pos int) {
+			err := filter.Validate(expr)
+			Expect(err).To(HaveOccurred())
+			Expect(err).To(BeAssignableToTypeOf(&filter.SyntaxError{}))
+			Expect(err.(*filter.SyntaxError).Pos).To(Equal(pos))
+		},
+		Entry(nil, "tcp prot 443", 4),
+		Entry(nil, "tcp port 443 and", 16),
+		Entry(nil, "host 10.0.0.256", 5),
+		Entry(nil, "port 70000", 5),
+		Entry(nil, "net 10.0.0.0/33", 4),
+		Entry(nil, "(tcp", 4),
+		Entry(nil, "tcp[1:3] = 0", 6),
+		Entry(nil, "icmp port 7", 10),
+		Entry(nil, "ether host 00:11:22", 11),
+		Entry(nil, "tcp $ udp", 4),
+	)
+
+})
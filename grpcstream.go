@@ -0,0 +1,189 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements transporting capture streams as gRPC server streams, for capture
+// services exposing the csharg.capture.v1.CaptureService.
+
+package csharg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/capturerpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// errNoGRPCStream signals that a capture service doesn't support gRPC capture
+// streams.
+var errNoGRPCStream = errors.New("capture service does not support gRPC capture streams")
+
+// captureGRPCStream calls the gRPC Capture method of the capture service,
+// giving up when the context is done before the capture stream response
+// arrives. It returns errNoGRPCStream if the capture service doesn't implement
+// it.
+func (hc *hostsharktank) captureGRPCStream(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions, header http.Header) (CaptureStreamer, error) {
+	capreq, err := CaptureServiceRequest(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	apiurl := *hc.hosturl
+	apiurl.Path = path.Join(apiurl.Path, capturerpc.CaptureMethod)
+	apiurl.RawQuery = ""
+	var body bytes.Buffer
+	_ = capturerpc.WriteMessage(&body, capreq.Marshal())
+	reqctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(reqctx, http.MethodPost, apiurl.String(), &body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if err := hc.authorize(req.Header); err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", capturerpc.ContentType)
+	req.Header.Set("Te", "trailers")
+	log.Debugf("calling gRPC capture service %q, time limit %s", RedactURL(&apiurl), hc.opts.handshakeTimeout())
+	if timeout := hc.opts.handshakeTimeout(); timeout > 0 {
+		timer := time.AfterFunc(timeout, cancel)
+		defer timer.Stop()
+	}
+	defer afterDone(ctx, cancel)()
+	resp, err := (&http.Client{Transport: hc.http2Transport(apiurl.Scheme)}).Do(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, unreachable(err)
+	}
+	mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 ||
+		!strings.HasPrefix(mediatype, "application/grpc") {
+		resp.Body.Close()
+		cancel()
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusNotFound, http.StatusMethodNotAllowed,
+			http.StatusUnsupportedMediaType, http.StatusUpgradeRequired:
+			return nil, errNoGRPCStream
+		}
+		if err := rejected(resp, t); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("capture service refused capture: %s", resp.Status)
+	}
+	// A trailers-only response carries the call status in its headers and
+	// signals an immediately failed call.
+	if present, err := capturerpc.ParseStatus(resp.Header); present {
+		resp.Body.Close()
+		cancel()
+		var status *capturerpc.Status
+		if errors.As(err, &status) {
+			switch status.Code {
+			case capturerpc.Unimplemented:
+				return nil, errNoGRPCStream
+			case capturerpc.Unauthenticated:
+				return nil, fmt.Errorf("%w: %s", ErrUnauthenticated, status.Message)
+			case capturerpc.PermissionDenied:
+				return nil, fmt.Errorf("%w from target %q", ErrForbidden, t.QualifiedName())
+			}
+		}
+		if err == nil {
+			err = errors.New("gRPC capture call ended without capture stream")
+		}
+		return nil, fmt.Errorf("capture service refused capture: %w", err)
+	}
+	log.Debugf("capture service gRPC capture stream response: %s %s", resp.Proto, resp.Status)
+	maxsize := capturerpc.DefaultMaxMessageSize
+	if opts != nil && opts.MaxBuffer > int64(maxsize) {
+		maxsize = int(opts.MaxBuffer)
+	}
+	return startHTTPCaptureStream(w, &grpcChunkReader{resp: resp, maxsize: maxsize}, cancel, t, opts, hc.opts.StallTimeout), nil
+}
+
+// CaptureServiceRequest is a low-level function almost all csharg package
+// users WON'T use. It returns the gRPC Capture request for the specified
+// capture target and options, as the gRPC counterpart to
+// CaptureServiceQueryParams.
+func CaptureServiceRequest(t *api.Target, opts *CaptureOptions) (*capturerpc.CaptureRequest, error) {
+	if opts == nil {
+		opts = &CaptureOptions{}
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	ctext, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	nifs, err := opts.resolveNifs(t)
+	if err != nil {
+		return nil, err
+	}
+	req := &capturerpc.CaptureRequest{
+		Container: string(ctext),
+		Nifs:      nifs,
+		Filter:    opts.Filter,
+		Chaste:    opts.AvoidPromiscuousMode,
+		SnapLen:   uint32(opts.SnapLen),
+	}
+	for _, vlan := range opts.VLANs {
+		req.VLANs = append(req.VLANs, uint32(vlan))
+	}
+	for _, encap := range opts.Decapsulate {
+		req.Decap = append(req.Decap, string(encap))
+	}
+	return req, nil
+}
+
+// grpcChunkReader reads the pcapng stream data from the gRPC capture chunk
+// messages in an HTTP/2 response body, turning a non-OK call status in the
+// trailers into an error.
+type grpcChunkReader struct {
+	resp    *http.Response
+	maxsize int
+	data    []byte // remaining data of the current chunk.
+}
+
+// Read the next capture stream data.
+func (r *grpcChunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		msg, err := capturerpc.ReadMessage(r.resp.Body, r.maxsize)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if _, serr := capturerpc.ParseStatus(r.resp.Trailer); serr != nil {
+					return 0, serr
+				}
+			}
+			return 0, err
+		}
+		var chunk capturerpc.CaptureChunk
+		if err := chunk.Unmarshal(msg); err != nil {
+			return 0, err
+		}
+		r.data = chunk.Data
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Close the underlying response body.
+func (r *grpcChunkReader) Close() error {
+	return r.resp.Body.Close()
+}
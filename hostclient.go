@@ -9,21 +9,23 @@
 package csharg
 
 import (
+	"context"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/siemens/csharg/api"
 
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
 )
 
 // SharkTankOnHostOptions allows some degree of control over how to use a
@@ -31,24 +33,76 @@ import (
 type SharkTankOnHostOptions struct {
 	CommonClientOptions
 	InsecureSkipVerify bool
+	// ServerName optionally overrides the server name used to verify the
+	// capture service's certificate, as well as for SNI. This allows
+	// connecting to a capture service by IP address or through a port
+	// forwarding, while still validating its certificate against the expected
+	// name instead of skipping verification altogether.
+	ServerName string
+	// TLSConfig optionally specifies the base TLS client configuration, such
+	// as with a client certificate. InsecureSkipVerify and ServerName are
+	// applied on top of it.
+	TLSConfig *tls.Config
+	// ClientCertificates optionally specifies client certificates to present
+	// to capture services requiring mutual TLS, in addition to any client
+	// certificates of TLSConfig.
+	ClientCertificates []tls.Certificate
+	// ClientCertFile and ClientKeyFile optionally specify the PEM files of an
+	// additional client certificate and its private key to present to capture
+	// services requiring mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// DialContext optionally specifies the dial function for creating the
+	// network connections to the capture service, such as through an SSH
+	// tunnel. When set, proxies from the environment are ignored.
+	DialContext DialContextFunc
+	// Proxy optionally specifies an HTTP CONNECT proxy to connect through,
+	// instead of any proxy configured in the environment. When DialContext
+	// is set too, then the proxy is connected to using DialContext.
+	Proxy *ProxyOptions
+	// Dialer optionally tunes the network connections to the capture service,
+	// also when connecting through proxies or using DialContext.
+	Dialer DialerOptions
+	// Transport optionally specifies the capture stream transport, defaulting
+	// to websockets.
+	Transport CaptureTransport
+	// MaxCaptures optionally limits the number of concurrent captures,
+	// including prepared captures not yet started. Further captures then fail
+	// with ErrTooManyCaptures until other captures have ended, instead of
+	// exhausting the local ephemeral ports.
+	MaxCaptures int
 }
 
+// maxIdleConnsPerHost is the number of idle connections to the capture
+// service kept for reuse, so that the discovery and preflight requests of
+// many concurrent captures don't need to dial from scratch.
+const maxIdleConnsPerHost = 16
+
 // NewSharkTankOnHost returns a new host capturer object to capture directly
 // from host targets using a Packetflix service, and accessing it via host+port
 // and an optional service path.
 func NewSharkTankOnHost(hosturl string, opts *SharkTankOnHostOptions) (st SharkTank, err error) {
-	// First checkpoint: if it doesn't start with the http/s scheme, then go for http.
-	if !strings.HasPrefix(hosturl, "http:") && !strings.HasPrefix(hosturl, "https://") {
-		hosturl = "http://" + hosturl
-	}
-	surl, err := url.Parse(hosturl)
+	surl, err := parseHostURL(hosturl)
 	if err != nil {
-		return
+		return nil, err
 	}
-	// Don't accept fragments and query elements.
-	if surl.User != nil || surl.Opaque != "" ||
-		surl.RawQuery != "" || surl.Fragment != "" {
-		return nil, errors.New("only host name and optional port number allowed")
+	return newHostSharkTank(surl, opts)
+}
+
+// newHostSharkTank returns a new host capturer object accessing the Packetflix
+// service at the specified URL.
+func newHostSharkTank(surl *url.URL, opts *SharkTankOnHostOptions) (*hostsharktank, error) {
+	if opts != nil {
+		switch opts.Transport {
+		case "", TransportWebsocket, TransportHTTP2, TransportSSE, TransportGRPC:
+		default:
+			return nil, fmt.Errorf("unsupported capture transport %q", opts.Transport)
+		}
+	}
+	if opts != nil && opts.Proxy != nil {
+		if _, err := NewProxyDialer(opts.Proxy, nil); err != nil {
+			return nil, err
+		}
 	}
 	uc := &hostsharktank{
 		hosturl: surl,
@@ -61,9 +115,81 @@ func NewSharkTankOnHost(hosturl string, opts *SharkTankOnHostOptions) (st SharkT
 	if opts != nil {
 		uc.opts = *opts
 	}
+	if uc.opts.ClientCertFile != "" || uc.opts.ClientKeyFile != "" {
+		if uc.opts.ClientCertFile == "" || uc.opts.ClientKeyFile == "" {
+			return nil, errors.New("client certificate requires both certificate and key files")
+		}
+		cert, err := tls.LoadX509KeyPair(uc.opts.ClientCertFile, uc.opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		certs := uc.opts.ClientCertificates
+		uc.opts.ClientCertificates = append(certs[:len(certs):len(certs)], cert)
+	}
+	uc.captures.limit = uc.opts.MaxCaptures
+	uc.tlsSessions = tls.NewLRUClientSessionCache(0)
 	return uc, nil
 }
 
+// parseHostURL parses the URL of a standalone capture service, defaulting to
+// the http scheme. Besides host names and IPv4 addresses, the host can be an
+// IPv6 literal in brackets with an optional port number and zone ID, such as
+// "https://[fe80::1%eth0]:5001"; the zone ID may be percent-encoded as "%25",
+// as in RFC 6874, but doesn't need to be. IPv6 literals without port number
+// don't need to be in brackets, such as "fe80::1%eth0".
+func parseHostURL(hosturl string) (*url.URL, error) {
+	scheme, rest := "http", hosturl
+	if s, r, ok := strings.Cut(hosturl, "://"); ok {
+		scheme, rest = strings.ToLower(s), r
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("unsupported capture service URL scheme %q", s)
+		}
+	}
+	host, path := rest, ""
+	if idx := strings.IndexAny(rest, "/?#"); idx >= 0 {
+		host, path = rest[:idx], rest[idx:]
+	}
+	if strings.Count(host, ":") > 1 && !strings.HasPrefix(host, "[") {
+		if _, err := netip.ParseAddr(host); err != nil {
+			return nil, fmt.Errorf("invalid IPv6 address %q, use brackets when specifying a port", host)
+		}
+		host = "[" + host + "]"
+	}
+	if strings.HasPrefix(host, "[") {
+		end := strings.Index(host, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("missing closing bracket in IPv6 address %q", host)
+		}
+		literal := host[1:end]
+		if strings.Contains(literal, "%25") {
+			unescaped, err := url.PathUnescape(literal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IPv6 zone ID in %q", host)
+			}
+			literal = unescaped
+		}
+		addr, err := netip.ParseAddr(literal)
+		if err != nil || !addr.Is6() {
+			return nil, fmt.Errorf("invalid IPv6 address %q", literal)
+		}
+		// url.Parse insists on zone IDs being percent-encoded.
+		host = "[" + strings.Replace(literal, "%", "%25", 1) + "]" + host[end+1:]
+	}
+	surl, err := url.Parse(scheme + "://" + host + path)
+	if err != nil {
+		return nil, err
+	}
+	// Don't accept fragments and query elements.
+	if surl.User != nil || surl.Opaque != "" ||
+		surl.RawQuery != "" || surl.Fragment != "" {
+		return nil, errors.New("only host name and optional port number allowed")
+	}
+	if surl.Hostname() == "" {
+		return nil, errors.New("missing capture service host name")
+	}
+	return surl, nil
+}
+
 // hostsharktank implements the UrlCapturer interface for a standalone host,
 // where the Packetflix capture service can be "directly" reached via
 // host+port-only URL.
@@ -74,44 +200,112 @@ type hostsharktank struct {
 	opts SharkTankOnHostOptions
 	// Cached capture targets
 	cache TargetCache
+	// Reaching a cluster capture service, which reports the node names of
+	// the capture targets itself.
+	cluster bool
+	// Discovery generation, incremented whenever the cache gets cleared, so
+	// that discoveries started before cannot repopulate the cache. In-flight
+	// discoveries of the current generation share the discovery context,
+	// which gets cancelled when clearing the cache.
+	mu        sync.Mutex
+	gen       uint64
+	discovery context.Context
+	cancel    context.CancelFunc
+	// HTTP transports shared by all requests to the capture service, created
+	// on demand, so that closing can release their idle connections.
+	httptrans *http.Transport
+	h2ctrans  *http2.Transport
+	// Prepared and active captures, to be stopped when closing.
+	captures captureTracker
+	// Dial function shared by all connections to the capture service, so
+	// that concurrent dials are bounded across all transports.
+	dialOnce sync.Once
+	dial     DialContextFunc
+	// TLS sessions shared by all connections to the capture service, so that
+	// new connections resume sessions instead of doing full handshakes.
+	tlsSessions tls.ClientSessionCache
 }
 
 // Captures network traffic from a specific pod and send the captured packet
 // stream to the writer w. The capture optionally can be restricted to only a
 // subset of the pod's network interfaces. The pod name can be prefixed by a
 // namespace in form of "namespace/podname"; if the namespace is left out it
-// defaults to the aptly-named "default" namespace.
+// defaults to the namespace from the client options, or otherwise to the
+// aptly-named "default" namespace.
 //
 // In principle, a standalone Docker host won't have Kubernetes pods, but then,
 // we don't block this function, because we cannot deny any pod existence. Talk
 // about KinD...
 func (hc *hostsharktank) CapturePod(w io.Writer, pod string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
-	p := strings.Split(pod, "/")
-	switch len(p) {
-	case 1:
-		p = []string{"default", p[0]}
-	case 2:
-		// ...already has a namespace, so we're done here.
-	default:
-		return nil, fmt.Errorf("invalid pod namespace/name: %q", pod)
+	return hc.CapturePodContext(context.Background(), w, pod, opts)
+}
+
+// CapturePodContext captures network traffic from a specific pod like
+// CapturePod, giving up when the context is done before the capture has been
+// started, and then stopping the capture when the context is done.
+func (hc *hostsharktank) CapturePodContext(ctx context.Context, w io.Writer, pod string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	namespace, name, err := api.ParsePodNameIn(pod, hc.opts.Namespace)
+	if err != nil {
+		return nil, err
 	}
 	t := &api.Target{
-		Name: strings.Join(p, "/"),
-		Type: "pod",
+		Name:      name,
+		Namespace: namespace,
+		Type:      api.TypePod,
 	}
-	return hc.Capture(w, t, opts)
+	return hc.CaptureContext(ctx, w, t, opts)
 }
 
 // CaptureContainer captures the network traffic from a specific container on a
 // specific cluster node and then sends the captured packet stream to the writer
 // w. The capture optionally can be restricted to only a subset of the
-// containers/pod's network interfaces.
+// containers/pod's network interfaces. Instead of its name, the container can
+// also be specified by its (truncated) container or sandbox ID.
 func (hc *hostsharktank) CaptureContainer(w io.Writer, nodename, name string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	return hc.CaptureContainerContext(context.Background(), w, nodename, name, opts)
+}
+
+// CaptureContainerContext captures the network traffic from a specific
+// container like CaptureContainer, giving up when the context is done before
+// the capture has been started, and then stopping the capture when the
+// context is done.
+func (hc *hostsharktank) CaptureContainerContext(ctx context.Context, w io.Writer, nodename, name string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
 	t := &api.Target{
 		Name:     name,
 		NodeName: nodename,
 	}
-	return hc.Capture(w, t, opts)
+	if hc.cache.IsEmpty() {
+		if _, err := hc.discover(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if tname, ok := hc.cache.OnNode(nodename, "", name); ok {
+		t = tname.Clone()
+	} else {
+		tid, err := hc.cache.containerByID(nodename, name)
+		if err != nil {
+			return nil, err
+		}
+		if tid != nil {
+			t = tid.Clone()
+		}
+	}
+	return hc.CaptureContext(ctx, w, t, opts)
+}
+
+// CaptureMany captures network traffic from multiple capture targets at the
+// same time, merging their captured packets into a single section written to
+// w. The captures are prepared first and only then started at the same
+// instant.
+func (hc *hostsharktank) CaptureMany(w io.Writer, targets []*api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	return captureMany(hc, w, targets, opts)
+}
+
+// CaptureReader captures network traffic from a capture target, returning a
+// reader delivering the packet capture stream. Closing the reader stops the
+// capture.
+func (hc *hostsharktank) CaptureReader(t *api.Target, opts *CaptureOptions) (io.ReadCloser, error) {
+	return CaptureReader(hc, t, opts)
 }
 
 // needsTargetDiscovery, given a capture target description, returns true if the
@@ -131,13 +325,65 @@ func needsTargetDiscovery(t *api.Target) bool {
 // are then send to the given Writer. This implementation hides the details how
 // to connect to the discovery/capture service.
 func (hc *hostsharktank) Capture(w io.Writer, t *api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	return hc.CaptureContext(context.Background(), w, t, opts)
+}
+
+// CaptureContext captures network traffic from a capture target like Capture,
+// giving up when the context is done before the capture has been started, and
+// then stopping the capture when the context is done.
+func (hc *hostsharktank) CaptureContext(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	pc, err := hc.PrepareContext(ctx, w, t, opts)
+	if err != nil {
+		return
+	}
+	return pc.Start()
+}
+
+// Prepare a capture from a capture target, without requesting packets yet.
+// When using the websocket transport, Prepare already connects to the capture
+// service, and the returned prepared capture only starts reading the packet
+// capture stream when started. The other transports request the capture
+// stream as part of connecting, so these connect only when the prepared
+// capture is started.
+func (hc *hostsharktank) Prepare(w io.Writer, t *api.Target, opts *CaptureOptions) (PreparedCapture, error) {
+	return hc.PrepareContext(context.Background(), w, t, opts)
+}
+
+// PrepareContext prepares a capture from a capture target like Prepare,
+// giving up when the context is done before the capture has been started, and
+// then stopping the capture when the context is done.
+func (hc *hostsharktank) PrepareContext(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions) (PreparedCapture, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := hc.captures.reserve(); err != nil {
+		return nil, err
+	}
+	pc, err := hc.prepare(ctx, w, t, opts)
+	if err != nil {
+		hc.captures.release()
+		return nil, err
+	}
+	if pc, err = hc.captures.track(pc); err != nil {
+		return nil, err
+	}
+	return preparedContext(ctx, pc), nil
+}
+
+// prepare a capture from a capture target, using the configured transport.
+func (hc *hostsharktank) prepare(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions) (pc PreparedCapture, err error) {
 	if opts == nil {
 		opts = &CaptureOptions{}
 	}
 	// Fill the cache only if we don't have to necessary information we might
 	// want to fill in...
 	if hc.cache.IsEmpty() && needsTargetDiscovery(t) {
-		hc.Targets()
+		if _, err = hc.discover(ctx); err != nil {
+			return
+		}
 		if t, err = CompleteTarget(t, opts, &hc.cache); err != nil {
 			return
 		}
@@ -151,13 +397,80 @@ func (hc *hostsharktank) Capture(w io.Writer, t *api.Target, opts *CaptureOption
 		log.Errorf("service request header failure: %q", err.Error())
 		return
 	}
-	if hc.opts.BearerToken != "" {
-		wsheaders.Set("Authorization", "Bearer "+hc.opts.BearerToken)
+	switch hc.opts.Transport {
+	case TransportHTTP2, TransportSSE, TransportGRPC:
+		return &preparedCapture{
+			start: func() (CaptureStreamer, error) {
+				return hc.captureStream(ctx, w, t, opts, *wsheaders)
+			},
+		}, nil
+	}
+	return hc.prepareWebsocket(ctx, w, t, opts, *wsheaders)
+}
+
+// captureStream requests a capture stream using the configured HTTP-based
+// transport, falling back to websockets if the capture service doesn't
+// support this transport.
+func (hc *hostsharktank) captureStream(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions, header http.Header) (CaptureStreamer, error) {
+	switch hc.opts.Transport {
+	case TransportHTTP2:
+		cs, err := hc.captureHTTPStream(ctx, w, t, opts, header)
+		if !errors.Is(err, errNoHTTPStream) {
+			return cs, err
+		}
+		log.Debug("capture service lacks HTTP/2 capture streams, falling back to websocket")
+	case TransportSSE:
+		cs, err := hc.captureEventStream(ctx, w, t, opts, header)
+		if !errors.Is(err, errNoHTTPStream) {
+			return cs, err
+		}
+		log.Debug("capture service lacks HTTP capture streams, falling back to websocket")
+	case TransportGRPC:
+		cs, err := hc.captureGRPCStream(ctx, w, t, opts, header)
+		if !errors.Is(err, errNoGRPCStream) {
+			return cs, err
+		}
+		log.Debug("capture service lacks gRPC capture streams, falling back to websocket")
+	}
+	pc, err := hc.prepareWebsocket(ctx, w, t, opts, header)
+	if err != nil {
+		return nil, err
+	}
+	return pc.Start()
+}
+
+// ErrServiceUnreachable signals that the capture service cannot be contacted,
+// such as when the connection gets refused or times out, or when there is no
+// capture service at the capture service URL.
+var ErrServiceUnreachable = errors.New("capture service unreachable")
+
+// unreachable wraps an error contacting the capture service, so that it
+// matches ErrServiceUnreachable, and redacts any credentials in its URL.
+func unreachable(err error) error {
+	return fmt.Errorf("%w: %w", ErrServiceUnreachable, RedactError(err))
+}
+
+// rejected returns an error wrapping ErrUnauthenticated or ErrForbidden if the
+// capture service response rejects the credentials or denies capturing from
+// the capture target, and nil otherwise.
+func rejected(resp *http.Response, t *api.Target) error {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, resp.Status)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w from target %q", ErrForbidden, t.QualifiedName())
 	}
+	return nil
+}
+
+// prepareWebsocket connects to the capture service via a websocket and returns
+// a prepared capture that reads the packet capture stream from the websocket
+// only after it has been started.
+func (hc *hostsharktank) prepareWebsocket(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions, header http.Header) (PreparedCapture, error) {
 	query, err := CaptureServiceQueryParams(t, opts)
 	if err != nil {
 		log.Errorf("service request query parameter failure: %q", err.Error())
-		return
+		return nil, err
 	}
 	apiurl := *hc.hosturl
 	if apiurl.Scheme == "https" {
@@ -169,85 +482,330 @@ func (hc *hostsharktank) Capture(w io.Writer, t *api.Target, opts *CaptureOption
 	apiurl.RawQuery = query.Encode()
 
 	// Finally: off to capture...
-	log.Debugf("connecting to capture service %q, time limit %s", apiurl.String(), hc.opts.Timeout)
+	wscon, resp, err := hc.dialWebsocket(ctx, &apiurl, header)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// When the websocket upgrade gets rejected, such as by a proxy
+		// blocking websockets, then try to downgrade to a plain HTTP capture
+		// stream, unless that has already been tried. As this requests the
+		// capture stream, it has to wait for the prepared capture to be
+		// started.
+		if errors.Is(err, websocket.ErrBadHandshake) && hc.opts.Transport != TransportSSE {
+			log.Debugf("capture service websocket rejected: %s, downgrading to HTTP capture stream", resp.Status)
+			return &preparedCapture{
+				start: func() (CaptureStreamer, error) {
+					cs, herr := hc.captureEventStream(ctx, w, t, opts, header)
+					if errors.Is(herr, errNoHTTPStream) {
+						log.Errorf("cannot contact capture service via websocket: %s", err.Error())
+						// Proxies blocking websockets might respond with
+						// 403 too, so keep the bad handshake visible.
+						if rerr := rejected(resp, t); rerr != nil {
+							return nil, fmt.Errorf("%w: %w", rerr, err)
+						}
+						return nil, err
+					}
+					return cs, herr
+				},
+			}, nil
+		}
+		log.Errorf("cannot contact capture service via websocket: %s", err.Error())
+		return nil, err
+	}
+	log.Debugf("capture service initial HTTP response: %s %s, header %v",
+		resp.Proto, resp.Status, RedactHeader(resp.Header))
+	// Broken capture streams get resumed by requesting the capture stream
+	// anew, with fresh authorization.
+	redial := func(ctx context.Context) (*websocket.Conn, error) {
+		wscon, resp, err := hc.dialWebsocket(ctx, &apiurl, header.Clone())
+		if err != nil && resp != nil {
+			if rerr := rejected(resp, t); rerr != nil {
+				return nil, rerr
+			}
+		}
+		return wscon, err
+	}
+	return &preparedCapture{
+		start: func() (CaptureStreamer, error) {
+			return startCaptureStream(w, wscon, t, opts, hc.opts.StallTimeout, redial)
+		},
+		cancel: func() { wscon.Close() },
+	}, nil
+}
+
+// dialWebsocket connects to the capture service at the specified websocket
+// URL, authorizing the request with the specified header.
+func (hc *hostsharktank) dialWebsocket(ctx context.Context, apiurl *url.URL, header http.Header) (*websocket.Conn, *http.Response, error) {
+	log.Debugf("connecting to capture service %q, time limit %s", RedactURL(apiurl), hc.opts.handshakeTimeout())
 	wsd := &websocket.Dialer{
 		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: hc.opts.Timeout,
+		HandshakeTimeout: hc.opts.handshakeTimeout(),
 	}
-	if hc.opts.InsecureSkipVerify && apiurl.Scheme == "wss" {
-		wsd.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	if dial := hc.dialContext(); dial != nil {
+		if hc.tunnelled() {
+			wsd.Proxy = nil
+		}
+		wsd.NetDialContext = dial
 	}
-	wscon, resp, err := wsd.Dial(apiurl.String(), *wsheaders)
-	if err != nil {
-		log.Errorf("cannot contact capture service via websocket: %s", err.Error())
-		return
+	if apiurl.Scheme == "wss" {
+		wsd.TLSClientConfig = hc.tlsConfig()
+	}
+	if err := hc.authorize(header); err != nil {
+		return nil, nil, err
 	}
-	log.Debugf("capture service initial HTTP response: %+v", *resp)
-	return StartCaptureStream(w, wscon, t, opts)
+	wscon, resp, err := wsd.DialContext(ctx, apiurl.String(), header)
+	if err != nil && resp == nil {
+		err = unreachable(err)
+	}
+	return wscon, resp, err
 }
 
 // Targets discovers the available capture targets in this cluster.
 func (hc *hostsharktank) Targets() (ts api.Targets) {
-	return hc.discover()
+	ts, _ = hc.discover(context.Background())
+	return
+}
+
+// TargetsContext discovers the available capture targets in this cluster,
+// giving up when the context is done before the discovery completes. It
+// returns an error wrapping ErrServiceUnreachable if the capture service
+// cannot be contacted, wrapping ErrUnauthenticated if the capture service
+// rejects the credentials, and wrapping ErrForbidden if it denies the
+// discovery.
+func (hc *hostsharktank) TargetsContext(ctx context.Context) (ts api.Targets, err error) {
+	return hc.discover(ctx)
+}
+
+// Close stops all active captures and cancels all prepared captures, as well
+// as any in-flight discovery, and then releases the idle connections to the
+// capture service. Afterwards, captures fail with ErrClosed and discoveries
+// return no capture targets.
+func (hc *hostsharktank) Close() error {
+	hc.captures.close()
+	hc.Clear()
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.httptrans != nil {
+		hc.httptrans.CloseIdleConnections()
+	}
+	if hc.h2ctrans != nil {
+		hc.h2ctrans.CloseIdleConnections()
+	}
+	return nil
 }
 
 // Clear the internally cached set of capture targets: this will cause the next
-// discover and capture operation to automatically get a fresh set.
+// discover and capture operation to automatically get a fresh set. Any
+// in-flight discovery gets cancelled and its result discarded.
 func (hc *hostsharktank) Clear() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.gen++
+	if hc.cancel != nil {
+		hc.cancel()
+		hc.discovery, hc.cancel = nil, nil
+	}
 	hc.cache.Clear()
 }
 
+// discoveryContext returns the context for a new discovery, together with the
+// current discovery generation.
+func (hc *hostsharktank) discoveryContext() (context.Context, uint64) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.discovery == nil {
+		hc.discovery, hc.cancel = context.WithCancel(context.Background())
+	}
+	return hc.discovery, hc.gen
+}
+
+// cacheTargets caches the discovered capture targets, unless the cache has
+// been cleared since the discovery started. It returns true if the capture
+// targets have been cached.
+func (hc *hostsharktank) cacheTargets(gen uint64, targets api.Targets) bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if gen != hc.gen {
+		return false
+	}
+	hc.cache.Set(targets)
+	return true
+}
+
 // Discovers the available capture targets on a standalone Docker host from the
 // capture service,  sending an HTTP(S) GET request to the given service URL.
-func (hc *hostsharktank) discover() (ts api.Targets) {
+// Failing discoveries are logged and return no capture targets, together with
+// the error telling why, such as the context's error when the context is done.
+func (hc *hostsharktank) discover(ctx context.Context) (ts api.Targets, err error) {
 	// If we already have a cached set of capture targets, then avoid the
 	// roundtrip to the cluster capture service and instead quickly return the
 	// cached set.
 	if !hc.cache.IsEmpty() {
-		return hc.cache.Targets()
+		return hc.cache.Targets(), nil
+	}
+	if hc.captures.err() != nil {
+		log.Debug("skipping discovery, as already closed")
+		return api.Targets{}, nil
 	}
 	// Derive the discovery service API URL from the base URL for the SharkTank
 	// cluster capture service. Then issue a simple HTTP/S GET request and hope
 	// that the result does make sense in that it can be decoded.
 	apiurl := *hc.hosturl
 	apiurl.Path = path.Join(apiurl.Path, "discover/mobyshark")
-	log.Debugf("querying targets from GhostWire-on-Packetflix service %q, time limit %s", apiurl.String(), hc.opts.Timeout)
-	httptrans := http.DefaultTransport.(*http.Transport)
-	if hc.opts.InsecureSkipVerify && apiurl.Scheme == "https" {
-		httptrans.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	}
+	log.Debugf("querying targets from GhostWire-on-Packetflix service %q, time limit %s", RedactURL(&apiurl), hc.opts.discoveryTimeout())
 	httpclient := &http.Client{
-		Timeout:   hc.opts.Timeout,
-		Transport: httptrans,
+		Timeout:   hc.opts.discoveryTimeout(),
+		Transport: hc.httpTransport(),
+	}
+	if err := ctx.Err(); err != nil {
+		return api.Targets{}, err
 	}
-	req, err := http.NewRequest("GET", apiurl.String(), nil)
+	dctx, gen := hc.discoveryContext()
+	dctx, cancel := context.WithCancel(dctx)
+	defer cancel()
+	defer afterDone(ctx, cancel)()
+	req, err := http.NewRequestWithContext(dctx, "GET", apiurl.String(), nil)
 	if err != nil {
 		log.Errorf("cannot create new HTTP request: %s", err.Error())
-		return api.Targets{}
+		return api.Targets{}, err
 	}
-	if hc.opts.BearerToken != "" {
-		req.Header.Set("Authorization", "Bearer "+hc.opts.BearerToken)
+	if err := hc.authorize(req.Header); err != nil {
+		log.Errorf("cannot authenticate with GhostWire-on-Packetflix service: %s", err.Error())
+		return api.Targets{}, fmt.Errorf("%w: %s", ErrUnauthenticated, err.Error())
 	}
 	res, err := httpclient.Do(req)
+	if errors.Is(err, context.Canceled) {
+		log.Debug("discovery cancelled")
+		return api.Targets{}, ctx.Err()
+	}
 	if err != nil {
-		log.Errorf("querying targets from GhostWire-on-Packetflix service failed: %s", err.Error())
-		return api.Targets{}
+		log.Errorf("querying targets from GhostWire-on-Packetflix service failed: %s", RedactError(err).Error())
+		return api.Targets{}, unreachable(err)
 	}
 	defer res.Body.Close()
-	var td api.GwTargetList
-	err = json.NewDecoder(res.Body).Decode(&td)
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		log.Errorf("GhostWire-on-Packetflix service rejected credentials: %s", res.Status)
+		return api.Targets{}, fmt.Errorf("%w: %s", ErrUnauthenticated, res.Status)
+	case http.StatusForbidden:
+		log.Errorf("GhostWire-on-Packetflix service denied discovery: %s", res.Status)
+		return api.Targets{}, fmt.Errorf("%w: %s", ErrForbidden, res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Errorf("cannot read targets from GhostWire-on-Packetflix service: %s", err.Error())
+		return api.Targets{}, fmt.Errorf("cannot read discovered targets: %w", err)
+	}
+	targets, version, err := api.DecodeGwTargets(data)
 	if err != nil {
 		log.Errorf("cannot decode targets from GhostWire-on-Packetflix service: %s", err.Error())
-		return api.Targets{}
+		return api.Targets{}, fmt.Errorf("cannot decode discovered targets: %w", err)
+	}
+	if version > api.GwSchemaVersion {
+		log.Warnf("GhostWire discovery schema version %d is newer than supported version %d",
+			version, api.GwSchemaVersion)
 	}
+	log.Debugf("discovered %d targets using GhostWire discovery schema version %d", len(targets), version)
 	// Since we don't have the cluster capture frontend service, we need to fill
 	// in some missing data to get a target list consistent with what a cluster
 	// capture service would return.
-	hostn, _, _ := net.SplitHostPort(hc.hosturl.Host)
-	for _, t := range td.Targets {
-		t.NodeName = hostn
+	if !hc.cluster {
+		hostn := hc.hosturl.Hostname()
+		for _, t := range targets {
+			t.NodeName = hostn
+		}
+	}
+	// Cache the capture target descriptions for further quick reference,
+	// unless the cache has been cleared in the meantime, making these capture
+	// targets stale.
+	if !hc.cacheTargets(gen, targets) {
+		log.Debug("discarding stale discovery result")
+		return api.Targets{}, nil
 	}
-	// Cache the capture target descriptions for further quick reference.
-	hc.cache.Set(td.Targets)
-	return td.Targets
+	return targets, nil
+}
+
+// authorize sets the Authorization header for requests to the capture
+// service, using a fresh SPNEGO token where necessary, as Kerberos
+// authenticators must not be replayed.
+func (hc *hostsharktank) authorize(h http.Header) error {
+	return hc.opts.authorize(h, "HTTP/"+hc.hosturl.Hostname())
+}
+
+// httpTransport returns the HTTP transport for connecting to the capture
+// service, honoring the dial and TLS options, creating it on first use.
+func (hc *hostsharktank) httpTransport() *http.Transport {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.httptrans != nil {
+		return hc.httptrans
+	}
+	httptrans := http.DefaultTransport.(*http.Transport).Clone()
+	if dial := hc.dialContext(); dial != nil {
+		if hc.tunnelled() {
+			httptrans.Proxy = nil
+		}
+		httptrans.DialContext = dial
+	}
+	httptrans.TLSClientConfig = hc.tlsConfig()
+	httptrans.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	hc.httptrans = httptrans
+	return httptrans
+}
+
+// tlsConfig returns the TLS client configuration to use when connecting to the
+// capture service, presenting the client certificates (if any), resuming the
+// TLS sessions of this client unless the base TLS configuration brings its own
+// session cache.
+func (hc *hostsharktank) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+	if hc.opts.TLSConfig != nil {
+		config = hc.opts.TLSConfig.Clone()
+	}
+	if config.ClientSessionCache == nil {
+		config.ClientSessionCache = hc.tlsSessions
+	}
+	if len(hc.opts.ClientCertificates) > 0 {
+		// Don't append to the certificates shared with the base configuration.
+		certs := config.Certificates
+		config.Certificates = append(certs[:len(certs):len(certs)], hc.opts.ClientCertificates...)
+	}
+	if hc.opts.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	if hc.opts.ServerName != "" {
+		config.ServerName = hc.opts.ServerName
+	}
+	return config
+}
+
+// dialContext returns the dial function for connecting to the capture service
+// through an SSH tunnel and/or proxy, as well as with tuned connections, or nil
+// if the default dialer applies. The dial function is created only once, so
+// that all connections share its bounds.
+func (hc *hostsharktank) dialContext() DialContextFunc {
+	hc.dialOnce.Do(func() { hc.dial = hc.newDialContext() })
+	return hc.dial
+}
+
+// newDialContext returns a new dial function for connecting to the capture
+// service, or nil if the default dialer applies.
+func (hc *hostsharktank) newDialContext() DialContextFunc {
+	dial := hc.opts.DialContext
+	if dial != nil || hc.opts.Dialer != (DialerOptions{}) {
+		dial = hc.opts.Dialer.DialContext(dial)
+	}
+	if hc.opts.Proxy == nil {
+		return dial
+	}
+	dial, _ = NewProxyDialer(hc.opts.Proxy, dial)
+	return dial
+}
+
+// tunnelled returns true if connections to the capture service are tunnelled
+// through an SSH tunnel or explicitly configured proxy, so that environment
+// proxy settings don't apply.
+func (hc *hostsharktank) tunnelled() bool {
+	return hc.opts.DialContext != nil || hc.opts.Proxy != nil
 }
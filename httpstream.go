@@ -0,0 +1,358 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements transporting capture streams over plain HTTP/2 streams instead of
+// websockets, for traversing proxies and gateways mishandling websockets.
+
+package csharg
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/siemens/csharg/api"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+// CaptureTransport specifies how capture streams are transported from the
+// capture service to the client. WebTransport over HTTP/3 isn't supported yet,
+// as there is no HTTP/3 stack available to csharg.
+type CaptureTransport string
+
+// Supported capture stream transports.
+const (
+	// TransportWebsocket streams captures over websockets (default).
+	TransportWebsocket CaptureTransport = "websocket"
+	// TransportHTTP2 streams captures over HTTP/2 streams, using h2c for
+	// unencrypted connections. Capture services not capable of HTTP/2 capture
+	// streams are transparently captured from using websockets instead.
+	TransportHTTP2 CaptureTransport = "http2"
+	// TransportSSE streams captures as plain (chunked) HTTP response bodies
+	// or Server-Sent Events, for environments blocking websockets entirely.
+	TransportSSE CaptureTransport = "sse"
+	// TransportGRPC streams captures as gRPC server streams of the
+	// csharg.capture.v1.CaptureService, see package capturerpc. Capture
+	// services not implementing this gRPC service are transparently captured
+	// from using websockets instead.
+	TransportGRPC CaptureTransport = "grpc"
+)
+
+// CaptureStreamMediaType is the media type of capture streams sent as HTTP
+// response bodies, as accepted by capture clients.
+const CaptureStreamMediaType = "application/x-pcapng"
+
+// CaptureEventStreamMediaType is the media type of capture streams sent as
+// Server-Sent Events, with the base64-encoded capture stream data in the
+// events.
+const CaptureEventStreamMediaType = "text/event-stream"
+
+// httpStreamBufferSize is the size of the buffer for reading capture streams
+// from HTTP response bodies.
+const httpStreamBufferSize = 64 * 1024
+
+// errNoHTTPStream signals that a capture service doesn't support sending
+// capture streams as HTTP response bodies.
+var errNoHTTPStream = errors.New("capture service does not support HTTP capture streams")
+
+// captureHTTPStream requests a capture stream from the capture service as an
+// HTTP/2 response body. It returns errNoHTTPStream if the capture service
+// isn't capable of HTTP capture streams.
+func (hc *hostsharktank) captureHTTPStream(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions, header http.Header) (CaptureStreamer, error) {
+	apiurl := *hc.hosturl
+	return hc.requestHTTPStream(ctx, w, t, opts, header,
+		hc.http2Transport(apiurl.Scheme), CaptureStreamMediaType)
+}
+
+// captureEventStream requests a capture stream from the capture service as a
+// plain HTTP response body or as Server-Sent Events, using HTTP/1.1 or HTTP/2
+// as negotiated, and passing any proxies in the way. It returns
+// errNoHTTPStream if the capture service isn't capable of HTTP capture
+// streams.
+func (hc *hostsharktank) captureEventStream(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions, header http.Header) (CaptureStreamer, error) {
+	return hc.requestHTTPStream(ctx, w, t, opts, header,
+		hc.httpTransport(), CaptureStreamMediaType+", "+CaptureEventStreamMediaType)
+}
+
+// requestHTTPStream requests a capture stream in one of the accepted media
+// types from the capture service using the specified transport, giving up
+// when the context is done before the capture stream response arrives.
+func (hc *hostsharktank) requestHTTPStream(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions, header http.Header, transport http.RoundTripper, accept string) (CaptureStreamer, error) {
+	apiurl := *hc.hosturl
+	apiurl.Path = path.Join(apiurl.Path, "capture")
+	query, err := CaptureServiceQueryParams(t, opts)
+	if err != nil {
+		return nil, err
+	}
+	apiurl.RawQuery = query.Encode()
+	reqctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(reqctx, http.MethodGet, apiurl.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if err := hc.authorize(req.Header); err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	log.Debugf("requesting HTTP capture stream from %q, time limit %s", RedactURL(&apiurl), hc.opts.handshakeTimeout())
+	// Only limit the time until the capture stream response arrives, but not
+	// the capture stream itself.
+	if timeout := hc.opts.handshakeTimeout(); timeout > 0 {
+		timer := time.AfterFunc(timeout, cancel)
+		defer timer.Stop()
+	}
+	defer afterDone(ctx, cancel)()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, unreachable(err)
+	}
+	mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusOK || !acceptable(accept, mediatype) {
+		resp.Body.Close()
+		cancel()
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusBadRequest, http.StatusNotFound,
+			http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusUpgradeRequired:
+			return nil, errNoHTTPStream
+		}
+		if err := rejected(resp, t); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("capture service refused capture: %s", resp.Status)
+	}
+	log.Debugf("capture service HTTP capture stream response: %s %s %s", resp.Proto, resp.Status, mediatype)
+	body := resp.Body
+	if mediatype == CaptureEventStreamMediaType {
+		body = newEventStreamReader(body)
+	}
+	return startHTTPCaptureStream(w, body, cancel, t, opts, hc.opts.StallTimeout), nil
+}
+
+// acceptable returns true if the media type is in the comma-separated list of
+// accepted media types.
+func acceptable(accept string, mediatype string) bool {
+	for _, a := range strings.Split(accept, ",") {
+		if strings.TrimSpace(a) == mediatype {
+			return true
+		}
+	}
+	return false
+}
+
+// http2Transport returns the round tripper for HTTP/2 requests to the capture
+// service, using the specified URL scheme, creating it on first use.
+func (hc *hostsharktank) http2Transport(scheme string) http.RoundTripper {
+	if scheme == "https" {
+		return hc.httpTransport()
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.h2ctrans != nil {
+		return hc.h2ctrans
+	}
+	dial := hc.dialContext()
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	// Unencrypted HTTP/2 (h2c) with prior knowledge, so there is no upgrade
+	// dance that proxies might mishandle.
+	hc.h2ctrans = &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+	}
+	return hc.h2ctrans
+}
+
+// StartHTTPCaptureStream is a low-level function almost all csharg package
+// users WON'T use. It streams the capture data read from an HTTP response body
+// through the pcapng stream editor to the writer w. Stopping the capture calls
+// the specified cancel function, if any, and closes the response body.
+//
+// Please note that in contrast to websocket capture streams, MaxBuffer in the
+// capture options only limits the size of the initial section header block
+// buffered for editing, as HTTP capture streams lack message boundaries.
+func StartHTTPCaptureStream(w io.Writer, body io.ReadCloser, cancel context.CancelFunc, t *api.Target, opts *CaptureOptions) CaptureStreamer {
+	return startHTTPCaptureStream(w, body, cancel, t, opts, 0)
+}
+
+// startHTTPCaptureStream starts streaming the capture data read from the HTTP
+// response body, aborting the capture stream when no capture data arrives
+// within the specified stall timeout, unless zero.
+func startHTTPCaptureStream(w io.Writer, body io.ReadCloser, cancel context.CancelFunc, t *api.Target, opts *CaptureOptions, stall time.Duration) CaptureStreamer {
+	if opts == nil {
+		opts = &CaptureOptions{}
+	}
+	cs := &httpCaptureStreamer{
+		body:   body,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	sink, finish := newStreamSink(w, t, opts, cs.Stop)
+	cs.stats = NewStatsWriter(sink)
+	lifecycle := newLifecycle(t, opts, cs.stats)
+	go func() {
+		defer close(cs.done)
+		defer body.Close()
+		if cancel != nil {
+			defer cancel()
+		}
+		defer func() { lifecycle.emit(EventClosed, cs.failure.Err()) }()
+		defer finish()
+		lifecycle.emit(EventConnected, nil)
+		pcapedit := cs.stats
+		// As reading the response body cannot time out, a watchdog aborts
+		// the capture stream when it stalls.
+		var stalled atomic.Bool
+		var watchdog *time.Timer
+		if stall > 0 {
+			watchdog = time.AfterFunc(stall, func() {
+				stalled.Store(true)
+				cs.abort()
+			})
+			defer watchdog.Stop()
+		}
+		buff := make([]byte, httpStreamBufferSize)
+		for {
+			n, err := body.Read(buff)
+			if watchdog != nil && n > 0 {
+				watchdog.Reset(stall)
+			}
+			if n > 0 {
+				if _, werr := pcapedit.Write(buff[:n]); werr != nil {
+					if perr, ok := werr.(*os.PathError); ok && perr.Err == os.ErrClosed {
+						log.Errorf("capture stream writer is fed up and does not accpet any more packets.")
+					} else {
+						log.Errorf("capture stream writer failed: %s", werr.Error())
+					}
+					cs.failure.fail("write", werr)
+					return
+				}
+				lifecycle.written()
+			}
+			if err != nil {
+				if stalled.Load() {
+					log.Errorf("%s for %s, aborting capture", ErrStalled, stall)
+					lifecycle.emit(EventStalled, nil)
+					cs.failure.fail("receive", ErrStalled)
+				} else if !errors.Is(err, io.EOF) {
+					log.Debugf("HTTP packet data stream error: %s", err.Error())
+					if !cs.stopped.Load() {
+						cs.failure.fail("receive", err)
+					}
+				}
+				return
+			}
+		}
+	}()
+	return cs
+}
+
+// httpCaptureStreamer implements the CaptureStreamer interface for capture
+// streams read from HTTP response bodies.
+type httpCaptureStreamer struct {
+	body     io.ReadCloser
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	stopped  atomic.Bool // the capture has been stopped, as opposed to aborted.
+	done     chan struct{}
+	stats    *StatsWriter
+	failure  captureFailure
+}
+
+// Stop the capture and wait for it to terminate.
+func (cs *httpCaptureStreamer) Stop() {
+	cs.stopped.Store(true)
+	cs.abort()
+	<-cs.done
+}
+
+// abort the capture by cancelling the request and closing the response body,
+// without waiting for the capture to terminate.
+func (cs *httpCaptureStreamer) abort() {
+	cs.stopOnce.Do(func() {
+		if cs.cancel != nil {
+			cs.cancel()
+		}
+		cs.body.Close()
+	})
+}
+
+// Wait for the capture to terminate, without initiating it.
+func (cs *httpCaptureStreamer) Wait() {
+	<-cs.done
+}
+
+// StopAfter waits for the capture to terminate and terminates it after the
+// specified duration if necessary.
+func (cs *httpCaptureStreamer) StopAfter(d time.Duration) {
+	select {
+	case <-cs.done:
+	case <-time.After(d):
+		cs.Stop()
+	}
+}
+
+// StopAfterContext waits for the capture to terminate and terminates it after
+// the specified duration or when the context is done, whichever comes first.
+// It reports whether the capture ended by itself.
+func (cs *httpCaptureStreamer) StopAfterContext(ctx context.Context, d time.Duration) (bool, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-cs.done:
+		return true, nil
+	case <-timer.C:
+		cs.Stop()
+		return false, nil
+	case <-ctx.Done():
+		cs.Stop()
+		return false, ctx.Err()
+	}
+}
+
+// Stats returns the live statistics of the capture.
+func (cs *httpCaptureStreamer) Stats() CaptureStats {
+	return cs.stats.Stats()
+}
+
+// Err returns why the capture failed, if it failed.
+func (cs *httpCaptureStreamer) Err() error {
+	return cs.failure.Err()
+}
+
+// WaitErr waits for the capture to terminate and returns why it failed, if
+// it failed.
+func (cs *httpCaptureStreamer) WaitErr() error {
+	cs.Wait()
+	return cs.Err()
+}
+
+// StopErr stops the capture and returns why it failed before, if it failed.
+func (cs *httpCaptureStreamer) StopErr() error {
+	cs.Stop()
+	return cs.Err()
+}
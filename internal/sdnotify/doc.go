@@ -0,0 +1,9 @@
+/*
+Package sdnotify implements the systemd service notification protocol, so that
+csharg can run as a Type=notify service with watchdog support.
+
+See also: [sd_notify(3)].
+
+[sd_notify(3)]: https://www.freedesktop.org/software/systemd/man/sd_notify.html
+*/
+package sdnotify
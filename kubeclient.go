@@ -0,0 +1,115 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements the capture client to access the cluster capture service through
+// the service proxy of the Kubernetes remote API server.
+
+package csharg
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Defaults for reaching the cluster capture service.
+const (
+	// DefaultClusterService is the name of the cluster capture service.
+	DefaultClusterService = "clustershark"
+	// DefaultClusterServiceNamespace is the namespace of the cluster capture
+	// service.
+	DefaultClusterServiceNamespace = "ghostwire"
+)
+
+// SharkTankOnKubeClusterOptions specifies how to reach the cluster capture
+// service through the Kubernetes remote API server.
+type SharkTankOnKubeClusterOptions struct {
+	// Bearer token, basic authentication credentials, and Namespace take
+	// precedence over the credentials and namespace of the kubeconfig
+	// context.
+	CommonClientOptions
+	// Kubeconfig optionally specifies the kubeconfig file, or multiple files
+	// separated as in $KUBECONFIG. It defaults to $KUBECONFIG, and otherwise
+	// to "~/.kube/config". Without any kubeconfig file, the in-cluster
+	// service account configuration gets used instead.
+	Kubeconfig string
+	// Context optionally specifies the kubeconfig context to use instead of
+	// the current context.
+	Context string
+	// Service optionally specifies the cluster capture service in the form
+	// of "[https:]name[:port]", defaulting to DefaultClusterService.
+	Service string
+	// ServiceNamespace optionally specifies the namespace of the cluster
+	// capture service, defaulting to DefaultClusterServiceNamespace.
+	ServiceNamespace string
+	// Transport optionally specifies the capture stream transport, defaulting
+	// to websockets.
+	Transport CaptureTransport
+	// MaxCaptures optionally limits the number of concurrent captures,
+	// including prepared captures not yet started.
+	MaxCaptures int
+}
+
+// NewSharkTankOnKubeCluster returns a new cluster capturer object to capture
+// from the capture targets in a Kubernetes cluster, accessing the cluster
+// capture service through the service proxy of the Kubernetes remote API
+// server. The API server and the credentials are taken from the kubeconfig
+// context, or otherwise from the in-cluster service account configuration.
+// Only kubeconfig users with client certificates, (file) tokens, or basic
+// authentication credentials are supported, but not exec and auth provider
+// plugins.
+//
+// As the API server's service proxy loses the URL query parameters of
+// websocket requests, the capture target and options are additionally passed
+// in HTTP headers, see also CaptureServiceHeaders.
+func NewSharkTankOnKubeCluster(opts *SharkTankOnKubeClusterOptions) (SharkTank, error) {
+	if opts == nil {
+		opts = &SharkTankOnKubeClusterOptions{
+			CommonClientOptions: CommonClientOptions{
+				Timeout: DefaultServiceTimeout,
+			},
+		}
+	}
+	apiserver, err := loadKubeAPIServer(opts.Kubeconfig, opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	service := opts.Service
+	if service == "" {
+		service = DefaultClusterService
+	}
+	if strings.Contains(service, "/") {
+		return nil, fmt.Errorf("invalid cluster capture service %q", service)
+	}
+	namespace := opts.ServiceNamespace
+	if namespace == "" {
+		namespace = DefaultClusterServiceNamespace
+	}
+	if strings.Contains(namespace, "/") {
+		return nil, fmt.Errorf("invalid cluster capture service namespace %q", namespace)
+	}
+	proxyurl := *apiserver.URL
+	proxyurl.Path = path.Join("/", proxyurl.Path, "api/v1/namespaces", namespace, "services", service, "proxy")
+	proxyurl.RawPath = ""
+	hostopts := &SharkTankOnHostOptions{
+		CommonClientOptions: opts.CommonClientOptions,
+		TLSConfig:           apiserver.TLSConfig,
+		Proxy:               apiserver.Proxy,
+		Transport:           opts.Transport,
+		MaxCaptures:         opts.MaxCaptures,
+	}
+	if hostopts.BearerToken == "" && hostopts.Username == "" {
+		hostopts.BearerToken = apiserver.Token
+		hostopts.Username, hostopts.Password = apiserver.Username, apiserver.Password
+	}
+	if hostopts.Namespace == "" {
+		hostopts.Namespace = apiserver.Namespace
+	}
+	hc, err := newHostSharkTank(&proxyurl, hostopts)
+	if err != nil {
+		return nil, err
+	}
+	hc.cluster = true
+	return hc, nil
+}
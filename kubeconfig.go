@@ -0,0 +1,298 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements loading the Kubernetes API server connection details from
+// kubeconfig files, or otherwise from the in-cluster service account
+// configuration, without depending on the Kubernetes client packages.
+
+package csharg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Location of the in-cluster service account configuration.
+const (
+	inClusterTokenFile     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// kubeConfig is the (relevant part of the) kubeconfig file format.
+type kubeConfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string      `yaml:"name"`
+		Cluster kubeCluster `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string      `yaml:"name"`
+		Context kubeContext `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User kubeUser `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeCluster describes how to reach a Kubernetes API server.
+type kubeCluster struct {
+	Server                   string `yaml:"server"`
+	TLSServerName            string `yaml:"tls-server-name"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+	CertificateAuthority     string `yaml:"certificate-authority"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	ProxyURL                 string `yaml:"proxy-url"`
+}
+
+// kubeContext references a cluster and user, with an optional default
+// namespace.
+type kubeContext struct {
+	Cluster   string `yaml:"cluster"`
+	User      string `yaml:"user"`
+	Namespace string `yaml:"namespace"`
+}
+
+// kubeUser describes how to authenticate to a Kubernetes API server.
+type kubeUser struct {
+	ClientCertificate     string      `yaml:"client-certificate"`
+	ClientCertificateData string      `yaml:"client-certificate-data"`
+	ClientKey             string      `yaml:"client-key"`
+	ClientKeyData         string      `yaml:"client-key-data"`
+	Token                 string      `yaml:"token"`
+	TokenFile             string      `yaml:"tokenFile"`
+	Username              string      `yaml:"username"`
+	Password              string      `yaml:"password"`
+	Exec                  interface{} `yaml:"exec"`
+	AuthProvider          interface{} `yaml:"auth-provider"`
+}
+
+// kubeAPIServer describes how to connect to and authenticate with a Kubernetes
+// API server.
+type kubeAPIServer struct {
+	URL       *url.URL
+	TLSConfig *tls.Config
+	Proxy     *ProxyOptions
+	Token     string
+	Username  string
+	Password  string
+	Namespace string // default namespace of the context, if any.
+}
+
+// loadKubeAPIServer returns the API server connection details of the specified
+// kubeconfig context, or the current context if empty. The kubeconfig files
+// default to $KUBECONFIG, and otherwise "~/.kube/config". When there are no
+// kubeconfig files at all, the in-cluster service account configuration gets
+// used instead.
+func loadKubeAPIServer(kubeconfig string, context string) (*kubeAPIServer, error) {
+	explicit := kubeconfig != ""
+	if !explicit {
+		kubeconfig = os.Getenv("KUBECONFIG")
+	}
+	if kubeconfig == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			kubeconfig = filepath.Join(home, ".kube", "config")
+		}
+	}
+	var paths []string
+	for _, path := range filepath.SplitList(kubeconfig) {
+		if _, err := os.Stat(path); err == nil || explicit {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		if context != "" {
+			return nil, fmt.Errorf("no kubeconfig with context %q", context)
+		}
+		return inClusterAPIServer()
+	}
+	return kubeconfigAPIServer(paths, context)
+}
+
+// kubeconfigAPIServer returns the API server connection details of the
+// specified context in the kubeconfig files. As with kubectl, the first
+// definition of a current context, cluster, context, or user wins.
+func kubeconfigAPIServer(paths []string, context string) (*kubeAPIServer, error) {
+	current := ""
+	clusters := map[string]kubeCluster{}
+	contexts := map[string]kubeContext{}
+	users := map[string]kubeUser{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read kubeconfig: %w", err)
+		}
+		var config kubeConfig
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig %s: %w", path, err)
+		}
+		if current == "" {
+			current = config.CurrentContext
+		}
+		// Relative file references are relative to their kubeconfig file.
+		dir := filepath.Dir(path)
+		for _, c := range config.Clusters {
+			if _, ok := clusters[c.Name]; !ok {
+				c.Cluster.CertificateAuthority = kubePath(dir, c.Cluster.CertificateAuthority)
+				clusters[c.Name] = c.Cluster
+			}
+		}
+		for _, c := range config.Contexts {
+			if _, ok := contexts[c.Name]; !ok {
+				contexts[c.Name] = c.Context
+			}
+		}
+		for _, u := range config.Users {
+			if _, ok := users[u.Name]; !ok {
+				u.User.ClientCertificate = kubePath(dir, u.User.ClientCertificate)
+				u.User.ClientKey = kubePath(dir, u.User.ClientKey)
+				u.User.TokenFile = kubePath(dir, u.User.TokenFile)
+				users[u.Name] = u.User
+			}
+		}
+	}
+	if context == "" {
+		context = current
+	}
+	if context == "" {
+		return nil, errors.New("no current kubeconfig context")
+	}
+	kctx, ok := contexts[context]
+	if !ok {
+		return nil, fmt.Errorf("no kubeconfig context %q", context)
+	}
+	cluster, ok := clusters[kctx.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("no kubeconfig cluster %q for context %q", kctx.Cluster, context)
+	}
+	user := users[kctx.User]
+	if user.Exec != nil || user.AuthProvider != nil {
+		return nil, fmt.Errorf("unsupported exec or auth-provider authentication of kubeconfig user %q", kctx.User)
+	}
+	apiserver, err := url.Parse(cluster.Server)
+	if err != nil || apiserver.Host == "" {
+		return nil, fmt.Errorf("invalid API server %q of kubeconfig cluster %q", cluster.Server, kctx.Cluster)
+	}
+	k := &kubeAPIServer{
+		URL:       apiserver,
+		Token:     user.Token,
+		Username:  user.Username,
+		Password:  user.Password,
+		Namespace: kctx.Namespace,
+	}
+	if k.Token == "" && user.TokenFile != "" {
+		token, err := os.ReadFile(user.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read token of kubeconfig user %q: %w", kctx.User, err)
+		}
+		k.Token = strings.TrimSpace(string(token))
+	}
+	if cluster.ProxyURL != "" {
+		proxy, err := url.Parse(cluster.ProxyURL)
+		if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https") {
+			return nil, fmt.Errorf("unsupported proxy-url %q of kubeconfig cluster %q", cluster.ProxyURL, kctx.Cluster)
+		}
+		k.Proxy = &ProxyOptions{URL: proxy}
+	}
+	k.TLSConfig = &tls.Config{
+		ServerName:         cluster.TLSServerName,
+		InsecureSkipVerify: cluster.InsecureSkipTLSVerify,
+	}
+	ca, err := kubeData(cluster.CertificateAuthorityData, cluster.CertificateAuthority)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate authority of kubeconfig cluster %q: %w", kctx.Cluster, err)
+	}
+	if ca != nil {
+		if k.TLSConfig.RootCAs, err = certPool(ca); err != nil {
+			return nil, fmt.Errorf("invalid certificate authority of kubeconfig cluster %q: %w", kctx.Cluster, err)
+		}
+	}
+	cert, err := kubeData(user.ClientCertificateData, user.ClientCertificate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate of kubeconfig user %q: %w", kctx.User, err)
+	}
+	key, err := kubeData(user.ClientKeyData, user.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client key of kubeconfig user %q: %w", kctx.User, err)
+	}
+	if cert != nil || key != nil {
+		keypair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate of kubeconfig user %q: %w", kctx.User, err)
+		}
+		k.TLSConfig.Certificates = []tls.Certificate{keypair}
+	}
+	return k, nil
+}
+
+// inClusterAPIServer returns the API server connection details from the
+// in-cluster service account configuration of pods.
+func inClusterAPIServer() (*kubeAPIServer, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("neither kubeconfig nor in-cluster configuration found")
+	}
+	token, err := os.ReadFile(inClusterTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read in-cluster service account token: %w", err)
+	}
+	ca, err := os.ReadFile(inClusterCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read in-cluster certificate authority: %w", err)
+	}
+	roots, err := certPool(ca)
+	if err != nil {
+		return nil, fmt.Errorf("invalid in-cluster certificate authority: %w", err)
+	}
+	k := &kubeAPIServer{
+		URL:       &url.URL{Scheme: "https", Host: net.JoinHostPort(host, port)},
+		TLSConfig: &tls.Config{RootCAs: roots},
+		Token:     strings.TrimSpace(string(token)),
+	}
+	if namespace, err := os.ReadFile(inClusterNamespaceFile); err == nil {
+		k.Namespace = strings.TrimSpace(string(namespace))
+	}
+	return k, nil
+}
+
+// kubePath returns the path relative to the kubeconfig directory, unless
+// absolute or empty.
+func kubePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// kubeData returns the base64-decoded inline data, or otherwise the contents
+// of the referenced file, or nil if neither has been specified.
+func kubeData(data, path string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return nil, nil
+}
+
+// certPool returns a new certificate pool with the PEM-encoded certificates.
+func certPool(pem []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no PEM certificates")
+	}
+	return pool, nil
+}
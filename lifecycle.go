@@ -0,0 +1,109 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"time"
+
+	"github.com/siemens/csharg/api"
+)
+
+// EventKind identifies the kind of a lifecycle event of a capture.
+type EventKind int
+
+// Kinds of lifecycle events of captures.
+const (
+	// EventConnected signals that the capture stream from the capture service
+	// has been established, including after reconnecting.
+	EventConnected EventKind = iota
+	// EventFirstPacket signals that the first network packet of the capture
+	// has arrived.
+	EventFirstPacket
+	// EventStalled signals that no capture data arrived within the stall
+	// timeout of the client options. The capture stream then either gets
+	// reconnected or the capture gets closed.
+	EventStalled
+	// EventReconnecting signals that the capture stream broke or stalled and
+	// is about to be reconnected, with Err telling why.
+	EventReconnecting
+	// EventClosed signals that the capture has ended, with Err telling why
+	// it failed, if it failed (see also CaptureStreamer.Err). It is the last
+	// event of a capture.
+	EventClosed
+)
+
+// String returns the name of the lifecycle event kind.
+func (k EventKind) String() string {
+	switch k {
+	case EventConnected:
+		return "connected"
+	case EventFirstPacket:
+		return "first packet"
+	case EventStalled:
+		return "stalled"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// LifecycleEvent describes a lifecycle event of a capture, such as for
+// driving the state of user interfaces.
+type LifecycleEvent struct {
+	Kind EventKind
+	// The capture target the event is about.
+	Target *api.Target
+	// When the event happened.
+	Time time.Time
+	// Why the capture stream is reconnecting, or why the capture failed when
+	// closed; otherwise nil.
+	Err error
+}
+
+// lifecycle emits the lifecycle events of a capture, if asked for in the
+// capture options. It must only be used by the goroutine streaming the
+// capture data.
+type lifecycle struct {
+	target      *api.Target
+	events      func(LifecycleEvent)
+	stats       *StatsWriter
+	firstPacket bool // the first packet has arrived.
+}
+
+// newLifecycle returns a new lifecycle for a capture from the specified
+// capture target, using the capture statistics to tell when the first packet
+// arrives.
+func newLifecycle(t *api.Target, opts *CaptureOptions, stats *StatsWriter) *lifecycle {
+	return &lifecycle{
+		target: t,
+		events: opts.Events,
+		stats:  stats,
+	}
+}
+
+// emit a lifecycle event of the specified kind, if asked for.
+func (l *lifecycle) emit(kind EventKind, err error) {
+	if l.events == nil {
+		return
+	}
+	l.events(LifecycleEvent{
+		Kind:   kind,
+		Target: l.target,
+		Time:   time.Now(),
+		Err:    err,
+	})
+}
+
+// written emits the first packet event after capture data has been written
+// that contained the first packet.
+func (l *lifecycle) written() {
+	if l.events == nil || l.firstPacket || l.stats.Stats().Packets == 0 {
+		return
+	}
+	l.firstPacket = true
+	l.emit(EventFirstPacket, nil)
+}
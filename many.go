@@ -0,0 +1,188 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+)
+
+// captureMany prepares captures from all the specified capture targets and
+// then starts them at the same instant, multiplexing their packet capture
+// streams into a single section written to w. If any capture cannot be
+// prepared or started, the other captures get cancelled or stopped. A packet
+// limit applies to the multiplexed packet capture stream, stopping all
+// captures together.
+func captureMany(st SharkTank, w io.Writer, targets []*api.Target, opts *CaptureOptions) (CaptureStreamer, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no capture targets specified")
+	}
+	mcs := &multiCaptureStreamer{
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if opts != nil && opts.MaxPackets > 0 {
+		limit := opts.MaxPackets
+		w = pcapng.NewPacketLimitWriter(w, limit, func() {
+			log.Infof("capture reached packet limit of %d, stopping captures", limit)
+			go func() {
+				<-mcs.started
+				mcs.Stop()
+			}()
+		})
+		perTarget := *opts
+		perTarget.MaxPackets = 0
+		opts = &perTarget
+	}
+	mux := pcapng.NewMultiplexer(w, len(targets))
+	pcs := make([]PreparedCapture, 0, len(targets))
+	for idx, t := range targets {
+		pc, err := st.PrepareContext(context.Background(), mux.Input(idx), t, opts)
+		if err != nil {
+			for _, pc := range pcs {
+				pc.Cancel()
+			}
+			return nil, fmt.Errorf("cannot capture from %q: %w", t.QualifiedName(), err)
+		}
+		pcs = append(pcs, pc)
+	}
+	for idx, pc := range pcs {
+		cs, err := pc.Start()
+		if err != nil {
+			for _, pc := range pcs[idx+1:] {
+				pc.Cancel()
+			}
+			mcs.stop()
+			close(mcs.started)
+			close(mcs.done)
+			return nil, fmt.Errorf("cannot capture from %q: %w", targets[idx].QualifiedName(), err)
+		}
+		mcs.css = append(mcs.css, cs)
+	}
+	close(mcs.started)
+	go mcs.follow(mux)
+	return mcs, nil
+}
+
+// multiCaptureStreamer is a capture from multiple capture targets, ending
+// after the captures from all targets ended.
+type multiCaptureStreamer struct {
+	css     []CaptureStreamer
+	started chan struct{} // closed after all captures have been started.
+	done    chan struct{} // closed after all captures ended.
+}
+
+// follow the captures until they all ended, closing their multiplexer inputs
+// as they end.
+func (mcs *multiCaptureStreamer) follow(mux *pcapng.Multiplexer) {
+	defer close(mcs.done)
+	var wg sync.WaitGroup
+	for idx, cs := range mcs.css {
+		wg.Add(1)
+		go func(idx int, cs CaptureStreamer) {
+			defer wg.Done()
+			cs.Wait()
+			if err := mux.Input(idx).Close(); err != nil {
+				log.Warnf("incomplete packet capture stream: %s", err.Error())
+			}
+		}(idx, cs)
+	}
+	wg.Wait()
+}
+
+// stop all captures at the same time, waiting for them to terminate.
+func (mcs *multiCaptureStreamer) stop() {
+	var wg sync.WaitGroup
+	for _, cs := range mcs.css {
+		wg.Add(1)
+		go func(cs CaptureStreamer) {
+			defer wg.Done()
+			cs.Stop()
+		}(cs)
+	}
+	wg.Wait()
+}
+
+// Stop all captures in an orderly manner, waiting for them to terminate.
+func (mcs *multiCaptureStreamer) Stop() {
+	mcs.stop()
+	<-mcs.done
+}
+
+// Wait for all captures to terminate, without initiating the termination.
+func (mcs *multiCaptureStreamer) Wait() {
+	<-mcs.done
+}
+
+// StopAfter waits for all captures to terminate and terminates them after the
+// specified duration if necessary.
+func (mcs *multiCaptureStreamer) StopAfter(d time.Duration) {
+	select {
+	case <-mcs.done:
+	case <-time.After(d):
+		mcs.Stop()
+	}
+}
+
+// StopAfterContext waits for all captures to terminate and terminates them
+// after the specified duration or when the context is done, whichever comes
+// first. It reports whether the captures ended by themselves.
+func (mcs *multiCaptureStreamer) StopAfterContext(ctx context.Context, d time.Duration) (bool, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-mcs.done:
+		return true, nil
+	case <-timer.C:
+		mcs.Stop()
+		return false, nil
+	case <-ctx.Done():
+		mcs.Stop()
+		return false, ctx.Err()
+	}
+}
+
+// Err returns why any of the captures failed, joining the failures of
+// multiple captures, or nil if none failed.
+func (mcs *multiCaptureStreamer) Err() error {
+	var errs []error
+	for _, cs := range mcs.css {
+		if err := cs.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WaitErr waits for all captures to terminate and returns why any of them
+// failed, if any failed.
+func (mcs *multiCaptureStreamer) WaitErr() error {
+	mcs.Wait()
+	return mcs.Err()
+}
+
+// StopErr stops all captures and returns why any of them failed before, if
+// any failed.
+func (mcs *multiCaptureStreamer) StopErr() error {
+	mcs.Stop()
+	return mcs.Err()
+}
+
+// Stats returns the live statistics of all captures combined.
+func (mcs *multiCaptureStreamer) Stats() CaptureStats {
+	var stats CaptureStats
+	for _, cs := range mcs.css {
+		stats.add(cs.Stats())
+	}
+	return stats
+}
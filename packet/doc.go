@@ -0,0 +1,6 @@
+/*
+Package packet decodes the link, network and transport layer headers of
+captured packets just enough to identify the communicating endpoints and
+protocols, such as for statistics, flow tracking, and packet summaries.
+*/
+package packet
@@ -0,0 +1,314 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package packet
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/pcapng"
+)
+
+// Flow tracker defaults.
+const (
+	DefaultFlowIdleTimeout = 2 * time.Minute
+	DefaultMaxFlows        = 10000
+	DefaultRecentFlows     = 100
+)
+
+// TCP flags ending a flow.
+const (
+	tcpFIN = uint8(0x01)
+	tcpRST = uint8(0x04)
+)
+
+// flowSweepInterval is the minimum (packet) time between checking for idle
+// flows.
+const flowSweepInterval = time.Second
+
+// FlowKey identifies a unidirectional flow by its network and transport layer
+// endpoints, as well as its transport protocol. The ports are zero for
+// transport protocols without ports.
+type FlowKey struct {
+	Proto            uint8
+	Src, Dst         netip.Addr
+	SrcPort, DstPort uint16
+}
+
+// Flow is a tracked flow with its packet and octet counts.
+type Flow struct {
+	FlowKey
+	Transport string    // name of the transport protocol, such as "TCP".
+	Packets   int64     // number of packets.
+	Octets    int64     // number of octets, as originally on the wire.
+	First     time.Time // timestamp of the first packet.
+	Last      time.Time // timestamp of the latest packet.
+}
+
+// String returns the flow in the form of "TCP 10.0.0.1:1234 > 10.0.0.2:80".
+func (f *Flow) String() string {
+	if f.SrcPort == 0 && f.DstPort == 0 {
+		return fmt.Sprintf("%s %s > %s", f.Transport, f.Src, f.Dst)
+	}
+	return fmt.Sprintf("%s %s > %s", f.Transport,
+		netip.AddrPortFrom(f.Src, f.SrcPort), netip.AddrPortFrom(f.Dst, f.DstPort))
+}
+
+// Talker is a network address with the packets and octets it sent and
+// received.
+type Talker struct {
+	Addr    netip.Addr
+	Packets int64
+	Octets  int64
+}
+
+// FlowSummary summarizes the flows tracked so far.
+type FlowSummary struct {
+	Packets int64    // overall number of packets, including non-IP packets.
+	Octets  int64    // overall number of octets.
+	Flows   []Flow   // active flows, busiest first.
+	Recent  []Flow   // recently ended flows, most recently ended first.
+	Talkers []Talker // top talkers, busiest first.
+}
+
+// FlowTrackerOptions defines options for tracking flows.
+type FlowTrackerOptions struct {
+	// IdleTimeout ends flows without packets for this (packet) time, defaulting
+	// to DefaultFlowIdleTimeout.
+	IdleTimeout time.Duration
+	// MaxFlows limits the number of active flows, ending the least recently
+	// active flows when exceeded, defaulting to DefaultMaxFlows.
+	MaxFlows int
+	// RecentFlows is the number of recently ended flows to keep, defaulting to
+	// DefaultRecentFlows.
+	RecentFlows int
+}
+
+// FlowTracker tracks the flows and top talkers of a pcapng stream written to
+// it, so it can run alongside or instead of writing the stream to a file.
+// Flows end when they become idle or, for TCP, when sending a FIN or RST;
+// ended flows are kept in a ring of recent flows. A FlowTracker is safe for
+// concurrent use.
+//
+// Writing to a FlowTracker never fails, so that it doesn't break captures.
+// Instead, when the pcapng stream turns out to be malformed, the FlowTracker
+// stops tracking and Err reports why.
+type FlowTracker struct {
+	opts FlowTrackerOptions
+
+	mu      sync.Mutex
+	scanner *pcapng.Scanner
+	err     error
+	packets int64
+	octets  int64
+	flows   map[FlowKey]*Flow
+	recent  []Flow // ring of recently ended flows.
+	next    int    // next slot in the recent ring.
+	talkers map[netip.Addr]*Talker
+	latest  time.Time
+	swept   time.Time
+}
+
+var _ io.WriteCloser = (*FlowTracker)(nil)
+
+// NewFlowTracker returns a new FlowTracker.
+func NewFlowTracker(opts *FlowTrackerOptions) *FlowTracker {
+	t := &FlowTracker{
+		flows:   map[FlowKey]*Flow{},
+		talkers: map[netip.Addr]*Talker{},
+	}
+	if opts != nil {
+		t.opts = *opts
+	}
+	if t.opts.IdleTimeout <= 0 {
+		t.opts.IdleTimeout = DefaultFlowIdleTimeout
+	}
+	if t.opts.MaxFlows <= 0 {
+		t.opts.MaxFlows = DefaultMaxFlows
+	}
+	if t.opts.RecentFlows <= 0 {
+		t.opts.RecentFlows = DefaultRecentFlows
+	}
+	t.recent = make([]Flow, 0, t.opts.RecentFlows)
+	t.scanner = pcapng.NewScanner(t.block)
+	return t
+}
+
+// Write tracks the packets in the octets of the pcapng stream.
+func (t *FlowTracker) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		if _, err := t.scanner.Write(p); err != nil {
+			t.err = err
+		}
+	}
+	return len(p), nil
+}
+
+// Close signals the end of the pcapng stream. The tracked flows can still be
+// summarized afterwards.
+func (t *FlowTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = t.scanner.Close()
+	}
+	return nil
+}
+
+// Err returns the error that stopped tracking, if any.
+func (t *FlowTracker) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// block tracks an enhanced packet block. Callers must hold the lock.
+func (t *FlowTracker) block(b *pcapng.Block) error {
+	if b.Type != pcapng.BlockEPB {
+		return nil
+	}
+	epb, err := b.EnhancedPacket()
+	if err != nil {
+		return nil
+	}
+	idb := t.scanner.Interface(epb.InterfaceID)
+	if idb == nil {
+		return nil
+	}
+	octets := int64(epb.OriginalLength)
+	t.packets++
+	t.octets += octets
+	ts := idb.Time(epb.Timestamp)
+	if ts.After(t.latest) {
+		t.latest = ts
+	}
+	if t.latest.Sub(t.swept) >= flowSweepInterval {
+		t.sweep()
+	}
+	summary, ok := Decode(idb.LinkType, epb.Data)
+	if !ok || !summary.Src.IsValid() {
+		return nil
+	}
+	t.talk(summary.Src, octets)
+	t.talk(summary.Dst, octets)
+	key := FlowKey{Proto: summary.Proto, Src: summary.Src, Dst: summary.Dst}
+	if summary.HasPorts() {
+		key.SrcPort, key.DstPort = summary.SrcPort, summary.DstPort
+	}
+	flow, ok := t.flows[key]
+	if !ok {
+		if len(t.flows) >= t.opts.MaxFlows {
+			t.evict()
+		}
+		flow = &Flow{FlowKey: key, Transport: summary.Transport(), First: ts}
+		t.flows[key] = flow
+	}
+	flow.Packets++
+	flow.Octets += octets
+	if ts.After(flow.Last) {
+		flow.Last = ts
+	}
+	if summary.Proto == ProtoTCP && summary.TCPFlags&(tcpFIN|tcpRST) != 0 {
+		t.end(flow)
+	}
+	return nil
+}
+
+// talk counts a packet sent or received by the specified address.
+func (t *FlowTracker) talk(addr netip.Addr, octets int64) {
+	talker, ok := t.talkers[addr]
+	if !ok {
+		talker = &Talker{Addr: addr}
+		t.talkers[addr] = talker
+	}
+	talker.Packets++
+	talker.Octets += octets
+}
+
+// sweep ends the idle flows.
+func (t *FlowTracker) sweep() {
+	t.swept = t.latest
+	idle := t.latest.Add(-t.opts.IdleTimeout)
+	for _, flow := range t.flows {
+		if flow.Last.Before(idle) {
+			t.end(flow)
+		}
+	}
+}
+
+// evict ends the least recently active flow.
+func (t *FlowTracker) evict() {
+	var oldest *Flow
+	for _, flow := range t.flows {
+		if oldest == nil || flow.Last.Before(oldest.Last) {
+			oldest = flow
+		}
+	}
+	if oldest != nil {
+		t.end(oldest)
+	}
+}
+
+// end ends the flow, moving it into the ring of recent flows.
+func (t *FlowTracker) end(flow *Flow) {
+	delete(t.flows, flow.FlowKey)
+	if len(t.recent) < cap(t.recent) {
+		t.recent = append(t.recent, *flow)
+	} else {
+		t.recent[t.next] = *flow
+	}
+	t.next = (t.next + 1) % cap(t.recent)
+}
+
+// Summary returns the overall counts, as well as the specified number of
+// busiest active flows and top talkers, together with the recently ended
+// flows. A zero or negative top returns all active flows and talkers.
+func (t *FlowTracker) Summary(top int) FlowSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := FlowSummary{
+		Packets: t.packets,
+		Octets:  t.octets,
+		Flows:   make([]Flow, 0, len(t.flows)),
+		Recent:  make([]Flow, 0, len(t.recent)),
+		Talkers: make([]Talker, 0, len(t.talkers)),
+	}
+	for _, flow := range t.flows {
+		s.Flows = append(s.Flows, *flow)
+	}
+	sort.Slice(s.Flows, func(a, b int) bool {
+		if s.Flows[a].Octets != s.Flows[b].Octets {
+			return s.Flows[a].Octets > s.Flows[b].Octets
+		}
+		return s.Flows[a].First.Before(s.Flows[b].First)
+	})
+	for idx := 1; idx <= len(t.recent); idx++ {
+		s.Recent = append(s.Recent, t.recent[(t.next-idx+cap(t.recent))%cap(t.recent)])
+	}
+	for _, talker := range t.talkers {
+		s.Talkers = append(s.Talkers, *talker)
+	}
+	sort.Slice(s.Talkers, func(a, b int) bool {
+		if s.Talkers[a].Octets != s.Talkers[b].Octets {
+			return s.Talkers[a].Octets > s.Talkers[b].Octets
+		}
+		return s.Talkers[a].Addr.Less(s.Talkers[b].Addr)
+	})
+	if top > 0 {
+		if len(s.Flows) > top {
+			s.Flows = s.Flows[:top]
+		}
+		if len(s.Talkers) > top {
+			s.Talkers = s.Talkers[:top]
+		}
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package packet
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	"github.com/siemens/csharg/pcapng/pcapngtest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// ipv4 returns an Ethernet frame with an IPv4 packet of the specified
+// transport protocol between the specified endpoints, with a transport header
+// carrying the ports and, for TCP, the flags.
+func ipv4(proto uint8, src, dst string, sport, dport uint16, flags uint8) []byte {
+	frame := make([]byte, 14+20+20)
+	binary.BigEndian.PutUint16(frame[12:14], EtherTypeIPv4)
+	ip := frame[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(len(ip)))
+	ip[9] = proto
+	s, d := netip.MustParseAddr(src).As4(), netip.MustParseAddr(dst).As4()
+	copy(ip[12:16], s[:])
+	copy(ip[16:20], d[:])
+	l4 := ip[20:]
+	binary.BigEndian.PutUint16(l4[0:2], sport)
+	binary.BigEndian.PutUint16(l4[2:4], dport)
+	l4[12] = 5 << 4
+	l4[13] = flags
+	return frame
+}
+
+var _ = Describe("flow tracking", func() {
+
+	const second = uint64(time.Second / time.Microsecond)
+
+	It("aggregates flows and top talkers", func() {
+		b := pcapngtest.New(binary.LittleEndian).SHB().IDB(1)
+		b.EPB(0, 1*second, ipv4(ProtoTCP, "10.0.0.1", "10.0.0.2", 1234, 80, 0))
+		b.EPB(0, 2*second, ipv4(ProtoTCP, "10.0.0.1", "10.0.0.2", 1234, 80, 0))
+		b.EPB(0, 3*second, ipv4(ProtoUDP, "10.0.0.3", "10.0.0.2", 53, 5353, 0))
+		b.EPB(0, 3*second, []byte{0}) // not decodable.
+		t := NewFlowTracker(nil)
+		for _, chunk := range pcapngtest.Chunk(b.Bytes(), 11) {
+			Expect(t.Write(chunk)).To(Equal(len(chunk)))
+		}
+		Expect(t.Close()).To(Succeed())
+		Expect(t.Err()).NotTo(HaveOccurred())
+
+		s := t.Summary(0)
+		Expect(s.Packets).To(Equal(int64(4)))
+		Expect(s.Octets).To(Equal(int64(3*54 + 1)))
+		Expect(s.Flows).To(HaveLen(2))
+		Expect(s.Flows[0].String()).To(Equal("TCP 10.0.0.1:1234 > 10.0.0.2:80"))
+		Expect(s.Flows[0].Packets).To(Equal(int64(2)))
+		Expect(s.Flows[0].Octets).To(Equal(int64(2 * 54)))
+		Expect(s.Flows[0].Last.Sub(s.Flows[0].First)).To(Equal(time.Second))
+		Expect(s.Flows[1].String()).To(Equal("UDP 10.0.0.3:53 > 10.0.0.2:5353"))
+		Expect(s.Recent).To(BeEmpty())
+
+		Expect(s.Talkers).To(HaveLen(3))
+		Expect(s.Talkers[0].Addr).To(Equal(netip.MustParseAddr("10.0.0.2")))
+		Expect(s.Talkers[0].Packets).To(Equal(int64(3)))
+		Expect(s.Talkers[1].Addr).To(Equal(netip.MustParseAddr("10.0.0.1")))
+
+		s = t.Summary(1)
+		Expect(s.Flows).To(HaveLen(1))
+		Expect(s.Talkers).To(HaveLen(1))
+	})
+
+	It("ends flows and keeps the recently ended flows", func() {
+		b := pcapngtest.New(binary.BigEndian).SHB().IDB(1)
+		b.EPB(0, 1*second, ipv4(ProtoTCP, "10.0.0.1", "10.0.0.2", 1, 80, tcpFIN))
+		b.EPB(0, 2*second, ipv4(ProtoTCP, "10.0.0.1", "10.0.0.2", 2, 80, 0))
+		b.EPB(0, 3*second, ipv4(ProtoTCP, "10.0.0.1", "10.0.0.2", 3, 80, 0))
+		b.EPB(0, 4*second, ipv4(ProtoTCP, "10.0.0.1", "10.0.0.2", 4, 80, 0))
+		b.EPB(0, 14*second, ipv4(ProtoTCP, "10.0.0.1", "10.0.0.2", 4, 80, 0))
+		t := NewFlowTracker(&FlowTrackerOptions{
+			IdleTimeout: 10 * time.Second,
+			MaxFlows:    2,
+			RecentFlows: 2,
+		})
+		Expect(t.Write(b.Bytes())).Error().NotTo(HaveOccurred())
+
+		s := t.Summary(0)
+		Expect(s.Flows).To(HaveLen(1))
+		Expect(s.Flows[0].SrcPort).To(Equal(uint16(4)))
+		Expect(s.Flows[0].Packets).To(Equal(int64(2)))
+		// Port 1 ended by FIN, port 2 evicted, port 3 idle.
+		Expect(s.Recent).To(HaveLen(2))
+		Expect(s.Recent[0].SrcPort).To(Equal(uint16(3)))
+		Expect(s.Recent[1].SrcPort).To(Equal(uint16(2)))
+	})
+
+	It("stops tracking malformed streams without failing", func() {
+		t := NewFlowTracker(nil)
+		Expect(t.Write([]byte("garbage, not pcapng"))).To(Equal(19))
+		Expect(t.Err()).To(HaveOccurred())
+		Expect(t.Write([]byte{0})).To(Equal(1))
+	})
+
+})
@@ -0,0 +1,17 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPacket(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Csharg packet package suite")
+}
@@ -0,0 +1,273 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"github.com/siemens/csharg/pcapng"
+)
+
+// Ether types of interest.
+const (
+	EtherTypeIPv4 = uint16(0x0800)
+	EtherTypeARP  = uint16(0x0806)
+	EtherTypeIPv6 = uint16(0x86dd)
+	EtherTypeVLAN = uint16(0x8100)
+	EtherTypeQinQ = uint16(0x88a8)
+)
+
+// IP protocol numbers of interest.
+const (
+	ProtoICMP   = uint8(1)
+	ProtoIGMP   = uint8(2)
+	ProtoTCP    = uint8(6)
+	ProtoUDP    = uint8(17)
+	ProtoICMPv6 = uint8(58)
+	ProtoSCTP   = uint8(132)
+)
+
+// Summary describes a decoded packet in terms of its network and transport
+// layer endpoints.
+type Summary struct {
+	EtherType       uint16     // network layer protocol, such as EtherTypeIPv4.
+	Src, Dst        netip.Addr // network layer addresses, if IPv4 or IPv6.
+	Proto           uint8      // transport protocol number, if IPv4 or IPv6.
+	SrcPort         uint16     // transport source port, if TCP, UDP or SCTP.
+	DstPort         uint16     // transport destination port, if TCP, UDP or SCTP.
+	TCPFlags        uint8      // TCP flags, if TCP.
+	NetworkOffset   int        // offset of the network layer header in the packet data.
+	TransportOffset int        // offset of the transport layer header, or 0 if none.
+	PayloadOffset   int        // offset of the transport layer payload, or 0 if none.
+	Length          int        // length of the network layer packet (as captured).
+}
+
+// Network returns the name of the network layer protocol.
+func (s *Summary) Network() string {
+	switch s.EtherType {
+	case EtherTypeIPv4:
+		return "IPv4"
+	case EtherTypeIPv6:
+		return "IPv6"
+	case EtherTypeARP:
+		return "ARP"
+	}
+	return fmt.Sprintf("0x%04x", s.EtherType)
+}
+
+// Transport returns the name of the transport layer protocol, or the network
+// layer protocol if there is no transport layer protocol.
+func (s *Summary) Transport() string {
+	if s.EtherType != EtherTypeIPv4 && s.EtherType != EtherTypeIPv6 {
+		return s.Network()
+	}
+	switch s.Proto {
+	case ProtoICMP:
+		return "ICMP"
+	case ProtoIGMP:
+		return "IGMP"
+	case ProtoTCP:
+		return "TCP"
+	case ProtoUDP:
+		return "UDP"
+	case ProtoICMPv6:
+		return "ICMPv6"
+	case ProtoSCTP:
+		return "SCTP"
+	}
+	return fmt.Sprintf("IP proto %d", s.Proto)
+}
+
+// HasPorts returns true if the transport layer protocol uses ports.
+func (s *Summary) HasPorts() bool {
+	return s.TransportOffset != 0 &&
+		(s.Proto == ProtoTCP || s.Proto == ProtoUDP || s.Proto == ProtoSCTP)
+}
+
+// String returns a one-line summary of the packet, such as "TCP
+// 10.0.0.1:1234 > 10.0.0.2:80".
+func (s *Summary) String() string {
+	if !s.Src.IsValid() {
+		return s.Network()
+	}
+	if s.HasPorts() {
+		return fmt.Sprintf("%s %s > %s", s.Transport(),
+			netip.AddrPortFrom(s.Src, s.SrcPort), netip.AddrPortFrom(s.Dst, s.DstPort))
+	}
+	return fmt.Sprintf("%s %s > %s", s.Transport(), s.Src, s.Dst)
+}
+
+// Decode decodes the packet data of the specified link type, returning a
+// summary of the packet and true. If the link type is unsupported or the
+// packet is too short to decode even the network layer protocol, then false
+// is returned instead.
+func Decode(linktype uint16, data []byte) (s Summary, ok bool) {
+	var offset int
+	switch linktype {
+	case pcapng.LinkTypeEthernet:
+		if len(data) < 14 {
+			return s, false
+		}
+		s.EtherType = binary.BigEndian.Uint16(data[12:14])
+		offset = 14
+		for (s.EtherType == EtherTypeVLAN || s.EtherType == EtherTypeQinQ) && len(data) >= offset+4 {
+			s.EtherType = binary.BigEndian.Uint16(data[offset+2 : offset+4])
+			offset += 4
+		}
+	case pcapng.LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return s, false
+		}
+		s.EtherType = binary.BigEndian.Uint16(data[14:16])
+		offset = 16
+	case pcapng.LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return s, false
+		}
+		s.EtherType = binary.BigEndian.Uint16(data[0:2])
+		offset = 20
+	case pcapng.LinkTypeNull:
+		if len(data) < 4 {
+			return s, false
+		}
+		// The address family is in host byte order of the capturing
+		// machine, so we need to check both byte orders.
+		family := binary.LittleEndian.Uint32(data[0:4])
+		if family > 0xffff {
+			family = binary.BigEndian.Uint32(data[0:4])
+		}
+		switch family {
+		case 2:
+			s.EtherType = EtherTypeIPv4
+		case 10, 24, 28, 30:
+			s.EtherType = EtherTypeIPv6
+		default:
+			return s, false
+		}
+		offset = 4
+	case pcapng.LinkTypeRaw, pcapng.LinkTypeIPv4, pcapng.LinkTypeIPv6:
+		if len(data) < 1 {
+			return s, false
+		}
+		switch data[0] >> 4 {
+		case 4:
+			s.EtherType = EtherTypeIPv4
+		case 6:
+			s.EtherType = EtherTypeIPv6
+		default:
+			return s, false
+		}
+	default:
+		return s, false
+	}
+	s.NetworkOffset = offset
+	s.Length = len(data) - offset
+	switch s.EtherType {
+	case EtherTypeIPv4:
+		decodeIPv4(&s, data, offset)
+	case EtherTypeIPv6:
+		decodeIPv6(&s, data, offset)
+	}
+	return s, true
+}
+
+// decodeIPv4 decodes an IPv4 header and the transport ports, if any.
+func decodeIPv4(s *Summary, data []byte, offset int) {
+	if len(data) < offset+20 || data[offset]>>4 != 4 {
+		return
+	}
+	ihl := int(data[offset]&0x0f) * 4
+	s.Proto = data[offset+9]
+	s.Src = netip.AddrFrom4([4]byte(data[offset+12 : offset+16]))
+	s.Dst = netip.AddrFrom4([4]byte(data[offset+16 : offset+20]))
+	// Only the first fragment carries the transport header.
+	if binary.BigEndian.Uint16(data[offset+6:offset+8])&0x1fff != 0 || ihl < 20 {
+		return
+	}
+	decodeTransport(s, data, offset+ihl)
+}
+
+// decodeIPv6 decodes an IPv6 header, skipping any extension headers, and then
+// the transport ports, if any.
+func decodeIPv6(s *Summary, data []byte, offset int) {
+	if len(data) < offset+40 || data[offset]>>4 != 6 {
+		return
+	}
+	s.Src = netip.AddrFrom16([16]byte(data[offset+8 : offset+24]))
+	s.Dst = netip.AddrFrom16([16]byte(data[offset+24 : offset+40]))
+	next := data[offset+6]
+	offset += 40
+	for {
+		switch next {
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(data) < offset+2 {
+				s.Proto = next
+				return
+			}
+			next, offset = data[offset], offset+8+int(data[offset+1])*8
+			continue
+		case 44: // fragment
+			if len(data) < offset+8 {
+				s.Proto = next
+				return
+			}
+			fragoff := binary.BigEndian.Uint16(data[offset+2:offset+4]) >> 3
+			next, offset = data[offset], offset+8
+			if fragoff != 0 {
+				s.Proto = next
+				return
+			}
+			continue
+		case 51: // authentication header
+			if len(data) < offset+2 {
+				s.Proto = next
+				return
+			}
+			next, offset = data[offset], offset+(int(data[offset+1])+2)*4
+			continue
+		}
+		break
+	}
+	s.Proto = next
+	decodeTransport(s, data, offset)
+}
+
+// decodeTransport decodes the ports of TCP, UDP and SCTP transport headers.
+func decodeTransport(s *Summary, data []byte, offset int) {
+	switch s.Proto {
+	case ProtoTCP:
+		if len(data) < offset+20 {
+			return
+		}
+		s.TCPFlags = data[offset+13]
+		s.PayloadOffset = offset + int(data[offset+12]>>4)*4
+	case ProtoUDP, ProtoSCTP:
+		hdrlen := 8
+		if s.Proto == ProtoSCTP {
+			hdrlen = 12
+		}
+		if len(data) < offset+hdrlen {
+			return
+		}
+		s.PayloadOffset = offset + hdrlen
+	case ProtoICMP, ProtoICMPv6:
+		if len(data) < offset+4 {
+			return
+		}
+		s.TransportOffset = offset
+		s.PayloadOffset = offset + 4
+		return
+	default:
+		return
+	}
+	s.TransportOffset = offset
+	s.SrcPort = binary.BigEndian.Uint16(data[offset : offset+2])
+	s.DstPort = binary.BigEndian.Uint16(data[offset+2 : offset+4])
+	if s.PayloadOffset > len(data) {
+		s.PayloadOffset = len(data)
+	}
+}
@@ -0,0 +1,494 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"time"
+)
+
+// Block types, see also:
+// https://www.ietf.org/archive/id/draft-tuexen-opsawg-pcapng-05.html#name-block-types
+const (
+	BlockSHB = uint32(0x0a0d0d0a) // Section Header Block
+	BlockIDB = uint32(0x00000001) // Interface Description Block
+	BlockSPB = uint32(0x00000003) // Simple Packet Block
+	BlockNRB = uint32(0x00000004) // Name Resolution Block
+	BlockISB = uint32(0x00000005) // Interface Statistics Block
+	BlockEPB = uint32(0x00000006) // Enhanced Packet Block
+	BlockDSB = uint32(0x0000000a) // Decryption Secrets Block
+)
+
+// Option codes specific to certain block types.
+const (
+	OptIfName        = uint16(2)  // IDB: interface name
+	OptIfDescription = uint16(3)  // IDB: interface description
+	OptIfTsResol     = uint16(9)  // IDB: timestamp resolution
+	OptIfFilter      = uint16(11) // IDB: capture filter
+	OptIfOS          = uint16(12) // IDB: operating system
+
+	OptISBStartTime    = uint16(2) // ISB: capture start time
+	OptISBEndTime      = uint16(3) // ISB: capture end time
+	OptISBIfRecv       = uint16(4) // ISB: packets received
+	OptISBIfDrop       = uint16(5) // ISB: packets dropped
+	OptISBFilterAccept = uint16(6) // ISB: packets accepted by filter
+	OptISBOSDrop       = uint16(7) // ISB: packets dropped by the OS
+	OptISBUsrDeliv     = uint16(8) // ISB: packets delivered to the user
+)
+
+// Common link types, see also:
+// https://www.tcpdump.org/linktypes.html
+const (
+	LinkTypeNull      = uint16(0)
+	LinkTypeEthernet  = uint16(1)
+	LinkTypeRaw       = uint16(101)
+	LinkTypeLinuxSLL  = uint16(113)
+	LinkTypeIPv4      = uint16(228)
+	LinkTypeIPv6      = uint16(229)
+	LinkTypeLinuxSLL2 = uint16(276)
+)
+
+// ErrShortBlock signals that a block body is too short for its block type.
+var ErrShortBlock = errors.New("pcapng block too short")
+
+// Block is a single pcapng block, consisting of its block type and body. The
+// body excludes the leading block type and total length fields, as well as
+// the trailing total length field.
+type Block struct {
+	Type   uint32
+	Body   []byte
+	Endian binary.ByteOrder
+}
+
+// Bytes returns the octets encoding the complete block, including the block
+// type and the leading and trailing block total length fields. The body
+// gets padded to a multiple of 32 bits, if necessary.
+func (b *Block) Bytes() []byte {
+	bodylen := len(b.Body)
+	padding := (4 - bodylen&3) & 3
+	totallen := 4 + 4 + bodylen + padding + 4
+	buff := make([]byte, totallen)
+	b.Endian.PutUint32(buff[0:4], b.Type)
+	b.Endian.PutUint32(buff[4:8], uint32(totallen))
+	copy(buff[8:], b.Body)
+	b.Endian.PutUint32(buff[totallen-4:], uint32(totallen))
+	return buff
+}
+
+// Options returns the options of a block, starting at the specified offset
+// into the block's body.
+func (b *Block) Options(offset int) []*Option {
+	return parseOptions(b.Body, offset, b.Endian)
+}
+
+// parseOptions parses the options in buff, starting at the specified offset,
+// until either an end-of-options marker or the end of the buffer has been
+// reached.
+func parseOptions(buff []byte, offset int, endian binary.ByteOrder) []*Option {
+	opts := []*Option{}
+	for offset+4 <= len(buff) {
+		length := int(endian.Uint16(buff[offset+2 : offset+4]))
+		if offset+4+length > len(buff) {
+			break
+		}
+		opt, skip := NewOption(buff[offset:], endian)
+		if opt == nil {
+			break
+		}
+		opts = append(opts, opt)
+		offset += int(skip)
+	}
+	return opts
+}
+
+// encodeOptions returns the octets encoding the specified options, including
+// a final end-of-options marker. If there are no options, then no octets at
+// all are returned.
+func encodeOptions(opts []*Option, endian binary.ByteOrder) []byte {
+	if len(opts) == 0 {
+		return nil
+	}
+	b := []byte{}
+	for _, opt := range opts {
+		b = append(b, opt.Bytes(endian)...)
+	}
+	return append(b, (*Option)(nil).Bytes(endian)...)
+}
+
+// findOption returns the first option with the specified code, or nil.
+func findOption(opts []*Option, code uint16) *Option {
+	for _, opt := range opts {
+		if opt.Code == code {
+			return opt
+		}
+	}
+	return nil
+}
+
+// SectionHeader describes the contents of a Section Header Block.
+type SectionHeader struct {
+	Major, Minor  uint16
+	SectionLength int64 // -1 if unknown.
+	Options       []*Option
+}
+
+// Comment returns the first comment option of a section header, or "".
+func (s *SectionHeader) Comment() string {
+	if opt := findOption(s.Options, OptComment); opt != nil {
+		return opt.String()
+	}
+	return ""
+}
+
+// SectionHeader returns the decoded contents of a Section Header Block.
+func (b *Block) SectionHeader() (*SectionHeader, error) {
+	if b.Type != BlockSHB {
+		return nil, fmt.Errorf("not a section header block: 0x%08x", b.Type)
+	}
+	if len(b.Body) < 16 {
+		return nil, ErrShortBlock
+	}
+	return &SectionHeader{
+		Major:         b.Endian.Uint16(b.Body[4:6]),
+		Minor:         b.Endian.Uint16(b.Body[6:8]),
+		SectionLength: int64(b.Endian.Uint64(b.Body[8:16])),
+		Options:       b.Options(16),
+	}, nil
+}
+
+// NewSectionHeaderBlock returns a new Section Header Block with the specified
+// options and an unknown section length.
+func NewSectionHeaderBlock(endian binary.ByteOrder, opts ...*Option) *Block {
+	body := make([]byte, 16)
+	endian.PutUint32(body[0:4], 0x1a2b3c4d)
+	endian.PutUint16(body[4:6], 1)
+	endian.PutUint16(body[6:8], 0)
+	endian.PutUint64(body[8:16], ^uint64(0))
+	return &Block{
+		Type:   BlockSHB,
+		Body:   append(body, encodeOptions(opts, endian)...),
+		Endian: endian,
+	}
+}
+
+// InterfaceDescription describes the contents of an Interface Description
+// Block.
+type InterfaceDescription struct {
+	LinkType uint16
+	SnapLen  uint32
+	Options  []*Option
+}
+
+// Name returns the name of the interface, or "" if unknown.
+func (i *InterfaceDescription) Name() string {
+	if opt := findOption(i.Options, OptIfName); opt != nil {
+		return opt.String()
+	}
+	return ""
+}
+
+// Description returns the description of the interface, or "" if unknown.
+func (i *InterfaceDescription) Description() string {
+	if opt := findOption(i.Options, OptIfDescription); opt != nil {
+		return opt.String()
+	}
+	return ""
+}
+
+// TicksPerSecond returns the timestamp resolution of the interface in form of
+// timestamp ticks per second. It defaults to microsecond resolution.
+func (i *InterfaceDescription) TicksPerSecond() uint64 {
+	opt := findOption(i.Options, OptIfTsResol)
+	if opt == nil || len(opt.Value) < 1 {
+		return 1000000
+	}
+	resol := opt.Value[0]
+	if resol&0x80 != 0 {
+		exp := resol & 0x7f
+		if exp > 63 {
+			exp = 63
+		}
+		return uint64(1) << exp
+	}
+	ticks := uint64(1)
+	for ; resol > 0 && ticks <= math.MaxUint64/10; resol-- {
+		ticks *= 10
+	}
+	return ticks
+}
+
+// Time converts a timestamp in this interface's resolution into a wall-clock
+// time.
+func (i *InterfaceDescription) Time(ts uint64) time.Time {
+	tps := i.TicksPerSecond()
+	secs := ts / tps
+	nanos := (ts % tps) * 1000000000 / tps
+	return time.Unix(int64(secs), int64(nanos))
+}
+
+// Timestamp converts a wall-clock time into a timestamp in this interface's
+// resolution.
+func (i *InterfaceDescription) Timestamp(t time.Time) uint64 {
+	tps := i.TicksPerSecond()
+	return uint64(t.Unix())*tps + uint64(t.Nanosecond())*tps/1000000000
+}
+
+// InterfaceDescription returns the decoded contents of an Interface
+// Description Block.
+func (b *Block) InterfaceDescription() (*InterfaceDescription, error) {
+	if b.Type != BlockIDB {
+		return nil, fmt.Errorf("not an interface description block: 0x%08x", b.Type)
+	}
+	if len(b.Body) < 8 {
+		return nil, ErrShortBlock
+	}
+	return &InterfaceDescription{
+		LinkType: b.Endian.Uint16(b.Body[0:2]),
+		SnapLen:  b.Endian.Uint32(b.Body[4:8]),
+		Options:  b.Options(8),
+	}, nil
+}
+
+// NewInterfaceDescriptionBlock returns a new Interface Description Block for
+// the specified interface description.
+func NewInterfaceDescriptionBlock(endian binary.ByteOrder, idesc *InterfaceDescription) *Block {
+	body := make([]byte, 8)
+	endian.PutUint16(body[0:2], idesc.LinkType)
+	endian.PutUint32(body[4:8], idesc.SnapLen)
+	return &Block{
+		Type:   BlockIDB,
+		Body:   append(body, encodeOptions(idesc.Options, endian)...),
+		Endian: endian,
+	}
+}
+
+// EnhancedPacket describes the contents of an Enhanced Packet Block.
+type EnhancedPacket struct {
+	InterfaceID    uint32
+	Timestamp      uint64 // in units of the interface's timestamp resolution.
+	CapturedLength uint32
+	OriginalLength uint32
+	Data           []byte // captured packet data, without padding.
+	Options        []*Option
+}
+
+// EnhancedPacket returns the decoded contents of an Enhanced Packet Block. The
+// packet data references the block's body and thus is not a copy.
+func (b *Block) EnhancedPacket() (*EnhancedPacket, error) {
+	if b.Type != BlockEPB {
+		return nil, fmt.Errorf("not an enhanced packet block: 0x%08x", b.Type)
+	}
+	if len(b.Body) < 20 {
+		return nil, ErrShortBlock
+	}
+	epb := &EnhancedPacket{
+		InterfaceID:    b.Endian.Uint32(b.Body[0:4]),
+		Timestamp:      uint64(b.Endian.Uint32(b.Body[4:8]))<<32 | uint64(b.Endian.Uint32(b.Body[8:12])),
+		CapturedLength: b.Endian.Uint32(b.Body[12:16]),
+		OriginalLength: b.Endian.Uint32(b.Body[16:20]),
+	}
+	if 20+int(epb.CapturedLength) > len(b.Body) {
+		return nil, ErrShortBlock
+	}
+	epb.Data = b.Body[20 : 20+epb.CapturedLength]
+	datalen := (int(epb.CapturedLength) + 3) &^ 3
+	if 20+datalen <= len(b.Body) {
+		epb.Options = b.Options(20 + datalen)
+	}
+	return epb, nil
+}
+
+// NewEnhancedPacketBlock returns a new Enhanced Packet Block for the
+// specified packet. If the captured length is zero, then the length of the
+// packet data is used instead.
+func NewEnhancedPacketBlock(endian binary.ByteOrder, epb *EnhancedPacket) *Block {
+	caplen := epb.CapturedLength
+	if caplen == 0 {
+		caplen = uint32(len(epb.Data))
+	}
+	origlen := epb.OriginalLength
+	if origlen < caplen {
+		origlen = caplen
+	}
+	datalen := (len(epb.Data) + 3) &^ 3
+	body := make([]byte, 20+datalen)
+	endian.PutUint32(body[0:4], epb.InterfaceID)
+	endian.PutUint32(body[4:8], uint32(epb.Timestamp>>32))
+	endian.PutUint32(body[8:12], uint32(epb.Timestamp))
+	endian.PutUint32(body[12:16], caplen)
+	endian.PutUint32(body[16:20], origlen)
+	copy(body[20:], epb.Data)
+	return &Block{
+		Type:   BlockEPB,
+		Body:   append(body, encodeOptions(epb.Options, endian)...),
+		Endian: endian,
+	}
+}
+
+// InterfaceStatistics describes the contents of an Interface Statistics
+// Block.
+type InterfaceStatistics struct {
+	InterfaceID uint32
+	Timestamp   uint64
+	Options     []*Option
+}
+
+// Counter returns the value of a 64 bit counter option, such as
+// OptISBIfDrop, and true if the counter is present. Otherwise, it returns
+// false.
+func (i *InterfaceStatistics) Counter(code uint16, endian binary.ByteOrder) (uint64, bool) {
+	opt := findOption(i.Options, code)
+	if opt == nil || len(opt.Value) < 8 {
+		return 0, false
+	}
+	return endian.Uint64(opt.Value), true
+}
+
+// InterfaceStatistics returns the decoded contents of an Interface Statistics
+// Block.
+func (b *Block) InterfaceStatistics() (*InterfaceStatistics, error) {
+	if b.Type != BlockISB {
+		return nil, fmt.Errorf("not an interface statistics block: 0x%08x", b.Type)
+	}
+	if len(b.Body) < 12 {
+		return nil, ErrShortBlock
+	}
+	return &InterfaceStatistics{
+		InterfaceID: b.Endian.Uint32(b.Body[0:4]),
+		Timestamp:   uint64(b.Endian.Uint32(b.Body[4:8]))<<32 | uint64(b.Endian.Uint32(b.Body[8:12])),
+		Options:     b.Options(12),
+	}, nil
+}
+
+// NewInterfaceStatisticsBlock returns a new Interface Statistics Block for the
+// specified interface statistics.
+func NewInterfaceStatisticsBlock(endian binary.ByteOrder, isb *InterfaceStatistics) *Block {
+	body := make([]byte, 12)
+	endian.PutUint32(body[0:4], isb.InterfaceID)
+	endian.PutUint32(body[4:8], uint32(isb.Timestamp>>32))
+	endian.PutUint32(body[8:12], uint32(isb.Timestamp))
+	return &Block{
+		Type:   BlockISB,
+		Body:   append(body, encodeOptions(isb.Options, endian)...),
+		Endian: endian,
+	}
+}
+
+// CounterOption returns a new option with a 64 bit counter value, as used in
+// Interface Statistics Blocks.
+func CounterOption(code uint16, value uint64, endian binary.ByteOrder) *Option {
+	v := make([]byte, 8)
+	endian.PutUint64(v, value)
+	return &Option{Code: code, Value: v}
+}
+
+// Name resolution record types, see also:
+// https://www.ietf.org/archive/id/draft-tuexen-opsawg-pcapng-05.html#name-name-resolution-block
+const (
+	NRBRecordEnd  = uint16(0) // end of records
+	NRBRecordIPv4 = uint16(1) // IPv4 address and names
+	NRBRecordIPv6 = uint16(2) // IPv6 address and names
+)
+
+// NameRecord resolves a single IPv4 or IPv6 address to one or more names.
+type NameRecord struct {
+	Addr  netip.Addr
+	Names []string
+}
+
+// NameResolution describes the contents of a Name Resolution Block.
+type NameResolution struct {
+	Records []NameRecord
+	Options []*Option
+}
+
+// NameResolution returns the decoded contents of a Name Resolution Block.
+// Records of other types than IPv4 and IPv6 address records are skipped.
+func (b *Block) NameResolution() (*NameResolution, error) {
+	if b.Type != BlockNRB {
+		return nil, fmt.Errorf("not a name resolution block: 0x%08x", b.Type)
+	}
+	nrb := &NameResolution{}
+	offset := 0
+	for {
+		if offset+4 > len(b.Body) {
+			return nil, ErrShortBlock
+		}
+		rectype := b.Endian.Uint16(b.Body[offset : offset+2])
+		length := int(b.Endian.Uint16(b.Body[offset+2 : offset+4]))
+		offset += 4
+		if rectype == NRBRecordEnd {
+			break
+		}
+		if offset+length > len(b.Body) {
+			return nil, ErrShortBlock
+		}
+		value := b.Body[offset : offset+length]
+		offset += (length + 3) &^ 3
+		var addr netip.Addr
+		switch {
+		case rectype == NRBRecordIPv4 && length > 4:
+			addr = netip.AddrFrom4([4]byte(value[0:4]))
+			value = value[4:]
+		case rectype == NRBRecordIPv6 && length > 16:
+			addr = netip.AddrFrom16([16]byte(value[0:16]))
+			value = value[16:]
+		default:
+			continue
+		}
+		rec := NameRecord{Addr: addr}
+		for _, name := range bytes.Split(value, []byte{0}) {
+			if len(name) > 0 {
+				rec.Names = append(rec.Names, string(name))
+			}
+		}
+		nrb.Records = append(nrb.Records, rec)
+	}
+	nrb.Options = b.Options(offset)
+	return nrb, nil
+}
+
+// NewNameResolutionBlock returns a new Name Resolution Block for the specified
+// name resolution. Records with invalid addresses or without names are
+// skipped.
+func NewNameResolutionBlock(endian binary.ByteOrder, nrb *NameResolution) *Block {
+	body := []byte{}
+	for _, rec := range nrb.Records {
+		if !rec.Addr.IsValid() || len(rec.Names) == 0 {
+			continue
+		}
+		rectype := NRBRecordIPv6
+		if rec.Addr.Unmap().Is4() {
+			rectype = NRBRecordIPv4
+		}
+		var value []byte
+		if rectype == NRBRecordIPv4 {
+			addr := rec.Addr.Unmap().As4()
+			value = addr[:]
+		} else {
+			addr := rec.Addr.As16()
+			value = addr[:]
+		}
+		for _, name := range rec.Names {
+			value = append(append(value, name...), 0)
+		}
+		hdr := make([]byte, 4)
+		endian.PutUint16(hdr[0:2], rectype)
+		endian.PutUint16(hdr[2:4], uint16(len(value)))
+		body = append(append(body, hdr...), value...)
+		body = append(body, make([]byte, (4-len(value)&3)&3)...)
+	}
+	body = append(body, 0, 0, 0, 0) // end of records
+	return &Block{
+		Type:   BlockNRB,
+		Body:   append(body, encodeOptions(nrb.Options, endian)...),
+		Endian: endian,
+	}
+}
@@ -1,3 +1,5 @@
 // Package pcapng implements a pcapng stream editor which edits the first
 // Section Header Block (SHB), inserting additional meta data as comments.
+// Additionally, it provides reading, scanning, writing, slicing and merging
+// pcapng blocks of existing packet captures.
 package pcapng
@@ -0,0 +1,202 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// errNotSeekable signals that the wrapped writer isn't seekable.
+var errNotSeekable = errors.New("pcapng stream sink is not seekable")
+
+// Finalizer passes a pcapng stream through to a writer, keeping track of the
+// interfaces of the current section and the packets delivered on them. When
+// the stream has ended, Finalize appends interface statistics blocks for those
+// interfaces that didn't see final statistics after their last packets, so
+// that a capture that got stopped still ends with proper statistics.
+//
+// When the sink is seekable, a Finalizer forwards seeking and writing at
+// offsets, so that a StreamEditor writing to a Finalizer can still patch the
+// section length in place. Finalize then accounts for the appended
+// statistics in the patched section length.
+type Finalizer struct {
+	w io.Writer
+
+	mu        sync.Mutex
+	scanner   *Scanner
+	err       error
+	sections  int
+	ifaces    []finalizerIface
+	patchOff  int64  // offset of the patched section length, if any.
+	patch     []byte // patched section length, if any.
+	finalized bool
+}
+
+// finalizerIface tracks the packets delivered on a single interface.
+type finalizerIface struct {
+	delivered uint64
+	first     uint64 // timestamp of the first packet.
+	stats     bool   // final statistics seen after the last packet.
+}
+
+var _ io.Writer = (*Finalizer)(nil)
+
+// NewFinalizer returns a new Finalizer passing a pcapng stream through to w.
+func NewFinalizer(w io.Writer) *Finalizer {
+	f := &Finalizer{w: w}
+	f.scanner = NewScanner(f.block)
+	return f
+}
+
+// Write passes the octets of the pcapng stream through to the sink, tracking
+// the octets successfully written. A malformed stream isn't an error, but
+// Finalize won't append any statistics then.
+func (f *Finalizer) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil && n > 0 {
+		if _, serr := f.scanner.Write(p[:n]); serr != nil {
+			f.err = serr
+		}
+	}
+	return n, err
+}
+
+// Seek seeks the sink, if seekable.
+func (f *Finalizer) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.w.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errNotSeekable
+}
+
+// WriteAt patches the sink in place, if seekable, remembering a patched
+// section length.
+func (f *Finalizer) WriteAt(b []byte, off int64) (int, error) {
+	w, ok := f.w.(io.WriterAt)
+	if !ok {
+		return 0, errNotSeekable
+	}
+	n, err := w.WriteAt(b, off)
+	if err == nil && len(b) == 8 {
+		f.mu.Lock()
+		f.patchOff, f.patch = off, append([]byte(nil), b...)
+		f.mu.Unlock()
+	}
+	return n, err
+}
+
+// block tracks the interfaces and the packets delivered on them. Callers must
+// hold the lock.
+func (f *Finalizer) block(b *Block) error {
+	var id uint32
+	var ts uint64
+	switch b.Type {
+	case BlockSHB:
+		f.sections++
+		f.ifaces = nil
+		return nil
+	case BlockIDB:
+		f.ifaces = append(f.ifaces, finalizerIface{})
+		return nil
+	case BlockSPB:
+		// Simple packets are always from the first interface and lack
+		// timestamps.
+	case BlockEPB:
+		epb, err := b.EnhancedPacket()
+		if err != nil {
+			return nil
+		}
+		id, ts = epb.InterfaceID, epb.Timestamp
+	case BlockISB:
+		if isb, err := b.InterfaceStatistics(); err == nil && int(isb.InterfaceID) < len(f.ifaces) {
+			f.ifaces[isb.InterfaceID].stats = true
+		}
+		return nil
+	default:
+		return nil
+	}
+	if int(id) >= len(f.ifaces) {
+		return nil
+	}
+	iface := &f.ifaces[id]
+	if iface.delivered == 0 {
+		iface.first = ts
+	}
+	iface.delivered++
+	iface.stats = false
+	return nil
+}
+
+// Finalize appends interface statistics blocks with the specified end time
+// for the interfaces of the current section that lack final statistics. It
+// must only be called after the stream has ended and does nothing when
+// called again. If the stream ended in the middle of a block, nothing gets
+// appended and the truncation error is returned.
+func (f *Finalizer) Finalize(end time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.finalized {
+		return nil
+	}
+	f.finalized = true
+	if f.err != nil {
+		return f.err
+	}
+	if err := f.scanner.Close(); err != nil {
+		return err
+	}
+	endian := f.scanner.Endian()
+	var isbs []byte
+	for id, iface := range f.ifaces {
+		if iface.stats {
+			continue
+		}
+		idesc := f.scanner.Interface(uint32(id))
+		endts := idesc.Timestamp(end)
+		opts := []*Option{
+			timestampOption(OptISBEndTime, endts, endian),
+			CounterOption(OptISBUsrDeliv, iface.delivered, endian),
+		}
+		if iface.first != 0 {
+			opts = append([]*Option{timestampOption(OptISBStartTime, iface.first, endian)}, opts...)
+		}
+		isbs = append(isbs, NewInterfaceStatisticsBlock(endian, &InterfaceStatistics{
+			InterfaceID: uint32(id),
+			Timestamp:   endts,
+			Options:     opts,
+		}).Bytes()...)
+	}
+	if len(isbs) == 0 {
+		return nil
+	}
+	if _, err := f.w.Write(isbs); err != nil {
+		return err
+	}
+	// The statistics belong to the (only) section, so its already patched
+	// length needs to account for them.
+	if f.patch != nil && f.sections == 1 {
+		sectionLen := endian.Uint64(f.patch) + uint64(len(isbs))
+		endian.PutUint64(f.patch, sectionLen)
+		if _, err := f.w.(io.WriterAt).WriteAt(f.patch, f.patchOff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timestampOption returns a new option with a 64 bit timestamp value, split
+// into its upper and lower 32 bits as in Interface Statistics Blocks.
+func timestampOption(code uint16, ts uint64, endian binary.ByteOrder) *Option {
+	v := make([]byte, 8)
+	endian.PutUint32(v[0:4], uint32(ts>>32))
+	endian.PutUint32(v[4:8], uint32(ts))
+	return &Option{Code: code, Value: v}
+}
@@ -0,0 +1,116 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// statistics returns the interface statistics in the specified pcapng stream,
+// failing if the stream isn't valid.
+func statistics(stream []byte) []*InterfaceStatistics {
+	r := NewReader(bytes.NewReader(stream))
+	isbs := []*InterfaceStatistics{}
+	for {
+		b, err := r.Next()
+		if err == io.EOF {
+			return isbs
+		}
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		if b.Type == BlockISB {
+			isb, err := b.InterfaceStatistics()
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			isbs = append(isbs, isb)
+		}
+	}
+}
+
+// packets returns a pcapng stream with a single interface and packets at the
+// specified (microsecond) timestamps, but without any statistics.
+func packets(endian binary.ByteOrder, timestamps ...uint64) []byte {
+	var b bytes.Buffer
+	b.Write(NewSectionHeaderBlock(endian).Bytes())
+	b.Write(NewInterfaceDescriptionBlock(endian, &InterfaceDescription{LinkType: LinkTypeEthernet}).Bytes())
+	for _, ts := range timestamps {
+		b.Write(NewEnhancedPacketBlock(endian, &EnhancedPacket{Timestamp: ts, Data: []byte{byte(ts)}}).Bytes())
+	}
+	return b.Bytes()
+}
+
+var _ = Describe("pcapng finalizer", func() {
+
+	end := time.Unix(42, 0)
+
+	It("appends final statistics", func() {
+		for _, endian := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			var b bytes.Buffer
+			f := NewFinalizer(&b)
+			stream := packets(endian, 1000000, 2000000, 3000000)
+			_, err := f.Write(stream)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Finalize(end)).To(Succeed())
+			Expect(b.Bytes()[:len(stream)]).To(Equal(stream))
+			isbs := statistics(b.Bytes())
+			Expect(isbs).To(HaveLen(1))
+			Expect(isbs[0].Timestamp).To(Equal(uint64(42000000)))
+			delivered, ok := isbs[0].Counter(OptISBUsrDeliv, endian)
+			Expect(ok).To(BeTrue())
+			Expect(delivered).To(Equal(uint64(3)))
+			Expect(findOption(isbs[0].Options, OptISBStartTime).Value).To(
+				Equal(timestampOption(0, 1000000, endian).Value))
+
+			Expect(f.Finalize(end)).To(Succeed())
+			Expect(statistics(b.Bytes())).To(HaveLen(1), "must finalize only once")
+		}
+	})
+
+	It("keeps final statistics already present", func() {
+		var b bytes.Buffer
+		f := NewFinalizer(&b)
+		stream := capture(binary.LittleEndian, "foo", 1, 2).Bytes()
+		_, err := f.Write(stream)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Finalize(end)).To(Succeed())
+		Expect(b.Bytes()).To(Equal(stream))
+	})
+
+	It("doesn't append to truncated streams", func() {
+		var b bytes.Buffer
+		f := NewFinalizer(&b)
+		stream := packets(binary.LittleEndian, 1, 2)
+		_, err := f.Write(stream[:len(stream)-3])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Finalize(end)).To(MatchError(io.ErrUnexpectedEOF))
+		Expect(b.Len()).To(Equal(len(stream) - 3))
+	})
+
+	It("accounts for final statistics in patched section lengths", func() {
+		file, err := os.Create(filepath.Join(GinkgoT().TempDir(), "capture.pcapng"))
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		f := NewFinalizer(file)
+		se := NewStreamEditor(f, nil, "", false)
+		_, err = se.Write(packets(binary.LittleEndian, 1, 2, 3))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(se.Finish()).To(Succeed())
+		Expect(f.Finalize(end)).To(Succeed())
+		stream, err := os.ReadFile(file.Name())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(statistics(stream)).To(HaveLen(1))
+		r := NewReader(bytes.NewReader(stream))
+		shb, err := r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(binary.LittleEndian.Uint64(stream[16:24])).To(Equal(uint64(len(stream) - len(shb.Bytes()))))
+	})
+
+})
@@ -0,0 +1,138 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// HeartbeatComment is the comment of the interface statistics blocks emitted
+// by a Heartbeat, so that they can be told apart from the statistics sent by
+// capture services.
+const HeartbeatComment = "heartbeat"
+
+// Heartbeat passes a pcapng stream through to a writer, emitting interface
+// statistics blocks for all interfaces of the current section whenever the
+// stream has been idle for the heartbeat interval. This way, consumers of the
+// pcapng stream, such as file rotation, can tell a capture without any
+// network traffic from a capture stream that died.
+//
+// The emitted statistics carry the numbers of packets delivered so far on
+// each interface. They are emitted only between complete blocks and only after
+// the first interface description, so the pcapng stream stays well-formed.
+type Heartbeat struct {
+	w        io.Writer
+	interval time.Duration
+
+	mu        sync.Mutex
+	scanner   *Scanner
+	delivered []uint64 // packets delivered per interface of the current section.
+	timer     *time.Timer
+	last      time.Time // octets written last.
+	err       error     // malformed stream or failed write.
+	stopped   bool
+}
+
+var _ io.Writer = (*Heartbeat)(nil)
+
+// NewHeartbeat returns a new Heartbeat passing a pcapng stream through to w,
+// emitting interface statistics after each interval without any octets
+// written. The caller must call Stop after the stream has ended.
+func NewHeartbeat(w io.Writer, interval time.Duration) *Heartbeat {
+	h := &Heartbeat{w: w, interval: interval, last: time.Now()}
+	h.scanner = NewScanner(h.block)
+	h.timer = time.AfterFunc(interval, h.beat)
+	return h
+}
+
+// Write passes the octets of the pcapng stream through to the sink,
+// restarting the heartbeat interval.
+func (h *Heartbeat) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err == nil {
+		if _, err := h.scanner.Write(p); err != nil {
+			h.err = err
+		}
+	}
+	h.last = time.Now()
+	if !h.stopped {
+		h.timer.Reset(h.interval)
+	}
+	return h.w.Write(p)
+}
+
+// Stop emitting heartbeats. Stop is idempotent.
+func (h *Heartbeat) Stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	h.timer.Stop()
+}
+
+// block tracks the interfaces of the current section and the packets
+// delivered on them. Callers must hold the lock.
+func (h *Heartbeat) block(b *Block) error {
+	var id uint32
+	switch b.Type {
+	case BlockSHB:
+		h.delivered = nil
+		return nil
+	case BlockIDB:
+		h.delivered = append(h.delivered, 0)
+		return nil
+	case BlockSPB:
+		// Simple packets are always from the first interface.
+	case BlockEPB:
+		epb, err := b.EnhancedPacket()
+		if err != nil {
+			return nil
+		}
+		id = epb.InterfaceID
+	default:
+		return nil
+	}
+	if int(id) < len(h.delivered) {
+		h.delivered[id]++
+	}
+	return nil
+}
+
+// beat emits interface statistics for all interfaces of the current section,
+// unless octets have been written in the meantime or the stream is in the
+// middle of a block, and then restarts the heartbeat interval.
+func (h *Heartbeat) beat() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped || h.err != nil {
+		return
+	}
+	if idle := time.Since(h.last); idle < h.interval {
+		h.timer.Reset(h.interval - idle)
+		return
+	}
+	defer h.timer.Reset(h.interval)
+	if len(h.scanner.buff) != 0 || len(h.delivered) == 0 {
+		return
+	}
+	now := time.Now()
+	endian := h.scanner.Endian()
+	var isbs []byte
+	for id, delivered := range h.delivered {
+		isbs = append(isbs, NewInterfaceStatisticsBlock(endian, &InterfaceStatistics{
+			InterfaceID: uint32(id),
+			Timestamp:   h.scanner.Interface(uint32(id)).Timestamp(now),
+			Options: []*Option{
+				{Code: OptComment, Value: []byte(HeartbeatComment)},
+				CounterOption(OptISBUsrDeliv, delivered, endian),
+			},
+		}).Bytes()...)
+	}
+	if _, err := h.w.Write(isbs); err != nil {
+		h.err = err
+	}
+}
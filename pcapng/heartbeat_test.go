@@ -0,0 +1,85 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.b.Bytes()...)
+}
+
+var _ = Describe("heartbeats", func() {
+
+	It("emits interface statistics while idle", func() {
+		var out lockedBuffer
+		h := NewHeartbeat(&out, 50*time.Millisecond)
+		defer h.Stop()
+		stream := packets(binary.LittleEndian, 1, 2)
+		Expect(h.Write(stream)).To(Equal(len(stream)))
+		Eventually(func() int {
+			return len(statistics(out.Bytes()))
+		}).Should(BeNumerically(">=", 2))
+		h.Stop()
+
+		stream = out.Bytes()
+		isbs := statistics(stream)
+		for _, isb := range isbs {
+			Expect(isb.InterfaceID).To(BeZero())
+			Expect(string(findOption(isb.Options, OptComment).Value)).To(Equal(HeartbeatComment))
+			delivered, ok := isb.Counter(OptISBUsrDeliv, binary.LittleEndian)
+			Expect(ok).To(BeTrue())
+			Expect(delivered).To(Equal(uint64(2)))
+		}
+		Consistently(func() int { return len(out.Bytes()) }, 150*time.Millisecond).
+			Should(Equal(len(stream)))
+	})
+
+	It("doesn't emit interface statistics in the middle of blocks", func() {
+		var out lockedBuffer
+		h := NewHeartbeat(&out, 20*time.Millisecond)
+		defer h.Stop()
+		stream := packets(binary.BigEndian, 1, 2)
+		Expect(h.Write(stream[:len(stream)-3])).Error().NotTo(HaveOccurred())
+		Consistently(func() int { return len(out.Bytes()) }, 100*time.Millisecond).
+			Should(Equal(len(stream) - 3))
+		Expect(h.Write(stream[len(stream)-3:])).Error().NotTo(HaveOccurred())
+		Eventually(func() []*InterfaceStatistics {
+			return statistics(out.Bytes())
+		}).ShouldNot(BeEmpty())
+	})
+
+	It("doesn't emit interface statistics before any interfaces", func() {
+		var out lockedBuffer
+		h := NewHeartbeat(&out, 20*time.Millisecond)
+		defer h.Stop()
+		shb := NewSectionHeaderBlock(binary.LittleEndian).Bytes()
+		Expect(h.Write(shb)).Error().NotTo(HaveOccurred())
+		Consistently(func() int { return len(out.Bytes()) }, 100*time.Millisecond).
+			Should(Equal(len(shb)))
+	})
+
+})
@@ -0,0 +1,224 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// errLimited signals that the section length cannot be patched anymore, as
+// blocks have been dropped.
+var errLimited = errors.New("pcapng stream has been limited")
+
+// LimitWriter passes complete pcapng blocks through to a writer as long as the
+// overall number of octets written stays within a limit. The first block that
+// would exceed the limit gets dropped, as well as all later blocks, and the
+// LimitWriter calls its limit function once, such as for stopping the
+// capture. As blocks never get written partially, the output stays a
+// well-formed pcapng stream. Dropped blocks are still reported as written, so
+// that writing the pcapng stream continues undisturbed until it gets stopped.
+//
+// When the sink is seekable, a LimitWriter forwards seeking and writing at
+// offsets, so that a StreamEditor writing to a LimitWriter can still patch the
+// section length in place, unless blocks have been dropped.
+type LimitWriter struct {
+	w       io.Writer
+	limit   int64
+	onLimit func()
+
+	mu        sync.Mutex
+	scanner   *Scanner
+	written   int64
+	limited   bool
+	malformed bool   // the pcapng stream is malformed.
+	out       []byte // blocks to write for the current write.
+}
+
+var _ io.Writer = (*LimitWriter)(nil)
+
+// NewLimitWriter returns a new LimitWriter passing at most limit octets of a
+// pcapng stream through to w, calling the optional limit function when the
+// limit has been reached. The limit function is called from the writing
+// goroutine, so it must not block, such as by waiting for the capture to
+// stop.
+func NewLimitWriter(w io.Writer, limit int64, onLimit func()) *LimitWriter {
+	l := &LimitWriter{w: w, limit: limit, onLimit: onLimit}
+	l.scanner = NewScanner(l.block)
+	return l
+}
+
+// Write passes the complete blocks within the limit through to the sink. A
+// malformed pcapng stream gets cut off at the limit instead, regardless of
+// block boundaries.
+func (l *LimitWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	wasLimited := l.limited
+	l.out = l.out[:0]
+	if !l.limited {
+		if _, err := l.scanner.Write(p); err != nil && !l.limited {
+			// Pass the octets of a malformed stream through as they are,
+			// starting with the octets the scanner couldn't consume.
+			rest := p
+			if !l.malformed {
+				rest = l.scanner.buff
+				l.malformed = true
+			}
+			l.out = append(l.out, rest...)
+			if remaining := l.limit - l.written; int64(len(l.out)) > remaining {
+				l.out = l.out[:remaining]
+				l.limited = true
+			}
+		}
+	}
+	l.written += int64(len(l.out))
+	justLimited := l.limited && !wasLimited
+	if len(l.out) != 0 {
+		if _, err := l.w.Write(l.out); err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
+	}
+	l.mu.Unlock()
+	if justLimited && l.onLimit != nil {
+		l.onLimit()
+	}
+	return len(p), nil
+}
+
+// Written returns the number of octets written to the sink so far.
+func (l *LimitWriter) Written() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.written
+}
+
+// Limited returns true if the limit has been reached and blocks have been
+// dropped.
+func (l *LimitWriter) Limited() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limited
+}
+
+// Seek seeks the sink, if seekable.
+func (l *LimitWriter) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := l.w.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, errNotSeekable
+}
+
+// WriteAt patches the sink in place, if seekable, unless blocks have been
+// dropped, as then the patched section length would be wrong.
+func (l *LimitWriter) WriteAt(b []byte, off int64) (int, error) {
+	w, ok := l.w.(io.WriterAt)
+	if !ok {
+		return 0, errNotSeekable
+	}
+	if l.Limited() {
+		return 0, errLimited
+	}
+	return w.WriteAt(b, off)
+}
+
+// block queues a complete block for writing, as long as it stays within the
+// limit. Callers must hold the lock.
+func (l *LimitWriter) block(b *Block) error {
+	if l.limited {
+		return nil
+	}
+	octets := b.Bytes()
+	if l.written+int64(len(l.out))+int64(len(octets)) > l.limit {
+		l.limited = true
+		return nil
+	}
+	l.out = append(l.out, octets...)
+	return nil
+}
+
+// PacketLimitWriter passes a pcapng stream through to a writer until a
+// maximum number of packets has been written, similar to tcpdump's "-c"
+// option. Further packets get dropped, while all other blocks, such as the
+// final interface statistics, are still passed through. The PacketLimitWriter
+// calls its limit function once when the last packet within the limit has been
+// written, such as for stopping the capture. Dropped packets are still
+// reported as written, so that writing the pcapng stream continues undisturbed
+// until it gets stopped. Malformed pcapng streams are passed through as they
+// are, without any limit.
+type PacketLimitWriter struct {
+	w       io.Writer
+	limit   int64
+	onLimit func()
+
+	mu        sync.Mutex
+	scanner   *Scanner
+	packets   int64
+	malformed bool   // the pcapng stream is malformed.
+	out       []byte // blocks to write for the current write.
+}
+
+var _ io.Writer = (*PacketLimitWriter)(nil)
+
+// NewPacketLimitWriter returns a new PacketLimitWriter passing at most limit
+// packets of a pcapng stream through to w, calling the optional limit function
+// when the limit has been reached. The limit function is called from the
+// writing goroutine, so it must not block, such as by waiting for the capture
+// to stop.
+func NewPacketLimitWriter(w io.Writer, limit int64, onLimit func()) *PacketLimitWriter {
+	l := &PacketLimitWriter{w: w, limit: limit, onLimit: onLimit}
+	l.scanner = NewScanner(l.block)
+	return l
+}
+
+// Write passes the complete blocks through to the sink, except for packets
+// beyond the limit.
+func (l *PacketLimitWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	wasLimited := l.packets >= l.limit
+	l.out = l.out[:0]
+	if l.malformed {
+		l.out = append(l.out, p...)
+	} else if _, err := l.scanner.Write(p); err != nil {
+		// Pass the octets of a malformed stream through as they are,
+		// starting with the octets the scanner couldn't consume.
+		l.malformed = true
+		l.out = append(l.out, l.scanner.buff...)
+	}
+	justLimited := !wasLimited && l.packets >= l.limit
+	if len(l.out) != 0 {
+		if _, err := l.w.Write(l.out); err != nil {
+			l.mu.Unlock()
+			return 0, err
+		}
+	}
+	l.mu.Unlock()
+	if justLimited && l.onLimit != nil {
+		l.onLimit()
+	}
+	return len(p), nil
+}
+
+// Packets returns the number of packets written to the sink so far.
+func (l *PacketLimitWriter) Packets() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.packets
+}
+
+// block queues a complete block for writing, unless it is a packet beyond the
+// limit. Callers must hold the lock.
+func (l *PacketLimitWriter) block(b *Block) error {
+	switch b.Type {
+	case BlockEPB, BlockSPB:
+		if l.packets >= l.limit {
+			return nil
+		}
+		l.packets++
+	}
+	l.out = append(l.out, b.Bytes()...)
+	return nil
+}
@@ -0,0 +1,115 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("limiting pcapng streams", func() {
+
+	It("cuts streams at block boundaries", func() {
+		stream := packets(binary.LittleEndian, 1, 2, 3, 4, 5, 6)
+		limit := int64(len(packets(binary.LittleEndian, 1, 2, 3)) + 10)
+		var out bytes.Buffer
+		calls := 0
+		l := NewLimitWriter(&out, limit, func() { calls++ })
+		for len(stream) > 0 {
+			n := 7
+			if n > len(stream) {
+				n = len(stream)
+			}
+			Expect(l.Write(stream[:n])).To(Equal(n))
+			stream = stream[n:]
+		}
+		Expect(calls).To(Equal(1))
+		Expect(l.Limited()).To(BeTrue())
+		Expect(out.Bytes()).To(Equal(packets(binary.LittleEndian, 1, 2, 3)))
+		Expect(l.Written()).To(Equal(int64(out.Len())))
+	})
+
+	It("passes streams within the limit through unmodified", func() {
+		stream := packets(binary.BigEndian, 1, 2, 3)
+		var out bytes.Buffer
+		l := NewLimitWriter(&out, int64(len(stream)), func() { Fail("unexpected limit") })
+		Expect(l.Write(stream)).To(Equal(len(stream)))
+		Expect(l.Limited()).To(BeFalse())
+		Expect(out.Bytes()).To(Equal(stream))
+	})
+
+	It("cuts malformed streams at the limit", func() {
+		var out bytes.Buffer
+		calls := 0
+		l := NewLimitWriter(&out, 10, func() { calls++ })
+		junk := bytes.Repeat([]byte{0x42}, 8)
+		Expect(l.Write(junk)).To(Equal(len(junk)))
+		Expect(l.Write(junk)).To(Equal(len(junk)))
+		Expect(l.Write(junk)).To(Equal(len(junk)))
+		Expect(out.Bytes()).To(Equal(bytes.Repeat([]byte{0x42}, 10)))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("refuses to patch seekable sinks after dropping blocks", func() {
+		f, err := os.Create(filepath.Join(GinkgoT().TempDir(), "capture.pcapng"))
+		Expect(err).ShouldNot(HaveOccurred())
+		DeferCleanup(f.Close)
+
+		stream := packets(binary.LittleEndian, 1, 2)
+		l := NewLimitWriter(f, int64(len(stream)), nil)
+		Expect(l.Write(stream)).To(Equal(len(stream)))
+		Expect(l.WriteAt([]byte{0}, 0)).To(Equal(1))
+		Expect(l.Write(packets(binary.LittleEndian, 3))).Error().NotTo(HaveOccurred())
+		Expect(l.Limited()).To(BeTrue())
+		Expect(l.WriteAt([]byte{0}, 0)).Error().To(MatchError(errLimited))
+	})
+
+})
+
+var _ = Describe("limiting packets in pcapng streams", func() {
+
+	It("drops packets beyond the limit, but no other blocks", func() {
+		stream := capture(binary.LittleEndian, "foo", 1, 2, 3, 4).Bytes()
+		var out bytes.Buffer
+		calls := 0
+		l := NewPacketLimitWriter(&out, 2, func() { calls++ })
+		for len(stream) > 0 {
+			n := 7
+			if n > len(stream) {
+				n = len(stream)
+			}
+			Expect(l.Write(stream[:n])).To(Equal(n))
+			stream = stream[n:]
+		}
+		Expect(calls).To(Equal(1))
+		Expect(l.Packets()).To(Equal(int64(2)))
+		types, _, _, data := readBlocks(out.Bytes())
+		Expect(types).To(Equal([]uint32{BlockSHB, BlockIDB, BlockEPB, BlockEPB, BlockISB}))
+		Expect(data).To(Equal([]byte{1, 2}))
+	})
+
+	It("passes streams within the limit through unmodified", func() {
+		stream := packets(binary.BigEndian, 1, 2, 3)
+		var out bytes.Buffer
+		l := NewPacketLimitWriter(&out, 4, func() { Fail("unexpected limit") })
+		Expect(l.Write(stream)).To(Equal(len(stream)))
+		Expect(out.Bytes()).To(Equal(stream))
+	})
+
+	It("passes malformed streams through", func() {
+		var out bytes.Buffer
+		l := NewPacketLimitWriter(&out, 1, func() { Fail("unexpected limit") })
+		junk := bytes.Repeat([]byte{0x42}, 16)
+		Expect(l.Write(junk)).To(Equal(len(junk)))
+		Expect(l.Write(junk)).To(Equal(len(junk)))
+		Expect(out.Bytes()).To(Equal(bytes.Repeat([]byte{0x42}, 32)))
+	})
+
+})
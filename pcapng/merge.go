@@ -0,0 +1,242 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// mergeInput is a single pcapng stream taking part in a merge.
+type mergeInput struct {
+	r      *Reader
+	target string   // description of the capture target of the current section.
+	ifmap  []uint32 // maps section-local interface IDs to merged interface IDs.
+	next   *EnhancedPacket
+	nextTs time.Time
+}
+
+// merger merges multiple pcapng streams into a single section.
+type merger struct {
+	w       io.Writer
+	endian  binary.ByteOrder
+	inputs  []*mergeInput
+	nextIfs uint32
+}
+
+// Merge merges the packets from the pcapng streams rs in timestamp order and
+// writes them to w as a single section. The section header comments of the
+// individual streams, including their csharg capture target meta data, are
+// concatenated into the comment of the merged section header. The interfaces
+// of the individual streams are kept distinct and their descriptions are
+// updated to also describe the capture target they belong to. Merge returns
+// the number of packets written.
+func Merge(w io.Writer, rs ...io.Reader) (packets int, err error) {
+	if len(rs) == 0 {
+		return 0, errors.New("no pcapng streams to merge")
+	}
+	m := &merger{w: w}
+	var comments []string
+	for idx, r := range rs {
+		in := &mergeInput{r: NewReader(r)}
+		if _, err := in.r.Next(); err != nil {
+			return 0, fmt.Errorf("stream #%d: %w", idx+1, err)
+		}
+		comment := in.r.SectionHeader().Comment()
+		if comment != "" {
+			comments = append(comments, strings.TrimSuffix(comment, "\n")+"\n")
+		}
+		in.target = targetDescription(comment)
+		m.inputs = append(m.inputs, in)
+	}
+	m.endian = m.inputs[0].r.Endian()
+	var opts []*Option
+	if len(comments) > 0 {
+		opts = append(opts, &Option{Code: OptComment, Value: []byte(strings.Join(comments, ""))})
+	}
+	if _, err := w.Write(NewSectionHeaderBlock(m.endian, opts...).Bytes()); err != nil {
+		return 0, err
+	}
+	for idx, in := range m.inputs {
+		if err := m.advance(in); err != nil {
+			return 0, fmt.Errorf("stream #%d: %w", idx+1, err)
+		}
+	}
+	for {
+		var earliest *mergeInput
+		var earliestIdx int
+		for idx, in := range m.inputs {
+			if in.next == nil {
+				continue
+			}
+			if earliest == nil || in.nextTs.Before(earliest.nextTs) {
+				earliest, earliestIdx = in, idx
+			}
+		}
+		if earliest == nil {
+			return packets, nil
+		}
+		epb := *earliest.next
+		epb.InterfaceID = earliest.ifmap[epb.InterfaceID]
+		epb.Options = convertOptions(BlockEPB, epb.Options, earliest.r.Endian(), m.endian)
+		if _, err := w.Write(NewEnhancedPacketBlock(m.endian, &epb).Bytes()); err != nil {
+			return packets, err
+		}
+		packets++
+		if err := m.advance(earliest); err != nil {
+			return packets, fmt.Errorf("stream #%d: %w", earliestIdx+1, err)
+		}
+	}
+}
+
+// advance reads the next packet from the specified input, passing on any
+// interface descriptions and statistics found on the way.
+func (m *merger) advance(in *mergeInput) error {
+	in.next = nil
+	for {
+		b, err := in.r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch b.Type {
+		case BlockSHB:
+			in.ifmap = nil
+			in.target = targetDescription(in.r.SectionHeader().Comment())
+		case BlockIDB:
+			idb := *in.r.Interface(uint32(len(in.r.Interfaces()) - 1))
+			idb.Options = convertOptions(BlockIDB, idb.Options, b.Endian, m.endian)
+			describeTarget(&idb, in.target)
+			if _, err := m.w.Write(NewInterfaceDescriptionBlock(m.endian, &idb).Bytes()); err != nil {
+				return err
+			}
+			in.ifmap = append(in.ifmap, m.nextIfs)
+			m.nextIfs++
+		case BlockISB:
+			isb, err := b.InterfaceStatistics()
+			if err != nil {
+				return err
+			}
+			if int(isb.InterfaceID) >= len(in.ifmap) {
+				continue
+			}
+			isb.InterfaceID = in.ifmap[isb.InterfaceID]
+			isb.Options = convertOptions(BlockISB, isb.Options, b.Endian, m.endian)
+			if _, err := m.w.Write(NewInterfaceStatisticsBlock(m.endian, isb).Bytes()); err != nil {
+				return err
+			}
+		case BlockNRB, BlockDSB:
+			// These blocks contain further endian-dependent fields, so we
+			// only pass them on as long as the endianness matches.
+			if b.Endian != m.endian {
+				continue
+			}
+			if _, err := m.w.Write(b.Bytes()); err != nil {
+				return err
+			}
+		case BlockEPB:
+			epb, err := b.EnhancedPacket()
+			if err != nil {
+				return err
+			}
+			if int(epb.InterfaceID) >= len(in.ifmap) {
+				return fmt.Errorf("packet references unknown interface %d", epb.InterfaceID)
+			}
+			in.next = epb
+			in.nextTs = in.r.Interface(epb.InterfaceID).Time(epb.Timestamp)
+			return nil
+		}
+	}
+}
+
+// targetDescription returns a short description of the capture target found
+// in a section header comment, or "" if there is none.
+func targetDescription(comment string) string {
+	ci, _ := ParseContainerInfo(comment)
+	if ci == nil {
+		return ""
+	}
+	desc := ci.ContainerName
+	if ci.ContainerType != "" {
+		desc += " (" + ci.ContainerType + ")"
+	}
+	if ci.NodeName != "" {
+		desc += " on " + ci.NodeName
+	}
+	return desc
+}
+
+// describeTarget prefixes the description of the interface with the
+// description of its capture target, if any.
+func describeTarget(idb *InterfaceDescription, target string) {
+	if target == "" {
+		return
+	}
+	desc := target
+	if orig := idb.Description(); orig != "" {
+		desc += ": " + orig
+	}
+	idb.Options = setOption(idb.Options, OptIfDescription, []byte(desc))
+}
+
+// setOption returns the options with the value of the first option with the
+// specified code replaced, or the option appended if not present yet.
+func setOption(opts []*Option, code uint16, value []byte) []*Option {
+	newopts := make([]*Option, 0, len(opts)+1)
+	set := false
+	for _, opt := range opts {
+		if opt.Code == code && !set {
+			opt = &Option{Code: code, Value: value}
+			set = true
+		}
+		newopts = append(newopts, opt)
+	}
+	if !set {
+		newopts = append(newopts, &Option{Code: code, Value: value})
+	}
+	return newopts
+}
+
+// numericOptions lists the options with numeric values per block type, and
+// the size of the individual integer fields in these values.
+var numericOptions = map[uint32]map[uint16]int{
+	BlockIDB: {8: 8, 10: 4, 14: 8, 16: 8, 17: 8}, // if_speed, if_tzone, if_tsoffset, if_txspeed, if_rxspeed
+	BlockEPB: {2: 4, 4: 8, 5: 8, 6: 4},           // epb_flags, epb_dropcount, epb_packetid, epb_queue
+	BlockISB: {2: 4, 3: 4, 4: 8, 5: 8, 6: 8, 7: 8, 8: 8},
+}
+
+// convertOptions converts the numeric option values of the specified block
+// type from one endianness into another.
+func convertOptions(blocktype uint32, opts []*Option, from, to binary.ByteOrder) []*Option {
+	if from == to {
+		return opts
+	}
+	sizes := numericOptions[blocktype]
+	newopts := make([]*Option, 0, len(opts))
+	for _, opt := range opts {
+		size, ok := sizes[opt.Code]
+		if !ok || len(opt.Value)%size != 0 {
+			newopts = append(newopts, opt)
+			continue
+		}
+		value := make([]byte, len(opt.Value))
+		for offset := 0; offset < len(value); offset += size {
+			switch size {
+			case 4:
+				to.PutUint32(value[offset:], from.Uint32(opt.Value[offset:]))
+			case 8:
+				to.PutUint64(value[offset:], from.Uint64(opt.Value[offset:]))
+			}
+		}
+		newopts = append(newopts, &Option{Code: opt.Code, Value: value})
+	}
+	return newopts
+}
@@ -0,0 +1,92 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// capture returns a pcapng stream for the specified capture target with a
+// single interface and packets at the specified (microsecond) timestamps.
+func capture(endian binary.ByteOrder, target string, timestamps ...uint64) *bytes.Buffer {
+	var b bytes.Buffer
+	b.Write(NewSectionHeaderBlock(endian, &Option{
+		Code:  OptComment,
+		Value: []byte(targetmarker + "container-name: " + target + "\nnode-name: node\n"),
+	}).Bytes())
+	b.Write(NewInterfaceDescriptionBlock(endian, &InterfaceDescription{
+		LinkType: LinkTypeEthernet,
+		Options:  []*Option{{Code: OptIfName, Value: []byte("eth0")}},
+	}).Bytes())
+	for _, ts := range timestamps {
+		b.Write(NewEnhancedPacketBlock(endian, &EnhancedPacket{
+			Timestamp: ts,
+			Data:      []byte{byte(ts)},
+		}).Bytes())
+	}
+	b.Write(NewInterfaceStatisticsBlock(endian, &InterfaceStatistics{
+		Options: []*Option{CounterOption(OptISBIfDrop, 42, endian)},
+	}).Bytes())
+	return &b
+}
+
+var _ = Describe("merging pcapng streams", func() {
+
+	It("rejects merging nothing", func() {
+		Expect(Merge(io.Discard)).Error().To(HaveOccurred())
+	})
+
+	It("merges in timestamp order with distinct interfaces", func() {
+		var out bytes.Buffer
+		n, err := Merge(&out,
+			capture(binary.LittleEndian, "foo", 1, 4, 5),
+			capture(binary.BigEndian, "bar", 2, 3, 6))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(6))
+
+		r := NewReader(&out)
+		var data []byte
+		var ifids []uint32
+		for {
+			b, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			switch b.Type {
+			case BlockEPB:
+				p, err := b.EnhancedPacket()
+				Expect(err).NotTo(HaveOccurred())
+				data = append(data, p.Data...)
+				ifids = append(ifids, p.InterfaceID)
+			case BlockISB:
+				isb, err := b.InterfaceStatistics()
+				Expect(err).NotTo(HaveOccurred())
+				dropped, ok := isb.Counter(OptISBIfDrop, b.Endian)
+				Expect(ok).To(BeTrue())
+				Expect(dropped).To(Equal(uint64(42)))
+			}
+		}
+		Expect(r.Endian()).To(Equal(binary.LittleEndian))
+		Expect(data).To(Equal([]byte{1, 2, 3, 4, 5, 6}))
+		Expect(ifids).To(Equal([]uint32{0, 1, 1, 0, 0, 1}))
+
+		Expect(r.Interfaces()).To(HaveLen(2))
+		Expect(r.Interface(0).Description()).To(Equal("foo on node"))
+		Expect(r.Interface(1).Description()).To(Equal("bar on node"))
+
+		cis, err := ParseContainerInfos(r.SectionHeader().Comment())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cis).To(HaveLen(2))
+		Expect(cis[0].ContainerName).To(Equal("foo"))
+		Expect(cis[1].ContainerName).To(Equal("bar"))
+	})
+
+})
@@ -0,0 +1,246 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Multiplexer merges multiple live pcapng streams into a single section as
+// their blocks arrive, such as when capturing from multiple capture targets at
+// the same time into a single packet capture. In contrast to Merge, which
+// needs the next packet of every stream in order to merge in timestamp order,
+// the Multiplexer never holds back the packets of busy streams while waiting
+// for packets of quiet streams; the packets of different streams thus might
+// be slightly out of timestamp order.
+//
+// As with Merge, the section header comments of the individual streams,
+// including their csharg capture target meta data, are concatenated into the
+// comment of the merged section header, and the interfaces of the individual
+// streams are kept distinct, with their descriptions updated to also describe
+// the capture target they belong to. The merged section header gets written
+// only after each input has either written its own section header or has been
+// closed, so inputs must be closed when their streams end.
+type Multiplexer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	endian  binary.ByteOrder // of the merged section, or nil if not yet written.
+	inputs  []*muxInput
+	pending int // number of inputs yet to write their section header.
+	nextIfs uint32
+	err     error // sticky error writing to w.
+}
+
+// muxInput is a single pcapng stream taking part in multiplexing.
+type muxInput struct {
+	m       *Multiplexer
+	scanner *Scanner
+	headed  bool     // section header seen.
+	closed  bool     // input has been closed.
+	comment string   // comment of the first section header.
+	target  string   // description of the capture target of the current section.
+	ifmap   []uint32 // maps section-local interface IDs to merged interface IDs.
+	queued  []*Block // blocks arriving before the merged section header.
+}
+
+var _ io.WriteCloser = (*muxInput)(nil)
+
+// NewMultiplexer returns a new Multiplexer merging the specified number of
+// pcapng streams into w.
+func NewMultiplexer(w io.Writer, n int) *Multiplexer {
+	m := &Multiplexer{
+		w:       w,
+		inputs:  make([]*muxInput, n),
+		pending: n,
+	}
+	for idx := range m.inputs {
+		in := &muxInput{m: m}
+		in.scanner = NewScanner(in.block)
+		m.inputs[idx] = in
+	}
+	return m
+}
+
+// Input returns the writer for the pcapng stream with the specified index.
+// The writer must be closed when the pcapng stream ends.
+func (m *Multiplexer) Input(idx int) io.WriteCloser {
+	return m.inputs[idx]
+}
+
+// Write writes octets from a pcapng stream into the multiplexer, writing the
+// blocks completed by these octets to the merged pcapng stream.
+func (in *muxInput) Write(p []byte) (n int, err error) {
+	in.m.mu.Lock()
+	defer in.m.mu.Unlock()
+	if in.m.err != nil {
+		return 0, in.m.err
+	}
+	if in.closed {
+		return 0, errors.New("pcapng multiplexer input already closed")
+	}
+	return in.scanner.Write(p)
+}
+
+// Close ends the pcapng stream of this input, returning an error if the stream
+// ended with an incomplete block. Closing an input more than once does
+// nothing.
+func (in *muxInput) Close() error {
+	in.m.mu.Lock()
+	defer in.m.mu.Unlock()
+	if in.closed {
+		return nil
+	}
+	in.closed = true
+	err := in.scanner.Close()
+	if !in.headed {
+		in.m.pending--
+		if werr := in.m.writeHeader(); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// block passes a block of the input on to the merged pcapng stream, or queues
+// it while the merged section header cannot be written yet.
+func (in *muxInput) block(b *Block) error {
+	if !in.headed {
+		if b.Type != BlockSHB {
+			return errors.New("invalid pcapng stream; must begin with section header block")
+		}
+		shb, err := b.SectionHeader()
+		if err != nil {
+			return err
+		}
+		in.headed = true
+		in.comment = shb.Comment()
+		in.target = targetDescription(in.comment)
+		in.queued = append(in.queued, b)
+		in.m.pending--
+		return in.m.writeHeader()
+	}
+	if in.m.endian == nil {
+		in.queued = append(in.queued, b)
+		return nil
+	}
+	return in.m.forward(in, b)
+}
+
+// writeHeader writes the merged section header as soon as there are no inputs
+// pending anymore, followed by the blocks queued so far.
+func (m *Multiplexer) writeHeader() error {
+	if m.pending > 0 || m.endian != nil {
+		return nil
+	}
+	var comments []string
+	for _, in := range m.inputs {
+		if !in.headed {
+			continue
+		}
+		if m.endian == nil {
+			m.endian = in.queued[0].Endian
+		}
+		if in.comment != "" {
+			comments = append(comments, strings.TrimSuffix(in.comment, "\n")+"\n")
+		}
+	}
+	if m.endian == nil {
+		return nil
+	}
+	var opts []*Option
+	if len(comments) > 0 {
+		opts = append(opts, &Option{Code: OptComment, Value: []byte(strings.Join(comments, ""))})
+	}
+	if err := m.write(NewSectionHeaderBlock(m.endian, opts...)); err != nil {
+		return err
+	}
+	for _, in := range m.inputs {
+		queued := in.queued
+		in.queued = nil
+		// The first queued block is the already merged section header.
+		if len(queued) > 0 {
+			queued = queued[1:]
+		}
+		for _, b := range queued {
+			if err := m.forward(in, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forward writes a block of the specified input to the merged pcapng stream,
+// mapping its interfaces to the merged interfaces.
+func (m *Multiplexer) forward(in *muxInput, b *Block) error {
+	switch b.Type {
+	case BlockSHB:
+		// A new section of this input; its interfaces get appended to the
+		// merged interfaces.
+		shb, err := b.SectionHeader()
+		if err != nil {
+			return err
+		}
+		in.ifmap = nil
+		in.target = targetDescription(shb.Comment())
+	case BlockIDB:
+		idb, err := b.InterfaceDescription()
+		if err != nil {
+			return err
+		}
+		idb.Options = convertOptions(BlockIDB, idb.Options, b.Endian, m.endian)
+		describeTarget(idb, in.target)
+		if err := m.write(NewInterfaceDescriptionBlock(m.endian, idb)); err != nil {
+			return err
+		}
+		in.ifmap = append(in.ifmap, m.nextIfs)
+		m.nextIfs++
+	case BlockISB:
+		isb, err := b.InterfaceStatistics()
+		if err != nil {
+			return err
+		}
+		if int(isb.InterfaceID) >= len(in.ifmap) {
+			return nil
+		}
+		isb.InterfaceID = in.ifmap[isb.InterfaceID]
+		isb.Options = convertOptions(BlockISB, isb.Options, b.Endian, m.endian)
+		return m.write(NewInterfaceStatisticsBlock(m.endian, isb))
+	case BlockNRB, BlockDSB:
+		// These blocks contain further endian-dependent fields, so we only
+		// pass them on as long as the endianness matches.
+		if b.Endian != m.endian {
+			return nil
+		}
+		return m.write(b)
+	case BlockEPB:
+		epb, err := b.EnhancedPacket()
+		if err != nil {
+			return err
+		}
+		if int(epb.InterfaceID) >= len(in.ifmap) {
+			return fmt.Errorf("packet references unknown interface %d", epb.InterfaceID)
+		}
+		epb.InterfaceID = in.ifmap[epb.InterfaceID]
+		epb.Options = convertOptions(BlockEPB, epb.Options, b.Endian, m.endian)
+		return m.write(NewEnhancedPacketBlock(m.endian, epb))
+	}
+	return nil
+}
+
+// write the block to the merged pcapng stream, remembering any error so that
+// all inputs fail from now on.
+func (m *Multiplexer) write(b *Block) error {
+	if _, err := m.w.Write(b.Bytes()); err != nil {
+		m.err = err
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// failingWriter fails all writes.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("failing writer") }
+
+var _ = Describe("multiplexing live pcapng streams", func() {
+
+	It("waits for all section headers and then passes on blocks as they arrive", func() {
+		var out bytes.Buffer
+		m := NewMultiplexer(&out, 2)
+		foo := capture(binary.LittleEndian, "foo", 1, 3).Bytes()
+		bar := capture(binary.BigEndian, "bar", 2).Bytes()
+
+		// Nothing gets written until all inputs have written their section
+		// headers.
+		Expect(m.Input(0).Write(foo)).To(Equal(len(foo)))
+		Expect(out.Len()).To(BeZero())
+		Expect(m.Input(1).Write(bar[:len(bar)-1])).To(Equal(len(bar) - 1))
+		Expect(out.Len()).NotTo(BeZero())
+		Expect(m.Input(1).Write(bar[len(bar)-1:])).To(Equal(1))
+		Expect(m.Input(0).Close()).To(Succeed())
+		Expect(m.Input(1).Close()).To(Succeed())
+
+		r := NewReader(bytes.NewReader(out.Bytes()))
+		b, err := r.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.Endian).To(Equal(binary.LittleEndian))
+		comment := r.SectionHeader().Comment()
+		Expect(comment).To(ContainSubstring("container-name: foo"))
+		Expect(comment).To(ContainSubstring("container-name: bar"))
+
+		types, _, ifids, data := readBlocks(out.Bytes())
+		Expect(types).To(Equal([]uint32{
+			BlockSHB, BlockIDB, BlockEPB, BlockEPB, BlockISB, BlockIDB, BlockEPB, BlockISB}))
+		Expect(ifids).To(Equal([]uint32{0, 0, 1}))
+		Expect(data).To(Equal([]byte{1, 3, 2}))
+		for {
+			if _, err := r.Next(); err != nil {
+				break
+			}
+		}
+		Expect(r.Interfaces()).To(HaveLen(2))
+		Expect(r.Interface(0).Description()).To(ContainSubstring("foo"))
+		Expect(r.Interface(1).Description()).To(ContainSubstring("bar"))
+	})
+
+	It("doesn't wait for inputs closed before their section header", func() {
+		var out bytes.Buffer
+		m := NewMultiplexer(&out, 2)
+		foo := capture(binary.LittleEndian, "foo", 1).Bytes()
+		Expect(m.Input(0).Write(foo)).To(Equal(len(foo)))
+		Expect(m.Input(1).Close()).To(Succeed())
+		Expect(m.Input(1).Close()).To(Succeed())
+		types, _, _, data := readBlocks(out.Bytes())
+		Expect(types).To(Equal([]uint32{BlockSHB, BlockIDB, BlockEPB, BlockISB}))
+		Expect(data).To(Equal([]byte{1}))
+		Expect(m.Input(1).Write(foo)).Error().To(HaveOccurred())
+	})
+
+	It("fails all inputs after failing to write", func() {
+		m := NewMultiplexer(failingWriter{}, 2)
+		foo := capture(binary.LittleEndian, "foo", 1).Bytes()
+		Expect(m.Input(0).Write(foo)).Error().NotTo(HaveOccurred())
+		Expect(m.Input(1).Write(foo)).Error().To(MatchError("failing writer"))
+		Expect(m.Input(0).Write(foo)).Error().To(MatchError("failing writer"))
+	})
+
+	It("rejects streams not starting with a section header", func() {
+		m := NewMultiplexer(&bytes.Buffer{}, 1)
+		foo := capture(binary.LittleEndian, "foo", 1).Bytes()
+		Expect(m.Input(0).Write(foo[28:])).Error().To(HaveOccurred())
+	})
+
+})
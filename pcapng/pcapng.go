@@ -32,8 +32,25 @@ var (
 
 // StreamEditor allows editing the first section header block (SHB) of a pcapng
 // packet capture stream.
+//
+// When the sink is seekable, such as a regular file, the stream editor
+// additionally keeps track of the length of the first section, so that Finish
+// can patch the accurate section length into the edited SHB in place, instead
+// of leaving it unspecified as when streaming into pipes and sockets.
 type StreamEditor struct {
-	Endian        binary.ByteOrder
+	Endian binary.ByteOrder
+	// MaxSHBLength optionally limits the size of the first SHB to buffer for
+	// editing. Larger SHBs are passed through unedited. Zero means no limit.
+	MaxSHBLength int64
+	// Names optionally resolves network addresses to names, such as the names
+	// of Kubernetes services. They are added in a name resolution block
+	// directly following the edited SHB.
+	Names *NameResolution
+	// Aliases optionally records the readable aliases of network interfaces,
+	// indexed by their kernel names, in the capture target meta data. The
+	// interfaces themselves get renamed by a Renamer.
+	Aliases map[string]string
+
 	sink          io.Writer
 	passThrough   bool
 	shb           []byte
@@ -41,6 +58,20 @@ type StreamEditor struct {
 	container     *api.Target
 	captureFilter string
 	noProm        bool
+
+	seekable   seekableSink // sink, if seekable; nil otherwise.
+	shbOffset  int64        // sink offset of the edited SHB.
+	sectioning bool         // walking the blocks of the first section.
+	sectionLen uint64       // octets of the first section so far.
+	blockHdr   []byte       // partial header of the next block.
+	blockLeft  uint64       // octets left of the current block.
+}
+
+// seekableSink is a sink that allows patching already written octets in
+// place, such as an *os.File of a regular file.
+type seekableSink interface {
+	io.Seeker
+	io.WriterAt
 }
 
 // ContainerInfo represents the container information to be added to the capture
@@ -49,9 +80,14 @@ type ContainerInfo struct {
 	ContainerName string `yaml:"container-name"`
 	ContainerType string `yaml:"container-type"`
 	NodeName      string `yaml:"node-name"`
+	ContainerID   string `yaml:"container-id,omitempty"`
+	SandboxID     string `yaml:"sandbox-id,omitempty"`
 	*ClusterInfo  `yaml:"cluster,omitempty"`
 	CaptureFilter string `yaml:"capture-filter,omitempty"`
 	NoProm        bool   `yaml:"no-promiscuous-mode,omitempty"`
+	// Readable aliases of renamed network interfaces, indexed by their kernel
+	// names.
+	InterfaceAliases map[string]string `yaml:"interface-aliases,omitempty"`
 }
 
 // ClusterInfo represents the cluster information to be added to the capture
@@ -60,18 +96,64 @@ type ClusterInfo struct {
 	UID string `yaml:"uid,omitempty"`
 }
 
+// ParseContainerInfo returns the container (capture target) information
+// embedded in a section header comment, as added by the StreamEditor. It
+// returns nil if the comment doesn't contain any container information.
+func ParseContainerInfo(comment string) (*ContainerInfo, error) {
+	start := markerstart.FindStringIndex(comment)
+	if len(start) != 2 {
+		return nil, nil
+	}
+	text := comment[start[1]:]
+	if end := markerend.FindStringIndex(text); len(end) == 2 {
+		text = text[:end[0]]
+	}
+	var ci ContainerInfo
+	if err := yaml.Unmarshal([]byte(text), &ci); err != nil {
+		return nil, err
+	}
+	return &ci, nil
+}
+
+// ParseContainerInfos returns all container (capture target) information
+// embedded in a section header comment, such as in case of merged captures.
+func ParseContainerInfos(comment string) ([]*ContainerInfo, error) {
+	cis := []*ContainerInfo{}
+	for {
+		start := markerstart.FindStringIndex(comment)
+		if len(start) != 2 {
+			return cis, nil
+		}
+		ci, err := ParseContainerInfo(comment[start[0]:])
+		if err != nil {
+			return cis, err
+		}
+		cis = append(cis, ci)
+		comment = comment[start[1]:]
+	}
+}
+
 // NewStreamEditor returns a new pcapng packet stream data editor, connected to
 // the specified writer (which can be a pipe, file, et cetera).
 func NewStreamEditor(sink io.Writer, container *api.Target, captureFilter string, noProm bool) *StreamEditor {
 	if container == nil {
 		container = &api.Target{}
 	}
-	return &StreamEditor{
+	pe := &StreamEditor{
 		sink:          sink,
 		container:     container,
 		captureFilter: captureFilter,
 		noProm:        noProm,
 	}
+	// Pipes, sockets, and terminals fail seeking, so only regular files and
+	// their ilk remain seekable.
+	if seekable, ok := sink.(seekableSink); ok {
+		if offset, err := seekable.Seek(0, io.SeekCurrent); err == nil {
+			pe.seekable = seekable
+			pe.shbOffset = offset
+		}
+	}
+	return pe
 }
 
 // Write writes some octets into the pcapng stream editor which it might then
@@ -79,7 +161,13 @@ func NewStreamEditor(sink io.Writer, container *api.Target, captureFilter string
 // sink.
 func (pe *StreamEditor) Write(b []byte) (n int, err error) {
 	n = len(b)
-	b = pe.process(b)
+	// Only walk the blocks past the edited SHB, as processing the SHB
+	// already walks any overspill.
+	if pe.sectioning {
+		pe.walk(b)
+	} else {
+		b = pe.process(b)
+	}
 	if _, err = pe.sink.Write(b); err != nil {
 		log.Debugf("pcapng stream broken: %s", err.Error())
 		return
@@ -104,11 +192,22 @@ func (pe *StreamEditor) process(b []byte) []byte {
 			// There's a problem with this stream, so simply switch into
 			// pass-through mode without editing the SHB.
 			pe.passThrough = true
+			pe.seekable = nil
 			pc := pe.shb
 			pe.shb = []byte{}
 			return pc
 		}
 	}
+	// Is the SHB too large to be buffered for editing? Then pass it through
+	// unedited instead.
+	if pe.MaxSHBLength > 0 && pe.shbLen != 0 && int64(pe.shbLen) > pe.MaxSHBLength {
+		log.Warnf("section header block of %d octets exceeds buffer limit, passing through unedited", pe.shbLen)
+		pe.passThrough = true
+		pe.seekable = nil
+		pc := pe.shb
+		pe.shb = []byte{}
+		return pc
+	}
 	// Did we gather the complete SHB yet?
 	if pe.shbLen != 0 && uint32(len(pe.shb)) >= pe.shbLen {
 		return pe.processSHB()
@@ -188,11 +287,15 @@ func (pe *StreamEditor) processSHB() []byte {
 	}
 	comment += targetmarker
 	ci := ContainerInfo{
-		ContainerName: pe.container.Name,
-		ContainerType: pe.container.Type,
+		ContainerName: pe.container.QualifiedName(),
+		ContainerType: string(pe.container.Type),
 		NodeName:      pe.container.NodeName,
+		ContainerID:   pe.container.ContainerID,
+		SandboxID:     pe.container.SandboxID,
 		CaptureFilter: pe.captureFilter,
 		NoProm:        pe.noProm,
+
+		InterfaceAliases: pe.Aliases,
 	}
 	if cluster := pe.container.Cluster; cluster != nil {
 		ci.ClusterInfo = &ClusterInfo{
@@ -225,8 +328,18 @@ func (pe *StreamEditor) processSHB() []byte {
 	pe.Endian.PutUint64(shb[16:24], ^uint64(0))
 	copy(shb[24:], shbOpts)
 	pe.Endian.PutUint32(shb[shbLen-4:], uint32(shbLen))
+	if pe.Names != nil && len(pe.Names.Records) > 0 {
+		nrb := NewNameResolutionBlock(pe.Endian, pe.Names).Bytes()
+		log.Debugf("adding name resolution block with %d records", len(pe.Names.Records))
+		shb = append(shb, nrb...)
+		pe.sectionLen += uint64(len(nrb))
+	}
 	// Don't forget to add the overspill because we might have gotten
 	// more bytes than just the SHB.
+	if pe.seekable != nil {
+		pe.sectioning = true
+		pe.walk(pe.shb[pe.shbLen:])
+	}
 	shb = append(shb, pe.shb[pe.shbLen:]...)
 	// We're done and now enter pass-through mode.
 	pe.passThrough = true
@@ -234,6 +347,69 @@ func (pe *StreamEditor) processSHB() []byte {
 	return shb
 }
 
+// walk walks the blocks of the first section in the specified stream octets
+// in order to determine the length of the first section, up to the next SHB.
+func (pe *StreamEditor) walk(b []byte) {
+	for pe.sectioning && len(b) > 0 {
+		if pe.blockLeft > 0 {
+			n := uint64(len(b))
+			if n > pe.blockLeft {
+				n = pe.blockLeft
+			}
+			pe.blockLeft -= n
+			pe.sectionLen += n
+			b = b[n:]
+			continue
+		}
+		// Gather the block type and total length of the next block, which
+		// might arrive in pieces.
+		n := 8 - len(pe.blockHdr)
+		if n > len(b) {
+			n = len(b)
+		}
+		pe.blockHdr = append(pe.blockHdr, b[:n]...)
+		b = b[n:]
+		if len(pe.blockHdr) < 8 {
+			return
+		}
+		blocktype := pe.Endian.Uint32(pe.blockHdr[0:4])
+		totallen := pe.Endian.Uint32(pe.blockHdr[4:8])
+		pe.blockHdr = pe.blockHdr[:0]
+		if blocktype == BlockSHB {
+			// The first section ends where the next section begins.
+			pe.sectioning = false
+			pe.blockHdr = nil
+			return
+		}
+		if totallen < 12 || totallen&0x3 != 0 {
+			log.Warn("malformed pcapng block, cannot determine section length")
+			pe.seekable = nil
+			pe.sectioning = false
+			return
+		}
+		pe.sectionLen += 8
+		pe.blockLeft = uint64(totallen) - 8
+	}
+}
+
+// Finish finishes the edited pcapng stream: when the sink is seekable, then
+// Finish patches the length of the first section into the edited SHB in
+// place, unless the stream ended in the middle of a block. Otherwise, Finish
+// does nothing.
+func (pe *StreamEditor) Finish() error {
+	if pe.seekable == nil || !pe.passThrough || pe.blockLeft != 0 || len(pe.blockHdr) != 0 {
+		return nil
+	}
+	var sectionLen [8]byte
+	pe.Endian.PutUint64(sectionLen[:], pe.sectionLen)
+	if _, err := pe.seekable.WriteAt(sectionLen[:], pe.shbOffset+16); err != nil {
+		log.Debugf("cannot patch section length: %s", err.Error())
+		return err
+	}
+	log.Debugf("patched section length: %d", pe.sectionLen)
+	return nil
+}
+
 // shbLenEndianness detects the endianness as well as the length of a
 // section header block; for this, the first 12 octets are needed.
 func (pe *StreamEditor) shbLenEndianness() bool {
@@ -7,6 +7,10 @@ package pcapng
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -77,6 +81,26 @@ var _ = Describe("pcapng", func() {
 		}))
 	})
 
+	It("Passes SHB exceeding the buffer limit unedited", func() {
+		var b bytes.Buffer
+		se := NewStreamEditor(&b, nil, "", false)
+		se.MaxSHBLength = 0x1b
+		shb := []byte{
+			0x0a, 0x0d, 0x0d, 0x0a, // SHB block type
+			0x00, 0x00, 0x00, 0x1c, // total block length
+			0x1a, 0x2b, 0x3c, 0x4d, // byte-order magic
+			0x00, 0x01, 0x00, 0x00, // major, minor
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, // section length unknown
+			0x00, 0x00, 0x00, 0x1c, // total block length
+		}
+		n, err := se.Write(shb[:14])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(n).To(Equal(14))
+		_, err = se.Write(shb[14:])
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(b.Bytes()).Should(Equal(shb))
+	})
+
 	It("Edits SHB editing existing comment", func() {
 		var b bytes.Buffer
 		se := NewStreamEditor(&b, nil, "", false)
@@ -152,4 +176,143 @@ var _ = Describe("pcapng", func() {
 		}))
 	})
 
+	Context("name resolution", func() {
+
+		names := &NameResolution{
+			Records: []NameRecord{
+				{Addr: netip.MustParseAddr("10.96.0.10"), Names: []string{"kube-dns.kube-system.svc"}},
+				{Addr: netip.MustParseAddr("fd00::1"), Names: []string{"foo.default.svc", "bar.default.svc"}},
+			},
+			Options: []*Option{{Code: OptComment, Value: []byte("services")}},
+		}
+
+		It("round-trips name resolution blocks", func() {
+			for _, endian := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+				octets := NewNameResolutionBlock(endian, names).Bytes()
+				r := NewReader(bytes.NewReader(append(NewSectionHeaderBlock(endian).Bytes(), octets...)))
+				_, err := r.Next()
+				Expect(err).ShouldNot(HaveOccurred())
+				b, err := r.Next()
+				Expect(err).ShouldNot(HaveOccurred())
+				nrb, err := b.NameResolution()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(nrb.Records).To(Equal(names.Records))
+				Expect(nrb.Options).To(HaveLen(1))
+				Expect(nrb.Options[0].String()).To(Equal("services"))
+			}
+		})
+
+		It("rejects other and truncated blocks", func() {
+			_, err := (&Block{Type: BlockEPB, Endian: binary.LittleEndian}).NameResolution()
+			Expect(err).To(HaveOccurred())
+			_, err = (&Block{Type: BlockNRB, Body: []byte{1, 0, 8, 0}, Endian: binary.LittleEndian}).NameResolution()
+			Expect(err).To(MatchError(ErrShortBlock))
+		})
+
+		It("adds a name resolution block after the edited SHB", func() {
+			var b bytes.Buffer
+			se := NewStreamEditor(&b, nil, "", false)
+			se.Names = names
+			stream := capture(binary.LittleEndian, "foo", 1).Bytes()
+			_, err := se.Write(stream)
+			Expect(err).ShouldNot(HaveOccurred())
+			r := NewReader(&b)
+			types := []uint32{}
+			var nrb *NameResolution
+			for {
+				blk, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ShouldNot(HaveOccurred())
+				types = append(types, blk.Type)
+				if blk.Type == BlockNRB {
+					nrb, err = blk.NameResolution()
+					Expect(err).ShouldNot(HaveOccurred())
+				}
+			}
+			Expect(types).To(Equal([]uint32{BlockSHB, BlockNRB, BlockIDB, BlockEPB, BlockISB}))
+			Expect(nrb.Records).To(Equal(names.Records))
+		})
+
+	})
+
+	Context("seekable sinks", func() {
+
+		// edit writes the specified stream in small chunks through a stream
+		// editor to the sink and then finishes the edited stream.
+		edit := func(sink io.Writer, stream []byte) {
+			se := NewStreamEditor(sink, nil, "", false)
+			for len(stream) > 0 {
+				n := 7
+				if n > len(stream) {
+					n = len(stream)
+				}
+				_, err := se.Write(stream[:n])
+				Expect(err).ShouldNot(HaveOccurred())
+				stream = stream[n:]
+			}
+			Expect(se.Finish()).To(Succeed())
+		}
+
+		// sectionLen returns the section length of the first section of
+		// the specified pcapng stream, as well as the length of the SHB.
+		sectionLen := func(stream []byte) (uint64, int) {
+			r := NewReader(bytes.NewReader(stream))
+			b, err := r.Next()
+			Expect(err).ShouldNot(HaveOccurred())
+			return r.Endian().Uint64(stream[16:24]), len(b.Bytes())
+		}
+
+		tempFile := func() *os.File {
+			f, err := os.Create(filepath.Join(GinkgoT().TempDir(), "capture.pcapng"))
+			Expect(err).ShouldNot(HaveOccurred())
+			DeferCleanup(f.Close)
+			return f
+		}
+
+		It("patches the section length in place", func() {
+			f := tempFile()
+			edit(f, capture(binary.LittleEndian, "foo", 1, 2, 3).Bytes())
+			stream, err := os.ReadFile(f.Name())
+			Expect(err).ShouldNot(HaveOccurred())
+			length, shbLen := sectionLen(stream)
+			Expect(length).To(Equal(uint64(len(stream) - shbLen)))
+		})
+
+		It("patches only the length of the first section", func() {
+			f := tempFile()
+			second := capture(binary.BigEndian, "bar", 4).Bytes()
+			edit(f, append(capture(binary.BigEndian, "foo", 1, 2).Bytes(), second...))
+			stream, err := os.ReadFile(f.Name())
+			Expect(err).ShouldNot(HaveOccurred())
+			length, shbLen := sectionLen(stream)
+			Expect(length).To(Equal(uint64(len(stream) - len(second) - shbLen)))
+			Expect(stream[len(stream)-len(second):]).To(Equal(second))
+		})
+
+		It("accounts for added name resolution blocks", func() {
+			f := tempFile()
+			se := NewStreamEditor(f, nil, "", false)
+			se.Names = &NameResolution{Records: []NameRecord{
+				{Addr: netip.MustParseAddr("10.96.0.1"), Names: []string{"kubernetes.default.svc"}},
+			}}
+			_, err := se.Write(capture(binary.LittleEndian, "foo", 1, 2).Bytes())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(se.Finish()).To(Succeed())
+			stream, err := os.ReadFile(f.Name())
+			Expect(err).ShouldNot(HaveOccurred())
+			length, shbLen := sectionLen(stream)
+			Expect(length).To(Equal(uint64(len(stream) - shbLen)))
+		})
+
+		It("leaves the section length unspecified for non-seekable sinks", func() {
+			var b bytes.Buffer
+			edit(&b, capture(binary.LittleEndian, "foo", 1, 2, 3).Bytes())
+			length, _ := sectionLen(b.Bytes())
+			Expect(length).To(Equal(^uint64(0)))
+		})
+
+	})
+
 })
@@ -0,0 +1,145 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapngtest
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/siemens/csharg/pcapng"
+)
+
+// Builder generates a pcapng stream block by block.
+type Builder struct {
+	endian binary.ByteOrder
+	buff   bytes.Buffer
+}
+
+// New returns a new pcapng stream builder using the specified endianness.
+func New(endian binary.ByteOrder) *Builder {
+	return &Builder{endian: endian}
+}
+
+// Endian returns the endianness of the generated pcapng stream.
+func (b *Builder) Endian() binary.ByteOrder {
+	return b.endian
+}
+
+// Block appends the specified block, regardless of its endianness.
+func (b *Builder) Block(block *pcapng.Block) *Builder {
+	b.buff.Write(block.Bytes())
+	return b
+}
+
+// SHB appends a section header block with the specified options.
+func (b *Builder) SHB(opts ...*pcapng.Option) *Builder {
+	return b.Block(pcapng.NewSectionHeaderBlock(b.endian, opts...))
+}
+
+// IDB appends an interface description block for the specified link type
+// with the specified options.
+func (b *Builder) IDB(linktype uint16, opts ...*pcapng.Option) *Builder {
+	return b.Block(pcapng.NewInterfaceDescriptionBlock(b.endian, &pcapng.InterfaceDescription{
+		LinkType: linktype,
+		Options:  opts,
+	}))
+}
+
+// EPB appends an enhanced packet block for the specified interface, with the
+// timestamp in units of the interface's timestamp resolution.
+func (b *Builder) EPB(ifid uint32, timestamp uint64, data []byte, opts ...*pcapng.Option) *Builder {
+	return b.Block(pcapng.NewEnhancedPacketBlock(b.endian, &pcapng.EnhancedPacket{
+		InterfaceID: ifid,
+		Timestamp:   timestamp,
+		Data:        data,
+		Options:     opts,
+	}))
+}
+
+// SPB appends a simple packet block.
+func (b *Builder) SPB(data []byte) *Builder {
+	body := make([]byte, 4+(len(data)+3)&^3)
+	b.endian.PutUint32(body[0:4], uint32(len(data)))
+	copy(body[4:], data)
+	return b.Block(&pcapng.Block{Type: pcapng.BlockSPB, Body: body, Endian: b.endian})
+}
+
+// ISB appends an interface statistics block for the specified interface with
+// the specified options, such as counters created using Counter.
+func (b *Builder) ISB(ifid uint32, opts ...*pcapng.Option) *Builder {
+	return b.Block(pcapng.NewInterfaceStatisticsBlock(b.endian, &pcapng.InterfaceStatistics{
+		InterfaceID: ifid,
+		Options:     opts,
+	}))
+}
+
+// Counter returns an interface statistics counter option, such as for
+// pcapng.OptISBIfDrop, using the builder's endianness.
+func (b *Builder) Counter(code uint16, value uint64) *pcapng.Option {
+	return pcapng.CounterOption(code, value, b.endian)
+}
+
+// Bytes returns the octets of the pcapng stream generated so far.
+func (b *Builder) Bytes() []byte {
+	return append([]byte(nil), b.buff.Bytes()...)
+}
+
+// Len returns the length of the pcapng stream generated so far.
+func (b *Builder) Len() int {
+	return b.buff.Len()
+}
+
+// Comment returns a comment option.
+func Comment(comment string) *pcapng.Option {
+	return &pcapng.Option{Code: pcapng.OptComment, Value: []byte(comment)}
+}
+
+// IfName returns an interface name option for interface description blocks.
+func IfName(name string) *pcapng.Option {
+	return &pcapng.Option{Code: pcapng.OptIfName, Value: []byte(name)}
+}
+
+// Capture returns a simple pcapng stream with a single Ethernet interface
+// “eth0” and a single packet with a single octet for each of the specified
+// timestamps, followed by an interface statistics block.
+func Capture(endian binary.ByteOrder, timestamps ...uint64) []byte {
+	b := New(endian).SHB().IDB(pcapng.LinkTypeEthernet, IfName("eth0"))
+	for _, ts := range timestamps {
+		b.EPB(0, ts, []byte{byte(ts)})
+	}
+	return b.ISB(0, b.Counter(pcapng.OptISBIfDrop, 0)).Bytes()
+}
+
+// Chunk splits a stream into chunks of the specified size, with the last
+// chunk being shorter if necessary.
+func Chunk(stream []byte, size int) [][]byte {
+	if size <= 0 {
+		size = len(stream)
+	}
+	chunks := [][]byte{}
+	for len(stream) > size {
+		chunks = append(chunks, stream[:size])
+		stream = stream[size:]
+	}
+	if len(stream) > 0 {
+		chunks = append(chunks, stream)
+	}
+	return chunks
+}
+
+// ChunkSizes splits a stream into chunks of the specified sizes, in turn,
+// repeating the sizes as necessary. The last chunk is shorter if necessary.
+func ChunkSizes(stream []byte, sizes ...int) [][]byte {
+	chunks := [][]byte{}
+	for idx := 0; len(stream) > 0; idx++ {
+		size := len(stream)
+		if len(sizes) > 0 && sizes[idx%len(sizes)] > 0 && sizes[idx%len(sizes)] < size {
+			size = sizes[idx%len(sizes)]
+		}
+		chunks = append(chunks, stream[:size])
+		stream = stream[size:]
+	}
+	return chunks
+}
@@ -0,0 +1,99 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapngtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pcapng stream builder", func() {
+
+	DescribeTable("generates readable streams",
+		func(endian binary.ByteOrder) {
+			b := New(endian)
+			stream := b.SHB(Comment("hello")).
+				IDB(pcapng.LinkTypeEthernet, IfName("eth0")).
+				EPB(0, 42, []byte{1, 2, 3}).
+				SPB([]byte{4, 5}).
+				ISB(0, b.Counter(pcapng.OptISBIfDrop, 7)).
+				Bytes()
+			Expect(b.Len()).To(Equal(len(stream)))
+
+			r := pcapng.NewReader(bytes.NewReader(stream))
+			var types []uint32
+			for {
+				block, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+				Expect(block.Endian).To(Equal(endian))
+				types = append(types, block.Type)
+				switch block.Type {
+				case pcapng.BlockSHB:
+					sh, err := block.SectionHeader()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(sh.Comment()).To(Equal("hello"))
+				case pcapng.BlockIDB:
+					idb, err := block.InterfaceDescription()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(idb.Name()).To(Equal("eth0"))
+				case pcapng.BlockEPB:
+					epb, err := block.EnhancedPacket()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(epb.Timestamp).To(Equal(uint64(42)))
+					Expect(epb.Data).To(Equal([]byte{1, 2, 3}))
+				case pcapng.BlockISB:
+					isb, err := block.InterfaceStatistics()
+					Expect(err).NotTo(HaveOccurred())
+					drops, ok := isb.Counter(pcapng.OptISBIfDrop, endian)
+					Expect(ok).To(BeTrue())
+					Expect(drops).To(Equal(uint64(7)))
+				}
+			}
+			Expect(types).To(Equal([]uint32{
+				pcapng.BlockSHB, pcapng.BlockIDB, pcapng.BlockEPB, pcapng.BlockSPB, pcapng.BlockISB}))
+		},
+		Entry("little endian", binary.LittleEndian),
+		Entry("big endian", binary.BigEndian),
+	)
+
+	It("chunks streams", func() {
+		stream := []byte{1, 2, 3, 4, 5, 6, 7}
+		Expect(Chunk(stream, 3)).To(Equal([][]byte{{1, 2, 3}, {4, 5, 6}, {7}}))
+		Expect(Chunk(stream, 0)).To(Equal([][]byte{stream}))
+		Expect(ChunkSizes(stream, 1, 2)).To(Equal([][]byte{{1}, {2, 3}, {4}, {5, 6}, {7}}))
+		Expect(bytes.Join(ChunkSizes(stream, 5), nil)).To(Equal(stream))
+	})
+
+	DescribeTable("feeds the stream editor in chunks",
+		func(endian binary.ByteOrder, size int) {
+			stream := Capture(endian, 1, 2, 3)
+			var out bytes.Buffer
+			editor := pcapng.NewStreamEditor(&out, &api.Target{Name: "foo", Type: api.TypeDocker}, "", false)
+			for _, chunk := range Chunk(stream, size) {
+				Expect(editor.Write(chunk)).To(Equal(len(chunk)))
+			}
+			Expect(out.Len()).To(BeNumerically(">", len(stream)))
+			block, err := pcapng.NewReader(&out).Next()
+			Expect(err).NotTo(HaveOccurred())
+			sh, err := block.SectionHeader()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sh.Comment()).To(ContainSubstring("foo"))
+		},
+		Entry("little endian, single octets", binary.LittleEndian, 1),
+		Entry("big endian, odd chunks", binary.BigEndian, 7),
+		Entry("whole stream", binary.LittleEndian, 0),
+	)
+
+})
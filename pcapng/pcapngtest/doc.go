@@ -0,0 +1,18 @@
+/*
+Package pcapngtest provides test helpers for programmatically generating valid
+pcapng streams, so that pcapng stream editing and parsing can be verified
+without hand-maintained byte arrays.
+
+A [Builder] generates a pcapng stream block by block, using the chosen
+endianness:
+
+	stream := pcapngtest.New(binary.BigEndian).
+		SHB(pcapngtest.Comment("hello")).
+		IDB(pcapng.LinkTypeEthernet, pcapngtest.IfName("eth0")).
+		EPB(0, 1, []byte{0xde, 0xad}).
+		Bytes()
+
+Use [Chunk] or [ChunkSizes] to then split a stream into chunks, such as for
+simulating websocket messages arriving from a capture service.
+*/
+package pcapngtest
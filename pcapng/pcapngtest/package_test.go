@@ -0,0 +1,21 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapngtest
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPcapngtest(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Csharg pcapngtest package suite")
+}
@@ -0,0 +1,158 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxBlockSize limits the total length of individual blocks the Reader
+// accepts, in order to not get tricked into allocating huge amounts of memory
+// by corrupted packet captures.
+const MaxBlockSize = 64 * 1024 * 1024
+
+// Reader reads pcapng blocks from a packet capture stream, such as a pcapng
+// file. The Reader keeps track of the endianness of the current section as
+// well as the interfaces described in this section.
+type Reader struct {
+	section
+	r *bufio.Reader
+}
+
+// NewReader returns a new pcapng block reader, reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next block from the packet capture stream, or io.EOF when
+// the stream has ended cleanly at a block boundary.
+func (r *Reader) Next() (*Block, error) {
+	hdr := make([]byte, 8)
+	if _, err := io.ReadFull(r.r, hdr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated pcapng block header: %w", err)
+		}
+		return nil, err
+	}
+	var magic []byte
+	if isSHB(hdr) {
+		var err error
+		if magic, err = r.r.Peek(4); err != nil {
+			return nil, fmt.Errorf("truncated pcapng section header block: %w", err)
+		}
+	}
+	totallen, err := r.totalLength(hdr, magic)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, totallen-8)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return nil, fmt.Errorf("truncated pcapng block: %w", io.ErrUnexpectedEOF)
+	}
+	return r.block(hdr, body)
+}
+
+// section keeps track of the endianness, header and interfaces of the current
+// section of a pcapng stream.
+type section struct {
+	endian     binary.ByteOrder
+	interfaces []*InterfaceDescription
+	header     *SectionHeader
+}
+
+// Interfaces returns the descriptions of the interfaces in the current
+// section, indexed by their interface IDs.
+func (s *section) Interfaces() []*InterfaceDescription {
+	return s.interfaces
+}
+
+// Interface returns the description of the interface with the specified ID in
+// the current section, or nil if unknown.
+func (s *section) Interface(id uint32) *InterfaceDescription {
+	if int(id) >= len(s.interfaces) {
+		return nil
+	}
+	return s.interfaces[id]
+}
+
+// SectionHeader returns the header of the current section, or nil if no
+// section has been read yet.
+func (s *section) SectionHeader() *SectionHeader {
+	return s.header
+}
+
+// Endian returns the endianness of the current section, or nil if no section
+// has been read yet.
+func (s *section) Endian() binary.ByteOrder {
+	return s.endian
+}
+
+// isSHB returns true if the block header hdr is the beginning of a Section
+// Header Block.
+func isSHB(hdr []byte) bool {
+	return bytes.Equal(hdr[0:4], []byte{0x0a, 0x0d, 0x0d, 0x0a})
+}
+
+// totalLength returns the total length of the block with the specified
+// 8 octet block header. In case of a Section Header Block, magic must contain
+// the byte-order magic following the block header, so the endianness of the
+// new section can be determined.
+func (s *section) totalLength(hdr []byte, magic []byte) (uint32, error) {
+	if isSHB(hdr) {
+		// A new section starts and we need to determine its endianness
+		// first, before we can correctly decode the block length.
+		switch {
+		case bytes.Equal(magic, []byte{0x1a, 0x2b, 0x3c, 0x4d}):
+			s.endian = binary.BigEndian
+		case bytes.Equal(magic, []byte{0x4d, 0x3c, 0x2b, 0x1a}):
+			s.endian = binary.LittleEndian
+		default:
+			return 0, errors.New("invalid pcapng byte-order magic")
+		}
+		s.interfaces = nil
+	} else if s.endian == nil {
+		return 0, errors.New("invalid pcapng stream; must begin with section header block")
+	}
+	totallen := s.endian.Uint32(hdr[4:8])
+	if totallen < 12 || totallen&3 != 0 || totallen > MaxBlockSize {
+		return 0, fmt.Errorf("invalid pcapng block total length %d", totallen)
+	}
+	return totallen, nil
+}
+
+// block returns the block consisting of the specified block header and the
+// remaining block octets, including the trailing total length. Section headers
+// and interface descriptions are tracked.
+func (s *section) block(hdr []byte, body []byte) (*Block, error) {
+	totallen := s.endian.Uint32(hdr[4:8])
+	if trailer := s.endian.Uint32(body[len(body)-4:]); trailer != totallen {
+		return nil, fmt.Errorf("pcapng block total length mismatch %d vs. %d", totallen, trailer)
+	}
+	b := &Block{
+		Type:   s.endian.Uint32(hdr[0:4]),
+		Body:   body[:len(body)-4],
+		Endian: s.endian,
+	}
+	switch b.Type {
+	case BlockSHB:
+		shb, err := b.SectionHeader()
+		if err != nil {
+			return nil, err
+		}
+		s.header = shb
+	case BlockIDB:
+		idb, err := b.InterfaceDescription()
+		if err != nil {
+			return nil, err
+		}
+		s.interfaces = append(s.interfaces, idb)
+	}
+	return b, nil
+}
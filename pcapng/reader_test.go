@@ -0,0 +1,140 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pcapng reader", func() {
+
+	DescribeTable("reads blocks written in either endianness",
+		func(endian binary.ByteOrder) {
+			var b bytes.Buffer
+			b.Write(NewSectionHeaderBlock(endian,
+				&Option{Code: OptComment, Value: []byte("Kuhbernetes")}).Bytes())
+			b.Write(NewInterfaceDescriptionBlock(endian, &InterfaceDescription{
+				LinkType: LinkTypeEthernet,
+				Options:  []*Option{{Code: OptIfName, Value: []byte("eth0")}},
+			}).Bytes())
+			b.Write(NewEnhancedPacketBlock(endian, &EnhancedPacket{
+				Timestamp: 1234567890,
+				Data:      []byte{1, 2, 3, 4, 5},
+			}).Bytes())
+
+			r := NewReader(&b)
+			shb, err := r.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shb.Type).To(Equal(BlockSHB))
+			Expect(r.Endian()).To(Equal(endian))
+			Expect(r.SectionHeader().Comment()).To(Equal("Kuhbernetes"))
+			Expect(r.SectionHeader().SectionLength).To(Equal(int64(-1)))
+
+			idb, err := r.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(idb.Type).To(Equal(BlockIDB))
+			Expect(r.Interfaces()).To(HaveLen(1))
+			Expect(r.Interface(0).Name()).To(Equal("eth0"))
+			Expect(r.Interface(0).LinkType).To(Equal(LinkTypeEthernet))
+			Expect(r.Interface(0).Time(1234567890)).To(
+				Equal(time.Unix(1234, 567890000)))
+
+			epb, err := r.Next()
+			Expect(err).NotTo(HaveOccurred())
+			p, err := epb.EnhancedPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Timestamp).To(Equal(uint64(1234567890)))
+			Expect(p.CapturedLength).To(Equal(uint32(5)))
+			Expect(p.OriginalLength).To(Equal(uint32(5)))
+			Expect(p.Data).To(Equal([]byte{1, 2, 3, 4, 5}))
+
+			_, err = r.Next()
+			Expect(err).To(Equal(io.EOF))
+		},
+		Entry("big endian", binary.BigEndian),
+		Entry("little endian", binary.LittleEndian),
+	)
+
+	It("rejects streams not starting with a section header", func() {
+		b := NewInterfaceDescriptionBlock(binary.BigEndian, &InterfaceDescription{}).Bytes()
+		_, err := NewReader(bytes.NewReader(b)).Next()
+		Expect(err).To(MatchError(ContainSubstring("must begin with section header block")))
+	})
+
+	It("rejects truncated blocks", func() {
+		b := NewSectionHeaderBlock(binary.BigEndian).Bytes()
+		_, err := NewReader(bytes.NewReader(b[:len(b)-2])).Next()
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	It("slices a time range", func() {
+		var in bytes.Buffer
+		in.Write(NewSectionHeaderBlock(binary.LittleEndian,
+			&Option{Code: OptComment, Value: []byte("Kuhbernetes")}).Bytes())
+		in.Write(NewInterfaceDescriptionBlock(binary.LittleEndian, &InterfaceDescription{
+			LinkType: LinkTypeEthernet,
+		}).Bytes())
+		for sec := uint64(1); sec <= 5; sec++ {
+			in.Write(NewEnhancedPacketBlock(binary.LittleEndian, &EnhancedPacket{
+				Timestamp: sec * 1000000,
+				Data:      []byte{byte(sec)},
+			}).Bytes())
+		}
+		in.Write(NewInterfaceStatisticsBlock(binary.LittleEndian, &InterfaceStatistics{}).Bytes())
+
+		Expect(FirstPacketTime(bytes.NewReader(in.Bytes()))).To(Equal(time.Unix(1, 0)))
+
+		var out bytes.Buffer
+		n, err := Slice(&out, bytes.NewReader(in.Bytes()), time.Unix(2, 0), time.Unix(4, 0))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+
+		r := NewReader(&out)
+		var types []uint32
+		var data []byte
+		for {
+			b, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			types = append(types, b.Type)
+			if b.Type == BlockEPB {
+				p, err := b.EnhancedPacket()
+				Expect(err).NotTo(HaveOccurred())
+				data = append(data, p.Data...)
+			}
+		}
+		Expect(types).To(Equal([]uint32{BlockSHB, BlockIDB, BlockEPB, BlockEPB}))
+		Expect(data).To(Equal([]byte{2, 3}))
+		Expect(r.SectionHeader().Comment()).To(Equal("Kuhbernetes"))
+		Expect(r.SectionHeader().SectionLength).To(Equal(int64(-1)))
+	})
+
+	It("extracts container information", func() {
+		ci, err := ParseContainerInfo("ABC\n" + targetmarker + "container-name: foo\nnode-name: bar\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ci).NotTo(BeNil())
+		Expect(ci.ContainerName).To(Equal("foo"))
+		Expect(ci.NodeName).To(Equal("bar"))
+
+		Expect(ParseContainerInfo("ABC")).To(BeNil())
+	})
+
+	It("extracts container runtime identifiers", func() {
+		ci, err := ParseContainerInfo(targetmarker + "container-name: foo\ncontainer-id: c0ffee\nsandbox-id: deadbeef\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ci).NotTo(BeNil())
+		Expect(ci.ContainerID).To(Equal("c0ffee"))
+		Expect(ci.SandboxID).To(Equal("deadbeef"))
+	})
+
+})
@@ -0,0 +1,81 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"io"
+)
+
+// Renamer rewrites the names of network interfaces in the interface
+// description blocks of a pcapng stream written to it, replacing kernel-style
+// names such as “eth0@if12” with aliases, such as readable names derived from
+// discovery data. The kernel name of a renamed interface is kept as its
+// interface description, unless the interface already has a description.
+// Interfaces without an alias keep their names. All other blocks are passed
+// through unmodified, except for section headers, where the section length
+// gets marked as unknown, as renaming changes the lengths of interface
+// description blocks.
+type Renamer struct {
+	sink    io.Writer
+	aliases map[string]string // aliases indexed by kernel interface names.
+	scanner *Scanner
+	out     []byte // blocks completed by the current write.
+}
+
+var _ io.Writer = (*Renamer)(nil)
+
+// NewRenamer returns a new Renamer writing the renamed pcapng stream to w,
+// using the specified aliases indexed by the kernel names of the network
+// interfaces.
+func NewRenamer(w io.Writer, aliases map[string]string) *Renamer {
+	r := &Renamer{
+		sink:    w,
+		aliases: aliases,
+	}
+	r.scanner = NewScanner(r.rename)
+	return r
+}
+
+// Write writes octets from a pcapng stream into the renamer, which then
+// writes all blocks completed by these octets to its sink in a single write.
+func (r *Renamer) Write(p []byte) (n int, err error) {
+	r.out = r.out[:0]
+	_, err = r.scanner.Write(p)
+	if len(r.out) != 0 {
+		if _, werr := r.sink.Write(r.out); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rename renames the network interface described by an IDB, if there's an
+// alias for it, and queues the (renamed) block for writing to the sink.
+func (r *Renamer) rename(b *Block) error {
+	switch b.Type {
+	case BlockSHB:
+		if len(b.Body) >= 16 {
+			b.Endian.PutUint64(b.Body[8:16], ^uint64(0))
+		}
+	case BlockIDB:
+		idb, err := b.InterfaceDescription()
+		if err != nil {
+			return err
+		}
+		name := idb.Name()
+		if alias, ok := r.aliases[name]; ok && name != "" {
+			if idb.Description() == "" {
+				idb.Options = setOption(idb.Options, OptIfDescription, []byte(name))
+			}
+			idb.Options = setOption(idb.Options, OptIfName, []byte(alias))
+			b = NewInterfaceDescriptionBlock(b.Endian, idb)
+		}
+	}
+	r.out = append(r.out, b.Bytes()...)
+	return nil
+}
@@ -0,0 +1,67 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("renaming network interfaces", func() {
+
+	It("renames interfaces with aliases written in arbitrary chunks", func() {
+		stream := capture(binary.LittleEndian, "foo", 1, 2).Bytes()
+		var out bytes.Buffer
+		r := NewRenamer(&out, map[string]string{"eth0": "eth0 (default/bar)"})
+		for len(stream) > 0 {
+			n := 5
+			if n > len(stream) {
+				n = len(stream)
+			}
+			Expect(r.Write(stream[:n])).To(Equal(n))
+			stream = stream[n:]
+		}
+
+		pr := NewReader(&out)
+		var types []uint32
+		for {
+			b, err := pr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			types = append(types, b.Type)
+		}
+		Expect(types).To(Equal([]uint32{BlockSHB, BlockIDB, BlockEPB, BlockEPB, BlockISB}))
+		Expect(pr.SectionHeader().SectionLength).To(Equal(int64(-1)))
+		idb := pr.Interface(0)
+		Expect(idb.Name()).To(Equal("eth0 (default/bar)"))
+		Expect(idb.Description()).To(Equal("eth0"))
+	})
+
+	It("passes streams without matching aliases through unmodified", func() {
+		stream := capture(binary.BigEndian, "foo", 1, 2, 3).Bytes()
+		var out bytes.Buffer
+		r := NewRenamer(&out, map[string]string{"lo": "loopback"})
+		Expect(r.Write(stream)).To(Equal(len(stream)))
+		Expect(out.Bytes()).To(Equal(stream))
+	})
+
+	It("marks known section lengths as unknown", func() {
+		shb := NewSectionHeaderBlock(binary.LittleEndian)
+		binary.LittleEndian.PutUint64(shb.Body[8:16], 42)
+		var out bytes.Buffer
+		r := NewRenamer(&out, nil)
+		Expect(r.Write(shb.Bytes())).Error().NotTo(HaveOccurred())
+		pr := NewReader(&out)
+		Expect(pr.Next()).Error().NotTo(HaveOccurred())
+		Expect(pr.SectionHeader().SectionLength).To(Equal(int64(-1)))
+	})
+
+})
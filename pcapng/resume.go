@@ -0,0 +1,173 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrResumeEndianness signals that a resumed pcapng stream differs in
+// endianness from the stream it resumes, so it cannot be spliced into the
+// section of the original stream.
+var ErrResumeEndianness = errors.New("resumed pcapng stream differs in endianness")
+
+// Resumer splices pcapng streams resuming an interrupted pcapng stream into
+// the section of the original stream, such as when a capture stream gets
+// re-requested after its connection to the capture service broke. After
+// calling Resume, the Resumer drops the section header block of the resumed
+// stream, as well as the interface description blocks of the interfaces
+// already described by the original stream with the same name, link type, and
+// timestamp resolution; interfaces new to the section get appended. The
+// interface IDs of packets and statistics in the resumed stream then get
+// mapped to the interface IDs of the section. Incomplete blocks of the
+// interrupted stream are dropped, so the Resumer only ever writes complete
+// blocks.
+type Resumer struct {
+	sink    io.Writer
+	scanner *Scanner
+	out     []byte // blocks completed by the current write.
+
+	endian  binary.ByteOrder        // of the section, or nil if none yet.
+	ifaces  []*InterfaceDescription // interfaces of the section.
+	resumed bool                    // splicing a resumed stream.
+	ifmap   []uint32                // maps resumed to section interface IDs.
+	claimed map[uint32]bool         // section interfaces of the resumed stream.
+}
+
+var _ io.Writer = (*Resumer)(nil)
+
+// NewResumer returns a new Resumer writing the spliced pcapng stream to w.
+func NewResumer(w io.Writer) *Resumer {
+	r := &Resumer{sink: w}
+	r.scanner = NewScanner(r.splice)
+	return r
+}
+
+// Write writes octets from a pcapng stream into the resumer, which then
+// writes all blocks completed by these octets to its sink in a single write.
+func (r *Resumer) Write(p []byte) (n int, err error) {
+	r.out = r.out[:0]
+	_, err = r.scanner.Write(p)
+	if len(r.out) != 0 {
+		if _, werr := r.sink.Write(r.out); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resume signals that the octets written next belong to a new pcapng stream
+// resuming the stream written so far, dropping any incomplete block of the
+// interrupted stream. Before the interrupted stream has written its section
+// header, the new stream simply replaces it.
+func (r *Resumer) Resume() {
+	r.scanner = NewScanner(r.splice)
+	r.resumed = r.endian != nil
+	r.ifmap = nil
+	r.claimed = map[uint32]bool{}
+}
+
+// splice queues the block for writing to the sink, unless it belongs to the
+// beginning of a resumed stream and duplicates the section header or an
+// interface description of the section.
+func (r *Resumer) splice(b *Block) error {
+	if !r.resumed {
+		switch b.Type {
+		case BlockSHB:
+			r.endian = b.Endian
+			r.ifaces = nil
+		case BlockIDB:
+			idb, err := b.InterfaceDescription()
+			if err != nil {
+				return err
+			}
+			r.ifaces = append(r.ifaces, idb)
+		}
+		r.out = append(r.out, b.Bytes()...)
+		return nil
+	}
+	switch b.Type {
+	case BlockSHB:
+		// Only the first section header of the resumed stream gets dropped;
+		// any further section stands on its own.
+		if r.ifmap != nil {
+			r.resumed = false
+			return r.splice(b)
+		}
+		if b.Endian != r.endian {
+			return ErrResumeEndianness
+		}
+		r.ifmap = []uint32{}
+		return nil
+	case BlockIDB:
+		idb, err := b.InterfaceDescription()
+		if err != nil {
+			return err
+		}
+		id, ok := r.sectionInterface(idb)
+		r.ifmap = append(r.ifmap, id)
+		if ok {
+			return nil
+		}
+	case BlockEPB, BlockISB:
+		if len(b.Body) < 4 {
+			return ErrShortBlock
+		}
+		b.Endian.PutUint32(b.Body[0:4], r.mapInterface(b.Endian.Uint32(b.Body[0:4])))
+	case BlockSPB:
+		// Simple packets are always from the first interface, so they need
+		// to become enhanced packets when that interface maps elsewhere.
+		if id := r.mapInterface(0); id != 0 && len(b.Body) >= 4 {
+			origlen := b.Endian.Uint32(b.Body[0:4])
+			data := b.Body[4:]
+			if uint64(origlen) < uint64(len(data)) {
+				data = data[:origlen]
+			}
+			b = NewEnhancedPacketBlock(b.Endian, &EnhancedPacket{
+				InterfaceID:    id,
+				Timestamp:      r.ifaces[id].Timestamp(time.Now()),
+				OriginalLength: origlen,
+				Data:           data,
+			})
+		}
+	}
+	r.out = append(r.out, b.Bytes()...)
+	return nil
+}
+
+// sectionInterface returns the ID of the first interface of the section
+// matching the specified interface description of the resumed stream and not
+// yet matched by another interface of the resumed stream, and true. If there
+// is no such interface, it adds the interface to the section instead,
+// returning its new ID and false.
+func (r *Resumer) sectionInterface(idb *InterfaceDescription) (uint32, bool) {
+	for id, iface := range r.ifaces {
+		if r.claimed[uint32(id)] || iface.LinkType != idb.LinkType ||
+			iface.Name() != idb.Name() || iface.TicksPerSecond() != idb.TicksPerSecond() {
+			continue
+		}
+		r.claimed[uint32(id)] = true
+		return uint32(id), true
+	}
+	r.ifaces = append(r.ifaces, idb)
+	id := uint32(len(r.ifaces) - 1)
+	r.claimed[id] = true
+	return id, false
+}
+
+// mapInterface maps an interface ID of the resumed stream to the interface ID
+// of the section, leaving unknown interface IDs as they are.
+func (r *Resumer) mapInterface(id uint32) uint32 {
+	if int(id) < len(r.ifmap) {
+		return r.ifmap[id]
+	}
+	return id
+}
@@ -0,0 +1,106 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// readBlocks returns the block types, the interface names, and the interface
+// IDs and data of the packets of a single-section pcapng stream.
+func readBlocks(stream []byte) (types []uint32, ifnames []string, ifids []uint32, data []byte) {
+	r := NewReader(bytes.NewReader(stream))
+	for {
+		b, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		Expect(err).NotTo(HaveOccurred())
+		types = append(types, b.Type)
+		switch b.Type {
+		case BlockIDB:
+			idb, err := b.InterfaceDescription()
+			Expect(err).NotTo(HaveOccurred())
+			ifnames = append(ifnames, idb.Name())
+		case BlockEPB:
+			epb, err := b.EnhancedPacket()
+			Expect(err).NotTo(HaveOccurred())
+			ifids = append(ifids, epb.InterfaceID)
+			data = append(data, epb.Data...)
+		}
+	}
+	return
+}
+
+var _ = Describe("resuming pcapng streams", func() {
+
+	It("splices resumed streams into the original section", func() {
+		var out bytes.Buffer
+		r := NewResumer(&out)
+		first := capture(binary.LittleEndian, "foo", 1, 2).Bytes()
+		// Interrupt the first stream in the middle of its final statistics.
+		Expect(r.Write(first[:len(first)-5])).To(Equal(len(first) - 5))
+		r.Resume()
+		second := capture(binary.LittleEndian, "foo", 3, 4).Bytes()
+		Expect(r.Write(second)).To(Equal(len(second)))
+
+		types, ifnames, ifids, data := readBlocks(out.Bytes())
+		Expect(types).To(Equal([]uint32{
+			BlockSHB, BlockIDB, BlockEPB, BlockEPB, BlockEPB, BlockEPB, BlockISB}))
+		Expect(ifnames).To(Equal([]string{"eth0"}))
+		Expect(ifids).To(Equal([]uint32{0, 0, 0, 0}))
+		Expect(data).To(Equal([]byte{1, 2, 3, 4}))
+	})
+
+	It("adds new interfaces and maps interface IDs", func() {
+		endian := binary.BigEndian
+		var out bytes.Buffer
+		r := NewResumer(&out)
+		Expect(r.Write(capture(endian, "foo", 1).Bytes())).Error().NotTo(HaveOccurred())
+		r.Resume()
+		var second bytes.Buffer
+		second.Write(NewSectionHeaderBlock(endian).Bytes())
+		for _, name := range []string{"lo", "eth0"} {
+			second.Write(NewInterfaceDescriptionBlock(endian, &InterfaceDescription{
+				LinkType: LinkTypeEthernet,
+				Options:  []*Option{{Code: OptIfName, Value: []byte(name)}},
+			}).Bytes())
+		}
+		second.Write(NewEnhancedPacketBlock(endian, &EnhancedPacket{InterfaceID: 1, Data: []byte{2}}).Bytes())
+		second.Write(NewEnhancedPacketBlock(endian, &EnhancedPacket{InterfaceID: 0, Data: []byte{3}}).Bytes())
+		second.Write((&Block{Type: BlockSPB, Body: []byte{0, 0, 0, 1, 4}, Endian: endian}).Bytes())
+		Expect(r.Write(second.Bytes())).Error().NotTo(HaveOccurred())
+
+		types, ifnames, ifids, data := readBlocks(out.Bytes())
+		Expect(types).To(Equal([]uint32{
+			BlockSHB, BlockIDB, BlockEPB, BlockISB, BlockIDB, BlockEPB, BlockEPB, BlockEPB}))
+		Expect(ifnames).To(Equal([]string{"eth0", "lo"}))
+		Expect(ifids).To(Equal([]uint32{0, 0, 1, 1}))
+		Expect(data).To(Equal([]byte{1, 2, 3, 4}))
+	})
+
+	It("replaces streams interrupted before their section header", func() {
+		var out bytes.Buffer
+		r := NewResumer(&out)
+		stream := capture(binary.LittleEndian, "foo", 1).Bytes()
+		Expect(r.Write(stream[:10])).To(Equal(10))
+		r.Resume()
+		Expect(r.Write(stream)).To(Equal(len(stream)))
+		Expect(out.Bytes()).To(Equal(stream))
+	})
+
+	It("rejects resumed streams of different endianness", func() {
+		r := NewResumer(io.Discard)
+		Expect(r.Write(capture(binary.LittleEndian, "foo", 1).Bytes())).Error().NotTo(HaveOccurred())
+		r.Resume()
+		Expect(r.Write(capture(binary.BigEndian, "foo", 2).Bytes())).Error().To(MatchError(ErrResumeEndianness))
+	})
+
+})
@@ -0,0 +1,159 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Ring continuously retains the most recent packets of a pcapng stream
+// written to it, limited by the age of the packets relative to the latest
+// packet, as well as by the overall size of the retained blocks. A snapshot of
+// the retained packets can be taken at any time as a valid pcapng stream.
+//
+// Only the current section is retained: when a new section begins, the
+// packets of the previous section are discarded. The section header and
+// interface description blocks of the current section are always retained
+// and don't count towards the size limit.
+type Ring struct {
+	maxAge  time.Duration
+	maxSize int64
+
+	mu      sync.Mutex
+	scanner *Scanner
+	header  [][]byte    // SHB and IDBs of the current section.
+	blocks  []ringBlock // retained blocks, oldest first.
+	size    int64       // octets of the retained blocks.
+	latest  time.Time   // timestamp of the latest packet.
+}
+
+// ringBlock is a retained block together with the timestamp of its packet, or
+// otherwise the timestamp of the packet preceding it.
+type ringBlock struct {
+	octets []byte
+	ts     time.Time
+	packet bool
+}
+
+var _ io.WriteCloser = (*Ring)(nil)
+
+// NewRing returns a new Ring retaining the packets of up to the specified age
+// relative to the latest packet and up to the specified overall size in
+// octets. A zero age or size doesn't limit the age or size respectively.
+func NewRing(maxAge time.Duration, maxSize int64) *Ring {
+	r := &Ring{maxAge: maxAge, maxSize: maxSize}
+	r.scanner = NewScanner(r.block)
+	return r
+}
+
+// Write writes octets of a pcapng stream to the Ring.
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scanner.Write(p)
+}
+
+// Close signals the end of the pcapng stream, returning an error if the
+// stream ended in the middle of a block. The retained packets can still be
+// snapshotted afterwards.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.scanner.Close()
+}
+
+// block retains a complete block, evicting the oldest blocks as necessary.
+// Callers must hold the lock.
+func (r *Ring) block(b *Block) error {
+	octets := b.Bytes()
+	switch b.Type {
+	case BlockSHB:
+		r.header = [][]byte{octets}
+		r.blocks = nil
+		r.size = 0
+		r.latest = time.Time{}
+		return nil
+	case BlockIDB:
+		r.header = append(r.header, octets)
+		return nil
+	case BlockEPB:
+		if epb, err := b.EnhancedPacket(); err == nil {
+			if idesc := r.scanner.Interface(epb.InterfaceID); idesc != nil {
+				if ts := idesc.Time(epb.Timestamp); ts.After(r.latest) {
+					r.latest = ts
+				}
+			}
+		}
+	}
+	r.blocks = append(r.blocks, ringBlock{octets: octets, ts: r.latest, packet: b.Type == BlockEPB || b.Type == BlockSPB})
+	r.size += int64(len(octets))
+	r.evict()
+	return nil
+}
+
+// evict evicts the oldest blocks exceeding the age or size limits. Callers
+// must hold the lock.
+func (r *Ring) evict() {
+	var oldest time.Time
+	if r.maxAge > 0 {
+		oldest = r.latest.Add(-r.maxAge)
+	}
+	n := 0
+	for n < len(r.blocks) {
+		if r.maxSize > 0 && r.size > r.maxSize {
+			r.size -= int64(len(r.blocks[n].octets))
+			n++
+			continue
+		}
+		if r.maxAge > 0 && r.blocks[n].ts.Before(oldest) {
+			r.size -= int64(len(r.blocks[n].octets))
+			n++
+			continue
+		}
+		break
+	}
+	if n > 0 {
+		// Drop the references to the evicted blocks, so that they can be
+		// garbage collected even before the slice gets reallocated.
+		for idx := 0; idx < n; idx++ {
+			r.blocks[idx] = ringBlock{}
+		}
+		r.blocks = r.blocks[n:]
+	}
+}
+
+// Size returns the overall size of the retained blocks in octets, excluding
+// the section header and interface descriptions.
+func (r *Ring) Size() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// Snapshot writes the retained packets as a pcapng stream to w, starting with
+// the section header and interface descriptions. It returns the number of
+// packets written. Writing to the Ring may continue while taking a snapshot.
+func (r *Ring) Snapshot(w io.Writer) (packets int, err error) {
+	r.mu.Lock()
+	header := append([][]byte(nil), r.header...)
+	blocks := append([]ringBlock(nil), r.blocks...)
+	r.mu.Unlock()
+	for _, octets := range header {
+		if _, err := w.Write(octets); err != nil {
+			return 0, err
+		}
+	}
+	for _, block := range blocks {
+		if _, err := w.Write(block.octets); err != nil {
+			return packets, err
+		}
+		if block.packet {
+			packets++
+		}
+	}
+	return packets, nil
+}
@@ -0,0 +1,93 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// timestamps returns the (microsecond) timestamps of the packets in the
+// specified pcapng stream, failing if the stream isn't valid.
+func timestamps(stream []byte) []uint64 {
+	r := NewReader(bytes.NewReader(stream))
+	ts := []uint64{}
+	for {
+		b, err := r.Next()
+		if err != nil {
+			return ts
+		}
+		if b.Type == BlockEPB {
+			epb, err := b.EnhancedPacket()
+			ExpectWithOffset(1, err).NotTo(HaveOccurred())
+			ts = append(ts, epb.Timestamp)
+		}
+	}
+}
+
+var _ = Describe("pcapng ring buffer", func() {
+
+	const second = uint64(time.Second / time.Microsecond)
+
+	It("snapshots nothing before the stream begins", func() {
+		var b bytes.Buffer
+		Expect(NewRing(0, 0).Snapshot(&b)).To(BeZero())
+		Expect(b.Len()).To(BeZero())
+	})
+
+	It("retains the packets of the most recent duration", func() {
+		r := NewRing(2*time.Second, 0)
+		stream := capture(binary.LittleEndian, "foo", 1*second, 2*second, 3*second, 4*second, 5*second)
+		for _, chunk := range [][]byte{stream.Next(50), stream.Next(7), stream.Bytes()} {
+			Expect(r.Write(chunk)).Error().NotTo(HaveOccurred())
+		}
+		Expect(r.Close()).To(Succeed())
+
+		var b bytes.Buffer
+		Expect(r.Snapshot(&b)).To(Equal(3))
+		Expect(timestamps(b.Bytes())).To(Equal([]uint64{3 * second, 4 * second, 5 * second}))
+		rd := NewReader(&b)
+		_, err := rd.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rd.SectionHeader().Comment()).To(ContainSubstring("foo"))
+	})
+
+	It("retains the packets up to the size limit", func() {
+		var stream bytes.Buffer
+		stream.Write(NewSectionHeaderBlock(binary.BigEndian).Bytes())
+		stream.Write(NewInterfaceDescriptionBlock(binary.BigEndian, &InterfaceDescription{
+			LinkType: LinkTypeEthernet,
+		}).Bytes())
+		var packet []byte
+		for ts := uint64(1); ts <= 4; ts++ {
+			packet = NewEnhancedPacketBlock(binary.BigEndian, &EnhancedPacket{
+				Timestamp: ts,
+				Data:      []byte{byte(ts)},
+			}).Bytes()
+			stream.Write(packet)
+		}
+		r := NewRing(0, int64(2*len(packet)))
+		Expect(r.Write(stream.Bytes())).Error().NotTo(HaveOccurred())
+		Expect(r.Size()).To(Equal(int64(2 * len(packet))))
+
+		var b bytes.Buffer
+		Expect(r.Snapshot(&b)).To(Equal(2))
+		Expect(timestamps(b.Bytes())).To(Equal([]uint64{3, 4}))
+	})
+
+	It("retains only the current section", func() {
+		r := NewRing(0, 0)
+		Expect(r.Write(capture(binary.LittleEndian, "foo", 1, 2).Bytes())).Error().NotTo(HaveOccurred())
+		Expect(r.Write(capture(binary.BigEndian, "bar", 3).Bytes())).Error().NotTo(HaveOccurred())
+		var b bytes.Buffer
+		Expect(r.Snapshot(&b)).To(Equal(1))
+		Expect(timestamps(b.Bytes())).To(Equal([]uint64{3}))
+	})
+
+})
@@ -0,0 +1,82 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"fmt"
+	"io"
+)
+
+// Scanner scans a pcapng stream written to it for complete blocks, handing
+// them to a callback one after another. In contrast to the Reader, a Scanner
+// is a writer and thus can be placed into the stream of octets arriving from
+// a capture service. Like the Reader, the Scanner keeps track of the
+// endianness of the current section as well as its interfaces.
+type Scanner struct {
+	section
+	fn   func(b *Block) error
+	buff []byte
+	err  error
+}
+
+var _ io.WriteCloser = (*Scanner)(nil)
+
+// NewScanner returns a new pcapng block scanner that calls fn for each
+// complete block written to it. When fn returns an error, this error is
+// returned from the current and all future writes.
+func NewScanner(fn func(b *Block) error) *Scanner {
+	return &Scanner{fn: fn}
+}
+
+// Write writes octets from a pcapng stream into the scanner, calling the
+// callback for each block that has been completed by these octets.
+func (s *Scanner) Write(p []byte) (n int, err error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.buff = append(s.buff, p...)
+	for {
+		if len(s.buff) < 12 {
+			break
+		}
+		totallen, err := s.totalLength(s.buff[0:8], s.buff[8:12])
+		if err != nil {
+			s.err = err
+			return 0, err
+		}
+		if uint32(len(s.buff)) < totallen {
+			break
+		}
+		// Hand out a copy of the block so that the callback might safely
+		// keep the block.
+		body := make([]byte, totallen-8)
+		copy(body, s.buff[8:totallen])
+		b, err := s.block(s.buff[0:8], body)
+		if err == nil {
+			err = s.fn(b)
+		}
+		if err != nil {
+			s.err = err
+			return 0, err
+		}
+		s.buff = s.buff[totallen:]
+	}
+	if len(s.buff) == 0 {
+		s.buff = nil
+	}
+	return len(p), nil
+}
+
+// Close signals the end of the pcapng stream, returning an error if the
+// stream ended in the middle of a block.
+func (s *Scanner) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.buff) != 0 {
+		return fmt.Errorf("truncated pcapng block: %w", io.ErrUnexpectedEOF)
+	}
+	return nil
+}
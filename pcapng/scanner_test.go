@@ -0,0 +1,55 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pcapng scanner", func() {
+
+	It("scans blocks written in arbitrary chunks", func() {
+		stream := capture(binary.BigEndian, "foo", 1, 2, 3).Bytes()
+		var types []uint32
+		s := NewScanner(func(b *Block) error {
+			types = append(types, b.Type)
+			return nil
+		})
+		for len(stream) > 0 {
+			n := 7
+			if n > len(stream) {
+				n = len(stream)
+			}
+			Expect(s.Write(stream[:n])).To(Equal(n))
+			stream = stream[n:]
+		}
+		Expect(s.Close()).To(Succeed())
+		Expect(types).To(Equal([]uint32{
+			BlockSHB, BlockIDB, BlockEPB, BlockEPB, BlockEPB, BlockISB}))
+		Expect(s.Endian()).To(Equal(binary.BigEndian))
+		Expect(s.Interfaces()).To(HaveLen(1))
+	})
+
+	It("reports truncated streams", func() {
+		stream := capture(binary.LittleEndian, "foo", 1).Bytes()
+		s := NewScanner(func(b *Block) error { return nil })
+		Expect(s.Write(stream[:len(stream)-1])).To(Equal(len(stream) - 1))
+		Expect(s.Close()).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	It("stops on callback errors", func() {
+		stream := capture(binary.LittleEndian, "foo", 1).Bytes()
+		s := NewScanner(func(b *Block) error { return io.ErrClosedPipe })
+		_, err := s.Write(stream)
+		Expect(err).To(MatchError(io.ErrClosedPipe))
+		_, err = s.Write(stream)
+		Expect(err).To(MatchError(io.ErrClosedPipe))
+	})
+
+})
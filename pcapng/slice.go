@@ -0,0 +1,81 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"io"
+	"time"
+)
+
+// Slice copies the packets with timestamps in the time range [from, to) from
+// the pcapng stream r to the writer w. A zero from or to time leaves the time
+// range open at that end. Section headers (including their csharg capture
+// target meta data), interface descriptions, name resolution and decryption
+// secrets blocks are copied as-is, while packets outside the time range as
+// well as interface statistics get dropped. It returns the number of packets
+// copied.
+func Slice(w io.Writer, r io.Reader, from, to time.Time) (packets int, err error) {
+	pr := NewReader(r)
+	for {
+		b, err := pr.Next()
+		if err == io.EOF {
+			return packets, nil
+		}
+		if err != nil {
+			return packets, err
+		}
+		switch b.Type {
+		case BlockSHB:
+			// As we're going to drop blocks, the section length won't be
+			// correct anymore, so we need to mark it as unknown.
+			b.Endian.PutUint64(b.Body[8:16], ^uint64(0))
+		case BlockIDB, BlockNRB, BlockDSB:
+		case BlockEPB:
+			epb, err := b.EnhancedPacket()
+			if err != nil {
+				return packets, err
+			}
+			idb := pr.Interface(epb.InterfaceID)
+			if idb == nil {
+				continue
+			}
+			ts := idb.Time(epb.Timestamp)
+			if (!from.IsZero() && ts.Before(from)) || (!to.IsZero() && !ts.Before(to)) {
+				continue
+			}
+			packets++
+		default:
+			continue
+		}
+		if _, err := w.Write(b.Bytes()); err != nil {
+			return packets, err
+		}
+	}
+}
+
+// FirstPacketTime returns the timestamp of the first packet in the pcapng
+// stream r, or the zero time if there are no packets.
+func FirstPacketTime(r io.Reader) (time.Time, error) {
+	pr := NewReader(r)
+	for {
+		b, err := pr.Next()
+		if err == io.EOF {
+			return time.Time{}, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if b.Type != BlockEPB {
+			continue
+		}
+		epb, err := b.EnhancedPacket()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if idb := pr.Interface(epb.InterfaceID); idb != nil {
+			return idb.Time(epb.Timestamp), nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"io"
+)
+
+// Truncator truncates the packet data in a pcapng stream written to it to a
+// maximum snapshot length, keeping only the beginning of each packet, such as
+// its headers. The original lengths of the packets are kept. Interfaces with a
+// larger or no snapshot length get their snapshot length lowered accordingly.
+// All other blocks are passed through unmodified, except for section headers,
+// where the section length gets marked as unknown, as truncating changes the
+// lengths of packet blocks.
+type Truncator struct {
+	sink    io.Writer
+	snaplen uint32
+	scanner *Scanner
+	out     []byte // blocks completed by the current write.
+}
+
+var _ io.Writer = (*Truncator)(nil)
+
+// NewTruncator returns a new Truncator writing the pcapng stream to w, with
+// the packet data truncated to the specified snapshot length.
+func NewTruncator(w io.Writer, snaplen uint32) *Truncator {
+	t := &Truncator{
+		sink:    w,
+		snaplen: snaplen,
+	}
+	t.scanner = NewScanner(t.truncate)
+	return t
+}
+
+// Write writes octets from a pcapng stream into the truncator, which then
+// writes all blocks completed by these octets to its sink in a single write.
+func (t *Truncator) Write(p []byte) (n int, err error) {
+	t.out = t.out[:0]
+	_, err = t.scanner.Write(p)
+	if len(t.out) != 0 {
+		if _, werr := t.sink.Write(t.out); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// truncate the packet data of packet blocks and lowers the snapshot length of
+// interfaces, and queues the (truncated) block for writing to the sink.
+func (t *Truncator) truncate(b *Block) error {
+	switch b.Type {
+	case BlockSHB:
+		if len(b.Body) >= 16 {
+			b.Endian.PutUint64(b.Body[8:16], ^uint64(0))
+		}
+	case BlockIDB:
+		if len(b.Body) < 8 {
+			return ErrShortBlock
+		}
+		if snaplen := b.Endian.Uint32(b.Body[4:8]); snaplen == 0 || snaplen > t.snaplen {
+			b.Endian.PutUint32(b.Body[4:8], t.snaplen)
+		}
+	case BlockEPB:
+		epb, err := b.EnhancedPacket()
+		if err != nil {
+			return err
+		}
+		if epb.CapturedLength > t.snaplen {
+			epb.Data = epb.Data[:t.snaplen]
+			epb.CapturedLength = t.snaplen
+			b = NewEnhancedPacketBlock(b.Endian, epb)
+		}
+	case BlockSPB:
+		// Simple packets lack a captured length, which instead derives from
+		// the block length.
+		if len(b.Body) < 4 {
+			return ErrShortBlock
+		}
+		if uint64(len(b.Body)-4) > uint64(t.snaplen) {
+			body := make([]byte, 4+(int(t.snaplen)+3)&^3)
+			copy(body, b.Body[:4+t.snaplen])
+			b = &Block{Type: BlockSPB, Body: body, Endian: b.Endian}
+		}
+	}
+	t.out = append(t.out, b.Bytes()...)
+	return nil
+}
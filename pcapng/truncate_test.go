@@ -0,0 +1,111 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("truncating packet data", func() {
+
+	// truncated returns the truncated packet capture stream and its blocks.
+	truncated := func(stream []byte, snaplen uint32) (*Reader, []*Block) {
+		var out bytes.Buffer
+		t := NewTruncator(&out, snaplen)
+		for len(stream) > 0 {
+			n := 7
+			if n > len(stream) {
+				n = len(stream)
+			}
+			Expect(t.Write(stream[:n])).To(Equal(n))
+			stream = stream[n:]
+		}
+		r := NewReader(&out)
+		var blocks []*Block
+		for {
+			b, err := r.Next()
+			if err == io.EOF {
+				return r, blocks
+			}
+			Expect(err).NotTo(HaveOccurred())
+			blocks = append(blocks, b)
+		}
+	}
+
+	It("truncates packets written in arbitrary chunks", func() {
+		endian := binary.BigEndian
+		var stream bytes.Buffer
+		shb := NewSectionHeaderBlock(endian)
+		endian.PutUint64(shb.Body[8:16], 42)
+		stream.Write(shb.Bytes())
+		stream.Write(NewInterfaceDescriptionBlock(endian, &InterfaceDescription{
+			LinkType: LinkTypeEthernet,
+			SnapLen:  65535,
+		}).Bytes())
+		stream.Write(NewEnhancedPacketBlock(endian, &EnhancedPacket{
+			Timestamp: 1,
+			Data:      []byte("0123456789"),
+			Options:   []*Option{{Code: OptComment, Value: []byte("foo")}},
+		}).Bytes())
+		stream.Write(NewEnhancedPacketBlock(endian, &EnhancedPacket{
+			Timestamp: 2,
+			Data:      []byte("0123"),
+		}).Bytes())
+
+		r, blocks := truncated(stream.Bytes(), 6)
+		Expect(blocks).To(HaveLen(4))
+		Expect(r.SectionHeader().SectionLength).To(Equal(int64(-1)))
+		Expect(r.Interface(0).SnapLen).To(Equal(uint32(6)))
+
+		epb, err := blocks[2].EnhancedPacket()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(epb.Timestamp).To(Equal(uint64(1)))
+		Expect(epb.Data).To(Equal([]byte("012345")))
+		Expect(epb.CapturedLength).To(Equal(uint32(6)))
+		Expect(epb.OriginalLength).To(Equal(uint32(10)))
+		Expect(epb.Options).To(HaveLen(1))
+		Expect(epb.Options[0].Value).To(Equal([]byte("foo")))
+
+		epb, err = blocks[3].EnhancedPacket()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(epb.Data).To(Equal([]byte("0123")))
+		Expect(epb.OriginalLength).To(Equal(uint32(4)))
+	})
+
+	It("keeps smaller snap lengths of interfaces", func() {
+		stream := NewInterfaceDescriptionBlock(binary.LittleEndian, &InterfaceDescription{
+			LinkType: LinkTypeEthernet,
+			SnapLen:  64,
+		}).Bytes()
+		_, blocks := truncated(append(NewSectionHeaderBlock(binary.LittleEndian).Bytes(), stream...), 96)
+		Expect(blocks).To(HaveLen(2))
+		Expect(blocks[1].Bytes()).To(Equal(stream))
+	})
+
+	It("truncates simple packets", func() {
+		endian := binary.LittleEndian
+		body := make([]byte, 4+12)
+		endian.PutUint32(body[0:4], 10)
+		copy(body[4:], "0123456789")
+		var stream bytes.Buffer
+		stream.Write(NewSectionHeaderBlock(endian).Bytes())
+		stream.Write(NewInterfaceDescriptionBlock(endian, &InterfaceDescription{LinkType: LinkTypeEthernet}).Bytes())
+		stream.Write((&Block{Type: BlockSPB, Body: body, Endian: endian}).Bytes())
+
+		_, blocks := truncated(stream.Bytes(), 5)
+		Expect(blocks).To(HaveLen(3))
+		spb := blocks[2]
+		Expect(spb.Type).To(Equal(BlockSPB))
+		Expect(spb.Body).To(HaveLen(4 + 8))
+		Expect(endian.Uint32(spb.Body[0:4])).To(Equal(uint32(10)))
+		Expect(spb.Body[4:]).To(Equal([]byte("01234\x00\x00\x00")))
+	})
+
+})
@@ -0,0 +1,105 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/siemens/csharg/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrUnauthorized signals that the capture service rejected a request, either
+// because of missing or rejected credentials (ErrUnauthenticated) or because
+// capturing from the capture target isn't permitted (ErrForbidden). Errors
+// wrapping either of these also match ErrUnauthorized using errors.Is.
+var ErrUnauthorized = errors.New("not authorized")
+
+// ErrUnauthenticated signals that the capture service doesn't accept the
+// credentials, or that credentials are missing.
+var ErrUnauthenticated error = &authError{"not authenticated"}
+
+// ErrForbidden signals that the capture service accepts the credentials, but
+// denies capturing from the capture target.
+var ErrForbidden error = &authError{"capture not permitted"}
+
+// authError is a specific reason for a request not being authorized.
+type authError struct{ msg string }
+
+func (e *authError) Error() string { return e.msg }
+
+// Is reports whether the target is ErrUnauthorized.
+func (e *authError) Is(target error) bool { return target == ErrUnauthorized }
+
+// CanCapture checks whether capturing from the specified capture target is
+// permitted, without actually capturing. It probes the capture endpoint of the
+// capture service using a HEAD request carrying the same credentials and
+// capture target description as a capture would: the capture service
+// authenticates and authorizes this request, but doesn't start capturing.
+//
+// As target discovery fails when the credentials are rejected, CanCapture
+// probes the capture service even for capture targets it cannot complete, so
+// that rejected credentials take precedence over non-existing targets.
+func (hc *hostsharktank) CanCapture(t *api.Target) error {
+	if t == nil {
+		return errors.New("no capture target specified")
+	}
+	opts := &CaptureOptions{}
+	var cerr error
+	if hc.cache.IsEmpty() && needsTargetDiscovery(t) {
+		hc.Targets()
+		var completed *api.Target
+		if completed, cerr = CompleteTarget(t, opts, &hc.cache); cerr == nil {
+			t = completed
+		}
+	}
+	header, err := CaptureServiceHeaders(t, opts)
+	if err != nil {
+		return err
+	}
+	query, err := CaptureServiceQueryParams(t, opts)
+	if err != nil {
+		return err
+	}
+	apiurl := *hc.hosturl
+	apiurl.Path = path.Join(apiurl.Path, "capture")
+	apiurl.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodHead, apiurl.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header = *header
+	if err := hc.authorize(req.Header); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, err.Error())
+	}
+	log.Debugf("probing capture service %q, time limit %s", RedactURL(&apiurl), hc.opts.handshakeTimeout())
+	httpclient := &http.Client{
+		Timeout:   hc.opts.handshakeTimeout(),
+		Transport: hc.httpTransport(),
+	}
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return unreachable(err)
+	}
+	resp.Body.Close()
+	log.Debugf("capture service probe response: %s", resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthenticated
+	case resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w from target %q", ErrForbidden, t.QualifiedName())
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: capture service not found", ErrServiceUnreachable)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("capture service failed: %s", resp.Status)
+	}
+	// Any other response, such as a websocket-only capture endpoint
+	// complaining about the missing upgrade, means that the request passed
+	// authentication and authorization.
+	return cerr
+}
@@ -0,0 +1,59 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNotPrepared signals that a prepared capture has already been started or
+// cancelled.
+var ErrNotPrepared = errors.New("capture already started or cancelled")
+
+// PreparedCapture is a capture that has been prepared as far as possible
+// without requesting packets yet, so that multiple captures can be started at
+// the same instant.
+type PreparedCapture interface {
+	// Start the prepared capture, returning the CaptureStreamer controlling
+	// the running capture. A prepared capture can be started only once;
+	// starting it again returns ErrNotPrepared.
+	Start() (CaptureStreamer, error)
+	// Cancel the prepared capture without starting it, releasing any
+	// connection to the capture service. Cancel is idempotent and does
+	// nothing after the capture has been started.
+	Cancel()
+}
+
+// preparedCapture implements the PreparedCapture interface by deferring the
+// final step of starting a capture.
+type preparedCapture struct {
+	mu     sync.Mutex
+	start  func() (CaptureStreamer, error)
+	cancel func() // optional.
+}
+
+// Start the prepared capture.
+func (pc *preparedCapture) Start() (CaptureStreamer, error) {
+	pc.mu.Lock()
+	start := pc.start
+	pc.start, pc.cancel = nil, nil
+	pc.mu.Unlock()
+	if start == nil {
+		return nil, ErrNotPrepared
+	}
+	return start()
+}
+
+// Cancel the prepared capture, unless already started.
+func (pc *preparedCapture) Cancel() {
+	pc.mu.Lock()
+	cancel := pc.cancel
+	pc.start, pc.cancel = nil, nil
+	pc.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
@@ -0,0 +1,229 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements tunneling connections to the capture service through HTTP
+// CONNECT proxies, including proxies requiring basic or NTLM authentication.
+
+package csharg
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProxyAuth specifies the authentication scheme for an HTTP CONNECT proxy.
+type ProxyAuth string
+
+// Supported proxy authentication schemes.
+const (
+	ProxyAuthBasic ProxyAuth = "basic"
+	ProxyAuthNTLM  ProxyAuth = "ntlm"
+)
+
+// ProxyOptions configures an HTTP CONNECT proxy for connecting to the capture
+// service, taking precedence over any proxy configured in the environment.
+type ProxyOptions struct {
+	// URL of the proxy in the form of "http://host:port" or
+	// "https://host:port". Credentials in the URL are used unless Username
+	// is set.
+	URL *url.URL
+	// Username and Password optionally specify the proxy credentials. For
+	// NTLM, the username can be prefixed by the domain as in
+	// "DOMAIN\username".
+	Username string
+	Password string
+	// Auth specifies the authentication scheme, defaulting to basic
+	// authentication if there are credentials.
+	Auth ProxyAuth
+}
+
+// DialContextFunc is a function for dialing network connections, such as
+// net.Dialer.DialContext.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewProxyDialer returns a dial function that tunnels connections through the
+// specified HTTP CONNECT proxy. The proxy itself is connected to using the
+// specified dial function, or a plain net.Dialer if nil.
+func NewProxyDialer(opts *ProxyOptions, dial DialContextFunc) (DialContextFunc, error) {
+	if opts == nil || opts.URL == nil || opts.URL.Host == "" ||
+		(opts.URL.Scheme != "http" && opts.URL.Scheme != "https") {
+		return nil, fmt.Errorf("invalid proxy URL, expecting http[s]://host[:port]")
+	}
+	username, password := opts.Username, opts.Password
+	if username == "" && opts.URL.User != nil {
+		username = opts.URL.User.Username()
+		password, _ = opts.URL.User.Password()
+	}
+	auth := opts.Auth
+	switch auth {
+	case "":
+		if username != "" {
+			auth = ProxyAuthBasic
+		}
+	case ProxyAuthBasic, ProxyAuthNTLM:
+	default:
+		return nil, fmt.Errorf("unsupported proxy authentication %q", auth)
+	}
+	proxyhost := opts.URL.Host
+	if opts.URL.Port() == "" {
+		port := "80"
+		if opts.URL.Scheme == "https" {
+			port = "443"
+		}
+		proxyhost = net.JoinHostPort(opts.URL.Hostname(), port)
+	}
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	p := &proxyDialer{
+		scheme:   opts.URL.Scheme,
+		host:     proxyhost,
+		username: username,
+		password: password,
+		auth:     auth,
+		dial:     dial,
+	}
+	return p.DialContext, nil
+}
+
+// proxyDialer dials connections through an HTTP CONNECT proxy.
+type proxyDialer struct {
+	scheme   string
+	host     string
+	username string
+	password string
+	auth     ProxyAuth
+	dial     DialContextFunc
+}
+
+// DialContext connects to the proxy and then asks it to connect to the
+// specified address, authenticating with the proxy as necessary.
+func (p *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	log.Debugf("dialing %s through proxy %s", addr, p.host)
+	conn, err := p.dial(ctx, network, p.host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to proxy %s: %w", p.host, err)
+	}
+	if p.scheme == "https" {
+		tlsconn := tls.Client(conn, &tls.Config{ServerName: strings.Split(p.host, ":")[0]})
+		if err := tlsconn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("cannot connect to proxy %s: %w", p.host, err)
+		}
+		conn = tlsconn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	br := bufio.NewReader(conn)
+	if err := p.connect(conn, br, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// connect sends the CONNECT request, going through the NTLM handshake if
+// necessary.
+func (p *proxyDialer) connect(conn net.Conn, br *bufio.Reader, addr string) error {
+	var authorization string
+	user, domain, domainNeeded := ntlmssp.GetDomain(p.username)
+	switch p.auth {
+	case ProxyAuthBasic:
+		authorization = "Basic " + base64.StdEncoding.EncodeToString(
+			[]byte(p.username+":"+p.password))
+	case ProxyAuthNTLM:
+		negotiate, err := ntlmssp.NewNegotiateMessage(domain, "")
+		if err != nil {
+			return fmt.Errorf("cannot authenticate with proxy %s: %w", p.host, err)
+		}
+		authorization = "NTLM " + base64.StdEncoding.EncodeToString(negotiate)
+	}
+	resp, err := p.request(conn, br, addr, authorization)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusProxyAuthRequired && p.auth == ProxyAuthNTLM {
+		var challenge []byte
+		for _, hdr := range resp.Header.Values("Proxy-Authenticate") {
+			if strings.HasPrefix(hdr, "NTLM ") {
+				challenge, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(hdr, "NTLM "))
+				if err != nil {
+					return fmt.Errorf("invalid NTLM challenge from proxy %s: %w", p.host, err)
+				}
+				break
+			}
+		}
+		if challenge == nil {
+			return fmt.Errorf("proxy %s doesn't support NTLM authentication", p.host)
+		}
+		authenticate, err := ntlmssp.ProcessChallenge(challenge, user, p.password, domainNeeded)
+		if err != nil {
+			return fmt.Errorf("cannot authenticate with proxy %s: %w", p.host, err)
+		}
+		resp, err = p.request(conn, br, addr,
+			"NTLM "+base64.StdEncoding.EncodeToString(authenticate))
+		if err != nil {
+			return err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy %s refused to connect to %s: %s", p.host, addr, resp.Status)
+	}
+	return nil
+}
+
+// request sends a single CONNECT request with the specified (optional)
+// authorization and reads the response, draining any response body.
+func (p *proxyDialer) request(conn net.Conn, br *bufio.Reader, addr string, authorization string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if authorization != "" {
+		req.Header.Set("Proxy-Authorization", authorization)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("cannot talk to proxy %s: %w", p.host, err)
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot talk to proxy %s: %w", p.host, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// bufferedConn is a connection with some already buffered data to be read
+// first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads from the buffered data first, and then from the connection.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,55 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"io"
+
+	"github.com/siemens/csharg/api"
+)
+
+// CaptureReader starts capturing network traffic from a capture target using
+// the specified SharkTank, like Capture does, but returns a reader delivering
+// the packet capture stream instead of writing it to a writer. This suits
+// reader-oriented consumers, such as HTTP handlers and packet decoders.
+//
+// Reading returns io.EOF after the capture ended, or otherwise the error why
+// the capture failed (see also CaptureStreamer.Err). Closing the reader stops
+// the capture in an orderly manner, discarding any capture data not read yet.
+func CaptureReader(st SharkTank, t *api.Target, opts *CaptureOptions) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	cs, err := st.Capture(pw, t, opts)
+	if err != nil {
+		pw.Close()
+		return nil, err
+	}
+	go func() {
+		pw.CloseWithError(cs.WaitErr())
+	}()
+	return &captureReader{pr: pr, cs: cs}, nil
+}
+
+// captureReader delivers a packet capture stream written into a pipe by a
+// capture.
+type captureReader struct {
+	pr *io.PipeReader
+	cs CaptureStreamer
+}
+
+var _ io.ReadCloser = (*captureReader)(nil)
+
+// Read reads capture data from the packet capture stream.
+func (cr *captureReader) Read(p []byte) (int, error) {
+	return cr.pr.Read(p)
+}
+
+// Close stops the capture, waiting for it to terminate. Closing the pipe
+// first fails any pending write of capture data, so that the capture can
+// terminate without its capture data being read.
+func (cr *captureReader) Close() error {
+	cr.pr.Close()
+	cr.cs.Stop()
+	return nil
+}
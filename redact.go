@@ -0,0 +1,98 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces credentials in log output.
+const Redacted = "REDACTED"
+
+// sensitiveNames lists the (lower case) substrings of query parameter and
+// header names that indicate credentials.
+var sensitiveNames = []string{
+	"auth", "token", "password", "passwd", "secret", "apikey", "api-key", "api_key",
+	"cookie", "credential", "signature", "session",
+}
+
+// IsSensitive returns true if the specified query parameter, header or flag
+// name indicates credentials that must not be logged.
+func IsSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactURL returns the specified URL in string form for logging, with any
+// password as well as the values of query parameters carrying credentials,
+// such as “access_token”, replaced.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	ru := *u
+	if ru.User != nil {
+		if _, ok := ru.User.Password(); ok {
+			ru.User = url.UserPassword(ru.User.Username(), Redacted)
+		}
+	}
+	if ru.RawQuery != "" {
+		query := ru.Query()
+		redacted := false
+		for name, values := range query {
+			if !IsSensitive(name) {
+				continue
+			}
+			for idx := range values {
+				values[idx] = Redacted
+			}
+			redacted = true
+		}
+		if redacted {
+			ru.RawQuery = query.Encode()
+		}
+	}
+	return ru.String()
+}
+
+// RedactHeader returns a copy of the specified HTTP header for logging, with
+// the values of headers carrying credentials, such as “Authorization” and
+// “Cookie”, replaced.
+func RedactHeader(h http.Header) http.Header {
+	rh := h.Clone()
+	for name, values := range rh {
+		if !IsSensitive(name) {
+			continue
+		}
+		for idx := range values {
+			values[idx] = Redacted
+		}
+	}
+	return rh
+}
+
+// RedactError returns the specified error for logging, with credentials in
+// the URL of url.Error errors replaced.
+func RedactError(err error) error {
+	uerr, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	u, perr := url.Parse(uerr.URL)
+	if perr != nil {
+		return err
+	}
+	if redacted := RedactURL(u); redacted != uerr.URL {
+		return &url.Error{Op: uerr.Op, URL: redacted, Err: uerr.Err}
+	}
+	return err
+}
@@ -0,0 +1,481 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements a capture client replaying packet capture files instead of
+// contacting a capture service, so demos, trainings and tests work completely
+// offline.
+
+package csharg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/api"
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReplayTargetType is the type of capture targets replayed from packet capture
+// files that lack capture target information.
+const ReplayTargetType api.TargetType = "replay"
+
+// SharkTankReplayOptions defines options for replaying packet capture files.
+type SharkTankReplayOptions struct {
+	// RealTime paces replaying the packets according to their timestamps,
+	// instead of replaying them as fast as possible.
+	RealTime bool
+	// Namespace optionally specifies the namespace of pods named without an
+	// explicit namespace, instead of the “default” namespace.
+	Namespace string
+}
+
+// replaysharktank implements the SharkTank interface by replaying the pcapng
+// files in a directory as capture targets.
+type replaysharktank struct {
+	dir   string
+	opts  SharkTankReplayOptions
+	mu    sync.Mutex
+	files map[*api.Target]string // maps discovered capture targets to their files.
+	// Prepared and active replays, to be stopped when closing.
+	captures captureTracker
+}
+
+// NewSharkTankReplay returns a new capture client replaying the “*.pcapng”
+// files in the specified directory as capture targets. The capture targets are
+// described by the capture target information of the files, if present,
+// otherwise they are named after the files, without the file extension.
+//
+// Please note that capture filters and network interfaces specified in capture
+// options are not applied, but only recorded in the replayed packet capture
+// streams.
+func NewSharkTankReplay(dir string, opts *SharkTankReplayOptions) (SharkTank, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", dir)
+	}
+	rc := &replaysharktank{dir: dir}
+	if opts != nil {
+		rc.opts = *opts
+	}
+	return rc, nil
+}
+
+// Targets discovers the pcapng files in the replay directory as capture
+// targets.
+func (rc *replaysharktank) Targets() api.Targets {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.files == nil {
+		rc.discover()
+	}
+	ts := make(api.Targets, 0, len(rc.files))
+	for t := range rc.files {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(a, b int) bool {
+		return rc.files[ts[a]] < rc.files[ts[b]]
+	})
+	return ts
+}
+
+// TargetsContext discovers the pcapng files in the replay directory as capture
+// targets, unless the context is already done.
+func (rc *replaysharktank) TargetsContext(ctx context.Context) (api.Targets, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rc.Targets(), nil
+}
+
+// Clear the cached capture targets, so that the next discovery and capture
+// operation will scan the replay directory anew.
+func (rc *replaysharktank) Clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.files = nil
+}
+
+// Close stops all active replays and cancels all prepared replays. Afterwards,
+// captures fail with ErrClosed.
+func (rc *replaysharktank) Close() error {
+	rc.captures.close()
+	return nil
+}
+
+// discover scans the replay directory for pcapng files, skipping files that
+// cannot be read.
+func (rc *replaysharktank) discover() {
+	rc.files = map[*api.Target]string{}
+	paths, err := filepath.Glob(filepath.Join(rc.dir, "*.pcapng"))
+	if err != nil {
+		log.Errorf("cannot scan replay directory: %s", err.Error())
+		return
+	}
+	for _, path := range paths {
+		t, err := replayTarget(path)
+		if err != nil {
+			log.Errorf("skipping replay file %s: %s", path, err.Error())
+			continue
+		}
+		rc.files[t] = path
+	}
+	log.Debugf("discovered %d replay files in %s", len(rc.files), rc.dir)
+}
+
+// replayTarget returns the capture target description for the specified
+// pcapng file, based on the capture target information and the interfaces
+// described at the beginning of the file.
+func replayTarget(path string) (*api.Target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &api.Target{
+		Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Type: ReplayTargetType,
+	}
+	// The capture target information is in the first section header, which
+	// is followed by the descriptions of the network interfaces captured from.
+	r := pcapng.NewReader(f)
+	b, err := r.Next()
+	if err != nil {
+		return nil, err
+	}
+	sh, err := b.SectionHeader()
+	if err != nil {
+		return nil, err
+	}
+	if ci, _ := pcapng.ParseContainerInfo(sh.Comment()); ci != nil && ci.ContainerName != "" {
+		t.Type = api.TargetType(ci.ContainerType)
+		t.SetName(ci.ContainerName)
+		t.NodeName = ci.NodeName
+		t.ContainerID = ci.ContainerID
+		t.SandboxID = ci.SandboxID
+		if ci.ClusterInfo != nil && ci.ClusterInfo.UID != "" {
+			t.Cluster = &api.Cluster{UID: ci.ClusterInfo.UID}
+		}
+	}
+	for {
+		b, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		idesc, err := b.InterfaceDescription()
+		if err != nil {
+			break
+		}
+		if name := idesc.Name(); name != "" {
+			t.NetworkInterfaces = append(t.NetworkInterfaces, name)
+		}
+	}
+	return t, nil
+}
+
+// CapturePod replays the pcapng file of the named pod, defaulting to the
+// configured namespace, or otherwise the “default” namespace, if the pod name
+// lacks a namespace.
+func (rc *replaysharktank) CapturePod(w io.Writer, podname string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	return rc.CapturePodContext(context.Background(), w, podname, opts)
+}
+
+// CapturePodContext replays the pcapng file of the named pod like CapturePod,
+// stopping the replay when the context is done.
+func (rc *replaysharktank) CapturePodContext(ctx context.Context, w io.Writer, podname string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	namespace, name, err := api.ParsePodNameIn(podname, rc.opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return rc.CaptureContext(ctx, w, &api.Target{Name: name, Namespace: namespace, Type: api.TypePod}, opts)
+}
+
+// CaptureContainer replays the pcapng file of the named container on the
+// specified node. Instead of its name, the container can also be specified by
+// its (truncated) container or sandbox ID.
+func (rc *replaysharktank) CaptureContainer(w io.Writer, nodename, name string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	return rc.CaptureContainerContext(context.Background(), w, nodename, name, opts)
+}
+
+// CaptureContainerContext replays the pcapng file of the named container like
+// CaptureContainer, stopping the replay when the context is done.
+func (rc *replaysharktank) CaptureContainerContext(ctx context.Context, w io.Writer, nodename, name string, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	t := &api.Target{Name: name, NodeName: nodename}
+	if target, _ := rc.lookup(t); target == nil {
+		var cache TargetCache
+		cache.Set(rc.Targets())
+		tid, err := cache.containerByID(nodename, name)
+		if err != nil {
+			return nil, err
+		}
+		if tid != nil {
+			t = tid
+		}
+	}
+	return rc.CaptureContext(ctx, w, t, opts)
+}
+
+// Capture replays the pcapng file of the specified capture target, writing
+// the packet capture stream to w. Unless stopped, the capture ends after the
+// whole file has been replayed.
+func (rc *replaysharktank) Capture(w io.Writer, t *api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	return rc.CaptureContext(context.Background(), w, t, opts)
+}
+
+// CaptureContext replays the pcapng file of the specified capture target like
+// Capture, stopping the replay when the context is done.
+func (rc *replaysharktank) CaptureContext(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	pc, err := rc.PrepareContext(ctx, w, t, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pc.Start()
+}
+
+// CaptureMany replays the pcapng files of the specified capture targets at the
+// same time, merging their packets into a single section written to w.
+func (rc *replaysharktank) CaptureMany(w io.Writer, targets []*api.Target, opts *CaptureOptions) (cs CaptureStreamer, err error) {
+	return captureMany(rc, w, targets, opts)
+}
+
+// CaptureReader replays the pcapng file of the specified capture target,
+// returning a reader delivering the replayed packet capture stream. Closing
+// the reader stops the replay.
+func (rc *replaysharktank) CaptureReader(t *api.Target, opts *CaptureOptions) (io.ReadCloser, error) {
+	return CaptureReader(rc, t, opts)
+}
+
+// Prepare opens the pcapng file of the specified capture target, delaying
+// replaying it until the prepared capture is started.
+func (rc *replaysharktank) Prepare(w io.Writer, t *api.Target, opts *CaptureOptions) (PreparedCapture, error) {
+	return rc.PrepareContext(context.Background(), w, t, opts)
+}
+
+// PrepareContext opens the pcapng file of the specified capture target like
+// Prepare, stopping the replay when the context is done after the prepared
+// capture has been started.
+func (rc *replaysharktank) PrepareContext(ctx context.Context, w io.Writer, t *api.Target, opts *CaptureOptions) (PreparedCapture, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := rc.captures.reserve(); err != nil {
+		return nil, err
+	}
+	pc, err := rc.prepare(w, t, opts)
+	if err != nil {
+		rc.captures.release()
+		return nil, err
+	}
+	if pc, err = rc.captures.track(pc); err != nil {
+		return nil, err
+	}
+	return preparedContext(ctx, pc), nil
+}
+
+// prepare opens the pcapng file of the specified capture target.
+func (rc *replaysharktank) prepare(w io.Writer, t *api.Target, opts *CaptureOptions) (pc PreparedCapture, err error) {
+	if t == nil {
+		return nil, errors.New("no capture target specified")
+	}
+	if opts == nil {
+		opts = &CaptureOptions{}
+	}
+	target, path := rc.lookup(t)
+	if path == "" {
+		return nil, fmt.Errorf("%w %s", ErrTargetNotFound, t)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &preparedCapture{
+		start: func() (CaptureStreamer, error) {
+			log.Debugf("replaying %s for capture target %s", path, target)
+			rs := &replayStreamer{
+				stop: make(chan struct{}),
+				done: make(chan struct{}),
+			}
+			sink, finish := newStreamSink(w, target, opts, rs.Stop)
+			rs.stats = NewStatsWriter(sink)
+			rs.lifecycle = newLifecycle(target, opts, rs.stats)
+			go func() {
+				defer close(rs.done)
+				defer f.Close()
+				defer func() { rs.lifecycle.emit(EventClosed, rs.failure.Err()) }()
+				defer finish()
+				rs.lifecycle.emit(EventConnected, nil)
+				if err := rs.replay(rs.stats, f, rc.opts.RealTime); err != nil {
+					log.Errorf("replaying %s failed: %s", path, err.Error())
+				}
+			}()
+			return rs, nil
+		},
+		cancel: func() { f.Close() },
+	}, nil
+}
+
+// CanCapture checks that the specified capture target has a replay file, as
+// there are no credentials and permissions to check.
+func (rc *replaysharktank) CanCapture(t *api.Target) error {
+	if t == nil {
+		return errors.New("no capture target specified")
+	}
+	if _, path := rc.lookup(t); path == "" {
+		return fmt.Errorf("%w %s", ErrTargetNotFound, t)
+	}
+	return nil
+}
+
+// lookup returns the discovered capture target matching the specified
+// capture target description, together with its pcapng file, or an empty
+// path if there's no matching capture target.
+func (rc *replaysharktank) lookup(t *api.Target) (*api.Target, string) {
+	for _, target := range rc.Targets() {
+		if target.QualifiedName() != t.QualifiedName() || target.Prefix != t.Prefix ||
+			(t.NodeName != "" && target.NodeName != t.NodeName) ||
+			(t.Type != "" && target.Type != t.Type) {
+			continue
+		}
+		rc.mu.Lock()
+		path := rc.files[target]
+		rc.mu.Unlock()
+		return target, path
+	}
+	return nil, ""
+}
+
+// replayStreamer implements the CaptureStreamer interface for replays.
+type replayStreamer struct {
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+	stats     *StatsWriter
+	failure   captureFailure
+	lifecycle *lifecycle
+}
+
+// replay copies the pcapng blocks from r to w, optionally pacing the packets
+// according to their timestamps, until either all blocks have been copied or
+// the replay has been stopped. Reading and writing failures get recorded as
+// the failure of the replay.
+func (rs *replayStreamer) replay(w io.Writer, r io.Reader, realtime bool) error {
+	pr := pcapng.NewReader(r)
+	var start, first time.Time
+	for {
+		select {
+		case <-rs.stop:
+			return nil
+		default:
+		}
+		b, err := pr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			rs.failure.fail("receive", err)
+			return err
+		}
+		if realtime && b.Type == pcapng.BlockEPB {
+			if epb, err := b.EnhancedPacket(); err == nil {
+				if idesc := pr.Interface(epb.InterfaceID); idesc != nil {
+					ts := idesc.Time(epb.Timestamp)
+					if first.IsZero() {
+						first, start = ts, time.Now()
+					}
+					if delay := time.Until(start.Add(ts.Sub(first))); delay > 0 {
+						select {
+						case <-time.After(delay):
+						case <-rs.stop:
+							return nil
+						}
+					}
+				}
+			}
+		}
+		if _, err := w.Write(b.Bytes()); err != nil {
+			rs.failure.fail("write", err)
+			return err
+		}
+		rs.lifecycle.written()
+	}
+}
+
+// Stop the replay and wait for it to terminate.
+func (rs *replayStreamer) Stop() {
+	rs.stopOnce.Do(func() { close(rs.stop) })
+	<-rs.done
+}
+
+// Wait for the replay to terminate, without initiating it.
+func (rs *replayStreamer) Wait() {
+	<-rs.done
+}
+
+// StopAfter waits for the replay to terminate and terminates it after the
+// specified duration if necessary.
+func (rs *replayStreamer) StopAfter(d time.Duration) {
+	select {
+	case <-rs.done:
+	case <-time.After(d):
+		rs.Stop()
+	}
+}
+
+// StopAfterContext waits for the replay to terminate and terminates it after
+// the specified duration or when the context is done, whichever comes first.
+// It reports whether the replay ended by itself.
+func (rs *replayStreamer) StopAfterContext(ctx context.Context, d time.Duration) (bool, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-rs.done:
+		return true, nil
+	case <-timer.C:
+		rs.Stop()
+		return false, nil
+	case <-ctx.Done():
+		rs.Stop()
+		return false, ctx.Err()
+	}
+}
+
+// Stats returns the live statistics of the replay.
+func (rs *replayStreamer) Stats() CaptureStats {
+	return rs.stats.Stats()
+}
+
+// Err returns why the replay failed, if it failed.
+func (rs *replayStreamer) Err() error {
+	return rs.failure.Err()
+}
+
+// WaitErr waits for the replay to terminate and returns why it failed, if it
+// failed.
+func (rs *replayStreamer) WaitErr() error {
+	rs.Wait()
+	return rs.Err()
+}
+
+// StopErr stops the replay and returns why it failed before, if it failed.
+func (rs *replayStreamer) StopErr() error {
+	rs.Stop()
+	return rs.Err()
+}
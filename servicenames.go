@@ -0,0 +1,251 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/siemens/csharg/pcapng"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// servicesmarker describes the "magic" signature of the Kubernetes services
+// YAML document in the comment of name resolution blocks.
+const servicesmarker = "---\n# kubernetes services\n"
+
+// ServiceDiscoveryOptions defines how to query a Kubernetes API server for
+// services and their endpoints.
+type ServiceDiscoveryOptions struct {
+	// APIServer is the URL of the Kubernetes API server, such as
+	// "http://127.0.0.1:8001" when running "kubectl proxy".
+	APIServer string
+	// BearerToken optionally authenticates to the API server.
+	BearerToken string
+	// Namespace optionally restricts the discovery to a single namespace,
+	// otherwise services in all namespaces are discovered.
+	Namespace string
+	// Timeout optionally limits the duration of each API server request.
+	Timeout time.Duration
+	// TLSConfig optionally configures the TLS client of https API servers.
+	TLSConfig *tls.Config
+}
+
+// Service is a Kubernetes service with its virtual (cluster) IP addresses and
+// the addresses of its endpoints.
+type Service struct {
+	Namespace  string            `yaml:"namespace"`
+	Name       string            `yaml:"name"`
+	ClusterIPs []netip.Addr      `yaml:"cluster-ips,omitempty"`
+	Endpoints  []ServiceEndpoint `yaml:"endpoints,omitempty"`
+}
+
+// ServiceEndpoint is an endpoint address of a Kubernetes service, together
+// with the name of the pod behind it, if any.
+type ServiceEndpoint struct {
+	Addr netip.Addr `yaml:"ip"`
+	Pod  string     `yaml:"pod,omitempty"`
+}
+
+// DiscoverServices lists the Kubernetes services and their endpoints from the
+// API server, sorted by namespace and name.
+func DiscoverServices(ctx context.Context, opts *ServiceDiscoveryOptions) ([]Service, error) {
+	if opts == nil || opts.APIServer == "" {
+		return nil, fmt.Errorf("no Kubernetes API server specified")
+	}
+	apiurl, err := url.Parse(opts.APIServer)
+	if err != nil || (apiurl.Scheme != "http" && apiurl.Scheme != "https") {
+		return nil, fmt.Errorf("invalid Kubernetes API server URL %q", opts.APIServer)
+	}
+	httpclient := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: opts.TLSConfig,
+		},
+	}
+	var svclist struct {
+		Items []struct {
+			Metadata k8sMetadata `json:"metadata"`
+			Spec     struct {
+				ClusterIP  string   `json:"clusterIP"`
+				ClusterIPs []string `json:"clusterIPs"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	if err := listK8s(ctx, httpclient, apiurl, opts, "services", &svclist); err != nil {
+		return nil, err
+	}
+	var eplist struct {
+		Items []struct {
+			Metadata k8sMetadata `json:"metadata"`
+			Subsets  []struct {
+				Addresses         []k8sEndpointAddress `json:"addresses"`
+				NotReadyAddresses []k8sEndpointAddress `json:"notReadyAddresses"`
+			} `json:"subsets"`
+		} `json:"items"`
+	}
+	if err := listK8s(ctx, httpclient, apiurl, opts, "endpoints", &eplist); err != nil {
+		return nil, err
+	}
+	services := map[string]*Service{}
+	for _, item := range svclist.Items {
+		svc := &Service{Namespace: item.Metadata.Namespace, Name: item.Metadata.Name}
+		ips := item.Spec.ClusterIPs
+		if len(ips) == 0 && item.Spec.ClusterIP != "" {
+			ips = []string{item.Spec.ClusterIP}
+		}
+		for _, ip := range ips {
+			// Headless services have "None" instead of a cluster IP.
+			if addr, err := netip.ParseAddr(ip); err == nil {
+				svc.ClusterIPs = append(svc.ClusterIPs, addr)
+			}
+		}
+		services[svc.Namespace+"/"+svc.Name] = svc
+	}
+	for _, item := range eplist.Items {
+		svc, ok := services[item.Metadata.Namespace+"/"+item.Metadata.Name]
+		if !ok {
+			continue
+		}
+		for _, subset := range item.Subsets {
+			for _, epaddrs := range [][]k8sEndpointAddress{subset.Addresses, subset.NotReadyAddresses} {
+				for _, epaddr := range epaddrs {
+					addr, err := netip.ParseAddr(epaddr.IP)
+					if err != nil {
+						continue
+					}
+					ep := ServiceEndpoint{Addr: addr}
+					if epaddr.TargetRef != nil && epaddr.TargetRef.Kind == "Pod" {
+						ep.Pod = epaddr.TargetRef.Name
+					}
+					svc.Endpoints = append(svc.Endpoints, ep)
+				}
+			}
+		}
+	}
+	svcs := make([]Service, 0, len(services))
+	for _, svc := range services {
+		svcs = append(svcs, *svc)
+	}
+	sort.Slice(svcs, func(a, b int) bool {
+		if svcs[a].Namespace != svcs[b].Namespace {
+			return svcs[a].Namespace < svcs[b].Namespace
+		}
+		return svcs[a].Name < svcs[b].Name
+	})
+	log.Debugf("discovered %d Kubernetes services", len(svcs))
+	return svcs, nil
+}
+
+// k8sMetadata is the subset of Kubernetes object metadata we need.
+type k8sMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// k8sEndpointAddress is the subset of a Kubernetes endpoint address we need.
+type k8sEndpointAddress struct {
+	IP        string `json:"ip"`
+	TargetRef *struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"targetRef"`
+}
+
+// listK8s lists the specified core Kubernetes resources, decoding the JSON
+// list into v.
+func listK8s(ctx context.Context, httpclient *http.Client, apiurl *url.URL, opts *ServiceDiscoveryOptions, resource string, v interface{}) error {
+	listurl := *apiurl
+	if opts.Namespace != "" {
+		listurl.Path = path.Join(listurl.Path, "api/v1/namespaces", opts.Namespace, resource)
+	} else {
+		listurl.Path = path.Join(listurl.Path, "api/v1", resource)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listurl.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if opts.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.BearerToken)
+	}
+	log.Debugf("listing Kubernetes %s from %q", resource, RedactURL(&listurl))
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot list Kubernetes %s: %w", resource, RedactError(err))
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("cannot list Kubernetes %s: %w", resource, ErrUnauthenticated)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("cannot list Kubernetes %s: %s", resource, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("malformed Kubernetes %s list: %w", resource, err)
+	}
+	return nil
+}
+
+// ServiceNames returns the name resolution for the specified Kubernetes
+// services, to be added to captures using CaptureOptions.Names. Cluster IP
+// addresses resolve to "name.namespace.svc", and endpoint addresses to
+// "pod.namespace.pod", or "name.namespace.endpoint" for endpoints without a
+// pod. The name resolution additionally carries a comment with a YAML document
+// describing the services.
+func ServiceNames(services []Service) *pcapng.NameResolution {
+	nr := &pcapng.NameResolution{}
+	index := map[netip.Addr]int{}
+	add := func(addr netip.Addr, name string) {
+		idx, ok := index[addr]
+		if !ok {
+			index[addr] = len(nr.Records)
+			nr.Records = append(nr.Records, pcapng.NameRecord{Addr: addr, Names: []string{name}})
+			return
+		}
+		for _, n := range nr.Records[idx].Names {
+			if n == name {
+				return
+			}
+		}
+		nr.Records[idx].Names = append(nr.Records[idx].Names, name)
+	}
+	for _, svc := range services {
+		for _, addr := range svc.ClusterIPs {
+			add(addr, svc.Name+"."+svc.Namespace+".svc")
+		}
+	}
+	for _, svc := range services {
+		for _, ep := range svc.Endpoints {
+			if ep.Pod != "" {
+				add(ep.Addr, ep.Pod+"."+svc.Namespace+".pod")
+			} else {
+				add(ep.Addr, svc.Name+"."+svc.Namespace+".endpoint")
+			}
+		}
+	}
+	if len(services) > 0 {
+		var comment strings.Builder
+		comment.WriteString(servicesmarker)
+		if y, err := yaml.Marshal(services); err == nil {
+			comment.Write(y)
+			nr.Options = []*pcapng.Option{{Code: pcapng.OptComment, Value: []byte(comment.String())}}
+		} else {
+			log.Errorf("cannot create Kubernetes services YAML meta data: %s", err.Error())
+		}
+	}
+	return nr
+}
@@ -0,0 +1,75 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// SessionMetadata describes the business context of a capture session, such as
+// who requested the capture and why. The capture service can then record this
+// context in its server-side audit logs. All fields are optional.
+type SessionMetadata struct {
+	// Requester names the person or team on whose behalf the capture is
+	// taken, which might differ from the authenticated user.
+	Requester string
+	// Reason briefly describes why the capture is taken.
+	Reason string
+	// Ticket references an incident or change ticket ID.
+	Ticket string
+}
+
+// sessionField describes a single session metadata field and how it is sent
+// to the capture service, as a request header as well as a query parameter.
+type sessionField struct {
+	header string
+	param  string
+	value  string
+}
+
+// fields returns the non-empty session metadata fields.
+func (m *SessionMetadata) fields() []sessionField {
+	fields := make([]sessionField, 0, 3)
+	for _, f := range []sessionField{
+		{header: "Clustershark-Requester", param: "requester", value: m.Requester},
+		{header: "Clustershark-Reason", param: "reason", value: m.Reason},
+		{header: "Clustershark-Ticket", param: "ticket", value: m.Ticket},
+	} {
+		if f.value != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Validate returns an error if any session metadata field contains control
+// characters, such as line breaks, which cannot be sent in request headers.
+func (m *SessionMetadata) Validate() error {
+	for _, f := range m.fields() {
+		if strings.IndexFunc(f.value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("invalid session %s %q: must not contain control characters",
+				f.param, f.value)
+		}
+	}
+	return nil
+}
+
+// setHeader sets the session metadata request headers.
+func (m *SessionMetadata) setHeader(header http.Header) {
+	for _, f := range m.fields() {
+		header.Set(f.header, f.value)
+	}
+}
+
+// setQuery sets the session metadata query parameters.
+func (m *SessionMetadata) setQuery(values url.Values) {
+	for _, f := range m.fields() {
+		values.Set(f.param, f.value)
+	}
+}
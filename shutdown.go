@@ -0,0 +1,153 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed signals that a SharkTank has already been closed.
+var ErrClosed = errors.New("capture client closed")
+
+// ErrTooManyCaptures signals that a SharkTank already has as many concurrent
+// captures as allowed.
+var ErrTooManyCaptures = errors.New("too many concurrent captures")
+
+// captureTracker tracks the prepared and active captures of a SharkTank, so
+// that closing the SharkTank can cancel and stop them all, without its users
+// having to track each CaptureStreamer themselves. Additionally, it optionally
+// limits the number of concurrent captures.
+type captureTracker struct {
+	mu       sync.Mutex
+	closed   bool
+	limit    int // maximum number of concurrent captures, if positive.
+	slots    int // captures being prepared, prepared, or active.
+	prepared map[*preparedCapture]PreparedCapture
+	active   map[CaptureStreamer]struct{}
+}
+
+// err returns ErrClosed after the tracker has been closed, otherwise nil.
+func (ct *captureTracker) err() error {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// reserve a slot for a new capture before preparing it, failing with
+// ErrClosed after the tracker has been closed and with ErrTooManyCaptures when
+// there are no more slots available.
+func (ct *captureTracker) reserve() error {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.closed {
+		return ErrClosed
+	}
+	if ct.limit > 0 && ct.slots >= ct.limit {
+		return ErrTooManyCaptures
+	}
+	ct.slots++
+	return nil
+}
+
+// release a slot reserved before.
+func (ct *captureTracker) release() {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.slots--
+}
+
+// track the prepared capture in its reserved slot until it gets cancelled, or
+// otherwise its capture until it ends, releasing the slot afterwards. If the
+// tracker has already been closed, then the prepared capture gets cancelled
+// and ErrClosed returned.
+func (ct *captureTracker) track(pc PreparedCapture) (PreparedCapture, error) {
+	tpc := &preparedCapture{}
+	tpc.start = func() (CaptureStreamer, error) {
+		if !ct.untrack(tpc) {
+			pc.Cancel()
+			ct.release()
+			return nil, ErrClosed
+		}
+		cs, err := pc.Start()
+		if err != nil {
+			ct.release()
+			return nil, err
+		}
+		ct.mu.Lock()
+		if ct.closed {
+			ct.mu.Unlock()
+			cs.Stop()
+			ct.release()
+			return nil, ErrClosed
+		}
+		if ct.active == nil {
+			ct.active = map[CaptureStreamer]struct{}{}
+		}
+		ct.active[cs] = struct{}{}
+		ct.mu.Unlock()
+		go func() {
+			cs.Wait()
+			ct.mu.Lock()
+			delete(ct.active, cs)
+			ct.slots--
+			ct.mu.Unlock()
+		}()
+		return cs, nil
+	}
+	tpc.cancel = func() {
+		ct.untrack(tpc)
+		pc.Cancel()
+		ct.release()
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.closed {
+		pc.Cancel()
+		ct.slots--
+		return nil, ErrClosed
+	}
+	if ct.prepared == nil {
+		ct.prepared = map[*preparedCapture]PreparedCapture{}
+	}
+	ct.prepared[tpc] = pc
+	return tpc, nil
+}
+
+// untrack the prepared capture, returning false if the tracker has been
+// closed in the meantime.
+func (ct *captureTracker) untrack(tpc *preparedCapture) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	delete(ct.prepared, tpc)
+	return !ct.closed
+}
+
+// close the tracker, cancelling all prepared captures and stopping all active
+// captures, waiting for them to terminate. close is idempotent.
+func (ct *captureTracker) close() {
+	ct.mu.Lock()
+	ct.closed = true
+	prepared := ct.prepared
+	active := ct.active
+	ct.prepared, ct.active = nil, nil
+	ct.mu.Unlock()
+	for _, pc := range prepared {
+		pc.Cancel()
+	}
+	var wg sync.WaitGroup
+	for cs := range active {
+		wg.Add(1)
+		go func(cs CaptureStreamer) {
+			defer wg.Done()
+			cs.Stop()
+			cs.Wait()
+		}(cs)
+	}
+	wg.Wait()
+}
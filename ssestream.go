@@ -0,0 +1,116 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+// Implements decoding capture streams sent as Server-Sent Events, for
+// environments blocking websockets entirely.
+
+package csharg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Capture stream event types.
+const (
+	// CaptureEvent carries the next part of the capture stream as base64
+	// encoded data. Events without an event type are capture events too.
+	CaptureEvent = "pcapng"
+	// CaptureErrorEvent carries an error message, ending the capture stream.
+	CaptureErrorEvent = "error"
+)
+
+// eventStreamReader reads the capture stream data from Server-Sent Events.
+type eventStreamReader struct {
+	body  io.ReadCloser
+	r     *bufio.Reader
+	event string
+	data  bytes.Buffer // data lines of the current event.
+	chunk []byte       // remaining capture stream data of the last event.
+}
+
+// newEventStreamReader returns a reader for the capture stream data sent as
+// Server-Sent Events in the specified HTTP response body.
+func newEventStreamReader(body io.ReadCloser) *eventStreamReader {
+	return &eventStreamReader{
+		body: body,
+		r:    bufio.NewReaderSize(body, httpStreamBufferSize),
+	}
+}
+
+// Read the next capture stream data.
+func (r *eventStreamReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// next reads and dispatches the next event.
+func (r *eventStreamReader) next() error {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if len(line) == 0 {
+			if dispatched, err := r.dispatch(); dispatched || err != nil {
+				return err
+			}
+			continue
+		}
+		if line[0] == ':' {
+			continue // comment, such as a keep-alive.
+		}
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(field) {
+		case "event":
+			r.event = string(value)
+		case "data":
+			r.data.Write(value)
+		}
+	}
+}
+
+// dispatch the current event, returning true if it carried capture stream
+// data.
+func (r *eventStreamReader) dispatch() (bool, error) {
+	event := r.event
+	r.event = ""
+	defer r.data.Reset()
+	switch event {
+	case "", CaptureEvent:
+		if r.data.Len() == 0 {
+			return false, nil
+		}
+		chunk := make([]byte, base64.StdEncoding.DecodedLen(r.data.Len()))
+		n, err := base64.StdEncoding.Decode(chunk, r.data.Bytes())
+		if err != nil {
+			return false, fmt.Errorf("malformed capture event: %w", err)
+		}
+		r.chunk = chunk[:n]
+		return n > 0, nil
+	case CaptureErrorEvent:
+		return false, fmt.Errorf("capture service failed: %s", r.data.String())
+	}
+	return false, nil
+}
+
+// Close the underlying response body.
+func (r *eventStreamReader) Close() error {
+	return r.body.Close()
+}
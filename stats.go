@@ -0,0 +1,92 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/siemens/csharg/pcapng"
+)
+
+// CaptureStats are the statistics of a capture, updated live while the
+// capture is running.
+type CaptureStats struct {
+	// Number of network packets received from the capture service.
+	Packets uint64
+	// Number of octets of capture stream data received from the capture
+	// service.
+	Octets uint64
+	// When the capture started.
+	Started time.Time
+	// When the last network packet was received, or the zero time if none
+	// has been received yet.
+	LastPacket time.Time
+}
+
+// add the statistics of another capture, such as when capturing from
+// multiple targets at the same time.
+func (s *CaptureStats) add(other CaptureStats) {
+	s.Packets += other.Packets
+	s.Octets += other.Octets
+	if s.Started.IsZero() || (!other.Started.IsZero() && other.Started.Before(s.Started)) {
+		s.Started = other.Started
+	}
+	if other.LastPacket.After(s.LastPacket) {
+		s.LastPacket = other.LastPacket
+	}
+}
+
+// StatsWriter passes the capture stream data written to it on to its sink,
+// counting the octets and network packets of the capture stream.
+type StatsWriter struct {
+	sink    io.Writer
+	scanner *pcapng.Scanner
+
+	mu    sync.Mutex
+	stats CaptureStats
+}
+
+var _ io.Writer = (*StatsWriter)(nil)
+
+// NewStatsWriter returns a new StatsWriter writing to the specified sink,
+// with the capture starting now.
+func NewStatsWriter(sink io.Writer) *StatsWriter {
+	sw := &StatsWriter{
+		sink:  sink,
+		stats: CaptureStats{Started: time.Now()},
+	}
+	sw.scanner = pcapng.NewScanner(sw.scan)
+	return sw
+}
+
+// Write counts the capture stream data and then writes it to the sink.
+func (sw *StatsWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	sw.stats.Octets += uint64(len(p))
+	// Malformed capture streams simply aren't counted any further; it's not
+	// our business to fail them.
+	_, _ = sw.scanner.Write(p)
+	sw.mu.Unlock()
+	return sw.sink.Write(p)
+}
+
+// Stats returns the current statistics of the capture stream.
+func (sw *StatsWriter) Stats() CaptureStats {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.stats
+}
+
+// scan counts the network packets. Callers must hold the lock.
+func (sw *StatsWriter) scan(b *pcapng.Block) error {
+	switch b.Type {
+	case pcapng.BlockEPB, pcapng.BlockSPB:
+		sw.stats.Packets++
+		sw.stats.LastPacket = time.Now()
+	}
+	return nil
+}
@@ -7,11 +7,24 @@
 package csharg
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/siemens/csharg/api"
 )
 
+// ErrTargetNotFound signals that there is no capture target matching a capture
+// target description, such as a name or container ID.
+var ErrTargetNotFound = errors.New("non-existing target")
+
+// ErrAmbiguousTarget signals that multiple capture targets match a capture
+// target description, such as a truncated container ID or a target name
+// without a node name.
+var ErrAmbiguousTarget = errors.New("ambiguous capture target")
+
 // TargetCache caches and indexes a set of capture targets. It can safely be
 // accessed simultaneously by multiple go routines.
 type TargetCache struct {
@@ -49,7 +62,8 @@ func (tc *TargetCache) Targets() api.Targets {
 	return tc.ts
 }
 
-// Pod returns the pod capture target with the specified prefix and name. For
+// Pod returns the pod capture target with the specified name in
+// “namespace/name” convention. For
 // other types of targets the lookup will fail and return (nil, false). Use
 // OnNode() instead when looking up capture targets that may occur multiple
 // times inside a cluster on different cluster nodes.
@@ -59,13 +73,82 @@ func (tc *TargetCache) Pod(name string) (*api.Target, bool) {
 	if ts, ok := tc.index[targetkey{name: name}]; ok {
 		// Only return a match if there is exactly one pod capture target;
 		// otherwise, there is no match.
-		if len(ts) == 1 && ts[0].Type == "pod" {
+		if len(ts) == 1 && ts[0].Type.IsPod() {
 			return ts[0], true
 		}
 	}
 	return nil, false
 }
 
+// MatchPods returns the pod capture targets matching the specified name in
+// “namespace/name” convention, in kubectl style: if a pod has exactly this
+// name, then only this pod is returned. Otherwise, all pods in the namespace
+// whose names start with the name part are returned, such as
+// “frontend-5c9d7f-x2k4q” for “frontend”, sorted by their names.
+func (tc *TargetCache) MatchPods(podname string) api.Targets {
+	if t, ok := tc.Pod(podname); ok {
+		return api.Targets{t}
+	}
+	namespace, prefix, err := api.ParsePodName(podname)
+	if err != nil {
+		return nil
+	}
+	tc.m.Lock()
+	defer tc.m.Unlock()
+	pods := api.Targets{}
+	for _, t := range tc.ts {
+		if t.Type.IsPod() && t.Namespace == namespace && strings.HasPrefix(t.Name, prefix) {
+			pods = append(pods, t)
+		}
+	}
+	sort.Slice(pods, func(a, b int) bool { return pods[a].Name < pods[b].Name })
+	return pods
+}
+
+// MatchID returns the capture targets on the specified node, or on any node if
+// the node name is empty, whose container or sandbox IDs start with the
+// specified (truncated) ID, as shown by “docker ps” and “crictl ps”. The ID
+// might carry a container runtime scheme, such as “containerd://”. If a
+// capture target has exactly this ID, then only this target is returned.
+func (tc *TargetCache) MatchID(nodename, id string) api.Targets {
+	if _, rid, found := strings.Cut(id, "://"); found {
+		id = rid
+	}
+	if id == "" {
+		return nil
+	}
+	tc.m.Lock()
+	defer tc.m.Unlock()
+	targets := api.Targets{}
+	for _, t := range tc.ts {
+		if nodename != "" && t.NodeName != nodename {
+			continue
+		}
+		if t.ContainerID == id || t.SandboxID == id {
+			return api.Targets{t}
+		}
+		if (t.ContainerID != "" && strings.HasPrefix(t.ContainerID, id)) ||
+			(t.SandboxID != "" && strings.HasPrefix(t.SandboxID, id)) {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// containerByID returns the single capture target on the specified node whose
+// (truncated) container or sandbox ID is the specified ID, or nil if there is
+// no such capture target. It returns an error if the ID is ambiguous.
+func (tc *TargetCache) containerByID(nodename, id string) (*api.Target, error) {
+	targets := tc.MatchID(nodename, id)
+	switch len(targets) {
+	case 0:
+		return nil, nil
+	case 1:
+		return targets[0], nil
+	}
+	return nil, fmt.Errorf("%w: container ID %q matches %d capture targets", ErrAmbiguousTarget, id, len(targets))
+}
+
 // OnNode returns the capture target with the given prefix+name and located on
 // the specified cluster node. Use OnNode() when capturing from per-node
 // targets, such as a kubelet, et cetera. For capturing from pods, use Pod()
@@ -91,23 +174,24 @@ func (tc *TargetCache) Set(ts api.Targets) {
 	// Also build an index of capture targets...
 	tc.index = make(map[targetkey]api.Targets)
 	for _, t := range ts {
-		// Index the capture target just by its prefix+name.
+		// Index the capture target just by its prefix+name, where pods are
+		// indexed by their namespace/name.
 		k := targetkey{
 			prefix: t.Prefix,
-			name:   t.Name,
+			name:   t.QualifiedName(),
 		}
 		// Pod targets can only appear once in a cluster, but other capture
 		// targets might well appear multiple times with the same prefix+name,
 		// on different nodes. So we allocate some more capacity for non-pod
 		// targets.
 		cap := 1
-		if t.Type != "pod" {
+		if !t.Type.IsPod() {
 			cap = 10
 		}
 		if ttt, ok := tc.index[k]; ok {
 			tc.index[k] = append(ttt, t)
 		} else {
-			tc.index[k] = make(api.Targets, cap)
+			tc.index[k] = make(api.Targets, 1, cap)
 			tc.index[k][0] = t
 		}
 		// And now index the capture target by its nodename+prefix+name. This
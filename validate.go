@@ -0,0 +1,157 @@
+// (c) Siemens AG 2023
+//
+// SPDX-License-Identifier: MIT
+
+package csharg
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxNifNameLen is the maximum length of Linux network interface names
+// (IFNAMSIZ without the terminating NUL).
+const maxNifNameLen = 15
+
+// Validate checks the capture options for invalid and conflicting options, so
+// that problems are reported before contacting the capture service. It returns
+// an error describing all problems found, using the option names, or nil if
+// the options are valid. SharkTanks validate the capture options before
+// starting captures.
+func (opts *CaptureOptions) Validate() error {
+	if opts == nil {
+		return nil
+	}
+	var errs []error
+	nifs := map[string]bool{}
+	for idx, nif := range opts.Nifs {
+		if err := validateNifName(nif); err != nil {
+			errs = append(errs, fmt.Errorf("nifs[%d]: %w", idx, err))
+			continue
+		}
+		if nifs[nif] {
+			errs = append(errs, fmt.Errorf("nifs[%d]: duplicate network interface %q", idx, nif))
+		}
+		nifs[nif] = true
+	}
+	if nifs["all"] && len(opts.Nifs) > 1 {
+		errs = append(errs, errors.New(`nifs: "all" conflicts with individual network interfaces`))
+	}
+	if opts.NoLoopback && (nifs[loopbackNif] || nifs["all"]) {
+		errs = append(errs, errors.New("noloopback: conflicts with explicitly capturing from all or loopback network interfaces"))
+	}
+	if opts.Filter != "" {
+		if strings.TrimSpace(opts.Filter) == "" {
+			errs = append(errs, errors.New("filter: must not be blank when set"))
+		} else if strings.IndexFunc(opts.Filter, unicode.IsControl) >= 0 {
+			errs = append(errs, fmt.Errorf("filter: %q must not contain control characters", opts.Filter))
+		} else if err := ValidateFilter(opts.Filter); err != nil {
+			errs = append(errs, fmt.Errorf("filter: %w", err))
+		}
+	}
+	if opts.MaxBuffer < 0 {
+		errs = append(errs, fmt.Errorf("maxbuffer: invalid negative value %d", opts.MaxBuffer))
+	}
+	if opts.Heartbeat < 0 {
+		errs = append(errs, fmt.Errorf("heartbeat: invalid negative value %s", opts.Heartbeat))
+	}
+	if opts.Reconnect < 0 {
+		errs = append(errs, fmt.Errorf("reconnect: invalid negative value %s", opts.Reconnect))
+	}
+	if opts.MaxOutput < 0 {
+		errs = append(errs, fmt.Errorf("maxoutput: invalid negative value %d", opts.MaxOutput))
+	}
+	if opts.MaxPackets < 0 {
+		errs = append(errs, fmt.Errorf("maxpackets: invalid negative value %d", opts.MaxPackets))
+	}
+	if opts.SnapLen < 0 || opts.SnapLen > MaxSnapLen {
+		errs = append(errs, fmt.Errorf("snaplen: invalid value %d, expecting 0-%d", opts.SnapLen, MaxSnapLen))
+	}
+	if opts.Raw && opts.SnapLen > 0 {
+		errs = append(errs, errors.New("snaplen: cannot truncate raw capture streams"))
+	}
+	if err := opts.Session.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	vlans := map[uint16]bool{}
+	for idx, vlan := range opts.VLANs {
+		if vlan < MinVLAN || vlan > MaxVLAN {
+			errs = append(errs, fmt.Errorf("vlans[%d]: invalid VLAN ID %d, expecting %d-%d", idx, vlan, MinVLAN, MaxVLAN))
+			continue
+		}
+		if vlans[vlan] {
+			errs = append(errs, fmt.Errorf("vlans[%d]: duplicate VLAN ID %d", idx, vlan))
+		}
+		vlans[vlan] = true
+	}
+	encaps := map[Encapsulation]bool{}
+	for idx, encap := range opts.Decapsulate {
+		if !encap.valid() {
+			errs = append(errs, fmt.Errorf("decapsulate[%d]: invalid encapsulation %q, expecting %s",
+				idx, encap, encapsulationList(Encapsulations)))
+			continue
+		}
+		if encaps[encap] {
+			errs = append(errs, fmt.Errorf("decapsulate[%d]: duplicate encapsulation %q", idx, encap))
+		}
+		encaps[encap] = true
+	}
+	if opts.Raw && opts.Names != nil {
+		errs = append(errs, errors.New("names: cannot be added to raw capture streams"))
+	}
+	if opts.Raw && len(opts.InterfaceAliases) != 0 {
+		errs = append(errs, errors.New("interfacealiases: cannot rename interfaces of raw capture streams"))
+	}
+	if opts.Raw && opts.Heartbeat > 0 {
+		errs = append(errs, errors.New("heartbeat: cannot be added to raw capture streams"))
+	}
+	if opts.Raw && opts.Reconnect > 0 {
+		errs = append(errs, errors.New("reconnect: cannot resume raw capture streams"))
+	}
+	if opts.Alerts != nil {
+		if opts.Alerts.StallAfter < 0 {
+			errs = append(errs, fmt.Errorf("alerts.stallafter: invalid negative value %s", opts.Alerts.StallAfter))
+		}
+		if opts.Alerts.SlowWrite < 0 {
+			errs = append(errs, fmt.Errorf("alerts.slowwrite: invalid negative value %s", opts.Alerts.SlowWrite))
+		}
+	}
+	for _, name := range sortedAliasNames(opts.InterfaceAliases) {
+		if opts.InterfaceAliases[name] == "" {
+			errs = append(errs, fmt.Errorf("interfacealiases: empty alias for network interface %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortedAliasNames returns the kernel names of the aliased network interfaces
+// in sorted order, so that problems are reported in a stable order.
+func sortedAliasNames(aliases map[string]string) []string {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateNifName returns an error if the specified name isn't a valid Linux
+// network interface name.
+func validateNifName(nif string) error {
+	switch {
+	case nif == "":
+		return errors.New("network interface name must not be empty")
+	case len(nif) > maxNifNameLen:
+		return fmt.Errorf("network interface name %q exceeds %d characters", nif, maxNifNameLen)
+	case nif == "." || nif == "..":
+		return fmt.Errorf("invalid network interface name %q", nif)
+	case strings.IndexFunc(nif, func(r rune) bool {
+		return r == '/' || unicode.IsSpace(r) || unicode.IsControl(r)
+	}) >= 0:
+		return fmt.Errorf("network interface name %q must not contain slashes or whitespace", nif)
+	}
+	return nil
+}
@@ -21,7 +21,8 @@ type ReadingClientWebsocket struct {
 	m       sync.Mutex // Synchronize access to this websocket's state.
 	// Signals that the websocket is closed, by closing (sic!)
 	// this channel.
-	closed chan bool
+	closed    chan bool
+	closeOnce sync.Once
 }
 
 // New returns an enhanced gorilla websocket that does graceful close handling.
@@ -72,7 +73,7 @@ func (ws *ReadingClientWebsocket) Read() (data []byte, err error) {
 			log.Debug("server acknowledged websocket close")
 		}
 		ws.Conn.Close()
-		close(ws.closed) // sic(k)!
+		ws.markClosed() // sic(k)!
 		return nil, cerr
 	}
 }
@@ -106,10 +107,28 @@ func (ws *ReadingClientWebsocket) Close() {
 		// websocket close.
 		log.Debug("graceful websocket close timeout; forced closed")
 		ws.Conn.Close()
-		close(ws.closed)
+		ws.markClosed()
 	case <-ws.closed:
 		// Done: either just gracefully closed or already closed.
 		break
 	}
 	log.Debug("websocket gracefully closed.")
 }
+
+// Abort closes the underlaying transport connection right away, without a
+// graceful close, such as when the peer (server) has become unresponsive. A
+// later Close() then returns immediately.
+func (ws *ReadingClientWebsocket) Abort() {
+	ws.m.Lock()
+	ws.Closing = true
+	ws.m.Unlock()
+	log.Debug("aborting websocket")
+	ws.Conn.Close()
+	ws.markClosed()
+}
+
+// markClosed signals that the websocket is closed, regardless of whether it
+// has been closed gracefully, forcefully, or aborted.
+func (ws *ReadingClientWebsocket) markClosed() {
+	ws.closeOnce.Do(func() { close(ws.closed) })
+}